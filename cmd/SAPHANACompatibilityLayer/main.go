@@ -26,15 +26,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/expfmt"
 	"go.uber.org/zap"
-	"golang.org/x/sys/unix"
 
-	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/clientconn"
-	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
-	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/compatlayer"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/config"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/debug"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/logging"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/version"
@@ -42,18 +41,14 @@ import (
 
 //nolint:gochecknoglobals // flags are defined there to be visible in `bin/SAPHANACompatibilitylayer-testcover -h` output
 var (
-	debugAddrF       = flag.String("debug-addr", "127.0.0.1:8088", "debug address")
-	listenAddrF      = flag.String("listen-addr", "127.0.0.1:27017", "listen address")
-	modeF            = flag.String("mode", string(clientconn.AllModes[0]), fmt.Sprintf("operation mode: %v", clientconn.AllModes))
-	proxyAddrF       = flag.String("proxy-addr", "127.0.0.1:37017", "")
-	tlsF             = flag.Bool("tls", false, "enable TLS")
-	tlsCertFilePathF = flag.String("certFile", "", "path to file containing certificate for TLS")
-	tlsKeyFilePathF  = flag.String("keyFile", "", "path to file containing key for TLS")
-	versionF         = flag.Bool("version", false, "print version to stdout (full version, commit, branch, dirty flag) and exit")
-	testConnTimeoutF = flag.Duration("test-conn-timeout", 0, "test: set connection timeout")
-	saphanaURL       = flag.String("HANAConnectString", "", "SAP HANA Cloud instance connect string")
+	cfg      = config.Default()
+	versionF = flag.Bool("version", false, "print version to stdout (full version, commit, branch, dirty flag) and exit")
 )
 
+func init() {
+	cfg.AddFlags(flag.CommandLine)
+}
+
 func main() {
 	logging.Setup(zap.DebugLevel)
 	logger := zap.L()
@@ -69,6 +64,19 @@ func main() {
 		return
 	}
 
+	if cfg.SupportBundleFile != "" {
+		if err := compatlayer.CollectSupportBundle(context.Background(), cfg, cfg.SupportBundleFile, logger); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
 	logger.Info(
 		"Starting SAP HANA compatibility layer for MongoDB Wire Protocol "+info.Version+"...",
 		zap.String("version", info.Version),
@@ -77,52 +85,20 @@ func main() {
 		zap.Bool("dirty", info.Dirty),
 	)
 
-	var found bool
-	for _, m := range clientconn.AllModes {
-		if *modeF == string(m) {
-			found = true
-			break
-		}
-	}
-	if !found {
-		logger.Sugar().Fatalf("Unknown mode %q.", *modeF)
+	if cfg.LogUnredacted {
+		logger.Warn("Logging documents, filters and the messages of errors unredacted, which must only be used in development")
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), unix.SIGTERM, unix.SIGINT)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	go func() {
 		<-ctx.Done()
 		logger.Info("Stopping...")
 		stop()
 	}()
 
-	go debug.RunHandler(ctx, *debugAddrF, logger.Named("debug"))
-
-	hanaPool, err := hana.CreatePool(*saphanaURL, logger, false)
-	if err != nil {
-		logger.Fatal(err.Error())
-	}
+	go debug.RunHandler(ctx, cfg.DebugAddr, logger.Named("debug"))
 
-	defer hanaPool.Close()
-
-	listenerMetrics := clientconn.NewListenerMetrics()
-	handlersMetrics := handlers.NewMetrics()
-	prometheus.DefaultRegisterer.MustRegister(listenerMetrics, handlersMetrics)
-
-	l := clientconn.NewListener(&clientconn.NewListenerOpts{
-		ListenAddr:      *listenAddrF,
-		TLS:             *tlsF,
-		TLSCertFilePath: *tlsCertFilePathF,
-		TLSKeyFilePath:  *tlsKeyFilePathF,
-		ProxyAddr:       *proxyAddrF,
-		Mode:            clientconn.Mode(*modeF),
-		HanaPool:        hanaPool,
-		Logger:          logger.Named("listener"),
-		Metrics:         listenerMetrics,
-		HandlersMetrics: handlersMetrics,
-		TestConnTimeout: *testConnTimeoutF,
-	})
-
-	err = l.Run(ctx)
+	err := compatlayer.Run(ctx, cfg, &compatlayer.Opts{Logger: logger})
 	if err == nil || err == context.Canceled {
 		logger.Info("Listener stopped")
 	} else {
@@ -0,0 +1,295 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Command replaytool replays the requests of a connection recorded with the -record-dir flag
+// against the SAP HANA compatibility layer for MongoDB Wire Protocol or another wire protocol compatible service,
+// and compares the replies to the recorded ones.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/clientconn"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/logging"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+//nolint:gochecknoglobals // flags are defined there to be visible in `replaytool -h` output
+var (
+	addrF     = flag.String("addr", "127.0.0.1:27017", "address to replay the requests to")
+	compareF  = flag.Bool("compare", true, "compare the replies to the recorded ones, if the replies file exists")
+	showDiffF = flag.Bool("diff", false, "print the differences of the replies to the recorded ones")
+)
+
+func main() {
+	logging.Setup(zap.InfoLevel)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <recording>%s\n", os.Args[0], clientconn.RecordRequestsExt)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	res, err := run(flag.Arg(0))
+	if err != nil {
+		zap.S().Fatal(err)
+	}
+
+	fmt.Printf("Replayed %d requests, received %d replies, %d replies differ.\n", res.requests, res.replies, res.mismatches)
+	if res.mismatches > 0 {
+		os.Exit(1)
+	}
+}
+
+// run replays the recorded requests of the file to the address.
+func run(requestsFile string) (*result, error) {
+	requests, err := os.Open(requestsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer requests.Close()
+
+	var replies io.Reader
+	if *compareF {
+		repliesFile := strings.TrimSuffix(requestsFile, clientconn.RecordRequestsExt) + clientconn.RecordRepliesExt
+		f, err := os.Open(repliesFile)
+		switch {
+		case err == nil:
+			defer f.Close()
+			replies = f
+		case os.IsNotExist(err):
+			zap.S().Warnf("No recorded replies %s to compare to.", repliesFile)
+		default:
+			return nil, err
+		}
+	}
+
+	conn, err := net.Dial("tcp", *addrF)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var diff io.Writer
+	if *showDiffF {
+		diff = os.Stdout
+	}
+
+	return replay(conn, requests, replies, diff)
+}
+
+// result is the result of a replay.
+type result struct {
+	requests   int
+	replies    int
+	mismatches int
+}
+
+// replay sends the recorded requests to the connection and reads their replies.
+// If the recorded replies are given, the bodies of the replies are compared to them,
+// and their differences are written to diff, if not nil.
+//
+// Streams of exhaust replies with the moreToCome flag are not replayed, so the replay stops at their first reply.
+func replay(conn io.ReadWriter, requests, replies io.Reader, diff io.Writer) (*result, error) {
+	reqr := bufio.NewReader(requests)
+	connr := bufio.NewReader(conn)
+
+	var repr *bufio.Reader
+	if replies != nil {
+		repr = bufio.NewReader(replies)
+	}
+
+	var res result
+	for {
+		frame, err := readFrame(reqr)
+		if err == io.EOF {
+			return &res, nil
+		}
+		if err != nil {
+			return nil, lazyerrors.Errorf("request %d: %w", res.requests+1, err)
+		}
+
+		// requests are replayed as recorded, even if they can't be parsed
+		reqHeader, reqBody, err := wire.ReadMessage(bufio.NewReader(bytes.NewReader(frame)))
+		if reqHeader == nil {
+			return nil, lazyerrors.Errorf("request %d: %w", res.requests+1, err)
+		}
+
+		if _, err = conn.Write(frame); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		res.requests++
+
+		if wire.NoReply(reqHeader, reqBody) {
+			continue
+		}
+
+		_, resBody, err := wire.ReadMessage(connr)
+		if err != nil {
+			return nil, lazyerrors.Errorf("reply to request %d: %w", res.requests, err)
+		}
+		res.replies++
+
+		if repr != nil {
+			var expected string
+			if _, expectedBody, err := wire.ReadMessage(repr); err == nil {
+				expected = wire.DumpMsgBody(normalize(expectedBody))
+			} else if err != io.EOF {
+				return nil, lazyerrors.Errorf("recorded reply to request %d: %w", res.requests, err)
+			}
+
+			if actual := wire.DumpMsgBody(normalize(resBody)); actual != expected {
+				res.mismatches++
+
+				if diff != nil {
+					s, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+						A:        difflib.SplitLines(expected),
+						FromFile: "recorded",
+						B:        difflib.SplitLines(actual),
+						ToFile:   "replayed",
+						Context:  1,
+					})
+					if err != nil {
+						return nil, lazyerrors.Error(err)
+					}
+					fmt.Fprintf(diff, "Reply to request %d (%s):\n%s\n", res.requests, reqHeader.OpCode, s)
+				}
+			}
+		}
+
+		if msg, ok := resBody.(*wire.OpMsg); ok && msg.FlagBits.FlagSet(wire.OpMsgMoreToCome) {
+			zap.S().Warnf("Stopping at the exhaust reply to request %d.", res.requests)
+			return &res, nil
+		}
+	}
+}
+
+// volatileFields are the fields of replies which differ naturally between the recording and the replay,
+// like times and ids, and are replaced by normalize.
+//
+//nolint:gochecknoglobals // constant
+var volatileFields = map[string]struct{}{
+	"$clusterTime":  {},
+	"connectionId":  {},
+	"electionId":    {},
+	"localTime":     {},
+	"operationTime": {},
+}
+
+// normalize returns the body of a reply with the values of volatile fields and cursor ids replaced,
+// so that replies differing only in them are equal. Cursor ids are only compared for being zero,
+// which tells whether the cursor is exhausted.
+func normalize(body wire.MsgBody) wire.MsgBody {
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		doc, err := body.Document()
+		if err != nil {
+			return body
+		}
+
+		res := &wire.OpMsg{FlagBits: body.FlagBits}
+		if err = res.SetSections(wire.OpMsgSection{Documents: []types.Document{normalizeDocument(doc, false)}}); err != nil {
+			return body
+		}
+		return res
+
+	case *wire.OpReply:
+		res := *body
+		if res.CursorID != 0 {
+			res.CursorID = 1
+		}
+		res.Documents = make([]types.Document, len(body.Documents))
+		for i, doc := range body.Documents {
+			res.Documents[i] = normalizeDocument(doc, false)
+		}
+		return &res
+
+	default:
+		return body
+	}
+}
+
+// normalizeDocument returns the document with the values of volatile fields replaced by "<volatile>",
+// and the non-zero id of a cursor document replaced by 1.
+func normalizeDocument(doc types.Document, cursor bool) types.Document {
+	pairs := make([]any, 0, 2*len(doc.Keys()))
+	for _, k := range doc.Keys() {
+		v := doc.Map()[k]
+
+		_, volatile := volatileFields[k]
+		switch {
+		case cursor && k == "id":
+			if v != int64(0) {
+				v = int64(1)
+			}
+		case volatile:
+			v = "<volatile>"
+		default:
+			v = normalizeValue(v, k == "cursor")
+		}
+
+		pairs = append(pairs, k, v)
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// normalizeValue returns the value with the volatile fields of its documents replaced, see normalizeDocument.
+func normalizeValue(v any, cursor bool) any {
+	switch v := v.(type) {
+	case types.Document:
+		return normalizeDocument(v, cursor)
+	case *types.Array:
+		res := types.MustNewArray()
+		for i := 0; i < v.Len(); i++ {
+			elem, _ := v.Get(i)
+			if err := res.Append(normalizeValue(elem, false)); err != nil {
+				panic(err)
+			}
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// readFrame reads the raw bytes of the next message.
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	b, err := r.Peek(4)
+	if err != nil {
+		if err == io.EOF && len(b) == 0 {
+			return nil, io.EOF
+		}
+		return nil, lazyerrors.Error(err)
+	}
+
+	l := int32(binary.LittleEndian.Uint32(b))
+	if l < wire.MsgHeaderLen {
+		return nil, lazyerrors.Errorf("invalid message length %d", l)
+	}
+
+	frame := make([]byte, l)
+	if _, err = io.ReadFull(r, frame); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return frame, nil
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// writeMsg writes an OP_MSG with the document to the writer.
+func writeMsg(t *testing.T, w *bufio.Writer, requestID int32, doc types.Document) {
+	t.Helper()
+
+	var msg wire.OpMsg
+	require.NoError(t, msg.SetSections(wire.OpMsgSection{Documents: []types.Document{doc}}))
+	b, err := msg.MarshalBinary()
+	require.NoError(t, err)
+
+	header := &wire.MsgHeader{MessageLength: int32(wire.MsgHeaderLen + len(b)), RequestID: requestID, OpCode: wire.OP_MSG}
+	require.NoError(t, wire.WriteMessage(w, header, &msg))
+	require.NoError(t, w.Flush())
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	var requests, replies bytes.Buffer
+	reqw := bufio.NewWriter(&requests)
+	writeMsg(t, reqw, 1, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+
+	insert := &wire.OpInsert{FullCollectionName: "test.values", Documents: []types.Document{types.MustMakeDocument("_id", int32(1))}}
+	b, err := insert.MarshalBinary()
+	require.NoError(t, err)
+	require.NoError(t, wire.WriteMessage(reqw, &wire.MsgHeader{MessageLength: int32(wire.MsgHeaderLen + len(b)), RequestID: 2, OpCode: wire.OP_INSERT}, insert))
+
+	writeMsg(t, reqw, 3, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+
+	repw := bufio.NewWriter(&replies)
+	writeMsg(t, repw, 11, types.MustMakeDocument("ok", float64(1)))
+	writeMsg(t, repw, 12, types.MustMakeDocument("ok", float64(0)))
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	// the server replies to every request which expects a reply with {ok: 1}
+	go func() {
+		defer server.Close()
+
+		r := bufio.NewReader(server)
+		w := bufio.NewWriter(server)
+		for {
+			header, body, err := wire.ReadMessage(r)
+			if err != nil {
+				return
+			}
+			if !wire.NoReply(header, body) {
+				writeMsg(t, w, header.RequestID+10, types.MustMakeDocument("ok", float64(1)))
+			}
+		}
+	}()
+
+	var diff bytes.Buffer
+	res, err := replay(client, &requests, &replies, &diff)
+	require.NoError(t, err)
+
+	assert.Equal(t, &result{requests: 3, replies: 2, mismatches: 1}, res)
+	assert.Contains(t, diff.String(), "Reply to request 3 (OP_MSG):")
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	reply := func(localTime time.Time, cursorID int64) wire.MsgBody {
+		var msg wire.OpMsg
+		require.NoError(t, msg.SetSections(wire.OpMsgSection{Documents: []types.Document{types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", types.MustNewArray(types.MustMakeDocument("localTime", int32(1))),
+				"id", cursorID,
+				"ns", "test.values",
+			),
+			"localTime", localTime,
+			"ok", float64(1),
+		)}}))
+		return &msg
+	}
+
+	recorded := wire.DumpMsgBody(normalize(reply(time.Unix(1, 0), 42)))
+	assert.Equal(t, recorded, wire.DumpMsgBody(normalize(reply(time.Unix(2, 0), 43))))
+	assert.NotEqual(t, recorded, wire.DumpMsgBody(normalize(reply(time.Unix(2, 0), 0))))
+}
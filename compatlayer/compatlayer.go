@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package compatlayer runs the SAP HANA compatibility layer for MongoDB Wire Protocol
+// embedded in other applications.
+//
+// Embedding applications may intercept the commands with a Middleware working on the
+// documents of the official MongoDB Go driver, which are converted from and to the internal ones.
+package compatlayer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/clientconn"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/config"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// Config is the configuration of the compatibility layer, like given by the flags of the binary.
+type Config = config.Config
+
+// DefaultConfig returns the configuration with the defaults of the flags.
+func DefaultConfig() Config {
+	return config.Default()
+}
+
+// Opts are the options of Run which are not part of the configuration.
+type Opts struct {
+	// Logger is used for the logs, zap.L() if nil.
+	Logger *zap.Logger
+
+	// Middlewares intercept the commands of the clients in the given order, see Middleware.
+	Middlewares []Middleware
+}
+
+// Run runs the compatibility layer with the configuration until ctx is canceled.
+//
+// The Prometheus metrics are registered with prometheus.DefaultRegisterer,
+// so Run must only be called once per process.
+func Run(ctx context.Context, cfg Config, opts *Opts) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	logger := zap.L()
+	if opts != nil && opts.Logger != nil {
+		logger = opts.Logger
+	}
+
+	var middlewares []handlers.Middleware
+	if opts != nil {
+		for _, m := range opts.Middlewares {
+			middlewares = append(middlewares, &middleware{m: m})
+		}
+	}
+
+	hanaPool, err := createPool(&cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	defer hanaPool.Close()
+
+	var quotas *crud.Quotas
+	if cfg.QuotasFile != "" {
+		if quotas, err = crud.LoadQuotas(cfg.QuotasFile); err != nil {
+			return err
+		}
+
+		if cfg.QuotasReloadInterval > 0 {
+			go quotas.Watch(ctx, cfg.QuotasReloadInterval, logger.Named("quotas"))
+		}
+	}
+
+	var mappings *handlers.Mappings
+	if cfg.MappingsFile != "" {
+		if mappings, err = handlers.LoadMappings(cfg.MappingsFile); err != nil {
+			return err
+		}
+
+		if cfg.MappingsReloadInterval > 0 {
+			go mappings.Watch(ctx, cfg.MappingsReloadInterval, logger.Named("mappings"))
+		}
+	}
+
+	var sandbox *handlers.Sandbox
+	if cfg.Sandbox {
+		sandbox = &handlers.Sandbox{
+			MaxTime:      cfg.SandboxMaxTime,
+			MaxDocuments: int32(cfg.SandboxMaxDocuments),
+		}
+	}
+
+	var capture *handlers.Capture
+	if cfg.CaptureFile != "" {
+		f, err := os.OpenFile(cfg.CaptureFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		capture = handlers.NewCapture(f)
+		logger.Warn("Capturing all commands", zap.String("file", cfg.CaptureFile))
+	}
+
+	listenerMetrics := clientconn.NewListenerMetrics()
+	handlersMetrics := handlers.NewMetrics()
+	wireMetrics := wire.NewMetrics()
+	if err = registerMetrics(listenerMetrics, handlersMetrics, wireMetrics); err != nil {
+		return err
+	}
+
+	var coalescer *crud.Coalescer
+	if cfg.CoalescePointReads {
+		coalescer = crud.NewCoalescer()
+		if err = registerMetrics(coalescer); err != nil {
+			return err
+		}
+	}
+
+	keyValidation := common.RejectDottedDollarKeys
+	if cfg.AllowDottedDollarKeys {
+		keyValidation = common.AllowDottedDollarKeys
+	}
+
+	var supportBundle *support.Collector
+	if cfg.SupportBundleCommand {
+		supportBundle = &support.Collector{
+			Config:   cfg.Sanitized(),
+			Gatherer: prometheus.DefaultGatherer,
+			HANA:     hanaPool.DB,
+			Report: func() (any, error) {
+				return handlersMetrics.CompatibilityReport()
+			},
+		}
+	}
+
+	var userPools hana.UserPoolOpener
+	if cfg.HANAPassthrough {
+		userPools = hana.NewUserPoolOpener(cfg.HANAConnectString, hanaTLSOpts(&cfg), hanaPoolOpts(&cfg))
+		logger.Info("Passing the SAP HANA credentials of clients through")
+	}
+
+	l := clientconn.NewListener(&clientconn.NewListenerOpts{
+		ListenAddrs:     cfg.ListenAddrs,
+		TLSCertFile:     cfg.TLSCertFile,
+		TLSKeyFile:      cfg.TLSKeyFile,
+		TLSCAFile:       cfg.TLSCAFile,
+		ProxyAddr:       cfg.ProxyAddr,
+		Mode:            cfg.Mode,
+		HanaPool:        hanaPool,
+		Logger:          logger.Named("listener"),
+		Metrics:         listenerMetrics,
+		HandlersMetrics: handlersMetrics,
+		WireMetrics:     wireMetrics,
+		Quotas:          quotas,
+		Mappings:        mappings,
+		Coalescer:       coalescer,
+		CursorReadAhead: cfg.CursorReadAheadBytes,
+		KeyValidation:   keyValidation,
+		Middlewares:     middlewares,
+		Sandbox:         sandbox,
+		SupportBundle:   supportBundle,
+		SlowCommand:     cfg.SlowCommandThreshold,
+		TestConnTimeout: cfg.TestConnTimeout,
+		RecordDir:       cfg.RecordDir,
+
+		TLSRequireClientCert: cfg.TLSRequireClientCert,
+		RequireAuth:          cfg.Auth,
+		MaxConnections:       cfg.MaxConnections,
+		ProxyProtocol:        cfg.ProxyProtocol,
+		ProxyProtocolTrusted: cfg.ProxyProtocolTrusted,
+		DiffReportFile:       cfg.DiffReportFile,
+		Capture:              capture,
+		UserPools:            userPools,
+		ReadOnly:             cfg.ReadOnly,
+		LogUnredacted:        cfg.LogUnredacted,
+	})
+
+	return l.Run(ctx)
+}
+
+// registerMetrics registers the collectors with prometheus.DefaultRegisterer.
+func registerMetrics(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := prometheus.DefaultRegisterer.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CollectSupportBundle writes a support bundle to the file, without running the compatibility layer.
+// The problems of an invalid configuration are part of the bundle.
+func CollectSupportBundle(ctx context.Context, cfg Config, file string, logger *zap.Logger) error {
+	c := &support.Collector{
+		Config:   cfg.Sanitized(),
+		Gatherer: prometheus.DefaultGatherer,
+	}
+
+	var verr *config.ValidationError
+	if err := cfg.Validate(); errors.As(err, &verr) {
+		c.ConfigProblems = verr.Problems
+	}
+
+	if cfg.HANAConnectString != "" {
+		hanaPool, err := createPool(&cfg, logger)
+		if err != nil {
+			c.ConfigProblems = append(c.ConfigProblems, err.Error())
+		} else {
+			defer hanaPool.Close()
+			c.HANA = hanaPool.DB
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+
+	if err = c.Collect(ctx, f); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	logger.Info("Support bundle written", zap.String("file", file))
+
+	return nil
+}
+
+// createPool sets up the connection to SAP HANA, authenticated with JWT tokens if a token file or OAuth token URL is given.
+func createPool(cfg *Config, logger *zap.Logger) (*hana.Hpool, error) {
+	var tokens *hana.TokenSource
+	switch {
+	case cfg.HANATokenFile != "":
+		tokens = hana.NewFileTokenSource(cfg.HANATokenFile)
+	case cfg.HANAOAuthTokenURL != "":
+		secret, err := os.ReadFile(cfg.HANAOAuthClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = hana.NewOAuthTokenSource(cfg.HANAOAuthTokenURL, cfg.HANAOAuthClientID, strings.TrimSpace(string(secret)), http.DefaultClient)
+	default:
+		return hana.CreatePool(cfg.HANAConnectString, hanaTLSOpts(cfg), hanaPoolOpts(cfg), logger, false)
+	}
+
+	return hana.CreateTokenPool(cfg.HANAConnectString, hanaTLSOpts(cfg), hanaPoolOpts(cfg), tokens, logger.Named("hana"))
+}
+
+// hanaPoolOpts returns the options sizing the pool of SAP HANA connections.
+func hanaPoolOpts(cfg *Config) *hana.PoolOpts {
+	return &hana.PoolOpts{
+		MaxOpenConns:    cfg.HANAMaxOpenConns,
+		MaxIdleConns:    cfg.HANAMaxIdleConns,
+		ConnMaxLifetime: cfg.HANAConnMaxLifetime,
+		AcquireTimeout:  cfg.HANAAcquireTimeout,
+		OptionsCacheTTL: cfg.HANAOptionsCacheTTL,
+	}
+}
+
+// hanaTLSOpts returns the options verifying the TLS certificate of SAP HANA,
+// or nil if the TLS parameters of the connect string are used.
+func hanaTLSOpts(cfg *Config) *hana.TLSOpts {
+	if !cfg.HANATLS() {
+		return nil
+	}
+
+	return &hana.TLSOpts{
+		CAFile:         cfg.HANATLSCAFile,
+		VerifyHostname: cfg.HANATLSVerifyHostname,
+		PinnedSHA256:   cfg.HANATLSPinnedSHA256,
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package compatlayer
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types/driverbson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// Middleware intercepts the commands of the clients, for example for auditing, caching or rewriting.
+//
+// Middlewares are called in the order of Opts.Middlewares: first PreCommand of every middleware,
+// then the command and last PostCommand of every middleware in reverse order.
+//
+// To fail a command with a MongoDB error, PreCommand or PostCommand return a reply
+// with ok: 0, errmsg, code and codeName. Other errors are returned to the client as InternalError.
+type Middleware interface {
+	// PreCommand is called with the request document before the command runs.
+	//
+	// A non-nil rewritten document replaces the request for later middlewares and the command.
+	// A non-nil reply or error answers the request: PreCommand of later middlewares and the command
+	// are skipped, but PostCommand of this and all earlier middlewares is still called.
+	PreCommand(ctx context.Context, command bson.D) (rewritten, reply bson.D, err error)
+
+	// PostCommand is called with the request document and the reply or error of the command.
+	// It returns the reply or error passed on to the earlier middlewares and the client,
+	// usually the given ones.
+	PostCommand(ctx context.Context, command, reply bson.D, err error) (bson.D, error)
+}
+
+// middleware is the handlers.Middleware of a Middleware.
+type middleware struct {
+	m Middleware
+}
+
+// PreCommand implements handlers.Middleware.
+func (m *middleware) PreCommand(ctx context.Context, document types.Document) (types.Document, *wire.OpMsg, error) {
+	command, err := driverbson.FromDocument(document)
+	if err != nil {
+		return types.Document{}, nil, lazyerrors.Error(err)
+	}
+
+	rewritten, reply, err := m.m.PreCommand(ctx, command)
+	if err != nil {
+		return types.Document{}, nil, err
+	}
+
+	var res types.Document
+	if rewritten != nil {
+		if res, err = driverbson.ToDocument(rewritten); err != nil {
+			return types.Document{}, nil, lazyerrors.Error(err)
+		}
+	}
+
+	if reply == nil {
+		return res, nil, nil
+	}
+
+	msg, err := replyMsg(reply)
+	if err != nil {
+		return types.Document{}, nil, err
+	}
+
+	return res, msg, nil
+}
+
+// PostCommand implements handlers.Middleware.
+func (m *middleware) PostCommand(ctx context.Context, document types.Document, msg *wire.OpMsg, err error) (*wire.OpMsg, error) {
+	command, cerr := driverbson.FromDocument(document)
+	if cerr != nil {
+		return nil, lazyerrors.Error(cerr)
+	}
+
+	var reply bson.D
+	if msg != nil {
+		doc, derr := msg.Document()
+		if derr != nil {
+			return nil, lazyerrors.Error(derr)
+		}
+		if reply, derr = driverbson.FromDocument(doc); derr != nil {
+			return nil, lazyerrors.Error(derr)
+		}
+	}
+
+	reply, err = m.m.PostCommand(ctx, command, reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, lazyerrors.New("PostCommand returned neither a reply nor an error")
+	}
+
+	return replyMsg(reply)
+}
+
+// replyMsg returns the OP_MSG of the reply document.
+func replyMsg(reply bson.D) (*wire.OpMsg, error) {
+	doc, err := driverbson.ToDocument(reply)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	var msg wire.OpMsg
+	if err = msg.SetSections(wire.OpMsgSection{Documents: []types.Document{doc}}); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &msg, nil
+}
+
+// check interfaces
+var (
+	_ handlers.Middleware = (*middleware)(nil)
+)
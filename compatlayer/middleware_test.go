@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package compatlayer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// testMiddleware runs the given functions.
+type testMiddleware struct {
+	pre  func(command bson.D) (bson.D, bson.D, error)
+	post func(command, reply bson.D, err error) (bson.D, error)
+}
+
+func (m *testMiddleware) PreCommand(ctx context.Context, command bson.D) (bson.D, bson.D, error) {
+	return m.pre(command)
+}
+
+func (m *testMiddleware) PostCommand(ctx context.Context, command, reply bson.D, err error) (bson.D, error) {
+	return m.post(command, reply, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	document := types.MustMakeDocument("find", "users", "$db", "test")
+
+	t.Run("PreCommand", func(t *testing.T) {
+		t.Parallel()
+
+		m := &middleware{m: &testMiddleware{pre: func(command bson.D) (bson.D, bson.D, error) {
+			assert.Equal(t, bson.D{{Key: "find", Value: "users"}, {Key: "$db", Value: "test"}}, command)
+			return nil, nil, nil
+		}}}
+		rewritten, reply, err := m.PreCommand(ctx, document)
+		require.NoError(t, err)
+		assert.Nil(t, rewritten.Map())
+		assert.Nil(t, reply)
+
+		m = &middleware{m: &testMiddleware{pre: func(command bson.D) (bson.D, bson.D, error) {
+			rewritten := bson.D{{Key: "find", Value: "archive"}, {Key: "$db", Value: "test"}}
+			return rewritten, bson.D{{Key: "ok", Value: float64(0)}, {Key: "code", Value: int32(13)}}, nil
+		}}}
+		rewritten, reply, err = m.PreCommand(ctx, document)
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("find", "archive", "$db", "test"), rewritten)
+		actual, err := reply.Document()
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(0), "code", int32(13)), actual)
+	})
+
+	t.Run("PostCommand", func(t *testing.T) {
+		t.Parallel()
+
+		var msg wire.OpMsg
+		require.NoError(t, msg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{types.MustMakeDocument("n", int32(1), "ok", float64(1))},
+		}))
+
+		m := &middleware{m: &testMiddleware{post: func(command, reply bson.D, err error) (bson.D, error) {
+			assert.Equal(t, bson.D{{Key: "find", Value: "users"}, {Key: "$db", Value: "test"}}, command)
+			assert.Equal(t, bson.D{{Key: "n", Value: int32(1)}, {Key: "ok", Value: float64(1)}}, reply)
+			return append(reply, bson.E{Key: "audited", Value: true}), err
+		}}}
+		reply, err := m.PostCommand(ctx, document, &msg, nil)
+		require.NoError(t, err)
+		actual, err := reply.Document()
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("n", int32(1), "ok", float64(1), "audited", true), actual)
+
+		commandErr := errors.New("command failed")
+		m = &middleware{m: &testMiddleware{post: func(command, reply bson.D, err error) (bson.D, error) {
+			assert.Nil(t, reply)
+			return reply, err
+		}}}
+		reply, err = m.PostCommand(ctx, document, nil, commandErr)
+		assert.Equal(t, commandErr, err)
+		assert.Nil(t, reply)
+
+		m = &middleware{m: &testMiddleware{post: func(command, reply bson.D, err error) (bson.D, error) {
+			return nil, nil
+		}}}
+		_, err = m.PostCommand(ctx, document, &msg, nil)
+		assert.Error(t, err)
+	})
+}
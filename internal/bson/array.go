@@ -60,12 +60,12 @@ func (a *Array) ReadFrom(r *bufio.Reader) error {
 
 // WriteTo implements bsontype interface.
 func (a Array) WriteTo(w *bufio.Writer) error {
-	v, err := a.MarshalBinary()
+	doc, err := a.document()
 	if err != nil {
 		return lazyerrors.Error(err)
 	}
 
-	if _, err = w.Write(v); err != nil {
+	if err = doc.WriteTo(w); err != nil {
 		return lazyerrors.Error(err)
 	}
 
@@ -74,6 +74,21 @@ func (a Array) WriteTo(w *bufio.Writer) error {
 
 // MarshalBinary implements bsontype interface.
 func (a Array) MarshalBinary() ([]byte, error) {
+	doc, err := a.document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	b, err := doc.MarshalBinary()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	return b, nil
+}
+
+// document returns the array as a document with the indexes as keys.
+// It references the same values without copying them.
+func (a Array) document() (*Document, error) {
 	ta := types.Array(a)
 	l := ta.Len()
 	m := make(map[string]any, l)
@@ -88,15 +103,10 @@ func (a Array) MarshalBinary() ([]byte, error) {
 		keys[i] = key
 	}
 
-	doc := Document{
+	return &Document{
 		m:    m,
 		keys: keys,
-	}
-	b, err := doc.MarshalBinary()
-	if err != nil {
-		return nil, lazyerrors.Error(err)
-	}
-	return b, nil
+	}, nil
 }
 
 // UnmarshalJSON implements bsontype interface.
@@ -81,6 +81,10 @@ func fromBSON(v bsontype) any {
 	// 	return types.Timestamp(*v)
 	case *Int64:
 		return int64(*v)
+	case *Code:
+		return types.Code(*v)
+	case *CodeWithScope:
+		return types.CodeWithScope(*v)
 		// case *CString:
 		// 	return types.CString(*v)
 	}
@@ -143,6 +147,10 @@ func toBSON(v any) bsontype {
 	// 	return pointer.To(Timestamp(v))
 	case int64:
 		return pointer.To(Int64(v))
+	case types.Code:
+		return pointer.To(Code(v))
+	case types.CodeWithScope:
+		return pointer.To(CodeWithScope(v))
 		// case types.CString:
 		// 	return pointer.To(CString(v))
 	}
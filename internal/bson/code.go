@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Code represents BSON JavaScript code data type, which is encoded like a string.
+type Code types.Code
+
+func (code *Code) bsontype() {}
+
+// ReadFrom implements bsontype interface.
+func (code *Code) ReadFrom(r *bufio.Reader) error {
+	var str String
+	if err := str.ReadFrom(r); err != nil {
+		return lazyerrors.Errorf("bson.Code.ReadFrom: %w", err)
+	}
+
+	*code = Code(str)
+	return nil
+}
+
+// WriteTo implements bsontype interface.
+func (code Code) WriteTo(w *bufio.Writer) error {
+	if err := String(code).WriteTo(w); err != nil {
+		return lazyerrors.Errorf("bson.Code.WriteTo: %w", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary implements bsontype interface.
+func (code Code) MarshalBinary() ([]byte, error) {
+	return String(code).MarshalBinary()
+}
+
+// UnmarshalJSON implements bsontype interface.
+func (code *Code) UnmarshalJSON(data []byte) error {
+	var codeJ fjson.Code
+	if err := codeJ.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	*code = Code(codeJ)
+	return nil
+}
+
+// MarshalJSON implements bsontype interface.
+func (code Code) MarshalJSON() ([]byte, error) {
+	return fjson.Marshal(fromBSON(&code))
+}
+
+// CodeWithScope represents BSON JavaScript code with scope data type.
+// It is encoded as its total length, the code as string and the scope document.
+type CodeWithScope types.CodeWithScope
+
+func (cws *CodeWithScope) bsontype() {}
+
+// ReadFrom implements bsontype interface.
+func (cws *CodeWithScope) ReadFrom(r *bufio.Reader) error {
+	var l int32
+	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom (binary.Read): %w", err)
+	}
+
+	var code String
+	if err := code.ReadFrom(r); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom (code): %w", err)
+	}
+
+	var scope Document
+	if err := scope.ReadFrom(r); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom (scope): %w", err)
+	}
+
+	s, err := types.ConvertDocument(&scope)
+	if err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom (scope): %w", err)
+	}
+
+	sl, err := scope.size()
+	if err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom (scope): %w", err)
+	}
+
+	if expected := 4 + 4 + len(code) + 1 + sl; int(l) != expected {
+		return lazyerrors.Errorf("bson.CodeWithScope.ReadFrom: invalid length %d, expected %d", l, expected)
+	}
+
+	*cws = CodeWithScope{
+		Code:  string(code),
+		Scope: s,
+	}
+	return nil
+}
+
+// WriteTo implements bsontype interface.
+func (cws CodeWithScope) WriteTo(w *bufio.Writer) error {
+	scope, err := ConvertDocument(cws.Scope)
+	if err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.WriteTo: %w", err)
+	}
+
+	l, err := cws.size()
+	if err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.WriteTo: %w", err)
+	}
+
+	if err := binary.Write(w, binary.LittleEndian, int32(l)); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.WriteTo: %w", err)
+	}
+	if err := String(cws.Code).WriteTo(w); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.WriteTo: %w", err)
+	}
+	if err := scope.WriteTo(w); err != nil {
+		return lazyerrors.Errorf("bson.CodeWithScope.WriteTo: %w", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary implements bsontype interface.
+func (cws CodeWithScope) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	if err := cws.WriteTo(bufw); err != nil {
+		return nil, err
+	}
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// size returns the length of the marshaled code with scope.
+func (cws CodeWithScope) size() (int, error) {
+	l, err := (&Document{m: cws.Scope.Map(), keys: cws.Scope.Keys()}).size()
+	if err != nil {
+		return 0, err
+	}
+
+	return 4 + 4 + len(cws.Code) + 1 + l, nil
+}
+
+// UnmarshalJSON implements bsontype interface.
+func (cws *CodeWithScope) UnmarshalJSON(data []byte) error {
+	var cwsJ fjson.CodeWithScope
+	if err := cwsJ.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	*cws = CodeWithScope(cwsJ)
+	return nil
+}
+
+// MarshalJSON implements bsontype interface.
+func (cws CodeWithScope) MarshalJSON() ([]byte, error) {
+	return fjson.Marshal(fromBSON(&cws))
+}
+
+// check interfaces
+var (
+	_ bsontype = (*Code)(nil)
+	_ bsontype = (*CodeWithScope)(nil)
+)
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bson
+
+import (
+	"testing"
+
+	"github.com/AlekSi/pointer"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+var codeTestCases = []testCase{{
+	name: "normal",
+	v:    pointer.To(Code("x=1")),
+	b:    []byte{0x04, 0x00, 0x00, 0x00, 0x78, 0x3d, 0x31, 0x00},
+}, {
+	name: "empty",
+	v:    pointer.To(Code("")),
+	b:    []byte{0x01, 0x00, 0x00, 0x00, 0x00},
+}, {
+	name: "EOF",
+	b:    []byte{0x00},
+	bErr: `unexpected EOF`,
+}}
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	testBinary(t, codeTestCases, func() bsontype { return new(Code) })
+}
+
+func FuzzCode(f *testing.F) {
+	fuzzBinary(f, codeTestCases, func() bsontype { return new(Code) })
+}
+
+func BenchmarkCode(b *testing.B) {
+	benchmark(b, codeTestCases, func() bsontype { return new(Code) })
+}
+
+var codeWithScopeTestCases = []testCase{{
+	name: "normal",
+	v:    pointer.To(CodeWithScope{Code: "f()", Scope: types.MustMakeDocument("a", int32(1))}),
+	b: []byte{
+		0x18, 0x00, 0x00, 0x00, // total length
+		0x04, 0x00, 0x00, 0x00, 0x66, 0x28, 0x29, 0x00, // code
+		0x0c, 0x00, 0x00, 0x00, 0x10, 0x61, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // scope
+	},
+}, {
+	name: "empty",
+	v:    pointer.To(CodeWithScope{Scope: types.MustMakeDocument()}),
+	b: []byte{
+		0x0e, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00, 0x00,
+		0x05, 0x00, 0x00, 0x00, 0x00,
+	},
+}, {
+	name: "EOF",
+	b:    []byte{0x00},
+	bErr: `unexpected EOF`,
+}}
+
+func TestCodeWithScope(t *testing.T) {
+	t.Parallel()
+	testBinary(t, codeWithScopeTestCases, func() bsontype { return new(CodeWithScope) })
+}
+
+func FuzzCodeWithScope(f *testing.F) {
+	fuzzBinary(f, codeWithScopeTestCases, func() bsontype { return new(CodeWithScope) })
+}
+
+func BenchmarkCodeWithScope(b *testing.B) {
+	benchmark(b, codeWithScopeTestCases, func() bsontype { return new(CodeWithScope) })
+}
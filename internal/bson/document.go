@@ -24,6 +24,7 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"time"
@@ -34,11 +35,19 @@ import (
 )
 
 const (
+	// MaxDocumentLen is the maxBsonObjectSize of MongoDB, the length of the largest document which can be stored.
 	MaxDocumentLen = 16777216
 
+	// MaxInternalDocumentLen is the length of the largest document of a message, like in MongoDB,
+	// so that commands and replies can hold a document of MaxDocumentLen with a few more fields.
+	MaxInternalDocumentLen = MaxDocumentLen + 16*1024
+
 	minDocumentLen = 5
 )
 
+// ErrDocumentTooLarge is returned for documents larger than MaxInternalDocumentLen.
+var ErrDocumentTooLarge = errors.New("document is too large")
+
 // Common interface with types.Document.
 type document interface {
 	Map() map[string]any
@@ -101,7 +110,10 @@ func (doc *Document) ReadFrom(r *bufio.Reader) error {
 	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
 		return lazyerrors.Errorf("bson.Document.ReadFrom (binary.Read): %w", err)
 	}
-	if l < minDocumentLen || l > MaxDocumentLen {
+	if l > MaxInternalDocumentLen {
+		return lazyerrors.Errorf("bson.Document.ReadFrom: length %d: %w", l, ErrDocumentTooLarge)
+	}
+	if l < minDocumentLen {
 		return lazyerrors.Errorf("bson.Document.ReadFrom: invalid length %d", l)
 	}
 
@@ -240,7 +252,21 @@ func (doc *Document) ReadFrom(r *bufio.Reader) error {
 			}
 			doc.m[string(ename)] = int64(v)
 
-		case tagDBPointer, tagDecimal, tagJavaScript, tagJavaScriptScope, tagMaxKey, tagMinKey, tagSymbol:
+		case tagJavaScript:
+			var v Code
+			if err := v.ReadFrom(bufr); err != nil {
+				return lazyerrors.Errorf("bson.Document.ReadFrom (Code): %w", err)
+			}
+			doc.m[string(ename)] = types.Code(v)
+
+		case tagJavaScriptScope:
+			var v CodeWithScope
+			if err := v.ReadFrom(bufr); err != nil {
+				return lazyerrors.Errorf("bson.Document.ReadFrom (CodeWithScope): %w", err)
+			}
+			doc.m[string(ename)] = types.CodeWithScope(v)
+
+		case tagDBPointer, tagDecimal, tagMaxKey, tagMinKey, tagSymbol:
 			return lazyerrors.Errorf("bson.Document.ReadFrom: unhandled element type %#02x (%s)", t, tag(t))
 		default:
 			return lazyerrors.Errorf("bson.Document.ReadFrom: unhandled element type %#02x (%s)", t, tag(t))
@@ -255,173 +281,282 @@ func (doc *Document) ReadFrom(r *bufio.Reader) error {
 }
 
 // WriteTo implements bsontype interface.
+//
+// The elements are written one by one, so the document is not marshaled as a whole in memory.
+// Its length is computed upfront by Size.
 func (doc Document) WriteTo(w *bufio.Writer) error {
-	v, err := doc.MarshalBinary()
+	l, err := doc.Size()
 	if err != nil {
 		return lazyerrors.Errorf("bson.Document.WriteTo: %w", err)
 	}
 
-	_, err = w.Write(v)
-	if err != nil {
+	if err = binary.Write(w, binary.LittleEndian, int32(l)); err != nil {
 		return lazyerrors.Errorf("bson.Document.WriteTo: %w", err)
 	}
 
-	return nil
-}
-
-// MarshalBinary implements bsontype interface.
-func (doc Document) MarshalBinary() ([]byte, error) {
-	var elist bytes.Buffer
-	bufw := bufio.NewWriter(&elist)
-
 	for _, elK := range doc.keys {
-		ename := CString(elK)
 		elV, ok := doc.m[elK]
 		if !ok {
 			panic(fmt.Sprintf("%q not found in map", elK))
 		}
 
-		switch elV := elV.(type) {
-		case types.Document:
-			bufw.WriteByte(byte(tagDocument))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			doc, err := ConvertDocument(elV)
-			if err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := doc.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+		if err = writeElement(w, elK, elV); err != nil {
+			return lazyerrors.Errorf("bson.Document.WriteTo: %w", err)
+		}
+	}
 
-		case *types.Array:
-			bufw.WriteByte(byte(tagArray))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Array(*elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	if err = w.WriteByte(0); err != nil {
+		return lazyerrors.Errorf("bson.Document.WriteTo: %w", err)
+	}
 
-		case float64:
-			bufw.WriteByte(byte(tagDouble))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Double(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	return nil
+}
 
-		case string:
-			bufw.WriteByte(byte(tagString))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := String(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+// writeElement writes the element with the given key and value.
+func writeElement(w *bufio.Writer, key string, value any) error {
+	ename := CString(key)
 
-		// case types.Binary:
-		// 	bufw.WriteByte(byte(tagBinary))
-		// 	if err := ename.WriteTo(bufw); err != nil {
-		// 		return nil, lazyerrors.Error(err)
-		// 	}
-		// 	if err := Binary(elV).WriteTo(bufw); err != nil {
-		// 		return nil, lazyerrors.Error(err)
-		// 	}
+	switch elV := value.(type) {
+	case types.Document:
+		w.WriteByte(byte(tagDocument))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		doc, err := ConvertDocument(elV)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := doc.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case types.ObjectID:
-			bufw.WriteByte(byte(tagObjectID))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := ObjectID(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case *types.Array:
+		w.WriteByte(byte(tagArray))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Array(*elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case bool:
-			bufw.WriteByte(byte(tagBool))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Bool(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case float64:
+		w.WriteByte(byte(tagDouble))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Double(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case time.Time:
-			bufw.WriteByte(byte(tagDateTime))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := DateTime(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case string:
+		w.WriteByte(byte(tagString))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := String(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case nil:
-			bufw.WriteByte(byte(tagNull))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case types.Binary:
+		// binary data is only written, like the support bundles of replies; bson.Binary is not supported yet
+		w.WriteByte(byte(tagBinary))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := binary.Write(w, binary.LittleEndian, int32(len(elV.B))); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := w.WriteByte(byte(elV.Subtype)); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if _, err := w.Write(elV.B); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case types.Regex:
-			bufw.WriteByte(byte(tagRegex))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Regex(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case types.ObjectID:
+		w.WriteByte(byte(tagObjectID))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := ObjectID(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case int32:
-			bufw.WriteByte(byte(tagInt32))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Int32(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case bool:
+		w.WriteByte(byte(tagBool))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Bool(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		// case types.Timestamp:
-		// 	bufw.WriteByte(byte(tagTimestamp))
-		// 	if err := ename.WriteTo(bufw); err != nil {
-		// 		return nil, lazyerrors.Error(err)
-		// 	}
-		// 	if err := Timestamp(elV).WriteTo(bufw); err != nil {
-		// 		return nil, lazyerrors.Error(err)
-		// 	}
+	case time.Time:
+		w.WriteByte(byte(tagDateTime))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := DateTime(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		case int64:
-			bufw.WriteByte(byte(tagInt64))
-			if err := ename.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if err := Int64(elV).WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+	case nil:
+		w.WriteByte(byte(tagNull))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
 
-		default:
-			return nil, lazyerrors.Errorf("bson.Document.MarshalBinary: unhandled element type %T", elV)
+	case types.Regex:
+		w.WriteByte(byte(tagRegex))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Regex(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+	case int32:
+		w.WriteByte(byte(tagInt32))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Int32(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+	// case types.Timestamp:
+	// 	w.WriteByte(byte(tagTimestamp))
+	// 	if err := ename.WriteTo(w); err != nil {
+	// 		return lazyerrors.Error(err)
+	// 	}
+	// 	if err := Timestamp(elV).WriteTo(w); err != nil {
+	// 		return lazyerrors.Error(err)
+	// 	}
+
+	case int64:
+		w.WriteByte(byte(tagInt64))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
 		}
+		if err := Int64(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+	case types.Code:
+		w.WriteByte(byte(tagJavaScript))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := Code(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+	case types.CodeWithScope:
+		w.WriteByte(byte(tagJavaScriptScope))
+		if err := ename.WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := CodeWithScope(elV).WriteTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+	default:
+		return lazyerrors.Errorf("bson.Document.MarshalBinary: unhandled element type %T", elV)
 	}
 
+	return nil
+}
+
+// MarshalBinary implements bsontype interface.
+func (doc Document) MarshalBinary() ([]byte, error) {
+	var res bytes.Buffer
+	bufw := bufio.NewWriter(&res)
+
+	if err := doc.WriteTo(bufw); err != nil {
+		return nil, err
+	}
 	if err := bufw.Flush(); err != nil {
 		return nil, lazyerrors.Error(err)
 	}
 
-	var res bytes.Buffer
-	l := int32(elist.Len() + 5)
-	binary.Write(&res, binary.LittleEndian, l)
-	if _, err := elist.WriteTo(&res); err != nil {
-		panic(err)
-	}
-	res.WriteByte(0)
-	if int32(res.Len()) != l {
+	if l, _ := doc.Size(); res.Len() != l {
 		panic(fmt.Sprintf("got %d, expected %d", res.Len(), l))
 	}
 	return res.Bytes(), nil
 }
 
+// Size returns the length of the marshaled document without marshaling it.
+// It returns ErrDocumentTooLarge if the document is larger than MaxInternalDocumentLen.
+func (doc Document) Size() (int, error) {
+	l, err := doc.size()
+	if err != nil {
+		return 0, err
+	}
+
+	if l > MaxInternalDocumentLen {
+		return 0, lazyerrors.Errorf("bson.Document.Size: length %d: %w", l, ErrDocumentTooLarge)
+	}
+
+	return l, nil
+}
+
+// size returns the length of the marshaled document without checking it against MaxInternalDocumentLen.
+func (doc Document) size() (int, error) {
+	l := minDocumentLen
+	for _, elK := range doc.keys {
+		elV, ok := doc.m[elK]
+		if !ok {
+			panic(fmt.Sprintf("%q not found in map", elK))
+		}
+
+		vl, err := valueSize(elV)
+		if err != nil {
+			return 0, err
+		}
+
+		// type byte, key as cstring, value
+		l += 1 + len(elK) + 1 + vl
+	}
+
+	return l, nil
+}
+
+// valueSize returns the length of the marshaled value of an element.
+func valueSize(value any) (int, error) {
+	switch v := value.(type) {
+	case types.Document:
+		return (&Document{m: v.Map(), keys: v.Keys()}).size()
+	case *types.Array:
+		doc, err := Array(*v).document()
+		if err != nil {
+			return 0, err
+		}
+		return doc.size()
+	case float64, time.Time, int64:
+		return 8, nil
+	case string:
+		return 4 + len(v) + 1, nil
+	case types.Binary:
+		return 4 + 1 + len(v.B), nil
+	case types.ObjectID:
+		return len(v), nil
+	case bool:
+		return 1, nil
+	case nil:
+		return 0, nil
+	case types.Regex:
+		return len(v.Pattern) + 1 + len(v.Options) + 1, nil
+	case int32:
+		return 4, nil
+	case types.Code:
+		return 4 + len(v) + 1, nil
+	case types.CodeWithScope:
+		return CodeWithScope(v).size()
+	default:
+		return 0, lazyerrors.Errorf("bson.Document.MarshalBinary: unhandled element type %T", v)
+	}
+}
+
 // UnmarshalJSON implements bsontype interface.
 func (doc *Document) UnmarshalJSON(data []byte) error {
 	var docJ fjson.Document
@@ -21,9 +21,16 @@
 package bson
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
 )
@@ -171,6 +178,82 @@ func TestDocument(t *testing.T) {
 	testBinary(t, documentTestCases, func() bsontype { return new(Document) })
 }
 
+func TestDocumentSize(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range documentTestCases {
+		tc := tc
+		if tc.v == nil {
+			continue
+		}
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := tc.v.(*Document).Size()
+			require.NoError(t, err)
+			assert.Equal(t, len(tc.b), actual)
+		})
+	}
+
+	t.Run("Binary", func(t *testing.T) {
+		t.Parallel()
+
+		doc := MustConvertDocument(types.MustMakeDocument(
+			"bin", types.Binary{Subtype: types.BinaryGeneric, B: []byte{0x01, 0x02}},
+		))
+		b, err := doc.MarshalBinary()
+		require.NoError(t, err)
+
+		expected := []byte{
+			0x11, 0x00, 0x00, 0x00, // document length
+			0x05, 'b', 'i', 'n', 0x00, // binary element "bin"
+			0x02, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, // length, subtype and data
+			0x00,
+		}
+		assert.Equal(t, expected, b)
+	})
+}
+
+func TestDocumentTooLarge(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Marshal", func(t *testing.T) {
+		t.Parallel()
+
+		doc := MustConvertDocument(types.MustMakeDocument("s", strings.Repeat("x", MaxInternalDocumentLen)))
+		_, err := doc.MarshalBinary()
+		require.ErrorIs(t, err, ErrDocumentTooLarge)
+	})
+
+	t.Run("MarshalReply", func(t *testing.T) {
+		t.Parallel()
+
+		// a reply holding a document of the maximum length is a bit larger
+		stored := types.MustMakeDocument("_id", int32(1), "s", strings.Repeat("x", MaxDocumentLen-30))
+		l, err := MustConvertDocument(stored).Size()
+		require.NoError(t, err)
+		require.LessOrEqual(t, l, MaxDocumentLen)
+
+		reply := MustConvertDocument(types.MustMakeDocument(
+			"cursor", types.MustMakeDocument("firstBatch", types.MustNewArray(stored), "id", int64(0), "ns", "db.c"),
+			"ok", float64(1),
+		))
+		_, err = reply.MarshalBinary()
+		require.NoError(t, err)
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		t.Parallel()
+
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, MaxInternalDocumentLen+1)
+		var doc Document
+		err := doc.ReadFrom(bufio.NewReader(bytes.NewReader(b)))
+		require.ErrorIs(t, err, ErrDocumentTooLarge)
+	})
+}
+
 func FuzzDocument(f *testing.F) {
 	fuzzBinary(f, documentTestCases, func() bsontype { return new(Document) })
 }
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bson
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// LazyDocument is a document read as JSON from SAP HANA, whose values are only decoded when they are used,
+// so that the fields of wide documents which are removed by a projection are never decoded.
+//
+// Its values reference the JSON without copying it, which must not be changed while the document is used.
+type LazyDocument struct {
+	keys   []string
+	values map[string][]byte
+}
+
+// UnmarshalLazyJSON returns the lazy document of the JSON object.
+// Only the top-level keys are read; the values are checked to be valid JSON, but not decoded.
+func UnmarshalLazyJSON(data []byte) (*LazyDocument, error) {
+	keys, values, err := fjson.SplitObject(data)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	doc := &LazyDocument{
+		keys:   make([]string, 0, len(keys)),
+		values: make(map[string][]byte, len(keys)),
+	}
+
+	// like encoding/json, the last of duplicate keys wins
+	for i, key := range keys {
+		if _, ok := doc.values[key]; !ok {
+			doc.keys = append(doc.keys, key)
+		}
+		doc.values[key] = values[i]
+	}
+
+	return doc, nil
+}
+
+// Keys returns the keys of the document. Do not modify it.
+func (doc *LazyDocument) Keys() []string {
+	return doc.keys
+}
+
+// Get decodes the value at the given key.
+func (doc *LazyDocument) Get(key string) (any, error) {
+	b, ok := doc.values[key]
+	if !ok {
+		return nil, lazyerrors.Errorf("bson.LazyDocument.Get: key not found: %q", key)
+	}
+
+	v, err := fjson.Unmarshal(b)
+	if err != nil {
+		return nil, lazyerrors.Errorf("bson.LazyDocument.Get: key %q: %w", key, err)
+	}
+
+	return v, nil
+}
+
+// Document decodes the document without the omitted keys, whose values are never decoded.
+func (doc *LazyDocument) Document(omit ...string) (types.Document, error) {
+	omitted := make(map[string]struct{}, len(omit))
+	for _, key := range omit {
+		omitted[key] = struct{}{}
+	}
+
+	res := types.MustMakeDocument()
+	for _, key := range doc.keys {
+		if _, ok := omitted[key]; ok {
+			continue
+		}
+
+		v, err := doc.Get(key)
+		if err != nil {
+			return types.Document{}, err
+		}
+
+		if err = res.Set(key, v); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package bson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestLazyDocument(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{"_id": {"$oid": "62e7c3a1a2b4c5d6e7f80910"}, "a" : [1, {"b": "c"}], "d":{"$date":"2022-08-01T00:00:00.123Z"}, "e": null}`)
+
+	var full Document
+	require.NoError(t, full.UnmarshalJSON(data))
+	expected := types.MustConvertDocument(&full)
+
+	doc, err := UnmarshalLazyJSON(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_id", "a", "d", "e"}, doc.Keys())
+
+	actual, err := doc.Document()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	a, err := doc.Get("a")
+	require.NoError(t, err)
+	assert.Equal(t, expected.Map()["a"], a)
+
+	_, err = doc.Get("x")
+	assert.Error(t, err)
+
+	t.Run("Omit", func(t *testing.T) {
+		t.Parallel()
+
+		// the omitted value is valid JSON, but not a valid value, which fails only if it is decoded
+		doc, err := UnmarshalLazyJSON([]byte(`{"_id": 1, "big": {"$oid": "not hex"}, "c": "d"}`))
+		require.NoError(t, err)
+
+		_, err = doc.Document()
+		assert.Error(t, err)
+
+		actual, err := doc.Document("big")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"_id", "c"}, actual.Keys())
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		t.Parallel()
+
+		doc, err := UnmarshalLazyJSON([]byte(`{"a": 1, "b": 2, "a": "x"}`))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, doc.Keys())
+
+		a, err := doc.Get("a")
+		require.NoError(t, err)
+		assert.Equal(t, "x", a)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, data := range []string{
+			``,
+			`[1]`,
+			`{"a": }`,
+			`{"a": 1`,
+			`{"a": 1} {}`,
+			`{"a": 1}}`,
+		} {
+			_, err := UnmarshalLazyJSON([]byte(data))
+			assert.Error(t, err, data)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// uncompressibleCommands are the commands whose replies are never compressed, like in MongoDB,
+// as they are part of the handshake or contain credentials.
+var uncompressibleCommands = map[string]struct{}{
+	"authenticate":    {},
+	"copydb":          {},
+	"copydbgetnonce":  {},
+	"copydbSaslStart": {},
+	"createUser":      {},
+	"getnonce":        {},
+	"hello":           {},
+	"isMaster":        {},
+	"ismaster":        {},
+	"saslContinue":    {},
+	"saslStart":       {},
+	"updateUser":      {},
+}
+
+// compress returns the reply compressed with the compressor negotiated by the handler,
+// or the reply itself if there is none or if the reply of the request is not compressed.
+// It is only called for compressed requests, as MongoDB only compresses their replies.
+//
+// Replies are only compressed in the modes answered by SAP HANA, as the compressor is negotiated
+// in the handshake with the handler.
+func (c *conn) compress(reqBody wire.MsgBody, resHeader *wire.MsgHeader, resBody wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	if c.mode != NormalMode && c.mode != DiffNormalMode && c.mode != ShadowNormalMode {
+		return resHeader, resBody, nil
+	}
+
+	compressor, ok := c.h.Compressor()
+	if !ok || !compressible(reqBody) {
+		return resHeader, resBody, nil
+	}
+
+	compressedHeader, compressedBody, err := wire.Compress(resHeader, resBody, compressor)
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	return compressedHeader, compressedBody, nil
+}
+
+// compressible returns false if the reply of the request is not compressed.
+func compressible(reqBody wire.MsgBody) bool {
+	var command string
+	switch body := reqBody.(type) {
+	case *wire.OpMsg:
+		document, err := body.Document()
+		if err != nil {
+			return false
+		}
+		command = document.Command()
+
+	case *wire.OpQuery:
+		command = body.Query.Command()
+
+	default:
+		return true
+	}
+
+	_, ok := uncompressibleCommands[command]
+	return !ok
+}
+
+// withoutCompression returns the request without the compression field of hello and isMaster,
+// so that the proxy does not negotiate a compressor which the connection can't read.
+func withoutCompression(reqHeader *wire.MsgHeader, reqBody wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	var body wire.MsgBody
+	switch reqBody := reqBody.(type) {
+	case *wire.OpMsg:
+		document, err := reqBody.Document()
+		if err != nil || !negotiatesCompression(document) {
+			return reqHeader, reqBody, nil
+		}
+
+		if err = document.Remove("compression"); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+		msg := &wire.OpMsg{
+			FlagBits: reqBody.FlagBits,
+		}
+		if err = msg.SetSections(wire.OpMsgSection{Documents: []types.Document{document}}); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+		body = msg
+
+	case *wire.OpQuery:
+		if !negotiatesCompression(reqBody.Query) {
+			return reqHeader, reqBody, nil
+		}
+
+		query := *reqBody
+		query.Query = types.MustMakeDocument()
+		m := reqBody.Query.Map()
+		for _, k := range reqBody.Query.Keys() {
+			if k == "compression" {
+				continue
+			}
+			if err := query.Query.Set(k, m[k]); err != nil {
+				return nil, nil, lazyerrors.Error(err)
+			}
+		}
+		body = &query
+
+	default:
+		return reqHeader, reqBody, nil
+	}
+
+	l, err := wire.BodySize(body)
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	header := *reqHeader
+	header.MessageLength = int32(wire.MsgHeaderLen + l)
+
+	return &header, body, nil
+}
+
+// negotiatesCompression returns true for a hello or isMaster command with a compression field.
+func negotiatesCompression(document types.Document) bool {
+	if _, ok := document.Map()["compression"]; !ok {
+		return false
+	}
+
+	switch strings.ToLower(document.Command()) {
+	case "hello", "ismaster":
+		return true
+	default:
+		return false
+	}
+}
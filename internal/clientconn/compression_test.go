@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestCompressible(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, compressible(shadowMsg(t, "find", "test", "$db", "db")))
+	assert.False(t, compressible(shadowMsg(t, "hello", int32(1), "$db", "admin")))
+	assert.False(t, compressible(shadowMsg(t, "saslStart", int32(1), "$db", "admin")))
+	assert.False(t, compressible(&wire.OpQuery{Query: types.MustMakeDocument("isMaster", int32(1))}))
+	assert.True(t, compressible(&wire.OpGetMore{}))
+}
+
+func TestWithoutCompression(t *testing.T) {
+	t.Parallel()
+
+	t.Run("OpMsg", func(t *testing.T) {
+		t.Parallel()
+
+		body := shadowMsg(t, "hello", int32(1), "compression", types.MustNewArray("zlib"), "$db", "admin")
+		l, err := wire.BodySize(body)
+		require.NoError(t, err)
+		header := &wire.MsgHeader{MessageLength: int32(wire.MsgHeaderLen + l), RequestID: 1, OpCode: wire.OP_MSG}
+
+		actualHeader, actualBody, err := withoutCompression(header, body)
+		require.NoError(t, err)
+		assert.Equal(t, shadowMsg(t, "hello", int32(1), "$db", "admin"), actualBody)
+
+		l, err = wire.BodySize(actualBody)
+		require.NoError(t, err)
+		assert.Equal(t, int32(wire.MsgHeaderLen+l), actualHeader.MessageLength)
+		assert.Equal(t, int32(1), actualHeader.RequestID)
+	})
+
+	t.Run("OpQuery", func(t *testing.T) {
+		t.Parallel()
+
+		body := &wire.OpQuery{
+			FullCollectionName: "admin.$cmd",
+			NumberToReturn:     -1,
+			Query:              types.MustMakeDocument("isMaster", int32(1), "compression", types.MustNewArray("zlib")),
+		}
+		l, err := wire.BodySize(body)
+		require.NoError(t, err)
+		header := &wire.MsgHeader{MessageLength: int32(wire.MsgHeaderLen + l), RequestID: 1, OpCode: wire.OP_QUERY}
+
+		actualHeader, actualBody, err := withoutCompression(header, body)
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("isMaster", int32(1)), actualBody.(*wire.OpQuery).Query)
+		assert.Less(t, actualHeader.MessageLength, header.MessageLength)
+
+		// the request itself is not changed
+		assert.Contains(t, body.Query.Keys(), "compression")
+	})
+
+	t.Run("Other", func(t *testing.T) {
+		t.Parallel()
+
+		body := shadowMsg(t, "find", "test", "compression", "zlib", "$db", "db")
+		header := &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_MSG}
+
+		actualHeader, actualBody, err := withoutCompression(header, body)
+		require.NoError(t, err)
+		assert.Same(t, header, actualHeader)
+		assert.Same(t, body, actualBody)
+	})
+}
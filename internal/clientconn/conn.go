@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -30,10 +32,14 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/proxy"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
@@ -51,10 +57,16 @@ const (
 	// DiffProxyMode both handles requests and proxies them, then logs the diff.
 	// Only the proxy response is sent to the client.
 	DiffProxyMode Mode = "diff-proxy"
+	// ShadowNormalMode handles requests and asynchronously sends writes to the proxy as well,
+	// then counts the divergences. Only the SAP HANA compatibility layer for MongoDB Wire Protocol response is sent to the client.
+	ShadowNormalMode Mode = "shadow-normal"
+	// ShadowProxyMode proxies requests and asynchronously handles writes as well,
+	// then counts the divergences. Only the proxy response is sent to the client.
+	ShadowProxyMode Mode = "shadow-proxy"
 )
 
 // AllModes includes all operation modes, with the first one being the default.
-var AllModes = []Mode{NormalMode, ProxyMode, DiffNormalMode, DiffProxyMode}
+var AllModes = []Mode{NormalMode, ProxyMode, DiffNormalMode, DiffProxyMode, ShadowNormalMode, ShadowProxyMode}
 
 // conn represents client connection.
 type conn struct {
@@ -63,6 +75,15 @@ type conn struct {
 	h       *handlers.Handler
 	proxy   *proxy.Handler
 	l       *zap.SugaredLogger
+	network *handlers.NetworkStats
+	metrics *ListenerMetrics
+	wire    *wire.Metrics
+
+	// diffReporter writes the reports of the diff modes, if any
+	diffReporter *diffReporter
+
+	// logUnredacted logs the documents of messages instead of their shapes
+	logUnredacted bool
 }
 
 type newConnOpts struct {
@@ -70,7 +91,29 @@ type newConnOpts struct {
 	hanaPool        *hana.Hpool
 	proxyAddr       string
 	mode            Mode
+	metrics         *ListenerMetrics
 	handlersMetrics *handlers.Metrics
+	wireMetrics     *wire.Metrics
+	quotas          *crud.Quotas
+	mappings        *handlers.Mappings
+	cursors         *crud.Cursors
+	indexBuilds     *crud.IndexBuilds
+	sessions        *handlers.Sessions
+	coalescer       *crud.Coalescer
+	keyValidation   common.KeyValidation
+	middlewares     []handlers.Middleware
+	sandbox         *handlers.Sandbox
+	supportBundle   *support.Collector
+	slowCommand     time.Duration
+	shutdown        func(delay time.Duration)
+	clientIdentity  string
+	clientIssuer    string
+	diffReporter    *diffReporter
+	capture         *handlers.Capture
+	requireAuth     bool
+	userPools       hana.UserPoolOpener
+	readOnly        bool
+	logUnredacted   bool
 }
 
 // newConn creates a new client connection for given net.Conn.
@@ -80,7 +123,23 @@ func newConn(opts *newConnOpts) (*conn, error) {
 
 	peerAddr := opts.netConn.RemoteAddr().String()
 
-	crudH := crud.NewStorage(opts.hanaPool, l)
+	// with credential passthrough, the connection has its own pool, whose connections are replaced by the ones of the user,
+	// and point reads are not coalesced with the ones of other users
+	hanaPool, coalescer := opts.hanaPool, opts.coalescer
+	if opts.userPools != nil {
+		pool := *opts.hanaPool
+		hanaPool, coalescer = &pool, nil
+	}
+
+	crudH := crud.NewStorage(&crud.NewStorageOpts{
+		HanaPool:      hanaPool,
+		Logger:        l,
+		Quotas:        opts.quotas,
+		Cursors:       opts.cursors,
+		Coalescer:     coalescer,
+		KeyValidation: opts.keyValidation,
+		IndexBuilds:   opts.indexBuilds,
+	})
 
 	var p *proxy.Handler
 	if opts.mode != NormalMode {
@@ -91,11 +150,27 @@ func newConn(opts *newConnOpts) (*conn, error) {
 	}
 
 	handlerOpts := &handlers.NewOpts{
-		HanaPool:    opts.hanaPool,
+		HanaPool:    hanaPool,
 		Logger:      l,
 		CrudStorage: crudH,
 		Metrics:     opts.handlersMetrics,
 		PeerAddr:    peerAddr,
+		Shutdown:    opts.shutdown,
+		Middlewares: opts.middlewares,
+		Sandbox:     opts.sandbox,
+		Quotas:      opts.quotas,
+		Mappings:    opts.mappings,
+		Sessions:    opts.sessions,
+
+		SupportBundle:        opts.supportBundle,
+		SlowCommandThreshold: opts.slowCommand,
+		ClientIdentity:       opts.clientIdentity,
+		ClientIssuer:         opts.clientIssuer,
+		Capture:              opts.capture,
+		RequireAuth:          opts.requireAuth,
+		UserPools:            opts.userPools,
+		ReadOnly:             opts.readOnly,
+		LogUnredacted:        opts.logUnredacted,
 	}
 
 	return &conn{
@@ -104,9 +179,55 @@ func newConn(opts *newConnOpts) (*conn, error) {
 		h:       handlers.New(handlerOpts),
 		proxy:   p,
 		l:       l.Sugar(),
+		network: opts.handlersMetrics.Network,
+		metrics: opts.metrics,
+		wire:    opts.wireMetrics,
+
+		diffReporter: opts.diffReporter,
+
+		logUnredacted: opts.logUnredacted,
 	}, nil
 }
 
+// credentialCommands are the commands whose requests are redacted even in unredacted logs,
+// as they contain credentials like the password of PLAIN authentication, like hello with speculativeAuthenticate.
+var credentialCommands = map[string]struct{}{
+	"authenticate": {},
+	"saslContinue": {},
+	"saslStart":    {},
+}
+
+// dumpMsgBody returns the body for logs, with the shapes of its documents unless logs are unredacted.
+func (c *conn) dumpMsgBody(body wire.MsgBody) string {
+	if !c.logUnredacted || hasCredentials(body) {
+		return wire.DumpRedactedMsgBody(body)
+	}
+
+	return wire.DumpMsgBody(body)
+}
+
+// hasCredentials returns true if the body is the request of one of the credentialCommands.
+func hasCredentials(body wire.MsgBody) bool {
+	var document types.Document
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		document, _ = body.Document()
+	case *wire.OpQuery:
+		document = body.Query
+	}
+
+	if len(document.Keys()) == 0 {
+		return false
+	}
+
+	if _, ok := document.Map()["speculativeAuthenticate"]; ok {
+		return true
+	}
+
+	_, ok := credentialCommands[document.Command()]
+	return ok
+}
+
 // run runs the client connection until ctx is canceled, client disconnects,
 // or fatal error or panic is encountered.
 //
@@ -136,6 +257,22 @@ func (c *conn) run(ctx context.Context) (err error) {
 		}
 	}()
 
+	peerAddr := c.netConn.RemoteAddr().String()
+	c.network.OpenConn(peerAddr, func() {
+		// fail the pending read or write like on ctx cancelation
+		c.netConn.SetDeadline(time.Unix(0, 0))
+	})
+	defer c.network.CloseConn(peerAddr)
+
+	// in shadow modes, the backend not answering the client receives writes asynchronously
+	var shadow *shadower
+	switch c.mode {
+	case ShadowNormalMode:
+		shadow = newShadower(ctx, c.proxy.Handle, c.metrics, c.l)
+	case ShadowProxyMode:
+		shadow = newShadower(ctx, c.handle, c.metrics, c.l)
+	}
+
 	bufr := bufio.NewReader(c.netConn)
 	bufw := bufio.NewWriter(c.netConn)
 	defer func() {
@@ -143,50 +280,94 @@ func (c *conn) run(ctx context.Context) (err error) {
 			err = e
 		}
 
+		// send queued writes before closing the backends
+		if shadow != nil {
+			shadow.close()
+		}
+
 		if c.proxy != nil {
 			c.proxy.Close()
 		}
 
+		// return connections pinned by open transactions to the pool
+		c.h.Close()
+
 		// c.netConn is closed by the caller
 	}()
 
 	for {
 		var reqHeader *wire.MsgHeader
 		var reqBody wire.MsgBody
-		reqHeader, reqBody, err = wire.ReadMessage(bufr)
+		reqHeader, reqBody, err = c.wire.ReadMessage(bufr)
 		if err != nil {
-			return
+			// a message or document which is too large is replied to with an error instead of closing the connection
+			// without a reply; the connection is still closed if the body of the message was not read
+			if reqHeader == nil {
+				return
+			}
+
+			readErr := err
+			resHeader, resBody := c.h.ReplyTooLarge(reqHeader, readErr)
+			if resBody != nil {
+				if err = c.wire.WriteMessage(bufw, resHeader, resBody); err != nil {
+					return
+				}
+				if err = bufw.Flush(); err != nil {
+					return
+				}
+			}
+
+			if errors.Is(readErr, wire.ErrMessageTooLarge) {
+				err = readErr
+				return
+			}
+			err = nil
+			continue
+		}
+
+		// a compressed request is handled like its original message,
+		// only the bytes read are the ones of the OP_COMPRESSED message
+		physicalBytesIn := int64(reqHeader.MessageLength)
+		compressed, reqCompressed := reqBody.(*wire.OpCompressed)
+		if reqCompressed {
+			reqHeader, reqBody = compressed.OriginalHeader(reqHeader), compressed.Body
 		}
 
 		// do not spend time dumping if we are not going to log it
 		if c.l.Desugar().Core().Enabled(zap.DebugLevel) {
 			c.l.Debugf("Request header:\n%s", wire.DumpMsgHeader(reqHeader))
-			c.l.Debugf("Request message:\n%s\n\n\n", wire.DumpMsgBody(reqBody))
+			c.l.Debugf("Request message:\n%s\n\n\n", c.dumpMsgBody(reqBody))
 		}
 
 		// handle request unless we are in proxy mode
 		var resHeader *wire.MsgHeader
 		var resBody wire.MsgBody
 		var closeConn bool
-		if c.mode != ProxyMode {
+		if c.mode != ProxyMode && c.mode != ShadowProxyMode {
 			resHeader, resBody, closeConn = c.h.Handle(ctx, reqHeader, reqBody)
 
 			// do not spend time dumping if we are not going to log it
 			if c.l.Desugar().Core().Enabled(zap.DebugLevel) {
 				c.l.Debugf("Response header:\n%s", wire.DumpMsgHeader(resHeader))
-				c.l.Debugf("Response message:\n%s\n\n\n", wire.DumpMsgBody(resBody))
+				c.l.Debugf("Response message:\n%s\n\n\n", c.dumpMsgBody(resBody))
 			}
 		}
 
 		// send request to proxy unless we are in normal mode
 		var proxyHeader *wire.MsgHeader
 		var proxyBody wire.MsgBody
-		if c.mode != NormalMode {
+		if c.mode != NormalMode && c.mode != ShadowNormalMode {
 			if c.proxy == nil {
 				panic("proxy addr was nil")
 			}
 
-			proxyHeader, proxyBody, err = c.proxy.Handle(ctx, reqHeader, reqBody)
+			var proxyReqHeader *wire.MsgHeader
+			var proxyReqBody wire.MsgBody
+			if proxyReqHeader, proxyReqBody, err = withoutCompression(reqHeader, reqBody); err != nil {
+				return
+			}
+
+			proxyHeader, proxyBody, err = c.proxy.Handle(ctx, proxyReqHeader, proxyReqBody)
 			if err != nil {
 				c.l.Warnf("Proxy returned error, closing connection: %s.", err)
 				return
@@ -195,14 +376,17 @@ func (c *conn) run(ctx context.Context) (err error) {
 			// do not spend time dumping if we are not going to log it
 			if c.l.Desugar().Core().Enabled(zap.DebugLevel) {
 				c.l.Debugf("Proxy header:\n%s", wire.DumpMsgHeader(proxyHeader))
-				c.l.Debugf("Proxy message:\n%s\n\n\n", wire.DumpMsgBody(proxyBody))
+				c.l.Debugf("Proxy message:\n%s\n\n\n", c.dumpMsgBody(proxyBody))
 			}
 		}
 
+		// the client does not wait for a reply to a message with moreToCome, like an unacknowledged write, or a legacy write
+		noReply := wire.NoReply(reqHeader, reqBody)
+
 		// diff in diff mode
-		if c.mode == DiffNormalMode || c.mode == DiffProxyMode {
-			res := difflib.SplitLines(wire.DumpMsgHeader(resHeader) + "\n" + wire.DumpMsgBody(resBody))
-			proxy := difflib.SplitLines(wire.DumpMsgHeader(proxyHeader) + "\n" + wire.DumpMsgBody(proxyBody))
+		if (c.mode == DiffNormalMode || c.mode == DiffProxyMode) && !noReply {
+			res := difflib.SplitLines(wire.DumpMsgHeader(resHeader) + "\n" + c.dumpMsgBody(resBody))
+			proxy := difflib.SplitLines(wire.DumpMsgHeader(proxyHeader) + "\n" + c.dumpMsgBody(proxyBody))
 			diff := difflib.UnifiedDiff{
 				A:        res,
 				FromFile: "res",
@@ -217,30 +401,159 @@ func (c *conn) run(ctx context.Context) (err error) {
 			}
 
 			c.l.Infof("Diff:\n%s\n\n\n", s)
+
+			c.reportDiff(peerAddr, reqHeader, reqBody, resBody, proxyBody)
 		}
 
 		// replace response with one from proxy in proxy and diff-proxy modes
-		if c.mode == ProxyMode || c.mode == DiffProxyMode {
+		if c.mode == ProxyMode || c.mode == DiffProxyMode || c.mode == ShadowProxyMode {
 			resHeader = proxyHeader
 			resBody = proxyBody
 		}
 
+		if shadow != nil && (resBody != nil || noReply) {
+			shadow.enqueue(reqHeader, reqBody, resBody)
+		}
+
+		if noReply {
+			c.network.RecordRequest(peerAddr, int64(reqHeader.MessageLength), physicalBytesIn, 0, 0)
+
+			if closeConn {
+				err = errors.New("internal error")
+				return
+			}
+			continue
+		}
+
 		if resHeader == nil || resBody == nil {
 			c.l.Info("no response to send to client")
 			return
 		}
 
-		if err = wire.WriteMessage(bufw, resHeader, resBody); err != nil {
-			return
+		// the physical sizes are the lengths of the compressed messages
+		bytesIn := int64(reqHeader.MessageLength)
+		for {
+			outHeader, outBody := resHeader, resBody
+			if reqCompressed {
+				if outHeader, outBody, err = c.compress(reqBody, resHeader, resBody); err != nil {
+					return
+				}
+			}
+
+			if err = c.wire.WriteMessage(bufw, outHeader, outBody); err != nil {
+				return
+			}
+
+			if err = bufw.Flush(); err != nil {
+				return
+			}
+
+			bytesOut := int64(resHeader.MessageLength)
+			c.network.RecordRequest(peerAddr, bytesIn, physicalBytesIn, bytesOut, int64(outHeader.MessageLength))
+
+			if closeConn {
+				err = errors.New("internal error")
+				return
+			}
+
+			// a reply with moreToCome, of an awaitable hello or a getMore with exhaustAllowed,
+			// is followed by the next one without a request, until the client closes the connection or the cursor is exhausted
+			if !hasMoreToCome(resBody) || c.mode == ProxyMode || c.mode == DiffProxyMode || c.mode == ShadowProxyMode {
+				break
+			}
+			if err = ctx.Err(); err != nil {
+				return
+			}
+
+			if reqBody, err = exhaustRequest(reqBody, resBody); err != nil {
+				return
+			}
+			reqHeader = &wire.MsgHeader{
+				MessageLength: reqHeader.MessageLength,
+				RequestID:     resHeader.RequestID,
+				OpCode:        reqHeader.OpCode,
+			}
+			resHeader, resBody, closeConn = c.h.Handle(ctx, reqHeader, reqBody)
+			bytesIn, physicalBytesIn = 0, 0
 		}
+	}
+}
 
-		if err = bufw.Flush(); err != nil {
-			return
+// reportDiff counts the comparison of the replies of both backends in the diff modes,
+// and writes the report of it if a report file is configured.
+func (c *conn) reportDiff(peerAddr string, reqHeader *wire.MsgHeader, reqBody, resBody, proxyBody wire.MsgBody) {
+	report := newDiffReport(reqHeader, reqBody, resBody, proxyBody)
+	report.Remote = peerAddr
+
+	c.metrics.DiffedRequests.WithLabelValues(handlers.CommandLabel(report.Command), report.result()).Inc()
+
+	if c.diffReporter == nil {
+		return
+	}
+
+	if err := c.diffReporter.write(report); err != nil {
+		c.l.Warnf("Failed to write diff report: %s.", err)
+	}
+}
+
+// exhaustRequest returns the request answered by the next reply of an exhaust stream, which follows the reply with moreToCome:
+// the getMore of the cursor of the reply, or the hello with the topologyVersion of the reply.
+func exhaustRequest(reqBody, resBody wire.MsgBody) (wire.MsgBody, error) {
+	req, ok := reqBody.(*wire.OpMsg)
+	if !ok {
+		return nil, lazyerrors.Errorf("unexpected request %T with moreToCome reply", reqBody)
+	}
+	reqDoc, err := req.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	resDoc, err := resBody.(*wire.OpMsg).Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	next := reqDoc.DeepCopy()
+	switch command := reqDoc.Command(); command {
+	case "getMore":
+		cursor, ok := resDoc.Map()["cursor"].(types.Document)
+		if !ok {
+			return nil, lazyerrors.Errorf("no cursor in the reply of getMore")
+		}
+		if err = next.Set("getMore", cursor.Map()["id"]); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
 
-		if closeConn {
-			err = errors.New("internal error")
-			return
+	case "hello", "isMaster", "ismaster":
+		if err = next.Set("topologyVersion", resDoc.Map()["topologyVersion"]); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
+
+	default:
+		return nil, lazyerrors.Errorf("unexpected command %q with moreToCome reply", command)
+	}
+
+	msg := &wire.OpMsg{
+		FlagBits: wire.OpMsgFlags(wire.OpMsgExhaustAllowed),
+	}
+	if err = msg.SetSections(wire.OpMsgSection{Documents: []types.Document{next}}); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return msg, nil
+}
+
+// hasMoreToCome returns true if the message is an OP_MSG with the moreToCome flag.
+func hasMoreToCome(body wire.MsgBody) bool {
+	msg, ok := body.(*wire.OpMsg)
+	return ok && msg.FlagBits.FlagSet(wire.OpMsgMoreToCome)
+}
+
+// handle handles the request like proxy.Handler, so that it can be the secondary backend in ShadowProxyMode.
+func (c *conn) handle(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	resHeader, resBody, closeConn := c.h.Handle(ctx, header, body)
+	if closeConn {
+		return nil, nil, errors.New("internal error")
 	}
+
+	return resHeader, resBody, nil
 }
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestExhaustRequest(t *testing.T) {
+	t.Parallel()
+
+	t.Run("getMore", func(t *testing.T) {
+		t.Parallel()
+
+		req := shadowMsg(t, "getMore", int64(42), "collection", "c", "batchSize", int32(2), "$db", "db")
+		cursor := types.MustMakeDocument("nextBatch", types.MustNewArray(), "id", int64(42), "ns", "db.c")
+		res := shadowMsg(t, "cursor", cursor, "ok", float64(1))
+
+		next, err := exhaustRequest(req, res)
+		require.NoError(t, err)
+		msg := next.(*wire.OpMsg)
+		assert.True(t, msg.FlagBits.FlagSet(wire.OpMsgExhaustAllowed))
+		doc, err := msg.Document()
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("getMore", int64(42), "collection", "c", "batchSize", int32(2), "$db", "db"), doc)
+	})
+
+	t.Run("hello", func(t *testing.T) {
+		t.Parallel()
+
+		topologyVersion := types.MustMakeDocument("processId", types.ObjectID{1}, "counter", int64(0))
+		req := shadowMsg(t, "hello", int32(1), "topologyVersion", types.MustMakeDocument(), "maxAwaitTimeMS", int64(1), "$db", "admin")
+		res := shadowMsg(t, "helloOk", true, "topologyVersion", topologyVersion, "ok", float64(1))
+
+		next, err := exhaustRequest(req, res)
+		require.NoError(t, err)
+		doc, err := next.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		expected := types.MustMakeDocument(
+			"hello", int32(1), "topologyVersion", topologyVersion, "maxAwaitTimeMS", int64(1), "$db", "admin",
+		)
+		assert.Equal(t, expected, doc)
+	})
+
+	t.Run("other", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := exhaustRequest(shadowMsg(t, "find", "c", "$db", "db"), shadowMsg(t, "ok", float64(1)))
+		assert.Error(t, err)
+	})
+}
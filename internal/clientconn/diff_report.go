@@ -0,0 +1,310 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// diffIgnoredFields are the top-level reply fields which differ between the backends on every request,
+// and are not compared in the diff modes.
+var diffIgnoredFields = map[string]struct{}{
+	"localTime":       {},
+	"$clusterTime":    {},
+	"operationTime":   {},
+	"connectionId":    {},
+	"electionId":      {},
+	"lastWrite":       {},
+	"topologyVersion": {},
+	"serviceId":       {},
+}
+
+// diffReport is the JSON report of the differences of the replies of both backends to a request in the diff modes.
+type diffReport struct {
+	Time      time.Time   `json:"time"`
+	Remote    string      `json:"remote"`
+	RequestID int32       `json:"requestID"`
+	Command   string      `json:"command"`
+	DB        string      `json:"db,omitempty"`
+	Match     bool        `json:"match"`
+	Diffs     []diffField `json:"diffs,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// diffField is a difference of a reply field, like "cursor.firstBatch.0.name", between the backends.
+// The value of a backend is omitted if the field is missing in its reply.
+type diffField struct {
+	Path  string          `json:"path"`
+	Res   json.RawMessage `json:"res,omitempty"`
+	Proxy json.RawMessage `json:"proxy,omitempty"`
+}
+
+// newDiffReport compares the replies of the SAP HANA compatibility layer for MongoDB Wire Protocol and the proxy
+// to the request.
+func newDiffReport(reqHeader *wire.MsgHeader, reqBody, resBody, proxyBody wire.MsgBody) *diffReport {
+	report := &diffReport{
+		Time:      time.Now().UTC(),
+		RequestID: reqHeader.RequestID,
+	}
+	report.Command, report.DB = diffCommand(reqBody)
+
+	res, err := diffReply(resBody)
+	if err != nil {
+		report.Error = fmt.Sprintf("res: %s", err)
+		return report
+	}
+
+	proxy, err := diffReply(proxyBody)
+	if err != nil {
+		report.Error = fmt.Sprintf("proxy: %s", err)
+		return report
+	}
+
+	report.Diffs = diffDocuments("", res, proxy)
+	report.Match = len(report.Diffs) == 0
+
+	return report
+}
+
+// result returns the result of the comparison for the metrics: match, diverged or failed.
+func (r *diffReport) result() string {
+	switch {
+	case r.Error != "":
+		return "failed"
+	case r.Match:
+		return "match"
+	default:
+		return "diverged"
+	}
+}
+
+// diffCommand returns the command and the database of the request.
+func diffCommand(body wire.MsgBody) (string, string) {
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		document, err := body.Document()
+		if err != nil {
+			return "", ""
+		}
+		db, _ := document.Map()["$db"].(string)
+		return document.Command(), db
+
+	case *wire.OpQuery:
+		db, _, _ := strings.Cut(body.FullCollectionName, ".")
+		return body.Query.Command(), db
+
+	default:
+		return "", ""
+	}
+}
+
+// diffReply returns the document of an OP_MSG or OP_REPLY reply.
+func diffReply(body wire.MsgBody) (types.Document, error) {
+	switch body := body.(type) {
+	case *wire.OpMsg:
+		return body.Document()
+
+	case *wire.OpReply:
+		if len(body.Documents) != 1 {
+			return types.Document{}, fmt.Errorf("reply has %d documents", len(body.Documents))
+		}
+		return body.Documents[0], nil
+
+	case nil:
+		return types.Document{}, errors.New("no reply")
+
+	default:
+		return types.Document{}, fmt.Errorf("unexpected reply %T", body)
+	}
+}
+
+// diffDocuments returns the differences of the fields of the documents, in the order of res,
+// followed by the fields only in proxy.
+func diffDocuments(prefix string, res, proxy types.Document) []diffField {
+	resMap, proxyMap := res.Map(), proxy.Map()
+
+	keys := res.Keys()
+	for _, k := range proxy.Keys() {
+		if _, ok := resMap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	var diffs []diffField
+	for _, k := range keys {
+		if _, ok := diffIgnoredFields[k]; ok && prefix == "" {
+			continue
+		}
+
+		rv, rok := resMap[k]
+		pv, pok := proxyMap[k]
+		diffs = append(diffs, diffValues(prefix+k, rv, rok, pv, pok)...)
+	}
+
+	return diffs
+}
+
+// diffArrays returns the differences of the elements of the arrays.
+func diffArrays(prefix string, res, proxy *types.Array) []diffField {
+	n := res.Len()
+	if proxy.Len() > n {
+		n = proxy.Len()
+	}
+
+	var diffs []diffField
+	for i := 0; i < n; i++ {
+		rv, rerr := res.Get(i)
+		pv, perr := proxy.Get(i)
+		diffs = append(diffs, diffValues(prefix+strconv.Itoa(i), rv, rerr == nil, pv, perr == nil)...)
+	}
+
+	return diffs
+}
+
+// diffValues returns the differences of the values of the field path; ok is false for a missing value.
+// Documents and arrays are compared by their fields and elements, numbers of different types are equal,
+// and cursor IDs only need to be both zero or both non-zero.
+func diffValues(path string, res any, resOK bool, proxy any, proxyOK bool) []diffField {
+	if resOK && proxyOK {
+		switch rv := res.(type) {
+		case types.Document:
+			if pv, ok := proxy.(types.Document); ok {
+				return diffDocuments(path+".", rv, pv)
+			}
+		case *types.Array:
+			if pv, ok := proxy.(*types.Array); ok {
+				return diffArrays(path+".", rv, pv)
+			}
+		}
+
+		if path == "cursor.id" && diffNumber(res) != nil && diffNumber(proxy) != nil {
+			if (*diffNumber(res) == 0) == (*diffNumber(proxy) == 0) {
+				return nil
+			}
+		}
+
+		if reflect.DeepEqual(diffJSONValue(res), diffJSONValue(proxy)) {
+			return nil
+		}
+	}
+
+	d := diffField{Path: path}
+	if resOK {
+		d.Res = diffMarshal(res)
+	}
+	if proxyOK {
+		d.Proxy = diffMarshal(proxy)
+	}
+
+	return []diffField{d}
+}
+
+// diffNumber returns the value of a number, or nil for other types.
+func diffNumber(v any) *float64 {
+	var f float64
+	switch v := v.(type) {
+	case float64:
+		f = v
+	case int32:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	default:
+		return nil
+	}
+
+	return &f
+}
+
+// diffJSONValue converts the value to one encoded to JSON for the report, like MongoDB's relaxed extended JSON,
+// with all numbers as float64, so that numbers of different types are equal.
+func diffJSONValue(v any) any {
+	if f := diffNumber(v); f != nil {
+		return *f
+	}
+
+	switch v := v.(type) {
+	case types.Document:
+		m := make(map[string]any, len(v.Keys()))
+		for k, v := range v.Map() {
+			m[k] = diffJSONValue(v)
+		}
+		return m
+	case *types.Array:
+		s := make([]any, v.Len())
+		for i := range s {
+			e, _ := v.Get(i)
+			s[i] = diffJSONValue(e)
+		}
+		return s
+	case string, bool, nil:
+		return v
+	case types.ObjectID:
+		return map[string]any{"$oid": hex.EncodeToString(v[:])}
+	case time.Time:
+		return map[string]any{"$date": v.UTC().Format(time.RFC3339Nano)}
+	case types.Binary:
+		return map[string]any{"$binary": map[string]any{
+			"base64":  base64.StdEncoding.EncodeToString(v.B),
+			"subType": fmt.Sprintf("%02x", byte(v.Subtype)),
+		}}
+	case types.Regex:
+		return map[string]any{"$regularExpression": map[string]any{"pattern": v.Pattern, "options": v.Options}}
+	case types.Timestamp:
+		return map[string]any{"$timestamp": map[string]any{"t": uint32(v >> 32), "i": uint32(v)}}
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// diffMarshal encodes the value to JSON for the report.
+func diffMarshal(v any) json.RawMessage {
+	b, err := json.Marshal(diffJSONValue(v))
+	if err != nil {
+		// NaN and infinite numbers can't be encoded to JSON
+		b, _ = json.Marshal(fmt.Sprintf("%v", v))
+	}
+
+	return b
+}
+
+// diffReporter writes the reports of all connections as JSON lines.
+type diffReporter struct {
+	m   sync.Mutex
+	enc *json.Encoder
+}
+
+// newDiffReporter creates a new diffReporter writing to w.
+func newDiffReporter(w io.Writer) *diffReporter {
+	return &diffReporter{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// write writes the report as a JSON line.
+func (r *diffReporter) write(report *diffReport) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if err := r.enc.Encode(report); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestNewDiffReport(t *testing.T) {
+	t.Parallel()
+
+	header := &wire.MsgHeader{RequestID: 42, OpCode: wire.OP_MSG}
+	find := shadowMsg(t, "find", "test", "$db", "db")
+
+	t.Run("Match", func(t *testing.T) {
+		t.Parallel()
+
+		res := shadowMsg(t,
+			"cursor", types.MustMakeDocument("id", int64(123), "firstBatch", types.MustNewArray(int32(1))),
+			"localTime", time.Unix(1, 0), "ok", float64(1),
+		)
+		proxy := shadowMsg(t,
+			"cursor", types.MustMakeDocument("firstBatch", types.MustNewArray(float64(1)), "id", int64(456)),
+			"ok", int32(1), "localTime", time.Unix(2, 0), "$clusterTime", types.MustMakeDocument(),
+		)
+
+		report := newDiffReport(header, find, res, proxy)
+		assert.Equal(t, "find", report.Command)
+		assert.Equal(t, "db", report.DB)
+		assert.Equal(t, int32(42), report.RequestID)
+		assert.True(t, report.Match)
+		assert.Empty(t, report.Diffs)
+		assert.Equal(t, "match", report.result())
+	})
+
+	t.Run("Diverged", func(t *testing.T) {
+		t.Parallel()
+
+		res := shadowMsg(t,
+			"cursor", types.MustMakeDocument(
+				"id", int64(0),
+				"firstBatch", types.MustNewArray(types.MustMakeDocument("_id", "a", "v", "x")),
+			),
+			"ok", float64(1),
+		)
+		proxy := shadowMsg(t,
+			"cursor", types.MustMakeDocument(
+				"id", int64(456),
+				"firstBatch", types.MustNewArray(types.MustMakeDocument("_id", "a", "v", int32(1)), "b"),
+			),
+			"ok", float64(1), "note", nil,
+		)
+
+		report := newDiffReport(header, find, res, proxy)
+		assert.False(t, report.Match)
+		assert.Equal(t, "diverged", report.result())
+
+		expected := []diffField{
+			{Path: "cursor.id", Res: json.RawMessage(`0`), Proxy: json.RawMessage(`456`)},
+			{Path: "cursor.firstBatch.0.v", Res: json.RawMessage(`"x"`), Proxy: json.RawMessage(`1`)},
+			{Path: "cursor.firstBatch.1", Proxy: json.RawMessage(`"b"`)},
+			{Path: "note", Proxy: json.RawMessage(`null`)},
+		}
+		assert.Equal(t, expected, report.Diffs)
+	})
+
+	t.Run("OpQuery", func(t *testing.T) {
+		t.Parallel()
+
+		query := &wire.OpQuery{FullCollectionName: "admin.$cmd", Query: types.MustMakeDocument("isMaster", int32(1))}
+		res := &wire.OpReply{Documents: []types.Document{types.MustMakeDocument("ismaster", true, "ok", float64(1))}}
+		proxy := &wire.OpReply{Documents: []types.Document{types.MustMakeDocument("ismaster", true, "ok", float64(1))}}
+
+		report := newDiffReport(header, query, res, proxy)
+		assert.Equal(t, "isMaster", report.Command)
+		assert.Equal(t, "admin", report.DB)
+		assert.True(t, report.Match)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		t.Parallel()
+
+		report := newDiffReport(header, find, nil, shadowMsg(t, "ok", float64(1)))
+		assert.Equal(t, "res: no reply", report.Error)
+		assert.Equal(t, "failed", report.result())
+	})
+}
+
+func TestDiffReporter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	r := newDiffReporter(&buf)
+
+	report := &diffReport{
+		Time:      time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+		Remote:    "127.0.0.1:12345",
+		RequestID: 1,
+		Command:   "insert",
+		DB:        "db",
+		Diffs:     []diffField{{Path: "n", Res: json.RawMessage(`1`), Proxy: json.RawMessage(`0`)}},
+	}
+	require.NoError(t, r.write(report))
+	require.NoError(t, r.write(&diffReport{Time: report.Time, Command: "ping", Match: true}))
+
+	expected := `{"time":"2022-01-02T03:04:05Z","remote":"127.0.0.1:12345","requestID":1,"command":"insert","db":"db",` +
+		`"match":false,"diffs":[{"path":"n","res":1,"proxy":0}]}` + "\n" +
+		`{"time":"2022-01-02T03:04:05Z","remote":"","requestID":0,"command":"ping","match":true}` + "\n"
+	assert.Equal(t, expected, buf.String())
+}
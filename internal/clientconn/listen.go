@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// UnixPrefix is the prefix of listen addresses of Unix domain sockets, like "unix:/tmp/mongodb-27017.sock".
+// Other listen addresses are TCP addresses like "127.0.0.1:27017".
+const UnixPrefix = "unix:"
+
+// listen returns the listener of the address.
+//
+// Like MongoDB, a stale socket file left by a process which did not stop cleanly is removed,
+// and the socket is only accessible by the user running the process.
+func listen(addr string) (net.Listener, error) {
+	path := strings.TrimPrefix(addr, UnixPrefix)
+	if path == addr {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		return lis, nil
+	}
+
+	if path == "" {
+		return nil, lazyerrors.Errorf("no path of the Unix domain socket %q", addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err = os.Chmod(path, 0o700); err != nil {
+		lis.Close()
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &unixListener{Listener: lis}, nil
+}
+
+// removeStaleSocket removes the socket file of the path if no process accepts connections on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is used by another process", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// unixListener is a listener of a Unix domain socket whose connections have unique remote addresses
+// like "/tmp/mongodb-27017.sock#1", as the ones of the clients are empty,
+// so that they are distinguished in the network statistics and by dropConnections.
+type unixListener struct {
+	net.Listener
+
+	lastID int64
+}
+
+// Accept implements net.Listener.
+func (l *unixListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	id := atomic.AddInt64(&l.lastID, 1)
+	addr := &net.UnixAddr{Net: "unix", Name: fmt.Sprintf("%s#%d", l.Addr().String(), id)}
+
+	return &unixConn{Conn: conn, remoteAddr: addr}, nil
+}
+
+// unixConn is a connection of a unixListener.
+type unixConn struct {
+	net.Conn
+
+	remoteAddr net.Addr
+}
+
+// RemoteAddr implements net.Conn.
+func (c *unixConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// check interfaces
+var (
+	_ net.Listener = (*unixListener)(nil)
+	_ net.Conn     = (*unixConn)(nil)
+)
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestListenUnix(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "test.sock")
+
+	lis, err := listen(UnixPrefix + path)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+
+	// the socket is used
+	_, err = listen(UnixPrefix + path)
+	assert.ErrorContains(t, err, "is used by another process")
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			if c, err := net.Dial("unix", path); err == nil {
+				defer c.Close()
+			}
+		}
+	}()
+
+	// the remote addresses of the connections are unique
+	for _, expected := range []string{path + "#1", path + "#2"} {
+		conn, err := lis.Accept()
+		require.NoError(t, err)
+		assert.Equal(t, expected, conn.RemoteAddr().String())
+		conn.Close()
+	}
+
+	// a stale socket, which is not removed when the listener is closed, is replaced
+	lis.(*unixListener).Listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, lis.Close())
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	lis, err = listen(UnixPrefix + path)
+	require.NoError(t, err)
+	require.NoError(t, lis.Close())
+
+	// files which are not sockets are not removed
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = listen(UnixPrefix + file)
+	assert.ErrorContains(t, err, "is not a socket")
+
+	_, err = listen(UnixPrefix)
+	assert.Error(t, err)
+}
+
+func TestListenerMultipleAddrs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.sock"), filepath.Join(dir, "b.sock")}
+
+	l := NewListener(&NewListenerOpts{
+		ListenAddrs:     []string{UnixPrefix + paths[0], UnixPrefix + paths[1]},
+		Mode:            NormalMode,
+		Logger:          zaptest.NewLogger(t),
+		Metrics:         NewListenerMetrics(),
+		HandlersMetrics: handlers.NewMetrics(),
+		WireMetrics:     wire.NewMetrics(),
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- l.Run(context.Background())
+	}()
+
+	for _, path := range paths {
+		var conn net.Conn
+		require.Eventually(t, func() bool {
+			var err error
+			conn, err = net.Dial("unix", path)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		writeTestMessage(t, conn, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_MSG}, shadowMsg(t, "ping", int32(1), "$db", "admin"))
+
+		_, body, err := wire.ReadMessage(bufio.NewReader(conn))
+		require.NoError(t, err)
+		doc, err := body.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		assert.Equal(t, float64(1), doc.Map()["ok"])
+
+		conn.Close()
+	}
+
+	// all listeners are stopped together
+	l.Shutdown(0)
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	for _, path := range paths {
+		_, err := os.Stat(path)
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	}
+}
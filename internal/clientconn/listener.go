@@ -21,80 +21,267 @@
 package clientconn
 
 import (
+	"bufio"
 	"context"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/ctxutil"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
+// defaultShutdownDelay is the time connections have to finish their requests when the listener stops.
+const defaultShutdownDelay = 3 * time.Second
+
+// rejectTimeout is the time in which a rejected connection must send its first request to receive the error.
+const rejectTimeout = 5 * time.Second
+
 // Listener accepts incoming client connections.
 type Listener struct {
 	opts *NewListenerOpts
+
+	// cursors of find, which clients may continue on any connection
+	cursors *crud.Cursors
+
+	// index builds in progress, which clients may see and abort on any connection
+	indexBuilds *crud.IndexBuilds
+
+	// client sessions with their open transactions, which clients may continue on any connection
+	sessions *handlers.Sessions
+
+	rw            sync.RWMutex
+	stop          context.CancelFunc
+	shutdownDelay time.Duration
+
+	// number of the last accepted connection, which is part of the names of the recordings
+	lastConnID int64
+
+	// number of the open connections, without rejected ones
+	openConns int64
 }
 
 type NewListenerOpts struct {
-	ListenAddr      string
-	TLS             bool
-	TLSCertFilePath string
-	TLSKeyFilePath  string
+	ListenAddrs     []string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSCAFile       string
 	ProxyAddr       string
 	Mode            Mode
 	HanaPool        *hana.Hpool
 	Logger          *zap.Logger
 	Metrics         *ListenerMetrics
 	HandlersMetrics *handlers.Metrics
+	WireMetrics     *wire.Metrics
+	Quotas          *crud.Quotas
+	Mappings        *handlers.Mappings
+	Coalescer       *crud.Coalescer
+	CursorReadAhead int64
+	KeyValidation   common.KeyValidation
+	Middlewares     []handlers.Middleware
+	Sandbox         *handlers.Sandbox
+	SupportBundle   *support.Collector
+	SlowCommand     time.Duration
 	TestConnTimeout time.Duration
+
+	// TLSRequireClientCert requires clients to send a certificate verified by TLSCAFile.
+	TLSRequireClientCert bool
+
+	// RequireAuth only allows the commands of the handshake until a connection is authenticated.
+	RequireAuth bool
+
+	// ProxyProtocol requires connections to start with a PROXY protocol header with the address of the client,
+	// like sent by load balancers.
+	ProxyProtocol bool
+
+	// ProxyProtocolTrusted are the IP addresses and CIDR networks of the load balancers which may send the header,
+	// all if empty. Connections from other addresses are closed.
+	ProxyProtocolTrusted []string
+
+	// MaxConnections is the maximum number of open connections, unlimited if 0.
+	// Further connections are rejected with an error to their first request.
+	MaxConnections int
+
+	// RecordDir is the directory to which the requests and replies of every connection are recorded,
+	// unredacted, none if empty. It must only be used in development, see config.Config.Validate.
+	RecordDir string
+
+	// DiffReportFile is the file to which the JSON reports of the differences of the replies
+	// in the diff modes are appended, none if empty.
+	DiffReportFile string
+
+	// UserPools enables SAP HANA credential passthrough: connections authenticate with PLAIN,
+	// and their commands use SAP HANA connections opened with the credentials of the client.
+	UserPools hana.UserPoolOpener
+
+	// ReadOnly rejects writes to SAP HANA with NotWritablePrimary.
+	ReadOnly bool
+
+	// LogUnredacted logs documents, filters and the messages of errors instead of their shapes and codes,
+	// only for development.
+	LogUnredacted bool
+
+	// Capture writes the commands of all connections, if not nil.
+	Capture *handlers.Capture
 }
 
 // NewListener returns a new listener, configured by the NewListenerOpts argument.
 func NewListener(opts *NewListenerOpts) *Listener {
 	return &Listener{
-		opts: opts,
+		opts:          opts,
+		cursors:       crud.NewCursors(opts.CursorReadAhead),
+		indexBuilds:   crud.NewIndexBuilds(),
+		sessions:      handlers.NewSessions(opts.Logger, opts.HandlersMetrics),
+		shutdownDelay: defaultShutdownDelay,
+	}
+}
+
+// Shutdown stops the listener like the cancelation of the context given to Run.
+// Open connections are closed after the given delay, or immediately if it is zero.
+func (l *Listener) Shutdown(delay time.Duration) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+
+	l.shutdownDelay = delay
+	if l.stop != nil {
+		l.stop()
 	}
 }
 
 // Run runs the listener until ctx is canceled or some unrecoverable error occurs.
 func (l *Listener) Run(ctx context.Context) error {
-	lis, err := net.Listen("tcp", l.opts.ListenAddr)
-	if err != nil {
-		return lazyerrors.Error(err)
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	l.rw.Lock()
+	l.stop = stop
+	l.rw.Unlock()
+
+	if len(l.opts.ListenAddrs) == 0 {
+		return lazyerrors.Errorf("no listen address")
 	}
 
-	l.opts.Logger.Sugar().Infof("Listening on %s ...", l.opts.ListenAddr)
+	if l.opts.RecordDir != "" {
+		if err := os.MkdirAll(l.opts.RecordDir, 0o700); err != nil {
+			return lazyerrors.Error(err)
+		}
+		l.opts.Logger.Warn("Recording all requests and replies", zap.String("dir", l.opts.RecordDir))
+	}
 
-	if l.opts.TLS {
-		tlsConfig, err := generateX509Cert(l.opts.TLSCertFilePath, l.opts.TLSKeyFilePath)
+	var reporter *diffReporter
+	if l.opts.DiffReportFile != "" {
+		f, err := os.OpenFile(l.opts.DiffReportFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
 		if err != nil {
+			return lazyerrors.Error(err)
+		}
+		defer f.Close()
+
+		reporter = newDiffReporter(f)
+	}
+
+	var tlsConfig *tls.Config
+	if l.opts.TLSCertFile != "" {
+		var err error
+		if tlsConfig, err = loadTLSConfig(l.opts.TLSCertFile, l.opts.TLSKeyFile, l.opts.TLSCAFile, l.opts.TLSRequireClientCert); err != nil {
 			return err
 		}
+	}
 
-		lis = tls.NewListener(lis, tlsConfig)
+	trustedProxies, err := ParseTrustedProxies(l.opts.ProxyProtocolTrusted)
+	if err != nil {
+		return err
+	}
+	if l.opts.ProxyProtocol && len(trustedProxies) == 0 {
+		l.opts.Logger.Warn("Trusting the PROXY protocol headers of all connections, set the trusted load balancers")
 	}
 
-	// handle ctx cancelation
+	// the listeners of all addresses are closed if one address can't be listened on
+	listeners := make([]net.Listener, 0, len(l.opts.ListenAddrs))
+	for _, addr := range l.opts.ListenAddrs {
+		lis, err := listen(addr)
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return err
+		}
+
+		// the PROXY header precedes the TLS handshake
+		if l.opts.ProxyProtocol {
+			lis = &proxyListener{Listener: lis, trusted: trustedProxies}
+		}
+		if tlsConfig != nil {
+			lis = tls.NewListener(lis, tlsConfig)
+		}
+		listeners = append(listeners, lis)
+
+		l.opts.Logger.Sugar().Infof("Listening on %s ...", addr)
+	}
+
+	// handle ctx cancelation and give connections the shutdown delay to finish their requests
+	connsDone := make(chan struct{})
 	go func() {
 		<-ctx.Done()
-		lis.Close()
+		for _, lis := range listeners {
+			lis.Close()
+		}
+
+		l.rw.RLock()
+		delay := l.shutdownDelay
+		l.rw.RUnlock()
+
+		time.Sleep(delay)
+		close(connsDone)
 	}()
 
-	const delay = 3 * time.Second
+	// timed out cursors are closed even if no new ones are opened
+	go l.cursors.Reap(ctx)
+
+	// transactions are rolled back after their lifetime limit even if no new ones are started
+	go l.sessions.Reap(ctx)
 
+	// connections of all listeners
 	var wg sync.WaitGroup
+
+	var acceptWG sync.WaitGroup
+	for _, lis := range listeners {
+		acceptWG.Add(1)
+		go func(lis net.Listener) {
+			defer acceptWG.Done()
+			l.accept(ctx, lis, connsDone, &wg, reporter)
+		}(lis)
+	}
+	acceptWG.Wait()
+
+	l.opts.Logger.Info("Waiting for all connections to stop...")
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// accept accepts the connections of the listener and runs them until ctx is canceled.
+// Connections are added to wg, and their context is canceled when connsDone is closed.
+// reporter writes the reports of the diff modes, if any.
+func (l *Listener) accept(ctx context.Context, lis net.Listener, connsDone <-chan struct{}, wg *sync.WaitGroup, reporter *diffReporter) {
 	for {
 		netConn, err := lis.Accept()
 		if err != nil {
 			if ctx.Err() != nil {
-				break
+				return
 			}
 
 			l.opts.Logger.Warn("Failed to accept connection", zap.Error(err))
@@ -105,22 +292,72 @@ func (l *Listener) Run(ctx context.Context) error {
 		}
 
 		wg.Add(1)
+
+		if n := atomic.AddInt64(&l.openConns, 1); l.opts.MaxConnections > 0 && n > int64(l.opts.MaxConnections) {
+			atomic.AddInt64(&l.openConns, -1)
+			l.opts.Metrics.RejectedConnections.Inc()
+
+			go func() {
+				defer func() {
+					netConn.Close()
+					wg.Done()
+				}()
+
+				l.reject(netConn)
+			}()
+			continue
+		}
+
 		l.opts.Metrics.ConnectedClients.Inc()
 
 		// run connection
 		go func() {
 			defer func() {
 				netConn.Close()
+				atomic.AddInt64(&l.openConns, -1)
 				l.opts.Metrics.ConnectedClients.Dec()
 				wg.Done()
 			}()
 
+			// the handshake is completed before the recording, which records the decrypted connection
+			identity, issuer, e := clientIdentity(netConn)
+			if e != nil {
+				l.opts.Logger.Warn("TLS handshake failed", zap.String("remote", netConn.RemoteAddr().String()), zap.Error(e))
+				return
+			}
+
+			if l.opts.RecordDir != "" {
+				netConn = l.record(netConn)
+			}
+
 			opts := &newConnOpts{
 				netConn:         netConn,
 				hanaPool:        l.opts.HanaPool,
 				proxyAddr:       l.opts.ProxyAddr,
 				mode:            l.opts.Mode,
+				metrics:         l.opts.Metrics,
 				handlersMetrics: l.opts.HandlersMetrics,
+				wireMetrics:     l.opts.WireMetrics,
+				quotas:          l.opts.Quotas,
+				mappings:        l.opts.Mappings,
+				cursors:         l.cursors,
+				indexBuilds:     l.indexBuilds,
+				sessions:        l.sessions,
+				coalescer:       l.opts.Coalescer,
+				keyValidation:   l.opts.KeyValidation,
+				middlewares:     l.opts.Middlewares,
+				sandbox:         l.opts.Sandbox,
+				supportBundle:   l.opts.SupportBundle,
+				slowCommand:     l.opts.SlowCommand,
+				shutdown:        l.Shutdown,
+				clientIdentity:  identity,
+				clientIssuer:    issuer,
+				diffReporter:    reporter,
+				capture:         l.opts.Capture,
+				requireAuth:     l.opts.RequireAuth,
+				userPools:       l.opts.UserPools,
+				readOnly:        l.opts.ReadOnly,
+				logUnredacted:   l.opts.LogUnredacted,
 			}
 			conn, e := newConn(opts)
 			if e != nil {
@@ -128,7 +365,7 @@ func (l *Listener) Run(ctx context.Context) error {
 				return
 			}
 
-			runCtx, runCancel := ctxutil.WithDelay(ctx.Done(), delay)
+			runCtx, runCancel := ctxutil.WithDelay(connsDone, 0)
 			defer runCancel()
 
 			if l.opts.TestConnTimeout != 0 {
@@ -145,8 +382,59 @@ func (l *Listener) Run(ctx context.Context) error {
 		}()
 	}
 
-	l.opts.Logger.Info("Waiting for all connections to stop...")
-	wg.Wait()
+}
 
-	return ctx.Err()
+// reject replies to the first request of a connection over the maximum number of connections
+// with an error, instead of handling it with a SAP HANA connection of the pool.
+// Clients see the error on their handshake, like the drivers with the reply to hello.
+func (l *Listener) reject(netConn net.Conn) {
+	// the remote address is read before the deadline is set, as it may read the PROXY header with its own deadline
+	remote := netConn.RemoteAddr().String()
+	l.opts.Logger.Warn(
+		"Connection refused because there are too many open connections",
+		zap.String("remote", remote), zap.Int("max", l.opts.MaxConnections),
+	)
+
+	if err := netConn.SetDeadline(time.Now().Add(rejectTimeout)); err != nil {
+		return
+	}
+
+	reqHeader, _, err := wire.ReadMessage(bufio.NewReader(netConn))
+	if reqHeader == nil {
+		l.opts.Logger.Debug("Failed to read the request of the rejected connection", zap.String("remote", remote), zap.Error(err))
+		return
+	}
+
+	resHeader, resBody := handlers.ErrorReply(reqHeader, common.NewErrorMessage(
+		common.ErrHostUnreachable,
+		"connection refused because there are too many open connections: %d", l.opts.MaxConnections,
+	))
+	if resBody == nil {
+		return
+	}
+
+	bufw := bufio.NewWriter(netConn)
+	if err = wire.WriteMessage(bufw, resHeader, resBody); err == nil {
+		err = bufw.Flush()
+	}
+	if err != nil {
+		l.opts.Logger.Debug("Failed to reply to the rejected connection", zap.String("remote", remote), zap.Error(err))
+	}
+}
+
+// record returns the connection recording its requests and replies to the record directory,
+// or the connection itself if the recording files can't be created.
+func (l *Listener) record(netConn net.Conn) net.Conn {
+	id := atomic.AddInt64(&l.lastConnID, 1)
+	name := fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405"), id)
+
+	rc, err := newRecordingConn(netConn, l.opts.RecordDir, name)
+	if err != nil {
+		l.opts.Logger.Warn("Failed to record connection", zap.Error(err))
+		return netConn
+	}
+
+	l.opts.Logger.Info("Recording connection", zap.String("remote", netConn.RemoteAddr().String()), zap.String("name", name))
+
+	return rc
 }
@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -27,7 +29,10 @@ const (
 
 // ListenerMetrics represents listener metrics.
 type ListenerMetrics struct {
-	ConnectedClients prometheus.Gauge
+	ConnectedClients    prometheus.Gauge
+	RejectedConnections prometheus.Counter
+	ShadowedRequests    *prometheus.CounterVec
+	DiffedRequests      *prometheus.CounterVec
 }
 
 // NewListenerMetrics creates new listener metrics.
@@ -41,17 +46,49 @@ func NewListenerMetrics() *ListenerMetrics {
 				Help:      "The current number of connected clients.",
 			},
 		),
+		RejectedConnections: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "rejected_connections_total",
+				Help:      "Total number of connections rejected because of the maximum number of connections.",
+			},
+		),
+		ShadowedRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "shadowed_requests_total",
+				Help:      "Total number of writes shadowed to the secondary backend, by result: match, diverged, failed or dropped.",
+			},
+			[]string{"command", "result"},
+		),
+		DiffedRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "diffed_requests_total",
+				Help:      "Total number of requests compared between both backends in the diff modes, by result: match, diverged or failed.",
+			},
+			[]string{"command", "result"},
+		),
 	}
 }
 
 // Describe implements prometheus.Collector.
 func (lm *ListenerMetrics) Describe(ch chan<- *prometheus.Desc) {
 	lm.ConnectedClients.Describe(ch)
+	lm.RejectedConnections.Describe(ch)
+	lm.ShadowedRequests.Describe(ch)
+	lm.DiffedRequests.Describe(ch)
 }
 
 // Collect implements prometheus.Collector.
 func (lm *ListenerMetrics) Collect(ch chan<- prometheus.Metric) {
 	lm.ConnectedClients.Collect(ch)
+	lm.RejectedConnections.Collect(ch)
+	lm.ShadowedRequests.Collect(ch)
+	lm.DiffedRequests.Collect(ch)
 }
 
 // check interfaces
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// writeTestMessage writes the request to the connection.
+func writeTestMessage(t *testing.T, conn net.Conn, header *wire.MsgHeader, body wire.MsgBody) {
+	t.Helper()
+
+	l, err := wire.BodySize(body)
+	require.NoError(t, err)
+	header.MessageLength = int32(wire.MsgHeaderLen + l)
+
+	bufw := bufio.NewWriter(conn)
+	require.NoError(t, wire.WriteMessage(bufw, header, body))
+	require.NoError(t, bufw.Flush())
+}
+
+func TestReject(t *testing.T) {
+	t.Parallel()
+
+	l := NewListener(&NewListenerOpts{
+		Logger:         zaptest.NewLogger(t),
+		Metrics:        NewListenerMetrics(),
+		MaxConnections: 2,
+	})
+
+	t.Run("OpMsg", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		defer client.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer server.Close()
+			l.reject(server)
+		}()
+
+		hello := shadowMsg(t, "hello", int32(1), "$db", "admin")
+		writeTestMessage(t, client, &wire.MsgHeader{RequestID: 42, OpCode: wire.OP_MSG}, hello)
+
+		header, body, err := wire.ReadMessage(bufio.NewReader(client))
+		require.NoError(t, err)
+		assert.Equal(t, int32(42), header.ResponseTo)
+
+		doc, err := body.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "connection refused because there are too many open connections: 2",
+			"code", int32(6),
+			"codeName", "HostUnreachable",
+		)
+		assert.Equal(t, expected, doc)
+
+		<-done
+	})
+
+	t.Run("OpQuery", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		defer client.Close()
+
+		go func() {
+			defer server.Close()
+			l.reject(server)
+		}()
+
+		query := &wire.OpQuery{
+			FullCollectionName: "admin.$cmd",
+			NumberToReturn:     -1,
+			Query:              types.MustMakeDocument("isMaster", int32(1)),
+		}
+		writeTestMessage(t, client, &wire.MsgHeader{RequestID: 7, OpCode: wire.OP_QUERY}, query)
+
+		header, body, err := wire.ReadMessage(bufio.NewReader(client))
+		require.NoError(t, err)
+		assert.Equal(t, wire.OP_REPLY, header.OpCode)
+
+		reply := body.(*wire.OpReply)
+		assert.True(t, reply.ResponseFlags.FlagSet(wire.OpReplyQueryFailure))
+		assert.Equal(t, int32(6), reply.Documents[0].Map()["code"])
+	})
+}
@@ -0,0 +1,301 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// proxyHeaderTimeout is the time in which clients must send the PROXY protocol header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyHeaderV1MaxLen is the maximum length of a PROXY protocol v1 header, including CRLF.
+const proxyHeaderV1MaxLen = 107
+
+// proxyHeaderV2Sig is the signature starting a PROXY protocol v2 header.
+var proxyHeaderV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// errNoProxyHeader is returned for connections which do not start with a PROXY protocol header.
+var errNoProxyHeader = errors.New("no PROXY protocol header")
+
+// errUntrustedProxy is returned for TCP connections whose address is not one of the trusted proxies.
+var errUntrustedProxy = errors.New("not a trusted proxy")
+
+// ParseTrustedProxies returns the networks of the trusted proxies given as IP addresses or CIDR networks,
+// like "10.0.0.1" or "10.0.0.0/8".
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	res := make([]*net.IPNet, len(proxies))
+	for i, p := range proxies {
+		if ip := net.ParseIP(p); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			res[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, expected an IP address or a CIDR network", p)
+		}
+		res[i] = n
+	}
+
+	return res, nil
+}
+
+// proxyListener is a listener behind a load balancer like HAProxy or ELB, which sends the PROXY protocol v1 or v2 header
+// with the address of the client before the data of every connection, see
+// https://www.haproxy.org/download/2.6/doc/proxy-protocol.txt.
+type proxyListener struct {
+	net.Listener
+
+	// trusted are the networks of the load balancers which may send the header, all if empty
+	trusted []*net.IPNet
+}
+
+// Accept implements net.Listener.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyConn{Conn: conn, trusted: l.trusted}, nil
+}
+
+// proxyConn is a connection of a proxyListener, whose remote address is the one of the client sent in the PROXY header.
+//
+// The header is read on the first Read or RemoteAddr, so that a slow client does not block the accept loop.
+// Connections without a valid header fail on Read, as their data can't be told apart from a header,
+// and so do TCP connections which do not come from a trusted proxy.
+type proxyConn struct {
+	net.Conn
+
+	trusted []*net.IPNet
+
+	once       sync.Once
+	r          *bufio.Reader
+	remoteAddr net.Addr
+	err        error
+
+	// the read deadline set before the header was read, which is restored after it
+	m            sync.Mutex
+	headerRead   bool
+	readDeadline time.Time
+}
+
+// readHeader reads the PROXY header once.
+func (c *proxyConn) readHeader() {
+	c.once.Do(func() {
+		c.r = bufio.NewReader(c.Conn)
+
+		c.m.Lock()
+		deadline := time.Now().Add(proxyHeaderTimeout)
+		if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		c.m.Unlock()
+
+		defer func() {
+			c.m.Lock()
+			defer c.m.Unlock()
+
+			c.headerRead = true
+			if c.err == nil {
+				c.err = c.Conn.SetReadDeadline(c.readDeadline)
+			}
+		}()
+
+		if !c.isTrusted() {
+			c.err = lazyerrors.Errorf("%s: %w", c.Conn.RemoteAddr(), errUntrustedProxy)
+			return
+		}
+
+		if c.err = c.Conn.SetReadDeadline(deadline); c.err != nil {
+			return
+		}
+
+		c.remoteAddr, c.err = readProxyHeader(c.r)
+		if c.err != nil {
+			c.err = lazyerrors.Errorf("%s: %w", c.Conn.RemoteAddr(), c.err)
+		}
+	})
+}
+
+// isTrusted returns true if the connection comes from a trusted proxy.
+// Connections which are not TCP connections, like the ones of Unix domain sockets, are always trusted.
+func (c *proxyConn) isTrusted() bool {
+	addr, ok := c.Conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || len(c.trusted) == 0 {
+		return true
+	}
+
+	for _, n := range c.trusted {
+		if n.Contains(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetDeadline implements net.Conn.
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn. Before the header is read, the deadline is only set after it.
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.readDeadline = t
+	if !c.headerRead {
+		return nil
+	}
+
+	return c.Conn.SetReadDeadline(t)
+}
+
+// Read implements net.Conn.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.readHeader()
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.r.Read(b)
+}
+
+// RemoteAddr implements net.Conn and returns the address of the client sent in the PROXY header,
+// or the address of the load balancer for its own connections, like health checks.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.readHeader()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header and returns the source address of it.
+// The address is nil for connections of the load balancer itself and for unknown protocols.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	b, err := r.Peek(len(proxyHeaderV2Sig))
+	switch {
+	case bytes.Equal(b, proxyHeaderV2Sig):
+		return readProxyHeaderV2(r)
+	case bytes.HasPrefix(b, []byte("PROXY ")):
+		return readProxyHeaderV1(r)
+	case err != nil:
+		return nil, err
+	default:
+		return nil, errNoProxyHeader
+	}
+}
+
+// readProxyHeaderV1 reads a header of the human-readable v1 format, like "PROXY TCP4 192.0.2.1 192.0.2.2 56324 27017\r\n".
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyHeaderV1MaxLen {
+			return nil, fmt.Errorf("PROXY v1 header is longer than %d bytes", proxyHeaderV1MaxLen)
+		}
+
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY v1 header %q", line)
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("invalid PROXY v1 header %q", line)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyHeaderV2 reads a header of the binary v2 format.
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+
+	verCmd, family := fixed[12], fixed[13]
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if verCmd>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY v2 header version %d", verCmd>>4)
+	}
+
+	switch verCmd & 0x0f {
+	case 0x0: // LOCAL
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("unsupported PROXY v2 header command %d", verCmd&0x0f)
+	}
+
+	// the address family is in the high and the transport protocol in the low 4 bits
+	var ipLen int
+	switch family {
+	case 0x11: // TCP over IPv4
+		ipLen = net.IPv4len
+	case 0x21: // TCP over IPv6
+		ipLen = net.IPv6len
+	default:
+		return nil, nil
+	}
+
+	// source and destination addresses, then source and destination ports; TLVs may follow
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("PROXY v2 address of %d bytes is too short", len(payload))
+	}
+
+	ip := make(net.IP, ipLen)
+	copy(ip, payload[:ipLen])
+	port := binary.BigEndian.Uint16(payload[2*ipLen:])
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// check interfaces
+var (
+	_ net.Listener = (*proxyListener)(nil)
+	_ net.Conn     = (*proxyConn)(nil)
+)
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyHeaderV2 returns a PROXY v2 header with the command, the address family and the address payload.
+func proxyHeaderV2(cmd, family byte, payload []byte) []byte {
+	b := append([]byte{}, proxyHeaderV2Sig...)
+	b = append(b, 0x20|cmd, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(payload)))
+	return append(b, payload...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	t.Parallel()
+
+	tcp4 := append(net.ParseIP("192.0.2.1").To4(), net.ParseIP("192.0.2.2").To4()...)
+	tcp4 = append(tcp4, 0xdc, 0x04, 0x69, 0x89) // ports 56324 and 27017
+
+	tcp6 := append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...)
+	tcp6 = append(tcp6, 0xdc, 0x04, 0x69, 0x89)
+
+	for name, tc := range map[string]struct {
+		header   string
+		expected string
+		err      string
+	}{
+		"V1TCP4":    {header: "PROXY TCP4 192.0.2.1 192.0.2.2 56324 27017\r\n", expected: "192.0.2.1:56324"},
+		"V1TCP6":    {header: "PROXY TCP6 2001:db8::1 2001:db8::2 56324 27017\r\n", expected: "[2001:db8::1]:56324"},
+		"V1Unknown": {header: "PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"},
+		"V1Mixed":   {header: "PROXY TCP4 2001:db8::1 192.0.2.2 56324 27017\r\n", err: "invalid PROXY v1 header"},
+		"V1Port":    {header: "PROXY TCP4 192.0.2.1 192.0.2.2 65536 27017\r\n", err: "invalid PROXY v1 header"},
+		"V1TooLong": {header: "PROXY TCP4 " + strings.Repeat("1", 100) + "\r\n", err: "longer than 107 bytes"},
+		"V2TCP4":    {header: string(proxyHeaderV2(0x1, 0x11, tcp4)), expected: "192.0.2.1:56324"},
+		"V2TCP6":    {header: string(proxyHeaderV2(0x1, 0x21, append(tcp6, 0x04, 0, 0))), expected: "[2001:db8::1]:56324"},
+		"V2Local":   {header: string(proxyHeaderV2(0x0, 0x00, nil))},
+		"V2Unspec":  {header: string(proxyHeaderV2(0x1, 0x00, []byte{1, 2, 3}))},
+		"V2Short":   {header: string(proxyHeaderV2(0x1, 0x11, tcp4[:8])), err: "too short"},
+		"V2Command": {header: string(proxyHeaderV2(0x2, 0x11, tcp4)), err: "unsupported PROXY v2 header command 2"},
+		"None":      {header: "\x3a\x00\x00\x00 OP_MSG of a client", err: "no PROXY protocol header"},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := bufio.NewReader(strings.NewReader(tc.header + "data"))
+			addr, err := readProxyHeader(r)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.expected == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, tc.expected, addr.String())
+			}
+
+			// the data after the header is kept
+			rest, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "data", string(rest))
+		})
+	}
+}
+
+func TestProxyConn(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Header", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		defer client.Close()
+
+		go client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 27017\r\nrequest"))
+
+		conn := &proxyConn{Conn: server}
+		defer conn.Close()
+
+		assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+
+		b := make([]byte, 7)
+		_, err := io.ReadFull(conn, b)
+		require.NoError(t, err)
+		assert.Equal(t, "request", string(b))
+	})
+
+	t.Run("NoHeader", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		defer client.Close()
+
+		go client.Write(bytes.Repeat([]byte{0}, 16))
+
+		conn := &proxyConn{Conn: server}
+		defer conn.Close()
+
+		_, err := conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, errNoProxyHeader)
+		assert.Equal(t, server.RemoteAddr(), conn.RemoteAddr())
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		t.Parallel()
+
+		client, server := net.Pipe()
+		defer client.Close()
+
+		go client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 27017\r\n"))
+
+		conn := &proxyConn{Conn: server}
+		defer conn.Close()
+
+		// the deadline set before the header is read applies after it
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+		assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String())
+
+		_, err := conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+
+	t.Run("Untrusted", func(t *testing.T) {
+		t.Parallel()
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer lis.Close()
+
+		trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+		require.NoError(t, err)
+		lis = &proxyListener{Listener: lis, trusted: trusted}
+
+		client, err := net.Dial("tcp", lis.Addr().String())
+		require.NoError(t, err)
+		defer client.Close()
+
+		go client.Write([]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 27017\r\n"))
+
+		conn, err := lis.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, errUntrustedProxy)
+		assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+	})
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "::1"})
+	require.NoError(t, err)
+	require.Len(t, trusted, 3)
+	assert.True(t, trusted[0].Contains(net.ParseIP("10.0.0.1")))
+	assert.False(t, trusted[0].Contains(net.ParseIP("10.0.0.2")))
+	assert.True(t, trusted[1].Contains(net.ParseIP("192.168.1.1")))
+	assert.True(t, trusted[2].Contains(net.IPv6loopback))
+
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.EqualError(t, err, `invalid trusted proxy "proxy", expected an IP address or a CIDR network`)
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+const (
+	// RecordRequestsExt is the extension of the files of the recorded requests of a connection.
+	RecordRequestsExt = ".requests.bin"
+
+	// RecordRepliesExt is the extension of the files of the recorded replies of a connection.
+	RecordRepliesExt = ".replies.bin"
+)
+
+// recordingConn is a client connection recording the raw bytes read from and written to the client,
+// which are the wire protocol frames of the requests and the replies, to two files of the record directory.
+// Both files are sequences of frames, which can be replayed with replaytool.
+//
+// A failed write to a file stops the recording of the connection, but not the connection itself.
+type recordingConn struct {
+	net.Conn
+
+	m        sync.Mutex
+	requests *os.File
+	replies  *os.File
+	err      error
+}
+
+// newRecordingConn returns a connection recording to the files name.requests.bin and name.replies.bin of dir.
+func newRecordingConn(conn net.Conn, dir, name string) (*recordingConn, error) {
+	requests, err := os.OpenFile(filepath.Join(dir, name+RecordRequestsExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	replies, err := os.OpenFile(filepath.Join(dir, name+RecordRepliesExt), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		requests.Close()
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &recordingConn{
+		Conn:     conn,
+		requests: requests,
+		replies:  replies,
+	}, nil
+}
+
+// Read implements net.Conn and records the bytes read.
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(c.requests, b[:n])
+	return n, err
+}
+
+// Write implements net.Conn and records the bytes written.
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(c.replies, b[:n])
+	return n, err
+}
+
+// record writes the bytes to the file, unless an earlier write failed.
+func (c *recordingConn) record(f *os.File, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	if _, err := f.Write(b); err != nil {
+		c.err = lazyerrors.Error(err)
+	}
+}
+
+// Close implements net.Conn and closes the files of the recording.
+// It returns the error of the connection, or else the one of the recording.
+func (c *recordingConn) Close() error {
+	err := c.Conn.Close()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, e := range []error{c.err, c.requests.Close(), c.replies.Close()} {
+		if err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// check interfaces
+var (
+	_ net.Conn = (*recordingConn)(nil)
+)
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordingConn(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	client, server := net.Pipe()
+	defer client.Close()
+
+	rc, err := newRecordingConn(server, dir, "conn-1")
+	require.NoError(t, err)
+
+	go func() {
+		client.Write([]byte("request"))
+		io.ReadAll(client)
+	}()
+
+	b := make([]byte, 7)
+	_, err = io.ReadFull(rc, b)
+	require.NoError(t, err)
+	_, err = rc.Write([]byte("reply"))
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	requests, err := os.ReadFile(filepath.Join(dir, "conn-1"+RecordRequestsExt))
+	require.NoError(t, err)
+	assert.Equal(t, "request", string(requests))
+
+	replies, err := os.ReadFile(filepath.Join(dir, "conn-1"+RecordRepliesExt))
+	require.NoError(t, err)
+	assert.Equal(t, "reply", string(replies))
+
+	// recordings are not overwritten
+	_, err = newRecordingConn(server, dir, "conn-1")
+	require.ErrorIs(t, err, os.ErrExist)
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestDumpMsgBody(t *testing.T) {
+	t.Parallel()
+
+	find := shadowMsg(t, "find", "users", "filter", types.MustMakeDocument("email", "alice@example.com"), "$db", "app")
+	saslStart := shadowMsg(t, "saslStart", int32(1), "mechanism", "PLAIN", "payload", "\x00APP\x00secret", "$db", "$external")
+
+	c := &conn{}
+	assert.NotContains(t, c.dumpMsgBody(find), "alice@example.com")
+	assert.NotContains(t, c.dumpMsgBody(saslStart), "secret")
+
+	// credentials are redacted in unredacted logs too
+	c.logUnredacted = true
+	assert.Contains(t, c.dumpMsgBody(find), "alice@example.com")
+	assert.NotContains(t, c.dumpMsgBody(saslStart), "secret")
+}
@@ -0,0 +1,252 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+const (
+	// shadowQueueSize is the number of writes of a connection waiting for the secondary backend.
+	// Further writes are dropped until the secondary backend catches up.
+	shadowQueueSize = 128
+
+	// shadowMinBackoff and shadowMaxBackoff bound the wait for the secondary backend after an error.
+	// The wait doubles with every consecutive error.
+	shadowMinBackoff = 100 * time.Millisecond
+	shadowMaxBackoff = 10 * time.Second
+)
+
+// shadowCommands are the commands shadowed to the secondary backend.
+var shadowCommands = map[string]struct{}{
+	"insert":           {},
+	"update":           {},
+	"delete":           {},
+	"findAndModify":    {},
+	"create":           {},
+	"drop":             {},
+	"dropDatabase":     {},
+	"createIndexes":    {},
+	"dropIndexes":      {},
+	"collMod":          {},
+	"renameCollection": {},
+}
+
+// shadowFields are the reply fields compared between the primary and the secondary backend.
+var shadowFields = []string{"ok", "n", "nModified", "code"}
+
+// shadowHandleFunc sends a request to the secondary backend.
+//
+// Returned error is something fatal.
+type shadowHandleFunc func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error)
+
+// shadowRequest is a write waiting for the secondary backend.
+type shadowRequest struct {
+	command string
+	header  *wire.MsgHeader
+	body    wire.MsgBody
+	primary wire.MsgBody
+}
+
+// shadower asynchronously sends the writes of a connection to the secondary backend, in order,
+// and compares the replies with the ones of the primary backend.
+type shadower struct {
+	handle   shadowHandleFunc
+	metrics  *ListenerMetrics
+	l        *zap.SugaredLogger
+	requests chan *shadowRequest
+	closing  chan struct{}
+	done     chan struct{}
+}
+
+// newShadower creates a shadower and starts sending writes until close is called or ctx is canceled.
+func newShadower(ctx context.Context, handle shadowHandleFunc, metrics *ListenerMetrics, l *zap.SugaredLogger) *shadower {
+	s := &shadower{
+		handle:   handle,
+		metrics:  metrics,
+		l:        l,
+		requests: make(chan *shadowRequest, shadowQueueSize),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.run(ctx)
+
+	return s
+}
+
+// enqueue queues the request for the secondary backend if it is a write.
+// primary is the reply of the primary backend.
+func (s *shadower) enqueue(header *wire.MsgHeader, body, primary wire.MsgBody) {
+	msg, ok := body.(*wire.OpMsg)
+	if !ok {
+		return
+	}
+
+	document, err := msg.Document()
+	if err != nil {
+		return
+	}
+
+	command := document.Command()
+	if _, ok := shadowCommands[command]; !ok {
+		return
+	}
+
+	select {
+	case s.requests <- &shadowRequest{command: command, header: header, body: body, primary: primary}:
+	default:
+		s.metrics.ShadowedRequests.WithLabelValues(command, "dropped").Inc()
+		s.l.Warnf("Shadow queue is full, %s is not sent to the secondary backend.", command)
+	}
+}
+
+// close waits until all queued writes are sent to the secondary backend.
+// While the secondary backend is backed off after an error, the queued writes fail instead.
+func (s *shadower) close() {
+	close(s.closing)
+	close(s.requests)
+	<-s.done
+}
+
+// run sends queued writes to the secondary backend.
+//
+// After an error the write is not retried, as it may have been applied, but the next one is sent
+// after a backoff, so that shadowing resumes when the secondary backend is reachable again.
+func (s *shadower) run(ctx context.Context) {
+	defer close(s.done)
+
+	var backoff time.Duration
+	for req := range s.requests {
+		// after cancelation, queued writes are not sent so that the connection closes fast
+		if ctx.Err() != nil || !s.wait(ctx, backoff) {
+			s.metrics.ShadowedRequests.WithLabelValues(req.command, "failed").Inc()
+			continue
+		}
+
+		_, body, err := s.handle(ctx, req.header, req.body)
+		if err != nil {
+			switch {
+			case backoff == 0:
+				backoff = shadowMinBackoff
+			case backoff < shadowMaxBackoff:
+				backoff *= 2
+				if backoff > shadowMaxBackoff {
+					backoff = shadowMaxBackoff
+				}
+			}
+
+			s.metrics.ShadowedRequests.WithLabelValues(req.command, "failed").Inc()
+			s.l.Warnf("Secondary backend returned error, sending the next write in %s: %s.", backoff, err)
+			continue
+		}
+		backoff = 0
+
+		// the replies of unacknowledged writes are not sent to the client and can not be compared
+		if wire.NoReply(req.header, req.body) {
+			s.metrics.ShadowedRequests.WithLabelValues(req.command, "unacknowledged").Inc()
+			continue
+		}
+
+		diff, err := shadowDiff(req.primary, body)
+		if err != nil {
+			s.metrics.ShadowedRequests.WithLabelValues(req.command, "failed").Inc()
+			s.l.Warnf("Failed to compare %s replies: %s.", req.command, err)
+			continue
+		}
+
+		if len(diff) == 0 {
+			s.metrics.ShadowedRequests.WithLabelValues(req.command, "match").Inc()
+			continue
+		}
+
+		s.metrics.ShadowedRequests.WithLabelValues(req.command, "diverged").Inc()
+		s.l.Warnf("Secondary backend diverged for %s: %v.", req.command, diff)
+	}
+}
+
+// wait waits for the backoff, and returns false if ctx is canceled or the shadower is closed before.
+func (s *shadower) wait(ctx context.Context, backoff time.Duration) bool {
+	if backoff == 0 {
+		return true
+	}
+
+	t := time.NewTimer(backoff)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-s.closing:
+		return false
+	}
+}
+
+// shadowDiff returns the differences of the shadowFields of the primary and secondary replies,
+// formatted as "field: primary != secondary".
+func shadowDiff(primary, secondary wire.MsgBody) ([]string, error) {
+	p, err := shadowReply(primary)
+	if err != nil {
+		return nil, fmt.Errorf("primary: %w", err)
+	}
+
+	s, err := shadowReply(secondary)
+	if err != nil {
+		return nil, fmt.Errorf("secondary: %w", err)
+	}
+
+	var diff []string
+	for _, field := range shadowFields {
+		pv, sv := shadowValue(p, field), shadowValue(s, field)
+		if pv != sv {
+			diff = append(diff, fmt.Sprintf("%s: %s != %s", field, pv, sv))
+		}
+	}
+
+	return diff, nil
+}
+
+// shadowReply returns the document of an OP_MSG reply.
+func shadowReply(body wire.MsgBody) (types.Document, error) {
+	msg, ok := body.(*wire.OpMsg)
+	if !ok {
+		return types.Document{}, errors.New("reply is not an OP_MSG")
+	}
+
+	return msg.Document()
+}
+
+// shadowValue formats the value of a reply field, so that numbers of different types are equal.
+func shadowValue(doc types.Document, field string) string {
+	v, ok := doc.Map()[field]
+	if !ok {
+		return "<missing>"
+	}
+
+	switch v := v.(type) {
+	case int32:
+		return fmt.Sprint(float64(v))
+	case int64:
+		return fmt.Sprint(float64(v))
+	case bool:
+		// ok may be a boolean in some replies
+		if v {
+			return "1"
+		}
+		return "0"
+	default:
+		return fmt.Sprint(v)
+	}
+}
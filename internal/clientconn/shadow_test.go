@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	prometheustest "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// shadowMsg returns an OP_MSG with the given document.
+func shadowMsg(t *testing.T, pairs ...any) *wire.OpMsg {
+	t.Helper()
+
+	var msg wire.OpMsg
+	require.NoError(t, msg.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(pairs...)},
+	}))
+	return &msg
+}
+
+func TestShadower(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Ctx(t)
+	metrics := NewListenerMetrics()
+
+	// the secondary backend replies with n = 1 to every request
+	var commands []string
+	handle := func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+		doc, err := body.(*wire.OpMsg).Document()
+		require.NoError(t, err)
+		commands = append(commands, doc.Command())
+		return header, shadowMsg(t, "n", int32(1), "ok", float64(1)), nil
+	}
+
+	s := newShadower(ctx, handle, metrics, zaptest.NewLogger(t).Sugar())
+
+	header := &wire.MsgHeader{OpCode: wire.OP_MSG}
+	s.enqueue(header, shadowMsg(t, "insert", "test", "$db", "db"), shadowMsg(t, "n", int64(1), "ok", true))
+	s.enqueue(header, shadowMsg(t, "find", "test", "$db", "db"), shadowMsg(t, "ok", float64(1)))
+	s.enqueue(header, shadowMsg(t, "delete", "test", "$db", "db"), shadowMsg(t, "n", int32(2), "ok", float64(1)))
+	s.close()
+
+	assert.Equal(t, []string{"insert", "delete"}, commands)
+	assert.Equal(t, float64(1), prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("insert", "match")))
+	assert.Equal(t, float64(1), prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("delete", "diverged")))
+	assert.Equal(t, 2, prometheustest.CollectAndCount(metrics.ShadowedRequests))
+}
+
+func TestShadowDiff(t *testing.T) {
+	t.Parallel()
+
+	diff, err := shadowDiff(
+		shadowMsg(t, "n", int32(1), "nModified", int32(1), "ok", float64(1)),
+		shadowMsg(t, "n", int32(1), "ok", float64(0), "code", int32(11000)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ok: 1 != 0", "nModified: 1 != <missing>", "code: <missing> != 11000"}, diff)
+}
+
+func TestShadowerBackoff(t *testing.T) {
+	t.Parallel()
+
+	ctx := testutil.Ctx(t)
+	metrics := NewListenerMetrics()
+
+	// the secondary backend fails the first request, and replies with n = 1 to the following ones
+	var calls []time.Time
+	handle := func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+		calls = append(calls, time.Now())
+		if len(calls) == 1 {
+			return nil, nil, errors.New("connection reset by peer")
+		}
+		return header, shadowMsg(t, "n", int32(1), "ok", float64(1)), nil
+	}
+
+	s := newShadower(ctx, handle, metrics, zaptest.NewLogger(t).Sugar())
+
+	header := &wire.MsgHeader{OpCode: wire.OP_MSG}
+	s.enqueue(header, shadowMsg(t, "insert", "test", "$db", "db"), shadowMsg(t, "n", int32(1), "ok", float64(1)))
+	s.enqueue(header, shadowMsg(t, "delete", "test", "$db", "db"), shadowMsg(t, "n", int32(1), "ok", float64(1)))
+	s.enqueue(header, shadowMsg(t, "update", "test", "$db", "db"), shadowMsg(t, "n", int32(1), "ok", float64(1)))
+
+	// shadowing resumes after the backoff
+	require.Eventually(t, func() bool {
+		return prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("update", "match")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	s.close()
+
+	require.Len(t, calls, 3)
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), shadowMinBackoff)
+	assert.Less(t, calls[2].Sub(calls[1]), shadowMinBackoff)
+	assert.Equal(t, float64(1), prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("insert", "failed")))
+	assert.Equal(t, float64(1), prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("delete", "match")))
+
+	// closing does not wait for the backoff
+	failing := func(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+		return nil, nil, errors.New("connection refused")
+	}
+	s = newShadower(ctx, failing, metrics, zaptest.NewLogger(t).Sugar())
+	s.enqueue(header, shadowMsg(t, "drop", "test", "$db", "db"), shadowMsg(t, "ok", float64(1)))
+	s.enqueue(header, shadowMsg(t, "drop", "test", "$db", "db"), shadowMsg(t, "ok", float64(1)))
+	s.close()
+	assert.Equal(t, float64(2), prometheustest.ToFloat64(metrics.ShadowedRequests.WithLabelValues("drop", "failed")))
+}
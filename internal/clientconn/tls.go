@@ -5,23 +5,99 @@
 package clientconn
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"time"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 )
 
-func generateX509Cert(certFilePath string, keyFilePath string) (*tls.Config, error) {
-	if certFilePath == "" {
+// loadTLSConfig returns the TLS configuration of the listener with the certificate and the private key of the PEM files.
+// If the CA file is given, the certificates of clients which send one are verified against its CA certificates,
+// and if requireClientCert is set, clients must send one.
+//
+// It fails for a certificate which is not valid now, so that a misconfigured listener does not start.
+func loadTLSConfig(certFile, keyFile, caFile string, requireClientCert bool) (*tls.Config, error) {
+	if certFile == "" {
 		return nil, lazyerrors.Errorf("No path was given for the certificate file for TLS")
-	} else if keyFilePath == "" {
+	} else if keyFile == "" {
 		return nil, lazyerrors.Errorf("No path was given for the key file for TLS")
 	}
 
-	cert, err := tls.LoadX509KeyPair(certFilePath, keyFilePath)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
 		return nil, lazyerrors.Errorf("Following error occured when loading the x509 key and cert files: %w", err)
 	}
-	config := &tls.Config{Certificates: []tls.Certificate{cert}}
 
-	return config, err
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return nil, lazyerrors.Errorf(
+			"TLS certificate %s is only valid from %s to %s", certFile,
+			leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339),
+		)
+	}
+	cert.Leaf = leaf
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if requireClientCert && caFile == "" {
+		return nil, lazyerrors.Errorf("Client certificates can't be verified without a CA file for TLS")
+	}
+
+	if caFile != "" {
+		b, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, lazyerrors.Errorf("TLS CA file %s contains no PEM certificates", caFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, nil
+}
+
+// tlsHandshakeTimeout is the time in which clients must complete the TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// clientIdentity completes the TLS handshake of the connection and returns the subject of the verified client certificate
+// as distinguished name of RFC 2253, like "CN=app,OU=dev,O=example", which is the user name of MONGODB-X509,
+// and the issuer of the certificate, like "CN=rootCA,O=example".
+// They are empty for connections without TLS or without a client certificate.
+func clientIdentity(netConn net.Conn) (subject, issuer string, err error) {
+	tlsConn, ok := netConn.(*tls.Conn)
+	if !ok {
+		return "", "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		return "", "", lazyerrors.Error(err)
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", "", nil
+	}
+
+	return certs[0].Subject.String(), certs[0].Issuer.String(), nil
 }
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package clientconn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCert is a certificate with its private key, written to PEM files.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert returns a certificate valid in the given period, signed by the parent or self-signed if it is nil.
+func newTestCert(t *testing.T, name string, notBefore, notAfter time.Time, parent *testCert) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	res := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".pem"),
+		keyFile:  filepath.Join(dir, name+"-key.pem"),
+	}
+	require.NoError(t, os.WriteFile(res.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(res.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return res
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ca := newTestCert(t, "ca", now.Add(-time.Hour), now.Add(time.Hour), nil)
+	server := newTestCert(t, "server", now.Add(-time.Hour), now.Add(time.Hour), ca)
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+
+		config, err := loadTLSConfig(server.certFile, server.keyFile, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+		assert.Equal(t, "server", config.Certificates[0].Leaf.Subject.CommonName)
+	})
+
+	t.Run("CA", func(t *testing.T) {
+		t.Parallel()
+
+		config, err := loadTLSConfig(server.certFile, server.keyFile, ca.certFile, false)
+		require.NoError(t, err)
+		assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+
+		client := newTestCert(t, "client", now.Add(-time.Hour), now.Add(time.Hour), ca)
+		_, err = client.cert.Verify(x509.VerifyOptions{
+			Roots:     config.ClientCAs,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		t.Parallel()
+
+		expired := newTestCert(t, "expired", now.Add(-2*time.Hour), now.Add(-time.Hour), ca)
+		_, err := loadTLSConfig(expired.certFile, expired.keyFile, "", false)
+		assert.ErrorContains(t, err, "is only valid from")
+	})
+
+	t.Run("KeyMismatch", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loadTLSConfig(server.certFile, ca.keyFile, "", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("InvalidCA", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := loadTLSConfig(server.certFile, server.keyFile, server.keyFile, false)
+		assert.ErrorContains(t, err, "contains no PEM certificates")
+
+		_, err = loadTLSConfig(server.certFile, server.keyFile, filepath.Join(t.TempDir(), "missing.pem"), false)
+		assert.Error(t, err)
+	})
+}
+
+func TestClientIdentity(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	ca := newTestCert(t, "ca", now.Add(-time.Hour), now.Add(time.Hour), nil)
+	server := newTestCert(t, "server", now.Add(-time.Hour), now.Add(time.Hour), ca)
+	client := newTestCert(t, "client", now.Add(-time.Hour), now.Add(time.Hour), ca)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	// handshake returns the identity and issuer of a client connecting with the certificates
+	handshake := func(t *testing.T, requireClientCert bool, certs ...tls.Certificate) (string, string, error) {
+		t.Helper()
+
+		config, err := loadTLSConfig(server.certFile, server.keyFile, ca.certFile, requireClientCert)
+		require.NoError(t, err)
+
+		// TCP instead of net.Pipe buffers the alert of the server while the client still writes
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer lis.Close()
+
+		c, err := net.Dial("tcp", lis.Addr().String())
+		require.NoError(t, err)
+		defer c.Close()
+
+		s, err := lis.Accept()
+		require.NoError(t, err)
+		defer s.Close()
+
+		go func() {
+			// the certificate is sent even if the server does not accept its CA
+			tlsClient := tls.Client(c, &tls.Config{
+				RootCAs:    roots,
+				ServerName: "localhost",
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					if len(certs) == 0 {
+						return new(tls.Certificate), nil
+					}
+					return &certs[0], nil
+				},
+			})
+
+			// the client reads everything the server writes, like the alert of a failed handshake
+			_ = tlsClient.Handshake()
+			_, _ = io.Copy(io.Discard, c)
+		}()
+
+		return clientIdentity(tls.Server(s, config))
+	}
+
+	cert, err := tls.LoadX509KeyPair(client.certFile, client.keyFile)
+	require.NoError(t, err)
+
+	identity, issuer, err := handshake(t, true, cert)
+	require.NoError(t, err)
+	assert.Equal(t, "CN=client", identity)
+	assert.Equal(t, "CN=ca", issuer)
+
+	identity, issuer, err = handshake(t, false)
+	require.NoError(t, err)
+	assert.Empty(t, identity)
+	assert.Empty(t, issuer)
+
+	_, _, err = handshake(t, true)
+	assert.Error(t, err)
+
+	// the certificate of another CA is rejected
+	other := newTestCert(t, "other", now.Add(-time.Hour), now.Add(time.Hour), nil)
+	cert, err = tls.LoadX509KeyPair(other.certFile, other.keyFile)
+	require.NoError(t, err)
+	_, _, err = handshake(t, false, cert)
+	assert.Error(t, err)
+
+	identity, _, err = clientIdentity(nil)
+	require.NoError(t, err)
+	assert.Empty(t, identity)
+}
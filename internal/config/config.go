@@ -0,0 +1,393 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package config provides the configuration of the SAP HANA compatibility layer for MongoDB Wire Protocol.
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/clientconn"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+)
+
+// Config is the configuration of the SAP HANA compatibility layer for MongoDB Wire Protocol,
+// set by command-line flags or by programs which run it.
+type Config struct {
+	// ListenAddrs are TCP addresses like "127.0.0.1:27017"
+	// and Unix domain sockets like "unix:/tmp/mongodb-27017.sock"
+	ListenAddrs []string
+	DebugAddr   string
+	Mode        clientconn.Mode
+	ProxyAddr   string
+
+	MaxConnections int
+	ProxyProtocol  bool
+
+	// ProxyProtocolTrusted are the IP addresses and CIDR networks of the load balancers sending the PROXY header, all if empty
+	ProxyProtocolTrusted []string
+
+	DiffReportFile string
+
+	// TLS is enabled if the certificate file is given
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSCAFile   string
+
+	TLSRequireClientCert bool
+
+	Auth bool
+
+	HANAConnectString string
+
+	// the SAP HANA connections authenticate with a JWT token instead of a user and password,
+	// read from the token file or requested from the OAuth token URL
+	HANATokenFile             string
+	HANAOAuthTokenURL         string
+	HANAOAuthClientID         string
+	HANAOAuthClientSecretFile string
+
+	// clients authenticate with PLAIN, and their SAP HANA connections are opened with their user and password
+	HANAPassthrough bool
+
+	// the TLS certificate of SAP HANA is verified by the CA file, its hostname and the pinned public keys
+	// instead of the TLS parameters of the connect string
+	HANATLSCAFile         string
+	HANATLSVerifyHostname bool
+	HANATLSPinnedSHA256   []string
+
+	// the pool of SAP HANA connections is sized and reused by these instead of the defaults of database/sql
+	HANAMaxOpenConns    int
+	HANAMaxIdleConns    int
+	HANAConnMaxLifetime time.Duration
+	HANAAcquireTimeout  time.Duration
+
+	// the options of collections are cached for that time, so that writes do not read them every time
+	HANAOptionsCacheTTL time.Duration
+
+	QuotasFile           string
+	QuotasReloadInterval time.Duration
+
+	MappingsFile           string
+	MappingsReloadInterval time.Duration
+
+	ReadOnly bool
+
+	Sandbox             bool
+	SandboxMaxTime      time.Duration
+	SandboxMaxDocuments int
+
+	CoalescePointReads   bool
+	CursorReadAheadBytes int64
+
+	AllowDottedDollarKeys bool
+
+	TestConnTimeout time.Duration
+
+	SupportBundleFile    string
+	SupportBundleCommand bool
+
+	SlowCommandThreshold time.Duration
+
+	RecordDir string
+
+	CaptureFile string
+
+	// documents, filters and the messages of errors are logged instead of their shapes and codes, only for development
+	LogUnredacted bool
+}
+
+// Default returns the default configuration.
+func Default() Config {
+	return Config{
+		ListenAddrs:            []string{"127.0.0.1:27017"},
+		DebugAddr:              "127.0.0.1:8088",
+		Mode:                   clientconn.AllModes[0],
+		ProxyAddr:              "127.0.0.1:37017",
+		QuotasReloadInterval:   10 * time.Second,
+		MappingsReloadInterval: 10 * time.Second,
+		SandboxMaxTime:         30 * time.Second,
+		SandboxMaxDocuments:    1000,
+		CursorReadAheadBytes:   256 << 20,
+		SlowCommandThreshold:   100 * time.Millisecond,
+
+		HANATLSVerifyHostname: true,
+
+		HANAMaxIdleConns:    2,
+		HANAOptionsCacheTTL: 5 * time.Second,
+	}
+}
+
+// AddFlags defines the command-line flags setting the configuration, with its current values as defaults.
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.DebugAddr, "debug-addr", c.DebugAddr, "debug address")
+	// the first given listen address replaces the default ones, and the next ones are added
+	var listenAddrsSet bool
+	fs.Func("listen-addr", fmt.Sprintf("listen address, may be repeated, %s<path> for a Unix domain socket (default %q)", clientconn.UnixPrefix, c.ListenAddrs), func(s string) error {
+		if !listenAddrsSet {
+			c.ListenAddrs = nil
+			listenAddrsSet = true
+		}
+		c.ListenAddrs = append(c.ListenAddrs, s)
+		return nil
+	})
+	fs.Func("mode", fmt.Sprintf("operation mode: %v (default %q)", clientconn.AllModes, c.Mode), func(s string) error {
+		c.Mode = clientconn.Mode(s)
+		return nil
+	})
+	fs.StringVar(&c.ProxyAddr, "proxy-addr", c.ProxyAddr, "")
+	fs.StringVar(&c.DiffReportFile, "diff-report-file", c.DiffReportFile, "append JSON reports of the differences of the replies of both backends in the diff modes to the file")
+	fs.BoolVar(&c.ProxyProtocol, "proxy-protocol", c.ProxyProtocol, "require the PROXY protocol v1 or v2 header of load balancers like HAProxy with the client address on all connections")
+	fs.Func("proxy-protocol-trusted", "IP address or CIDR network of a load balancer which may send the PROXY protocol header, may be repeated; connections from other addresses are closed", func(s string) error {
+		c.ProxyProtocolTrusted = append(c.ProxyProtocolTrusted, s)
+		return nil
+	})
+	fs.IntVar(&c.MaxConnections, "max-connections", c.MaxConnections, "maximum number of open client connections, further ones are refused with an error, 0 for unlimited")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "path to the PEM file of the TLS certificate, which enables TLS")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "path to the PEM file of the private key of the TLS certificate")
+	fs.StringVar(&c.TLSCAFile, "tls-ca-file", c.TLSCAFile, "path to the PEM file of the CA certificates verifying the certificates of clients")
+	fs.BoolVar(&c.TLSRequireClientCert, "tls-require-client-cert", c.TLSRequireClientCert, "require clients to send a certificate verified by the CA file, whose subject is their MONGODB-X509 user")
+	fs.BoolVar(&c.Auth, "auth", c.Auth, "require clients to authenticate with MONGODB-X509 before all commands but the handshake, like mongod --auth")
+	fs.StringVar(&c.TLSCertFile, "certFile", c.TLSCertFile, "deprecated: use -tls-cert-file")
+	fs.StringVar(&c.TLSKeyFile, "keyFile", c.TLSKeyFile, "deprecated: use -tls-key-file")
+	fs.Bool("tls", false, "deprecated and ignored: TLS is enabled by -tls-cert-file")
+	fs.DurationVar(&c.TestConnTimeout, "test-conn-timeout", c.TestConnTimeout, "test: set connection timeout")
+	fs.StringVar(&c.HANAConnectString, "HANAConnectString", c.HANAConnectString, "SAP HANA Cloud instance connect string")
+	fs.StringVar(&c.HANATokenFile, "hana-token-file", c.HANATokenFile, "path to a file with a JWT token authenticating the SAP HANA connections instead of the user and password of the connect string, read again when it expires")
+	fs.StringVar(&c.HANAOAuthTokenURL, "hana-oauth-token-url", c.HANAOAuthTokenURL, "OAuth 2.0 token endpoint issuing the JWT tokens authenticating the SAP HANA connections with the client credentials grant")
+	fs.StringVar(&c.HANAOAuthClientID, "hana-oauth-client-id", c.HANAOAuthClientID, "OAuth 2.0 client ID of the token endpoint")
+	fs.StringVar(&c.HANAOAuthClientSecretFile, "hana-oauth-client-secret-file", c.HANAOAuthClientSecretFile, "path to a file with the OAuth 2.0 client secret of the token endpoint")
+	fs.BoolVar(&c.HANAPassthrough, "hana-passthrough", c.HANAPassthrough, "authenticate clients with PLAIN and open their SAP HANA connections with their user and password instead of the ones of the connect string")
+	fs.StringVar(&c.HANATLSCAFile, "hana-tls-ca-file", c.HANATLSCAFile, "path to the PEM file of the CA certificates verifying the TLS certificate of SAP HANA instead of the ones of the system")
+	fs.BoolVar(&c.HANATLSVerifyHostname, "hana-tls-verify-hostname", c.HANATLSVerifyHostname, "verify that the TLS certificate of SAP HANA is valid for the host of the connect string")
+	fs.Func("hana-tls-pin-sha256", "base64 SHA-256 hash of a public key which the TLS certificate chain of SAP HANA must contain, may be repeated", func(s string) error {
+		c.HANATLSPinnedSHA256 = append(c.HANATLSPinnedSHA256, s)
+		return nil
+	})
+	fs.IntVar(&c.HANAMaxOpenConns, "hana-max-open-conns", c.HANAMaxOpenConns, "maximum number of open SAP HANA connections, further queries wait for one to be returned to the pool, 0 for unlimited")
+	fs.IntVar(&c.HANAMaxIdleConns, "hana-max-idle-conns", c.HANAMaxIdleConns, "maximum number of idle SAP HANA connections kept open for further queries, reduced to the maximum open connections")
+	fs.DurationVar(&c.HANAConnMaxLifetime, "hana-conn-max-lifetime", c.HANAConnMaxLifetime, "maximum time a SAP HANA connection is reused before it is reopened, 0 for unlimited")
+	fs.DurationVar(&c.HANAAcquireTimeout, "hana-acquire-timeout", c.HANAAcquireTimeout, "maximum time to take a SAP HANA connection from the pool, including opening and authenticating a new one, 0 for unlimited")
+	fs.DurationVar(&c.HANAOptionsCacheTTL, "hana-options-cache-ttl", c.HANAOptionsCacheTTL, "time the options of collections set with collMod are cached, 0 to read them for every command")
+	fs.StringVar(&c.QuotasFile, "quotas-file", c.QuotasFile, "path to a JSON file with result limits per SAP HANA role")
+	fs.DurationVar(&c.QuotasReloadInterval, "quotas-reload-interval", c.QuotasReloadInterval, "how often the quotas file is checked for changes, 0 to disable")
+	fs.StringVar(&c.MappingsFile, "mappings-file", c.MappingsFile, "path to a JSON file with virtual collections and row-level security filters per SAP HANA role")
+	fs.DurationVar(&c.MappingsReloadInterval, "mappings-reload-interval", c.MappingsReloadInterval, "how often the mappings file is checked for changes, 0 to disable")
+	fs.BoolVar(&c.ReadOnly, "read-only", c.ReadOnly, "reject inserts, updates, deletes and changes of collections, databases and indexes with NotWritablePrimary, while allowing all reads")
+	fs.BoolVar(&c.Sandbox, "sandbox", c.Sandbox, "only allow read commands with a time and document limit, for untrusted ad-hoc access")
+	fs.DurationVar(&c.SandboxMaxTime, "sandbox-max-time", c.SandboxMaxTime, "sandbox: maximum duration of a command")
+	fs.IntVar(&c.SandboxMaxDocuments, "sandbox-max-documents", c.SandboxMaxDocuments, "sandbox: maximum number of documents returned by find and aggregate")
+	fs.BoolVar(&c.CoalescePointReads, "coalesce-point-reads", c.CoalescePointReads, "run identical concurrent finds by _id as one SAP HANA query")
+	fs.Int64Var(&c.CursorReadAheadBytes, "cursor-read-ahead-bytes", c.CursorReadAheadBytes, "maximum size of the documents read ahead of getMore by all cursors, 0 to disable")
+	fs.BoolVar(&c.AllowDottedDollarKeys, "allow-dotted-dollar-keys", c.AllowDottedDollarKeys, "allow keys containing '.' or starting with '$' in inserted and updated documents, like MongoDB 5.0")
+	fs.DurationVar(&c.SlowCommandThreshold, "slow-command-threshold", c.SlowCommandThreshold, "log commands taking at least this long with their comment, 0 to disable")
+	fs.StringVar(&c.RecordDir, "record-dir", c.RecordDir, "development only, requires -log-unredacted: record the unredacted requests and replies of all connections to files of the directory, to be replayed with replaytool")
+	fs.StringVar(&c.CaptureFile, "capture-file", c.CaptureFile, "append the sanitized commands of all connections with their SAP HANA statements and replies to the file, for compatibility analysis")
+	fs.BoolVar(&c.LogUnredacted, "log-unredacted", c.LogUnredacted, "development only: log documents, filters and the messages of errors instead of their shapes and codes")
+	fs.StringVar(&c.SupportBundleFile, "collect-support-bundle", c.SupportBundleFile, "write a support bundle for SAP support to the zip file and exit")
+	fs.BoolVar(&c.SupportBundleCommand, "enable-support-bundle-command", c.SupportBundleCommand, "allow clients to collect support bundles with logs and profiles by the collectSupportBundle command")
+}
+
+// Sanitized returns a copy of the configuration without secrets, like the password of the SAP HANA connect string,
+// to be included in support bundles.
+func (c Config) Sanitized() Config {
+	c.HANAConnectString = hana.RedactConnectString(c.HANAConnectString)
+
+	return c
+}
+
+// ValidationError lists all problems of an invalid configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// HANATLS returns true if the TLS certificate of SAP HANA is verified by the TLS flags
+// instead of the TLS parameters of the connect string.
+func (c *Config) HANATLS() bool {
+	return c.HANATLSCAFile != "" || !c.HANATLSVerifyHostname || len(c.HANATLSPinnedSHA256) > 0
+}
+
+// Validate returns a *ValidationError with all problems of the configuration, or nil if it is valid.
+// More idle SAP HANA connections than open ones are reduced to the open ones, like database/sql does.
+func (c *Config) Validate() error {
+	var problems []string
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.ListenAddrs) == 0 {
+		addf("listen address is required")
+	}
+	seen := make(map[string]struct{}, len(c.ListenAddrs))
+	for _, addr := range c.ListenAddrs {
+		if _, ok := seen[addr]; ok {
+			addf("listen address %q is given more than once", addr)
+		}
+		seen[addr] = struct{}{}
+
+		if addr == "" || addr == clientconn.UnixPrefix {
+			addf("listen address %q is empty", addr)
+		}
+	}
+
+	var knownMode bool
+	for _, m := range clientconn.AllModes {
+		if c.Mode == m {
+			knownMode = true
+			break
+		}
+	}
+	switch {
+	case !knownMode:
+		addf("unknown mode %q, expected one of %v", c.Mode, clientconn.AllModes)
+	case c.Mode != clientconn.NormalMode && c.ProxyAddr == "":
+		addf("mode %q requires a proxy address (-proxy-addr)", c.Mode)
+	}
+	if c.DiffReportFile != "" && c.Mode != clientconn.DiffNormalMode && c.Mode != clientconn.DiffProxyMode {
+		addf("diff report file requires mode %q or %q", clientconn.DiffNormalMode, clientconn.DiffProxyMode)
+	}
+	if c.RecordDir != "" && !c.LogUnredacted {
+		addf("recording requires -log-unredacted, as the recordings contain the documents and passwords of the clients unredacted")
+	}
+
+	switch {
+	case c.TLSCertFile != "" && c.TLSKeyFile == "":
+		addf("TLS requires a key file (-tls-key-file)")
+	case c.TLSCertFile == "" && c.TLSKeyFile != "":
+		addf("TLS requires a certificate file (-tls-cert-file)")
+	case c.TLSCertFile == "" && c.TLSCAFile != "":
+		addf("TLS CA file requires a certificate file (-tls-cert-file)")
+	}
+	if c.TLSRequireClientCert && c.TLSCAFile == "" {
+		addf("TLS client certificates require a CA file (-tls-ca-file)")
+	}
+	if c.Auth && c.TLSCAFile == "" {
+		addf("authentication requires TLS client certificates verified by a CA file (-tls-ca-file)")
+	}
+
+	if len(c.ProxyProtocolTrusted) > 0 {
+		if !c.ProxyProtocol {
+			addf("trusted proxies require the PROXY protocol (-proxy-protocol)")
+		}
+		if _, err := clientconn.ParseTrustedProxies(c.ProxyProtocolTrusted); err != nil {
+			addf("%s", err)
+		}
+	}
+
+	if c.MaxConnections < 0 {
+		addf("maximum connections must not be negative, got %d", c.MaxConnections)
+	}
+
+	if c.HANAConnectString == "" {
+		addf("SAP HANA connect string is required (-HANAConnectString)")
+	}
+	if c.HANATokenFile != "" || c.HANAOAuthTokenURL != "" {
+		if u, err := url.Parse(c.HANAConnectString); err == nil && u.User != nil {
+			addf("SAP HANA token authentication requires a connect string without user and password")
+		}
+	}
+	if c.HANATokenFile != "" && c.HANAOAuthTokenURL != "" {
+		addf("SAP HANA token file and OAuth token URL are mutually exclusive")
+	}
+	if c.HANAOAuthTokenURL != "" && (c.HANAOAuthClientID == "" || c.HANAOAuthClientSecretFile == "") {
+		addf("SAP HANA OAuth token URL requires a client ID (-hana-oauth-client-id) and a client secret file (-hana-oauth-client-secret-file)")
+	}
+	if c.HANAOAuthTokenURL == "" && (c.HANAOAuthClientID != "" || c.HANAOAuthClientSecretFile != "") {
+		addf("SAP HANA OAuth client requires a token URL (-hana-oauth-token-url)")
+	}
+	if c.HANAPassthrough {
+		if c.TLSCertFile == "" {
+			addf("SAP HANA credential passthrough requires TLS (-tls-cert-file), as passwords are sent in plain text")
+		}
+		if c.Auth {
+			addf("SAP HANA credential passthrough and -auth are mutually exclusive")
+		}
+		if c.HANATokenFile != "" || c.HANAOAuthTokenURL != "" {
+			addf("SAP HANA credential passthrough and token authentication are mutually exclusive")
+		}
+	}
+
+	if c.HANATLS() {
+		if u, err := url.Parse(c.HANAConnectString); err == nil {
+			for _, param := range []string{"TLSRootCAFile", "TLSServerName", "TLSInsecureSkipVerify"} {
+				if u.Query().Has(param) {
+					addf("SAP HANA TLS flags and the %s parameter of the connect string are mutually exclusive", param)
+				}
+			}
+		}
+	}
+	for _, pin := range c.HANATLSPinnedSHA256 {
+		if b, err := base64.StdEncoding.DecodeString(pin); err != nil || len(b) != sha256.Size {
+			addf("SAP HANA TLS pin %q is not a base64 SHA-256 hash", pin)
+		}
+	}
+
+	if c.HANAMaxOpenConns < 0 {
+		addf("SAP HANA maximum open connections must not be negative, got %d", c.HANAMaxOpenConns)
+	}
+	if c.HANAMaxIdleConns < 0 {
+		addf("SAP HANA maximum idle connections must not be negative, got %d", c.HANAMaxIdleConns)
+	}
+	if c.HANAMaxOpenConns > 0 && c.HANAMaxIdleConns > c.HANAMaxOpenConns {
+		c.HANAMaxIdleConns = c.HANAMaxOpenConns
+	}
+	if c.HANAConnMaxLifetime < 0 {
+		addf("SAP HANA connection maximum lifetime must not be negative, got %s", c.HANAConnMaxLifetime)
+	}
+	if c.HANAAcquireTimeout < 0 {
+		addf("SAP HANA acquire timeout must not be negative, got %s", c.HANAAcquireTimeout)
+	}
+	if c.HANAOptionsCacheTTL < 0 {
+		addf("SAP HANA options cache TTL must not be negative, got %s", c.HANAOptionsCacheTTL)
+	}
+
+	if c.SlowCommandThreshold < 0 {
+		addf("slow command threshold must not be negative, got %s", c.SlowCommandThreshold)
+	}
+
+	if c.QuotasFile != "" && !c.Auth && !c.HANAPassthrough {
+		addf("quotas require -auth or -hana-passthrough, as otherwise all clients share the roles of the user of the connect string")
+	}
+	if c.QuotasReloadInterval < 0 {
+		addf("quotas reload interval must not be negative, got %s", c.QuotasReloadInterval)
+	}
+
+	if c.MappingsReloadInterval < 0 {
+		addf("mappings reload interval must not be negative, got %s", c.MappingsReloadInterval)
+	}
+
+	if c.Sandbox {
+		if c.SandboxMaxTime <= 0 {
+			addf("sandbox maximum time must be positive, got %s", c.SandboxMaxTime)
+		}
+		if c.SandboxMaxDocuments <= 0 {
+			addf("sandbox maximum documents must be positive, got %d", c.SandboxMaxDocuments)
+		}
+	}
+
+	if c.CursorReadAheadBytes < 0 {
+		addf("cursor read ahead bytes must not be negative, got %d", c.CursorReadAheadBytes)
+	}
+
+	if c.TestConnTimeout < 0 {
+		addf("test connection timeout must not be negative, got %s", c.TestConnTimeout)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// MarshalCanonical encodes given value into MongoDB Canonical Extended JSON v2,
+// like {"n": {"$numberLong": "42"}, "d": {"$date": {"$numberLong": "1659312000000"}}}.
+// Unlike Marshal and MarshalHANA, it keeps the type of every value, so other tools like mongoimport can read it.
+func MarshalCanonical(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeCanonical writes the Canonical Extended JSON of the value.
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case types.Document:
+		buf.WriteByte('{')
+		for i, key := range v.Keys() {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+
+			value, err := v.Get(key)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+			if err = writeCanonical(buf, value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+
+	case *types.Array:
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i != 0 {
+				buf.WriteByte(',')
+			}
+
+			value, err := v.Get(i)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+			if err = writeCanonical(buf, value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+
+	case float64:
+		buf.WriteString(`{"$numberDouble":"` + canonicalDouble(v) + `"}`)
+	case string:
+		writeCanonicalString(buf, v)
+	case types.CString:
+		writeCanonicalString(buf, string(v))
+	case types.Binary:
+		buf.WriteString(`{"$binary":{"base64":"` + base64.StdEncoding.EncodeToString(v.B) + `","subType":"`)
+		buf.WriteString(hex.EncodeToString([]byte{byte(v.Subtype)}) + `"}}`)
+	case types.ObjectID:
+		buf.WriteString(`{"$oid":"` + hex.EncodeToString(v[:]) + `"}`)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case time.Time:
+		buf.WriteString(`{"$date":{"$numberLong":"` + strconv.FormatInt(v.UnixMilli(), 10) + `"}}`)
+	case nil:
+		buf.WriteString("null")
+	case types.Regex:
+		// options are sorted alphabetically
+		options := strings.Split(v.Options, "")
+		sort.Strings(options)
+
+		buf.WriteString(`{"$regularExpression":{"pattern":`)
+		writeCanonicalString(buf, v.Pattern)
+		buf.WriteString(`,"options":`)
+		writeCanonicalString(buf, strings.Join(options, ""))
+		buf.WriteString(`}}`)
+	case int32:
+		buf.WriteString(`{"$numberInt":"` + strconv.FormatInt(int64(v), 10) + `"}`)
+	case types.Timestamp:
+		buf.WriteString(`{"$timestamp":{"t":` + strconv.FormatUint(uint64(v)>>32, 10) + `,"i":` + strconv.FormatUint(uint64(v)&math.MaxUint32, 10) + `}}`)
+	case int64:
+		buf.WriteString(`{"$numberLong":"` + strconv.FormatInt(v, 10) + `"}`)
+	case types.Code:
+		buf.WriteString(`{"$code":`)
+		writeCanonicalString(buf, string(v))
+		buf.WriteByte('}')
+	case types.CodeWithScope:
+		buf.WriteString(`{"$code":`)
+		writeCanonicalString(buf, v.Code)
+		buf.WriteString(`,"$scope":`)
+		if err := writeCanonical(buf, v.Scope); err != nil {
+			return err
+		}
+		buf.WriteByte('}')
+	default:
+		return lazyerrors.Errorf("%T is not supported by Canonical Extended JSON", v)
+	}
+
+	return nil
+}
+
+// writeCanonicalString writes the JSON string without escaping HTML characters like the MongoDB tools.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	// strings are always valid JSON
+	_ = enc.Encode(s)
+
+	// remove the newline of Encode
+	buf.Truncate(buf.Len() - 1)
+}
+
+// canonicalDouble returns the string of $numberDouble, which always has a decimal point or an exponent.
+func canonicalDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	s := strconv.FormatFloat(f, 'G', -1, 64)
+	if !strings.ContainsAny(s, ".E") {
+		s += ".0"
+	}
+
+	return s
+}
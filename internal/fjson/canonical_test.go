@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types/driverbson"
+)
+
+func TestMarshalCanonical(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
+		"double", types.MustNewArray(42.0, 0.1, -1.5e300, math.Inf(1), math.Inf(-1), math.NaN()),
+		"string", "<foo> \"bar\"",
+		"binary", types.Binary{Subtype: types.BinaryUser, B: []byte("foo")},
+		"bool", true,
+		"datetime", time.Date(2022, 8, 1, 0, 0, 0, 123000000, time.UTC),
+		"null", nil,
+		"regex", types.Regex{Pattern: "^a.*", Options: "xi"},
+		"int32", int32(42),
+		"timestamp", types.Timestamp(1<<32|7),
+		"int64", int64(math.MaxInt64),
+		"code", types.Code("function() { return 1; }"),
+		"codeWithScope", types.CodeWithScope{Code: "function() { return x; }", Scope: types.MustMakeDocument("x", int32(1))},
+		"document", types.MustMakeDocument("array", types.MustNewArray()),
+	)
+
+	actual, err := MarshalCanonical(doc)
+	require.NoError(t, err)
+
+	expected := `{"_id":{"$oid":"62e2bd54510683f9c0bb0d6b"},` +
+		`"double":[{"$numberDouble":"42.0"},{"$numberDouble":"0.1"},{"$numberDouble":"-1.5E+300"},` +
+		`{"$numberDouble":"Infinity"},{"$numberDouble":"-Infinity"},{"$numberDouble":"NaN"}],` +
+		`"string":"<foo> \"bar\"",` +
+		`"binary":{"$binary":{"base64":"Zm9v","subType":"80"}},` +
+		`"bool":true,` +
+		`"datetime":{"$date":{"$numberLong":"1659312000123"}},` +
+		`"null":null,` +
+		`"regex":{"$regularExpression":{"pattern":"^a.*","options":"ix"}},` +
+		`"int32":{"$numberInt":"42"},` +
+		`"timestamp":{"$timestamp":{"t":1,"i":7}},` +
+		`"int64":{"$numberLong":"9223372036854775807"},` +
+		`"code":{"$code":"function() { return 1; }"},` +
+		`"codeWithScope":{"$code":"function() { return x; }","$scope":{"x":{"$numberInt":"1"}}},` +
+		`"document":{"array":[]}}`
+	assert.Equal(t, expected, string(actual))
+
+	t.Run("Driver", func(t *testing.T) {
+		t.Parallel()
+
+		// the MongoDB Go driver reads the same values
+		var d bson.D
+		require.NoError(t, bson.UnmarshalExtJSON(actual, true, &d))
+
+		roundTrip, err := driverbson.ToDocument(d)
+		require.NoError(t, err)
+
+		b, err := MarshalCanonical(roundTrip)
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(b))
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := MarshalCanonical(uint8(1))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,137 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Code represents BSON JavaScript code data type.
+type Code types.Code
+
+// fjsontype implements fjsontype interface.
+func (code *Code) fjsontype() {}
+
+type codeJSON struct {
+	JS string `json:"$js"`
+}
+
+// UnmarshalJSON implements fjsontype interface.
+func (code *Code) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		panic("null data")
+	}
+
+	r := bytes.NewReader(data)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var o codeJSON
+	if err := dec.Decode(&o); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err := checkConsumed(dec, r); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	*code = Code(o.JS)
+	return nil
+}
+
+// MarshalJSON implements fjsontype interface.
+func (code *Code) MarshalJSON() ([]byte, error) {
+	res, err := json.Marshal(codeJSON{
+		JS: string(*code),
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	return res, nil
+}
+
+// CodeWithScope represents BSON JavaScript code with scope data type.
+type CodeWithScope types.CodeWithScope
+
+// fjsontype implements fjsontype interface.
+func (cws *CodeWithScope) fjsontype() {}
+
+type codeWithScopeJSON struct {
+	JS string          `json:"$js"`
+	S  json.RawMessage `json:"$s"`
+}
+
+// UnmarshalJSON implements fjsontype interface.
+func (cws *CodeWithScope) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		panic("null data")
+	}
+
+	r := bytes.NewReader(data)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var o codeWithScopeJSON
+	if err := dec.Decode(&o); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err := checkConsumed(dec, r); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	var scope Document
+	if err := scope.UnmarshalJSON(o.S); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	*cws = CodeWithScope{
+		Code:  o.JS,
+		Scope: types.Document(scope),
+	}
+	return nil
+}
+
+// MarshalJSON implements fjsontype interface.
+func (cws *CodeWithScope) MarshalJSON() ([]byte, error) {
+	scope, err := Marshal(cws.Scope)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	res, err := json.Marshal(codeWithScopeJSON{
+		JS: cws.Code,
+		S:  scope,
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	return res, nil
+}
+
+// MarshalJSONHANA returns the JSON of the code with scope to store it, with the scope as it is stored.
+func (cws *CodeWithScope) MarshalJSONHANA() ([]byte, error) {
+	scope, err := MarshalHANA(cws.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := json.Marshal(codeWithScopeJSON{
+		JS: cws.Code,
+		S:  scope,
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	return res, nil
+}
+
+// check interfaces
+var (
+	_ fjsontype = (*Code)(nil)
+	_ fjsontype = (*CodeWithScope)(nil)
+)
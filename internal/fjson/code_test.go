@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"testing"
+
+	"github.com/AlekSi/pointer"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+var codeTestCases = []testCase{{
+	name: "normal",
+	v:    pointer.To(Code("function() { return 1; }")),
+	j:    `{"$js":"function() { return 1; }"}`,
+}, {
+	name: "EOF",
+	j:    `{`,
+	jErr: `unexpected EOF`,
+}}
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+	testJSON(t, codeTestCases, func() fjsontype { return new(Code) })
+}
+
+func FuzzCode(f *testing.F) {
+	fuzzJSON(f, codeTestCases, func() fjsontype { return new(Code) })
+}
+
+func BenchmarkCode(b *testing.B) {
+	benchmark(b, codeTestCases, func() fjsontype { return new(Code) })
+}
+
+var codeWithScopeTestCases = []testCase{{
+	name: "normal",
+	v:    pointer.To(CodeWithScope{Code: "function() { return x; }", Scope: types.MustMakeDocument("x", "foo")}),
+	j:    `{"$js":"function() { return x; }","$s":{"x":"foo"}}`,
+}, {
+	name: "EOF",
+	j:    `{`,
+	jErr: `unexpected EOF`,
+}}
+
+func TestCodeWithScope(t *testing.T) {
+	t.Parallel()
+	testJSON(t, codeWithScopeTestCases, func() fjsontype { return new(CodeWithScope) })
+}
+
+func FuzzCodeWithScope(f *testing.F) {
+	fuzzJSON(f, codeWithScopeTestCases, func() fjsontype { return new(CodeWithScope) })
+}
+
+func BenchmarkCodeWithScope(b *testing.B) {
+	benchmark(b, codeWithScopeTestCases, func() fjsontype { return new(CodeWithScope) })
+}
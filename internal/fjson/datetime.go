@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -37,7 +39,9 @@ func (dt *DateTime) String() string {
 	return time.Time(*dt).Format(time.RFC3339Nano)
 }
 
-// $da should be changed if ever datetime is supported for storing
+// dateTimeJSON is also the representation of dates stored in SAP HANA.
+// Like BSON DateTime, it has the precision of milliseconds since epoch, so finer parts of a time are truncated.
+// The milliseconds are sortable, so filters compare and sorts order dates by them.
 type dateTimeJSON struct {
 	D int64 `json:"$da"`
 }
@@ -60,8 +64,7 @@ func (dt *DateTime) UnmarshalJSON(data []byte) error {
 		return lazyerrors.Error(err)
 	}
 
-	// TODO Use .UTC()
-	*dt = DateTime(time.UnixMilli(o.D))
+	*dt = DateTime(time.UnixMilli(o.D).UTC())
 	return nil
 }
 
@@ -27,20 +27,24 @@ import (
 
 var dateTimeTestCases = []testCase{{
 	name: "2021",
-	v:    pointer.To(DateTime(time.Date(2021, 11, 1, 10, 18, 42, 123000000, time.UTC).Local())),
+	v:    pointer.To(DateTime(time.Date(2021, 11, 1, 10, 18, 42, 123000000, time.UTC))),
 	j:    `{"$da":1635761922123}`,
 }, {
 	name: "unix_zero",
-	v:    pointer.To(DateTime(time.Unix(0, 0))),
+	v:    pointer.To(DateTime(time.Unix(0, 0).UTC())),
 	j:    `{"$da":0}`,
 }, {
 	name: "0",
-	v:    pointer.To(DateTime(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).Local())),
+	v:    pointer.To(DateTime(time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC))),
 	j:    `{"$da":-62167219200000}`,
 }, {
 	name: "9999",
-	v:    pointer.To(DateTime(time.Date(9999, 12, 31, 23, 59, 59, 999000000, time.UTC).Local())),
+	v:    pointer.To(DateTime(time.Date(9999, 12, 31, 23, 59, 59, 999000000, time.UTC))),
 	j:    `{"$da":253402300799999}`,
+}, {
+	name: "before unix_zero",
+	v:    pointer.To(DateTime(time.Date(1969, 12, 31, 23, 59, 59, 999000000, time.UTC))),
+	j:    `{"$da":-1}`,
 }, {
 	name: "EOF",
 	j:    `{`,
@@ -23,9 +23,6 @@ package fjson
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
-	"io"
-	"log"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
@@ -43,11 +40,6 @@ func (doc *Document) UnmarshalJSON(data []byte) error {
 		panic("null data")
 	}
 
-	jsonKeys, err := getJSONKeys(data)
-	if err != nil {
-		return lazyerrors.Error(err)
-	}
-
 	r := bytes.NewReader(data)
 	dec := json.NewDecoder(r)
 
@@ -59,6 +51,11 @@ func (doc *Document) UnmarshalJSON(data []byte) error {
 		return lazyerrors.Error(err)
 	}
 
+	jsonKeys, err := getJSONKeys(data)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
 	td := types.MustMakeDocument()
 
 	for _, key := range jsonKeys {
@@ -82,65 +79,34 @@ func (doc *Document) UnmarshalJSON(data []byte) error {
 }
 
 // getJSONKeys returns a slice containing the fields of the JSON document. This enables order preservance.
-func getJSONKeys(docs []byte) (keys []string, error error) {
-	r := bytes.NewReader(docs)
-	dec := json.NewDecoder(r)
-	i := 0
-	isArray := 0
-	isDocument := 0
-	for {
-
-		t, err := dec.Token()
-		if err == io.EOF {
-			break
-		}
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		if i == 0 {
-			i++
-			continue
-		}
-
-		s := fmt.Sprintf("%v", t)
+// Values are skipped as a whole, so nested documents and arrays of any depth don't contribute keys.
+func getJSONKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
 
-		if s == "]" {
-			isArray--
-			continue
-		}
-
-		if s == "}" {
-			isDocument--
-			continue
-		}
-
-		if s == "[" {
-			i++
-			isArray++
-			continue
-		}
+	t, err := dec.Token()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if t != json.Delim('{') {
+		return nil, lazyerrors.Errorf("fjson.getJSONKeys: expected object, got %v", t)
+	}
 
-		if s == "{" {
-			i++
-			isDocument++
-			continue
+	var keys []string
+	for dec.More() {
+		if t, err = dec.Token(); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
 
-		// Continues when value
-		if i%2 == 0 {
-			i++
-			continue
+		key, ok := t.(string)
+		if !ok {
+			return nil, lazyerrors.Errorf("fjson.getJSONKeys: expected key, got %v", t)
 		}
+		keys = append(keys, key)
 
-		if isArray > 0 || isDocument > 0 {
-			continue
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
-
-		keys = append(keys, fmt.Sprintf("%v", t))
-
-		i++
 	}
 
 	return keys, nil
@@ -184,7 +184,7 @@ var (
 		v: convertDocument(types.MustMakeDocument(
 			"_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
 			"bool", types.MustNewArray(true, false),
-			"datetime", types.MustNewArray(time.Date(2021, 7, 27, 9, 35, 42, 123000000, time.UTC).Local(), time.Time{}.Local()),
+			"datetime", types.MustNewArray(time.Date(2021, 7, 27, 9, 35, 42, 123000000, time.UTC), time.Time{}),
 			"double", types.MustNewArray(42.13),
 			"int32", types.MustNewArray(int32(42), int32(0)),
 			"int64", types.MustNewArray(int64(223372036854775807)),
@@ -201,13 +201,25 @@ var (
 			`"null":null}`,
 	}
 
+	dbref = testCase{
+		name: "DBRef",
+		v: convertDocument(types.MustMakeDocument(
+			"author", types.MustMakeDocument(
+				"$ref", "users",
+				"$id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
+				"$db", "test",
+			),
+		)),
+		j: `{"author":{"$ref":"users","$id":{"oid":"62e2bd54510683f9c0bb0d6b"},"$db":"test"}}`,
+	}
+
 	eof = testCase{
 		name: "EOF",
 		j:    `[`,
 		jErr: `unexpected EOF`,
 	}
 
-	documentTestCases = []testCase{handshake1, handshake2, handshake4, all, eof}
+	documentTestCases = []testCase{handshake1, handshake2, handshake4, all, dbref, eof}
 )
 
 func TestDocument(t *testing.T) {
@@ -245,19 +257,57 @@ func TestMarshalJSONHANA(t *testing.T) {
 			0x32, 0x62, 0x64, 0x35, 0x34, 0x35, 0x31, 0x30, 0x36, 0x38, 0x33, 0x66, 0x39, 0x63, 0x30, 0x62, 0x62, 0x30,
 			0x64, 0x36, 0x62, 0x22, 0x7d, 0x2c, 0x22, 0x62, 0x6f, 0x6f, 0x6c, 0x22, 0x3a, 0x74, 0x72, 0x75, 0x65, 0x2c,
 			0x22, 0x69, 0x6e, 0x74, 0x33, 0x32, 0x22, 0x3a, 0x34, 0x32, 0x2c, 0x22, 0x69, 0x6e, 0x74, 0x36, 0x34, 0x22,
-			0x3a, 0x32, 0x32, 0x33, 0x33, 0x37, 0x32, 0x30, 0x33, 0x36, 0x38, 0x35, 0x34, 0x37, 0x37, 0x35, 0x38, 0x30,
-			0x37, 0x2c, 0x22, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x36, 0x34, 0x22, 0x3a, 0x31, 0x32, 0x33, 0x2e, 0x31, 0x32,
-			0x33, 0x2c, 0x22, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x22, 0x3a, 0x22, 0x66, 0x6f, 0x6f, 0x22, 0x2c, 0x22,
-			0x6e, 0x75, 0x6c, 0x6c, 0x22, 0x3a, 0x6e, 0x75, 0x6c, 0x6c, 0x2c, 0x22, 0x61, 0x72, 0x72, 0x61, 0x79, 0x22,
-			0x3a, 0x5b, 0x30, 0x2c, 0x22, 0x22, 0x2c, 0x66, 0x61, 0x6c, 0x73, 0x65, 0x2c, 0x5b, 0x5d, 0x2c, 0x7b, 0x7d,
-			0x2c, 0x6e, 0x75, 0x6c, 0x6c, 0x5d, 0x2c, 0x22, 0x64, 0x6f, 0x63, 0x75, 0x6d, 0x65, 0x6e, 0x74, 0x22, 0x3a,
-			0x7b, 0x22, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x22, 0x3a, 0x22, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x7d, 0x7d,
+			0x3a, 0x7b, 0x22, 0x24, 0x6c, 0x22, 0x3a, 0x22, 0x30, 0x39, 0x34, 0x34, 0x36, 0x37, 0x34, 0x34, 0x30, 0x37,
+			0x33, 0x37, 0x30, 0x39, 0x35, 0x35, 0x31, 0x36, 0x31, 0x35, 0x22, 0x2c, 0x22, 0x24, 0x6e, 0x22, 0x3a, 0x32,
+			0x32, 0x33, 0x33, 0x37, 0x32, 0x30, 0x33, 0x36, 0x38, 0x35, 0x34, 0x37, 0x37, 0x35, 0x38, 0x30, 0x37, 0x7d,
+			0x2c, 0x22, 0x66, 0x6c, 0x6f, 0x61, 0x74, 0x36, 0x34, 0x22, 0x3a, 0x31, 0x32, 0x33, 0x2e, 0x31, 0x32, 0x33,
+			0x2c, 0x22, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x22, 0x3a, 0x22, 0x66, 0x6f, 0x6f, 0x22, 0x2c, 0x22, 0x6e,
+			0x75, 0x6c, 0x6c, 0x22, 0x3a, 0x6e, 0x75, 0x6c, 0x6c, 0x2c, 0x22, 0x61, 0x72, 0x72, 0x61, 0x79, 0x22, 0x3a,
+			0x5b, 0x30, 0x2c, 0x22, 0x22, 0x2c, 0x66, 0x61, 0x6c, 0x73, 0x65, 0x2c, 0x5b, 0x5d, 0x2c, 0x7b, 0x7d, 0x2c,
+			0x6e, 0x75, 0x6c, 0x6c, 0x5d, 0x2c, 0x22, 0x64, 0x6f, 0x63, 0x75, 0x6d, 0x65, 0x6e, 0x74, 0x22, 0x3a, 0x7b,
+			0x22, 0x66, 0x69, 0x65, 0x6c, 0x64, 0x22, 0x3a, 0x22, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x7d, 0x7d,
 		}
 
 		assert.Nil(t, err)
 		assert.Equal(t, expected, actual)
 	})
 
+	t.Run("MarshalJSONHANA datetime", func(t *testing.T) {
+		t.Parallel()
+
+		document := convertDocument(types.MustMakeDocument(
+			"createdAt", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+		))
+
+		actual, err := document.MarshalJSONHANA()
+
+		assert.Nil(t, err)
+		assert.Equal(t, `{"createdAt":{"$da":1659312000000}}`, string(actual))
+	})
+
+	t.Run("MarshalJSONHANA code", func(t *testing.T) {
+		t.Parallel()
+
+		td := types.MustMakeDocument(
+			"code", types.Code("function() { return 1; }"),
+			"codeWithScope", types.CodeWithScope{
+				Code:  "function() { return d; }",
+				Scope: types.MustMakeDocument("d", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)),
+			},
+		)
+
+		actual, err := convertDocument(td).MarshalJSONHANA()
+		assert.Nil(t, err)
+		assert.Equal(t, `{"code":{"$js":"function() { return 1; }"},`+
+			`"codeWithScope":{"$js":"function() { return d; }","$s":{"d":{"$da":1659312000000}}}}`, string(actual))
+
+		v, err := Unmarshal(actual)
+		assert.Nil(t, err)
+		m := v.(types.Document).Map()
+		assert.Equal(t, types.Code("function() { return 1; }"), m["code"])
+		assert.Equal(t, "function() { return d; }", m["codeWithScope"].(types.CodeWithScope).Code)
+	})
+
 	t.Run("MarshalJSONHANA unsupported datatype", func(t *testing.T) {
 		t.Parallel()
 
@@ -45,7 +45,7 @@
 //  Regex:      {"$r": "<string without terminating 0x0>", "o": "<string without terminating 0x0>"}
 //  Int32:      JSON number
 //  Timestamp:  {"ts": "<number as string>"}
-//  Int64:      {"$l": "<number as string>"}
+//  Int64:      JSON number, or {"$l": "<key as string>", "$n": JSON number} if no exact double
 //  Decimal128: {"$n": "<number as string>"}
 //  CString:    {"$c": "<string without terminating 0x0>"}
 package fjson
@@ -114,6 +114,10 @@ func fromFJSON(v fjsontype) any {
 		return int64(*v)
 	case *Int32:
 		return int32(*v)
+	case *Code:
+		return types.Code(*v)
+	case *CodeWithScope:
+		return types.CodeWithScope(*v)
 		// case *Timestamp:
 		// 	return types.Timestamp(*v)
 		// case *CString:
@@ -149,6 +153,10 @@ func toFJSON(v any) fjsontype {
 		return pointer.To(Int64(v))
 	case int32:
 		return pointer.To(Int64(v))
+	case types.Code:
+		return pointer.To(Code(v))
+	case types.CodeWithScope:
+		return pointer.To(CodeWithScope(v))
 		// case types.Timestamp:
 		// 	return pointer.To(Timestamp(v))
 		// case types.CString:
@@ -172,18 +180,25 @@ func toFJSONHANA(v any) (fjsontype, error) {
 		return pointer.To(ObjectID(v)), nil
 	case bool:
 		return pointer.To(Bool(v)), nil
+	case time.Time:
+		return pointer.To(DateTime(v)), nil
 	case nil:
 		return nil, nil
 	case int64:
 		return pointer.To(Int64(v)), nil
 	case int32:
 		return pointer.To(Int64(v)), nil
+	case types.Code:
+		return pointer.To(Code(v)), nil
+	case types.CodeWithScope:
+		return pointer.To(CodeWithScope(v)), nil
 	default:
 		return nil, fmt.Errorf("datatype %T is not supported", v)
 	}
 }
 
 // Unmarshal decodes the given fjson-encoded data.
+// It also accepts values of MongoDB Extended JSON v2 like {"$date": "2022-08-01T00:00:00Z"}, see unmarshalExtJSON.
 // Everything commented is at the moment not supported.
 func Unmarshal(data []byte) (any, error) {
 	var v any
@@ -218,10 +233,22 @@ func Unmarshal(data []byte) (any, error) {
 			var o DateTime
 			err = o.UnmarshalJSON(data)
 			res = &o
+		case v["$l"] != nil:
+			var o Int64
+			err = o.UnmarshalJSON(data)
+			res = &o
 		case v["$r"] != nil:
 			var o Regex
 			err = o.UnmarshalJSON(data)
 			res = &o
+		case v["$js"] != nil && v["$s"] != nil:
+			var o CodeWithScope
+			err = o.UnmarshalJSON(data)
+			res = &o
+		case v["$js"] != nil:
+			var o Code
+			err = o.UnmarshalJSON(data)
+			res = &o
 		// case v["ts"] != nil:
 		// 	var o Timestamp
 		// 	err = o.UnmarshalJSON(data)
@@ -236,6 +263,8 @@ func Unmarshal(data []byte) (any, error) {
 		// 	var o CString
 		// 	err = o.UnmarshalJSON(data)
 		// 	res = &o
+		case isExtJSON(v):
+			res, err = unmarshalExtJSON(data)
 		default:
 			var o Document
 			err = o.UnmarshalJSON(data)
@@ -304,6 +333,10 @@ func MarshalHANA(v any) ([]byte, error) {
 	switch f := f.(type) {
 	case *Document:
 		b, err = f.MarshalJSONHANA()
+	case *CodeWithScope:
+		b, err = f.MarshalJSONHANA()
+	case *Int64:
+		b, err = f.MarshalJSONHANA()
 	default:
 		b, err = f.MarshalJSON()
 	}
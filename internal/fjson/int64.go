@@ -21,6 +21,8 @@ package fjson
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"strconv"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 )
@@ -31,7 +33,45 @@ type Int64 int64
 // fjsontype implements fjsontype interface.
 func (i *Int64) fjsontype() {}
 
+// int64JSON is the representation of an int64 stored in SAP HANA, which stores JSON numbers as doubles.
+// $l is the exact value as key of Int64Key, $n the approximate number for comparisons with values of other numeric types.
+type int64JSON struct {
+	L string      `json:"$l"`
+	N json.Number `json:"$n"`
+}
+
+// maxExactInt64 is the largest magnitude of int64 values SAP HANA stores exactly as JSON numbers, which are doubles.
+const maxExactInt64 = 1 << 53
+
+// IsInt64Key returns true if the int64 is stored in SAP HANA with its key, as it is no exact double.
+// Other int64 values are stored as plain JSON numbers.
+func IsInt64Key(v int64) bool {
+	return v > maxExactInt64 || v < -maxExactInt64
+}
+
+// Int64Key returns the key of an int64 stored in SAP HANA.
+// It is the value with flipped sign bit as unsigned number of 20 digits,
+// so the order of the keys as strings is the order of the values.
+func Int64Key(v int64) string {
+	return fmt.Sprintf("%020d", uint64(v)^(1<<63))
+}
+
+// parseInt64Key returns the int64 of a key returned by Int64Key.
+func parseInt64Key(key string) (int64, error) {
+	if len(key) != 20 {
+		return 0, lazyerrors.Errorf("invalid int64 key %q", key)
+	}
+
+	u, err := strconv.ParseUint(key, 10, 64)
+	if err != nil {
+		return 0, lazyerrors.Error(err)
+	}
+
+	return int64(u ^ (1 << 63)), nil
+}
+
 // UnmarshalJSON implements fjsontype interface.
+// It accepts both JSON numbers and int64 as they are stored in SAP HANA.
 func (i *Int64) UnmarshalJSON(data []byte) error {
 	if bytes.Equal(data, []byte("null")) {
 		panic("null data")
@@ -41,6 +81,24 @@ func (i *Int64) UnmarshalJSON(data []byte) error {
 	dec := json.NewDecoder(r)
 	dec.DisallowUnknownFields()
 
+	if bytes.HasPrefix(data, []byte("{")) {
+		var o int64JSON
+		if err := dec.Decode(&o); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err := checkConsumed(dec, r); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		v, err := parseInt64Key(o.L)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		*i = Int64(v)
+		return nil
+	}
+
 	var o int64
 	if err := dec.Decode(&o); err != nil {
 		return lazyerrors.Error(err)
@@ -62,6 +120,23 @@ func (i *Int64) MarshalJSON() ([]byte, error) {
 	return res, nil
 }
 
+// MarshalJSONHANA returns the JSON of the int64 to store it in SAP HANA without losing precision.
+// Values which are no exact doubles are stored as {"$l": key, "$n": number}, see IsInt64Key.
+func (i *Int64) MarshalJSONHANA() ([]byte, error) {
+	if !IsInt64Key(int64(*i)) {
+		return i.MarshalJSON()
+	}
+
+	res, err := json.Marshal(int64JSON{
+		L: Int64Key(int64(*i)),
+		N: json.Number(strconv.FormatInt(int64(*i), 10)),
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	return res, nil
+}
+
 // check interfaces
 var (
 	_ fjsontype = (*Int64)(nil)
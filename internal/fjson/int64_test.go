@@ -20,9 +20,12 @@ package fjson
 
 import (
 	"math"
+	"strconv"
 	"testing"
 
 	"github.com/AlekSi/pointer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var int64TestCases = []testCase{{
@@ -59,3 +62,48 @@ func FuzzInt64(f *testing.F) {
 func BenchmarkInt64(b *testing.B) {
 	benchmark(b, int64TestCases, func() fjsontype { return new(Int64) })
 }
+
+func TestInt64HANA(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Exact", func(t *testing.T) {
+		t.Parallel()
+
+		for _, v := range []int64{0, 42, 1 << 53, -1 << 53} {
+			b, err := pointer.To(Int64(v)).MarshalJSONHANA()
+			require.NoError(t, err)
+			assert.Equal(t, strconv.FormatInt(v, 10), string(b))
+		}
+	})
+
+	for _, v := range []int64{1<<53 + 1, -1<<53 - 1, math.MaxInt64, math.MinInt64} {
+		v := v
+		t.Run(strconv.FormatInt(v, 10), func(t *testing.T) {
+			t.Parallel()
+
+			b, err := pointer.To(Int64(v)).MarshalJSONHANA()
+			require.NoError(t, err)
+			assert.Equal(t, `{"$l":"`+Int64Key(v)+`","$n":`+strconv.FormatInt(v, 10)+`}`, string(b))
+
+			actual, err := Unmarshal(b)
+			require.NoError(t, err)
+			assert.Equal(t, v, actual)
+		})
+	}
+
+	t.Run("KeyOrder", func(t *testing.T) {
+		t.Parallel()
+
+		values := []int64{math.MinInt64, -1 << 53, -1, 0, 1, 1<<53 + 1, 1<<53 + 2, math.MaxInt64}
+		for i := 1; i < len(values); i++ {
+			assert.Less(t, Int64Key(values[i-1]), Int64Key(values[i]))
+		}
+	})
+
+	t.Run("InvalidKey", func(t *testing.T) {
+		t.Parallel()
+
+		var i Int64
+		require.Error(t, i.UnmarshalJSON([]byte(`{"$l":"42","$n":42}`)))
+	})
+}
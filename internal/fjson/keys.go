@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+// reservedKeys are the keys of objects which are read as values of other types than documents,
+// both of the stored format and of Extended JSON.
+var reservedKeys = map[string]struct{}{
+	"$da":                {},
+	"$l":                 {},
+	"$r":                 {},
+	"$js":                {},
+	"$oid":               {},
+	"$date":              {},
+	"$numberInt":         {},
+	"$numberLong":        {},
+	"$numberDouble":      {},
+	"$regularExpression": {},
+	"$code":              {},
+}
+
+// IsReservedKey returns true if documents with the key can't be stored,
+// because they would be read as values of other types, like {"$da": 0} as a date.
+func IsReservedKey(key string) bool {
+	_, ok := reservedKeys[key]
+	return ok
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// extJSON is a value of MongoDB Extended JSON v2, in Relaxed or Canonical format.
+// Documents written to SAP HANA directly by SQL applications may contain them, like mongoexport writes them.
+type extJSON struct {
+	OID    *string         `json:"$oid"`
+	Date   json.RawMessage `json:"$date"`
+	Int    *string         `json:"$numberInt"`
+	Long   *string         `json:"$numberLong"`
+	Double *string         `json:"$numberDouble"`
+	Regex  *struct {
+		Pattern string `json:"pattern"`
+		Options string `json:"options"`
+	} `json:"$regularExpression"`
+	Code  *string         `json:"$code"`
+	Scope json.RawMessage `json:"$scope"`
+}
+
+// isExtJSON returns true if the object is a value of Extended JSON supported by unmarshalExtJSON.
+func isExtJSON(v map[string]any) bool {
+	switch len(v) {
+	case 1:
+		for key := range v {
+			switch key {
+			case "$oid", "$date", "$numberInt", "$numberLong", "$numberDouble", "$regularExpression", "$code":
+				return true
+			}
+		}
+	case 2:
+		return v["$code"] != nil && v["$scope"] != nil
+	}
+
+	return false
+}
+
+// unmarshalExtJSON decodes a value of Extended JSON.
+// Dates are ISO-8601 strings like "2022-08-01T00:00:00.123Z" in Relaxed format,
+// and milliseconds since epoch like {"$numberLong": "1659312000123"} in Canonical format.
+func unmarshalExtJSON(data []byte) (fjsontype, error) {
+	r := bytes.NewReader(data)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var o extJSON
+	if err := dec.Decode(&o); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err := checkConsumed(dec, r); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	switch {
+	case o.OID != nil:
+		b, err := hex.DecodeString(*o.OID)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		if len(b) != 12 {
+			return nil, lazyerrors.Errorf("fjson.unmarshalExtJSON: $oid of %d bytes", len(b))
+		}
+
+		var res ObjectID
+		copy(res[:], b)
+		return &res, nil
+
+	case o.Date != nil:
+		t, err := unmarshalExtJSONDate(o.Date)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res := DateTime(t)
+		return &res, nil
+
+	case o.Int != nil:
+		i, err := strconv.ParseInt(*o.Int, 10, 32)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res := Int32(i)
+		return &res, nil
+
+	case o.Long != nil:
+		i, err := strconv.ParseInt(*o.Long, 10, 64)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res := Int64(i)
+		return &res, nil
+
+	case o.Double != nil:
+		var f float64
+		switch *o.Double {
+		case "Infinity":
+			f = math.Inf(1)
+		case "-Infinity":
+			f = math.Inf(-1)
+		case "NaN":
+			f = math.NaN()
+		default:
+			var err error
+			if f, err = strconv.ParseFloat(*o.Double, 64); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		}
+
+		res := Double(f)
+		return &res, nil
+
+	case o.Regex != nil:
+		return &Regex{Pattern: o.Regex.Pattern, Options: o.Regex.Options}, nil
+
+	case o.Code != nil && o.Scope != nil:
+		var scope Document
+		if err := scope.UnmarshalJSON(o.Scope); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return &CodeWithScope{Code: *o.Code, Scope: types.Document(scope)}, nil
+
+	case o.Code != nil:
+		res := Code(*o.Code)
+		return &res, nil
+
+	default:
+		return nil, lazyerrors.Errorf("fjson.unmarshalExtJSON: unexpected value %s", data)
+	}
+}
+
+// unmarshalExtJSONDate returns the time of $date with the precision of milliseconds in UTC.
+// It accepts ISO-8601 strings, {"$numberLong": "<milliseconds>"} and plain milliseconds.
+func unmarshalExtJSONDate(data json.RawMessage) (time.Time, error) {
+	var ms int64
+	switch {
+	case bytes.HasPrefix(data, []byte(`"`)):
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return time.Time{}, lazyerrors.Error(err)
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return time.Time{}, lazyerrors.Error(err)
+		}
+		ms = t.UnixMilli()
+
+	case bytes.HasPrefix(data, []byte(`{`)):
+		var o struct {
+			Long string `json:"$numberLong"`
+		}
+		if err := json.Unmarshal(data, &o); err != nil {
+			return time.Time{}, lazyerrors.Error(err)
+		}
+
+		var err error
+		if ms, err = strconv.ParseInt(o.Long, 10, 64); err != nil {
+			return time.Time{}, lazyerrors.Error(err)
+		}
+
+	default:
+		if err := json.Unmarshal(data, &ms); err != nil {
+			return time.Time{}, lazyerrors.Error(err)
+		}
+	}
+
+	return time.UnixMilli(ms).UTC(), nil
+}
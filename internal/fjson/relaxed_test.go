@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestUnmarshalExtJSON(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Relaxed", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := Unmarshal([]byte(`{"_id": {"$oid": "62e2bd54510683f9c0bb0d6b"}, "int": 42, "double": 4.2, ` +
+			`"created": {"$date": "2022-08-01T02:00:00.123456+02:00"}, "long": {"$numberLong": "9007199254740993"}, ` +
+			`"tags": [{"$date": 1659312000000}, "foo"]}`))
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
+			"int", int32(42),
+			"double", 4.2,
+			"created", time.Date(2022, 8, 1, 0, 0, 0, 123000000, time.UTC),
+			"long", int64(9007199254740993),
+			"tags", types.MustNewArray(time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC), "foo"),
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Canonical", func(t *testing.T) {
+		t.Parallel()
+
+		expected := types.MustMakeDocument(
+			"_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
+			"double", types.MustNewArray(42.0, math.Inf(-1)),
+			"datetime", time.Date(2022, 8, 1, 0, 0, 0, 123000000, time.UTC),
+			"regex", types.Regex{Pattern: "^a.*", Options: "i"},
+			"int32", int32(42),
+			"int64", int64(math.MinInt64),
+			"code", types.Code("function() { return 1; }"),
+			"codeWithScope", types.CodeWithScope{Code: "function() { return x; }", Scope: types.MustMakeDocument("x", int32(1))},
+		)
+
+		b, err := MarshalCanonical(expected)
+		require.NoError(t, err)
+
+		actual, err := Unmarshal(b)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+
+		for _, data := range []string{
+			`{"$oid": "62e2"}`,
+			`{"$date": "yesterday"}`,
+			`{"$numberInt": "2147483648"}`,
+			`{"$numberLong": "4.2"}`,
+			`{"$numberDouble": "foo"}`,
+		} {
+			_, err := Unmarshal([]byte(data))
+			assert.Error(t, err, data)
+		}
+	})
+
+	t.Run("Document", func(t *testing.T) {
+		t.Parallel()
+
+		// objects with other fields are no Extended JSON values
+		actual, err := Unmarshal([]byte(`{"$date": "2022-08-01T00:00:00Z", "note": "foo"}`))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("$date", "2022-08-01T00:00:00Z", "note", "foo"), actual)
+	})
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// randomDocument returns a random document of nested documents and arrays up to the depth.
+// Numbers are only of the types they are decoded to: int32, int64 above 2^53 and doubles with fractions.
+func randomDocument(r *rand.Rand, depth int) types.Document {
+	doc := types.MustMakeDocument()
+	for i := r.Intn(5); i > 0; i-- {
+		key := string(rune('a' + r.Intn(6)))
+		if r.Intn(4) == 0 {
+			key += "." + strconv.Itoa(r.Intn(3))
+		}
+		if err := doc.Set(key, randomValue(r, depth)); err != nil {
+			panic(err)
+		}
+	}
+
+	return doc
+}
+
+// randomArray returns a random array of nested documents and arrays up to the depth.
+func randomArray(r *rand.Rand, depth int) *types.Array {
+	arr := types.MakeArray(0)
+	for i := r.Intn(5); i > 0; i-- {
+		if err := arr.Append(randomValue(r, depth)); err != nil {
+			panic(err)
+		}
+	}
+
+	return arr
+}
+
+// randomValue returns a random value, which is a document or an array for the depth above 0 in half of the cases.
+func randomValue(r *rand.Rand, depth int) any {
+	if depth > 0 && r.Intn(2) == 0 {
+		if r.Intn(2) == 0 {
+			return randomDocument(r, depth-1)
+		}
+		return randomArray(r, depth-1)
+	}
+
+	switch r.Intn(8) {
+	case 0:
+		return "s" + strconv.Itoa(r.Intn(100))
+	case 1:
+		return int32(r.Int31() - math.MaxInt32/2)
+	case 2:
+		return int64(1<<53+1) + r.Int63n(1<<62)
+	case 3:
+		return float64(r.Intn(1000)) + 0.25
+	case 4:
+		return r.Intn(2) == 0
+	case 5:
+		return nil
+	case 6:
+		var oid types.ObjectID
+		r.Read(oid[:])
+		return oid
+	default:
+		return time.UnixMilli(r.Int63n(1 << 42)).UTC()
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		doc := randomDocument(r, 4)
+		if err := doc.Set("nested", randomArray(r, 4)); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, marshal := range map[string]func(any) ([]byte, error){
+			"HANA": MarshalHANA,
+			"Wire": Marshal,
+		} {
+			b, err := marshal(doc)
+			require.NoError(t, err, name)
+
+			actual, err := Unmarshal(b)
+			require.NoError(t, err, "%s: %s", name, b)
+			assert.Equal(t, doc, actual, "%s: %s", name, b)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// skippedValue is a JSON value which is validated, but not decoded.
+type skippedValue struct{}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (*skippedValue) UnmarshalJSON([]byte) error {
+	return nil
+}
+
+// SplitObject returns the keys of the JSON object in their order and the JSON of their values,
+// which are slices of data without copying, so that they can be decoded by Unmarshal when they are used.
+// The values are valid JSON, but they are not decoded.
+func SplitObject(data []byte) (keys []string, values [][]byte, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	t, err := dec.Token()
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+	if t != json.Delim('{') {
+		return nil, nil, lazyerrors.Errorf("fjson.SplitObject: expected object, got %v", t)
+	}
+
+	for dec.More() {
+		if t, err = dec.Token(); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return nil, nil, lazyerrors.Errorf("fjson.SplitObject: expected key, got %v", t)
+		}
+
+		// the value starts after the colon following the key
+		start := dec.InputOffset()
+		if err = dec.Decode(new(skippedValue)); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+
+		keys = append(keys, key)
+		values = append(values, bytes.TrimLeft(data[start:dec.InputOffset()], " \t\r\n:"))
+	}
+
+	if t, err = dec.Token(); err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+	if t != json.Delim('}') {
+		return nil, nil, lazyerrors.Errorf("fjson.SplitObject: expected end of object, got %v", t)
+	}
+
+	if t, err = dec.Token(); err != io.EOF {
+		return nil, nil, lazyerrors.Errorf("fjson.SplitObject: unexpected data after object: %v", t)
+	}
+
+	return keys, values, nil
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// SQLCapture collects the statements run by the pool for a request, for the traffic capture.
+type SQLCapture struct {
+	m          sync.Mutex
+	statements []string
+}
+
+type sqlCaptureKey struct{}
+
+// WithSQLCapture returns a context in which all statements of the pool are added to the capture,
+// with their literals replaced by "?", so that the capture contains no data of the documents.
+func WithSQLCapture(ctx context.Context, c *SQLCapture) context.Context {
+	return context.WithValue(ctx, sqlCaptureKey{}, c)
+}
+
+// Statements returns the captured statements in the order they were run.
+func (c *SQLCapture) Statements() []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return append([]string(nil), c.statements...)
+}
+
+// captureSQL adds the query to the capture of the context, if any.
+func captureSQL(ctx context.Context, query string) {
+	c, ok := ctx.Value(sqlCaptureKey{}).(*SQLCapture)
+	if !ok {
+		return
+	}
+
+	query = SanitizeSQL(query)
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.statements = append(c.statements, query)
+}
+
+// SanitizeSQL returns the query with its string and number literals replaced by "?".
+// Quoted identifiers, like the names of schemas, collections and fields, and placeholders like $1 are kept.
+func SanitizeSQL(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '"':
+			// quoted identifier, with "" for a quote
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '"' {
+					if j+1 < len(query) && query[j+1] == '"' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			b.WriteString(query[i:j])
+			i = j
+
+		case c == '\'':
+			// string literal, with '' for a quote
+			j := i + 1
+			for j < len(query) {
+				if query[j] == '\'' {
+					if j+1 < len(query) && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					j++
+					break
+				}
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+
+		case isSQLDigit(c) && (i == 0 || !isSQLIdentByte(query[i-1])):
+			// number literal, like 42, 1.5 or 1e10
+			j := i
+			for j < len(query) && (isSQLDigit(query[j]) || query[j] == '.' || query[j] == 'e' || query[j] == 'E' ||
+				((query[j] == '+' || query[j] == '-') && (query[j-1] == 'e' || query[j-1] == 'E'))) {
+				j++
+			}
+			b.WriteByte('?')
+			i = j
+
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	return b.String()
+}
+
+// isSQLDigit returns true for decimal digits.
+func isSQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isSQLIdentByte returns true for bytes of unquoted identifiers and placeholders, which may contain digits.
+func isSQLIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '#' || isSQLDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeSQL(t *testing.T) {
+	t.Parallel()
+
+	for query, expected := range map[string]string{
+		`SELECT * FROM "db"."c" WHERE "name" = 'Doe' AND "age" > 50 LIMIT 10`:         `SELECT * FROM "db"."c" WHERE "name" = ? AND "age" > ? LIMIT ?`,
+		`SELECT * FROM "db"."c" WHERE "a" BETWEEN -1.7976931348623157E308 AND 1.5e-3`: `SELECT * FROM "db"."c" WHERE "a" BETWEEN -? AND ?`,
+		`INSERT INTO "db"."c2" VALUES ($1)`:                                           `INSERT INTO "db"."c2" VALUES ($1)`,
+		`SELECT * FROM "db"."it""s 1" WHERE "a" = 'it''s 2'`:                          `SELECT * FROM "db"."it""s 1" WHERE "a" = ?`,
+		`COMMENT ON TABLE "db"."c" IS '{"readOnly":true}'`:                            `COMMENT ON TABLE "db"."c" IS ?`,
+		`SELECT COUNT(*) FROM DUMMY`:                                                  `SELECT COUNT(*) FROM DUMMY`,
+	} {
+		assert.Equal(t, expected, SanitizeSQL(query), query)
+	}
+}
+
+func TestSQLCapture(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	captureSQL(ctx, "SELECT 1 FROM DUMMY")
+
+	var c SQLCapture
+	ctx = WithSQLCapture(ctx, &c)
+	captureSQL(ctx, "SELECT 1 FROM DUMMY")
+	captureSQL(ctx, `DROP COLLECTION "db"."c"`)
+
+	assert.Equal(t, []string{"SELECT ? FROM DUMMY", `DROP COLLECTION "db"."c"`}, c.Statements())
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"strings"
+)
+
+type commentKey struct{}
+
+// WithComment returns a context in which all statements of the pool start with the comment as SQL comment,
+// so that DBAs find them with the comment of the command in the SQL plan cache and expensive statements trace.
+func WithComment(ctx context.Context, comment string) context.Context {
+	return context.WithValue(ctx, commentKey{}, comment)
+}
+
+// Comment returns the comment of the context, or an empty string if there is none.
+func Comment(ctx context.Context) string {
+	comment, _ := ctx.Value(commentKey{}).(string)
+	return comment
+}
+
+// commentSQL returns the query with the comment of the context, if any.
+// The end of a comment "*/" in it is broken up, so that it cannot end the SQL comment early.
+func commentSQL(ctx context.Context, query string) string {
+	comment := Comment(ctx)
+	if comment == "" {
+		return query
+	}
+
+	return "/* " + strings.ReplaceAll(comment, "*/", "* /") + " */ " + query
+}
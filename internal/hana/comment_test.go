@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommentSQL(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Equal(t, "SELECT 1 FROM DUMMY", commentSQL(ctx, "SELECT 1 FROM DUMMY"))
+
+	ctx = WithComment(ctx, "nightly report")
+	assert.Equal(t, "nightly report", Comment(ctx))
+	assert.Equal(t, "/* nightly report */ SELECT 1 FROM DUMMY", commentSQL(ctx, "SELECT 1 FROM DUMMY"))
+
+	ctx = WithComment(ctx, "a */ DROP TABLE x /*")
+	assert.Equal(t, "/* a * / DROP TABLE x /* */ SELECT 1 FROM DUMMY", commentSQL(ctx, "SELECT 1 FROM DUMMY"))
+}
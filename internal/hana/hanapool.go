@@ -12,6 +12,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 	"go.uber.org/zap"
@@ -24,16 +25,22 @@ var (
 
 type Hpool struct {
 	*sql.DB
+
+	// acquireTimeout is the maximum time to take a connection from the pool, unlimited if 0.
+	acquireTimeout time.Duration
+
+	// options caches the options of collections, nil if they are not cached
+	options *optionsCache
 }
 
 // TableStats describes some statistics for a table.
 type TableStats struct {
 	Table       string
 	TableType   string
-	SizeTotal   int32
-	SizeIndexes int32
-	SizeTable   int32
-	Rows        int32
+	SizeTotal   int64
+	SizeIndexes int64
+	SizeTable   int64
+	Rows        int64
 }
 
 // DBStats describes some statistics for a database.
@@ -47,24 +54,39 @@ type DBStats struct {
 	CountIndexes int32
 }
 
-// CreatePool sets up the connection to SAP HANA JSON Document Store
-func CreatePool(connectString string, logger *zap.Logger, lazy bool) (*Hpool, error) {
+// CreatePool sets up the connection to SAP HANA JSON Document Store.
+// With TLS options, the certificate of SAP HANA is verified by them and checked with a first connection.
+// With pool options, the connections are sized and reused by them.
+func CreatePool(connectString string, tlsOpts *TLSOpts, poolOpts *PoolOpts, logger *zap.Logger, lazy bool) (*Hpool, error) {
 	if connectString == "" {
 		return nil, lazyerrors.Errorf("No connect string for SAP HANA Cloud instance given")
 	}
 
-	fmt.Println("Connect String is " + connectString)
+	logger.Info("Connecting to SAP HANA", zap.String("connectString", RedactConnectString(connectString)))
+
+	if tlsOpts == nil && poolOpts == nil {
+		db, err := sql.Open("hdb", connectString)
+		if err != nil {
+			return nil, fmt.Errorf("hanapool.CreatePool: %w", err)
+		}
+
+		return &Hpool{DB: db}, nil
+	}
 
-	db, err := sql.Open("hdb", connectString)
+	connector, err := openConnector(connectString, tlsOpts)
 	if err != nil {
 		return nil, fmt.Errorf("hanapool.CreatePool: %w", err)
 	}
 
-	res := &Hpool{
-		DB: db,
+	res := openPool(connector, poolOpts)
+	if tlsOpts != nil {
+		if err = checkTLS(res.DB, logger); err != nil {
+			res.Close()
+			return nil, fmt.Errorf("hanapool.CreatePool: %w", err)
+		}
 	}
 
-	return res, err
+	return res, nil
 }
 
 // Tables returns a sorted list of SAP HANA JSON Document Store collection names.
@@ -161,30 +183,25 @@ func (hanaPool *Hpool) CreateNamespaceIfNotExists(ctx context.Context, db, colle
 }
 
 // TableStats returns a set of statistics for a table.
-// Still needs to be written for SAP HANA JSON Document Store
-// func (hanaPool *Hpool) TableStats(ctx context.Context, db, table string) (*TableStats, error) {
-// 	res := new(TableStats)
-// 	sql := `
-//     SELECT table_name, table_type,
-//            pg_total_relation_size('"'||t.table_schema||'"."'||t.table_name||'"'),
-//            pg_indexes_size('"'||t.table_schema||'"."'||t.table_name||'"'),
-//            pg_relation_size('"'||t.table_schema||'"."'||t.table_name||'"'),
-//            COALESCE(s.n_live_tup, 0)
-//       FROM information_schema.tables AS t
-//       LEFT OUTER
-//       JOIN pg_stat_user_tables AS s ON s.schemaname = t.table_schema
-//                                       and s.relname = t.table_name
-//      WHERE t.table_schema = $1
-//        AND t.table_name = $2`
+//
+// It returns ErrNotExist if table does not exist.
+func (hanaPool *Hpool) TableStats(ctx context.Context, db, table string) (*TableStats, error) {
+	res := new(TableStats)
+	sqlStmt := "SELECT TABLE_NAME, TABLE_TYPE, TABLE_SIZE, RECORD_COUNT FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?"
+
+	err := hanaPool.QueryRowContext(ctx, sqlStmt, db, table).Scan(&res.Table, &res.TableType, &res.SizeTotal, &res.Rows)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
 
-// 	err := hanaPool.QueryRowContext(ctx, sql, db, table).
-// 		Scan(&res.Table, &res.TableType, &res.SizeTotal, &res.SizeIndexes, &res.SizeTable, &res.Rows)
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
+	// The indexes built by createIndexes are not reported separately.
+	res.SizeTable = res.SizeTotal
 
-// 	return res, nil
-// }
+	return res, nil
+}
 
 // DBStats returns a set of statistics for a database.
 // Still needs to be written for SAP HANA JSON Document Store
@@ -222,6 +239,7 @@ func (hanaPool *Hpool) CreateNamespaceIfNotExists(ctx context.Context, db, colle
 func (hanaPool *Hpool) DropTable(ctx context.Context, db, collection string) error {
 	sql := fmt.Sprintf("DROP COLLECTION \"%s\".\"%s\"", db, collection)
 	_, err := hanaPool.ExecContext(ctx, sql)
+	hanaPool.options.remove(db, collection)
 	if err != nil {
 		return ErrNotExist
 	}
@@ -235,6 +253,7 @@ func (hanaPool *Hpool) DropTable(ctx context.Context, db, collection string) err
 func (hanaPool *Hpool) DropSchema(ctx context.Context, db string) error {
 	sql := fmt.Sprintf("DROP SCHEMA \"%s\" CASCADE", db)
 	_, err := hanaPool.ExecContext(ctx, sql)
+	hanaPool.options.remove(db, "")
 	if err == nil {
 		return nil
 	}
@@ -296,10 +315,10 @@ func (hanaPool *Hpool) NamespaceExists(ctx context.Context, db, collection strin
 
 // DatabaseExists checks if the database exists
 func (hanaPool *Hpool) DatabaseExists(ctx context.Context, db string) (bool, error) {
-	sql := fmt.Sprintf("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = '%s'", db)
+	sql := "SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?"
 
 	var count int
-	err := hanaPool.QueryRowContext(ctx, sql).Scan(&count)
+	err := hanaPool.QueryRowContext(ctx, sql, db).Scan(&count)
 	if err != nil {
 		return false, lazyerrors.Error(err)
 	}
@@ -313,10 +332,10 @@ func (hanaPool *Hpool) DatabaseExists(ctx context.Context, db string) (bool, err
 
 // CollectionsExists checks if the collection exists
 func (hanaPool *Hpool) CollectionsExists(ctx context.Context, db, collection string) (bool, error) {
-	sql := fmt.Sprintf("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = '%s' AND table_name = '%s' AND TABLE_TYPE = 'COLLECTION'", db, collection)
+	sql := "SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'"
 
 	var count int
-	err := hanaPool.QueryRowContext(ctx, sql).Scan(&count)
+	err := hanaPool.QueryRowContext(ctx, sql, db, collection).Scan(&count)
 	if err != nil {
 		return false, lazyerrors.Error(err)
 	}
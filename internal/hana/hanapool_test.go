@@ -49,7 +49,7 @@ func TestHanapool(t *testing.T) {
 		mock.ExpectQuery("SELECT TABLE_NAME FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = $1 AND TABLE_TYPE = 'COLLECTION';").WithArgs(args...).WillReturnRows(row)
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 
 		ctx := testutil.Ctx(t)
@@ -86,7 +86,7 @@ func TestHanapool(t *testing.T) {
 		defer db.Close()
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 		ctx := testutil.Ctx(t)
 
@@ -116,7 +116,7 @@ func TestHanapool(t *testing.T) {
 		mock.ExpectExec("CREATE SCHEMA \"database\"").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 		ctx := testutil.Ctx(t)
 		err = h.CreateSchema(ctx, "database")
@@ -140,7 +140,7 @@ func TestHanapool(t *testing.T) {
 		mock.ExpectExec("CREATE COLLECTION \"database\".\"collection\"").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 		ctx := testutil.Ctx(t)
 		err = h.CreateCollection(ctx, "database", "collection")
@@ -170,7 +170,7 @@ func TestHanapool(t *testing.T) {
 		mock.ExpectExec("DROP COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 
 		ctx := testutil.Ctx(t)
@@ -201,7 +201,7 @@ func TestHanapool(t *testing.T) {
 		mock.ExpectExec("DROP SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		h := Hpool{
-			db,
+			DB: db,
 		}
 
 		ctx := testutil.Ctx(t)
@@ -227,7 +227,7 @@ func TestHanapool(t *testing.T) {
 
 		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(row)
 		h := Hpool{
-			db,
+			DB: db,
 		}
 
 		ctx := testutil.Ctx(t)
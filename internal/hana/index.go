@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Index is an index of a collection created by createIndexes, whose keys are fields in ascending or descending order.
+type Index struct {
+	Name string
+	Keys []IndexKey
+}
+
+// IndexKey is a field of an index, which can be a path of embedded fields like "a.b".
+type IndexKey struct {
+	Field      string
+	Descending bool
+}
+
+// IndexBuilder creates indexes one after another on its own connection of the pool,
+// so that the progress SAP HANA reports for the connection is the one of its index builds.
+type IndexBuilder struct {
+	conn *sql.Conn
+
+	// ConnID is the id of the SAP HANA connection, which identifies the progress of the builds.
+	ConnID int64
+}
+
+// NewIndexBuilder takes a connection from the pool for building indexes.
+func (hanaPool *Hpool) NewIndexBuilder(ctx context.Context) (*IndexBuilder, error) {
+	conn, err := hanaPool.conn(ctx)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	b := &IndexBuilder{conn: conn}
+	if err = conn.QueryRowContext(ctx, "SELECT CURRENT_CONNECTION FROM DUMMY").Scan(&b.ConnID); err != nil {
+		conn.Close()
+		return nil, lazyerrors.Error(err)
+	}
+
+	return b, nil
+}
+
+// CreateIndex creates the index of the collection and returns when SAP HANA built it.
+// Canceling the context aborts the build.
+func (b *IndexBuilder) CreateIndex(ctx context.Context, db, collection string, index *Index) error {
+	keys := make([]string, len(index.Keys))
+	for i, key := range index.Keys {
+		keys[i] = indexKeySQL(key)
+	}
+
+	sqlStmt := "CREATE INDEX " + quoteIdentifier(db) + "." + quoteIdentifier(indexName(collection, index.Name)) +
+		" ON " + quoteIdentifier(db) + "." + quoteIdentifier(collection) + " (" + strings.Join(keys, ", ") + ")"
+	if _, err := b.conn.ExecContext(ctx, sqlStmt); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// Close returns the connection of the builder to the pool.
+func (b *IndexBuilder) Close() {
+	b.conn.Close()
+}
+
+// IndexExists returns true if the collection has the index of the name given to createIndexes.
+func (hanaPool *Hpool) IndexExists(ctx context.Context, db, collection, name string) (bool, error) {
+	sqlStmt := "SELECT COUNT(*) FROM \"PUBLIC\".\"INDEXES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ? AND INDEX_NAME = ?"
+
+	var count int
+	if err := hanaPool.QueryRowContext(ctx, sqlStmt, db, collection, indexName(collection, name)).Scan(&count); err != nil {
+		return false, lazyerrors.Error(err)
+	}
+
+	return count > 0, nil
+}
+
+// DropIndex drops the index of the collection with the name given to createIndexes.
+func (hanaPool *Hpool) DropIndex(ctx context.Context, db, collection, name string) error {
+	sqlStmt := "DROP INDEX " + quoteIdentifier(db) + "." + quoteIdentifier(indexName(collection, name))
+	if _, err := hanaPool.ExecContext(ctx, sqlStmt); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// IndexBuildProgress returns the done and the total work of the index build running on the SAP HANA connection,
+// as reported by SAP HANA. It returns ErrNotExist if SAP HANA reports no progress for it,
+// for example while the build has not started to sort the values yet.
+func (hanaPool *Hpool) IndexBuildProgress(ctx context.Context, connID int64) (done, total int64, err error) {
+	sqlStmt := "SELECT CURRENT_PROGRESS, MAX_PROGRESS FROM \"PUBLIC\".\"M_JOB_PROGRESS\" " +
+		"WHERE CONNECTION_ID = ? AND JOB_NAME LIKE '%Index%'"
+
+	err = hanaPool.QueryRowContext(ctx, sqlStmt, connID).Scan(&done, &total)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrNotExist
+	}
+	if err != nil {
+		return 0, 0, lazyerrors.Error(err)
+	}
+
+	return done, total, nil
+}
+
+// indexName returns the name of the SAP HANA index of a collection, whose names are unique in the schema,
+// while MongoDB index names are only unique in the collection.
+func indexName(collection, name string) string {
+	return collection + "." + name
+}
+
+// indexKeySQL returns the SQL of an index key like "a"."b" DESC.
+func indexKeySQL(key IndexKey) string {
+	parts := strings.Split(key.Field, ".")
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+
+	order := " ASC"
+	if key.Descending {
+		order = " DESC"
+	}
+
+	return strings.Join(parts, ".") + order
+}
+
+// quoteIdentifier quotes a name for SQL, doubling its quotes.
+func quoteIdentifier(name string) string {
+	return "\"" + strings.ReplaceAll(name, "\"", "\"\"") + "\""
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// limitConnector limits the connections open at the same time by all pools sharing the slots,
+// so that the pools of many clients do not open more SAP HANA connections than one pool.
+// Opening a connection waits for a free slot until the context is done.
+type limitConnector struct {
+	driver.Connector
+	slots chan struct{}
+}
+
+// Connect implements driver.Connector interface.
+func (c *limitConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+
+	return &limitConn{Conn: conn, slots: c.slots}, nil
+}
+
+// limitConn frees its slot when it is closed.
+// The optional interfaces of the driver connection are passed through, or skipped as database/sql allows.
+type limitConn struct {
+	driver.Conn
+	slots chan struct{}
+	once  sync.Once
+}
+
+// Close implements driver.Conn interface.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { <-c.slots })
+
+	return err
+}
+
+// PrepareContext implements driver.ConnPrepareContext interface.
+func (c *limitConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+
+	return c.Conn.Prepare(query)
+}
+
+// BeginTx implements driver.ConnBeginTx interface.
+func (c *limitConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, lazyerrors.Errorf("SAP HANA driver does not support transaction options")
+	}
+
+	return c.Conn.Begin() //nolint:staticcheck // fallback of database/sql
+}
+
+// QueryContext implements driver.QueryerContext interface.
+func (c *limitConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+// ExecContext implements driver.ExecerContext interface.
+func (c *limitConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, query, args)
+	}
+
+	return nil, driver.ErrSkip
+}
+
+// CheckNamedValue implements driver.NamedValueChecker interface.
+func (c *limitConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+
+	return driver.ErrSkip
+}
+
+// Ping implements driver.Pinger interface.
+func (c *limitConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+
+	return nil
+}
+
+// ResetSession implements driver.SessionResetter interface.
+func (c *limitConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+
+	return nil
+}
+
+// IsValid implements driver.Validator interface.
+func (c *limitConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+
+	return true
+}
+
+// check interfaces
+var (
+	_ driver.Connector          = (*limitConnector)(nil)
+	_ driver.Conn               = (*limitConn)(nil)
+	_ driver.ConnPrepareContext = (*limitConn)(nil)
+	_ driver.ConnBeginTx        = (*limitConn)(nil)
+	_ driver.QueryerContext     = (*limitConn)(nil)
+	_ driver.ExecerContext      = (*limitConn)(nil)
+	_ driver.NamedValueChecker  = (*limitConn)(nil)
+	_ driver.Pinger             = (*limitConn)(nil)
+	_ driver.SessionResetter    = (*limitConn)(nil)
+	_ driver.Validator          = (*limitConn)(nil)
+)
@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// CollectionOptions are the options of a collection set with collMod.
+// They are stored as JSON in the comment of the collection.
+type CollectionOptions struct {
+	ReadOnly     bool          `json:"readOnly,omitempty"`
+	WriteConcern *WriteConcern `json:"writeConcern,omitempty"`
+	TextIndex    *TextIndex    `json:"textIndex,omitempty"`
+	GeoIndexes   []GeoIndex    `json:"geoIndexes,omitempty"`
+	Collation    *Collation    `json:"collation,omitempty"`
+}
+
+// Collation is the default collation of a collection set with create.
+// It orders the strings of find without a collation of its own.
+type Collation struct {
+	Locale          string `json:"locale"`
+	Strength        int32  `json:"strength,omitempty"`
+	CaseLevel       bool   `json:"caseLevel,omitempty"`
+	NumericOrdering bool   `json:"numericOrdering,omitempty"`
+}
+
+// TextIndex describes the text index of a collection given to createIndexes.
+// It is only stored in the options, as there are no full-text indexes on collections,
+// so that hints can name it; $text queries are not supported.
+type TextIndex struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// GeoIndex describes a 2dsphere index of a collection given to createIndexes.
+// It is only stored in the options, as there are no spatial indexes on collections,
+// and geospatial queries convert the GeoJSON values of its fields with the spatial engine.
+type GeoIndex struct {
+	Name   string   `json:"name"`
+	Fields []string `json:"fields"`
+}
+
+// WriteConcern describes the write concern of a write operation.
+type WriteConcern struct {
+	W        any   `json:"w,omitempty"`
+	J        *bool `json:"j,omitempty"`
+	WTimeout int64 `json:"wtimeout,omitempty"`
+}
+
+// CollectionOptions returns the options of a collection.
+// A collection without options or which does not exist has the default options.
+// With an options cache, the options are only read again after its time to live.
+func (hanaPool *Hpool) CollectionOptions(ctx context.Context, db, collection string) (*CollectionOptions, error) {
+	comment, ok := hanaPool.options.get(db, collection)
+	if !ok {
+		sqlStmt := "SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?"
+
+		var nullComment sql.NullString
+		err := hanaPool.QueryRowContext(ctx, sqlStmt, db, collection).Scan(&nullComment)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, lazyerrors.Error(err)
+		}
+
+		comment = nullComment.String
+		hanaPool.options.set(db, collection, comment)
+	}
+
+	opts := new(CollectionOptions)
+	if !strings.HasPrefix(comment, "{") {
+		return opts, nil
+	}
+
+	if err := json.Unmarshal([]byte(comment), opts); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return opts, nil
+}
+
+// SetCollectionOptions stores the options of a collection.
+// DDL statements can't bind parameters, so the comment is an escaped literal.
+func (hanaPool *Hpool) SetCollectionOptions(ctx context.Context, db, collection string, opts *CollectionOptions) error {
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	sqlStmt := "COMMENT ON TABLE " + quoteIdentifier(db) + "." + quoteIdentifier(collection) +
+		" IS '" + strings.ReplaceAll(string(b), "'", "''") + "'"
+	_, err = hanaPool.ExecContext(ctx, sqlStmt)
+	hanaPool.options.remove(db, collection)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// optionsCache caches the comments storing the options of collections, so that writes do not read them every time.
+// A nil cache caches nothing.
+//
+// Options changed by other instances are seen after the time to live,
+// the ones changed or dropped by this instance right away.
+type optionsCache struct {
+	ttl time.Duration
+
+	m       sync.Mutex
+	entries map[string]optionsEntry
+}
+
+// optionsEntry is the cached comment of a collection.
+type optionsEntry struct {
+	comment string
+	expires time.Time
+}
+
+// newOptionsCache returns a cache of the options for the time to live, nil if it is not positive.
+func newOptionsCache(ttl time.Duration) *optionsCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &optionsCache{
+		ttl:     ttl,
+		entries: make(map[string]optionsEntry),
+	}
+}
+
+// get returns the cached comment of the collection, if it did not expire.
+func (c *optionsCache) get(db, collection string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[optionsKey(db, collection)]
+	if !ok || time.Now().After(e.expires) {
+		return "", false
+	}
+
+	return e.comment, true
+}
+
+// set caches the comment of the collection. Expired entries are removed then.
+func (c *optionsCache) set(db, collection, comment string) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[optionsKey(db, collection)] = optionsEntry{comment: comment, expires: now.Add(c.ttl)}
+}
+
+// remove removes the cached comment of the collection, or of all collections of the database if collection is empty.
+func (c *optionsCache) remove(db, collection string) {
+	if c == nil {
+		return
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if collection != "" {
+		delete(c.entries, optionsKey(db, collection))
+		return
+	}
+
+	for k := range c.entries {
+		if strings.HasPrefix(k, db+"\x00") {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// optionsKey returns the key of the cached comment of the collection.
+func optionsKey(db, collection string) string {
+	return db + "\x00" + collection
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectionOptionsCache(t *testing.T) {
+	t.Parallel()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	hanaPool := &Hpool{DB: db, options: newOptionsCache(time.Hour)}
+
+	selectComments := regexp.QuoteMeta(`SELECT COMMENTS FROM "PUBLIC"."TABLES" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?`)
+	mock.ExpectQuery(selectComments).WithArgs("db", "coll").
+		WillReturnRows(sqlmock.NewRows([]string{"COMMENTS"}).AddRow(`{"readOnly":true}`))
+
+	// the second read is cached
+	for i := 0; i < 2; i++ {
+		opts, err := hanaPool.CollectionOptions(ctx, "db", "coll")
+		require.NoError(t, err)
+		assert.Equal(t, &CollectionOptions{ReadOnly: true}, opts)
+	}
+
+	// setting the options removes them from the cache
+	mock.ExpectExec(regexp.QuoteMeta(`COMMENT ON TABLE "db"."coll" IS '{"writeConcern":{"w":"majority"}}'`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, hanaPool.SetCollectionOptions(ctx, "db", "coll", &CollectionOptions{WriteConcern: &WriteConcern{W: "majority"}}))
+
+	mock.ExpectQuery(selectComments).WithArgs("db", "coll").
+		WillReturnRows(sqlmock.NewRows([]string{"COMMENTS"}).AddRow(`{"writeConcern":{"w":"majority"}}`))
+	opts, err := hanaPool.CollectionOptions(ctx, "db", "coll")
+	require.NoError(t, err)
+	assert.Equal(t, &CollectionOptions{WriteConcern: &WriteConcern{W: "majority"}}, opts)
+
+	// collections which do not exist are cached with the default options
+	mock.ExpectQuery(selectComments).WithArgs("db", "missing").WillReturnRows(sqlmock.NewRows([]string{"COMMENTS"}))
+	for i := 0; i < 2; i++ {
+		opts, err = hanaPool.CollectionOptions(ctx, "db", "missing")
+		require.NoError(t, err)
+		assert.Equal(t, new(CollectionOptions), opts)
+	}
+
+	// dropping the database removes the options of its collections
+	mock.ExpectExec(regexp.QuoteMeta(`DROP SCHEMA "db" CASCADE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	require.NoError(t, hanaPool.DropSchema(ctx, "db"))
+	_, ok := hanaPool.options.get("db", "coll")
+	assert.False(t, ok)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
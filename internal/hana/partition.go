@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Partitioning methods supported for collections.
+const (
+	PartitionByHash  = "HASH"
+	PartitionByRange = "RANGE"
+)
+
+// Partitioning describes how a SAP HANA JSON Document Store collection is partitioned.
+type Partitioning struct {
+	Method     string   // PartitionByHash or PartitionByRange
+	Field      string   // partitioning field, e.g. _id
+	Partitions int32    // number of partitions for PartitionByHash
+	Boundaries []string // ascending SQL literals separating the partitions for PartitionByRange
+}
+
+// PartitionStats describes the statistics of one partition of a collection.
+type PartitionStats struct {
+	ID   int32
+	Rows int64
+	Size int64
+}
+
+// SQL returns the PARTITION BY clause.
+// DDL statements can't bind parameters, so the field is quoted and the boundaries are escaped literals.
+func (p *Partitioning) SQL() string {
+	field := quoteIdentifier(p.Field)
+
+	if p.Method == PartitionByHash {
+		return fmt.Sprintf("PARTITION BY HASH (%s) PARTITIONS %d", field, p.Partitions)
+	}
+
+	partitions := make([]string, 0, len(p.Boundaries))
+	for i := 1; i < len(p.Boundaries); i++ {
+		partitions = append(partitions, "PARTITION "+p.Boundaries[i-1]+" <= VALUES < "+p.Boundaries[i])
+	}
+	partitions = append(partitions, "PARTITION OTHERS")
+
+	return fmt.Sprintf("PARTITION BY RANGE (%s) (%s)", field, strings.Join(partitions, ", "))
+}
+
+// CreatePartitionedCollection creates a new SAP HANA JSON Document Store collection with the given partitioning.
+//
+// It returns ErrAlreadyExist if collection already exist.
+func (hanaPool *Hpool) CreatePartitionedCollection(ctx context.Context, db, collection string, p *Partitioning) error {
+	sql := "CREATE COLLECTION " + quoteIdentifier(db) + "." + quoteIdentifier(collection) + " " + p.SQL()
+	_, err := hanaPool.ExecContext(ctx, sql)
+	if err != nil {
+		if strings.Contains(err.Error(), "288: cannot use duplicate table name") {
+			return ErrAlreadyExist
+		}
+	}
+
+	return err
+}
+
+// PartitionCollection changes the partitioning of an existing collection.
+func (hanaPool *Hpool) PartitionCollection(ctx context.Context, db, collection string, p *Partitioning) error {
+	sql := "ALTER COLLECTION " + quoteIdentifier(db) + "." + quoteIdentifier(collection) + " " + p.SQL()
+	if _, err := hanaPool.ExecContext(ctx, sql); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// PartitionStats returns the statistics of every partition of a collection.
+// A collection without partitioning has no partitions.
+func (hanaPool *Hpool) PartitionStats(ctx context.Context, db, collection string) ([]PartitionStats, error) {
+	sql := "SELECT PART_ID, RECORD_COUNT, TABLE_SIZE FROM \"PUBLIC\".\"M_TABLE_PARTITIONS\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ? ORDER BY PART_ID"
+	rows, err := hanaPool.QueryContext(ctx, sql, db, collection)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	res := make([]PartitionStats, 0, 2)
+	for rows.Next() {
+		var stats PartitionStats
+		if err = rows.Scan(&stats.ID, &stats.Rows, &stats.Size); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		res = append(res, stats)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return res, nil
+}
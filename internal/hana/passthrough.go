@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// UserPoolOpener opens a pool of SAP HANA connections authenticated as the user with the password,
+// like the ones presented by a client, so that the privileges and auditing of SAP HANA apply to that user.
+type UserPoolOpener func(ctx context.Context, user, password string) (*sql.DB, error)
+
+// NewUserPoolOpener returns a UserPoolOpener for the connect string, whose user and password are replaced.
+// The credentials are checked by opening the first connection, whose certificate is verified by the TLS options if not nil.
+// With pool options, the connections are sized and reused by them like for CreatePool,
+// and the maximum number of open connections also limits the connections of all pools together.
+func NewUserPoolOpener(connectString string, tlsOpts *TLSOpts, poolOpts *PoolOpts) UserPoolOpener {
+	var slots chan struct{}
+	if poolOpts != nil && poolOpts.MaxOpenConns > 0 {
+		slots = make(chan struct{}, poolOpts.MaxOpenConns)
+	}
+
+	return func(ctx context.Context, user, password string) (*sql.DB, error) {
+		u, err := url.Parse(connectString)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		u.User = url.UserPassword(user, password)
+
+		var db *sql.DB
+		if tlsOpts == nil && poolOpts == nil {
+			if db, err = sql.Open("hdb", u.String()); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		} else {
+			connector, err := openConnector(u.String(), tlsOpts)
+			if err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+			if slots != nil {
+				connector = &limitConnector{Connector: connector, slots: slots}
+			}
+			db = openDB(connector, poolOpts)
+		}
+
+		if err = db.PingContext(ctx); err != nil {
+			db.Close()
+			return nil, lazyerrors.Error(err)
+		}
+
+		return db, nil
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// PoolOpts configure the sizing and lifetime of the pool of SAP HANA connections,
+// instead of the defaults of database/sql.
+type PoolOpts struct {
+	// MaxOpenConns is the maximum number of open connections, unlimited if 0.
+	// Further queries wait for a connection to be returned to the pool.
+	MaxOpenConns int
+
+	// MaxIdleConns is the maximum number of idle connections kept for further queries, none if 0.
+	MaxIdleConns int
+
+	// ConnMaxLifetime is the maximum time a connection is reused, unlimited if 0,
+	// so that connections are reopened after SAP HANA or a load balancer in between closes them.
+	ConnMaxLifetime time.Duration
+
+	// AcquireTimeout is the maximum time to take a connection from the pool, unlimited if 0.
+	// It includes waiting for a connection returned to a full pool and opening a new one with its authentication,
+	// but not running the query on it.
+	AcquireTimeout time.Duration
+
+	// OptionsCacheTTL is the time the options of collections are cached, not cached if 0.
+	// Options changed by other instances are only seen after that time.
+	OptionsCacheTTL time.Duration
+}
+
+// openDB returns the pool of connections of the connector, configured by the options if not nil.
+// database/sql limits the idle connections to the open ones.
+func openDB(connector driver.Connector, opts *PoolOpts) *sql.DB {
+	if opts == nil {
+		return sql.OpenDB(connector)
+	}
+
+	if opts.AcquireTimeout > 0 {
+		connector = &timeoutConnector{Connector: connector, timeout: opts.AcquireTimeout}
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+
+	return db
+}
+
+// openPool returns the pool of connections of the connector, configured by the options if not nil.
+func openPool(connector driver.Connector, opts *PoolOpts) *Hpool {
+	res := &Hpool{DB: openDB(connector, opts)}
+	if opts != nil {
+		res.acquireTimeout = opts.AcquireTimeout
+		res.options = newOptionsCache(opts.OptionsCacheTTL)
+	}
+
+	return res
+}
+
+// conn takes a connection from the pool, waiting at most for the acquire timeout of the pool.
+func (hanaPool *Hpool) conn(ctx context.Context) (*sql.Conn, error) {
+	if hanaPool.acquireTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hanaPool.acquireTimeout)
+		defer cancel()
+	}
+
+	return hanaPool.DB.Conn(ctx)
+}
+
+// releaseConn returns the connection to the pool once the rows or row of a query on it are closed.
+// Conn.Close blocks until then.
+func releaseConn(conn *sql.Conn) {
+	go conn.Close()
+}
+
+// timeoutConnector limits the time to open a connection, including its authentication,
+// also for the connections opened by the pool in the background.
+type timeoutConnector struct {
+	driver.Connector
+	timeout time.Duration
+}
+
+// Connect implements driver.Connector interface.
+func (c *timeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	return c.Connector.Connect(ctx)
+}
+
+// check interfaces
+var (
+	_ driver.Connector = (*timeoutConnector)(nil)
+)
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingConnector opens connections only when the context is done, like an unreachable SAP HANA.
+type blockingConnector struct{}
+
+// Connect implements driver.Connector interface.
+func (blockingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// Driver implements driver.Connector interface.
+func (blockingConnector) Driver() driver.Driver {
+	return nil
+}
+
+func TestOpenDB(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Sizing", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDB(blockingConnector{}, &PoolOpts{MaxOpenConns: 4, MaxIdleConns: 2})
+		defer db.Close()
+
+		assert.Equal(t, 4, db.Stats().MaxOpenConnections)
+	})
+
+	t.Run("AcquireTimeout", func(t *testing.T) {
+		t.Parallel()
+
+		db := openDB(blockingConnector{}, &PoolOpts{AcquireTimeout: 10 * time.Millisecond})
+		defer db.Close()
+
+		err := db.PingContext(context.Background())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	t.Parallel()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.SetMaxOpenConns(1)
+	hanaPool := &Hpool{DB: db, acquireTimeout: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	// waiting for a connection returned to the full pool times out
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+
+	_, err = hanaPool.ExecContext(ctx, "DELETE")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = hanaPool.QueryContext(ctx, "SELECT")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var n int
+	err = hanaPool.QueryRowContext(ctx, "SELECT").Scan(&n)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the connection of a query is returned to the pool once its rows are closed
+	require.NoError(t, conn.Close())
+	mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	mock.ExpectExec("DELETE").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rows, err := hanaPool.QueryContext(ctx, "SELECT")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&n))
+	require.NoError(t, rows.Close())
+
+	_, err = hanaPool.ExecContext(ctx, "DELETE")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// idleConn is a driver connection which is only opened and closed.
+type idleConn struct {
+	driver.Conn
+}
+
+// Close implements driver.Conn interface.
+func (idleConn) Close() error {
+	return nil
+}
+
+// idleConnector opens idle connections.
+type idleConnector struct {
+	blockingConnector
+}
+
+// Connect implements driver.Connector interface.
+func (idleConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return idleConn{}, nil
+}
+
+func TestLimitConnector(t *testing.T) {
+	t.Parallel()
+
+	slots := make(chan struct{}, 1)
+	c1 := &limitConnector{Connector: idleConnector{}, slots: slots}
+	c2 := &limitConnector{Connector: idleConnector{}, slots: slots}
+
+	conn, err := c1.Connect(context.Background())
+	require.NoError(t, err)
+
+	// the connectors share the slots
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c2.Connect(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// closing a connection frees its slot once
+	require.NoError(t, conn.Close())
+	require.NoError(t, conn.Close())
+	conn, err = c2.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, slots, 1)
+	require.NoError(t, conn.Close())
+	assert.Empty(t, slots)
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Privileges checked before accessing collections of other databases,
+// and before every command of users authenticated with their client certificate.
+const (
+	PrivilegeSelect    = "SELECT"
+	PrivilegeInsert    = "INSERT"
+	PrivilegeUpdate    = "UPDATE"
+	PrivilegeDelete    = "DELETE"
+	PrivilegeAlter     = "ALTER"
+	PrivilegeIndex     = "INDEX"
+	PrivilegeDrop      = "DROP"
+	PrivilegeCreateAny = "CREATE ANY"
+)
+
+// System privileges checked before administrative commands of authenticated users.
+const (
+	PrivilegeServiceAdmin = "SERVICE ADMIN"
+	PrivilegeSessionAdmin = "SESSION ADMIN"
+)
+
+// HasPrivilege checks if the user of the context, or else the connected user, has the privilege on the collection,
+// either granted for the collection itself or for the whole schema.
+func (hanaPool *Hpool) HasPrivilege(ctx context.Context, db, collection, privilege string) (bool, error) {
+	user, args := userCondition(ctx)
+	sql := "SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE " + user + " AND SCHEMA_NAME = ? AND (OBJECT_NAME IS NULL OR OBJECT_NAME = ?) AND PRIVILEGE = ? AND IS_VALID = 'TRUE'"
+
+	var count int
+	err := hanaPool.QueryRowContext(ctx, sql, append(args, db, collection, privilege)...).Scan(&count)
+	if err != nil {
+		return false, lazyerrors.Error(err)
+	}
+
+	return count > 0, nil
+}
+
+// HasSystemPrivilege checks if the user of the context, or else the connected user, has the system privilege.
+func (hanaPool *Hpool) HasSystemPrivilege(ctx context.Context, privilege string) (bool, error) {
+	user, args := userCondition(ctx)
+	sql := "SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE " + user + " AND OBJECT_TYPE = 'SYSTEMPRIVILEGE' AND PRIVILEGE = ? AND IS_VALID = 'TRUE'"
+
+	var count int
+	err := hanaPool.QueryRowContext(ctx, sql, append(args, privilege)...).Scan(&count)
+	if err != nil {
+		return false, lazyerrors.Error(err)
+	}
+
+	return count > 0, nil
+}
+
+// Roles returns the roles granted to the user of the context, or else the connected user,
+// directly or through other roles.
+func (hanaPool *Hpool) Roles(ctx context.Context) ([]string, error) {
+	user, args := userCondition(ctx)
+	rows, err := hanaPool.QueryContext(ctx, "SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE "+user, args...)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err = rows.Scan(&role); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redacted replaces secrets in redacted connect strings.
+const redacted = "xxxxx"
+
+// RedactConnectString returns the connect string without secrets, like the password of the user
+// and parameters like proxyPassword, for logs and support bundles.
+// A connect string which can't be parsed is replaced as a whole.
+func RedactConnectString(connectString string) string {
+	if connectString == "" {
+		return ""
+	}
+
+	u, err := url.Parse(connectString)
+	if err != nil {
+		return redacted
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	q := u.Query()
+	for k := range q {
+		if l := strings.ToLower(k); strings.Contains(l, "password") || strings.Contains(l, "secret") || strings.Contains(l, "token") {
+			q.Set(k, redacted)
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
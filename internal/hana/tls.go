@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// tlsCheckTimeout limits the time of the first connection checking the certificate of SAP HANA.
+const tlsCheckTimeout = 30 * time.Second
+
+// TLSOpts configure the verification of the TLS certificates of SAP HANA,
+// instead of the TLS parameters of the connect string.
+type TLSOpts struct {
+	// CAFile is the path to the PEM file of the CA certificates verifying the certificate of SAP HANA,
+	// the ones of the system if empty.
+	CAFile string
+
+	// VerifyHostname checks that the certificate is valid for the host of the connect string.
+	VerifyHostname bool
+
+	// PinnedSHA256 are the base64 SHA-256 hashes of the public keys (SubjectPublicKeyInfo) of certificates,
+	// like the pin-sha256 of HTTP public key pinning. If there are any, the verified chain must contain one of them.
+	PinnedSHA256 []string
+}
+
+// TLSVerificationError is returned by connections to SAP HANA whose certificate is not verified.
+type TLSVerificationError struct {
+	ServerName string
+	Err        error
+}
+
+// Error implements error interface.
+func (e *TLSVerificationError) Error() string {
+	return fmt.Sprintf("TLS certificate of SAP HANA %s is not verified: %s", e.ServerName, e.Err)
+}
+
+// Unwrap implements standard error unwrapping interface.
+func (e *TLSVerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Config returns the TLS configuration of connections to the server, whose certificate is verified by VerifyConnection
+// instead of by crypto/tls, so that it is verified without its hostname and pinned.
+func (o *TLSOpts) Config(serverName string) (*tls.Config, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if o.CAFile != "" {
+		b, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return nil, lazyerrors.Errorf("no CA certificates in %s", o.CAFile)
+		}
+	}
+
+	pins := make(map[string]struct{}, len(o.PinnedSHA256))
+	for _, pin := range o.PinnedSHA256 {
+		b, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(b) != sha256.Size {
+			return nil, lazyerrors.Errorf("pin %q is not a base64 SHA-256 hash", pin)
+		}
+		pins[string(b)] = struct{}{}
+	}
+
+	verifyHostname := o.VerifyHostname
+
+	return &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+
+		//nolint:gosec // the certificate is verified by VerifyConnection
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			err := verifyCertificates(cs, roots, verifyHostname, pins)
+			if err != nil {
+				return &TLSVerificationError{ServerName: cs.ServerName, Err: err}
+			}
+			return nil
+		},
+	}, nil
+}
+
+// verifyCertificates verifies the certificates of the connection against the roots,
+// and checks that one of the verified chains contains a pinned public key if there are pins.
+func verifyCertificates(cs tls.ConnectionState, roots *x509.CertPool, verifyHostname bool, pins map[string]struct{}) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if verifyHostname {
+		opts.DNSName = cs.ServerName
+	}
+
+	chains, err := cs.PeerCertificates[0].Verify(opts)
+	if err != nil {
+		return err
+	}
+
+	if len(pins) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if _, ok := pins[string(sum[:])]; ok {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("no public key of the certificate chain is pinned")
+}
+
+// tlsConfigurer is implemented by the connectors of the go-hdb driver.
+type tlsConfigurer interface {
+	SetTLSConfig(tlsConfig *tls.Config) error
+}
+
+// openConnector returns a connector of the driver for the connect string,
+// whose TLS configuration is replaced by the one of the options if not nil.
+func openConnector(connectString string, tlsOpts *TLSOpts) (driver.Connector, error) {
+	// the database is only opened for the registered driver
+	db, err := sql.Open("hdb", connectString)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	d := db.Driver()
+	db.Close()
+
+	dc, ok := d.(driver.DriverContext)
+	if !ok {
+		return nil, lazyerrors.Errorf("SAP HANA driver %T does not support connectors", d)
+	}
+
+	connector, err := dc.OpenConnector(connectString)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if tlsOpts == nil {
+		return connector, nil
+	}
+
+	configurer, ok := connector.(tlsConfigurer)
+	if !ok {
+		return nil, lazyerrors.Errorf("SAP HANA driver %T does not support TLS configurations", d)
+	}
+
+	u, err := url.Parse(connectString)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	config, err := tlsOpts.Config(u.Hostname())
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err = configurer.SetTLSConfig(config); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return connector, nil
+}
+
+// checkTLS opens a first connection, so that a certificate of SAP HANA which is not verified fails at startup.
+// Other errors, like an unreachable SAP HANA, are only logged, as the connection is retried by later commands.
+func checkTLS(db *sql.DB, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), tlsCheckTimeout)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err == nil {
+		return nil
+	}
+
+	var verr *TLSVerificationError
+	if errors.As(err, &verr) {
+		return verr
+	}
+
+	logger.Warn("Failed to check the TLS certificate of SAP HANA", zap.Error(err))
+
+	return nil
+}
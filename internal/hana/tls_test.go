@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert returns a certificate for the host signed by the parent, or a self-signed CA certificate if it is nil.
+func newTestCert(t *testing.T, host string, parent *tls.Certificate) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: host},
+		DNSNames:              []string{host},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	signer, signerKey := template, any(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+// pin returns the pin of the public key of the certificate.
+func pin(cert *tls.Certificate) string {
+	sum := sha256.Sum256(cert.Leaf.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// handshake returns the error of the TLS handshake of the client with the configuration to a server with the certificate.
+func handshake(t *testing.T, config *tls.Config, cert *tls.Certificate) error {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+
+	go func() {
+		defer serverConn.Close()
+		_ = tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{*cert}}).Handshake()
+	}()
+
+	return tls.Client(clientConn, config).Handshake()
+}
+
+func TestTLSOpts(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "hana.example.com", ca)
+	other := newTestCert(t, "other", nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate[0]}), 0o600))
+
+	for name, tc := range map[string]struct {
+		opts       TLSOpts
+		serverName string
+		err        string
+	}{
+		"Valid": {
+			opts:       TLSOpts{CAFile: caFile, VerifyHostname: true},
+			serverName: "hana.example.com",
+		},
+		"Hostname": {
+			opts:       TLSOpts{CAFile: caFile, VerifyHostname: true},
+			serverName: "other.example.com",
+			err:        "x509: certificate is valid for hana.example.com, not other.example.com",
+		},
+		"NoHostname": {
+			opts:       TLSOpts{CAFile: caFile},
+			serverName: "other.example.com",
+		},
+		"UnknownCA": {
+			opts:       TLSOpts{VerifyHostname: true},
+			serverName: "hana.example.com",
+			err:        "x509: certificate signed by unknown authority",
+		},
+		"PinnedCA": {
+			opts:       TLSOpts{CAFile: caFile, VerifyHostname: true, PinnedSHA256: []string{pin(other), pin(ca)}},
+			serverName: "hana.example.com",
+		},
+		"NotPinned": {
+			opts:       TLSOpts{CAFile: caFile, VerifyHostname: true, PinnedSHA256: []string{pin(other)}},
+			serverName: "hana.example.com",
+			err:        "no public key of the certificate chain is pinned",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			config, err := tc.opts.Config(tc.serverName)
+			require.NoError(t, err)
+
+			err = handshake(t, config, server)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var verr *TLSVerificationError
+			require.ErrorAs(t, err, &verr)
+			assert.Equal(t, tc.serverName, verr.ServerName)
+			assert.Contains(t, verr.Err.Error(), tc.err)
+		})
+	}
+
+	_, err := (&TLSOpts{PinnedSHA256: []string{"abc"}}).Config("hana.example.com")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `pin "abc" is not a base64 SHA-256 hash`)
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// tokenRefreshMargin is how long before their expiry tokens are refreshed,
+// so that connections opened shortly before do not fail.
+const tokenRefreshMargin = time.Minute
+
+// tokenTimeout limits the time to get a token for a new connection, like from an unresponsive token endpoint.
+const tokenTimeout = 30 * time.Second
+
+// TokenSource returns the JWT tokens authenticating the SAP HANA connections, like the ones of SAP HANA Cloud,
+// and refreshes them when they expire.
+type TokenSource struct {
+	// fetch returns a new token and its expiry, zero if unknown
+	fetch func(ctx context.Context) (string, time.Time, error)
+
+	m      sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewFileTokenSource returns a TokenSource reading the token from the file, like one mounted by Kubernetes.
+// The file is read again when the token expires, or for every connection if it is not a JWT token with an expiry,
+// so that a token rotated by another process is used.
+func NewFileTokenSource(path string) *TokenSource {
+	return &TokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return "", time.Time{}, lazyerrors.Error(err)
+			}
+
+			token := strings.TrimSpace(string(b))
+			if token == "" {
+				return "", time.Time{}, lazyerrors.Errorf("token file %s is empty", path)
+			}
+
+			return token, tokenExpiry(token), nil
+		},
+	}
+}
+
+// NewOAuthTokenSource returns a TokenSource requesting tokens from the OAuth 2.0 token endpoint
+// with the client credentials grant, like the one of an XSUAA service instance.
+func NewOAuthTokenSource(tokenURL, clientID, clientSecret string, client *http.Client) *TokenSource {
+	return &TokenSource{
+		fetch: func(ctx context.Context) (string, time.Time, error) {
+			form := url.Values{"grant_type": {"client_credentials"}}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+			if err != nil {
+				return "", time.Time{}, lazyerrors.Error(err)
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Accept", "application/json")
+			req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+			start := time.Now()
+			resp, err := client.Do(req)
+			if err != nil {
+				return "", time.Time{}, lazyerrors.Error(err)
+			}
+			defer resp.Body.Close()
+
+			b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+			if err != nil {
+				return "", time.Time{}, lazyerrors.Error(err)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return "", time.Time{}, lazyerrors.Errorf("token endpoint returned %s", resp.Status)
+			}
+
+			var res struct {
+				AccessToken string `json:"access_token"`
+				ExpiresIn   int64  `json:"expires_in"`
+			}
+			if err = json.Unmarshal(b, &res); err != nil {
+				return "", time.Time{}, lazyerrors.Error(err)
+			}
+			if res.AccessToken == "" {
+				return "", time.Time{}, lazyerrors.New("token endpoint returned no access token")
+			}
+
+			expiry := tokenExpiry(res.AccessToken)
+			if res.ExpiresIn > 0 {
+				expiry = start.Add(time.Duration(res.ExpiresIn) * time.Second)
+			}
+
+			return res.AccessToken, expiry, nil
+		},
+	}
+}
+
+// Token returns the current token, or a new one if it expires within the refresh margin or its expiry is unknown.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.token != "" && !s.expiry.IsZero() && time.Until(s.expiry) > tokenRefreshMargin {
+		return s.token, nil
+	}
+
+	token, expiry, err := s.fetch(ctx)
+	if err != nil {
+		return "", lazyerrors.Error(err)
+	}
+
+	s.token, s.expiry = token, expiry
+
+	return token, nil
+}
+
+// tokenExpiry returns the expiry of the exp claim of a JWT token, or zero if it has none.
+// The token is not verified, that is done by SAP HANA.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err = json.Unmarshal(b, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
+
+// tokenConnector is implemented by the connectors of the go-hdb driver, which authenticate with the JWT method
+// with the given token, and call the refresh function for a new token when the authentication with the previous one fails.
+type tokenConnector interface {
+	SetToken(token string)
+	SetRefreshToken(refreshToken func() (token string, ok bool))
+}
+
+// CreateTokenPool sets up the connection to SAP HANA JSON Document Store authenticated with the tokens of the source
+// instead of the user and password of the connect string, which must have none.
+// With TLS and pool options, the certificate of SAP HANA is verified and the connections are sized by them like for CreatePool.
+//
+// The connector is seeded with the current token, so that connections authenticate with it right away.
+// When it is rejected, for example because it expired, the driver asks the source for a new one.
+func CreateTokenPool(connectString string, tlsOpts *TLSOpts, poolOpts *PoolOpts, tokens *TokenSource, logger *zap.Logger) (*Hpool, error) {
+	if connectString == "" {
+		return nil, lazyerrors.Errorf("No connect string for SAP HANA Cloud instance given")
+	}
+
+	connector, err := openConnector(connectString, tlsOpts)
+	if err != nil {
+		return nil, fmt.Errorf("hanapool.CreateTokenPool: %w", err)
+	}
+
+	tc, ok := connector.(tokenConnector)
+	if !ok {
+		return nil, lazyerrors.Errorf("hanapool.CreateTokenPool: SAP HANA driver %T does not support JWT tokens", connector.Driver())
+	}
+
+	token, err := currentToken(tokens)
+	if err != nil {
+		return nil, fmt.Errorf("hanapool.CreateTokenPool: %w", err)
+	}
+	tc.SetToken(token)
+
+	tc.SetRefreshToken(func() (string, bool) {
+		token, err := currentToken(tokens)
+		if err != nil {
+			logger.Error("Failed to get SAP HANA token", zap.Error(err))
+			return "", false
+		}
+
+		return token, true
+	})
+
+	res := openPool(connector, poolOpts)
+
+	if tlsOpts != nil {
+		if err = checkTLS(res.DB, logger); err != nil {
+			res.Close()
+			return nil, fmt.Errorf("hanapool.CreateTokenPool: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// currentToken returns the current token of the source, waiting at most tokenTimeout for it.
+func currentToken(tokens *TokenSource) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenTimeout)
+	defer cancel()
+
+	return tokens.Token(ctx)
+}
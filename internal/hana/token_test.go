@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWT returns an unsigned JWT token with the exp claim.
+func testJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJub25lIn0." + payload + ".sig"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	t.Parallel()
+
+	exp := time.Unix(1700000000, 0)
+	assert.Equal(t, exp, tokenExpiry(testJWT(exp)))
+	assert.True(t, tokenExpiry("opaque").IsZero())
+	assert.True(t, tokenExpiry("a.b.c").IsZero())
+}
+
+func TestFileTokenSource(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "token")
+	s := NewFileTokenSource(path)
+
+	_, err := s.Token(ctx)
+	require.Error(t, err)
+
+	// a valid token is cached until shortly before its expiry
+	valid := testJWT(time.Now().Add(time.Hour))
+	require.NoError(t, os.WriteFile(path, []byte(valid+"\n"), 0o600))
+	token, err := s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, valid, token)
+
+	require.NoError(t, os.WriteFile(path, []byte("rotated"), 0o600))
+	token, err = s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, valid, token)
+
+	// a token without expiry is read again every time
+	s = NewFileTokenSource(path)
+	token, err = s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", token)
+
+	require.NoError(t, os.WriteFile(path, []byte("rotated again"), 0o600))
+	token, err = s.Token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated again", token)
+}
+
+func TestOAuthTokenSource(t *testing.T) {
+	t.Parallel()
+
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "client" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+
+		// the first token expires within the refresh margin, so it is refreshed
+		expiresIn := 30
+		if n > 1 {
+			expiresIn = 3600
+		}
+		fmt.Fprintf(w, `{"access_token":"token%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	s := NewOAuthTokenSource(ts.URL, "client", "secret", ts.Client())
+
+	for _, expected := range []string{"token1", "token2", "token2"} {
+		token, err := s.Token(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, expected, token)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	_, err := NewOAuthTokenSource(ts.URL, "client", "wrong", ts.Client()).Token(ctx)
+	require.ErrorContains(t, err, "401 Unauthorized")
+}
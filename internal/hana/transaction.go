@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// PinnedTx is a transaction of a client session.
+// It is pinned to one connection of the pool until it is committed or rolled back.
+type PinnedTx struct {
+	conn *sql.Conn
+	tx   *sql.Tx
+}
+
+type pinnedTxKey struct{}
+
+// BeginPinnedTx takes a connection from the pool and starts a transaction on it.
+func (hanaPool *Hpool) BeginPinnedTx(ctx context.Context) (*PinnedTx, error) {
+	conn, err := hanaPool.conn(ctx)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	// the transaction must outlive the request which started it
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		conn.Close()
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &PinnedTx{conn: conn, tx: tx}, nil
+}
+
+// Commit commits the transaction and returns the connection to the pool.
+func (p *PinnedTx) Commit() error {
+	err := p.tx.Commit()
+	p.conn.Close()
+
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// Rollback rolls the transaction back and returns the connection to the pool.
+func (p *PinnedTx) Rollback() error {
+	err := p.tx.Rollback()
+	p.conn.Close()
+
+	if err != nil && err != sql.ErrTxDone {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// InTx runs f with a context in which all statements of the pool run in one transaction,
+// which is committed if f succeeds and rolled back otherwise.
+// In the transaction of a client session, f runs in that transaction, which the session commits.
+func (hanaPool *Hpool) InTx(ctx context.Context, f func(ctx context.Context) error) error {
+	if InTransaction(ctx) {
+		return f(ctx)
+	}
+
+	p, err := hanaPool.BeginPinnedTx(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = f(WithPinnedTx(ctx, p)); err != nil {
+		_ = p.Rollback()
+		return err
+	}
+
+	return p.Commit()
+}
+
+// InDDLTx runs f like InTx, but the DDL statements of f are committed with the transaction instead of each on its own,
+// so that for example a collection is only created together with its options.
+// The setting of the session is restored before the connection is returned to the pool.
+func (hanaPool *Hpool) InDDLTx(ctx context.Context, f func(ctx context.Context) error) error {
+	return hanaPool.InTx(ctx, func(ctx context.Context) error {
+		if _, err := hanaPool.ExecContext(ctx, "SET TRANSACTION AUTOCOMMIT DDL OFF"); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		err := f(ctx)
+
+		if _, resetErr := hanaPool.ExecContext(ctx, "SET TRANSACTION AUTOCOMMIT DDL ON"); resetErr != nil && err == nil {
+			err = lazyerrors.Error(resetErr)
+		}
+
+		return err
+	})
+}
+
+// WithPinnedTx returns a context in which all statements of the pool run in the given transaction.
+func WithPinnedTx(ctx context.Context, p *PinnedTx) context.Context {
+	return context.WithValue(ctx, pinnedTxKey{}, p)
+}
+
+// InTransaction returns true if statements run in the transaction of a client session.
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(pinnedTxKey{}).(*PinnedTx)
+	return ok
+}
+
+// QueryContext runs the query in the pinned transaction of the context if there is one,
+// with the comment of the context, and adds it to the SQL capture of the context.
+func (hanaPool *Hpool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	captureSQL(ctx, query)
+	query = commentSQL(ctx, query)
+
+	if p, ok := ctx.Value(pinnedTxKey{}).(*PinnedTx); ok {
+		return p.tx.QueryContext(ctx, query, args...)
+	}
+
+	if hanaPool.acquireTimeout == 0 {
+		return hanaPool.DB.QueryContext(ctx, query, args...)
+	}
+
+	conn, err := hanaPool.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseConn(conn)
+
+	return conn.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext runs the query in the pinned transaction of the context if there is one,
+// with the comment of the context, and adds it to the SQL capture of the context.
+func (hanaPool *Hpool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	captureSQL(ctx, query)
+	query = commentSQL(ctx, query)
+
+	if p, ok := ctx.Value(pinnedTxKey{}).(*PinnedTx); ok {
+		return p.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	if hanaPool.acquireTimeout == 0 {
+		return hanaPool.DB.QueryRowContext(ctx, query, args...)
+	}
+
+	conn, err := hanaPool.conn(ctx)
+	if err != nil {
+		// sql.Row can only be made by a query, so the expired context makes Scan return the timeout
+		expired, cancel := context.WithDeadline(ctx, time.Time{})
+		defer cancel()
+
+		return hanaPool.DB.QueryRowContext(expired, query, args...)
+	}
+	defer releaseConn(conn)
+
+	return conn.QueryRowContext(ctx, query, args...)
+}
+
+// ExecContext runs the statement in the pinned transaction of the context if there is one,
+// with the comment of the context, and adds it to the SQL capture of the context.
+func (hanaPool *Hpool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	captureSQL(ctx, query)
+	query = commentSQL(ctx, query)
+
+	if p, ok := ctx.Value(pinnedTxKey{}).(*PinnedTx); ok {
+		return p.tx.ExecContext(ctx, query, args...)
+	}
+
+	if hanaPool.acquireTimeout == 0 {
+		return hanaPool.DB.ExecContext(ctx, query, args...)
+	}
+
+	conn, err := hanaPool.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext prepares the statement in the pinned transaction of the context,
+// with the comment of the context, and adds it to the SQL capture of the context.
+// Statements are only prepared in transactions, as they must run on the connection they were prepared on.
+func (hanaPool *Hpool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	p, ok := ctx.Value(pinnedTxKey{}).(*PinnedTx)
+	if !ok {
+		return nil, lazyerrors.Errorf("statement prepared outside of a transaction: %s", query)
+	}
+
+	captureSQL(ctx, query)
+	query = commentSQL(ctx, query)
+
+	return p.tx.PrepareContext(ctx, query)
+}
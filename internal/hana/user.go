@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package hana
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+type userKey struct{}
+
+// WithUser returns a context with the SAP HANA user of the client, like the user mapped to its TLS client certificate.
+// Privileges and roles are then checked for this user instead of the connected user of the pool.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// User returns the SAP HANA user of the client of the context, or an empty string without one.
+func User(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// userCondition returns the condition on the USER_NAME column selecting the user of the context
+// or the connected user, with its arguments.
+func userCondition(ctx context.Context) (string, []any) {
+	if user := User(ctx); user != "" {
+		return "USER_NAME = ?", []any{user}
+	}
+
+	return "USER_NAME = CURRENT_USER", nil
+}
+
+// X509User returns the SAP HANA user with the X.509 identity of the subject and issuer of a certificate,
+// like "CN=app,O=example" issued by "CN=rootCA,O=example", or an empty string if there is none.
+// The issuer is the one of the mapping, or else the one of its X.509 provider.
+// Spaces after the commas separating the attributes of the subjects and issuers of the mappings are ignored.
+// It is an error if several users have the identity, as then it is ambiguous which one the client is.
+func (hanaPool *Hpool) X509User(ctx context.Context, subject, issuer string) (string, error) {
+	sql := "SELECT DISTINCT M.USER_NAME FROM \"SYS\".\"X509_USER_MAPPINGS\" AS M " +
+		"LEFT OUTER JOIN \"SYS\".\"X509_PROVIDERS\" AS P ON P.X509_PROVIDER_NAME = M.X509_PROVIDER_NAME " +
+		"WHERE REPLACE(M.SUBJECT_NAME, ', ', ',') = ? AND REPLACE(COALESCE(M.ISSUER_NAME, P.ISSUER_NAME), ', ', ',') = ?"
+	rows, err := hanaPool.QueryContext(ctx, sql, subject, issuer)
+	if err != nil {
+		return "", lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	var users []string
+	for rows.Next() {
+		var user string
+		if err = rows.Scan(&user); err != nil {
+			return "", lazyerrors.Error(err)
+		}
+		users = append(users, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", lazyerrors.Error(err)
+	}
+
+	switch len(users) {
+	case 0:
+		return "", nil
+	case 1:
+		return users[0], nil
+	default:
+		return "", lazyerrors.Errorf("subject %q is mapped to several users %q", subject, users)
+	}
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+)
+
+// authCommands are the commands of the handshake allowed on unauthenticated connections with required authentication,
+// like in mongod with --auth.
+var authCommands = map[string]struct{}{
+	"authenticate": {},
+	"buildInfo":    {},
+	"buildinfo":    {},
+	"hello":        {},
+	"isMaster":     {},
+	"ismaster":     {},
+	"saslContinue": {},
+	"saslStart":    {},
+}
+
+// checkAuth returns Unauthorized if authentication is required and the connection is not authenticated yet,
+// unless the command is part of the handshake.
+func (h *Handler) checkAuth(command string) error {
+	if !h.requireAuth || h.authenticated {
+		return nil
+	}
+
+	if _, ok := authCommands[command]; ok {
+		return nil
+	}
+
+	return common.NewErrorMessage(common.ErrUnauthorized, "command %s requires authentication", command)
+}
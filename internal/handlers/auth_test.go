@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestRequireAuth(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+	handler.requireAuth = true
+	handler.clientIdentity = "CN=app,O=example"
+	handler.clientIssuer = "CN=rootCA,O=example"
+
+	unauthorized := types.MustMakeDocument(
+		"ok", float64(0),
+		"errmsg", "command whatsmyuri requires authentication",
+		"code", int32(13),
+		"codeName", "Unauthorized",
+	)
+	assert.Equal(t, unauthorized, handle(ctx, t, handler, types.MustMakeDocument("whatsmyuri", int32(1), "$db", "admin")))
+
+	// the handshake is allowed
+	res := handle(ctx, t, handler, types.MustMakeDocument("hello", int32(1), "$db", "admin"))
+	assert.Equal(t, float64(1), res.Map()["ok"])
+
+	// legacy commands are rejected too
+	_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{OpCode: wire.OP_QUERY}, &wire.OpQuery{
+		FullCollectionName: "admin.$cmd",
+		Query:              types.MustMakeDocument("getlasterror", int32(1)),
+	})
+	reply := resBody.(*wire.OpReply)
+	require.Len(t, reply.Documents, 1)
+	assert.Equal(t, int32(13), reply.Documents[0].Map()["code"])
+
+	for name, tc := range map[string]struct {
+		request types.Document
+		errmsg  string
+	}{
+		"Mechanism": {
+			request: types.MustMakeDocument("authenticate", int32(1), "mechanism", "PLAIN", "$db", "$external"),
+			errmsg:  `authentication mechanism "PLAIN" is not supported, only MONGODB-X509`,
+		},
+		"Database": {
+			request: types.MustMakeDocument("authenticate", int32(1), "mechanism", "MONGODB-X509", "$db", "admin"),
+			errmsg:  "MONGODB-X509 authentication must use the $external database",
+		},
+		"User": {
+			request: types.MustMakeDocument("authenticate", int32(1), "mechanism", "MONGODB-X509", "user", "CN=other", "$db", "$external"),
+			errmsg:  `user "CN=other" does not match the subject of the TLS client certificate`,
+		},
+	} {
+		res = handle(ctx, t, handler, tc.request)
+		assert.Equal(t, types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", tc.errmsg,
+			"code", int32(18),
+			"codeName", "AuthenticationFailed",
+		), res, name)
+	}
+
+	authenticate := types.MustMakeDocument(
+		"authenticate", int32(1), "mechanism", "MONGODB-X509", "user", "CN=app,O=example", "$db", "$external",
+	)
+	mappingSQL := "SELECT DISTINCT M.USER_NAME FROM \"SYS\".\"X509_USER_MAPPINGS\" AS M " +
+		"LEFT OUTER JOIN \"SYS\".\"X509_PROVIDERS\" AS P ON P.X509_PROVIDER_NAME = M.X509_PROVIDER_NAME " +
+		"WHERE REPLACE(M.SUBJECT_NAME, ', ', ',') = ? AND REPLACE(COALESCE(M.ISSUER_NAME, P.ISSUER_NAME), ', ', ',') = ?"
+
+	// the subject and issuer must be mapped to a SAP HANA user
+	mock.ExpectQuery(mappingSQL).WithArgs("CN=app,O=example", "CN=rootCA,O=example").WillReturnRows(mock.NewRows([]string{"USER_NAME"}))
+	res = handle(ctx, t, handler, authenticate)
+	assert.Equal(t, "no SAP HANA user is mapped to the subject of the TLS client certificate", res.Map()["errmsg"])
+
+	mock.ExpectQuery(mappingSQL).WithArgs("CN=app,O=example", "CN=rootCA,O=example").WillReturnRows(mock.NewRows([]string{"USER_NAME"}).AddRow("APP"))
+	mock.ExpectQuery("SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE USER_NAME = ?").
+		WithArgs("APP").
+		WillReturnRows(mock.NewRows([]string{"ROLE_NAME"}).AddRow("READER"))
+	res = handle(ctx, t, handler, authenticate)
+	expected := types.MustMakeDocument(
+		"dbname", "$external",
+		"user", "CN=app,O=example",
+		"ok", float64(1),
+	)
+	assert.Equal(t, expected, res)
+
+	res = handle(ctx, t, handler, types.MustMakeDocument("whatsmyuri", int32(1), "$db", "admin"))
+	assert.Equal(t, float64(1), res.Map()["ok"])
+
+	res = handle(ctx, t, handler, types.MustMakeDocument("connectionStatus", int32(1), "$db", "admin"))
+	expected = types.MustMakeDocument(
+		"authenticatedUsers", types.MustNewArray(types.MustMakeDocument("user", "CN=app,O=example", "db", "$external")),
+		"authenticatedUserRoles", types.MustNewArray(types.MustMakeDocument("role", "READER", "db", "$external")),
+		"authenticatedUserPrivileges", types.MustNewArray(),
+	)
+	assert.Equal(t, expected, res.Map()["authInfo"])
+
+	// the commands need the privileges of the user on their collection
+	privilegeSQL := "SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE USER_NAME = ? AND SCHEMA_NAME = ? " +
+		"AND (OBJECT_NAME IS NULL OR OBJECT_NAME = ?) AND PRIVILEGE = ? AND IS_VALID = 'TRUE'"
+	mock.ExpectQuery(privilegeSQL).WithArgs("APP", "db", "orders", "DELETE").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	res = handle(ctx, t, handler, types.MustMakeDocument(
+		"delete", "orders", "deletes", types.MustNewArray(), "$db", "db",
+	))
+	assert.Equal(t, types.MustMakeDocument(
+		"ok", float64(0),
+		"errmsg", "not authorized on db to execute command delete, which needs the privilege DELETE",
+		"code", int32(13),
+		"codeName", "Unauthorized",
+	), res)
+
+	mock.ExpectQuery(privilegeSQL).WithArgs("APP", "db", "orders", "SELECT").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(privilegeSQL).WithArgs("APP", "db", "orders", "UPDATE").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(0))
+	res = handle(ctx, t, handler, types.MustMakeDocument(
+		"explain", types.MustMakeDocument("findAndModify", "orders", "update", types.MustMakeDocument()),
+		"$db", "db",
+	))
+	assert.Equal(t, "not authorized on db to execute command findAndModify, which needs the privilege UPDATE", res.Map()["errmsg"])
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireAuthWithoutCertificate(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, nil)
+	handler.requireAuth = true
+
+	res := handle(ctx, t, handler, types.MustMakeDocument("authenticate", int32(1), "mechanism", "MONGODB-X509", "$db", "$external"))
+	assert.Equal(t, "MONGODB-X509 authentication requires a TLS client certificate", res.Map()["errmsg"])
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// captureMaxArrayLen is the maximum number of elements of an array in the capture,
+// like the documents of a batch; further elements are left out.
+const captureMaxArrayLen = 3
+
+// captureReplyFields are the top-level reply fields whose values are kept in the capture.
+var captureReplyFields = []string{"ok", "code", "codeName"}
+
+// Capture writes the commands of all connections with the SAP HANA statements run for them and their replies
+// as JSON lines, for the offline analysis of the MongoDB features a workload needs.
+//
+// The capture is sanitized: all values are replaced by their BSON type, like "string" or "int",
+// except for the command name, the database and the status of the reply,
+// and the literals of the statements are replaced by "?".
+type Capture struct {
+	m   sync.Mutex
+	enc *json.Encoder
+}
+
+// captureRecord is a command in the capture.
+type captureRecord struct {
+	Time           time.Time `json:"time"`
+	Remote         string    `json:"remote"`
+	Command        string    `json:"command"`
+	DB             string    `json:"db,omitempty"`
+	Request        any       `json:"request"`
+	SQL            []string  `json:"sql,omitempty"`
+	Reply          any       `json:"reply,omitempty"`
+	DurationMillis int64     `json:"durationMillis"`
+}
+
+// NewCapture creates a new Capture writing to w.
+func NewCapture(w io.Writer) *Capture {
+	return &Capture{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// write writes the record as a JSON line.
+func (c *Capture) write(record *captureRecord) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if err := c.enc.Encode(record); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// newCaptureRecord returns the sanitized record of the command of an OP_MSG or OP_QUERY request,
+// or nil for other requests.
+func newCaptureRecord(reqBody, resBody wire.MsgBody, statements []string) *captureRecord {
+	var document types.Document
+	var db string
+	switch body := reqBody.(type) {
+	case *wire.OpMsg:
+		var err error
+		if document, err = body.Document(); err != nil {
+			return nil
+		}
+		db, _ = document.Map()["$db"].(string)
+
+	case *wire.OpQuery:
+		document = body.Query
+		db, _, _ = strings.Cut(body.FullCollectionName, ".")
+
+	default:
+		return nil
+	}
+
+	record := &captureRecord{
+		Time:    time.Now().UTC(),
+		Command: document.Command(),
+		DB:      db,
+		Request: captureDocument(document, document.Command(), "$db"),
+		SQL:     statements,
+	}
+
+	switch body := resBody.(type) {
+	case *wire.OpMsg:
+		if reply, err := body.Document(); err == nil {
+			record.Reply = captureDocument(reply, captureReplyFields...)
+		}
+	case *wire.OpReply:
+		if len(body.Documents) > 0 {
+			record.Reply = captureDocument(body.Documents[0], captureReplyFields...)
+		}
+	}
+
+	return record
+}
+
+// captureDocument returns the shape of the document, keeping the values of the given top-level fields
+// if they are strings, numbers or booleans.
+func captureDocument(document types.Document, keep ...string) map[string]any {
+	m := make(map[string]any, len(document.Keys()))
+	for k, v := range document.Map() {
+		m[k] = captureValue(v)
+	}
+
+	for _, k := range keep {
+		switch v := document.Map()[k].(type) {
+		case string, float64, int32, int64, bool:
+			m[k] = v
+		}
+	}
+
+	return m
+}
+
+// captureValue returns the shape of the value: documents and arrays with the shapes of their values,
+// and the BSON type alias of other values, like "string" or "int".
+func captureValue(v any) any {
+	switch v := v.(type) {
+	case types.Document:
+		return captureDocument(v)
+	case *types.Array:
+		n := v.Len()
+		if n > captureMaxArrayLen {
+			n = captureMaxArrayLen
+		}
+		s := make([]any, n)
+		for i := range s {
+			e, _ := v.Get(i)
+			s[i] = captureValue(e)
+		}
+		return s
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case types.Binary:
+		return "binData"
+	case types.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case nil:
+		return "null"
+	case types.Regex:
+		return "regex"
+	case types.Code:
+		return "javascript"
+	case types.CodeWithScope:
+		return "javascriptWithScope"
+	case int32:
+		return "int"
+	case types.Timestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	default:
+		return "unknown"
+	}
+}
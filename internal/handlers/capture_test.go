@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestCapture(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+	var buf bytes.Buffer
+	handler.capture = NewCapture(&buf)
+	handler.peerAddr = "127.0.0.1:12345"
+
+	mock.ExpectExec("DROP COLLECTION \"testDatabase\".\"newTest\"").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	handle(ctx, t, handler, types.MustMakeDocument("drop", "newTest", "$db", "testDatabase"))
+	handle(ctx, t, handler, types.MustMakeDocument(
+		"drop", "newTest",
+		"writeConcern", types.MustMakeDocument("w", "majority", "j", true),
+		"$db", "testDatabase",
+	))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	dec := json.NewDecoder(&buf)
+
+	var record map[string]any
+	require.NoError(t, dec.Decode(&record))
+	assert.Equal(t, "127.0.0.1:12345", record["remote"])
+	assert.Equal(t, "drop", record["command"])
+	assert.Equal(t, "testDatabase", record["db"])
+	assert.Equal(t, map[string]any{"drop": "newTest", "$db": "testDatabase"}, record["request"])
+	assert.Equal(t, []any{`DROP COLLECTION "testDatabase"."newTest"`}, record["sql"])
+	assert.Equal(t, map[string]any{"nIndexesWas": "int", "ns": "string", "ok": float64(1)}, record["reply"])
+
+	// unsupported features are found by the code of the reply
+	record = nil
+	require.NoError(t, dec.Decode(&record))
+	assert.Equal(t, map[string]any{
+		"drop":         "newTest",
+		"writeConcern": map[string]any{"w": "string", "j": "bool"},
+		"$db":          "testDatabase",
+	}, record["request"])
+	assert.Nil(t, record["sql"])
+	assert.Equal(t, map[string]any{
+		"ok":       float64(0),
+		"errmsg":   "string",
+		"code":     float64(238),
+		"codeName": "NotImplemented",
+	}, record["reply"])
+}
+
+func TestNewCaptureRecord(t *testing.T) {
+	t.Parallel()
+
+	query := &wire.OpQuery{
+		FullCollectionName: "admin.$cmd",
+		Query:              types.MustMakeDocument("isMaster", int32(1), "client", types.MustMakeDocument("name", "app")),
+	}
+	batch := types.MustNewArray("a", int64(1), time.Now(), nil, types.ObjectID{})
+	reply := &wire.OpReply{Documents: []types.Document{types.MustMakeDocument(
+		"ismaster", true, "hosts", batch, "ok", float64(0), "code", int32(13), "codeName", "Unauthorized",
+	)}}
+
+	record := newCaptureRecord(query, reply, nil)
+	require.NotNil(t, record)
+	assert.Equal(t, "isMaster", record.Command)
+	assert.Equal(t, "admin", record.DB)
+	assert.Equal(t, map[string]any{"isMaster": int32(1), "client": map[string]any{"name": "string"}}, record.Request)
+	assert.Equal(t, map[string]any{
+		"ismaster": "bool",
+		"hosts":    []any{"string", "long", "date"},
+		"ok":       float64(0),
+		"code":     int32(13),
+		"codeName": "Unauthorized",
+	}, record.Reply)
+
+	assert.Nil(t, newCaptureRecord(&wire.OpGetMore{}, nil, nil))
+}
@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// X509Mechanism is the authentication mechanism of users identified by their TLS client certificate.
+const X509Mechanism = "MONGODB-X509"
+
+// externalDB is the database of users authenticated outside of the layer, like by their client certificate.
+const externalDB = "$external"
+
+type clientIdentityKey struct{}
+
+// WithClientIdentity returns a context with the identity of the client,
+// which is the subject of its TLS client certificate.
+func WithClientIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, clientIdentityKey{}, identity)
+}
+
+// ClientIdentity returns the identity of the client of the context, like the subject "CN=app,O=example" of its TLS certificate,
+// or an empty string without one. Middlewares may use it to authorize the commands of the connection.
+func ClientIdentity(ctx context.Context) string {
+	identity, _ := ctx.Value(clientIdentityKey{}).(string)
+	return identity
+}
+
+// setSASLSupportedMechs sets the saslSupportedMechs of the hello reply if the request asks for the mechanisms of a user.
+// Only the user of the client certificate, like "$external.CN=app,O=example", has a mechanism, which is MONGODB-X509.
+func (h *Handler) setSASLSupportedMechs(reply *types.Document, request types.Document) error {
+	v, ok := request.Map()["saslSupportedMechs"]
+	if !ok {
+		return nil
+	}
+
+	user, ok := v.(string)
+	if !ok {
+		return common.NewErrorMessage(common.ErrTypeMismatch, "saslSupportedMechs must be a string. Got instead: %T", v)
+	}
+
+	db, name, ok := strings.Cut(user, ".")
+	if !ok {
+		return common.NewErrorMessage(common.ErrBadValue, "UserName must contain a '.' separated database.user pair")
+	}
+
+	// unknown users have no mechanisms, so that clients can't find out which users exist
+	if db != externalDB || h.clientIdentity == "" || name != h.clientIdentity {
+		return nil
+	}
+
+	if err := reply.Set("saslSupportedMechs", types.MustNewArray(X509Mechanism)); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
@@ -70,19 +70,42 @@ var commands = map[string]command{
 		help:    "checks connection",
 		handler: (*Handler).MsgConnectionStatus,
 	},
-	// "collstats": {
-	// 	// This command implements the following database methods:
-	// 	// 	- db.collection.stats()
-	// 	// 	- db.collection.dataSize()
-	// 	name:    "collStats",
-	// 	help:    "Storage data for a collection. Still needs to be implemented",
-	// 	handler: (*Handler).MsgCollStats,
-	// },
-	// "createindexes": {
-	// 	name:           "createIndexes",
-	// 	help:           "Creates indexes on a collection. Still needs to be implemented.",
-	// 	storageHandler: (common.Storage).MsgCreateIndexes,
-	// },
+	"collMod": {
+		name:    "collMod",
+		help:    "Changes the partitioning of a collection.",
+		handler: (*Handler).MsgCollMod,
+	},
+	"collStats": {
+		// This command implements the following database methods:
+		// 	- db.collection.stats()
+		// 	- db.collection.dataSize()
+		name:    "collStats",
+		help:    "Storage data for a collection including its partitions.",
+		handler: (*Handler).MsgCollStats,
+	},
+	"createIndexes": {
+		name:           "createIndexes",
+		help:           "Builds indexes of ascending and descending keys in the background. Validates the other index specifications.",
+		storageHandler: (common.Storage).MsgCreateIndexes,
+	},
+	"setIndexCommitQuorum": {
+		// db.collection.setIndexCommitQuorum()
+		name:           "setIndexCommitQuorum",
+		help:           "Changes the commitQuorum of an index build in progress.",
+		storageHandler: (common.Storage).MsgSetIndexCommitQuorum,
+	},
+	"currentOp": {
+		// db.currentOp()
+		name:           "currentOp",
+		help:           "Returns the index builds in progress.",
+		storageHandler: (common.Storage).MsgCurrentOp,
+	},
+	"killOp": {
+		// db.killOp()
+		name:           "killOp",
+		help:           "Aborts an index build in progress.",
+		storageHandler: (common.Storage).MsgKillOp,
+	},
 	"create": {
 		// db.createCollection()
 		name:    "create",
@@ -125,12 +148,12 @@ var commands = map[string]command{
 		help:    "Returns the most recent logged events from memory.",
 		handler: (*Handler).MsgGetLog,
 	},
-	// "getparameter": {
-	// 	// db.adminCommand( { getParameter : 1} )db
-	// 	name:    "getParameter",
-	// 	help:    "Returns the value of the parameter.",
-	// 	handler: (*Handler).MsgGetParameter,
-	// },
+	"getParameter": {
+		// db.adminCommand( { getParameter : 1, quotas: 1 } )
+		name:    "getParameter",
+		help:    "Returns the value of the parameter.",
+		handler: (*Handler).MsgGetParameter,
+	},
 	"hostInfo": {
 		// db.hostInfo()
 		name:    "hostInfo",
@@ -172,6 +195,18 @@ var commands = map[string]command{
 		help:    "Returns a pong response. Used for testing purposes.",
 		handler: (*Handler).MsgPing,
 	},
+	"collectSupportBundle": {
+		// db.adminCommand({collectSupportBundle: 1})
+		name:    "collectSupportBundle",
+		help:    "Returns a zip archive with the configuration, logs, metrics, profiles, SAP HANA diagnostics and compatibility report for SAP support.",
+		handler: (*Handler).MsgCollectSupportBundle,
+	},
+	"versionInfo": {
+		// db.adminCommand({versionInfo: 1})
+		name:    "versionInfo",
+		help:    "Returns the version, target platform, build tags and SAP HANA driver version of the build.",
+		handler: (*Handler).MsgVersionInfo,
+	},
 	"whatsmyuri": {
 		//  db.runCommand( { whatsmyuri: 1 } )
 		name:    "whatsmyuri",
@@ -179,24 +214,78 @@ var commands = map[string]command{
 		handler: (*Handler).MsgWhatsMyURI,
 	},
 	"authenticate": {
-		// So far only used for the authenticate required by MongoDB drivers when using tls
-		// At the moment it just sends ok back to MongoDB
+		// Used for the authenticate required by MongoDB drivers when using tls,
+		// and for MONGODB-X509 authentication when authentication is required
 		name:    "authenticate",
 		help:    "a method for authentication",
 		handler: (*Handler).MsgAuthenticate,
 	},
-	// "serverstatus": {
-	// 	// db.serverStatus()
-	// 	name:    "serverStatus",
-	// 	help:    "Returns an overview of the databases state.",
-	// 	handler: (*Handler).MsgServerStatus,
-	// },
+	"saslStart": {
+		// used for PLAIN authentication with SAP HANA credential passthrough
+		name:    "saslStart",
+		help:    "Authenticates the connection with the PLAIN mechanism as a SAP HANA user.",
+		handler: (*Handler).MsgSASLStart,
+	},
+	"serverStatus": {
+		// db.serverStatus()
+		name:    "serverStatus",
+		help:    "Returns an overview of the state including the network traffic per client application.",
+		handler: (*Handler).MsgServerStatus,
+	},
+	"dropConnections": {
+		// db.adminCommand({dropConnections: 1})
+		name:    "dropConnections",
+		help:    "Closes the open connections of the given hosts or client applications.",
+		handler: (*Handler).MsgDropConnections,
+	},
+	"shutdown": {
+		// db.shutdownServer()
+		name:    "shutdown",
+		help:    "Stops accepting connections and closes the open ones.",
+		handler: (*Handler).MsgShutdown,
+	},
+	"commitTransaction": {
+		// session.commitTransaction()
+		name:    "commitTransaction",
+		help:    "Commits the transaction of the session.",
+		handler: (*Handler).MsgCommitTransaction,
+	},
+	"abortTransaction": {
+		// session.abortTransaction()
+		name:    "abortTransaction",
+		help:    "Rolls back the transaction of the session.",
+		handler: (*Handler).MsgAbortTransaction,
+	},
+	"endSessions": {
+		// session.endSession()
+		name:    "endSessions",
+		help:    "Ends the sessions and rolls back their open transactions.",
+		handler: (*Handler).MsgEndSessions,
+	},
+	"aggregate": {
+		// db.collection.aggregate()
+		name:           "aggregate",
+		help:           "Runs an aggregation pipeline on a collection.",
+		storageHandler: (common.Storage).MsgAggregate,
+	},
 	"delete": {
 		// db.collection.deleteOne() or db.collection.deleteMany()
 		name:           "delete",
 		help:           "Deletes documents matched by the query.",
 		storageHandler: (common.Storage).MsgDelete,
 	},
+	"explain": {
+		// db.collection.explain().aggregate()
+		name:           "explain",
+		help:           "Returns how an aggregation pipeline is executed, with statistics per stage.",
+		storageHandler: (common.Storage).MsgExplain,
+	},
+	"seed": {
+		// db.runCommand({seed: "collection", count, template})
+		name:           "seed",
+		help:           "Populates a collection with documents generated from a schema template.",
+		storageHandler: (common.Storage).MsgSeed,
+	},
 	"find": {
 		// db.collection.find()
 		name:           "find",
@@ -215,6 +304,18 @@ var commands = map[string]command{
 		help:           "Returns the count of documents that's matched by the query.",
 		storageHandler: (common.Storage).MsgFindOrCount,
 	},
+	"getMore": {
+		// cursor.next() after the first batch of find
+		name:           "getMore",
+		help:           "Returns the next batch of documents of a cursor, sized by the average size of its documents.",
+		storageHandler: (common.Storage).MsgGetMore,
+	},
+	"killCursors": {
+		// cursor.close()
+		name:           "killCursors",
+		help:           "Closes cursors before all their documents are returned.",
+		storageHandler: (common.Storage).MsgKillCursors,
+	},
 	"insert": {
 		// db.collection.insertOne() or db.collection.deleteMany()
 		name:           "insert",
@@ -245,6 +346,16 @@ var commands = map[string]command{
 	},
 }
 
+// CommandLabel returns the name of the command if it is supported, or "unknown" otherwise,
+// so that the names sent by clients can be used as metric labels without creating arbitrary series.
+func CommandLabel(name string) string {
+	if _, ok := commands[name]; !ok {
+		return "unknown"
+	}
+
+	return name
+}
+
 // SupportedCommands returns a list of currently supported commands.
 func SupportedCommands(context.Context, *wire.OpMsg) (*wire.OpMsg, error) {
 	var reply wire.OpMsg
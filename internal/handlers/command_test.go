@@ -61,6 +61,24 @@ func TestSupportedCommands(t *testing.T) {
 			"create", types.MustMakeDocument(
 				"help", "Creates the collection.",
 			),
+			"aggregate", types.MustMakeDocument(
+				"help", "Runs an aggregation pipeline on a collection.",
+			),
+			"collMod", types.MustMakeDocument(
+				"help", "Changes the partitioning of a collection.",
+			),
+			"collStats", types.MustMakeDocument(
+				"help", "Storage data for a collection including its partitions.",
+			),
+			"createIndexes", types.MustMakeDocument(
+				"help", "Builds indexes of ascending and descending keys in the background. Validates the other index specifications.",
+			),
+			"currentOp", types.MustMakeDocument(
+				"help", "Returns the index builds in progress.",
+			),
+			"getParameter", types.MustMakeDocument(
+				"help", "Returns the value of the parameter.",
+			),
 			"hostInfo", types.MustMakeDocument(
 				"help", "Returns a summary of the system information.",
 			),
@@ -79,6 +97,9 @@ func TestSupportedCommands(t *testing.T) {
 			"authenticate", types.MustMakeDocument(
 				"help", "a method for authentication",
 			),
+			"saslStart", types.MustMakeDocument(
+				"help", "Authenticates the connection with the PLAIN mechanism as a SAP HANA user.",
+			),
 			"debug_error", types.MustMakeDocument(
 				"help", "Used for debugging purposes.",
 			),
@@ -91,9 +112,42 @@ func TestSupportedCommands(t *testing.T) {
 			"isMaster", types.MustMakeDocument(
 				"help", "Returns the role of the SAP HANA compatibility layer for MongoDB Wire Protocol instance.",
 			),
+			"collectSupportBundle", types.MustMakeDocument(
+				"help", "Returns a zip archive with the configuration, logs, metrics, profiles, SAP HANA diagnostics and compatibility report for SAP support.",
+			),
+			"versionInfo", types.MustMakeDocument(
+				"help", "Returns the version, target platform, build tags and SAP HANA driver version of the build.",
+			),
 			"whatsmyuri", types.MustMakeDocument(
 				"help", "An internal command.",
 			),
+			"setIndexCommitQuorum", types.MustMakeDocument(
+				"help", "Changes the commitQuorum of an index build in progress.",
+			),
+			"dropConnections", types.MustMakeDocument(
+				"help", "Closes the open connections of the given hosts or client applications.",
+			),
+			"shutdown", types.MustMakeDocument(
+				"help", "Stops accepting connections and closes the open ones.",
+			),
+			"commitTransaction", types.MustMakeDocument(
+				"help", "Commits the transaction of the session.",
+			),
+			"abortTransaction", types.MustMakeDocument(
+				"help", "Rolls back the transaction of the session.",
+			),
+			"endSessions", types.MustMakeDocument(
+				"help", "Ends the sessions and rolls back their open transactions.",
+			),
+			"serverStatus", types.MustMakeDocument(
+				"help", "Returns an overview of the state including the network traffic per client application.",
+			),
+			"explain", types.MustMakeDocument(
+				"help", "Returns how an aggregation pipeline is executed, with statistics per stage.",
+			),
+			"seed", types.MustMakeDocument(
+				"help", "Populates a collection with documents generated from a schema template.",
+			),
 			"find", types.MustMakeDocument(
 				"help", "Returns documents matched by the custom query.",
 			),
@@ -103,6 +157,15 @@ func TestSupportedCommands(t *testing.T) {
 			"count", types.MustMakeDocument(
 				"help", "Returns the count of documents that's matched by the query.",
 			),
+			"getMore", types.MustMakeDocument(
+				"help", "Returns the next batch of documents of a cursor, sized by the average size of its documents.",
+			),
+			"killCursors", types.MustMakeDocument(
+				"help", "Closes cursors before all their documents are returned.",
+			),
+			"killOp", types.MustMakeDocument(
+				"help", "Aborts an index build in progress.",
+			),
 			"delete", types.MustMakeDocument(
 				"help", "Deletes documents matched by the query.",
 			),
@@ -141,3 +204,10 @@ func TestSupportedCommands(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, expected.(types.Document).Map(), actual.(types.Document).Map())
 }
+
+func TestCommandLabel(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "find", CommandLabel("find"))
+	assert.Equal(t, "unknown", CommandLabel("noSuchCommand"))
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// commentString returns the comment of the command as string, or an empty string if it has none.
+// Like in MongoDB, the comment may have any type; other types than strings are formatted as JSON.
+func commentString(document types.Document) string {
+	switch comment := document.Map()["comment"].(type) {
+	case nil:
+		return ""
+	case string:
+		return comment
+	default:
+		b, err := fjson.Marshal(comment)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+}
+
+// logSlowCommand logs the command if it took at least the slow command threshold of the handler,
+// with its comment, so that slow commands can be correlated with the statements in SAP HANA.
+func (h *Handler) logSlowCommand(document types.Document, comment string, duration time.Duration, err error) {
+	if h.slowCommandThreshold <= 0 || duration < h.slowCommandThreshold {
+		return
+	}
+
+	// an awaitable hello waits for its maxAwaitTimeMS on purpose
+	if _, ok := document.Map()["maxAwaitTimeMS"]; ok {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("command", document.Command()),
+		zap.Any("db", document.Map()["$db"]),
+		zap.Int64("durationMillis", duration.Milliseconds()),
+	}
+	if comment != "" {
+		fields = append(fields, zap.String("comment", comment))
+	}
+	if err != nil {
+		fields = append(fields, h.errorField(err))
+	}
+
+	h.l.Info("Slow command", fields...)
+}
@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+)
+
+func TestCommentString(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "", commentString(types.MustMakeDocument("find", "c")))
+	assert.Equal(t, "nightly report", commentString(types.MustMakeDocument("find", "c", "comment", "nightly report")))
+	assert.Equal(t, `{"job":"report"}`, commentString(types.MustMakeDocument("find", "c", "comment", types.MustMakeDocument("job", "report"))))
+}
+
+func TestSlowCommand(t *testing.T) {
+	t.Parallel()
+
+	_, handler, mock := setup(t, nil)
+
+	core, logs := observer.New(zap.InfoLevel)
+	handler.l = zap.New(core)
+	handler.slowCommandThreshold = 10 * time.Millisecond
+
+	// the comment is attached to the SAP HANA statements of the command
+	mock.ExpectQuery(regexp.QuoteMeta("/* nightly report */ SELECT object_count FROM m_feature_usage")).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnError(sqlmock.ErrCancelled)
+
+	handle(testutil.Ctx(t), t, handler, types.MustMakeDocument("find", "c", "comment", "nightly report", "$db", "db"))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	entries := logs.FilterMessage("Slow command").All()
+	require.Len(t, entries, 1)
+
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "find", fields["command"])
+	assert.Equal(t, "db", fields["db"])
+	assert.Equal(t, "nightly report", fields["comment"])
+	assert.GreaterOrEqual(t, fields["durationMillis"], int64(20))
+}
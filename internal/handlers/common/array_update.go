@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// arrayOperators are the update operators which SAP HANA cannot apply in an UPDATE statement,
+// with the parser of the operator on one field.
+var arrayOperators = []struct {
+	name  string
+	parse func(path string, value any) (arrayUpdate, error)
+}{
+	{"$push", func(path string, value any) (arrayUpdate, error) { return parsePush(path, value) }},
+	{"$pull", func(path string, value any) (arrayUpdate, error) { return parsePull(path, value) }},
+}
+
+// arrayUpdate is the update of one array field by one of the arrayOperators.
+type arrayUpdate interface {
+	// apply returns the new array of the field in the document, or nil if the field is not changed.
+	apply(doc types.Document) (*types.Array, error)
+}
+
+// IsArrayUpdate returns true if the update document has one of the array operators like $push or $pull,
+// a field with the positional operator $, or sets a field of an embedded document by dot notation,
+// which SAP HANA cannot apply in an UPDATE statement.
+// Such updates are applied with UpdateArrays.
+func IsArrayUpdate(updateDoc types.Document) bool {
+	for _, op := range arrayOperators {
+		if _, ok := updateDoc.Map()[op.name]; ok {
+			return true
+		}
+	}
+
+	return isPositionalUpdate(updateDoc) || isNestedSet(updateDoc)
+}
+
+// UpdateArrays creates the SQL part for updating one document with array operators like $push or $pull.
+// The new arrays are computed from the current document and set as a whole, together with $set and $unset.
+// Fields of embedded documents set by dot notation are set with their whole top-level field.
+// The positional operator $ is replaced by the index of the array element matched by the filter.
+// It returns an empty string if the document is not changed. The values are bound to parameters of p.
+func UpdateArrays(updateDoc, filter, doc types.Document, p *Placeholder) (updateSQL string, err error) {
+	if updateDoc, err = resolvePositional(updateDoc, filter, doc); err != nil {
+		return "", err
+	}
+
+	supported := map[string]struct{}{"$set": {}, "$unset": {}}
+	for _, op := range arrayOperators {
+		supported[op.name] = struct{}{}
+	}
+	for _, k := range updateDoc.Keys() {
+		if _, ok := supported[k]; !ok {
+			return "", NewErrorMessage(ErrNotImplemented, "%s: support for field %q is not implemented yet", updateDoc.Command(), k)
+		}
+	}
+
+	var sets []string
+	paths := make(map[string]struct{})
+	for _, op := range arrayOperators {
+		value, ok := updateDoc.Map()[op.name]
+		if !ok {
+			continue
+		}
+
+		opDoc, ok := value.(types.Document)
+		if !ok {
+			return "", NewErrorMessage(ErrFailedToParse, "Modifiers operate on fields but we found type %s instead", typeName(value))
+		}
+
+		for _, key := range opDoc.Keys() {
+			if _, ok := paths[key]; ok {
+				return "", NewErrorMessage(ErrConflictingUpdateOperators, "Updating the path '%s' would create a conflict at '%s'", key, key)
+			}
+			paths[key] = struct{}{}
+
+			u, err := op.parse(key, opDoc.Map()[key])
+			if err != nil {
+				return "", err
+			}
+
+			arr, err := u.apply(doc)
+			if err != nil {
+				return "", err
+			}
+			if arr == nil {
+				continue
+			}
+
+			updateKey, err := getUpdateKey(key)
+			if err != nil {
+				return "", err
+			}
+
+			updateValue, err := GetUpdateValue(arr, p)
+			if err != nil {
+				return "", err
+			}
+
+			sets = append(sets, updateKey+" = "+updateValue)
+		}
+	}
+
+	if setDoc, ok := updateDoc.Map()["$set"].(types.Document); ok {
+		// fields of embedded documents are set with their top-level field
+		nested, rest, err := nestedSets(setDoc, doc, p)
+		if err != nil {
+			return "", err
+		}
+		sets = append(sets, nested...)
+
+		// fields which already have the new value are not set, so that the document is not modified
+		rest = withoutFields(rest, unchangedFields(rest, doc, true))
+		if len(rest.Keys()) > 0 {
+			var setSQL string
+			if setSQL, _, err = createSetandUnsetSqlStmnt(rest, true, p); err != nil {
+				return "", err
+			}
+			sets = append(sets, strings.TrimPrefix(setSQL, " SET "))
+		}
+	}
+
+	if len(sets) > 0 {
+		updateSQL = " SET " + strings.Join(sets, ", ")
+	}
+
+	if unSetDoc, ok := updateDoc.Map()["$unset"].(types.Document); ok {
+		// missing fields are not unset, so that the document is not modified
+		if unSetDoc = withoutFields(unSetDoc, unchangedFields(unSetDoc, doc, false)); len(unSetDoc.Keys()) == 0 {
+			return updateSQL, nil
+		}
+
+		var unSetSQL string
+		if unSetSQL, _, err = createSetandUnsetSqlStmnt(unSetDoc, false, p); err != nil {
+			return "", err
+		}
+		if updateSQL != "" {
+			updateSQL += ", "
+		}
+		updateSQL += unSetSQL
+	}
+
+	return updateSQL, nil
+}
+
+// currentArray returns the elements of the array field in the document, or none if the field is missing.
+func currentArray(doc types.Document, path string) ([]any, error) {
+	switch current := valueAtPath(doc, path).(type) {
+	case nil:
+		return nil, nil
+	case *types.Array:
+		values := make([]any, current.Len())
+		for i := range values {
+			values[i], _ = current.Get(i)
+		}
+		return values, nil
+	default:
+		id, _ := doc.Get("_id")
+		return nil, NewErrorMessage(
+			ErrBadValue,
+			"The field '%s' must be an array but is of type %s in document {_id: %v}", path, typeName(current), id,
+		)
+	}
+}
+
+// valueAtPath returns the value at the dot notation path of the document, or nil if there is none.
+func valueAtPath(doc types.Document, path string) any {
+	value, _ := lookupPath(doc, path)
+	return value
+}
+
+// lookupPath returns the value at the dot notation path of the document and whether it exists.
+func lookupPath(doc types.Document, path string) (any, bool) {
+	var value any = doc
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case types.Document:
+			var ok bool
+			if value, ok = v.Map()[key]; !ok {
+				return nil, false
+			}
+		case *types.Array:
+			i, err := strconv.Atoi(key)
+			if err != nil {
+				return nil, false
+			}
+			if value, err = v.Get(i); err != nil {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// unchangedFields returns the fields of the $set or $unset document which would not change the document,
+// because they already have the new value or are already missing.
+func unchangedFields(updateDoc, doc types.Document, set bool) map[string]struct{} {
+	unchanged := make(map[string]struct{})
+	for _, key := range updateDoc.Keys() {
+		current, ok := lookupPath(doc, key)
+		if (set && ok && reflect.DeepEqual(current, updateDoc.Map()[key])) || (!set && !ok) {
+			unchanged[key] = struct{}{}
+		}
+	}
+
+	return unchanged
+}
+
+// withoutFields returns a copy of the document without the given fields.
+func withoutFields(doc types.Document, fields map[string]struct{}) types.Document {
+	res := types.MustMakeDocument()
+	for _, key := range doc.Keys() {
+		if _, ok := fields[key]; !ok {
+			res.Set(key, doc.Map()[key])
+		}
+	}
+
+	return res
+}
+
+// wholeNumber returns the value as int if it is a whole number.
+func wholeNumber(value any) (int, bool) {
+	switch v := value.(type) {
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	}
+
+	return 0, false
+}
+
+// TypeName returns the MongoDB name of the value's type for error messages.
+func TypeName(value any) string {
+	return typeName(value)
+}
+
+// typeName returns the MongoDB name of the value's type for error messages.
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case types.Document:
+		return "object"
+	case *types.Array:
+		return "array"
+	case types.Binary:
+		return "binData"
+	case types.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case types.Regex:
+		return "regex"
+	case int32:
+		return "int"
+	case types.Timestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	case types.Code:
+		return "javascript"
+	case types.CodeWithScope:
+		return "javascriptWithScope"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestUpdateArrays(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument("_id", int32(1), "feed", types.MustNewArray("a"), "old", "x", "null", nil)
+
+	updateSQL, err := boundUpdateArrays(types.MustMakeDocument(
+		"$push", types.MustMakeDocument("feed", "b", "tags", "new"),
+		"$unset", types.MustMakeDocument("old", ""),
+	), types.Document{}, doc)
+	require.NoError(t, err)
+	assert.Equal(t, " SET \"feed\" = ['a', 'b'], \"tags\" = ['new'],  UNSET \"old\"", updateSQL)
+
+	_, err = boundUpdateArrays(types.MustMakeDocument("$push", types.MustMakeDocument("feed", "b"), "$inc", types.MustMakeDocument("n", int32(1))), types.Document{}, doc)
+	assert.EqualError(t, err, "NotImplemented (238): $push: support for field \"$inc\" is not implemented yet")
+
+	_, err = boundUpdateArrays(types.MustMakeDocument("$push", types.MustMakeDocument("feed", "b"), "$pull", types.MustMakeDocument("feed", "a")), types.Document{}, doc)
+	assert.EqualError(t, err, "ConflictingUpdateOperators (40): Updating the path 'feed' would create a conflict at 'feed'")
+
+	updateSQL, err = boundUpdateArrays(types.MustMakeDocument("$pull", types.MustMakeDocument("feed", "b")), types.Document{}, doc)
+	require.NoError(t, err)
+	assert.Empty(t, updateSQL)
+
+	// fields which already have the new value or are already missing do not modify the document
+	updateSQL, err = boundUpdateArrays(types.MustMakeDocument(
+		"$pull", types.MustMakeDocument("feed", "b"),
+		"$set", types.MustMakeDocument("old", "x", "null", nil),
+		"$unset", types.MustMakeDocument("missing", ""),
+	), types.Document{}, doc)
+	require.NoError(t, err)
+	assert.Empty(t, updateSQL)
+
+	updateSQL, err = boundUpdateArrays(types.MustMakeDocument(
+		"$pull", types.MustMakeDocument("feed", "b"),
+		"$set", types.MustMakeDocument("missing", nil, "old", "y"),
+	), types.Document{}, doc)
+	require.NoError(t, err)
+	assert.Equal(t, " SET \"missing\" = NULL, \"old\" = 'y'", updateSQL)
+}
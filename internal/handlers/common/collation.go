@@ -0,0 +1,254 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// Collation contains the options of a collation which change how strings are compared in SQL and sorted.
+type Collation struct {
+	Locale          string
+	Strength        int32
+	CaseLevel       bool
+	NumericOrdering bool
+
+	// collator compares strings by the rules of the locale, created by the first Compare
+	collator *collate.Collator
+}
+
+// ParseCollation validates a collation like {locale: "en", strength: 2}.
+// It returns nil if value is nil or uses the locale "simple", which compares strings binary
+// like SAP HANA does by default.
+func ParseCollation(value any) (*Collation, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	doc, ok := value.(types.Document)
+	if !ok {
+		return nil, NewErrorMessage(ErrBadValue, "collation must be an object. Got instead: %T", value)
+	}
+
+	c := Collation{Strength: 3}
+	for _, k := range doc.Keys() {
+		v := doc.Map()[k]
+
+		switch k {
+		case "locale":
+			if c.Locale, ok = v.(string); !ok || c.Locale == "" {
+				return nil, NewErrorMessage(ErrBadValue, "collation locale must be a non-empty string")
+			}
+			if c.Locale != "simple" && collationTag(c.Locale) == "" {
+				return nil, NewErrorMessage(ErrBadValue, "unsupported collation locale: %s", c.Locale)
+			}
+		case "strength":
+			n, ok := writeConcernNumber(v)
+			if !ok || n < 1 || n > 5 {
+				return nil, NewErrorMessage(ErrBadValue, "collation strength must be an integer between 1 and 5")
+			}
+			c.Strength = int32(n)
+		case "caseLevel":
+			if c.CaseLevel, ok = v.(bool); !ok {
+				return nil, NewErrorMessage(ErrBadValue, "collation caseLevel must be a boolean. Got instead: %T", v)
+			}
+		case "numericOrdering":
+			if c.NumericOrdering, ok = v.(bool); !ok {
+				return nil, NewErrorMessage(ErrBadValue, "collation numericOrdering must be a boolean. Got instead: %T", v)
+			}
+		case "backwards", "normalization":
+			b, ok := v.(bool)
+			if !ok {
+				return nil, NewErrorMessage(ErrBadValue, "collation %s must be a boolean. Got instead: %T", k, v)
+			}
+			if b {
+				return nil, NewErrorMessage(ErrNotImplemented, "collation %s is not implemented yet", k)
+			}
+		case "caseFirst", "alternate", "maxVariable":
+			if _, ok := v.(string); !ok {
+				return nil, NewErrorMessage(ErrBadValue, "collation %s must be a string. Got instead: %T", k, v)
+			}
+			if v != collationDefaults[k] {
+				return nil, NewErrorMessage(ErrNotImplemented, "collation %s %s is not implemented yet", k, v)
+			}
+		default:
+			return nil, NewErrorMessage(ErrBadValue, "unknown collation field: %s", k)
+		}
+	}
+
+	if c.Locale == "" {
+		return nil, NewErrorMessage(ErrBadValue, "missing required collation field: locale")
+	}
+
+	if c.Locale == "simple" {
+		if len(doc.Keys()) > 1 {
+			return nil, NewErrorMessage(ErrBadValue, "collation locale simple cannot be combined with other options")
+		}
+		return nil, nil
+	}
+
+	return &c, nil
+}
+
+// collationDefaults are the values of string options which do not change the comparison.
+var collationDefaults = map[string]string{
+	"caseFirst":   "off",
+	"alternate":   "non-ignorable",
+	"maxVariable": "punct",
+}
+
+// foldCase returns true if the collation ignores the case of strings.
+// Strength 1 and 2 only compare base characters and diacritics unless caseLevel is set.
+func (c *Collation) foldCase() bool {
+	return c != nil && c.Strength <= 2 && !c.CaseLevel
+}
+
+// collate applies the collation to the comparison of the field kSQL with a value.
+// Only string values are affected.
+func (c *Collation) collate(kSQL, vSQL string, value any) (string, string) {
+	if _, ok := value.(string); !ok || c == nil {
+		return kSQL, vSQL
+	}
+
+	if c.foldCase() {
+		kSQL, vSQL = "UPPER("+kSQL+")", "UPPER("+vSQL+")"
+	}
+
+	if c.NumericOrdering {
+		kSQL, vSQL = numericKey(kSQL), numericKey(vSQL)
+	}
+
+	return kSQL, vSQL
+}
+
+// numericWidth is the number of digits numbers are padded to by numericKey, enough for any int64.
+const numericWidth = 20
+
+// numericKey returns the SQL of a string with every sequence of digits padded with zeros to numericWidth digits,
+// so that comparing strings compares their numbers by value, like "2" before "10" with numericOrdering.
+// The digits are first prefixed with numericWidth zeros and then cut to the last numericWidth digits.
+func numericKey(sql string) string {
+	width := strconv.Itoa(numericWidth)
+	padded := "REPLACE_REGEXPR('([0-9]+)' IN " + sql + " WITH '" + strings.Repeat("0", numericWidth) + "\\1' OCCURRENCE ALL)"
+
+	return "REPLACE_REGEXPR('0*([0-9]{" + width + "})' IN " + padded + " WITH '\\1' OCCURRENCE ALL)"
+}
+
+// Compare compares two values like types.Compare, but strings by the rules of the locale of the collation,
+// like "Ä" next to "A" in German. Strings in documents and arrays are compared binary.
+// SAP HANA has no collations for the values of JSON documents, so documents are sorted with a collation in Go.
+func (c *Collation) Compare(a, b any) int {
+	as, aok := collatedString(a)
+	bs, bok := collatedString(b)
+	if !aok || !bok {
+		return types.Compare(a, b)
+	}
+
+	if c.collator == nil {
+		c.collator = collate.New(language.Make(collationTag(c.Locale)), c.collateOptions()...)
+	}
+
+	return c.collator.CompareString(as, bs)
+}
+
+// collatedString returns the string of a value compared by the collator.
+func collatedString(value any) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case types.CString:
+		return string(value), true
+	default:
+		return "", false
+	}
+}
+
+// collateOptions returns the options of the collator of the strength, caseLevel and numericOrdering of the collation.
+// Strength 1 only compares base characters, strength 2 also diacritics, both ignore the case unless caseLevel is set.
+func (c *Collation) collateOptions() []collate.Option {
+	var opts []collate.Option
+	if c.Strength <= 1 {
+		opts = append(opts, collate.IgnoreDiacritics)
+	}
+	if c.foldCase() {
+		opts = append(opts, collate.IgnoreCase)
+	}
+	if c.NumericOrdering {
+		opts = append(opts, collate.Numeric)
+	}
+
+	return opts
+}
+
+// collationTags are the BCP 47 tags of the collations of the languages of locales,
+// and of locales whose collation differs from the one of their language.
+var collationTags = map[string]string{
+	"cs":                     "cs",
+	"da":                     "da",
+	"de":                     "de",
+	"de@collation=phonebook": "de-u-co-phonebk",
+	"en":                     "en",
+	"es":                     "es",
+	"fi":                     "fi",
+	"fr":                     "fr",
+	"hu":                     "hu",
+	"it":                     "it",
+	"ja":                     "ja",
+	"ko":                     "ko",
+	"nb":                     "nb",
+	"nl":                     "nl",
+	"pl":                     "pl",
+	"pt":                     "pt",
+	"ru":                     "ru",
+	"sv":                     "sv",
+	"tr":                     "tr",
+	"zh":                     "zh",
+}
+
+// collationTag returns the BCP 47 tag of the collation of a locale like "de_AT" or "de@collation=phonebook",
+// or an empty string if it is not supported.
+func collationTag(locale string) string {
+	if tag, ok := collationTags[locale]; ok {
+		return tag
+	}
+
+	// the collation of the language, like "de" for "de_AT"
+	lang := strings.FieldsFunc(locale, func(r rune) bool { return r == '_' || r == '-' || r == '@' })
+	if len(lang) == 0 {
+		return ""
+	}
+
+	return collationTags[lang[0]]
+}
+
+// CollationFromOptions returns the default collation of a collection, or nil if it has none.
+func CollationFromOptions(c *hana.Collation) *Collation {
+	if c == nil {
+		return nil
+	}
+
+	res := &Collation{Locale: c.Locale, Strength: c.Strength, CaseLevel: c.CaseLevel, NumericOrdering: c.NumericOrdering}
+	if res.Strength == 0 {
+		res.Strength = 3
+	}
+
+	return res
+}
+
+// Options returns the collation to be stored as the default collation of a collection.
+func (c *Collation) Options() *hana.Collation {
+	if c == nil {
+		return nil
+	}
+
+	return &hana.Collation{Locale: c.Locale, Strength: c.Strength, CaseLevel: c.CaseLevel, NumericOrdering: c.NumericOrdering}
+}
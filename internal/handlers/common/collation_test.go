@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestParseCollation(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		value    any
+		expected *Collation
+		err      string
+	}{
+		"Missing": {
+			value: nil,
+		},
+		"Simple": {
+			value: types.MustMakeDocument("locale", "simple"),
+		},
+		"Default": {
+			value:    types.MustMakeDocument("locale", "en"),
+			expected: &Collation{Locale: "en", Strength: 3},
+		},
+		"Strength": {
+			value:    types.MustMakeDocument("locale", "de", "strength", int32(1), "caseLevel", true),
+			expected: &Collation{Locale: "de", Strength: 1, CaseLevel: true},
+		},
+		"NoLocale": {
+			value: types.MustMakeDocument("strength", int32(2)),
+			err:   "BadValue (2): missing required collation field: locale",
+		},
+		"SimpleWithOptions": {
+			value: types.MustMakeDocument("locale", "simple", "strength", int32(2)),
+			err:   "BadValue (2): collation locale simple cannot be combined with other options",
+		},
+		"InvalidStrength": {
+			value: types.MustMakeDocument("locale", "en", "strength", int32(6)),
+			err:   "BadValue (2): collation strength must be an integer between 1 and 5",
+		},
+		"NumericOrdering": {
+			value:    types.MustMakeDocument("locale", "en", "numericOrdering", true),
+			expected: &Collation{Locale: "en", Strength: 3, NumericOrdering: true},
+		},
+		"NumericOrderingWrongType": {
+			value: types.MustMakeDocument("locale", "en", "numericOrdering", int32(1)),
+			err:   "BadValue (2): collation numericOrdering must be a boolean. Got instead: int32",
+		},
+		"Backwards": {
+			value: types.MustMakeDocument("locale", "fr", "backwards", true),
+			err:   "NotImplemented (238): collation backwards is not implemented yet",
+		},
+		"DefaultCaseFirst": {
+			value:    types.MustMakeDocument("locale", "en", "caseFirst", "off"),
+			expected: &Collation{Locale: "en", Strength: 3},
+		},
+		"UnsupportedLocale": {
+			value: types.MustMakeDocument("locale", "xx"),
+			err:   "BadValue (2): unsupported collation locale: xx",
+		},
+		"UnknownField": {
+			value: types.MustMakeDocument("locale", "en", "foo", int32(1)),
+			err:   "BadValue (2): unknown collation field: foo",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ParseCollation(tc.value)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestCollationCompare(t *testing.T) {
+	t.Parallel()
+
+	// German sorts "Ä" next to "A", the phonebook order like "Ae"
+	c := &Collation{Locale: "de_AT", Strength: 3}
+	assert.Equal(t, -1, c.Compare("Äpfel", "Birnen"))
+	assert.Equal(t, -1, c.Compare("Äpfel", "Apfel2"))
+	c = &Collation{Locale: "de@collation=phonebook", Strength: 3}
+	assert.Equal(t, -1, c.Compare("Äpfel", "Af"))
+
+	// Swedish sorts "Ä" after "Z"
+	c = &Collation{Locale: "sv", Strength: 3}
+	assert.Equal(t, 1, c.Compare("Äpple", "Zebra"))
+
+	// strength 2 ignores the case, strength 1 also diacritics
+	c = &Collation{Locale: "en", Strength: 2}
+	assert.Equal(t, 0, c.Compare("abc", "ABC"))
+	assert.Equal(t, -1, c.Compare("abc", "ábc"))
+	c = &Collation{Locale: "en", Strength: 1}
+	assert.Equal(t, 0, c.Compare("abc", "ÁBC"))
+	c = &Collation{Locale: "en", Strength: 1, CaseLevel: true}
+	assert.Equal(t, -1, c.Compare("abc", "ABC"))
+
+	c = &Collation{Locale: "en", Strength: 3, NumericOrdering: true}
+	assert.Equal(t, -1, c.Compare("item 2", "item 10"))
+
+	// other values are compared in the BSON comparison order
+	assert.Equal(t, -1, c.Compare(int32(10), "a"))
+	assert.Equal(t, 1, c.Compare(int32(10), int64(2)))
+	assert.Equal(t, -1, c.Compare(nil, "a"))
+}
+
+func TestCreateCollatedWhereClause(t *testing.T) {
+	t.Parallel()
+
+	caseInsensitive := &Collation{Locale: "en", Strength: 2}
+
+	for name, tc := range map[string]struct {
+		filter    types.Document
+		collation *Collation
+		expected  string
+	}{
+		"Equal": {
+			filter:    types.MustMakeDocument("name", "abc"),
+			collation: caseInsensitive,
+			expected:  ` WHERE UPPER("name") = UPPER('abc')`,
+		},
+		"CaseSensitive": {
+			filter:    types.MustMakeDocument("name", "abc"),
+			collation: &Collation{Locale: "en", Strength: 3},
+			expected:  ` WHERE "name" = 'abc'`,
+		},
+		"CaseLevel": {
+			filter:    types.MustMakeDocument("name", "abc"),
+			collation: &Collation{Locale: "en", Strength: 1, CaseLevel: true},
+			expected:  ` WHERE "name" = 'abc'`,
+		},
+		"Number": {
+			filter:    types.MustMakeDocument("age", int32(3)),
+			collation: caseInsensitive,
+			expected:  ` WHERE "age" = 3`,
+		},
+		"Comparison": {
+			filter:    types.MustMakeDocument("name", types.MustMakeDocument("$gte", "b")),
+			collation: caseInsensitive,
+			expected:  ` WHERE ("name" LIKE '%' AND UPPER("name") >= UPPER('b'))`,
+		},
+		"NotEqual": {
+			filter:    types.MustMakeDocument("name", types.MustMakeDocument("$ne", "b")),
+			collation: caseInsensitive,
+			expected:  ` WHERE (UPPER("name") <> UPPER('b') OR "name" IS UNSET)`,
+		},
+		"NumericOrdering": {
+			filter:    types.MustMakeDocument("version", types.MustMakeDocument("$lt", "v10")),
+			collation: &Collation{Locale: "en", Strength: 3, NumericOrdering: true},
+			expected: ` WHERE ("version" LIKE '%' AND ` +
+				`REPLACE_REGEXPR('0*([0-9]{20})' IN REPLACE_REGEXPR('([0-9]+)' IN "version" WITH '00000000000000000000\1' OCCURRENCE ALL) WITH '\1' OCCURRENCE ALL) < ` +
+				`REPLACE_REGEXPR('0*([0-9]{20})' IN REPLACE_REGEXPR('([0-9]+)' IN 'v10' WITH '00000000000000000000\1' OCCURRENCE ALL) WITH '\1' OCCURRENCE ALL))`,
+		},
+		"Or": {
+			filter: types.MustMakeDocument("$or", types.MustNewArray(
+				types.MustMakeDocument("name", "a"),
+				types.MustMakeDocument("city", "b"),
+			)),
+			collation: caseInsensitive,
+			expected:  ` WHERE (UPPER("name") = UPPER('a') OR UPPER("city") = UPPER('b'))`,
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := boundWhereClause(tc.filter, tc.collation)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
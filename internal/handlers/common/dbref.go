@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// isDBRef returns true if the document follows the DBRef convention {$ref: collection, $id: value, $db: database},
+// where $db is optional and may be followed by other fields without $ prefix.
+//
+// Such documents are values, not documents of query operators, so they are compared for equality in filters.
+func isDBRef(doc types.Document) bool {
+	keys := doc.Keys()
+	if len(keys) < 2 || keys[0] != "$ref" || keys[1] != "$id" {
+		return false
+	}
+
+	m := doc.Map()
+	if _, ok := m["$ref"].(string); !ok {
+		return false
+	}
+
+	rest := keys[2:]
+	if len(rest) > 0 && rest[0] == "$db" {
+		if _, ok := m["$db"].(string); !ok {
+			return false
+		}
+		rest = rest[1:]
+	}
+
+	for _, k := range rest {
+		if strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+
+	return true
+}
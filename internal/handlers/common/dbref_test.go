@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestIsDBRef(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		doc      types.Document
+		expected bool
+	}{
+		"DBRef":      {types.MustMakeDocument("$ref", "users", "$id", int32(1)), true},
+		"Database":   {types.MustMakeDocument("$ref", "users", "$id", int32(1), "$db", "test"), true},
+		"Extra":      {types.MustMakeDocument("$ref", "users", "$id", int32(1), "$db", "test", "note", "x"), true},
+		"Order":      {types.MustMakeDocument("$id", int32(1), "$ref", "users"), false},
+		"NoID":       {types.MustMakeDocument("$ref", "users"), false},
+		"RefType":    {types.MustMakeDocument("$ref", int32(1), "$id", int32(1)), false},
+		"DBType":     {types.MustMakeDocument("$ref", "users", "$id", int32(1), "$db", int32(1)), false},
+		"Operator":   {types.MustMakeDocument("$ref", "users", "$id", int32(1), "$gt", int32(1)), false},
+		"Expression": {types.MustMakeDocument("$gt", int32(1)), false},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, isDBRef(tc.doc))
+		})
+	}
+}
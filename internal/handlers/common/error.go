@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -36,15 +38,44 @@ const (
 	// For ProtocolError only.
 	errInternalError = ErrorCode(1) // InternalError
 
-	ErrBadValue          = ErrorCode(2)     // BadValue
-	ErrNamespaceNotFound = ErrorCode(26)    // NamespaceNotFound
-	ErrNamespaceExists   = ErrorCode(48)    // NamespaceExists
-	ErrCommandNotFound   = ErrorCode(59)    // CommandNotFound
-	ErrNotImplemented    = ErrorCode(238)   // NotImplemented
-	ErrSortBadValue      = ErrorCode(15974) // SortBadValue
-	ErrProjectionInEx    = ErrorCode(31253) // Location31253
-	ErrProjectionExIn    = ErrorCode(31254) // Location31254
-	ErrRegexOptions      = ErrorCode(51075) // Location51075
+	ErrBadValue                           = ErrorCode(2)     // BadValue
+	ErrHostUnreachable                    = ErrorCode(6)     // HostUnreachable
+	ErrFailedToParse                      = ErrorCode(9)     // FailedToParse
+	ErrUnauthorized                       = ErrorCode(13)    // Unauthorized
+	ErrTypeMismatch                       = ErrorCode(14)    // TypeMismatch
+	ErrOverflow                           = ErrorCode(15)    // Overflow
+	ErrAuthenticationFailed               = ErrorCode(18)    // AuthenticationFailed
+	ErrIllegalOperation                   = ErrorCode(20)    // IllegalOperation
+	ErrNamespaceNotFound                  = ErrorCode(26)    // NamespaceNotFound
+	ErrIndexNotFound                      = ErrorCode(27)    // IndexNotFound
+	ErrPathNotViable                      = ErrorCode(28)    // PathNotViable
+	ErrConflictingUpdateOperators         = ErrorCode(40)    // ConflictingUpdateOperators
+	ErrCursorNotFound                     = ErrorCode(43)    // CursorNotFound
+	ErrNamespaceExists                    = ErrorCode(48)    // NamespaceExists
+	ErrMaxTimeMSExpired                   = ErrorCode(50)    // MaxTimeMSExpired
+	ErrDollarPrefixedFieldName            = ErrorCode(52)    // DollarPrefixedFieldName
+	ErrDottedFieldName                    = ErrorCode(57)    // DottedFieldName
+	ErrCommandNotFound                    = ErrorCode(59)    // CommandNotFound
+	ErrInvalidOptions                     = ErrorCode(72)    // InvalidOptions
+	ErrInvalidNamespace                   = ErrorCode(73)    // InvalidNamespace
+	ErrIndexOptionsConflict               = ErrorCode(85)    // IndexOptionsConflict
+	ErrTransactionTooOld                  = ErrorCode(225)   // TransactionTooOld
+	ErrNotImplemented                     = ErrorCode(238)   // NotImplemented
+	ErrNoSuchTransaction                  = ErrorCode(251)   // NoSuchTransaction
+	ErrOperationNotSupportedInTransaction = ErrorCode(263)   // OperationNotSupportedInTransaction
+	ErrIndexBuildAborted                  = ErrorCode(276)   // IndexBuildAborted
+	ErrNotWritablePrimary                 = ErrorCode(10107) // NotWritablePrimary
+	ErrBSONObjectTooLarge                 = ErrorCode(10334) // BSONObjectTooLarge
+	ErrSortBadValue                       = ErrorCode(15974) // SortBadValue
+	ErrInvalidVariableStart               = ErrorCode(16870) // Location16870
+	ErrInvalidVariableChar                = ErrorCode(16871) // Location16871
+	ErrUndefinedVariable                  = ErrorCode(17276) // Location17276
+	ErrPathCollision                      = ErrorCode(31250) // Location31250
+	ErrProjectionInEx                     = ErrorCode(31253) // Location31253
+	ErrProjectionExIn                     = ErrorCode(31254) // Location31254
+	ErrTextScoreNotAvailable              = ErrorCode(40218) // Location40218
+	ErrRegexOptions                       = ErrorCode(51075) // Location51075
+	ErrMinMaxWithoutHint                  = ErrorCode(51173) // Location51173
 )
 
 // Error represents wire protocol error.
@@ -10,53 +10,92 @@ func _() {
 	var x [1]struct{}
 	_ = x[errInternalError-1]
 	_ = x[ErrBadValue-2]
+	_ = x[ErrHostUnreachable-6]
+	_ = x[ErrFailedToParse-9]
+	_ = x[ErrUnauthorized-13]
+	_ = x[ErrTypeMismatch-14]
+	_ = x[ErrOverflow-15]
+	_ = x[ErrAuthenticationFailed-18]
+	_ = x[ErrIllegalOperation-20]
 	_ = x[ErrNamespaceNotFound-26]
+	_ = x[ErrIndexNotFound-27]
+	_ = x[ErrPathNotViable-28]
+	_ = x[ErrConflictingUpdateOperators-40]
+	_ = x[ErrCursorNotFound-43]
 	_ = x[ErrNamespaceExists-48]
+	_ = x[ErrMaxTimeMSExpired-50]
+	_ = x[ErrDollarPrefixedFieldName-52]
+	_ = x[ErrDottedFieldName-57]
 	_ = x[ErrCommandNotFound-59]
+	_ = x[ErrInvalidOptions-72]
+	_ = x[ErrInvalidNamespace-73]
+	_ = x[ErrIndexOptionsConflict-85]
+	_ = x[ErrTransactionTooOld-225]
 	_ = x[ErrNotImplemented-238]
+	_ = x[ErrNoSuchTransaction-251]
+	_ = x[ErrOperationNotSupportedInTransaction-263]
+	_ = x[ErrIndexBuildAborted-276]
+	_ = x[ErrNotWritablePrimary-10107]
+	_ = x[ErrBSONObjectTooLarge-10334]
 	_ = x[ErrSortBadValue-15974]
+	_ = x[ErrInvalidVariableStart-16870]
+	_ = x[ErrInvalidVariableChar-16871]
+	_ = x[ErrUndefinedVariable-17276]
+	_ = x[ErrPathCollision-31250]
 	_ = x[ErrProjectionInEx-31253]
 	_ = x[ErrProjectionExIn-31254]
+	_ = x[ErrTextScoreNotAvailable-40218]
 	_ = x[ErrRegexOptions-51075]
+	_ = x[ErrMinMaxWithoutHint-51173]
 }
 
-const (
-	_ErrorCode_name_0 = "InternalErrorBadValue"
-	_ErrorCode_name_1 = "NamespaceNotFound"
-	_ErrorCode_name_2 = "NamespaceExists"
-	_ErrorCode_name_3 = "CommandNotFound"
-	_ErrorCode_name_4 = "NotImplemented"
-	_ErrorCode_name_5 = "SortBadValue"
-	_ErrorCode_name_6 = "Location31253Location31254"
-	_ErrorCode_name_7 = "Location51075"
-)
+const _ErrorCode_name = "InternalErrorBadValueHostUnreachableFailedToParseUnauthorizedTypeMismatchOverflowAuthenticationFailedIllegalOperationNamespaceNotFoundIndexNotFoundPathNotViableConflictingUpdateOperatorsCursorNotFoundNamespaceExistsMaxTimeMSExpiredDollarPrefixedFieldNameDottedFieldNameCommandNotFoundInvalidOptionsInvalidNamespaceIndexOptionsConflictTransactionTooOldNotImplementedNoSuchTransactionOperationNotSupportedInTransactionIndexBuildAbortedNotWritablePrimaryBSONObjectTooLargeSortBadValueLocation16870Location16871Location17276Location31250Location31253Location31254Location40218Location51075Location51173"
 
-var (
-	_ErrorCode_index_0 = [...]uint8{0, 13, 21}
-	_ErrorCode_index_6 = [...]uint8{0, 13, 26}
-)
+var _ErrorCode_map = map[ErrorCode]string{
+	1:     _ErrorCode_name[0:13],
+	2:     _ErrorCode_name[13:21],
+	6:     _ErrorCode_name[21:36],
+	9:     _ErrorCode_name[36:49],
+	13:    _ErrorCode_name[49:61],
+	14:    _ErrorCode_name[61:73],
+	15:    _ErrorCode_name[73:81],
+	18:    _ErrorCode_name[81:101],
+	20:    _ErrorCode_name[101:117],
+	26:    _ErrorCode_name[117:134],
+	27:    _ErrorCode_name[134:147],
+	28:    _ErrorCode_name[147:160],
+	40:    _ErrorCode_name[160:186],
+	43:    _ErrorCode_name[186:200],
+	48:    _ErrorCode_name[200:215],
+	50:    _ErrorCode_name[215:231],
+	52:    _ErrorCode_name[231:254],
+	57:    _ErrorCode_name[254:269],
+	59:    _ErrorCode_name[269:284],
+	72:    _ErrorCode_name[284:298],
+	73:    _ErrorCode_name[298:314],
+	85:    _ErrorCode_name[314:334],
+	225:   _ErrorCode_name[334:351],
+	238:   _ErrorCode_name[351:365],
+	251:   _ErrorCode_name[365:382],
+	263:   _ErrorCode_name[382:416],
+	276:   _ErrorCode_name[416:433],
+	10107: _ErrorCode_name[433:451],
+	10334: _ErrorCode_name[451:469],
+	15974: _ErrorCode_name[469:481],
+	16870: _ErrorCode_name[481:494],
+	16871: _ErrorCode_name[494:507],
+	17276: _ErrorCode_name[507:520],
+	31250: _ErrorCode_name[520:533],
+	31253: _ErrorCode_name[533:546],
+	31254: _ErrorCode_name[546:559],
+	40218: _ErrorCode_name[559:572],
+	51075: _ErrorCode_name[572:585],
+	51173: _ErrorCode_name[585:598],
+}
 
 func (i ErrorCode) String() string {
-	switch {
-	case 1 <= i && i <= 2:
-		i -= 1
-		return _ErrorCode_name_0[_ErrorCode_index_0[i]:_ErrorCode_index_0[i+1]]
-	case i == 26:
-		return _ErrorCode_name_1
-	case i == 48:
-		return _ErrorCode_name_2
-	case i == 59:
-		return _ErrorCode_name_3
-	case i == 238:
-		return _ErrorCode_name_4
-	case i == 15974:
-		return _ErrorCode_name_5
-	case 31253 <= i && i <= 31254:
-		i -= 31253
-		return _ErrorCode_name_6[_ErrorCode_index_6[i]:_ErrorCode_index_6[i+1]]
-	case i == 51075:
-		return _ErrorCode_name_7
-	default:
-		return "ErrorCode(" + strconv.FormatInt(int64(i), 10) + ")"
+	if str, ok := _ErrorCode_map[i]; ok {
+		return str
 	}
+	return "ErrorCode(" + strconv.FormatInt(int64(i), 10) + ")"
 }
@@ -0,0 +1,259 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// exprComparisons are the SQL operators of the comparison operators of $expr.
+var exprComparisons = map[string]string{
+	"$eq":  " = ",
+	"$ne":  " <> ",
+	"$gt":  " > ",
+	"$gte": " >= ",
+	"$lt":  " < ",
+	"$lte": " <= ",
+}
+
+// ApplyLet returns the filter with the variables of let, like "$$minPrice", replaced by their values in its $expr,
+// so that the SQL of the filter compares with the values. let is the let option of find, update or delete.
+// Variables are only replaced in $expr; elsewhere "$$minPrice" is a string, like in MongoDB.
+func ApplyLet(filter types.Document, let any) (types.Document, error) {
+	vars, err := letVariables(let)
+	if err != nil {
+		return filter, err
+	}
+
+	res, err := applyLet(filter, vars, false)
+	if err != nil {
+		return filter, err
+	}
+
+	return res.(types.Document), nil
+}
+
+// ApplyLetToExpression returns the aggregation expression with the variables of let replaced by their values,
+// like the stages of an update with an aggregation pipeline.
+func ApplyLetToExpression(expr any, let any) (any, error) {
+	vars, err := letVariables(let)
+	if err != nil {
+		return expr, err
+	}
+
+	return applyLet(expr, vars, true)
+}
+
+// letVariables returns the validated variables of let.
+func letVariables(let any) (map[string]any, error) {
+	switch let := let.(type) {
+	case nil:
+		return nil, nil
+	case types.Document:
+		for _, name := range let.Keys() {
+			if err := validateVariableName(name); err != nil {
+				return nil, err
+			}
+		}
+		return let.Map(), nil
+	default:
+		return nil, NewErrorMessage(ErrTypeMismatch, "BSON field 'let' is the wrong type '%s', expected type 'object'", typeName(let))
+	}
+}
+
+// validateVariableName checks that the name of a user variable starts with a lowercase or non-ASCII letter
+// and only contains letters, digits and underscores.
+func validateVariableName(name string) error {
+	if name == "" {
+		return NewErrorMessage(ErrInvalidVariableStart, "empty variable names are not allowed")
+	}
+
+	for i, r := range name {
+		if r > unicode.MaxASCII {
+			continue
+		}
+		if i == 0 && !unicode.IsLower(r) {
+			return NewErrorMessage(ErrInvalidVariableStart, "'%s' starts with an invalid character for a user variable name", name)
+		}
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return NewErrorMessage(ErrInvalidVariableChar, "'%s' contains an invalid character for a variable name: '%c'", name, r)
+		}
+	}
+
+	return nil
+}
+
+// applyLet replaces the variables in value, which is part of a $expr if inExpr is true.
+// Replaced values are wrapped in $literal, so that strings like "$name" are not read as field paths.
+func applyLet(value any, vars map[string]any, inExpr bool) (any, error) {
+	switch value := value.(type) {
+	case types.Document:
+		pairs := make([]any, 0, 2*len(value.Keys()))
+		for _, k := range value.Keys() {
+			v, err := applyLet(value.Map()[k], vars, inExpr || k == "$expr")
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, k, v)
+		}
+		return types.MakeDocument(pairs...)
+
+	case *types.Array:
+		res := types.MakeArray(value.Len())
+		for i := 0; i < value.Len(); i++ {
+			v, _ := value.Get(i)
+			if v, err := applyLet(v, vars, inExpr); err != nil {
+				return nil, err
+			} else if err = res.Append(v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+
+	case string:
+		if !inExpr || !strings.HasPrefix(value, "$$") {
+			return value, nil
+		}
+
+		// system variables like $$NOW start with an uppercase letter and are left to exprSQL
+		name := strings.TrimPrefix(value, "$$")
+		if name == "" || unicode.IsUpper([]rune(name)[0]) {
+			return value, nil
+		}
+
+		if strings.Contains(name, ".") {
+			return nil, NewErrorMessage(ErrNotImplemented, "support for fields of variables like %s is not implemented yet", value)
+		}
+
+		v, ok := vars[name]
+		if !ok {
+			return nil, NewErrorMessage(ErrUndefinedVariable, "Use of undefined variable: %s", name)
+		}
+
+		return types.MustMakeDocument("$literal", v), nil
+
+	default:
+		return value, nil
+	}
+}
+
+// exprSQL converts the aggregation expression of $expr, which must be true for matching documents, to SQL.
+// It supports $and, $or, $not and comparisons of fields like "$price", literals and variables of let.
+// Literals are bound to parameters of p.
+func exprSQL(expr any, collation *Collation, p *Placeholder) (string, error) {
+	doc, ok := expr.(types.Document)
+	if !ok || len(doc.Keys()) != 1 {
+		return "", NewErrorMessage(ErrNotImplemented, "$expr only supports expressions with one operator like {$gt: [\"$a\", \"$b\"]} yet")
+	}
+
+	op := doc.Keys()[0]
+	args, ok := doc.Map()[op].(*types.Array)
+	if !ok {
+		args = types.MustNewArray(doc.Map()[op])
+	}
+
+	switch op {
+	case "$and", "$or":
+		parts := make([]string, args.Len())
+		for i := range parts {
+			arg, _ := args.Get(i)
+
+			var err error
+			if parts[i], err = exprSQL(arg, collation, p); err != nil {
+				return "", err
+			}
+		}
+		if len(parts) == 0 {
+			return map[string]string{"$and": "1 = 1", "$or": "1 = 0"}[op], nil
+		}
+		return "(" + strings.Join(parts, strings.ToUpper(" "+op[1:]+" ")) + ")", nil
+
+	case "$not":
+		if args.Len() != 1 {
+			return "", NewErrorMessage(ErrBadValue, "Expression $not takes exactly 1 arguments. %d were passed in.", args.Len())
+		}
+		arg, _ := args.Get(0)
+		sql, err := exprSQL(arg, collation, p)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + sql + ")", nil
+
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		if args.Len() != 2 {
+			return "", NewErrorMessage(ErrBadValue, "Expression %s takes exactly 2 arguments. %d were passed in.", op, args.Len())
+		}
+		return exprComparisonSQL(op, args, collation, p)
+
+	default:
+		return "", NewErrorMessage(ErrNotImplemented, "support for %s in $expr is not implemented yet", op)
+	}
+}
+
+// exprComparisonSQL converts the comparison of two operands of $expr to SQL.
+// Strings are compared according to the collation, and a field is compared with null like in a filter.
+func exprComparisonSQL(op string, args *types.Array, collation *Collation, p *Placeholder) (string, error) {
+	var sqls [2]string
+	var literals [2]any
+	var fields [2]bool
+	for i := range sqls {
+		arg, _ := args.Get(i)
+
+		var err error
+		if sqls[i], literals[i], fields[i], err = exprOperandSQL(arg, p); err != nil {
+			return "", err
+		}
+	}
+
+	for i := range sqls {
+		// j is the other operand
+		j := 1 - i
+		if !fields[i] || fields[j] {
+			continue
+		}
+
+		if literals[j] == nil && (op == "$eq" || op == "$ne") {
+			return nullSQL(sqls[i], op), nil
+		}
+		if _, ok := literals[j].(time.Time); ok {
+			sqls[i] = dateKey(sqls[i])
+		}
+		sqls[i], sqls[j] = collation.collate(sqls[i], sqls[j], literals[j])
+	}
+
+	return sqls[0] + exprComparisons[op] + sqls[1], nil
+}
+
+// exprOperandSQL converts an operand of a comparison of $expr to SQL,
+// and returns the literal value, or whether it is a field.
+func exprOperandSQL(arg any, p *Placeholder) (sql string, literal any, field bool, err error) {
+	if s, ok := arg.(string); ok && strings.HasPrefix(s, "$") {
+		if strings.HasPrefix(s, "$$") {
+			err = NewErrorMessage(ErrNotImplemented, "support for the variable %s in $expr is not implemented yet", s)
+			return
+		}
+
+		sql, err = whereKey(strings.TrimPrefix(s, "$"))
+		field = true
+		return
+	}
+
+	if doc, ok := arg.(types.Document); ok {
+		if v, ok := doc.Map()["$literal"]; ok && len(doc.Keys()) == 1 {
+			arg = v
+		} else if len(doc.Keys()) > 0 && strings.HasPrefix(doc.Keys()[0], "$") {
+			err = NewErrorMessage(ErrNotImplemented, "support for %s in $expr is not implemented yet", doc.Keys()[0])
+			return
+		}
+	}
+
+	sql, _, err = whereValue(arg, p)
+	literal = arg
+	return
+}
@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestApplyLet(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		filter   types.Document
+		let      any
+		expected types.Document
+		err      string
+	}{
+		"None": {
+			filter:   types.MustMakeDocument("name", "$$name"),
+			expected: types.MustMakeDocument("name", "$$name"),
+		},
+		"Expr": {
+			filter: types.MustMakeDocument(
+				"name", "$$name",
+				"$expr", types.MustMakeDocument("$lt", types.MustNewArray("$price", "$$maxPrice")),
+			),
+			let: types.MustMakeDocument("maxPrice", int32(5), "name", "x"),
+			expected: types.MustMakeDocument(
+				"name", "$$name",
+				"$expr", types.MustMakeDocument("$lt", types.MustNewArray("$price", types.MustMakeDocument("$literal", int32(5)))),
+			),
+		},
+		"SystemVariable": {
+			filter:   types.MustMakeDocument("$expr", types.MustMakeDocument("$lt", types.MustNewArray("$date", "$$NOW"))),
+			expected: types.MustMakeDocument("$expr", types.MustMakeDocument("$lt", types.MustNewArray("$date", "$$NOW"))),
+		},
+		"Undefined": {
+			filter: types.MustMakeDocument("$expr", types.MustMakeDocument("$eq", types.MustNewArray("$a", "$$b"))),
+			let:    types.MustMakeDocument("a", int32(1)),
+			err:    "Location17276 (17276): Use of undefined variable: b",
+		},
+		"WrongType": {
+			filter: types.MustMakeDocument(),
+			let:    "a",
+			err:    "TypeMismatch (14): BSON field 'let' is the wrong type 'string', expected type 'object'",
+		},
+		"InvalidStart": {
+			filter: types.MustMakeDocument(),
+			let:    types.MustMakeDocument("Max", int32(1)),
+			err:    "Location16870 (16870): 'Max' starts with an invalid character for a user variable name",
+		},
+		"InvalidChar": {
+			filter: types.MustMakeDocument(),
+			let:    types.MustMakeDocument("max-price", int32(1)),
+			err:    "Location16871 (16871): 'max-price' contains an invalid character for a variable name: '-'",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ApplyLet(tc.filter, tc.let)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestExprWhereClause(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		expr      types.Document
+		collation *Collation
+		expected  string
+		err       string
+	}{
+		"Fields": {
+			expr:     types.MustMakeDocument("$gt", types.MustNewArray("$spent", "$budget")),
+			expected: ` WHERE "spent" > "budget"`,
+		},
+		"Literal": {
+			expr:     types.MustMakeDocument("$lte", types.MustNewArray(types.MustMakeDocument("$literal", "$5"), "$price")),
+			expected: ` WHERE '$5' <= "price"`,
+		},
+		"Collation": {
+			expr:      types.MustMakeDocument("$eq", types.MustNewArray("$name", "abc")),
+			collation: &Collation{Locale: "en", Strength: 2},
+			expected:  ` WHERE UPPER("name") = UPPER('abc')`,
+		},
+		"Null": {
+			expr:     types.MustMakeDocument("$ne", types.MustNewArray("$a.b", nil)),
+			expected: ` WHERE ("a"."b" IS NOT NULL AND "a"."b" IS SET)`,
+		},
+		"Logic": {
+			expr: types.MustMakeDocument("$or", types.MustNewArray(
+				types.MustMakeDocument("$eq", types.MustNewArray("$a", int32(1))),
+				types.MustMakeDocument("$not", types.MustNewArray(types.MustMakeDocument("$lt", types.MustNewArray("$b", "$c")))),
+			)),
+			expected: ` WHERE ("a" = 1 OR NOT ("b" < "c"))`,
+		},
+		"Arguments": {
+			expr: types.MustMakeDocument("$eq", types.MustNewArray("$a")),
+			err:  "BadValue (2): Expression $eq takes exactly 2 arguments. 1 were passed in.",
+		},
+		"Operator": {
+			expr: types.MustMakeDocument("$gt", types.MustNewArray(types.MustMakeDocument("$add", types.MustNewArray("$a", int32(1))), "$b")),
+			err:  "NotImplemented (238): support for $add in $expr is not implemented yet",
+		},
+		"SystemVariable": {
+			expr: types.MustMakeDocument("$lt", types.MustNewArray("$date", "$$NOW")),
+			err:  "NotImplemented (238): support for the variable $$NOW in $expr is not implemented yet",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := boundWhereClause(types.MustMakeDocument("$expr", tc.expr), tc.collation)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// expressionOperatorsSQL are the SQL operators of the arithmetic and string operators of aggregation expressions.
+var expressionOperatorsSQL = map[string]string{
+	"$add":      " + ",
+	"$multiply": " * ",
+	"$concat":   " || ",
+}
+
+// ExpressionSQL converts an aggregation expression of $project to an SQL expression of SAP HANA.
+// It supports field paths like "$a.b", numbers, strings and null, and the operators
+// $literal, $add, $multiply, $concat, $toLower, $cond, $ifNull, $year and $month.
+//
+// $add of dates, $substr, which counts bytes instead of characters, and $year and $month of other expressions than fields
+// are not supported, so that they are evaluated by the proxy.
+func ExpressionSQL(expr any, p *Placeholder) (string, error) {
+	switch expr := expr.(type) {
+	case string:
+		if strings.HasPrefix(expr, "$$") {
+			return "", NewErrorMessage(ErrNotImplemented, "support for the variable %s in SQL expressions is not implemented yet", expr)
+		}
+		if strings.HasPrefix(expr, "$") {
+			return whereKey(strings.TrimPrefix(expr, "$"))
+		}
+		return constantSQL(expr, p)
+
+	case types.Document:
+		if len(expr.Keys()) != 1 || !strings.HasPrefix(expr.Keys()[0], "$") {
+			return "", NewErrorMessage(ErrNotImplemented, "support for documents in SQL expressions is not implemented yet")
+		}
+
+		op := expr.Keys()[0]
+		if op == "$literal" {
+			return constantSQL(expr.Map()[op], p)
+		}
+
+		args, ok := expr.Map()[op].(*types.Array)
+		if !ok {
+			args = types.MustNewArray(expr.Map()[op])
+		}
+
+		return operatorSQL(op, args, p)
+
+	default:
+		return constantSQL(expr, p)
+	}
+}
+
+// operatorSQL converts the operator op of an aggregation expression with its arguments to SQL.
+func operatorSQL(op string, args *types.Array, p *Placeholder) (string, error) {
+	switch op {
+	case "$add", "$multiply", "$concat", "$ifNull":
+		parts := make([]string, args.Len())
+		for i := range parts {
+			arg, _ := args.Get(i)
+
+			var err error
+			if parts[i], err = ExpressionSQL(arg, p); err != nil {
+				return "", err
+			}
+		}
+		if op == "$ifNull" {
+			return "COALESCE(" + strings.Join(parts, ", ") + ")", nil
+		}
+		return "(" + strings.Join(parts, expressionOperatorsSQL[op]) + ")", nil
+
+	case "$toLower":
+		arg, _ := args.Get(0)
+		sql, err := ExpressionSQL(arg, p)
+		if err != nil {
+			return "", err
+		}
+		// like in MongoDB, null is the empty string
+		return "COALESCE(LOWER(" + sql + "), '')", nil
+
+	case "$substr":
+		// SAP HANA counts the characters of strings, but $substr counts their bytes like $substrBytes,
+		// so it is computed by the compatibility layer for non-ASCII strings to have the same substrings
+		return "", NewErrorMessage(ErrNotImplemented, "support for $substr in SQL expressions is not implemented, as SAP HANA counts characters instead of bytes")
+
+	case "$cond":
+		// $cond is either {if: ..., then: ..., else: ...} or [if, then, else]
+		cond, _ := args.Get(0)
+		then, _ := args.Get(1)
+		otherwise, _ := args.Get(2)
+		if doc, ok := cond.(types.Document); ok && args.Len() == 1 {
+			cond, then, otherwise = doc.Map()["if"], doc.Map()["then"], doc.Map()["else"]
+		}
+
+		condSQL, err := exprSQL(cond, nil, p)
+		if err != nil {
+			return "", err
+		}
+		thenSQL, err := ExpressionSQL(then, p)
+		if err != nil {
+			return "", err
+		}
+		otherwiseSQL, err := ExpressionSQL(otherwise, p)
+		if err != nil {
+			return "", err
+		}
+		return "CASE WHEN " + condSQL + " THEN " + thenSQL + " ELSE " + otherwiseSQL + " END", nil
+
+	case "$year", "$month":
+		arg, _ := args.Get(0)
+		field, ok := arg.(string)
+		if !ok || !strings.HasPrefix(field, "$") || strings.HasPrefix(field, "$$") {
+			return "", NewErrorMessage(ErrNotImplemented, "support for %s of other expressions than fields is not implemented yet", op)
+		}
+
+		kSQL, err := whereKey(strings.TrimPrefix(field, "$"))
+		if err != nil {
+			return "", err
+		}
+		// dates are stored as milliseconds since the epoch
+		return strings.ToUpper(op[1:]) + "(ADD_SECONDS(TO_TIMESTAMP('1970-01-01 00:00:00'), " + dateKey(kSQL) + " / 1000))", nil
+
+	default:
+		return "", NewErrorMessage(ErrNotImplemented, "support for %s in SQL expressions is not implemented yet", op)
+	}
+}
+
+// constantSQL converts a constant of an aggregation expression to SQL, binding it to a parameter of p.
+func constantSQL(value any, p *Placeholder) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "NULL", nil
+	case int32, int64, float64, string:
+		return p.Next(value), nil
+	default:
+		return "", NewErrorMessage(ErrNotImplemented, "support for constants of type %s in SQL expressions is not implemented yet", typeName(value))
+	}
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestExpressionSQL(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		expr     any
+		expected string
+		err      string
+	}{
+		"Field": {
+			expr:     "$address.city",
+			expected: `"address"."city"`,
+		},
+		"String": {
+			expr:     "it's",
+			expected: `'it''s'`,
+		},
+		"Literal": {
+			expr:     types.MustMakeDocument("$literal", "$price"),
+			expected: `'$price'`,
+		},
+		"Add": {
+			expr:     types.MustMakeDocument("$add", types.MustNewArray("$price", int32(1), 0.5)),
+			expected: `("price" + 1 + 0.5)`,
+		},
+		"Substr": {
+			expr: types.MustMakeDocument("$substr", types.MustNewArray("$name", int32(1), int32(-1))),
+			err:  "NotImplemented (238): support for $substr in SQL expressions is not implemented, as SAP HANA counts characters instead of bytes",
+		},
+		"Cond": {
+			expr: types.MustMakeDocument("$cond", types.MustNewArray(
+				types.MustMakeDocument("$gt", types.MustNewArray("$qty", int32(10))),
+				"bulk",
+				types.MustMakeDocument("$ifNull", types.MustNewArray("$kind", "single")),
+			)),
+			expected: `CASE WHEN "qty" > 10 THEN 'bulk' ELSE COALESCE("kind", 'single') END`,
+		},
+		"Month": {
+			expr:     types.MustMakeDocument("$month", "$date"),
+			expected: `MONTH(ADD_SECONDS(TO_TIMESTAMP('1970-01-01 00:00:00'), "date"."$da" / 1000))`,
+		},
+		"MonthOfExpression": {
+			expr: types.MustMakeDocument("$month", types.MustMakeDocument("date", "$date")),
+			err:  "NotImplemented (238): support for $month of other expressions than fields is not implemented yet",
+		},
+		"Unsupported": {
+			expr: types.MustMakeDocument("$subtract", types.MustNewArray("$a", "$b")),
+			err:  "NotImplemented (238): support for $subtract in SQL expressions is not implemented yet",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := boundExpression(tc.expr)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,385 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// geoSRID is the spatial reference system used for GeoJSON values (WGS 84), like 2dsphere in MongoDB.
+const geoSRID = 4326
+
+// earthRadiusMeters is the radius MongoDB uses to convert radians of $centerSphere into meters.
+const earthRadiusMeters = 6378100
+
+// geoExpression converts $geoWithin, $geoIntersects and $near to predicates of the SAP HANA spatial engine.
+// kSQL is the already prepared field, and value the operand of the operator.
+func geoExpression(kSQL string, operator string, value any) (kvSQL string, err error) {
+	doc, ok := value.(types.Document)
+	if !ok {
+		err = NewErrorMessage(ErrBadValue, "%s needs an object. Got instead: %T", operator, value)
+		return
+	}
+
+	field := geoField(kSQL)
+
+	switch operator {
+	case "$geowithin":
+		kvSQL, err = geoWithin(field, doc)
+	case "$geointersects":
+		var geomSQL string
+		geomSQL, err = geometryOperand("$geoIntersects", doc)
+		if err != nil {
+			return
+		}
+		kvSQL = field + ".ST_Intersects(" + geomSQL + ") = 1"
+	case "$near":
+		kvSQL, _, err = near(kSQL, doc)
+	default:
+		err = NewErrorMessage(ErrNotImplemented, "support for %s is not implemented yet", operator)
+	}
+
+	return
+}
+
+// geoWithin converts the shapes of $geoWithin ($geometry, $box, $polygon and $centerSphere) to SQL.
+func geoWithin(field string, doc types.Document) (kvSQL string, err error) {
+	if len(doc.Keys()) != 1 {
+		err = NewErrorMessage(ErrBadValue, "$geoWithin needs exactly one shape")
+		return
+	}
+
+	shape := doc.Keys()[0]
+	value := doc.Map()[shape]
+
+	switch shape {
+	case "$geometry":
+		var geomSQL string
+		if geomSQL, err = geometryOperand("$geoWithin", doc); err != nil {
+			return
+		}
+		kvSQL = field + ".ST_Within(" + geomSQL + ") = 1"
+	case "$box":
+		var points [][]float64
+		if points, err = geoPoints(value); err != nil {
+			return
+		}
+		if len(points) != 2 {
+			err = NewErrorMessage(ErrBadValue, "$box needs exactly two points")
+			return
+		}
+		lower, upper := points[0], points[1]
+		ring := [][]float64{lower, {upper[0], lower[1]}, upper, {lower[0], upper[1]}, lower}
+		kvSQL = field + ".ST_Within(" + geometrySQL("POLYGON ("+wktRing(ring)+")") + ") = 1"
+	case "$polygon":
+		var points [][]float64
+		if points, err = geoPoints(value); err != nil {
+			return
+		}
+		if len(points) < 3 {
+			err = NewErrorMessage(ErrBadValue, "$polygon needs at least three points")
+			return
+		}
+		if first, last := points[0], points[len(points)-1]; first[0] != last[0] || first[1] != last[1] {
+			points = append(points, first)
+		}
+		kvSQL = field + ".ST_Within(" + geometrySQL("POLYGON ("+wktRing(points)+")") + ") = 1"
+	case "$centerSphere":
+		arr, ok := value.(*types.Array)
+		if !ok || arr.Len() != 2 {
+			err = NewErrorMessage(ErrBadValue, "$centerSphere needs a center and a radius")
+			return
+		}
+		center, _ := arr.Get(0)
+		var point []float64
+		if point, err = geoPosition(center); err != nil {
+			return
+		}
+		radius, _ := arr.Get(1)
+		var radians float64
+		if radians, err = geoNumber(radius); err != nil {
+			return
+		}
+		meters := radians * earthRadiusMeters
+		if math.IsInf(meters, 0) {
+			err = NewErrorMessage(ErrBadValue, "$centerSphere radius is out of range")
+			return
+		}
+		kvSQL = field + ".ST_Distance(" + geometrySQL("POINT ("+wktPosition(point)+")") + ", 'meter') <= " +
+			formatGeoNumber(meters)
+	default:
+		err = NewErrorMessage(ErrBadValue, "unknown geo specifier: %s", shape)
+	}
+
+	return
+}
+
+// near converts $near to a distance predicate. The returned orderSQL sorts by distance, nearest first.
+func near(kSQL string, doc types.Document) (kvSQL string, orderSQL string, err error) {
+	var geomSQL string
+	if geomSQL, err = geometryOperand("$near", doc); err != nil {
+		return
+	}
+
+	geometry, _ := doc.Map()["$geometry"].(types.Document)
+	if geoType, _ := geometry.Map()["type"].(string); geoType != "Point" {
+		err = NewErrorMessage(ErrBadValue, "$near requires a point, given %s", geoType)
+		return
+	}
+
+	distance := geoField(kSQL) + ".ST_Distance(" + geomSQL + ", 'meter')"
+
+	var conditions []string
+	for _, bound := range []struct {
+		key  string
+		sign string
+	}{{"$minDistance", " >= "}, {"$maxDistance", " <= "}} {
+		v, ok := doc.Map()[bound.key]
+		if !ok {
+			continue
+		}
+
+		var d float64
+		if d, err = geoNumber(v); err != nil {
+			return
+		}
+		if d < 0 {
+			err = NewErrorMessage(ErrBadValue, "%s must be non-negative", bound.key)
+			return
+		}
+
+		conditions = append(conditions, distance+bound.sign+formatGeoNumber(d))
+	}
+
+	if len(conditions) == 0 {
+		conditions = append(conditions, kSQL+" IS SET")
+	}
+
+	kvSQL = strings.Join(conditions, " AND ")
+	orderSQL = " ORDER BY " + distance + " ASC"
+
+	return
+}
+
+// NearOrderBy returns the ORDER BY clause sorting by distance if the filter uses $near on a field.
+// MongoDB always returns the documents of $near sorted from nearest to farthest.
+func NearOrderBy(filter types.Document) (orderSQL string, err error) {
+	for _, key := range filter.Keys() {
+		expr, ok := filter.Map()[key].(types.Document)
+		if !ok || strings.HasPrefix(key, "$") {
+			continue
+		}
+
+		for _, op := range expr.Keys() {
+			if !strings.EqualFold(op, "$near") {
+				continue
+			}
+
+			nearDoc, ok := expr.Map()[op].(types.Document)
+			if !ok {
+				err = NewErrorMessage(ErrBadValue, "$near needs an object. Got instead: %T", expr.Map()[op])
+				return
+			}
+
+			var kSQL string
+			if kSQL, err = whereKey(key); err != nil {
+				return
+			}
+
+			_, orderSQL, err = near(kSQL, nearDoc)
+			return
+		}
+	}
+
+	return
+}
+
+// geoField converts the GeoJSON object stored in a field to a geometry.
+func geoField(kSQL string) string {
+	return "ST_GeomFromGeoJSON(" + kSQL + ", " + strconv.Itoa(geoSRID) + ")"
+}
+
+// geometrySQL creates a geometry from well-known text.
+func geometrySQL(wkt string) string {
+	return "ST_GeomFromText('" + wkt + "', " + strconv.Itoa(geoSRID) + ")"
+}
+
+// geometryOperand converts {$geometry: <GeoJSON>} to a geometry.
+func geometryOperand(operator string, doc types.Document) (string, error) {
+	geometry, ok := doc.Map()["$geometry"].(types.Document)
+	if !ok {
+		return "", NewErrorMessage(ErrBadValue, "%s needs a $geometry object", operator)
+	}
+
+	wkt, err := geoJSONToWKT(geometry)
+	if err != nil {
+		return "", err
+	}
+
+	return geometrySQL(wkt), nil
+}
+
+// geoJSONToWKT converts a GeoJSON object to well-known text.
+func geoJSONToWKT(geometry types.Document) (string, error) {
+	geoType, ok := geometry.Map()["type"].(string)
+	if !ok {
+		return "", NewErrorMessage(ErrBadValue, "GeoJSON object needs a type")
+	}
+
+	coordinates, ok := geometry.Map()["coordinates"].(*types.Array)
+	if !ok {
+		return "", NewErrorMessage(ErrBadValue, "GeoJSON object needs coordinates given as an array")
+	}
+
+	switch geoType {
+	case "Point":
+		point, err := geoPosition(coordinates)
+		if err != nil {
+			return "", err
+		}
+		return "POINT (" + wktPosition(point) + ")", nil
+
+	case "LineString":
+		points, err := geoPoints(coordinates)
+		if err != nil {
+			return "", err
+		}
+		return "LINESTRING " + wktRing(points), nil
+
+	case "MultiPoint":
+		points, err := geoPoints(coordinates)
+		if err != nil {
+			return "", err
+		}
+		parts := make([]string, len(points))
+		for i, p := range points {
+			parts[i] = "(" + wktPosition(p) + ")"
+		}
+		return "MULTIPOINT (" + strings.Join(parts, ", ") + ")", nil
+
+	case "Polygon", "MultiLineString":
+		rings, err := geoRings(coordinates)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToUpper(geoType) + " (" + rings + ")", nil
+
+	case "MultiPolygon":
+		polygons := make([]string, coordinates.Len())
+		for i := 0; i < coordinates.Len(); i++ {
+			v, _ := coordinates.Get(i)
+			polygon, ok := v.(*types.Array)
+			if !ok {
+				return "", NewErrorMessage(ErrBadValue, "MultiPolygon coordinates must be an array of polygons")
+			}
+			rings, err := geoRings(polygon)
+			if err != nil {
+				return "", err
+			}
+			polygons[i] = "(" + rings + ")"
+		}
+		return "MULTIPOLYGON (" + strings.Join(polygons, ", ") + ")", nil
+
+	default:
+		return "", NewErrorMessage(ErrBadValue, "unknown GeoJSON type: %s", geoType)
+	}
+}
+
+// geoRings converts an array of arrays of positions to well-known text.
+func geoRings(coordinates *types.Array) (string, error) {
+	rings := make([]string, coordinates.Len())
+	for i := 0; i < coordinates.Len(); i++ {
+		v, _ := coordinates.Get(i)
+		points, err := geoPoints(v)
+		if err != nil {
+			return "", err
+		}
+		rings[i] = wktRing(points)
+	}
+
+	return strings.Join(rings, ", "), nil
+}
+
+// geoPoints converts an array of positions.
+func geoPoints(value any) ([][]float64, error) {
+	arr, ok := value.(*types.Array)
+	if !ok {
+		return nil, NewErrorMessage(ErrBadValue, "expected an array of points. Got instead: %T", value)
+	}
+
+	points := make([][]float64, arr.Len())
+	for i := 0; i < arr.Len(); i++ {
+		v, _ := arr.Get(i)
+		p, err := geoPosition(v)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = p
+	}
+
+	return points, nil
+}
+
+// geoPosition converts a position [longitude, latitude].
+func geoPosition(value any) ([]float64, error) {
+	arr, ok := value.(*types.Array)
+	if !ok || arr.Len() != 2 {
+		return nil, NewErrorMessage(ErrBadValue, "a point must be an array of longitude and latitude")
+	}
+
+	position := make([]float64, 2)
+	for i := range position {
+		v, _ := arr.Get(i)
+		n, err := geoNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		position[i] = n
+	}
+
+	return position, nil
+}
+
+// geoNumber converts any numeric value to float64.
+// NaN and infinite values are rejected, as they can't be formatted as WKT numbers.
+func geoNumber(value any) (float64, error) {
+	switch value := value.(type) {
+	case float64:
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, NewErrorMessage(ErrBadValue, "expected a finite number. Got instead: %v", value)
+		}
+		return value, nil
+	case int32:
+		return float64(value), nil
+	case int64:
+		return float64(value), nil
+	default:
+		return 0, NewErrorMessage(ErrBadValue, "expected a number. Got instead: %T", value)
+	}
+}
+
+// wktRing formats a list of positions as (x y, x y, ...).
+func wktRing(points [][]float64) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = wktPosition(p)
+	}
+
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// wktPosition formats a position as x y.
+func wktPosition(p []float64) string {
+	return formatGeoNumber(p[0]) + " " + formatGeoNumber(p[1])
+}
+
+// formatGeoNumber formats a finite number of geoNumber for WKT and SQL.
+func formatGeoNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearOrderBy(t *testing.T) {
+	t.Run("filter with $near", func(t *testing.T) {
+		filter := types.MustMakeDocument(
+			"name", "park",
+			"loc", types.MustMakeDocument("$near", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "Point", "coordinates", types.MustNewArray(int32(8), float64(49.5))),
+			)),
+		)
+
+		orderSQL, err := NearOrderBy(filter)
+
+		assert.Nil(t, err)
+		assert.Equal(t, " ORDER BY ST_GeomFromGeoJSON(\"loc\", 4326).ST_Distance(ST_GeomFromText('POINT (8 49.5)', 4326), 'meter') ASC", orderSQL)
+	})
+
+	t.Run("filter without $near", func(t *testing.T) {
+		orderSQL, err := NearOrderBy(types.MustMakeDocument("loc", types.MustMakeDocument("$exists", true)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "", orderSQL)
+	})
+}
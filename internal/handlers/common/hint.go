@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+const (
+	// idIndexName is the name of the index of _id, which every collection has in MongoDB.
+	idIndexName = "_id_"
+
+	// indexSearchHint makes SAP HANA prefer an index search, for hints of an index.
+	indexSearchHint = " WITH HINT(INDEX_SEARCH)"
+
+	// noIndexSearchHint makes SAP HANA scan the collection, for the hint {$natural: 1}.
+	noIndexSearchHint = " WITH HINT(NO_INDEX_SEARCH)"
+)
+
+// HintSQL returns the WITH HINT clause of SAP HANA, to be appended to the statement,
+// for the hint of find, count, update or delete, which is an index name or key pattern.
+//
+// The indexes of a collection are the index of _id and the text index in its options.
+// A hint of another index fails with BadValue like in MongoDB.
+func HintSQL(hint any, opts *hana.CollectionOptions) (string, error) {
+	switch hint := hint.(type) {
+	case nil:
+		return "", nil
+	case string:
+		if hint == idIndexName || (opts.TextIndex != nil && hint == opts.TextIndex.Name) {
+			return indexSearchHint, nil
+		}
+	case types.Document:
+		if natural, ok := hint.Map()["$natural"]; ok && len(hint.Keys()) == 1 {
+			if natural != int32(1) && natural != int32(-1) && natural != float64(1) && natural != float64(-1) {
+				return "", NewErrorMessage(ErrBadValue, "$natural hint must be 1 or -1")
+			}
+			return noIndexSearchHint, nil
+		}
+
+		if isIDKeyPattern(hint) || isTextKeyPattern(hint, opts.TextIndex) {
+			return indexSearchHint, nil
+		}
+	default:
+		return "", NewErrorMessage(ErrBadValue, "hint must be either a string or nested object")
+	}
+
+	return "", NewErrorMessage(ErrBadValue, "hint provided does not correspond to an existing index")
+}
+
+// ReturnKeyProjection returns the inclusion projection of returnKey with the key fields of the index selected for the query.
+// It is the hinted index and the index of _id otherwise, as SAP HANA does not report which index it uses.
+func ReturnKeyProjection(hint any, opts *hana.CollectionOptions) types.Document {
+	fields := []string{"_id"}
+	if textIndex := opts.TextIndex; textIndex != nil {
+		switch hint := hint.(type) {
+		case string:
+			if hint == textIndex.Name {
+				fields = textIndex.Fields
+			}
+		case types.Document:
+			if isTextKeyPattern(hint, textIndex) {
+				fields = textIndex.Fields
+			}
+		}
+	}
+
+	// _id is included by default, so it is excluded unless it is a key field
+	pairs := []any{"_id", false}
+	for _, field := range fields {
+		if field == "_id" {
+			pairs[1] = true
+			continue
+		}
+		pairs = append(pairs, field, true)
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// isIDKeyPattern returns true if the key pattern is the one of the index of _id.
+func isIDKeyPattern(key types.Document) bool {
+	if len(key.Keys()) != 1 {
+		return false
+	}
+
+	switch order := key.Map()["_id"].(type) {
+	case int32:
+		return order == 1 || order == -1
+	case float64:
+		return order == 1 || order == -1
+	default:
+		return false
+	}
+}
+
+// isTextKeyPattern returns true if the key pattern has the fields of the text index, like {title: "text"}.
+func isTextKeyPattern(key types.Document, textIndex *hana.TextIndex) bool {
+	if textIndex == nil {
+		return false
+	}
+
+	for _, field := range key.Keys() {
+		if key.Map()[field] != "text" {
+			return false
+		}
+	}
+
+	return strings.Join(key.Keys(), ",") == strings.Join(textIndex.Fields, ",")
+}
@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestHintSQL(t *testing.T) {
+	t.Parallel()
+
+	opts := &hana.CollectionOptions{
+		TextIndex: &hana.TextIndex{Name: "title_text", Fields: []string{"title"}},
+	}
+
+	for name, tc := range map[string]struct {
+		hint     any
+		opts     *hana.CollectionOptions
+		expected string
+		err      string
+	}{
+		"None": {
+			hint: nil,
+		},
+		"IDName": {
+			hint:     "_id_",
+			expected: " WITH HINT(INDEX_SEARCH)",
+		},
+		"IDKeyPattern": {
+			hint:     types.MustMakeDocument("_id", int32(-1)),
+			expected: " WITH HINT(INDEX_SEARCH)",
+		},
+		"TextName": {
+			hint:     "title_text",
+			expected: " WITH HINT(INDEX_SEARCH)",
+		},
+		"TextKeyPattern": {
+			hint:     types.MustMakeDocument("title", "text"),
+			expected: " WITH HINT(INDEX_SEARCH)",
+		},
+		"Natural": {
+			hint:     types.MustMakeDocument("$natural", float64(1)),
+			expected: " WITH HINT(NO_INDEX_SEARCH)",
+		},
+		"InvalidNatural": {
+			hint: types.MustMakeDocument("$natural", int32(2)),
+			err:  "BadValue (2): $natural hint must be 1 or -1",
+		},
+		"UnknownName": {
+			hint: "name_1",
+			err:  "BadValue (2): hint provided does not correspond to an existing index",
+		},
+		"UnknownKeyPattern": {
+			hint: types.MustMakeDocument("name", int32(1)),
+			err:  "BadValue (2): hint provided does not correspond to an existing index",
+		},
+		"NoTextIndex": {
+			hint: "title_text",
+			opts: new(hana.CollectionOptions),
+			err:  "BadValue (2): hint provided does not correspond to an existing index",
+		},
+		"WrongType": {
+			hint: int32(1),
+			err:  "BadValue (2): hint must be either a string or nested object",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			o := tc.opts
+			if o == nil {
+				o = opts
+			}
+
+			actual, err := HintSQL(tc.hint, o)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestReturnKeyProjection(t *testing.T) {
+	t.Parallel()
+
+	opts := &hana.CollectionOptions{
+		TextIndex: &hana.TextIndex{Name: "title_body_text", Fields: []string{"title", "body"}},
+	}
+
+	id := types.MustMakeDocument("_id", true)
+	text := types.MustMakeDocument("_id", false, "title", true, "body", true)
+
+	assert.Equal(t, id, ReturnKeyProjection(nil, opts))
+	assert.Equal(t, id, ReturnKeyProjection("title_body_text", new(hana.CollectionOptions)))
+	assert.Equal(t, id, ReturnKeyProjection("_id_", opts))
+	assert.Equal(t, text, ReturnKeyProjection("title_body_text", opts))
+	assert.Equal(t, text, ReturnKeyProjection(types.MustMakeDocument("title", "text", "body", "text"), opts))
+}
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+)
+
+// int64SQL returns the SQL of an int64 as it is stored in SAP HANA, see fjson.Int64,
+// binding its key and number to parameters of p.
+func int64SQL(v int64, p *Placeholder) string {
+	if !fjson.IsInt64Key(v) {
+		return p.Next(v)
+	}
+
+	return "{\"$l\": " + p.Next(fjson.Int64Key(v)) + ", \"$n\": " + p.Next(v) + "}"
+}
+
+// isNumber returns true for the numeric types int32, int64 and float64.
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int32, int64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// numberSQL converts the comparison of the field kSQL with a number to SQL.
+// int64 values which are no exact doubles are stored as {"$l": key, "$n": number}, see fjson.Int64.
+// They are compared by their keys, which are exact and ordered like the values, with such int64 values,
+// and by their numbers with other numbers, which are all less or greater than them.
+// Each use of the number is bound to its own parameter of p.
+func numberSQL(kSQL, operator string, value any, p *Placeholder) string {
+	if v, ok := value.(int64); ok && fjson.IsInt64Key(v) {
+		lSQL := kSQL + ".\"$l\""
+
+		switch operator {
+		case "$eq":
+			return lSQL + " = " + p.Next(fjson.Int64Key(v))
+		case "$ne":
+			return "(" + lSQL + " <> " + p.Next(fjson.Int64Key(v)) + " OR " + lSQL + " IS UNSET)"
+		default:
+			sign := rangeSign(operator)
+			return "((" + bracketSQL(kSQL, value) + " AND " + kSQL + sign + p.Next(value) + ") OR " + lSQL + sign + p.Next(fjson.Int64Key(v)) + ")"
+		}
+	}
+
+	switch operator {
+	case "$eq":
+		return kSQL + " = " + p.Next(value)
+	case "$ne":
+		return "(" + kSQL + " <> " + p.Next(value) + " OR " + kSQL + " IS UNSET)"
+	default:
+		sign := rangeSign(operator)
+		return "((" + bracketSQL(kSQL, value) + " AND " + kSQL + sign + p.Next(value) + ") OR " + kSQL + ".\"$n\"" + sign + p.Next(value) + ")"
+	}
+}
+
+// rangeSign returns the SQL sign of a range comparison operator like $gt.
+func rangeSign(operator string) string {
+	switch operator {
+	case "$gt":
+		return " > "
+	case "$gte":
+		return " >= "
+	case "$lt":
+		return " < "
+	case "$lte":
+		return " <= "
+	default:
+		panic(fmt.Sprintf("unexpected operator %s", operator))
+	}
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// KeyValidation selects which keys of inserted and updated documents are rejected.
+// Keys with "." can't be queried by dot notation, and keys starting with "$" are mistaken for operators,
+// so MongoDB rejected them before version 5.0.
+type KeyValidation int
+
+const (
+	// RejectDottedDollarKeys rejects keys containing "." or starting with "$", like MongoDB before 5.0.
+	// The keys "$ref", "$id" and "$db" of DBRefs are allowed.
+	RejectDottedDollarKeys KeyValidation = iota
+
+	// AllowDottedDollarKeys allows them like MongoDB 5.0, except keys starting with "$" in _id
+	// and the keys of the stored format, like "$da" of dates, which would be read as values of other types.
+	AllowDottedDollarKeys
+)
+
+// ValidateDocument returns an error if a key of the document to be stored, or of its embedded documents, is not allowed.
+func (v KeyValidation) ValidateDocument(doc types.Document) error {
+	return v.validateDocument(doc, "", false)
+}
+
+// ValidateUpdate returns an error if a key of the documents set by the update document is not allowed,
+// or of the replacement document if it has no update operators.
+func (v KeyValidation) ValidateUpdate(update types.Document) error {
+	var operators bool
+	for _, key := range update.Keys() {
+		if strings.HasPrefix(key, "$") {
+			operators = true
+			break
+		}
+	}
+
+	if !operators {
+		return v.ValidateDocument(update)
+	}
+
+	for _, operator := range []string{"$set", "$push"} {
+		fields, ok := update.Map()[operator].(types.Document)
+		if !ok {
+			continue
+		}
+
+		for _, path := range fields.Keys() {
+			value := fields.Map()[path]
+
+			// values of $push may be modified by $each
+			if each, ok := value.(types.Document); ok && operator == "$push" {
+				if values, ok := each.Map()["$each"]; ok {
+					value = values
+				}
+			}
+
+			if err := v.validateValue(value, path, strings.HasPrefix(path, "_id.") || path == "_id"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateDocument validates the keys of the document at path, which is in _id if id is true.
+func (v KeyValidation) validateDocument(doc types.Document, path string, id bool) error {
+	for _, key := range doc.Keys() {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		inID := id || keyPath == "_id"
+		if err := v.validateKey(key, keyPath, inID); err != nil {
+			return err
+		}
+
+		if err := v.validateValue(doc.Map()[key], keyPath, inID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateValue validates the keys of the documents in the value at path.
+func (v KeyValidation) validateValue(value any, path string, id bool) error {
+	switch value := value.(type) {
+	case types.Document:
+		return v.validateDocument(value, path, id)
+
+	case *types.Array:
+		for i := 0; i < value.Len(); i++ {
+			elem, _ := value.Get(i)
+			if err := v.validateValue(elem, path, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateKey validates the key at path, which is in _id if id is true.
+func (v KeyValidation) validateKey(key, path string, id bool) error {
+	dollar := strings.HasPrefix(key, "$")
+
+	switch {
+	case dollar && id && path != "_id":
+		return NewErrorMessage(ErrDollarPrefixedFieldName, "_id fields may not contain '$'-prefixed fields: %s is not valid for storage.", key)
+
+	case v == AllowDottedDollarKeys:
+		if dollar && fjson.IsReservedKey(key) {
+			return NewErrorMessage(ErrDollarPrefixedFieldName, "The dollar ($) prefixed field '%s' in '%s' is reserved for storage in SAP HANA.", key, path)
+		}
+		return nil
+
+	case dollar && key != "$ref" && key != "$id" && key != "$db":
+		return NewErrorMessage(ErrDollarPrefixedFieldName, "The dollar ($) prefixed field '%s' in '%s' is not valid for storage.", key, path)
+
+	case strings.Contains(key, "."):
+		return NewErrorMessage(ErrDottedFieldName, "The dotted field '%s' in '%s' is not valid for storage.", key, path)
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestKeyValidation(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		doc    types.Document
+		update bool
+		reject string // error of RejectDottedDollarKeys, none if empty
+		allow  string // error of AllowDottedDollarKeys, none if empty
+	}{
+		"Valid": {
+			doc: types.MustMakeDocument("_id", int32(1), "a", types.MustMakeDocument("b", types.MustNewArray(int32(1)))),
+		},
+		"DBRef": {
+			doc: types.MustMakeDocument("ref", types.MustMakeDocument("$ref", "c", "$id", int32(1), "$db", "db")),
+		},
+		"Dollar": {
+			doc:    types.MustMakeDocument("a", types.MustMakeDocument("$foo", int32(1))),
+			reject: "DollarPrefixedFieldName (52): The dollar ($) prefixed field '$foo' in 'a.$foo' is not valid for storage.",
+		},
+		"Dotted": {
+			doc:    types.MustMakeDocument("a", types.MustNewArray(types.MustMakeDocument("b.c", int32(1)))),
+			reject: "DottedFieldName (57): The dotted field 'b.c' in 'a.b.c' is not valid for storage.",
+		},
+		"ID": {
+			doc:    types.MustMakeDocument("_id", types.MustMakeDocument("$foo", int32(1))),
+			reject: "DollarPrefixedFieldName (52): _id fields may not contain '$'-prefixed fields: $foo is not valid for storage.",
+			allow:  "DollarPrefixedFieldName (52): _id fields may not contain '$'-prefixed fields: $foo is not valid for storage.",
+		},
+		"Reserved": {
+			doc:    types.MustMakeDocument("d", types.MustMakeDocument("$da", int32(0))),
+			reject: "DollarPrefixedFieldName (52): The dollar ($) prefixed field '$da' in 'd.$da' is not valid for storage.",
+			allow:  "DollarPrefixedFieldName (52): The dollar ($) prefixed field '$da' in 'd.$da' is reserved for storage in SAP HANA.",
+		},
+		"Replacement": {
+			doc:    types.MustMakeDocument("a.b", int32(1)),
+			update: true,
+			reject: "DottedFieldName (57): The dotted field 'a.b' in 'a.b' is not valid for storage.",
+		},
+		"SetPath": {
+			doc:    types.MustMakeDocument("$set", types.MustMakeDocument("a.b", int32(1))),
+			update: true,
+		},
+		"SetValue": {
+			doc:    types.MustMakeDocument("$set", types.MustMakeDocument("a.b", types.MustMakeDocument("$foo", int32(1)))),
+			update: true,
+			reject: "DollarPrefixedFieldName (52): The dollar ($) prefixed field '$foo' in 'a.b.$foo' is not valid for storage.",
+		},
+		"SetID": {
+			doc:    types.MustMakeDocument("$set", types.MustMakeDocument("_id", types.MustMakeDocument("$foo", int32(1)))),
+			update: true,
+			reject: "DollarPrefixedFieldName (52): _id fields may not contain '$'-prefixed fields: $foo is not valid for storage.",
+			allow:  "DollarPrefixedFieldName (52): _id fields may not contain '$'-prefixed fields: $foo is not valid for storage.",
+		},
+		"PushEach": {
+			doc: types.MustMakeDocument("$push", types.MustMakeDocument(
+				"arr", types.MustMakeDocument("$each", types.MustNewArray(types.MustMakeDocument("x.y", int32(1)))),
+			)),
+			update: true,
+			reject: "DottedFieldName (57): The dotted field 'x.y' in 'arr.x.y' is not valid for storage.",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			for v, expected := range map[KeyValidation]string{
+				RejectDottedDollarKeys: tc.reject,
+				AllowDottedDollarKeys:  tc.allow,
+			} {
+				var err error
+				if tc.update {
+					err = v.ValidateUpdate(tc.doc)
+				} else {
+					err = v.ValidateDocument(tc.doc)
+				}
+
+				if expected == "" {
+					assert.NoError(t, err, "key validation %d", v)
+				} else {
+					assert.EqualError(t, err, expected, "key validation %d", v)
+				}
+			}
+		})
+	}
+}
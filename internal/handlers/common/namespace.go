@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+)
+
+// NamespaceAccess is what a command does with a namespace, which decides whether system collections are allowed.
+type NamespaceAccess int
+
+const (
+	// NamespaceRead reads a collection, which may be a system collection.
+	NamespaceRead NamespaceAccess = iota
+
+	// NamespaceWrite writes to a collection and may create it implicitly.
+	NamespaceWrite
+
+	// NamespaceCreate creates a collection explicitly.
+	NamespaceCreate
+)
+
+const (
+	// maxDatabaseNameLength is the maximum length of a database name in bytes, like in MongoDB.
+	maxDatabaseNameLength = 63
+
+	// maxCollectionNameLength is the maximum length of a collection name in bytes.
+	// It is the maximum length of an identifier in SAP HANA.
+	maxCollectionNameLength = 127
+
+	// maxNamespaceLength is the maximum length of db.collection in bytes, like in MongoDB.
+	maxNamespaceLength = 255
+
+	// invalidDatabaseNameChars are the characters MongoDB does not allow in database names.
+	invalidDatabaseNameChars = "/\\. \"$\x00"
+
+	// invalidCollectionNameChars are the characters not allowed in collection names.
+	// Unlike MongoDB, double quotes are not allowed because SAP HANA quotes identifiers with them.
+	invalidCollectionNameChars = "$\"\x00"
+
+	// systemPrefix is the reserved prefix of system collections.
+	systemPrefix = "system."
+)
+
+// ValidateDatabaseName returns InvalidNamespace if the database name is invalid.
+// $external is the database of externally authenticated users.
+func ValidateDatabaseName(db string) error {
+	if db == "$external" {
+		return nil
+	}
+
+	if db == "" || len(db) > maxDatabaseNameLength || strings.ContainsAny(db, invalidDatabaseNameChars) {
+		return NewErrorMessage(ErrInvalidNamespace, "Invalid database name: '%s'", db)
+	}
+
+	return nil
+}
+
+// ValidateNamespace returns InvalidNamespace if the database or collection name is invalid,
+// or if the collection is a system collection which the access does not allow.
+// Writing to system.js returns NotImplemented instead.
+// It returns the same errors as MongoDB, so it is used by all commands taking a collection.
+func ValidateNamespace(db, collection string, access NamespaceAccess) error {
+	if err := ValidateDatabaseName(db); err != nil {
+		return err
+	}
+
+	ns := db + "." + collection
+	if collection == "" || strings.HasPrefix(collection, ".") ||
+		len(collection) > maxCollectionNameLength || len(ns) > maxNamespaceLength ||
+		strings.ContainsAny(collection, invalidCollectionNameChars) {
+		return NewErrorMessage(ErrInvalidNamespace, "Invalid namespace specified '%s'", ns)
+	}
+
+	if !strings.HasPrefix(collection, systemPrefix) {
+		return nil
+	}
+
+	// MongoDB stores server-side JavaScript functions in system.js, which are not supported
+	if collection == "system.js" && access != NamespaceRead {
+		return NewErrorMessage(ErrNotImplemented, "server-side JavaScript is not supported, so '%s' cannot be written to", ns)
+	}
+
+	switch access {
+	case NamespaceWrite:
+		return NewErrorMessage(ErrInvalidNamespace, "cannot write to '%s'", ns)
+	case NamespaceCreate:
+		return NewErrorMessage(ErrInvalidNamespace, "Invalid system namespace: %s", ns)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNamespace(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		db         string
+		collection string
+		access     NamespaceAccess
+		err        string
+	}{
+		"Valid": {
+			db:         "db",
+			collection: "orders.2022",
+			access:     NamespaceCreate,
+		},
+		"External": {
+			db:         "$external",
+			collection: "users",
+		},
+		"EmptyDatabase": {
+			collection: "c",
+			err:        "Invalid database name: ''",
+		},
+		"DatabaseDot": {
+			db:         "a.b",
+			collection: "c",
+			err:        "Invalid database name: 'a.b'",
+		},
+		"DatabaseTooLong": {
+			db:         strings.Repeat("d", 64),
+			collection: "c",
+			err:        "Invalid database name: '" + strings.Repeat("d", 64) + "'",
+		},
+		"EmptyCollection": {
+			db:  "db",
+			err: "Invalid namespace specified 'db.'",
+		},
+		"CollectionDollar": {
+			db:         "db",
+			collection: "a$b",
+			err:        "Invalid namespace specified 'db.a$b'",
+		},
+		"CollectionQuote": {
+			db:         "db",
+			collection: `a"b`,
+			err:        `Invalid namespace specified 'db.a"b'`,
+		},
+		"CollectionTooLong": {
+			db:         "db",
+			collection: strings.Repeat("c", 128),
+			err:        "Invalid namespace specified 'db." + strings.Repeat("c", 128) + "'",
+		},
+		"SystemRead": {
+			db:         "db",
+			collection: "system.views",
+			access:     NamespaceRead,
+		},
+		"SystemWrite": {
+			db:         "db",
+			collection: "system.foo",
+			access:     NamespaceWrite,
+			err:        "cannot write to 'db.system.foo'",
+		},
+		"SystemCreate": {
+			db:         "db",
+			collection: "system.foo",
+			access:     NamespaceCreate,
+			err:        "Invalid system namespace: db.system.foo",
+		},
+		"SystemJS": {
+			db:         "db",
+			collection: "system.js",
+			access:     NamespaceWrite,
+			err:        "server-side JavaScript is not supported, so 'db.system.js' cannot be written to",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateNamespace(tc.db, tc.collection, tc.access)
+			if tc.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			code := ErrInvalidNamespace
+			if tc.collection == "system.js" {
+				code = ErrNotImplemented
+			}
+			assert.Equal(t, NewErrorMessage(code, tc.err), err)
+		})
+	}
+}
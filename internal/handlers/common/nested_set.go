@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// isNestedPath returns true if the dot notation path refers to a field of an embedded document like "a.b.c".
+// Paths with array indexes like "a.2" are set by SAP HANA in the UPDATE statement.
+func isNestedPath(path string) bool {
+	parts := strings.Split(path, ".")
+	if len(parts) < 2 {
+		return false
+	}
+
+	for _, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isNestedSet returns true if $set sets a field of an embedded document,
+// which SAP HANA does not create with its missing parents in an UPDATE statement.
+func isNestedSet(updateDoc types.Document) bool {
+	setDoc, _ := updateDoc.Map()["$set"].(types.Document)
+	for _, key := range setDoc.Keys() {
+		if isNestedPath(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NestedSetSQL returns the condition of the documents in which the UPDATE statement of SAP HANA
+// sets the fields of embedded documents of $set, like "a"."b" IS SET for {$set: {"a.b": 1}}.
+// The fields exist in those documents, so that their parents are embedded documents.
+// Only the other documents, in which the fields and their missing parents are created, are updated with UpdateArrays.
+// It returns an empty string if the update does not set fields of embedded documents,
+// or needs UpdateArrays for all documents, like for array operators or the positional operator $.
+func NestedSetSQL(updateDoc types.Document) (string, error) {
+	if !isNestedSet(updateDoc) || isPositionalUpdate(updateDoc) {
+		return "", nil
+	}
+	for _, op := range arrayOperators {
+		if _, ok := updateDoc.Map()[op.name]; ok {
+			return "", nil
+		}
+	}
+
+	setDoc := updateDoc.Map()["$set"].(types.Document)
+	if err := checkSetPaths(setDoc); err != nil {
+		return "", err
+	}
+
+	var conditions []string
+	for _, key := range setDoc.Keys() {
+		if !isNestedPath(key) {
+			continue
+		}
+
+		updateKey, err := getUpdateKey(key)
+		if err != nil {
+			return "", err
+		}
+		conditions = append(conditions, updateKey+" IS SET")
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+// checkSetPaths returns an error if a path of $set is a prefix of another one, or is a field of _id.
+func checkSetPaths(setDoc types.Document) error {
+	var paths []string
+	for _, key := range setDoc.Keys() {
+		for _, other := range paths {
+			if strings.HasPrefix(key+".", other+".") || strings.HasPrefix(other+".", key+".") {
+				return NewErrorMessage(ErrConflictingUpdateOperators, "Updating the path '%s' would create a conflict at '%s'", key, other)
+			}
+		}
+		paths = append(paths, key)
+
+		if isNestedPath(key) && strings.Split(key, ".")[0] == "_id" {
+			return NewErrorMessage(ErrBadValue, "performing an update on the path '_id' would modify the immutable field '_id'")
+		}
+	}
+
+	return nil
+}
+
+// nestedSets returns the SQL setting the top-level fields of the document which contain fields set by dot notation,
+// like "a" = {"b": {"c": 1}} for {$set: {"a.b.c": 1}}, creating the missing embedded documents.
+// Fields whose value does not change are not set. The other fields of $set are returned in rest.
+// The values are bound to parameters of p.
+func nestedSets(setDoc, doc types.Document, p *Placeholder) (sets []string, rest types.Document, err error) {
+	var restPairs []any
+	var fields []string
+	nested := types.MustMakeDocument()
+
+	if err = checkSetPaths(setDoc); err != nil {
+		return nil, types.Document{}, err
+	}
+
+	for _, key := range setDoc.Keys() {
+		value := setDoc.Map()[key]
+		if !isNestedPath(key) {
+			restPairs = append(restPairs, key, value)
+			continue
+		}
+
+		field := strings.Split(key, ".")[0]
+		if _, ok := nested.Map()[field]; !ok {
+			fields = append(fields, field)
+			if current, ok := doc.Map()[field]; ok {
+				if err = nested.Set(field, current); err != nil {
+					return nil, types.Document{}, lazyerrors.Error(err)
+				}
+			}
+		}
+
+		if err = setByPath(&nested, key, value); err != nil {
+			return nil, types.Document{}, err
+		}
+	}
+
+	for _, field := range fields {
+		value := nested.Map()[field]
+		if reflect.DeepEqual(value, doc.Map()[field]) {
+			continue
+		}
+
+		updateKey, err := getUpdateKey(field)
+		if err != nil {
+			return nil, types.Document{}, err
+		}
+
+		updateValue, err := GetUpdateValue(value, p)
+		if err != nil {
+			return nil, types.Document{}, err
+		}
+		sets = append(sets, updateKey+" = "+updateValue)
+	}
+
+	if rest, err = types.MakeDocument(restPairs...); err != nil {
+		return nil, types.Document{}, lazyerrors.Error(err)
+	}
+
+	return sets, rest, nil
+}
+
+// setByPath sets the value at the dot notation path of the document, creating the missing embedded documents.
+func setByPath(doc *types.Document, path string, value any) error {
+	err := doc.SetByPath(value, strings.Split(path, ".")...)
+
+	var notViable *types.NotViableError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &notViable):
+		return NewErrorMessage(ErrPathNotViable, "%s", notViable.Error())
+	default:
+		return lazyerrors.Error(err)
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestNestedSet(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", int32(1),
+		"a", types.MustMakeDocument("x", int32(0)),
+		"n", int32(5),
+		"null", nil,
+	)
+
+	for name, tc := range map[string]struct {
+		update   types.Document
+		expected string
+		err      string
+	}{
+		"CreateParents": {
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("b.c.d", int32(1))),
+			expected: ` SET "b" = {"c": {"d": 1}}`,
+		},
+		"ModifyExisting": {
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("a.x", int32(2), "a.y.z", "new", "plain", true)),
+			expected: ` SET "a" = {"x": 2, "y": {"z": 'new'}}, "plain" = to_json_boolean(true)`,
+		},
+		"Unchanged": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("a.x", int32(0))),
+		},
+		"WithUnset": {
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("a.x", int32(1)), "$unset", types.MustMakeDocument("n", "")),
+			expected: ` SET "a" = {"x": 1},  UNSET "n"`,
+		},
+		"NotADocument": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("n.m", int32(1))),
+			err:    "PathNotViable (28): Cannot create field 'm' in element {n: 5}",
+		},
+		"Null": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("null.m", int32(1))),
+			err:    "PathNotViable (28): Cannot create field 'm' in element {null: null}",
+		},
+		"Conflict": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("a", int32(1), "a.x", int32(2))),
+			err:    "ConflictingUpdateOperators (40): Updating the path 'a.x' would create a conflict at 'a'",
+		},
+		"ID": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("_id.x", int32(1))),
+			err:    "BadValue (2): performing an update on the path '_id' would modify the immutable field '_id'",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.True(t, IsArrayUpdate(tc.update))
+
+			updateSQL, err := boundUpdateArrays(tc.update, types.Document{}, doc)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, updateSQL)
+		})
+	}
+
+	// array indexes are set by SAP HANA
+	assert.False(t, IsArrayUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("arr.1", int32(1)))))
+}
+
+func TestNestedSetSQL(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		update   types.Document
+		expected string
+		err      string
+	}{
+		"Nested": {
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("a.b.c", int32(1), "plain", true, "d.e", int32(2))),
+			expected: `"a"."b"."c" IS SET AND "d"."e" IS SET`,
+		},
+		"NotNested": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("plain", true)),
+		},
+		"Push": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("a.b", int32(1)), "$push", types.MustMakeDocument("arr", int32(1))),
+		},
+		"Positional": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("a.b", int32(1), "arr.$", int32(1))),
+		},
+		"Conflict": {
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("a.b", int32(1), "a", int32(2))),
+			err:    "ConflictingUpdateOperators (40): Updating the path 'a' would create a conflict at 'a.b'",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			sql, err := NestedSetSQL(tc.update)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, sql)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// maxPartitions is the maximum number of partitions of a table in SAP HANA.
+const maxPartitions = 16000
+
+// ParsePartitioning converts the partition option of create and collMod to the partitioning of a collection.
+// The option looks like {type: "hash", key: "_id", partitions: 4}
+// or {type: "range", key: "year", boundaries: [2000, 2010, 2020]}.
+func ParsePartitioning(value any) (*hana.Partitioning, error) {
+	doc, ok := value.(types.Document)
+	if !ok {
+		return nil, NewErrorMessage(ErrBadValue, "partition must be an object. Got instead: %T", value)
+	}
+
+	m := doc.Map()
+	for _, k := range doc.Keys() {
+		switch k {
+		case "type", "key", "partitions", "boundaries":
+		default:
+			return nil, NewErrorMessage(ErrBadValue, "unknown partition option: %s", k)
+		}
+	}
+
+	var p hana.Partitioning
+
+	p.Field, ok = m["key"].(string)
+	if !ok || p.Field == "" {
+		return nil, NewErrorMessage(ErrBadValue, "partition needs a key given as a string")
+	}
+	if strings.ContainsAny(p.Field, ".\"") || strings.HasPrefix(p.Field, "$") {
+		return nil, NewErrorMessage(ErrBadValue, "partition key must be a top-level field: %s", p.Field)
+	}
+
+	method, _ := m["type"].(string)
+	switch strings.ToLower(method) {
+	case "hash":
+		p.Method = hana.PartitionByHash
+
+		if _, ok := m["boundaries"]; ok {
+			return nil, NewErrorMessage(ErrBadValue, "boundaries can only be used with range partitioning")
+		}
+
+		switch partitions := m["partitions"].(type) {
+		case int32:
+			p.Partitions = partitions
+		case int64:
+			p.Partitions = int32(partitions)
+		case float64:
+			p.Partitions = int32(partitions)
+		default:
+			return nil, NewErrorMessage(ErrBadValue, "hash partitioning needs the number of partitions")
+		}
+
+		if p.Partitions < 1 || p.Partitions > maxPartitions {
+			return nil, NewErrorMessage(ErrBadValue, "number of partitions must be between 1 and %d", maxPartitions)
+		}
+
+	case "range":
+		p.Method = hana.PartitionByRange
+
+		if _, ok := m["partitions"]; ok {
+			return nil, NewErrorMessage(ErrBadValue, "partitions can only be used with hash partitioning")
+		}
+
+		boundaries, ok := m["boundaries"].(*types.Array)
+		if !ok || boundaries.Len() < 2 {
+			return nil, NewErrorMessage(ErrBadValue, "range partitioning needs an array of at least two boundaries")
+		}
+
+		for i := 0; i < boundaries.Len(); i++ {
+			boundary, _ := boundaries.Get(i)
+			switch boundary.(type) {
+			case int32, int64, float64, string:
+			default:
+				return nil, NewErrorMessage(ErrBadValue, "partition boundary of type %T is not supported", boundary)
+			}
+
+			if i > 0 {
+				var less types.CompareResult
+				less = 1
+				previous, _ := boundaries.Get(i - 1)
+				if types.CompareScalars(previous, boundary) != less {
+					return nil, NewErrorMessage(ErrBadValue, "partition boundaries must be in ascending order")
+				}
+			}
+
+			// DDL statements have no parameters, so the boundaries are literals
+			p.Boundaries = append(p.Boundaries, literalSQL(boundary))
+		}
+
+	default:
+		return nil, NewErrorMessage(ErrBadValue, "partition type must be hash or range. Got instead: %v", m["type"])
+	}
+
+	return &p, nil
+}
+
+// literalSQL converts a partition boundary to an SQL literal.
+func literalSQL(boundary any) string {
+	switch boundary := boundary.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(boundary, "'", "''") + "'"
+	case float64:
+		return strconv.FormatFloat(boundary, 'f', -1, 64)
+	default:
+		return fmt.Sprint(boundary)
+	}
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePartitioning(t *testing.T) {
+	t.Run("hash partitioning", func(t *testing.T) {
+		p, err := ParsePartitioning(types.MustMakeDocument("type", "hash", "key", "_id", "partitions", int32(8)))
+
+		assert.Nil(t, err)
+		assert.Equal(t, &hana.Partitioning{Method: hana.PartitionByHash, Field: "_id", Partitions: 8}, p)
+		assert.Equal(t, "PARTITION BY HASH (\"_id\") PARTITIONS 8", p.SQL())
+	})
+
+	t.Run("range partitioning", func(t *testing.T) {
+		p, err := ParsePartitioning(types.MustMakeDocument("type", "range", "key", "region", "boundaries", types.MustNewArray("A", "M", "Z")))
+
+		assert.Nil(t, err)
+		assert.Equal(t, "PARTITION BY RANGE (\"region\") (PARTITION 'A' <= VALUES < 'M', PARTITION 'M' <= VALUES < 'Z', PARTITION OTHERS)", p.SQL())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := ParsePartitioning(types.MustMakeDocument("type", "hash", "key", "a.b", "partitions", int32(2)))
+		assert.EqualError(t, err, "BadValue (2): partition key must be a top-level field: a.b")
+
+		_, err = ParsePartitioning(types.MustMakeDocument("type", "hash", "key", "_id", "partitions", int32(0)))
+		assert.EqualError(t, err, "BadValue (2): number of partitions must be between 1 and 16000")
+
+		_, err = ParsePartitioning(types.MustMakeDocument("type", "range", "key", "year", "boundaries", types.MustNewArray(int32(2010), int32(2000))))
+		assert.EqualError(t, err, "BadValue (2): partition boundaries must be in ascending order")
+
+		_, err = ParsePartitioning(types.MustMakeDocument("type", "list", "key", "year"))
+		assert.EqualError(t, err, "BadValue (2): partition type must be hash or range. Got instead: list")
+	})
+}
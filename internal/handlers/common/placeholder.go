@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+// Placeholder collects the values of the parameters ? of an SQL statement,
+// so that the values of filters, documents and updates are bound to the statement instead of being formatted into it.
+// As the parameters are positional, all parts of one statement use the same Placeholder
+// and are created in the order they appear in the statement.
+type Placeholder struct {
+	args []any
+}
+
+// Next returns the next parameter of the statement, bound to the value.
+func (p *Placeholder) Next(value any) string {
+	p.args = append(p.args, value)
+	return "?"
+}
+
+// Args returns the values of the parameters in the order they appear in the statement.
+func (p *Placeholder) Args() []any {
+	return p.args
+}
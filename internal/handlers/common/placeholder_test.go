@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// bindSQL returns the SQL with its parameters ? replaced by the values bound to them in order,
+// so that tests compare the SQL with the values it is executed with.
+// Quoted identifiers and strings like "a?" are kept.
+func bindSQL(sql string, p *Placeholder) string {
+	var res strings.Builder
+	var quote rune
+	var n int
+	for _, c := range sql {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '?' && n < len(p.Args()):
+			switch v := p.Args()[n].(type) {
+			case string:
+				res.WriteString("'" + strings.ReplaceAll(v, "'", "''") + "'")
+			case float64:
+				res.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+			default:
+				res.WriteString(fmt.Sprint(v))
+			}
+			n++
+			continue
+		}
+
+		res.WriteRune(c)
+	}
+
+	return res.String()
+}
+
+func TestPlaceholder(t *testing.T) {
+	t.Parallel()
+
+	var p Placeholder
+	assert.Equal(t, "?", p.Next("a"))
+	assert.Equal(t, "?", p.Next(int32(1)))
+	assert.Equal(t, []any{"a", int32(1)}, p.Args())
+}
+
+// TestWhereParameters is not parallel, as the SQL of $nor is created with package state.
+func TestWhereParameters(t *testing.T) {
+	for name, tc := range map[string]struct {
+		filter types.Document
+		sql    string
+		args   []any
+	}{
+		"Quote": {
+			filter: types.MustMakeDocument("name", "O'Brien"),
+			sql:    ` WHERE "name" = ?`,
+			args:   []any{"O'Brien"},
+		},
+		"Injection": {
+			filter: types.MustMakeDocument("name", "' OR 1 = 1 --"),
+			sql:    ` WHERE "name" = ?`,
+			args:   []any{"' OR 1 = 1 --"},
+		},
+		"Document": {
+			filter: types.MustMakeDocument("author", types.MustMakeDocument(`a"b`, "O'Brien", "age", int32(42))),
+			sql:    ` WHERE "author" = {"a""b": ?, "age": ?}`,
+			args:   []any{"O'Brien", int32(42)},
+		},
+		"Array": {
+			filter: types.MustMakeDocument("doc", types.MustMakeDocument("tags", types.MustNewArray("it's", true, nil))),
+			sql:    ` WHERE "doc" = {"tags": [?, to_json_boolean(?), NULL]}`,
+			args:   []any{"it's", true},
+		},
+		"Percent": {
+			filter: types.MustMakeDocument("name", "100%", "n", types.MustMakeDocument("$gt", int32(1))),
+			sql:    ` WHERE "name" = ? AND (("n" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND "n" > ?) OR "n"."$n" > ?)`,
+			args:   []any{"100%", int32(1), int32(1)},
+		},
+		"Regex": {
+			filter: types.MustMakeDocument("name", types.Regex{Pattern: "^O'B"}),
+			sql:    ` WHERE "name" LIKE ?`,
+			args:   []any{"O'B%"},
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var p Placeholder
+			sql, err := CreateWhereClause(tc.filter, &p)
+			require.NoError(t, err)
+			assert.Equal(t, tc.sql, sql)
+			assert.Equal(t, tc.args, p.Args())
+		})
+	}
+}
+
+// boundWhereClause returns the SQL of CreateCollatedWhereClause with the values bound to its parameters, see bindSQL.
+func boundWhereClause(filter types.Document, collation *Collation) (string, error) {
+	var p Placeholder
+	sql, err := CreateCollatedWhereClause(filter, collation, &p)
+	return bindSQL(sql, &p), err
+}
+
+// boundUpdate returns the SQL of Update with the values bound to its parameters, see bindSQL.
+func boundUpdate(updateDoc types.Document) (string, string, error) {
+	var p, notWhereP Placeholder
+	updateSQL, notWhereSQL, err := Update(updateDoc, &p, &notWhereP)
+	return bindSQL(updateSQL, &p), bindSQL(notWhereSQL, &notWhereP), err
+}
+
+// boundUpdateArrays returns the SQL of UpdateArrays with the values bound to its parameters, see bindSQL.
+func boundUpdateArrays(updateDoc, filter, doc types.Document) (string, error) {
+	var p Placeholder
+	sql, err := UpdateArrays(updateDoc, filter, doc, &p)
+	return bindSQL(sql, &p), err
+}
+
+// boundExpression returns the SQL of ExpressionSQL with the values bound to its parameters, see bindSQL.
+func boundExpression(expr any) (string, error) {
+	var p Placeholder
+	sql, err := ExpressionSQL(expr, &p)
+	return bindSQL(sql, &p), err
+}
+
+// boundRegexPredicate returns the SQL of regexPredicate with the values bound to its parameters, see bindSQL.
+func boundRegexPredicate(kSQL string, value any, options string) (string, error) {
+	var p Placeholder
+	sql, err := regexPredicate(kSQL, value, options, &p)
+	return bindSQL(sql, &p), err
+}
@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// positionalOperators are the update operators whose fields may contain the positional operator $.
+var positionalOperators = []string{"$set", "$unset", "$push", "$pull"}
+
+// hasPositional returns true if the path contains the positional operator $ like "items.$.qty".
+func hasPositional(path string) bool {
+	for _, part := range strings.Split(path, ".") {
+		if part == "$" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPositionalUpdate returns true if a field of the update document contains the positional operator $.
+func isPositionalUpdate(updateDoc types.Document) bool {
+	for _, op := range positionalOperators {
+		opDoc, _ := updateDoc.Map()[op].(types.Document)
+		for _, key := range opDoc.Keys() {
+			if hasPositional(key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// resolvePositional returns the update document with the positional operator $ in its fields
+// replaced by the index of the first element of the array matched by the filter in the document,
+// so that {$set: {"items.$.qty": 5}} with the filter {items: {$elemMatch: {sku: "b"}}} becomes {$set: {"items.1.qty": 5}}.
+func resolvePositional(updateDoc, filter, doc types.Document) (types.Document, error) {
+	if !isPositionalUpdate(updateDoc) {
+		return updateDoc, nil
+	}
+
+	pairs := make([]any, 0, 2*len(updateDoc.Keys()))
+	for _, op := range updateDoc.Keys() {
+		value := updateDoc.Map()[op]
+
+		opDoc, ok := value.(types.Document)
+		if !ok {
+			pairs = append(pairs, op, value)
+			continue
+		}
+
+		opPairs := make([]any, 0, 2*len(opDoc.Keys()))
+		for _, key := range opDoc.Keys() {
+			path := key
+			if hasPositional(key) {
+				var err error
+				if path, err = resolvePositionalPath(key, filter, doc); err != nil {
+					return types.Document{}, err
+				}
+			}
+			opPairs = append(opPairs, path, opDoc.Map()[key])
+		}
+
+		resolved, err := types.MakeDocument(opPairs...)
+		if err != nil {
+			return types.Document{}, NewErrorMessage(ErrBadValue, "%s", err)
+		}
+		pairs = append(pairs, op, resolved)
+	}
+
+	return types.MakeDocument(pairs...)
+}
+
+// resolvePositionalPath returns the path with the positional operator $ replaced by the index of the matched element.
+func resolvePositionalPath(path string, filter, doc types.Document) (string, error) {
+	parts := strings.Split(path, ".")
+	if parts[0] == "$" {
+		return "", NewErrorMessage(ErrBadValue, "Cannot have positional (i.e. '$') element in the first position in path '%s'", path)
+	}
+
+	pos := -1
+	for i, part := range parts {
+		if part != "$" {
+			continue
+		}
+		if pos >= 0 {
+			return "", NewErrorMessage(ErrBadValue, "Too many positional (i.e. '$') elements found in path '%s'", path)
+		}
+		pos = i
+	}
+
+	arrayPath := strings.Join(parts[:pos], ".")
+	index, err := positionalIndex(arrayPath, filter, doc)
+	if err != nil {
+		return "", err
+	}
+
+	parts[pos] = strconv.Itoa(index)
+	return strings.Join(parts, "."), nil
+}
+
+// positionalIndex returns the index of the first element of the array which matches the condition of the filter on the array,
+// either {items: {$elemMatch: ...}}, {items: <value or operators>} or {"items.sku": <value or operators>}.
+func positionalIndex(arrayPath string, filter, doc types.Document) (int, error) {
+	notFound := NewErrorMessage(ErrBadValue, "The positional operator did not find the match needed from the query.")
+
+	var condition pullCondition
+	for _, key := range filter.Keys() {
+		value := filter.Map()[key]
+
+		var err error
+		switch {
+		case key == arrayPath:
+			if cond, ok := value.(types.Document); ok {
+				if elemMatch, ok := cond.Map()["$elemMatch"]; ok {
+					var p *pull
+					if p, err = parsePull(arrayPath, elemMatch); err == nil {
+						condition = p.condition
+					}
+					break
+				}
+			}
+			condition, err = parsePullValue(value)
+
+		case strings.HasPrefix(key, arrayPath+"."):
+			var c pullCondition
+			if c, err = parsePullValue(value); err == nil {
+				field := strings.TrimPrefix(key, arrayPath+".")
+				condition = func(elem any) bool {
+					elemDoc, ok := elem.(types.Document)
+					return ok && c(valueAtPath(elemDoc, field))
+				}
+			}
+
+		default:
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+		break
+	}
+
+	if condition == nil {
+		return 0, notFound
+	}
+
+	values, err := currentArray(doc, arrayPath)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, v := range values {
+		if condition(v) {
+			return i, nil
+		}
+	}
+
+	return 0, notFound
+}
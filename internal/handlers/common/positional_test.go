@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestResolvePositional(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", int32(1),
+		"grades", types.MustNewArray(int32(80), int32(85), int32(90)),
+		"items", types.MustNewArray(
+			types.MustMakeDocument("sku", "a", "qty", int32(1)),
+			types.MustMakeDocument("sku", "b", "qty", int32(2)),
+		),
+	)
+
+	for name, tc := range map[string]struct {
+		filter   types.Document
+		update   types.Document
+		expected types.Document
+		err      error
+	}{
+		"ElemMatch": {
+			filter:   types.MustMakeDocument("items", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("sku", "b"))),
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("items.$.qty", int32(5), "name", "x")),
+			expected: types.MustMakeDocument("$set", types.MustMakeDocument("items.1.qty", int32(5), "name", "x")),
+		},
+		"ElemMatchOperators": {
+			filter:   types.MustMakeDocument("grades", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("$gte", int32(85)))),
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("grades.$", int32(86))),
+			expected: types.MustMakeDocument("$set", types.MustMakeDocument("grades.1", int32(86))),
+		},
+		"Value": {
+			filter:   types.MustMakeDocument("_id", int32(1), "grades", int32(90)),
+			update:   types.MustMakeDocument("$unset", types.MustMakeDocument("grades.$", "")),
+			expected: types.MustMakeDocument("$unset", types.MustMakeDocument("grades.2", "")),
+		},
+		"EmbeddedField": {
+			filter:   types.MustMakeDocument("items.qty", types.MustMakeDocument("$gt", int32(1))),
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("items.$.sku", "c")),
+			expected: types.MustMakeDocument("$set", types.MustMakeDocument("items.1.sku", "c")),
+		},
+		"NoPositional": {
+			filter:   types.MustMakeDocument("_id", int32(1)),
+			update:   types.MustMakeDocument("$set", types.MustMakeDocument("items.0.qty", int32(5))),
+			expected: types.MustMakeDocument("$set", types.MustMakeDocument("items.0.qty", int32(5))),
+		},
+		"NotInFilter": {
+			filter: types.MustMakeDocument("_id", int32(1)),
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("items.$.qty", int32(5))),
+			err:    NewErrorMessage(ErrBadValue, "The positional operator did not find the match needed from the query."),
+		},
+		"NoMatch": {
+			filter: types.MustMakeDocument("grades", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("$lt", int32(50)))),
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("grades.$", int32(50))),
+			err:    NewErrorMessage(ErrBadValue, "The positional operator did not find the match needed from the query."),
+		},
+		"First": {
+			filter: types.MustMakeDocument("grades", int32(80)),
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("$.grades", int32(50))),
+			err:    NewErrorMessage(ErrBadValue, "Cannot have positional (i.e. '$') element in the first position in path '$.grades'"),
+		},
+		"TooMany": {
+			filter: types.MustMakeDocument("items", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("sku", "b"))),
+			update: types.MustMakeDocument("$set", types.MustMakeDocument("items.$.tags.$", "x")),
+			err:    NewErrorMessage(ErrBadValue, "Too many positional (i.e. '$') elements found in path 'items.$.tags.$'"),
+		},
+	} {
+		actual, err := resolvePositional(tc.update, tc.filter, doc)
+		if tc.err != nil {
+			assert.Equal(t, tc.err, err, name)
+			continue
+		}
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.expected, actual, name)
+	}
+}
+
+func TestUpdateArraysPositional(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", int32(1),
+		"items", types.MustNewArray(
+			types.MustMakeDocument("sku", "a", "tags", types.MustNewArray("x")),
+			types.MustMakeDocument("sku", "b", "tags", types.MustNewArray("y")),
+		),
+	)
+	filter := types.MustMakeDocument("items", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("sku", "b")))
+
+	update := types.MustMakeDocument("$set", types.MustMakeDocument("items.$.qty", int32(5)))
+	assert.True(t, IsArrayUpdate(update))
+	updateSQL, err := boundUpdateArrays(update, filter, doc)
+	require.NoError(t, err)
+	assert.Equal(t, " SET \"items\"[2].\"qty\" = 5", updateSQL)
+
+	update = types.MustMakeDocument("$push", types.MustMakeDocument("items.$.tags", "z"))
+	updateSQL, err = boundUpdateArrays(update, filter, doc)
+	require.NoError(t, err)
+	assert.Equal(t, " SET \"items\"[2].\"tags\" = ['y', 'z']", updateSQL)
+}
@@ -21,7 +21,6 @@
 package common
 
 import (
-	"strconv"
 	"strings"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
@@ -30,8 +29,11 @@ import (
 
 // Projection checks if projection is an inclusion or exclusion.
 // If inclusion then the sql needed to perform inclusion is created.
-// If exclusion then the removal of fields will first happen after retrieval of documents.
-func Projection(projection types.Document) (sql string, exclusion bool, err error) {
+// If exclusion then the removal of fields will first happen after retrieval of documents,
+// as the JSON projection of SAP HANA only builds documents of named fields and cannot leave fields out.
+// Inclusions of embedded fields like "a.b" select their top-level fields, which are trimmed after retrieval.
+// postProjection is true if the documents must be projected with ProjectDocuments after retrieval.
+func Projection(projection types.Document) (sql string, postProjection bool, err error) {
 	unimplementedFields := []string{
 		"$",
 		"$elemMatch",
@@ -57,15 +59,145 @@ func Projection(projection types.Document) (sql string, exclusion bool, err erro
 	}
 
 	if inclusion {
-		sql = inclusionProjection(projection)
+		var tree map[string]any
+		if tree, err = inclusionTree(projection); err != nil {
+			return
+		}
+
+		if !isNestedInclusion(projection) {
+			sql = inclusionProjection(projection)
+			return
+		}
+
+		// the top-level fields of the included paths, like "a" of "a.b"
+		pairs := make([]any, 0, 2*len(tree))
+		for _, k := range projection.Keys() {
+			root := strings.Split(k, ".")[0]
+			if _, ok := tree[root]; ok {
+				pairs = append(pairs, root, true)
+				delete(tree, root)
+			}
+		}
+		if id, ok := projection.Map()["_id"]; ok && !isTruthyProjection(id) {
+			// _id is included by default, so it is excluded explicitly
+			pairs = append([]any{"_id", false}, pairs...)
+		}
+
+		sql = inclusionProjection(types.MustMakeDocument(pairs...))
+		postProjection = true
 		return
 	} else {
-		exclusion = true
+		postProjection = true
 		sql = "*"
 		return
 	}
 }
 
+// isNestedInclusion returns true if the inclusion projection includes embedded fields like "a.b".
+func isNestedInclusion(projection types.Document) bool {
+	for _, k := range projection.Keys() {
+		if strings.Contains(k, ".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// inclusionTree returns the paths included by an inclusion projection as tree of their fields.
+// Included fields map to nil, and fields with included embedded fields to the tree of them.
+// _id is included unless it is excluded. Paths which include a parent of each other fail with a path collision.
+func inclusionTree(projection types.Document) (map[string]any, error) {
+	tree := map[string]any{"_id": nil}
+	for _, k := range projection.Keys() {
+		if k == "_id" {
+			if !isTruthyProjection(projection.Map()[k]) {
+				delete(tree, k)
+			}
+			continue
+		}
+
+		node := tree
+		fields := strings.Split(k, ".")
+		for i, field := range fields {
+			child, ok := node[field]
+			last := i == len(fields)-1
+
+			switch {
+			case ok && (last || child == nil):
+				return nil, NewErrorMessage(ErrPathCollision, "Path collision at %s", k)
+			case last:
+				node[field] = nil
+			case !ok:
+				sub := make(map[string]any)
+				node[field] = sub
+				node = sub
+			default:
+				node = child.(map[string]any)
+			}
+		}
+	}
+
+	return tree, nil
+}
+
+// isTruthyProjection returns true if the value of a projection field includes it, like true or 1.
+func isTruthyProjection(value any) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case int32, int64, float64:
+		return types.CompareScalars(value, int32(0)) != 0
+	default:
+		return true
+	}
+}
+
+// includeDocument returns the document with only the fields of the inclusion tree, in the order of the document.
+func includeDocument(doc types.Document, tree map[string]any) types.Document {
+	pairs := make([]any, 0, 2*len(tree))
+	for _, k := range doc.Keys() {
+		sub, ok := tree[k]
+		if !ok {
+			continue
+		}
+
+		v := doc.Map()[k]
+		if sub != nil {
+			if v, ok = includeValue(v, sub.(map[string]any)); !ok {
+				continue
+			}
+		}
+
+		pairs = append(pairs, k, v)
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// includeValue returns the embedded fields of the inclusion tree of a value,
+// which are the fields of a document, or of the documents in an array, like in MongoDB.
+// Other values have no embedded fields and are not included.
+func includeValue(value any, tree map[string]any) (any, bool) {
+	switch value := value.(type) {
+	case types.Document:
+		return includeDocument(value, tree), true
+	case *types.Array:
+		res := types.MakeArray(value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elem, _ := value.Get(i)
+			if elem, ok := includeValue(elem, tree); ok {
+				if err := res.Append(elem); err != nil {
+					panic(err)
+				}
+			}
+		}
+		return res, true
+	default:
+		return nil, false
+	}
+}
+
 // isProjectionInclusion determines whether projection is inclusion or exclusion.
 func isProjectionInclusion(projection types.Document) (inclusion bool, err error) {
 	var exclusion bool
@@ -97,10 +229,6 @@ func isProjectionInclusion(projection types.Document) (inclusion bool, err error
 					err = NewErrorMessage(ErrProjectionInEx, "Cannot do inclusion on field %s in exclusion projection", k)
 					return
 				}
-				if strings.Contains(k, ".") {
-					err = lazyerrors.Errorf("Projection on nested documents is not implemented, yet.")
-					return
-				}
 				inclusion = true
 			} else {
 				if inclusion {
@@ -124,10 +252,6 @@ func isProjectionInclusion(projection types.Document) (inclusion bool, err error
 					err = NewErrorMessage(ErrProjectionInEx, "Cannot do inclusion on field %s in exclusion projection", k)
 					return
 				}
-				if strings.Contains(k, ".") {
-					err = lazyerrors.Errorf("Projection on nested documents is not implemented, yet.")
-					return
-				}
 				inclusion = true
 			}
 		default:
@@ -182,7 +306,7 @@ func inclusionProjection(projection types.Document) (sql string) {
 		}
 
 		id = false
-		sql += "\"" + k + "\": \"" + k + "\""
+		sql += quoteField(k) + ": " + quoteField(k)
 
 	}
 
@@ -192,8 +316,21 @@ func inclusionProjection(projection types.Document) (sql string) {
 }
 
 // ProjectDocuments will be used if it is an exclusion to performs the exclusion
-// on each document together with the function projectDocument
+// on each document together with the function projectDocument,
+// or if it is an inclusion of embedded fields to trim the documents to the included paths.
 func ProjectDocuments(docs *types.Array, projection types.Document) (err error) {
+	inclusion, err := isProjectionInclusion(projection)
+	if err != nil {
+		return err
+	}
+
+	var tree map[string]any
+	if inclusion {
+		if tree, err = inclusionTree(projection); err != nil {
+			return err
+		}
+	}
+
 	for i := 0; i < docs.Len(); i++ {
 		doc, errGet := docs.GetPointer(i)
 		if errGet != nil {
@@ -201,6 +338,10 @@ func ProjectDocuments(docs *types.Array, projection types.Document) (err error)
 		}
 		switch docv := (*doc).(type) {
 		case types.Document:
+			if inclusion {
+				*doc = includeDocument(docv, tree)
+				continue
+			}
 			err = projectDocument(&docv, projection)
 			*doc = docv
 		default:
@@ -213,100 +354,62 @@ func ProjectDocuments(docs *types.Array, projection types.Document) (err error)
 	return nil
 }
 
+// ExcludedFields returns the top-level fields removed by an exclusion projection,
+// which do not have to be decoded from the retrieved documents. It is nil for inclusion projections.
+// Fields with embedded excluded fields like "a" of "a.b" are not returned, as the rest of them is kept.
+func ExcludedFields(projection types.Document) ([]string, error) {
+	if len(projection.Keys()) == 0 {
+		return nil, nil
+	}
+
+	inclusion, err := isProjectionInclusion(projection)
+	if err != nil || inclusion {
+		return nil, err
+	}
+
+	var fields []string
+	for _, k := range projection.Keys() {
+		if !strings.Contains(k, ".") && !isTruthyProjection(projection.Map()[k]) {
+			fields = append(fields, k)
+		}
+	}
+
+	return fields, nil
+}
+
 // projectDocument removes the fields of a document specified in the exclusion
 func projectDocument(doc *types.Document, projection types.Document) (err error) {
 	projectionMap := projection.Map()
 	for field := range projectionMap {
 		if strings.Contains(field, ".") {
-			var next any = doc
-			var previousS string
-			var previousDoc types.Document
-			var previousArray *types.Array
-			var ppDoc types.Document
-			var ppS string
-			var notFound bool
-			var projErr error
-			arrayCount := 0
-		forLoop:
-			for _, s := range strings.Split(field, ".") {
-				switch j := next.(type) {
-				case *types.Document:
-					previousDoc = *j
-					previousS = s
-					next, projErr = j.Get(s)
-					if projErr != nil || next == nil {
-						notFound = true
-						break forLoop
-					}
-				case types.Document:
-					ppDoc = previousDoc
-					ppS = previousS
-					previousS = s
-					previousDoc = j
-					next, projErr = j.Get(s)
-					if projErr != nil || next == nil {
-						notFound = true
-						break forLoop
-					}
-					if arrayCount > 0 {
-						arrayCount--
-					}
-				case *types.Array:
-					ppDoc = previousDoc
-					ppS = previousS
-					previousS = s
-					previousArray = j
-					if sInt, convErr := strconv.Atoi(s); convErr == nil {
-						next, projErr = j.Get(sInt)
-					} else {
-						notFound = true
-						break forLoop
-					}
-
-					if projErr != nil {
-						notFound = true
-						break forLoop
-					}
-					arrayCount = 2
-				default:
-					notFound = true
-					continue
-				}
+			if err = doc.RemoveByPath(strings.Split(field, ".")...); err != nil {
+				return lazyerrors.Error(err)
 			}
-			if notFound {
-				continue
-			}
-			if arrayCount == 0 {
-				previousDoc.Remove(previousS)
-				ppDoc.Set(ppS, previousDoc)
-			} else if arrayCount == 1 {
-				previousDoc.Remove(previousS)
-				sInt, _ := strconv.Atoi(ppS)
-				previousArray.Set(sInt, previousDoc)
-			} else if arrayCount == 2 {
-				sInt, _ := strconv.Atoi(previousS)
-				previousArray.Delete(sInt)
-			}
-
 		} else {
 			if field == "_id" {
 				idExclusion := projectionMap[field]
 				switch idExclusion := idExclusion.(type) {
 				case bool:
 					if !idExclusion {
-						doc.Remove(field)
+						if err = doc.Remove(field); err != nil {
+							return lazyerrors.Error(err)
+						}
 					}
 					continue
 				case int32, int64, float64:
 					var equal types.CompareResult
 					equal = 0
 					if types.CompareScalars(idExclusion, int32(0)) == equal {
-						doc.Remove(field)
+						if err = doc.Remove(field); err != nil {
+							return lazyerrors.Error(err)
+						}
 					}
 					continue
 				}
 			}
-			doc.Remove(field)
+			if err = doc.Remove(field); err != nil {
+				return lazyerrors.Error(err)
+			}
 		}
 	}
 
@@ -9,6 +9,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 )
 
@@ -33,8 +36,16 @@ func TestProjection(t *testing.T) {
 			e: expected{sql: "*", exclusion: true, err: nil},
 		},
 		{
-			name: "inclusion nested document error test", r: types.MustMakeDocument("field.nest", true),
-			e: expected{sql: "", exclusion: false, err: fmt.Errorf("Projection on nested documents is not implemented, yet.")},
+			name: "inclusion nested document test", r: types.MustMakeDocument("field.nest", true, "field.other", int32(1)),
+			e: expected{sql: "{\"_id\": \"_id\", \"field\": \"field\"}", exclusion: true, err: nil},
+		},
+		{
+			name: "inclusion nested document without _id test", r: types.MustMakeDocument("a", int32(1), "b.c", true, "_id", false),
+			e: expected{sql: "{\"a\": \"a\", \"b\": \"b\"}", exclusion: true, err: nil},
+		},
+		{
+			name: "inclusion path collision error test", r: types.MustMakeDocument("field", true, "field.nest", true),
+			e: expected{sql: "", exclusion: false, err: fmt.Errorf("Location31250 (31250): Path collision at field.nest")},
 		},
 		{
 			name: "empty projection document test", r: types.MustMakeDocument(),
@@ -93,8 +104,8 @@ func TestIsProjectionInclusion(t *testing.T) {
 			e: expected{inclusion: true, err: nil},
 		},
 		{
-			name: "inclusion nested document error test", r: types.MustMakeDocument("field.nest", int32(1)),
-			e: expected{inclusion: false, err: fmt.Errorf("Projection on nested documents is not implemented, yet.")},
+			name: "inclusion nested document test", r: types.MustMakeDocument("field.nest", int32(1)),
+			e: expected{inclusion: true, err: nil},
 		},
 	}
 
@@ -138,6 +149,10 @@ func TestInclusionProjection(t *testing.T) {
 			name: "include fields and _id bool test", r: types.MustMakeDocument("field1", int32(1), "_id", true),
 			e: expected{sql: "{\"_id\": \"_id\", \"field1\": \"field1\"}"},
 		},
+		{
+			name: "include quoted field test", r: types.MustMakeDocument("a\"b", int32(1)),
+			e: expected{sql: "{\"_id\": \"_id\", \"a\"\"b\": \"a\"\"b\"}"},
+		},
 	}
 
 	for _, field := range inclusionProjectionTestCases {
@@ -273,3 +288,61 @@ outer_loop:
 		}
 	}
 }
+
+func TestProjectDocumentsNestedInclusion(t *testing.T) {
+	t.Parallel()
+
+	docs := types.MustNewArray(
+		types.MustMakeDocument(
+			"_id", int32(1),
+			"name", "a",
+			"size", types.MustMakeDocument("h", int32(14), "w", int32(21), "uom", "cm"),
+			"stock", types.MustNewArray(
+				types.MustMakeDocument("qty", int32(5), "warehouse", "A"),
+				int32(3),
+				types.MustMakeDocument("warehouse", "B"),
+			),
+		),
+		types.MustMakeDocument("_id", int32(2), "size", "large", "stock", types.MustMakeDocument("qty", int32(1))),
+	)
+
+	projection := types.MustMakeDocument("size.uom", int32(1), "stock.qty", true, "size.h", true, "_id", false)
+	require.NoError(t, ProjectDocuments(docs, projection))
+
+	expected := types.MustNewArray(
+		types.MustMakeDocument(
+			"size", types.MustMakeDocument("h", int32(14), "uom", "cm"),
+			"stock", types.MustNewArray(
+				types.MustMakeDocument("qty", int32(5)),
+				types.MustMakeDocument(),
+			),
+		),
+		types.MustMakeDocument("stock", types.MustMakeDocument("qty", int32(1))),
+	)
+	assert.Equal(t, expected, docs)
+}
+
+func TestExcludedFields(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		projection types.Document
+		expected   []string
+	}{
+		"Empty":          {types.MustMakeDocument(), nil},
+		"Inclusion":      {types.MustMakeDocument("a", true, "b.c", int32(1)), nil},
+		"IDExclusion":    {types.MustMakeDocument("_id", false, "a", true), nil},
+		"Exclusion":      {types.MustMakeDocument("_id", int32(0), "a", false, "b.c", int64(0), "d", 0.0), []string{"_id", "a", "d"}},
+		"IncludedID":     {types.MustMakeDocument("_id", true, "a", false), []string{"a"}},
+		"EmbeddedFields": {types.MustMakeDocument("a.b", false), nil},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ExcludedFields(tc.projection)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
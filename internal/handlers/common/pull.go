@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// pullCondition returns true if the array element is removed by a $pull.
+type pullCondition func(elem any) bool
+
+// pull is a parsed $pull of one field.
+type pull struct {
+	path      string
+	condition pullCondition
+}
+
+// parsePull parses the $pull of one field: a value which is removed from the array,
+// a document of query operators like {$lt: 60} applied to the elements,
+// or a query document like {score: {$lt: 60}} applied to the embedded documents.
+func parsePull(path string, value any) (*pull, error) {
+	if strings.EqualFold(path, "_id") {
+		return nil, NewErrorMessage(ErrBadValue, "performing an update on the path '_id' would modify the immutable field '_id'")
+	}
+
+	cond, ok := value.(types.Document)
+	if !ok || len(cond.Keys()) == 0 {
+		return &pull{path: path, condition: pullEqual(value)}, nil
+	}
+
+	if isDBRef(cond) {
+		return &pull{path: path, condition: pullEqual(value)}, nil
+	}
+
+	if strings.HasPrefix(cond.Keys()[0], "$") {
+		c, err := parsePullOperators(cond)
+		if err != nil {
+			return nil, err
+		}
+		return &pull{path: path, condition: c}, nil
+	}
+
+	fields := cond.Keys()
+	conditions := make([]pullCondition, len(fields))
+	for i, f := range fields {
+		if strings.HasPrefix(f, "$") {
+			return nil, NewErrorMessage(ErrBadValue, "unknown top level operator: %s", f)
+		}
+
+		var err error
+		if conditions[i], err = parsePullValue(cond.Map()[f]); err != nil {
+			return nil, err
+		}
+	}
+
+	c := func(elem any) bool {
+		doc, ok := elem.(types.Document)
+		if !ok {
+			return false
+		}
+
+		for i, f := range fields {
+			if !conditions[i](valueAtPath(doc, f)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return &pull{path: path, condition: c}, nil
+}
+
+// parsePullValue parses the condition of a field of a query document, either a value or a document of query operators.
+func parsePullValue(value any) (pullCondition, error) {
+	if cond, ok := value.(types.Document); ok && len(cond.Keys()) > 0 && strings.HasPrefix(cond.Keys()[0], "$") && !isDBRef(cond) {
+		return parsePullOperators(cond)
+	}
+
+	return pullEqual(value), nil
+}
+
+// parsePullOperators parses a document of query operators, which all must match.
+func parsePullOperators(cond types.Document) (pullCondition, error) {
+	var conditions []pullCondition
+	for _, op := range cond.Keys() {
+		operand := cond.Map()[op]
+
+		var c pullCondition
+		switch op {
+		case "$eq":
+			c = pullEqual(operand)
+		case "$ne":
+			eq := pullEqual(operand)
+			c = func(elem any) bool { return !eq(elem) }
+		case "$gt", "$gte", "$lt", "$lte":
+			c = pullCompare(op, operand)
+		case "$in", "$nin":
+			values, ok := operand.(*types.Array)
+			if !ok {
+				return nil, NewErrorMessage(ErrBadValue, "%s needs an array", op)
+			}
+			in := make([]pullCondition, values.Len())
+			for i := range in {
+				v, _ := values.Get(i)
+				in[i] = pullEqual(v)
+			}
+			negate := op == "$nin"
+			c = func(elem any) bool {
+				for _, eq := range in {
+					if eq(elem) {
+						return !negate
+					}
+				}
+				return negate
+			}
+		case "$exists":
+			exists, ok := operand.(bool)
+			if !ok {
+				return nil, NewErrorMessage(ErrBadValue, "$exists needs a boolean")
+			}
+			c = func(elem any) bool { return (elem != nil) == exists }
+		default:
+			return nil, NewErrorMessage(ErrNotImplemented, "$pull does not support %s yet", op)
+		}
+
+		conditions = append(conditions, c)
+	}
+
+	return func(elem any) bool {
+		for _, c := range conditions {
+			if !c(elem) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// pullEqual returns the condition of elements equal to the value.
+func pullEqual(value any) pullCondition {
+	return func(elem any) bool { return types.Compare(elem, value) == 0 }
+}
+
+// pullCompare returns the condition of a comparison operator.
+// Like in MongoDB, only values of the same type bracket are compared, so {$lt: 60} does not match strings.
+func pullCompare(op string, operand any) pullCondition {
+	return func(elem any) bool {
+		if types.CanonicalType(elem) != types.CanonicalType(operand) {
+			return false
+		}
+
+		c := types.Compare(elem, operand)
+		switch op {
+		case "$gt":
+			return c > 0
+		case "$gte":
+			return c >= 0
+		case "$lt":
+			return c < 0
+		default:
+			return c <= 0
+		}
+	}
+}
+
+// apply implements arrayUpdate.
+// Like in MongoDB, a missing field is not created, and an array without matching elements is not changed.
+func (p *pull) apply(doc types.Document) (*types.Array, error) {
+	if valueAtPath(doc, p.path) == nil {
+		return nil, nil
+	}
+
+	values, err := currentArray(doc, p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]any, 0, len(values))
+	for _, v := range values {
+		if !p.condition(v) {
+			res = append(res, v)
+		}
+	}
+
+	if len(res) == len(values) {
+		return nil, nil
+	}
+
+	return types.MustNewArray(res...), nil
+}
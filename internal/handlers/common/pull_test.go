@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestPull(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", int32(1),
+		"scores", types.MustNewArray(int32(45), float64(59.5), int32(60), int64(90), "absent"),
+		"results", types.MustNewArray(
+			types.MustMakeDocument("item", "A", "score", int32(5)),
+			types.MustMakeDocument("item", "B", "score", int32(8)),
+			types.MustMakeDocument("item", "C", "score", int32(8)),
+		),
+		"name", "quiz",
+		"refs", types.MustNewArray(
+			types.MustMakeDocument("$ref", "users", "$id", int32(1)),
+			types.MustMakeDocument("$ref", "users", "$id", int32(2)),
+		),
+	)
+
+	for name, tc := range map[string]struct {
+		path     string
+		value    any
+		expected *types.Array
+		err      string
+	}{
+		"Value": {
+			path:     "scores",
+			value:    float64(60),
+			expected: types.MustNewArray(int32(45), float64(59.5), int64(90), "absent"),
+		},
+		"Condition": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$lt", int32(60)),
+			expected: types.MustNewArray(int32(60), int64(90), "absent"),
+		},
+		"In": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$in", types.MustNewArray("absent", int32(90))),
+			expected: types.MustNewArray(int32(45), float64(59.5), int32(60)),
+		},
+		"Range": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$gte", int32(45), "$lte", int32(60)),
+			expected: types.MustNewArray(int64(90), "absent"),
+		},
+		"DBRef": {
+			path:     "refs",
+			value:    types.MustMakeDocument("$ref", "users", "$id", int32(2)),
+			expected: types.MustNewArray(types.MustMakeDocument("$ref", "users", "$id", int32(1))),
+		},
+		"Documents": {
+			path:  "results",
+			value: types.MustMakeDocument("score", int32(8), "item", types.MustMakeDocument("$ne", "C")),
+			expected: types.MustNewArray(
+				types.MustMakeDocument("item", "A", "score", int32(5)),
+				types.MustMakeDocument("item", "C", "score", int32(8)),
+			),
+		},
+		"NoMatch": {
+			path:  "scores",
+			value: int32(1),
+		},
+		"Missing": {
+			path:  "feed",
+			value: int32(1),
+		},
+		"NotArray": {
+			path:  "name",
+			value: int32(1),
+			err:   "BadValue (2): The field 'name' must be an array but is of type string in document {_id: 1}",
+		},
+		"Unsupported": {
+			path:  "scores",
+			value: types.MustMakeDocument("$regex", "^a"),
+			err:   "NotImplemented (238): $pull does not support $regex yet",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := parsePull(tc.path, tc.value)
+			if err == nil {
+				var actual *types.Array
+				actual, err = p.apply(doc)
+				if tc.err == "" {
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, actual)
+					return
+				}
+			}
+
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
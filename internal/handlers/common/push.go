@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// pushModifiers are the clauses of a $push with $each, applied in this order.
+var pushModifiers = []string{"$each", "$position", "$sort", "$slice"}
+
+// push is a parsed $push of one field.
+type push struct {
+	path     string
+	each     []any
+	position *int
+	sort     *pushSort
+	slice    *int
+}
+
+// pushSort is the $sort clause of a $push.
+// Without fields, the elements are sorted themselves, otherwise by the fields of the embedded documents.
+type pushSort struct {
+	order  int
+	fields []string
+	orders []int
+}
+
+// parsePush parses the $push of one field, either a value or a document with $each and its modifiers.
+func parsePush(path string, value any) (*push, error) {
+	if strings.EqualFold(path, "_id") {
+		return nil, NewErrorMessage(ErrBadValue, "performing an update on the path '_id' would modify the immutable field '_id'")
+	}
+
+	p := &push{path: path}
+
+	spec, ok := value.(types.Document)
+	if _, each := spec.Map()["$each"]; !ok || !each {
+		p.each = []any{value}
+		return p, nil
+	}
+
+	for _, k := range spec.Keys() {
+		known := false
+		for _, m := range pushModifiers {
+			known = known || k == m
+		}
+		if !known {
+			return nil, NewErrorMessage(ErrBadValue, "Unrecognized clause in $push: %s", k)
+		}
+	}
+
+	m := spec.Map()
+
+	each, ok := m["$each"].(*types.Array)
+	if !ok {
+		return nil, NewErrorMessage(ErrBadValue, "The argument to $each in $push must be an array but it was of type: %s", typeName(m["$each"]))
+	}
+	for i := 0; i < each.Len(); i++ {
+		v, _ := each.Get(i)
+		p.each = append(p.each, v)
+	}
+
+	if v, ok := m["$position"]; ok {
+		n, ok := wholeNumber(v)
+		if !ok {
+			return nil, NewErrorMessage(ErrBadValue, "The value for $position must be an integer value, not of type: %s", typeName(v))
+		}
+		p.position = &n
+	}
+
+	if v, ok := m["$slice"]; ok {
+		n, ok := wholeNumber(v)
+		if !ok {
+			return nil, NewErrorMessage(ErrBadValue, "The value for $slice must be an integer value but was given type: %s", typeName(v))
+		}
+		p.slice = &n
+	}
+
+	if v, ok := m["$sort"]; ok {
+		s, err := parsePushSort(v)
+		if err != nil {
+			return nil, err
+		}
+		p.sort = s
+	}
+
+	return p, nil
+}
+
+// parsePushSort parses the $sort clause, either 1 or -1, or a document of fields with 1 or -1.
+func parsePushSort(value any) (*pushSort, error) {
+	invalid := NewErrorMessage(ErrBadValue, "The $sort is invalid: use 1/-1 to sort the whole element, or {field:1/-1} to sort embedded fields")
+
+	if order, ok := wholeNumber(value); ok {
+		if order != 1 && order != -1 {
+			return nil, invalid
+		}
+		return &pushSort{order: order}, nil
+	}
+
+	doc, ok := value.(types.Document)
+	if !ok || len(doc.Keys()) == 0 {
+		return nil, invalid
+	}
+
+	s := new(pushSort)
+	for _, k := range doc.Keys() {
+		order, ok := wholeNumber(doc.Map()[k])
+		if !ok || (order != 1 && order != -1) || k == "" || strings.HasPrefix(k, "$") {
+			return nil, invalid
+		}
+		s.fields = append(s.fields, k)
+		s.orders = append(s.orders, order)
+	}
+
+	return s, nil
+}
+
+// apply implements arrayUpdate.
+func (p *push) apply(doc types.Document) (*types.Array, error) {
+	values, err := currentArray(doc, p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	// a negative $position counts from the end of the array
+	pos := len(values)
+	if p.position != nil {
+		pos = *p.position
+		if pos < 0 {
+			pos += len(values)
+		}
+		if pos < 0 {
+			pos = 0
+		}
+		if pos > len(values) {
+			pos = len(values)
+		}
+	}
+
+	res := make([]any, 0, len(values)+len(p.each))
+	res = append(res, values[:pos]...)
+	res = append(res, p.each...)
+	res = append(res, values[pos:]...)
+
+	if p.sort != nil {
+		sort.SliceStable(res, func(i, j int) bool { return p.sort.less(res[i], res[j]) })
+	}
+
+	// a negative $slice keeps the last elements
+	if p.slice != nil {
+		switch n := *p.slice; {
+		case n >= 0 && n < len(res):
+			res = res[:n]
+		case n < 0 && -n < len(res):
+			res = res[len(res)+n:]
+		}
+	}
+
+	return types.MustNewArray(res...), nil
+}
+
+// less returns true if a is sorted before b.
+func (s *pushSort) less(a, b any) bool {
+	if s.fields == nil {
+		return s.order*types.Compare(a, b) < 0
+	}
+
+	ad, _ := a.(types.Document)
+	bd, _ := b.(types.Document)
+	for i, f := range s.fields {
+		if c := s.orders[i] * types.Compare(valueAtPath(ad, f), valueAtPath(bd, f)); c != 0 {
+			return c < 0
+		}
+	}
+
+	return false
+}
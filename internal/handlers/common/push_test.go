@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestPush(t *testing.T) {
+	t.Parallel()
+
+	doc := types.MustMakeDocument(
+		"_id", int32(1),
+		"scores", types.MustNewArray(int32(89), int32(90), int32(92)),
+		"quizzes", types.MustNewArray(
+			types.MustMakeDocument("wk", int32(1), "score", int32(10)),
+			types.MustMakeDocument("wk", int32(2), "score", int32(8)),
+		),
+		"name", "queue",
+	)
+
+	for name, tc := range map[string]struct {
+		path     string
+		value    any
+		expected *types.Array
+		err      string
+	}{
+		"Value": {
+			path:     "scores",
+			value:    int32(1),
+			expected: types.MustNewArray(int32(89), int32(90), int32(92), int32(1)),
+		},
+		"Array": {
+			path:     "scores",
+			value:    types.MustNewArray(int32(1)),
+			expected: types.MustNewArray(int32(89), int32(90), int32(92), types.MustNewArray(int32(1))),
+		},
+		"Missing": {
+			path:     "feed",
+			value:    types.MustMakeDocument("$each", types.MustNewArray("a", "b")),
+			expected: types.MustNewArray("a", "b"),
+		},
+		"Position": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$each", types.MustNewArray(int32(50), int32(60)), "$position", int32(1)),
+			expected: types.MustNewArray(int32(89), int32(50), int32(60), int32(90), int32(92)),
+		},
+		"NegativePosition": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$each", types.MustNewArray(int32(50)), "$position", int32(-1)),
+			expected: types.MustNewArray(int32(89), int32(90), int32(50), int32(92)),
+		},
+		"Slice": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$each", types.MustNewArray(int32(95)), "$slice", int32(-2)),
+			expected: types.MustNewArray(int32(92), int32(95)),
+		},
+		"Sort": {
+			path:     "scores",
+			value:    types.MustMakeDocument("$each", types.MustNewArray(float64(90.5), "a", nil), "$sort", int32(-1)),
+			expected: types.MustNewArray("a", int32(92), float64(90.5), int32(90), int32(89), nil),
+		},
+		"SortFieldSlice": {
+			path: "quizzes",
+			value: types.MustMakeDocument(
+				"$each", types.MustNewArray(types.MustMakeDocument("wk", int32(3), "score", int32(9))),
+				"$sort", types.MustMakeDocument("score", int32(-1)),
+				"$slice", int32(2),
+			),
+			expected: types.MustNewArray(
+				types.MustMakeDocument("wk", int32(1), "score", int32(10)),
+				types.MustMakeDocument("wk", int32(3), "score", int32(9)),
+			),
+		},
+		"NotArray": {
+			path:  "name",
+			value: int32(1),
+			err:   "The field 'name' must be an array but is of type string in document {_id: 1}",
+		},
+		"Each": {
+			path:  "scores",
+			value: types.MustMakeDocument("$each", int32(1)),
+			err:   "The argument to $each in $push must be an array but it was of type: int",
+		},
+		"Unrecognized": {
+			path:  "scores",
+			value: types.MustMakeDocument("$each", types.MustNewArray(), "$max", int32(1)),
+			err:   "Unrecognized clause in $push: $max",
+		},
+		"InvalidSort": {
+			path:  "scores",
+			value: types.MustMakeDocument("$each", types.MustNewArray(), "$sort", int32(2)),
+			err:   "The $sort is invalid: use 1/-1 to sort the whole element, or {field:1/-1} to sort embedded fields",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p, err := parsePush(tc.path, tc.value)
+			if err == nil {
+				var actual *types.Array
+				actual, err = p.apply(doc)
+				if tc.err == "" {
+					require.NoError(t, err)
+					assert.Equal(t, tc.expected, actual)
+					return
+				}
+			}
+
+			assert.Equal(t, NewErrorMessage(ErrBadValue, tc.err), err)
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// regexMetaChars are the characters of a regular expression which cannot be translated to LIKE.
+const regexMetaChars = "[](){}|+?\\"
+
+// regexPredicate converts a regular expression with options to a SQL predicate on the field kSQL.
+// Patterns which only use ., .*, ^ and $ and no options are translated to LIKE.
+// All others use LIKE_REGEXPR of SAP HANA, which supports the options i, m, s and x like MongoDB.
+// Patterns anchored with ^ additionally get a LIKE condition on their literal prefix
+// so that SAP HANA can limit the rows the regular expression is evaluated for.
+// The patterns are bound to parameters of p.
+func regexPredicate(kSQL string, value any, options string, p *Placeholder) (string, error) {
+	switch value := value.(type) {
+	case types.Regex:
+		if options != "" && value.Options != "" {
+			return "", NewErrorMessage(ErrRegexOptions, "options set in both $regex and $options")
+		}
+		options += value.Options
+		value.Options = ""
+		return regexPredicate(kSQL, value.Pattern, options, p)
+
+	case string:
+		flags, err := regexFlags(options)
+		if err != nil {
+			return "", err
+		}
+
+		if flags == "" && likeTranslatable(value) {
+			vSQL, err := regex(value, p)
+			if err != nil {
+				return "", err
+			}
+			return kSQL + " LIKE " + vSQL, nil
+		}
+
+		// with i the case of the prefix may differ and with m ^ also matches after a line break
+		var prefix string
+		if !strings.ContainsAny(flags, "im") {
+			prefix = anchoredPrefix(value, strings.Contains(flags, "x"))
+		}
+
+		// the parameter of the prefix comes first in the statement
+		var prefixSQL string
+		if prefix != "" {
+			prefixSQL = kSQL + " LIKE " + likePrefix(prefix, p) + " AND "
+		}
+
+		predicate := kSQL + " LIKE_REGEXPR " + p.Next(value)
+		if flags != "" {
+			predicate += " FLAG '" + flags + "'"
+		}
+
+		if prefix == "" {
+			return predicate, nil
+		}
+
+		return "(" + prefixSQL + predicate + ")", nil
+
+	default:
+		return "", NewErrorMessage(ErrBadValue, "Expected either a JavaScript regular expression objects (i.e. /pattern/) or string containing a pattern. Got instead type %T", value)
+	}
+}
+
+// regexFlags validates the options of a regular expression and returns the flags of LIKE_REGEXPR.
+// The option u is accepted as SAP HANA always matches Unicode.
+func regexFlags(options string) (string, error) {
+	var flags string
+	for _, o := range options {
+		switch o {
+		case 'i', 'm', 's', 'x':
+			if !strings.ContainsRune(flags, o) {
+				flags += string(o)
+			}
+		case 'u':
+		default:
+			return "", NewErrorMessage(ErrBadValue, "invalid flag in regex options: %c", o)
+		}
+	}
+
+	return flags, nil
+}
+
+// likeTranslatable returns true if the pattern only uses the parts of regular expressions LIKE can express.
+func likeTranslatable(pattern string) bool {
+	if strings.ContainsAny(pattern, regexMetaChars) {
+		return false
+	}
+
+	for i, c := range pattern {
+		switch c {
+		case '^':
+			if i != 0 {
+				return false
+			}
+		case '$':
+			if i != len(pattern)-1 {
+				return false
+			}
+		case '*':
+			if i == 0 || pattern[i-1] != '.' {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// anchoredPrefix returns the literal characters a pattern starting with ^ requires at the beginning.
+// With extended it ignores whitespace and comments like the x option.
+// Patterns with alternatives at the top level have no prefix, as ^ only anchors the first one,
+// and neither have the characters before a quantifier, which may repeat or drop them.
+func anchoredPrefix(pattern string, extended bool) string {
+	if !strings.HasPrefix(pattern, "^") || hasTopLevelAlternation(pattern, extended) {
+		return ""
+	}
+
+	var prefix []rune
+	for _, c := range pattern[1:] {
+		if extended && (c == ' ' || c == '\t' || c == '\n' || c == '\r') {
+			continue
+		}
+
+		if strings.ContainsRune("*+?{", c) {
+			return ""
+		}
+
+		if strings.ContainsRune(".^$|()[]\\#", c) {
+			break
+		}
+
+		prefix = append(prefix, c)
+	}
+
+	return string(prefix)
+}
+
+// hasTopLevelAlternation returns true if the pattern has a | outside of groups, character classes, escapes
+// and, with extended, comments.
+func hasTopLevelAlternation(pattern string, extended bool) bool {
+	var depth int
+	var class, escaped, comment bool
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case comment:
+			comment = c != '\n'
+		case c == '\\':
+			escaped = true
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '#' && extended:
+			comment = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			return true
+		}
+	}
+
+	return false
+}
+
+// likePrefix returns the LIKE pattern matching all strings starting with prefix, bound to a parameter of p.
+func likePrefix(prefix string, p *Placeholder) string {
+	var escape bool
+	var vSQL string
+	for _, c := range prefix {
+		switch c {
+		case '%', '_', '^':
+			vSQL += "^" + string(c)
+			escape = true
+		default:
+			vSQL += string(c)
+		}
+	}
+
+	vSQL = p.Next(vSQL + "%")
+	if escape {
+		vSQL += " ESCAPE '^'"
+	}
+
+	return vSQL
+}
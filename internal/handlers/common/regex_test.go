@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestRegexPredicate(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		value    any
+		options  string
+		expected string
+		err      string
+	}{
+		"Like": {
+			value:    "^abc.*",
+			expected: `"field" LIKE 'abc%%'`,
+		},
+		"CaseInsensitive": {
+			value:    "^abc",
+			options:  "i",
+			expected: `"field" LIKE_REGEXPR '^abc' FLAG 'i'`,
+		},
+		"Multiline": {
+			value:    "^abc$",
+			options:  "m",
+			expected: `"field" LIKE_REGEXPR '^abc$' FLAG 'm'`,
+		},
+		"DotAll": {
+			value:    "a.c",
+			options:  "s",
+			expected: `"field" LIKE_REGEXPR 'a.c' FLAG 's'`,
+		},
+		"Extended": {
+			value:    "^ab c # comment",
+			options:  "x",
+			expected: `("field" LIKE 'abc%' AND "field" LIKE_REGEXPR '^ab c # comment' FLAG 'x')`,
+		},
+		"RegexOptions": {
+			value:    types.Regex{Pattern: "abc", Options: "ims"},
+			expected: `"field" LIKE_REGEXPR 'abc' FLAG 'ims'`,
+		},
+		"AnchoredPrefix": {
+			value:    "^abc[0-9]+",
+			expected: `("field" LIKE 'abc%' AND "field" LIKE_REGEXPR '^abc[0-9]+')`,
+		},
+		"AnchoredPrefixQuantifier": {
+			value:    "^abc?d",
+			expected: `"field" LIKE_REGEXPR '^abc?d'`,
+		},
+		"AnchoredPrefixAlternation": {
+			value:    "^a|b",
+			expected: `"field" LIKE_REGEXPR '^a|b'`,
+		},
+		"AnchoredPrefixEscape": {
+			value:    "^a_b'(c|d)",
+			expected: `("field" LIKE 'a^_b''%' ESCAPE '^' AND "field" LIKE_REGEXPR '^a_b''(c|d)')`,
+		},
+		"Unanchored": {
+			value:    "(abc|def)",
+			expected: `"field" LIKE_REGEXPR '(abc|def)'`,
+		},
+		"Unicode": {
+			value:    "abc",
+			options:  "u",
+			expected: `"field" LIKE '%abc%'`,
+		},
+		"InvalidOption": {
+			value:   "abc",
+			options: "g",
+			err:     "BadValue (2): invalid flag in regex options: g",
+		},
+		"OptionsTwice": {
+			value:   types.Regex{Pattern: "abc", Options: "i"},
+			options: "m",
+			err:     "Location51075 (51075): options set in both $regex and $options",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := boundRegexPredicate(`"field"`, tc.value, tc.options)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		pattern  string
+		extended bool
+		expected string
+	}{
+		"Literal":              {pattern: "^abc", expected: "abc"},
+		"Unanchored":           {pattern: "abc", expected: ""},
+		"Alternation":          {pattern: "^a|b", expected: ""},
+		"GroupAlternation":     {pattern: "^a(b|c)", expected: "a"},
+		"ClassAlternation":     {pattern: "^a[|]", expected: "a"},
+		"EscapedAlternation":   {pattern: "^a\\|b", expected: "a"},
+		"CommentAlternation":   {pattern: "^a # b|c", extended: true, expected: "a"},
+		"Optional":             {pattern: "^ab?", expected: ""},
+		"ZeroRepetitions":      {pattern: "^a{0}", expected: ""},
+		"OneOrMore":            {pattern: "^ab+", expected: ""},
+		"Group":                {pattern: "^(a)", expected: ""},
+		"QuantifiedAfterGroup": {pattern: "^ab(c)*", expected: "ab"},
+		"Class":                {pattern: "^ab[0-9]", expected: "ab"},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expected, anchoredPrefix(tc.pattern, tc.extended))
+		})
+	}
+}
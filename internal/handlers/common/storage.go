@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -25,10 +27,21 @@ import (
 )
 
 type Storage interface {
+	MsgAggregate(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgCreateIndexes(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgCurrentOp(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgDelete(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgExplain(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgFindOrCount(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgFindAndModify(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgGetMore(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgInsert(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgKillCursors(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgKillOp(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgSeed(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+	MsgSetIndexCommitQuorum(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
 	MsgUpdate(context.Context, *wire.OpMsg) (*wire.OpMsg, error)
+
+	// Close releases the resources of the connection, like its cursors.
+	Close()
 }
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// textScoreMeta is the $meta keyword of the score of $text, like in {score: {$meta: "textScore"}}.
+// The score is never available, as $text is not supported.
+const textScoreMeta = "textScore"
+
+// IsTextScoreMeta returns true if the value of a projection or sort is {$meta: "textScore"}.
+// Other values of $meta are not supported.
+func IsTextScoreMeta(value any) (bool, error) {
+	doc, ok := value.(types.Document)
+	if !ok {
+		return false, nil
+	}
+
+	meta, ok := doc.Map()["$meta"]
+	if !ok {
+		return false, nil
+	}
+
+	if len(doc.Keys()) != 1 {
+		return false, NewErrorMessage(ErrBadValue, "$meta must be the only field of the expression")
+	}
+
+	switch meta {
+	case textScoreMeta:
+		return true, nil
+	case "indexKey", "recordId", "searchScore", "searchHighlights", "sortKey", "geoNearDistance", "geoNearPoint", "randVal":
+		return false, NewErrorMessage(ErrNotImplemented, "support for $meta \"%s\" is not implemented yet", meta)
+	default:
+		return false, NewErrorMessage(ErrBadValue, "unsupported metadata: %v", meta)
+	}
+}
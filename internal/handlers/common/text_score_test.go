@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestIsTextScoreMeta(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		value    any
+		expected bool
+		err      string
+	}{
+		"None": {
+			value: int32(1),
+		},
+		"Document": {
+			value: types.MustMakeDocument("$eq", int32(1)),
+		},
+		"Score": {
+			value:    types.MustMakeDocument("$meta", "textScore"),
+			expected: true,
+		},
+		"OtherFields": {
+			value: types.MustMakeDocument("$meta", "textScore", "a", int32(1)),
+			err:   "BadValue (2): $meta must be the only field of the expression",
+		},
+		"OtherMeta": {
+			value: types.MustMakeDocument("$meta", "indexKey"),
+			err:   `NotImplemented (238): support for $meta "indexKey" is not implemented yet`,
+		},
+		"UnknownMeta": {
+			value: types.MustMakeDocument("$meta", "foo"),
+			err:   "BadValue (2): unsupported metadata: foo",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := IsTextScoreMeta(tc.value)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
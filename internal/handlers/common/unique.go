@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
@@ -21,7 +22,8 @@ import (
 func IsIdUnique(id any, db, collection string, ctx context.Context, hanapool *hana.Hpool) (unique bool, errMsg error, err error) {
 	sql := "SELECT _id FROM \"%s\".\"%s\" "
 
-	whereSQL, errSQL := CreateWhereClause(types.MustMakeDocument([]any{"_id", id}...))
+	var p Placeholder
+	whereSQL, errSQL := CreateWhereClause(types.MustMakeDocument([]any{"_id", id}...), &p)
 	if errSQL != nil {
 		err = errSQL
 		return
@@ -30,7 +32,7 @@ func IsIdUnique(id any, db, collection string, ctx context.Context, hanapool *ha
 	sql = fmt.Sprintf(sql, db, collection) + whereSQL + " LIMIT 1"
 
 	var returnValue any
-	ScanErr := hanapool.QueryRowContext(ctx, sql).Scan(&returnValue)
+	ScanErr := hanapool.QueryRowContext(ctx, sql, p.Args()...).Scan(&returnValue)
 
 	if ScanErr != nil {
 		if strings.EqualFold(ScanErr.Error(), "sql: no rows in result set") {
@@ -43,6 +45,10 @@ func IsIdUnique(id any, db, collection string, ctx context.Context, hanapool *ha
 	}
 
 	byteID, errMarshal := fjson.MarshalHANA(id)
+	if v, ok := id.(int64); ok {
+		// large int64 values are stored with their keys, see fjson.Int64
+		byteID = []byte(strconv.FormatInt(v, 10))
+	}
 	if errMarshal != nil {
 		err = errMarshal
 		return
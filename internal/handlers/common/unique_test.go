@@ -44,7 +44,7 @@ func setupDBMock(t *testing.T) (mock sqlmock.Sqlmock, hPool hana.Hpool, err erro
 	}
 
 	hPool = hana.Hpool{
-		db,
+		DB: db,
 	}
 
 	return
@@ -60,7 +60,7 @@ func TestUnique(t *testing.T) {
 
 		emptyRow := mock.NewRows([]string{"_id"})
 
-		mock.ExpectQuery("SELECT _id FROM \"TESTDATABASE\".\"TESTCOLLECTION\"  WHERE \"_id\" = 123 LIMIT 1").WillReturnRows(emptyRow)
+		mock.ExpectQuery("SELECT _id FROM \"TESTDATABASE\".\"TESTCOLLECTION\"  WHERE \"_id\" = ? LIMIT 1").WithArgs(int64(123)).WillReturnRows(emptyRow)
 
 		unique, errMsg, err := IsIdUnique(int64(123), "TESTDATABASE", "TESTCOLLECTION", ctx, &hPool)
 
@@ -78,7 +78,7 @@ func TestUnique(t *testing.T) {
 
 		emptyRow := mock.NewRows([]string{"_id"}).AddRow("62e2bd54510683f9c0bb0d6b")
 
-		mock.ExpectQuery("SELECT _id FROM \"TESTDATABASE\".\"TESTCOLLECTION\"  WHERE \"_id\" = {\"oid\":'62e2bd54510683f9c0bb0d6b'} LIMIT 1").WillReturnRows(emptyRow)
+		mock.ExpectQuery("SELECT _id FROM \"TESTDATABASE\".\"TESTCOLLECTION\"  WHERE \"_id\" = {\"oid\": ?} LIMIT 1").WithArgs("62e2bd54510683f9c0bb0d6b").WillReturnRows(emptyRow)
 
 		unique, errMsg, err := IsIdUnique(types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, "TESTDATABASE", "TESTCOLLECTION", ctx, &hPool)
 
@@ -5,19 +5,20 @@
 package common
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 )
 
-// update creates needed SQL parts for SQL update statement
-func Update(updateDoc types.Document) (updateSQL string, notWhereSQL string, err error) {
+// update creates needed SQL parts for SQL update statement.
+// The values of the update are bound to parameters of p, and the ones of notWhereSQL,
+// which follows the WHERE clause of the statement, to parameters of notWhereP.
+func Update(updateDoc types.Document, p, notWhereP *Placeholder) (updateSQL string, notWhereSQL string, err error) {
 	uninmplementedFields := []string{
 		"$currentDate",
 		"$inc",
@@ -55,7 +56,7 @@ func Update(updateDoc types.Document) (updateSQL string, notWhereSQL string, err
 	var setDoc types.Document
 	var ok bool
 	if setDoc, ok = updateMap["$set"].(types.Document); ok {
-		updateSQL, isUnsetSQL, err = createSetandUnsetSqlStmnt(setDoc, true)
+		updateSQL, isUnsetSQL, err = createSetandUnsetSqlStmnt(setDoc, true, p)
 		if err != nil {
 			return
 		}
@@ -63,13 +64,13 @@ func Update(updateDoc types.Document) (updateSQL string, notWhereSQL string, err
 
 	var unSetSQL, isSetSQL string
 	if unSetDoc, ok := updateMap["$unset"].(types.Document); ok {
-		if unSetSQL, isSetSQL, err = createSetandUnsetSqlStmnt(unSetDoc, false); err != nil {
+		if unSetSQL, isSetSQL, err = createSetandUnsetSqlStmnt(unSetDoc, false, p); err != nil {
 			return
 		}
 	}
 
 	if isUnsetSQL != "" && isSetSQL != "" { // If both setting and unsetting fields
-		notWhereSQL, err = CreateWhereClause(setDoc)
+		notWhereSQL, err = CreateWhereClause(setDoc, notWhereP)
 		if err != nil {
 			if strings.Contains(err.Error(), "value *types.Array not supported in filter") {
 				err = NewErrorMessage(ErrNotImplemented, "cannot update a field with array")
@@ -81,7 +82,7 @@ func Update(updateDoc types.Document) (updateSQL string, notWhereSQL string, err
 		notWhereSQL = " AND ( NOT ( " + strings.Replace(notWhereSQL, "WHERE", "", 1) + ") OR (" + isUnsetSQL + " ) OR ( " + isSetSQL + " ))"
 		updateSQL += ", " + unSetSQL
 	} else if isUnsetSQL != "" { // If only setting fields
-		notWhereSQL, err = CreateWhereClause(setDoc)
+		notWhereSQL, err = CreateWhereClause(setDoc, notWhereP)
 		if err != nil {
 			if strings.Contains(err.Error(), "value *types.Array not supported in filter") {
 				err = NewErrorMessage(ErrNotImplemented, "cannot update a field with array")
@@ -101,7 +102,7 @@ func Update(updateDoc types.Document) (updateSQL string, notWhereSQL string, err
 	return
 }
 
-func createSetandUnsetSqlStmnt(doc types.Document, set bool) (updateSQL string, isSetOrUnsetSQL string, err error) {
+func createSetandUnsetSqlStmnt(doc types.Document, set bool, p *Placeholder) (updateSQL string, isSetOrUnsetSQL string, err error) {
 	if set {
 		updateSQL = " SET "
 	} else {
@@ -132,7 +133,7 @@ func createSetandUnsetSqlStmnt(doc types.Document, set bool) (updateSQL string,
 		}
 
 		if set {
-			updateValue, err = GetUpdateValue(value)
+			updateValue, err = GetUpdateValue(value, p)
 			if err != nil {
 				return
 			}
@@ -146,6 +147,48 @@ func createSetandUnsetSqlStmnt(doc types.Document, set bool) (updateSQL string,
 	return
 }
 
+// ReplaceSQL returns the SET and UNSET clauses of an UPDATE statement replacing the document old with the document doc,
+// or an empty string if they are equal. Only the top-level fields which differ are set or unset,
+// and their values are bound to parameters of p. The _id must not change.
+func ReplaceSQL(old, doc types.Document, p *Placeholder) (string, error) {
+	if id, ok := doc.Map()["_id"]; !ok || types.Compare(id, old.Map()["_id"]) != 0 {
+		return "", NewErrorMessage(ErrBadValue, "performing an update on the path '_id' would modify the immutable field '_id'")
+	}
+
+	var set, unset []string
+	for _, key := range doc.Keys() {
+		value := doc.Map()[key]
+		if oldValue, ok := old.Map()[key]; ok && types.Compare(oldValue, value) == 0 {
+			continue
+		}
+
+		valueSQL, err := GetUpdateValue(value, p)
+		if err != nil {
+			return "", err
+		}
+		set = append(set, quoteField(key)+" = "+valueSQL)
+	}
+
+	for _, key := range old.Keys() {
+		if _, ok := doc.Map()[key]; !ok {
+			unset = append(unset, quoteField(key))
+		}
+	}
+
+	var sql string
+	if len(set) > 0 {
+		sql = " SET " + strings.Join(set, ", ")
+	}
+	if len(unset) > 0 {
+		if sql != "" {
+			sql += ","
+		}
+		sql += " UNSET " + strings.Join(unset, ", ")
+	}
+
+	return sql, nil
+}
+
 // getUpdateKey prepares the key (field) for SQL statement
 func getUpdateKey(key string) (updateKey string, err error) {
 	if strings.Contains(key, ".") {
@@ -169,83 +212,56 @@ func getUpdateKey(key string) (updateKey string, err error) {
 				updateKey += "."
 			}
 
-			updateKey += "\"" + k + "\""
+			updateKey += quoteField(k)
 
 			isInt = false
 
 		}
 	} else {
-		updateKey = "\"" + key + "\""
+		updateKey = quoteField(key)
 	}
 
 	return
 }
 
-// getUpdateValue prepares the value for SQL statement
-func GetUpdateValue(value any) (updateValue string, err error) {
-	var updateArgs []any
+// getUpdateValue prepares the value for SQL statement, binding it to parameters of p.
+func GetUpdateValue(value any, p *Placeholder) (updateValue string, err error) {
 	switch value := value.(type) {
-	case string:
-		updateValue += "'%s'"
-		updateArgs = append(updateArgs, value)
+	case string, int32, float64:
+		updateValue = p.Next(value)
 	case int64:
-		updateValue += "%d"
-		updateArgs = append(updateArgs, value)
-	case int32:
-		updateValue += "%d"
-		updateArgs = append(updateArgs, value)
-	case float64:
-		updateValue += "%f"
-		updateArgs = append(updateArgs, value)
+		updateValue = int64SQL(value, p)
 	case nil:
-		updateValue += "NULL"
-		return
+		updateValue = "NULL"
 	case bool:
-		updateValue += "to_json_boolean(%t)"
-		updateArgs = append(updateArgs, value)
+		updateValue = "to_json_boolean(" + p.Next(value) + ")"
+	case time.Time:
+		updateValue = dateSQL(value, p)
 	case *types.Array:
-		updateValue, err = PrepareArrayForSQL(value)
-		if err != nil {
-			return
-		}
+		updateValue, err = PrepareArrayForSQL(value, p)
 	case types.Document:
-		updateValue += "%s"
-		var argDoc string
-		argDoc, err = updateDocument(value)
-		if err != nil {
-			return
-		}
-
-		updateArgs = append(updateArgs, argDoc)
+		updateValue, err = updateDocument(value, p)
 	case types.ObjectID:
-		updateValue += "%s"
-		var bOBJ []byte
-		if bOBJ, err = bson.ObjectID(value).MarshalJSON(); err != nil {
-			err = lazyerrors.Errorf("scalar: %w", err)
-		}
-		oid := bytes.Replace(bOBJ, []byte{34}, []byte{39}, -1)
-		oid = bytes.Replace(oid, []byte{39}, []byte{34}, 2)
-		updateArgs = append(updateArgs, string(oid))
+		updateValue = objectIDSQL(value, p)
 	default:
 		err = lazyerrors.Errorf("Value: %T is not supported for update", value)
 	}
 
-	updateValue = fmt.Sprintf(updateValue, updateArgs...)
 	return
 }
 
-// updateDocument prepares a document for being used as value for updating a field
-func updateDocument(doc types.Document) (docSQL string, err error) {
+// updateDocument prepares a document for being used as value for updating a field.
+// The keys of the document are quoted like fields and its values are bound to parameters of p.
+func updateDocument(doc types.Document, p *Placeholder) (docSQL string, err error) {
 	docSQL += "{"
 	var value any
-	var args []any
 	for i, key := range doc.Keys() {
 
 		if i != 0 {
 			docSQL += ", "
 		}
 
-		docSQL += "\"" + key + "\": "
+		docSQL += quoteField(key) + ": "
 
 		value, err = doc.Get(key)
 
@@ -254,47 +270,33 @@ func updateDocument(doc types.Document) (docSQL string, err error) {
 		}
 
 		switch value := value.(type) {
-		case int32, int64:
-			docSQL += "%d"
-			args = append(args, value)
-		case float64:
-			docSQL += "%f"
-			args = append(args, value)
-		case string:
-
-			docSQL += "'%s'"
-			args = append(args, value)
+		case int32, float64, string:
+			docSQL += p.Next(value)
+		case int64:
+			docSQL += int64SQL(value, p)
 		case bool:
-
-			docSQL += "to_json_boolean(%t)"
-			args = append(args, value)
+			docSQL += "to_json_boolean(" + p.Next(value) + ")"
 		case nil:
-			docSQL += " NULL "
+			docSQL += "NULL"
+		case time.Time:
+			docSQL += dateSQL(value, p)
 		case *types.Array:
 			var arraySQL string
-			arraySQL, err = PrepareArrayForSQL(value)
-			docSQL += arraySQL
+			arraySQL, err = PrepareArrayForSQL(value, p)
 			if err != nil {
 				return
 			}
+			docSQL += arraySQL
 		case types.ObjectID:
-			docSQL += "%s"
-			var bOBJ []byte
-			bOBJ, err = bson.ObjectID(value).MarshalJSON()
-			oid := bytes.Replace(bOBJ, []byte{34}, []byte{39}, -1)
-			oid = bytes.Replace(oid, []byte{39}, []byte{34}, 2)
-			args = append(args, string(oid))
+			docSQL += objectIDSQL(value, p)
 		case types.Document:
-
-			docSQL += "%s"
-
 			var docValue string
-			docValue, err = updateDocument(value)
+			docValue, err = updateDocument(value, p)
 			if err != nil {
 				return
 			}
 
-			args = append(args, docValue)
+			docSQL += docValue
 
 		default:
 			err = NewErrorMessage(ErrBadValue, "%T is not supported within an object for filtering", value)
@@ -302,6 +304,6 @@ func updateDocument(doc types.Document) (docSQL string, err error) {
 		}
 	}
 
-	docSQL = fmt.Sprintf(docSQL, args...) + "}"
+	docSQL += "}"
 	return
 }
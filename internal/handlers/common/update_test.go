@@ -15,31 +15,31 @@ func TestMsgUpdate(t *testing.T) {
 	t.Run("set fields with supported and unsupported values", func(t *testing.T) {
 		t.Parallel()
 
-		updateSQL, notWhereSQL, err := Update(types.MustMakeDocument("$set", types.MustMakeDocument("str_value", "value", "int32_value", int32(123), "int64_value", int64(223372036854775807), "float64_value", 64534.12432, "bool_value", true, "objID_value", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, "document_value", types.MustMakeDocument("string", "value", "int32", int32(2), "int64", int64(4543654563), "float", float64(543245.2245), "bool", true, "array", types.MustNewArray(int32(1), "2"), "nested_docu", types.MustMakeDocument("inside", "array"), "objID", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, "null", nil), "null_value", nil, "nested.field", "value", "nested.field.array.2", int32(12))))
+		updateSQL, notWhereSQL, err := boundUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("str_value", "value", "int32_value", int32(123), "int64_value", int64(223372036854775807), "float64_value", 64534.12432, "bool_value", true, "objID_value", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, "document_value", types.MustMakeDocument("string", "value", "int32", int32(2), "int64", int64(4543654563), "float", float64(543245.2245), "bool", true, "array", types.MustNewArray(int32(1), "2"), "nested_docu", types.MustMakeDocument("inside", "array"), "objID", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, "null", nil), "null_value", nil, "nested.field", "value", "nested.field.array.2", int32(12))))
 
-		assert.Equal(t, " SET \"str_value\" = 'value', \"int32_value\" = 123, \"int64_value\" = 223372036854775807, \"float64_value\" = 64534.124320, \"bool_value\" = to_json_boolean(true), \"objID_value\" = {\"oid\":'62e2bd54510683f9c0bb0d6b'}, \"document_value\" = {\"string\": 'value', \"int32\": 2, \"int64\": 4543654563, \"float\": 543245.224500, \"bool\": to_json_boolean(true), \"array\": [1, '2'], \"nested_docu\": {\"inside\": 'array'}, \"objID\": {\"oid\":'62e2bd54510683f9c0bb0d6b'}, \"null\":  NULL }, \"null_value\" = NULL, \"nested\".\"field\" = 'value', \"nested\".\"field\".\"array\"[3] = 12", updateSQL)
-		assert.Equal(t, " AND ( NOT (   \"str_value\" = 'value' AND \"int32_value\" = 123 AND \"int64_value\" = 223372036854775807 AND \"float64_value\" = 64534.124320 AND \"bool_value\" = to_json_boolean(true) AND \"objID_value\" = {\"oid\":'62e2bd54510683f9c0bb0d6b'} AND \"document_value\" = {\"string\": 'value', \"int32\": 2, \"int64\": 4543654563, \"float\": 543245.224500, \"bool\": to_json_boolean(true), \"array\": [1, '2'], \"nested_docu\": {\"inside\": 'array'}, \"objID\": {\"oid\":'62e2bd54510683f9c0bb0d6b'}, \"null\":  NULL } AND \"null_value\" IS NULL AND \"nested\".\"field\" = 'value' AND \"nested\".\"field\".\"array\"[3] = 12) OR (\"str_value\" IS UNSET OR \"int32_value\" IS UNSET OR \"int64_value\" IS UNSET OR \"float64_value\" IS UNSET OR \"bool_value\" IS UNSET OR \"objID_value\" IS UNSET OR \"document_value\" IS UNSET OR \"null_value\" IS UNSET OR \"nested\".\"field\" IS UNSET OR \"nested\".\"field\".\"array\"[3] IS UNSET )) ", notWhereSQL)
+		assert.Equal(t, " SET \"str_value\" = 'value', \"int32_value\" = 123, \"int64_value\" = {\"$l\": '09446744073709551615', \"$n\": 223372036854775807}, \"float64_value\" = 64534.12432, \"bool_value\" = to_json_boolean(true), \"objID_value\" = {\"oid\": '62e2bd54510683f9c0bb0d6b'}, \"document_value\" = {\"string\": 'value', \"int32\": 2, \"int64\": 4543654563, \"float\": 543245.2245, \"bool\": to_json_boolean(true), \"array\": [1, '2'], \"nested_docu\": {\"inside\": 'array'}, \"objID\": {\"oid\": '62e2bd54510683f9c0bb0d6b'}, \"null\": NULL}, \"null_value\" = NULL, \"nested\".\"field\" = 'value', \"nested\".\"field\".\"array\"[3] = 12", updateSQL)
+		assert.Equal(t, " AND ( NOT (   \"str_value\" = 'value' AND \"int32_value\" = 123 AND \"int64_value\".\"$l\" = '09446744073709551615' AND \"float64_value\" = 64534.12432 AND \"bool_value\" = to_json_boolean(true) AND \"objID_value\" = {\"oid\": '62e2bd54510683f9c0bb0d6b'} AND \"document_value\" = {\"string\": 'value', \"int32\": 2, \"int64\": 4543654563, \"float\": 543245.2245, \"bool\": to_json_boolean(true), \"array\": [1, '2'], \"nested_docu\": {\"inside\": 'array'}, \"objID\": {\"oid\": '62e2bd54510683f9c0bb0d6b'}, \"null\": NULL} AND (\"null_value\" IS NULL OR \"null_value\" IS UNSET) AND \"nested\".\"field\" = 'value' AND \"nested\".\"field\".\"array\"[3] = 12) OR (\"str_value\" IS UNSET OR \"int32_value\" IS UNSET OR \"int64_value\" IS UNSET OR \"float64_value\" IS UNSET OR \"bool_value\" IS UNSET OR \"objID_value\" IS UNSET OR \"document_value\" IS UNSET OR \"null_value\" IS UNSET OR \"nested\".\"field\" IS UNSET OR \"nested\".\"field\".\"array\"[3] IS UNSET )) ", notWhereSQL)
 		assert.Nil(t, err)
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$set", types.MustMakeDocument("array", types.MustNewArray(int32(1), "2"))))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("array", types.MustNewArray(int32(1), "2"))))
 
 		assert.Equal(t, " SET \"array\" = [1, '2']", updateSQL)
 		assert.Equal(t, " WHERE ", notWhereSQL)
 		assert.EqualError(t, err, "NotImplemented (238): cannot update a field with array")
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$set", types.MustMakeDocument("_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107})))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("_id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107})))
 
 		assert.Equal(t, " SET ", updateSQL)
 		assert.Equal(t, "", notWhereSQL)
 		assert.EqualError(t, err, `performing an update on the path '_id' would modify the immutable field '_id'`)
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$set", types.MustMakeDocument("array.2.3", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107})))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("array.2.3", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107})))
 
 		assert.Equal(t, " SET ", updateSQL)
 		assert.Equal(t, "", notWhereSQL)
 		assert.ErrorContains(t, err, "NotImplemented (238): not yet supporting indexing on an array inside of an array")
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$set", types.MustMakeDocument("unsupported value", types.Binary{Subtype: types.BinarySubtype(byte(12)), B: []byte("hello")})))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$set", types.MustMakeDocument("unsupported value", types.Binary{Subtype: types.BinarySubtype(byte(12)), B: []byte("hello")})))
 
 		assert.Equal(t, " SET ", updateSQL)
 		assert.Equal(t, "", notWhereSQL)
@@ -49,13 +49,13 @@ func TestMsgUpdate(t *testing.T) {
 	t.Run("unset fields with supported and unsupported values", func(t *testing.T) {
 		t.Parallel()
 
-		updateSQL, notWhereSQL, err := Update(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", "", "field2", int32(123))))
+		updateSQL, notWhereSQL, err := boundUpdate(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", "", "field2", int32(123))))
 
 		assert.Equal(t, " UNSET \"field1\", \"field2\"", updateSQL)
 		assert.Equal(t, " AND ( \"field1\" IS SET OR \"field2\" IS SET )", notWhereSQL)
 		assert.Nil(t, err)
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$unset", types.MustMakeDocument("_id", "")))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$unset", types.MustMakeDocument("_id", "")))
 
 		assert.Equal(t, "", updateSQL)
 		assert.Equal(t, "", notWhereSQL)
@@ -65,22 +65,41 @@ func TestMsgUpdate(t *testing.T) {
 	t.Run("unset and unset fields with supported and unsupported values", func(t *testing.T) {
 		t.Parallel()
 
-		updateSQL, notWhereSQL, err := Update(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", "", "field2", int32(123)), "$set", types.MustMakeDocument("field3", int32(123))))
+		updateSQL, notWhereSQL, err := boundUpdate(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", "", "field2", int32(123)), "$set", types.MustMakeDocument("field3", int32(123))))
 
 		assert.Equal(t, " SET \"field3\" = 123,  UNSET \"field1\", \"field2\"", updateSQL)
 		assert.Equal(t, " AND ( NOT (   \"field3\" = 123) OR (\"field3\" IS UNSET ) OR ( \"field1\" IS SET OR \"field2\" IS SET ))", notWhereSQL)
 		assert.Nil(t, err)
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$unset", types.MustMakeDocument("_id", ""), "$set", types.MustMakeDocument("field", "value")))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$unset", types.MustMakeDocument("_id", ""), "$set", types.MustMakeDocument("field", "value")))
 
 		assert.Equal(t, " SET \"field\" = 'value'", updateSQL)
 		assert.Equal(t, "", notWhereSQL)
 		assert.EqualError(t, err, `performing an update on the path '_id' would modify the immutable field '_id'`)
 
-		updateSQL, notWhereSQL, err = Update(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", ""), "$set", types.MustMakeDocument("array", types.MustNewArray(int32(1), "2"))))
+		updateSQL, notWhereSQL, err = boundUpdate(types.MustMakeDocument("$unset", types.MustMakeDocument("field1", ""), "$set", types.MustMakeDocument("array", types.MustNewArray(int32(1), "2"))))
 
 		assert.Equal(t, " SET \"array\" = [1, '2']", updateSQL)
 		assert.Equal(t, " WHERE ", notWhereSQL)
 		assert.EqualError(t, err, "NotImplemented (238): cannot update a field with array")
 	})
 }
+
+func TestReplaceSQL(t *testing.T) {
+	t.Parallel()
+
+	old := types.MustMakeDocument("_id", int32(1), "a", int32(1), "b", "x", "c", true)
+
+	var p Placeholder
+	sql, err := ReplaceSQL(old, types.MustMakeDocument("_id", int32(1), "a", int32(2), "b", "x", "d", nil), &p)
+	assert.NoError(t, err)
+	assert.Equal(t, ` SET "a" = ?, "d" = NULL, UNSET "c"`, sql)
+	assert.Equal(t, []any{int32(2)}, p.Args())
+
+	sql, err = ReplaceSQL(old, old, new(Placeholder))
+	assert.NoError(t, err)
+	assert.Equal(t, "", sql)
+
+	_, err = ReplaceSQL(old, types.MustMakeDocument("a", int32(1)), new(Placeholder))
+	assert.EqualError(t, err, "BadValue (2): performing an update on the path '_id' would modify the immutable field '_id'")
+}
@@ -62,11 +62,13 @@ func Upsert(updateDoc *types.Document, filter *types.Document, replace bool) (*t
 func filterUpsert(filter *types.Document) (*types.Document, error) {
 	doc := types.MustMakeDocument()
 
-	for key, value := range filter.Map() {
+	// the upserted document has the fields in the order of the filter
+	for _, key := range filter.Keys() {
+		value := filter.Map()[key]
 		if strings.HasPrefix(key, "$") {
 			continue
 		}
-		if _, ok := value.(types.Document); ok {
+		if d, ok := value.(types.Document); ok && !isDBRef(d) {
 			continue
 		}
 		if _, ok := value.(types.Array); ok {
@@ -88,15 +90,47 @@ func filterUpsert(filter *types.Document) (*types.Document, error) {
 func updateUpsert(updateDoc *types.Document, d *types.Document) (*types.Document, error) {
 	updateMap := updateDoc.Map()
 
+	if pushDoc, ok := updateMap["$push"].(types.Document); ok {
+		for _, key := range pushDoc.Keys() {
+			// the arrays of embedded documents are created with their parents
+			if strings.Contains(key, ".") && !isNestedPath(key) {
+				return nil, NewErrorMessage(ErrNotImplemented, "upsert with $push to the path %s with an array index is not implemented yet", key)
+			}
+
+			p, err := parsePush(key, pushDoc.Map()[key])
+			if err != nil {
+				return nil, err
+			}
+
+			arr, err := p.apply(*d)
+			if err != nil {
+				return nil, err
+			}
+
+			if err = setByPath(d, key, arr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	setDoc, ok := updateMap["$set"].(types.Document)
 	if !ok {
 		return d, nil
 	}
 
-	for key, value := range setDoc.Map() {
+	for _, key := range setDoc.Keys() {
+		value := setDoc.Map()[key]
 		if strings.HasPrefix(key, "$") {
 			continue
 		}
+
+		// fields of embedded documents are created with their parents
+		if isNestedPath(key) {
+			if err := setByPath(d, key, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		if strings.Contains(key, ".") {
 			continue
 		}
@@ -43,6 +43,22 @@ func TestUpsert(t *testing.T) {
 			caseName: "update with upsert - update and filter with none equal key-value pair error", updateDoc: types.MustMakeDocumentPointer("$set", types.MustMakeDocument("name", "testing", "type", "normal", "number", int32(123))),
 			filter: types.MustMakeDocumentPointer("name", "test"), replace: false, e: upsertExpected{expDoc: nil, expErr: fmt.Errorf("Key-value pair name:test from query document is not equal to same key-value pair name:testing in update document")},
 		},
+		{
+			caseName: "update with upsert - nested fields", updateDoc: types.MustMakeDocumentPointer("$set", types.MustMakeDocument("a.b.c", int32(1), "a.b.d", "x", "e", true)),
+			filter: types.MustMakeDocumentPointer("name", "test"), replace: false, e: upsertExpected{expDoc: types.MustMakeDocumentPointer(
+				"name", "test", "a", types.MustMakeDocument("b", types.MustMakeDocument("c", int32(1), "d", "x")), "e", true,
+			), expErr: nil},
+		},
+		{
+			caseName: "update with upsert - key order of filter", updateDoc: types.MustMakeDocumentPointer("$set", types.MustMakeDocument("b", int32(2))),
+			filter: types.MustMakeDocumentPointer("z", int32(26), "a", int32(1), "$or", types.MustNewArray(), "m", int32(13)), replace: false,
+			e: upsertExpected{expDoc: types.MustMakeDocumentPointer("z", int32(26), "a", int32(1), "m", int32(13), "b", int32(2)), expErr: nil},
+		},
+		{
+			caseName: "update with upsert - dbref filter", updateDoc: types.MustMakeDocumentPointer("$set", types.MustMakeDocument("name", "test")),
+			filter: types.MustMakeDocumentPointer("author", types.MustMakeDocument("$ref", "users", "$id", int32(1))), replace: false,
+			e: upsertExpected{expDoc: types.MustMakeDocumentPointer("author", types.MustMakeDocument("$ref", "users", "$id", int32(1)), "name", "test"), expErr: nil},
+		},
 	}
 
 	for _, field := range upserCases {
@@ -63,6 +79,8 @@ func TestUpsert(t *testing.T) {
 				t.Errorf("%s: Upsert(%v, %v, %t) FAILED. Expected doc = %v and err = %v but got doc = %v and err = %v", field.caseName, field.updateDoc, field.filter, field.replace, field.e.expDoc, field.e.expErr, actualDoc, actualErr)
 			} else if !reflect.DeepEqual(field.e.expDoc.Map(), actualDoc.Map()) {
 				t.Errorf("%s: Upsert(%v, %v, %t) FAILED. Expected doc = %v and err = %v but got doc = %v and err = %v", field.caseName, field.updateDoc, field.filter, field.replace, field.e.expDoc, field.e.expErr, actualDoc, actualErr)
+			} else {
+				assert.Equal(t, field.e.expDoc.Keys(), actualDoc.Keys(), field.caseName)
 			}
 		} else {
 			t.Errorf("%s: Upsert(%v, %v, %t) FAILED. Expected doc = %v and err = %v but got doc = %v and err = %v", field.caseName, field.updateDoc, field.filter, field.replace, field.e.expDoc, field.e.expErr, actualDoc, actualErr)
@@ -21,19 +21,26 @@
 package common
 
 import (
-	"bytes"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"time"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 )
 
 // CreateWhereClause creates the WHERE-clause of the SQL statement.
-func CreateWhereClause(filter types.Document) (sql string, err error) {
+// The values of the filter are bound to parameters of p.
+func CreateWhereClause(filter types.Document, p *Placeholder) (sql string, err error) {
+	return CreateCollatedWhereClause(filter, nil, p)
+}
+
+// CreateCollatedWhereClause creates the WHERE-clause of the SQL statement
+// comparing strings according to the collation.
+// The values of the filter are bound to parameters of p.
+func CreateCollatedWhereClause(filter types.Document, collation *Collation, p *Placeholder) (sql string, err error) {
 	for i, key := range filter.Keys() {
 
 		if i == 0 {
@@ -46,7 +53,7 @@ func CreateWhereClause(filter types.Document) (sql string, err error) {
 
 		// Stands for key-value SQL
 		var kvSQL string
-		kvSQL, err = wherePair(key, value)
+		kvSQL, err = wherePair(key, value, collation, p)
 
 		if err != nil {
 			return
@@ -59,28 +66,48 @@ func CreateWhereClause(filter types.Document) (sql string, err error) {
 }
 
 // wherePair takes a {field: value} and converts it to SQL
-func wherePair(key string, value any) (kvSQL string, err error) {
+func wherePair(key string, value any, collation *Collation, p *Placeholder) (kvSQL string, err error) {
+	if key == "$expr" { // {$expr: expression}
+		kvSQL, err = exprSQL(value, collation, p)
+		return
+	}
+
+	if key == "$text" {
+		// SAP HANA JSON Document Store has no full-text indexes, and scanning all documents instead would be too slow
+		err = NewErrorMessage(ErrNotImplemented, "$text is not supported, as SAP HANA JSON Document Store has no full-text indexes")
+		return
+	}
+
 	if strings.HasPrefix(key, "$") { // {$: value}
 
-		kvSQL, err = logicExpression(key, value)
+		kvSQL, err = logicExpression(key, value, collation, p)
 		return
 
 	}
 
 	switch value := value.(type) {
 	case types.Document:
-		if strings.HasPrefix(value.Keys()[0], "$") { // {field: {$: value}}
-			kvSQL, err = fieldExpression(key, value)
+		if strings.HasPrefix(value.Keys()[0], "$") && !isDBRef(value) { // {field: {$: value}}
+			kvSQL, err = fieldExpression(key, value, collation, p)
 			return
 		}
 	}
 
-	// vSQL: ValueSQL
-	var vSQL string
-	var sign string
-	vSQL, sign, err = whereValue(value)
+	if regex, ok := value.(types.Regex); ok { // {field: /pattern/options}
+		var kSQL string
+		kSQL, err = whereKey(key)
+		if err != nil {
+			return
+		}
 
-	if err != nil {
+		kvSQL, err = regexPredicate(kSQL, regex, "", p)
+		if err != nil {
+			return
+		}
+
+		if isNor {
+			kvSQL = "(" + kvSQL + " AND " + kSQL + " IS SET)"
+		}
 		return
 	}
 
@@ -91,7 +118,34 @@ func wherePair(key string, value any) (kvSQL string, err error) {
 		return
 	}
 
-	kvSQL = kSQL + sign + vSQL
+	if value == nil {
+		kvSQL = nullSQL(kSQL, "$eq")
+		return
+	}
+
+	if isNumber(value) {
+		kvSQL = numberSQL(kSQL, "$eq", value, p)
+		if isNor {
+			kvSQL = "(" + kvSQL + " AND " + kSQL + " IS SET)"
+		}
+		return
+	}
+
+	// vSQL: ValueSQL, which is only created for values used in the SQL, as its parameters are bound
+	var vSQL string
+	var sign string
+	vSQL, sign, err = whereValue(value, p)
+
+	if err != nil {
+		return
+	}
+
+	if _, ok := value.(time.Time); ok {
+		kSQL = dateKey(kSQL)
+	}
+
+	cSQL, vSQL := collation.collate(kSQL, vSQL, value)
+	kvSQL = cSQL + sign + vSQL
 
 	if isNor {
 		kvSQL = "(" + kvSQL + " AND " + kSQL + " IS SET)"
@@ -100,112 +154,263 @@ func wherePair(key string, value any) (kvSQL string, err error) {
 	return
 }
 
-// whereKey prepares the key (field) for SQL
+// whereKey prepares the key (field) for SQL.
+// A key in dot notation like "address.city" is converted to the path "address"."city"
+// and numeric parts after the first one like "items.0" or "matrix.0.1" are converted to array indexes "items"[1] and "matrix"[1][2].
 func whereKey(key string) (kSQL string, err error) {
-	if strings.Contains(key, ".") {
-		splitKey := strings.Split(key, ".")
-		var isInt bool
-		for i, k := range splitKey {
-
-			if kInt, convErr := strconv.Atoi(k); convErr == nil {
-				if isInt {
-					kSQL = ""
-					err = NewErrorMessage(ErrNotImplemented, "not yet supporting indexing on an array inside of an array")
-					return
-				}
-				if kInt < 0 {
-					kSQL = ""
-					err = fmt.Errorf("negative array index is not allowed")
-					return
-				}
-				kIntSQL := "[" + "%d" + "]"
-				kSQL += fmt.Sprintf(kIntSQL, (kInt + 1))
-				isInt = true
-				continue
-			}
+	if !strings.Contains(key, ".") {
+		kSQL = quoteField(key)
+		return
+	}
 
-			if i != 0 {
-				kSQL += "."
-			}
+	for i, k := range strings.Split(key, ".") {
+		if k == "" {
+			kSQL = ""
+			err = NewErrorMessage(ErrBadValue, "field path %s contains an empty field name", key)
+			return
+		}
 
-			kSQL += "\"" + k + "\""
+		// the first part is always a field name as the document itself is no array
+		if i != 0 && strings.HasPrefix(k, "-") {
+			if _, convErr := strconv.Atoi(k); convErr == nil {
+				kSQL = ""
+				err = fmt.Errorf("negative array index is not allowed")
+				return
+			}
+		}
 
-			isInt = false
+		if index, ok := arrayIndex(k); ok && i != 0 {
+			// SQL arrays start at 1
+			kSQL += fmt.Sprintf("[%d]", index+1)
+			continue
+		}
 
+		if i != 0 {
+			kSQL += "."
 		}
-	} else {
-		kSQL = "\"" + key + "\""
+
+		kSQL += quoteField(k)
 	}
 
 	return
 }
 
-// whereValue prepares the value for SQL
-func whereValue(value any) (vSQL string, sign string, err error) {
-	var args []any
-	switch value := value.(type) {
-	case int32, int64:
-		vSQL = "%d"
-		args = append(args, value)
-	case float64:
-		vSQL = "%f"
-		args = append(args, value)
+// FieldSQL returns the SQL of a field path like "address.city" for statements like GROUP BY.
+func FieldSQL(path string) (string, error) {
+	return whereKey(path)
+}
+
+// JoinSQL returns the ON condition of a join matching the field localPath of the documents of the collection
+// with the alias local with the field foreignPath of the documents of the collection with the alias foreign.
+// Like in $lookup, a null or missing field matches null and missing fields.
+func JoinSQL(local, localPath, foreign, foreignPath string) (string, error) {
+	localSQL, err := whereKey(localPath)
+	if err != nil {
+		return "", err
+	}
+	foreignSQL, err := whereKey(foreignPath)
+	if err != nil {
+		return "", err
+	}
+
+	localSQL = quoteField(local) + "." + localSQL
+	foreignSQL = quoteField(foreign) + "." + foreignSQL
+
+	return "(" + localSQL + " = " + foreignSQL + " OR (" + nullSQL(localSQL, "$eq") + " AND " + nullSQL(foreignSQL, "$eq") + "))", nil
+}
+
+// arrayIndex returns the array index of a part of a path.
+// Like in MongoDB only non-negative numbers without sign and leading zeros are indexes,
+// so "01" or "+1" are field names.
+func arrayIndex(k string) (int, bool) {
+	if k == "" || (len(k) > 1 && k[0] == '0') {
+		return 0, false
+	}
+
+	for _, c := range k {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	index, err := strconv.Atoi(k)
+	if err != nil {
+		return 0, false
+	}
+
+	return index, true
+}
+
+// dateKey returns the path of the milliseconds since epoch of a date stored in the field kSQL.
+// Dates are compared by them since they are stored as {"$da": milliseconds}.
+func dateKey(kSQL string) string {
+	return kSQL + ".\"$da\""
+}
+
+// OrderBySQL returns the ORDER BY expressions sorting by the field kSQL in the direction ASC or DESC.
+// Dates are sorted by their milliseconds first, which are NULL for other values,
+// so dates keep their millisecond precision and, like in MongoDB, come after numbers and strings in ascending order.
+func OrderBySQL(kSQL, direction string) string {
+	nulls := " NULLS FIRST"
+	if direction == "DESC" {
+		nulls = " NULLS LAST"
+	}
+
+	return dateKey(kSQL) + " " + direction + nulls + ", " + kSQL + " " + direction
+}
+
+// quoteField quotes a single field name for SQL.
+func quoteField(field string) string {
+	return "\"" + strings.ReplaceAll(field, "\"", "\"\"") + "\""
+}
+
+// isComparison returns true for the comparison operators like $eq or $gt.
+func isComparison(operator string) bool {
+	switch operator {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+		return true
+	default:
+		return false
+	}
+}
+
+// isRange returns true for the operators comparing the order of values like $gt.
+func isRange(operator string) bool {
+	switch operator {
+	case "$gt", "$gte", "$lt", "$lte":
+		return true
+	default:
+		return false
+	}
+}
+
+// bracketSQL returns the condition restricting the field kSQL to values of the same type as value.
+// Like in MongoDB, {$gt: 5} only matches numbers and {$lt: "b"} only matches strings.
+// Dates and ObjectIDs need no condition as they are compared by their own paths.
+func bracketSQL(kSQL string, value any) string {
+	switch value.(type) {
+	case int32, int64, float64:
+		return kSQL + " BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308"
 	case string:
-		vSQL = "'%s'"
-		args = append(args, value)
+		// LIKE only matches strings, see $regex
+		return kSQL + " LIKE '%'"
+	default:
+		return ""
+	}
+}
+
+// IsNumberSQL returns the condition which is true if the field kSQL holds a number.
+func IsNumberSQL(kSQL string) string {
+	return bracketSQL(kSQL, float64(0))
+}
+
+// IsStringSQL returns the condition which is true if the field kSQL holds a string.
+func IsStringSQL(kSQL string) string {
+	return bracketSQL(kSQL, "")
+}
+
+// UniformTypeSQL returns the aggregate expression which is 1 if the non-null values of the field kSQL
+// are either all numbers or all strings, which SAP HANA compares like MongoDB, and 0 otherwise.
+func UniformTypeSQL(kSQL string) string {
+	numbers := "COUNT(CASE WHEN " + IsNumberSQL(kSQL) + " THEN 1 END)"
+	strs := "COUNT(CASE WHEN " + IsStringSQL(kSQL) + " THEN 1 END)"
+	return "CASE WHEN COUNT(" + kSQL + ") IN (" + numbers + ", " + strs + ") THEN 1 ELSE 0 END"
+}
+
+// boolRangeSQL converts the range comparison of a field with a boolean to SQL.
+// false is less than true and booleans are not compared with other types.
+func boolRangeSQL(kSQL, operator string, value bool) string {
+	var matches []bool
+	for _, b := range []bool{false, true} {
+		switch {
+		case b == value && (operator == "$gte" || operator == "$lte"),
+			b && !value && (operator == "$gt" || operator == "$gte"),
+			!b && value && (operator == "$lt" || operator == "$lte"):
+			matches = append(matches, b)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "1 = 0"
+	case 1:
+		return fmt.Sprintf("%s = to_json_boolean(%t)", kSQL, matches[0])
+	default:
+		return "(" + kSQL + " = to_json_boolean(false) OR " + kSQL + " = to_json_boolean(true))"
+	}
+}
+
+// nullSQL converts the comparison of a field with null to SQL.
+// Like in MongoDB null is equal to a missing field, so {field: null} matches both
+// documents where the field is null and where it is missing.
+func nullSQL(kSQL, operator string) string {
+	switch operator {
+	case "$ne":
+		return "(" + kSQL + " IS NOT NULL AND " + kSQL + " IS SET)"
+	case "$gt", "$lt":
+		// nothing is greater or less than null
+		return "1 = 0"
+	default:
+		return "(" + kSQL + " IS NULL OR " + kSQL + " IS UNSET)"
+	}
+}
+
+// whereValue prepares the value for SQL, binding it to a parameter of p.
+func whereValue(value any, p *Placeholder) (vSQL string, sign string, err error) {
+	switch value := value.(type) {
+	case int32, int64, float64, string:
+		vSQL = p.Next(value)
 	case bool:
-		vSQL = "to_json_boolean(%t)"
-		args = append(args, value)
+		vSQL = "to_json_boolean(" + p.Next(value) + ")"
+	case time.Time:
+		vSQL = p.Next(value.UnixMilli())
 	case nil:
 		vSQL = "NULL"
 		sign = " IS "
 		return
 	case types.Regex:
-		vSQL, err = regex(value)
+		vSQL, err = regex(value, p)
 		if err != nil {
 			return
 		}
 		sign = " LIKE "
 		return
 	case types.ObjectID:
-		var bOBJ []byte
-		bOBJ, err = bson.ObjectID(value).MarshalJSON()
-		if err != nil {
-			return
-		}
-		oid := bytes.Replace(bOBJ, []byte{34}, []byte{39}, -1)
-		oid = bytes.Replace(oid, []byte{39}, []byte{34}, 2)
-		vSQL = "%s"
-		args = append(args, string(oid))
-
+		vSQL = objectIDSQL(value, p)
 	case types.Document:
-		vSQL = "%s"
-		var docValue string
-		docValue, err = whereDocument(value)
-		args = append(args, docValue)
+		vSQL, err = whereDocument(value, p)
 	default:
 		err = NewErrorMessage(ErrBadValue, "value %T not supported in filter", value)
 		return
 
 	}
 	sign = " = "
-	vSQL = fmt.Sprintf(vSQL, args...)
 
 	return
 }
 
+// objectIDSQL returns the SQL of an ObjectID, which is stored as {"oid": hex}.
+func objectIDSQL(oid types.ObjectID, p *Placeholder) string {
+	return "{\"oid\": " + p.Next(hex.EncodeToString(oid[:])) + "}"
+}
+
+// dateSQL returns the SQL of a date inside of a document or an array, which is stored as {"$da": milliseconds}.
+func dateSQL(date time.Time, p *Placeholder) string {
+	return "{\"$da\": " + p.Next(date.UnixMilli()) + "}"
+}
+
 // whereDocument prepares a document for fx. value = {document}.
-func whereDocument(doc types.Document) (docSQL string, err error) {
+// The keys of the document are quoted like fields and its values are bound to parameters of p.
+func whereDocument(doc types.Document, p *Placeholder) (docSQL string, err error) {
 	docSQL += "{"
 	var value any
-	var args []any
 	for i, key := range doc.Keys() {
 
 		if i != 0 {
 			docSQL += ", "
 		}
 
-		docSQL += "\"" + key + "\": "
+		docSQL += quoteField(key) + ": "
 
 		value, err = doc.Get(key)
 
@@ -214,48 +419,35 @@ func whereDocument(doc types.Document) (docSQL string, err error) {
 		}
 
 		switch value := value.(type) {
-		case int32, int64:
-			docSQL += "%d"
-			args = append(args, value)
-		case float64:
-			docSQL += "%f"
-			args = append(args, value)
-		case string:
-
-			docSQL += "'%s'"
-			args = append(args, value)
+		case int32, float64, string:
+			docSQL += p.Next(value)
+		case int64:
+			docSQL += int64SQL(value, p)
 		case bool:
-
-			docSQL += "to_json_boolean(%t)"
-
-			args = append(args, value)
+			docSQL += "to_json_boolean(" + p.Next(value) + ")"
+		case time.Time:
+			docSQL += dateSQL(value, p)
 		case nil:
-			docSQL += " NULL "
+			docSQL += "NULL"
 		case types.ObjectID:
-			docSQL += "%s"
-			var bOBJ []byte
-			bOBJ, err = bson.ObjectID(value).MarshalJSON()
-			oid := bytes.Replace(bOBJ, []byte{34}, []byte{39}, -1)
-			oid = bytes.Replace(oid, []byte{39}, []byte{34}, 2)
-			args = append(args, string(oid))
+			docSQL += objectIDSQL(value, p)
 		case *types.Array:
 			var sqlArray string
-
-			sqlArray, err = PrepareArrayForSQL(value)
+			sqlArray, err = PrepareArrayForSQL(value, p)
+			if err != nil {
+				return
+			}
 
 			docSQL += sqlArray
 
 		case types.Document:
-
-			docSQL += "%s"
-
 			var docValue string
-			docValue, err = whereDocument(value)
+			docValue, err = whereDocument(value, p)
 			if err != nil {
 				return
 			}
 
-			args = append(args, docValue)
+			docSQL += docValue
 
 		default:
 			err = NewErrorMessage(ErrBadValue, "the document used in filter contains a datatype not yet supported: %T", value)
@@ -263,15 +455,15 @@ func whereDocument(doc types.Document) (docSQL string, err error) {
 		}
 	}
 
-	docSQL = fmt.Sprintf(docSQL, args...) + "}"
+	docSQL += "}"
 
 	return
 }
 
-// PrepareArrayForSQL prepares an array which is inside of a document for SQL
-func PrepareArrayForSQL(a *types.Array) (sqlArray string, err error) {
+// PrepareArrayForSQL prepares an array which is inside of a document for SQL,
+// binding its values to parameters of p.
+func PrepareArrayForSQL(a *types.Array, p *Placeholder) (sqlArray string, err error) {
 	var value any
-	var args []any
 	sqlArray += "["
 	for i := 0; i < a.Len(); i++ {
 		if i != 0 {
@@ -284,30 +476,33 @@ func PrepareArrayForSQL(a *types.Array) (sqlArray string, err error) {
 		}
 
 		switch value := value.(type) {
-		case string, int32, int64, float64, types.ObjectID, nil, bool:
+		case string, int32, float64, types.ObjectID, nil, bool:
 			var sql string
-			sql, _, err = whereValue(value)
+			sql, _, err = whereValue(value, p)
+			if err != nil {
+				return
+			}
 			sqlArray += sql
+		case int64:
+			sqlArray += int64SQL(value, p)
+		case time.Time:
+			sqlArray += dateSQL(value, p)
 		case *types.Array:
 			var sql string
-			sql, err = PrepareArrayForSQL(value)
+			sql, err = PrepareArrayForSQL(value, p)
 			if err != nil {
 				return
 			}
-			sqlArray += "%s"
-			args = append(args, sql)
+			sqlArray += sql
 
 		case types.Document:
-
-			sqlArray += "%s"
-
 			var docValue string
-			docValue, err = whereDocument(value)
+			docValue, err = whereDocument(value, p)
 			if err != nil {
 				return
 			}
 
-			args = append(args, docValue)
+			sqlArray += docValue
 
 		default:
 			err = NewErrorMessage(ErrBadValue, "The array used in filter contains a datatype not yet supported: %T", value)
@@ -316,7 +511,6 @@ func PrepareArrayForSQL(a *types.Array) (sqlArray string, err error) {
 	}
 
 	sqlArray += "]"
-	sqlArray = fmt.Sprintf(sqlArray, args...)
 
 	return
 }
@@ -327,7 +521,7 @@ var (
 )
 
 // logicExpression converts expressions like $AND and $OR to the equivalent expressions in SQL.
-func logicExpression(key string, value any) (kvSQL string, err error) {
+func logicExpression(key string, value any, collation *Collation, p *Placeholder) (kvSQL string, err error) {
 	logicExprMap := map[string]string{
 		"$and": " AND ",
 		"$or":  " OR ",
@@ -391,7 +585,7 @@ func logicExpression(key string, value any) (kvSQL string, err error) {
 					if err != nil {
 						return
 					}
-					exprSQL, err = wherePair(k, value)
+					exprSQL, err = wherePair(k, value, collation, p)
 					if err != nil {
 						return
 					}
@@ -428,24 +622,27 @@ func logicExpression(key string, value any) (kvSQL string, err error) {
 
 // fieldExpression converts expressions like $gt or $elemMatch to the equivalent expression in SQL.
 // Used for {field: {$: value}}.
-func fieldExpression(key string, value any) (kvSQL string, err error) {
+func fieldExpression(key string, value any, collation *Collation, p *Placeholder) (kvSQL string, err error) {
 	fieldExprMap := map[string]string{
-		"$gt":        " > ",
-		"$gte":       " >= ",
-		"$lt":        " < ",
-		"$lte":       " <= ",
-		"$eq":        " = ",
-		"$ne":        " <> ",
-		"$exists":    " IS ",
-		"$size":      "CARDINALITY",
-		"$all":       "all",
-		"$elemmatch": "elemMatch",
-		"$not":       " NOT ",
-		"$regex":     " LIKE ",
+		"$gt":            " > ",
+		"$gte":           " >= ",
+		"$lt":            " < ",
+		"$lte":           " <= ",
+		"$eq":            " = ",
+		"$ne":            " <> ",
+		"$exists":        " IS ",
+		"$size":          "CARDINALITY",
+		"$all":           "all",
+		"$elemmatch":     "elemMatch",
+		"$not":           " NOT ",
+		"$regex":         " LIKE ",
+		"$geowithin":     "geoWithin",
+		"$geointersects": "geoIntersects",
+		"$near":          "near",
 	}
 
-	var kSQL string
-	kSQL, err = whereKey(key)
+	var fieldSQL string
+	fieldSQL, err = whereKey(key)
 	if err != nil {
 		return
 	}
@@ -455,26 +652,46 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 
 		var exprValue any
 		var vSQL string
-		for i, k := range value.Keys() {
+		for _, k := range value.Keys() {
 
-			if i != 0 {
-				kvSQL += " AND "
+			// $options are used by $regex
+			if k == "$options" {
+				if _, ok := value.Map()["$regex"]; !ok {
+					err = NewErrorMessage(ErrBadValue, "$options needs a $regex")
+					return
+				}
+				continue
 			}
-			kvSQL += kSQL
 
 			lowerK := strings.ToLower(k)
 
-			fieldExpr, ok := fieldExprMap[lowerK]
-			if !ok {
-				err = NewErrorMessage(ErrNotImplemented, "support for %s is not implemented yet", k)
+			exprValue, err = value.Get(k)
+			if err != nil {
 				return
 			}
 
-			exprValue, err = value.Get(k)
-			if err != nil {
+			kSQL := fieldSQL
+			if _, ok := exprValue.(time.Time); ok && isComparison(lowerK) {
+				kSQL = dateKey(kSQL)
+			}
+
+			if kvSQL != "" {
+				kvSQL += " AND "
+			}
+			kvSQL += kSQL
+
+			fieldExpr, ok := fieldExprMap[lowerK]
+			if !ok {
+				err = NewErrorMessage(ErrNotImplemented, "support for %s is not implemented yet", k)
 				return
 			}
 			var sign string
+			if exprValue == nil && isComparison(lowerK) {
+				// comparisons with null also match missing fields
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL) + nullSQL(kSQL, lowerK)
+				continue
+			}
+
 			if lowerK == "$exists" {
 				switch exprValue := exprValue.(type) {
 				case bool:
@@ -490,12 +707,12 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 				}
 			} else if lowerK == "$size" {
 				kvSQL = fieldExpr + "(" + kvSQL + ")"
-				vSQL, fieldExpr, err = whereValue(exprValue)
+				vSQL, fieldExpr, err = whereValue(exprValue, p)
 				if err != nil {
 					return
 				}
 			} else if lowerK == "$all" || lowerK == "$elemmatch" {
-				kvSQL, err = filterArray(kvSQL, fieldExpr, exprValue)
+				kvSQL, err = filterArray(kvSQL, fieldExpr, exprValue, collation, p)
 				if err != nil {
 					return
 				}
@@ -503,7 +720,7 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 			} else if lowerK == "$not" {
 				var fieldSQL string
 				expr := value.Map()[k]
-				fieldSQL, err = fieldExpression(key, expr)
+				fieldSQL, err = fieldExpression(key, expr, collation, p)
 				fieldSQL = "(" + fieldExpr + fieldSQL + " OR " + kSQL + " IS UNSET) "
 				if err != nil {
 					err = NewErrorMessage(ErrBadValue, "wrong use of $not")
@@ -512,9 +729,13 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 
 				kvSQL = fieldSQL
 				return
+			} else if isNumber(exprValue) && isComparison(lowerK) {
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL)
+				fieldExpr = ""
+				vSQL = numberSQL(kSQL, lowerK, exprValue, p)
 			} else if lowerK == "$ne" {
 				kvSQL = "(" + kvSQL
-				vSQL, sign, err = whereValue(exprValue)
+				vSQL, sign, err = whereValue(exprValue, p)
 				if err != nil {
 					return
 				}
@@ -522,11 +743,47 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 					fieldExpr = " IS NOT "
 				}
 
+				var cSQL string
+				cSQL, vSQL = collation.collate(kSQL, vSQL, exprValue)
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL) + cSQL
+
 				vSQL += " OR " + kSQL + " IS UNSET)"
 			} else if lowerK == "$regex" {
-				vSQL, err = regex(exprValue)
+				options, ok := value.Map()["$options"].(string)
+				if _, set := value.Map()["$options"]; set && !ok {
+					err = NewErrorMessage(ErrBadValue, "$options has to be a string")
+					return
+				}
+
+				// the predicate already contains the field
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL)
+				fieldExpr = ""
+				vSQL, err = regexPredicate(kSQL, exprValue, options, p)
+				if err != nil {
+					return
+				}
+			} else if lowerK == "$geowithin" || lowerK == "$geointersects" || lowerK == "$near" {
+				// the spatial predicate already contains the field
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL)
+				fieldExpr = ""
+				vSQL, err = geoExpression(kSQL, lowerK, exprValue)
+				if err != nil {
+					return
+				}
+			} else if oid, ok := exprValue.(types.ObjectID); ok && isRange(lowerK) {
+				// SAP HANA can only compare scalars with < and >,
+				// the hex strings of ObjectIDs have the same order as the ObjectIDs
+				kvSQL += ".\"oid\""
+				vSQL = p.Next(hex.EncodeToString(oid[:]))
+			} else if b, ok := exprValue.(bool); ok && isRange(lowerK) {
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL)
+				fieldExpr = ""
+				vSQL = boolRangeSQL(kSQL, lowerK, b)
+			} else if _, ok := exprValue.(types.Document); ok && isRange(lowerK) {
+				err = NewErrorMessage(ErrNotImplemented, "%s with an object is not implemented yet", k)
+				return
 			} else {
-				vSQL, sign, err = whereValue(exprValue)
+				vSQL, sign, err = whereValue(exprValue, p)
 				if err != nil {
 					return
 				}
@@ -534,6 +791,15 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 				if strings.EqualFold(sign, " IS ") {
 					fieldExpr = sign
 				}
+
+				var cSQL string
+				cSQL, vSQL = collation.collate(kSQL, vSQL, exprValue)
+				kvSQL = strings.TrimSuffix(kvSQL, kSQL) + cSQL
+
+				if guard := bracketSQL(kSQL, exprValue); guard != "" && isRange(lowerK) {
+					kvSQL = strings.TrimSuffix(kvSQL, cSQL) + "(" + guard + " AND " + cSQL
+					vSQL += ")"
+				}
 			}
 
 			kvSQL += fieldExpr + vSQL
@@ -551,7 +817,7 @@ func fieldExpression(key string, value any) (kvSQL string, err error) {
 }
 
 // filterArray implements $all and $elemMatch using the FOR ANY
-func filterArray(field string, arrayOperator string, filters any) (kvSQL string, err error) {
+func filterArray(field string, arrayOperator string, filters any, collation *Collation, p *Placeholder) (kvSQL string, err error) {
 	switch filters := filters.(type) {
 	case types.Document:
 		if strings.EqualFold(arrayOperator, "all") {
@@ -559,7 +825,8 @@ func filterArray(field string, arrayOperator string, filters any) (kvSQL string,
 			return
 		}
 		i := 0
-		for f, v := range filters.Map() {
+		for _, f := range filters.Keys() {
+			v := filters.Map()[f]
 
 			if i != 0 {
 				kvSQL += " AND "
@@ -571,15 +838,14 @@ func filterArray(field string, arrayOperator string, filters any) (kvSQL string,
 			}
 			var sql string
 			if strings.Contains(doc.Keys()[0], "$") {
-				sql, err = wherePair("element", doc)
+				sql, err = wherePair("element", doc, collation, p)
 
-				if strings.EqualFold(doc.Keys()[0], "$not") {
-					sqlSlice := strings.Split(sql, "OR")
-					sql = strings.Replace(sqlSlice[0], "(", "", 1)
+				// the conditions added for missing fields are cut off, as elements are never missing
+				if i := strings.LastIndex(sql, " OR "); strings.EqualFold(doc.Keys()[0], "$not") && i >= 0 {
+					sql = strings.Replace(sql[:i], "(", "", 1)
 				}
-				if strings.Contains(sql, " IS SET") {
-					sqlSlice := strings.Split(sql, " AND ")
-					sql = strings.Replace(sqlSlice[0], "(", "", 1)
+				if i := strings.LastIndex(sql, " AND "); strings.Contains(sql, " IS SET") && i >= 0 {
+					sql = strings.Replace(sql[:i], "(", "", 1)
 				}
 			} else {
 				var value any
@@ -589,7 +855,7 @@ func filterArray(field string, arrayOperator string, filters any) (kvSQL string,
 					return
 				}
 
-				sql, err = wherePair(element, value)
+				sql, err = wherePair(element, value, collation, p)
 				if _, ok := value.(types.Document); ok {
 					if _, getErr := value.(types.Document).Get("$not"); getErr == nil {
 						replaceIndex := strings.LastIndex(sql, "UNSET")
@@ -631,7 +897,11 @@ func filterArray(field string, arrayOperator string, filters any) (kvSQL string,
 			if err != nil {
 				return
 			}
-			value, _, err = whereValue(v)
+			if isNumber(v) {
+				kvSQL += "FOR ANY \"element\" IN " + field + " SATISFIES " + numberSQL("\"element\"", "$eq", v, p) + " END "
+				continue
+			}
+			value, _, err = whereValue(v, p)
 			if err != nil {
 				return
 			}
@@ -645,8 +915,9 @@ func filterArray(field string, arrayOperator string, filters any) (kvSQL string,
 	return
 }
 
-// regex converts $regex to the SQL equivalent regular expressions
-func regex(value any) (vSQL string, err error) {
+// regex converts $regex to the SQL equivalent regular expressions,
+// binding the LIKE pattern to a parameter of p.
+func regex(value any, p *Placeholder) (vSQL string, err error) {
 	if regex, ok := value.(types.Regex); ok {
 		value = regex.Pattern
 		if regex.Options != "" {
@@ -751,7 +1022,7 @@ func regex(value any) (vSQL string, err error) {
 		return
 	}
 
-	vSQL = "'" + vSQL + "'"
+	vSQL = p.Next(vSQL)
 	if escape {
 		vSQL += " ESCAPE '^' "
 	}
@@ -6,8 +6,12 @@ package common
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 )
@@ -29,17 +33,62 @@ func TestWhere(t *testing.T) {
 			"equal_float64", float64(123.123),
 			"equal_objId", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
 		), e: expectedWhereKey{sql: " WHERE \"equal_string\" = 'string' AND \"equal_int32\" = 1 AND \"equal_int64\" = 123123123123 AND \"equal_bool\" = to_json_boolean(true) AND " +
-			"\"equal_eq\" = 'equal' AND \"equal_document\" = {\"field\": 123} AND \"equal_float64\" = 123.123000 AND \"equal_objId\" = {\"oid\":'62e2bd54510683f9c0bb0d6b'}", err: nil}},
+			"\"equal_eq\" = 'equal' AND \"equal_document\" = {\"field\": 123} AND \"equal_float64\" = 123.123 AND \"equal_objId\" = {\"oid\": '62e2bd54510683f9c0bb0d6b'}", err: nil}},
+		{name: "where date test", r: types.MustMakeDocument("createdAt", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+			"event", types.MustMakeDocument("at", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC))),
+			e: expectedWhereKey{sql: " WHERE \"createdAt\".\"$da\" = 1659312000000 AND \"event\" = {\"at\": {\"$da\": 1659312000000}}", err: nil}},
 		{name: "where comparison test", r: types.MustMakeDocument("greaterThan_int32", types.MustMakeDocument("$gt", int32(12)),
 			"lessThan_int64", types.MustMakeDocument("$lt", int64(123123)),
-		), e: expectedWhereKey{sql: " WHERE \"greaterThan_int32\" > 12 AND \"lessThan_int64\" < 123123", err: nil}},
+		), e: expectedWhereKey{sql: " WHERE ((\"greaterThan_int32\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"greaterThan_int32\" > 12) OR \"greaterThan_int32\".\"$n\" > 12) AND ((\"lessThan_int64\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"lessThan_int64\" < 123123) OR \"lessThan_int64\".\"$n\" < 123123)", err: nil}},
 		{
 			name: "logic expression test", r: types.MustMakeDocument("$or", types.MustNewArray(types.MustMakeDocument("field", "new"), types.MustMakeDocument("field2", true))),
 			e: expectedWhereKey{sql: " WHERE (\"field\" = 'new' OR \"field2\" = to_json_boolean(true))", err: nil},
 		},
 		{
-			name: "double array index error", r: types.MustMakeDocument("array.1.2", int32(1)),
-			e: expectedWhereKey{sql: " WHERE ", err: fmt.Errorf("NotImplemented (238): not yet supporting indexing on an array inside of an array")},
+			name: "dot notation test", r: types.MustMakeDocument("address.city", "Walldorf",
+				"address.geo.zip", types.MustMakeDocument("$gte", int32(69190), "$lt", int32(69200)),
+				"address.street", types.MustMakeDocument("$ne", nil),
+			),
+			e: expectedWhereKey{sql: " WHERE \"address\".\"city\" = 'Walldorf' AND ((\"address\".\"geo\".\"zip\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"address\".\"geo\".\"zip\" >= 69190) OR \"address\".\"geo\".\"zip\".\"$n\" >= 69190) AND ((\"address\".\"geo\".\"zip\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"address\".\"geo\".\"zip\" < 69200) OR \"address\".\"geo\".\"zip\".\"$n\" < 69200) AND " +
+				"(\"address\".\"street\" IS NOT NULL AND \"address\".\"street\" IS SET)", err: nil},
+		},
+		{
+			name: "dbref test", r: types.MustMakeDocument(
+				"author", types.MustMakeDocument("$ref", "users", "$id", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}),
+				"editor.$id", int32(7),
+			),
+			e: expectedWhereKey{sql: " WHERE \"author\" = {\"$ref\": 'users', \"$id\": {\"oid\": '62e2bd54510683f9c0bb0d6b'}} AND \"editor\".\"$id\" = 7", err: nil},
+		},
+		{
+			name: "regex with options test", r: types.MustMakeDocument("name", types.MustMakeDocument("$options", "i", "$regex", "^wall")),
+			e: expectedWhereKey{sql: " WHERE \"name\" LIKE_REGEXPR '^wall' FLAG 'i'", err: nil},
+		},
+		{
+			name: "regex object with options test", r: types.MustMakeDocument("name", types.Regex{Pattern: "^Wall[a-z]+$", Options: "s"}),
+			e: expectedWhereKey{sql: " WHERE (\"name\" LIKE 'Wall%' AND \"name\" LIKE_REGEXPR '^Wall[a-z]+$' FLAG 's')", err: nil},
+		},
+		{
+			name: "options without regex error", r: types.MustMakeDocument("name", types.MustMakeDocument("$options", "i")),
+			e: expectedWhereKey{sql: " WHERE ", err: fmt.Errorf("BadValue (2): $options needs a $regex")},
+		},
+		{
+			name: "null test", r: types.MustMakeDocument("field", nil),
+			e: expectedWhereKey{sql: " WHERE (\"field\" IS NULL OR \"field\" IS UNSET)", err: nil},
+		},
+		{
+			name: "null in nor test", r: types.MustMakeDocument("$nor", types.MustNewArray(types.MustMakeDocument("field", nil))),
+			e: expectedWhereKey{sql: " WHERE ( NOT ((\"field\" IS NULL OR \"field\" IS UNSET)))", err: nil},
+		},
+		{
+			name: "dot notation in logic expression test", r: types.MustMakeDocument("$nor", types.MustNewArray(types.MustMakeDocument("address.city", "Walldorf"))),
+			e: expectedWhereKey{sql: " WHERE ( NOT ((\"address\".\"city\" = 'Walldorf' AND \"address\".\"city\" IS SET)))", err: nil},
+		},
+		{
+			name: "array index test", r: types.MustMakeDocument("scores.0", types.MustMakeDocument("$gt", int32(90)),
+				"items.2.name", "pen",
+				"matrix.1.2", int32(1),
+			),
+			e: expectedWhereKey{sql: " WHERE ((\"scores\"[1] BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"scores\"[1] > 90) OR \"scores\"[1].\"$n\" > 90) AND \"items\"[3].\"name\" = 'pen' AND \"matrix\"[2][3] = 1", err: nil},
 		},
 		{
 			name: "double array index error", r: types.MustMakeDocument("array.1", types.MustNewArray(int32(32))),
@@ -49,7 +98,9 @@ func TestWhere(t *testing.T) {
 
 	for _, field := range whereTestCases {
 
-		sql, err := CreateWhereClause(field.r)
+		var p Placeholder
+		sql, err := CreateWhereClause(field.r, &p)
+		sql = bindSQL(sql, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -84,8 +135,16 @@ func TestWhereKey(t *testing.T) {
 		{name: "multiple fields test", r: "oneField.twoField.threeField", e: expectedWhereKey{sql: "\"oneField\".\"twoField\".\"threeField\"", err: nil}},
 		{name: "field with array index test", r: "array.0", e: expectedWhereKey{sql: "\"array\"[1]", err: nil}},
 		{name: "mix multiple fields and index test", r: "oneField.array.0.twoField", e: expectedWhereKey{sql: "\"oneField\".\"array\"[1].\"twoField\"", err: nil}},
+		{name: "deeply nested fields test", r: "a.b.c.d.e.f", e: expectedWhereKey{sql: "\"a\".\"b\".\"c\".\"d\".\"e\".\"f\"", err: nil}},
+		{name: "numeric first field test", r: "0.field", e: expectedWhereKey{sql: "\"0\".\"field\"", err: nil}},
+		{name: "field with quote test", r: "say.\"hi\"", e: expectedWhereKey{sql: "\"say\".\"\"\"hi\"\"\"", err: nil}},
+		{name: "empty field name error test", r: "address..city", e: expectedWhereKey{sql: "", err: fmt.Errorf("BadValue (2): field path address..city contains an empty field name")}},
+		{name: "trailing dot error test", r: "address.", e: expectedWhereKey{sql: "", err: fmt.Errorf("BadValue (2): field path address. contains an empty field name")}},
 		{name: "field with negative array index error test", r: "array.-1", e: expectedWhereKey{sql: "", err: fmt.Errorf("negative array index is not allowed")}},
-		{name: "double array index error test", r: "array.0.1", e: expectedWhereKey{sql: "", err: fmt.Errorf("NotImplemented (238): not yet supporting indexing on an array inside of an array")}},
+		{name: "nested array index test", r: "array.0.1", e: expectedWhereKey{sql: "\"array\"[1][2]", err: nil}},
+		{name: "array index of nested document test", r: "items.2.name", e: expectedWhereKey{sql: "\"items\"[3].\"name\"", err: nil}},
+		{name: "leading zero field test", r: "field.01", e: expectedWhereKey{sql: "\"field\".\"01\"", err: nil}},
+		{name: "signed number field test", r: "field.+1", e: expectedWhereKey{sql: "\"field\".\"+1\"", err: nil}},
 	}
 
 	for _, field := range whereKeyTestCases {
@@ -118,7 +177,7 @@ func TestWhereValue(t *testing.T) {
 		{name: "string test", r: "string", e: expectedWhereKey{sql: "'string'", sign: " = ", err: nil}},
 		{name: "int32 test", r: int32(123), e: expectedWhereKey{sql: "123", sign: " = ", err: nil}},
 		{name: "int32 test", r: int64(123), e: expectedWhereKey{sql: "123", sign: " = ", err: nil}},
-		{name: "float64 test", r: float64(123.123), e: expectedWhereKey{sql: "123.123000", sign: " = ", err: nil}},
+		{name: "float64 test", r: float64(123.123), e: expectedWhereKey{sql: "123.123", sign: " = ", err: nil}},
 		{name: "boolean test", r: true, e: expectedWhereKey{sql: "to_json_boolean(true)", sign: " = ", err: nil}},
 		{name: "boolean test", r: true, e: expectedWhereKey{sql: "to_json_boolean(true)", sign: " = ", err: nil}},
 		{name: "nil test", r: nil, e: expectedWhereKey{sql: "NULL", sign: " IS ", err: nil}},
@@ -133,7 +192,7 @@ func TestWhereValue(t *testing.T) {
 		{name: "regex option error test", r: types.Regex{Pattern: "_pa_t...t_er.*n%", Options: "m"}, e: expectedWhereKey{sql: "", sign: "", err: fmt.Errorf("The use of $options with regular expressions is not supported")}},
 		{name: "regex (i?) error test", r: types.Regex{Pattern: "patt(?i)ern"}, e: expectedWhereKey{sql: "", sign: "", err: fmt.Errorf("The use of (?i) and (?-i) with regular expressions is not supported")}},
 		{name: "regex (?-i) error test", r: types.Regex{Pattern: "pat(?-i)tern"}, e: expectedWhereKey{sql: "", sign: "", err: fmt.Errorf("The use of (?i) and (?-i) with regular expressions is not supported")}},
-		{name: "ObjectID test", r: types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, e: expectedWhereKey{sql: "{\"oid\":'62e2bd54510683f9c0bb0d6b'}", sign: " = ", err: nil}},
+		{name: "ObjectID test", r: types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, e: expectedWhereKey{sql: "{\"oid\": '62e2bd54510683f9c0bb0d6b'}", sign: " = ", err: nil}},
 		{
 			name: "document test", r: types.MustMakeDocument(
 				"bool", true,
@@ -142,14 +201,16 @@ func TestWhereValue(t *testing.T) {
 				"objectID", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
 				"string", "foo",
 				"null", nil),
-			e: expectedWhereKey{sql: "{\"bool\": to_json_boolean(true), \"int32\": 0, \"int64\": 223372036854775807, \"objectID\": {\"oid\":'62e2bd54510683f9c0bb0d6b'}, \"string\": 'foo', \"null\":  NULL }", sign: " = ", err: nil},
+			e: expectedWhereKey{sql: "{\"bool\": to_json_boolean(true), \"int32\": 0, \"int64\": {\"$l\": '09446744073709551615', \"$n\": 223372036854775807}, \"objectID\": {\"oid\": '62e2bd54510683f9c0bb0d6b'}, \"string\": 'foo', \"null\": NULL}", sign: " = ", err: nil},
 		},
 		{name: "type error test", r: int(34), e: expectedWhereKey{sql: "", sign: "", err: fmt.Errorf("BadValue (2): value int not supported in filter")}},
 	}
 
 	for _, field := range whereValueTestCases {
 
-		sql, sign, err := whereValue(field.r)
+		var p Placeholder
+		sql, sign, err := whereValue(field.r, &p)
+		sql = bindSQL(sql, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) || !strings.EqualFold(sign, field.e.sign) {
@@ -172,7 +233,7 @@ func TestWhereDocument(t *testing.T) {
 			name: "test document all data types", r: types.MustMakeDocument("int32", int32(0), "int64", int64(9090123123), "float64", float64(898.341123),
 				"string", "normal string", "bool", true, "nil", nil, "objID", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
 				"array", types.MustNewArray(int32(543), "string"), "document", types.MustMakeDocument("field", "name", "bool", true)),
-			e: expectedWhereKey{sql: "{\"int32\": 0, \"int64\": 9090123123, \"float64\": 898.341123, \"string\": 'normal string', \"bool\": to_json_boolean(true), \"nil\":  NULL , \"objID\": {\"oid\":'62e2bd54510683f9c0bb0d6b'}, \"array\": [543, 'string'], \"document\": {\"field\": 'name', \"bool\": to_json_boolean(true)}}", err: nil},
+			e: expectedWhereKey{sql: "{\"int32\": 0, \"int64\": 9090123123, \"float64\": 898.341123, \"string\": 'normal string', \"bool\": to_json_boolean(true), \"nil\": NULL, \"objID\": {\"oid\": '62e2bd54510683f9c0bb0d6b'}, \"array\": [543, 'string'], \"document\": {\"field\": 'name', \"bool\": to_json_boolean(true)}}", err: nil},
 		},
 		{
 			name: "not supported datatype test", r: types.MustMakeDocument("binary", types.Binary{Subtype: types.BinarySubtype(byte(12)), B: []byte("hello")}),
@@ -181,7 +242,9 @@ func TestWhereDocument(t *testing.T) {
 	}
 
 	for _, field := range whereDocumentTestCases {
-		docSQL, err := whereDocument(field.r)
+		var p Placeholder
+		docSQL, err := whereDocument(field.r, &p)
+		docSQL = bindSQL(docSQL, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(docSQL, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -208,7 +271,14 @@ func TestPrepareArraySQL(t *testing.T) {
 	prepareArrayForSQLTestCases := []testCasePrepareArraySQL{
 		{
 			name: "all datatypes", r: types.MustNewArray(int32(12), int64(123123), "string", float64(321.321), types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}, nil, types.MustMakeDocument("field", int32(123)), false, types.MustNewArray(int32(123), "new_array")),
-			e: expectedWhereKey{sql: "[12, 123123, 'string', 321.321000, {\"oid\":'62e2bd54510683f9c0bb0d6b'}, NULL, {\"field\": 123}, to_json_boolean(false), [123, 'new_array']]", err: nil},
+			e: expectedWhereKey{sql: "[12, 123123, 'string', 321.321, {\"oid\": '62e2bd54510683f9c0bb0d6b'}, NULL, {\"field\": 123}, to_json_boolean(false), [123, 'new_array']]", err: nil},
+		},
+		{
+			name: "nested documents and arrays", r: types.MustNewArray(
+				types.MustMakeDocument("tags", types.MustNewArray("100%", types.MustNewArray()), "items", types.MustNewArray(types.MustMakeDocument("n", int32(1)), types.MustMakeDocument())),
+				types.MustNewArray(types.MustNewArray(types.MustMakeDocument("d", time.UnixMilli(1659312000123)))),
+			),
+			e: expectedWhereKey{sql: "[{\"tags\": ['100%', []], \"items\": [{\"n\": 1}, {}]}, [[{\"d\": {\"$da\": 1659312000123}}]]]", err: nil},
 		},
 		{
 			name: "not support value test", r: types.MustNewArray(types.Binary{Subtype: types.BinarySubtype(byte(12)), B: []byte("hello")}),
@@ -217,7 +287,9 @@ func TestPrepareArraySQL(t *testing.T) {
 	}
 
 	for _, field := range prepareArrayForSQLTestCases {
-		sqlArray, err := PrepareArrayForSQL(field.r)
+		var p Placeholder
+		sqlArray, err := PrepareArrayForSQL(field.r, &p)
+		sqlArray = bindSQL(sqlArray, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sqlArray, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -281,7 +353,9 @@ func TestLogicExpression(t *testing.T) {
 	}
 
 	for _, field := range logicExpressionTestCases {
-		sql, err := logicExpression(field.r1, field.r2)
+		var p Placeholder
+		sql, err := logicExpression(field.r1, field.r2, nil, &p)
+		sql = bindSQL(sql, &p)
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
 				t.Errorf("%s: logicExpression(%s, %v) FAILED. Expected sql = %s and err = %v got sql = %s and err = %v", field.name,
@@ -300,19 +374,39 @@ func TestFieldExpression(t *testing.T) {
 	fieldExpressionTestCases := []testCaseExpression{
 		{
 			name: "greater than test", r1: "field", r2: types.MustMakeDocument("$gt", int32(9)),
-			e: expectedWhereKey{sql: "\"field\" > 9", err: nil},
+			e: expectedWhereKey{sql: "((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" > 9) OR \"field\".\"$n\" > 9)", err: nil},
 		},
 		{
 			name: "less than test", r1: "field", r2: types.MustMakeDocument("$lt", int32(9)),
-			e: expectedWhereKey{sql: "\"field\" < 9", err: nil},
+			e: expectedWhereKey{sql: "((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" < 9) OR \"field\".\"$n\" < 9)", err: nil},
 		},
 		{
 			name: "greater than or equal test", r1: "field", r2: types.MustMakeDocument("$gte", int32(9)),
-			e: expectedWhereKey{sql: "\"field\" >= 9", err: nil},
+			e: expectedWhereKey{sql: "((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" >= 9) OR \"field\".\"$n\" >= 9)", err: nil},
 		},
 		{
 			name: "less than or equal test", r1: "field", r2: types.MustMakeDocument("$lte", int32(9)),
-			e: expectedWhereKey{sql: "\"field\" <= 9", err: nil},
+			e: expectedWhereKey{sql: "((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" <= 9) OR \"field\".\"$n\" <= 9)", err: nil},
+		},
+		{
+			name: "string greater than test", r1: "field", r2: types.MustMakeDocument("$gt", "b"),
+			e: expectedWhereKey{sql: "(\"field\" LIKE '%' AND \"field\" > 'b')", err: nil},
+		},
+		{
+			name: "boolean greater than or equal false test", r1: "field", r2: types.MustMakeDocument("$gte", false),
+			e: expectedWhereKey{sql: "(\"field\" = to_json_boolean(false) OR \"field\" = to_json_boolean(true))", err: nil},
+		},
+		{
+			name: "boolean less than true test", r1: "field", r2: types.MustMakeDocument("$lt", true),
+			e: expectedWhereKey{sql: "\"field\" = to_json_boolean(false)", err: nil},
+		},
+		{
+			name: "boolean greater than true test", r1: "field", r2: types.MustMakeDocument("$gt", true),
+			e: expectedWhereKey{sql: "1 = 0", err: nil},
+		},
+		{
+			name: "object greater than test", r1: "field", r2: types.MustMakeDocument("$gt", types.MustMakeDocument("a", int32(1))),
+			e: expectedWhereKey{sql: "\"field\"", err: NewErrorMessage(ErrNotImplemented, "$gt with an object is not implemented yet")},
 		},
 		{
 			name: "equal test", r1: "field", r2: types.MustMakeDocument("$eq", int32(9)),
@@ -322,6 +416,52 @@ func TestFieldExpression(t *testing.T) {
 			name: "not equal test", r1: "field", r2: types.MustMakeDocument("$ne", int32(9)),
 			e: expectedWhereKey{sql: "(\"field\" <> 9 OR \"field\" IS UNSET)", err: nil},
 		},
+		{
+			name: "equal null test", r1: "field", r2: types.MustMakeDocument("$eq", nil),
+			e: expectedWhereKey{sql: "(\"field\" IS NULL OR \"field\" IS UNSET)", err: nil},
+		},
+		{
+			name: "not equal null test", r1: "field", r2: types.MustMakeDocument("$ne", nil),
+			e: expectedWhereKey{sql: "(\"field\" IS NOT NULL AND \"field\" IS SET)", err: nil},
+		},
+		{
+			name: "greater than or equal null test", r1: "field", r2: types.MustMakeDocument("$gte", nil),
+			e: expectedWhereKey{sql: "(\"field\" IS NULL OR \"field\" IS UNSET)", err: nil},
+		},
+		{
+			name: "less than null test", r1: "field", r2: types.MustMakeDocument("$lt", nil),
+			e: expectedWhereKey{sql: "1 = 0", err: nil},
+		},
+		{
+			name: "null with other operator test", r1: "field", r2: types.MustMakeDocument("$ne", nil, "$gt", int32(1)),
+			e: expectedWhereKey{sql: "(\"field\" IS NOT NULL AND \"field\" IS SET) AND ((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" > 1) OR \"field\".\"$n\" > 1)", err: nil},
+		},
+		{
+			name: "ObjectID greater than test", r1: "_id", r2: types.MustMakeDocument("$gt", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}),
+			e: expectedWhereKey{sql: "\"_id\".\"oid\" > '62e2bd54510683f9c0bb0d6b'", err: nil},
+		},
+		{
+			name: "ObjectID range test", r1: "ref._id", r2: types.MustMakeDocument(
+				"$gte", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107},
+				"$lt", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 255},
+			),
+			e: expectedWhereKey{sql: "\"ref\".\"_id\".\"oid\" >= '62e2bd54510683f9c0bb0d6b' AND \"ref\".\"_id\".\"oid\" < '62e2bd54510683f9c0bb0dff'", err: nil},
+		},
+		{
+			name: "date range test", r1: "createdAt", r2: types.MustMakeDocument(
+				"$gte", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC),
+				"$lt", time.Date(2022, 9, 1, 0, 0, 0, 0, time.UTC),
+			),
+			e: expectedWhereKey{sql: "\"createdAt\".\"$da\" >= 1659312000000 AND \"createdAt\".\"$da\" < 1661990400000", err: nil},
+		},
+		{
+			name: "date not equal test", r1: "createdAt", r2: types.MustMakeDocument("$ne", time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)),
+			e: expectedWhereKey{sql: "(\"createdAt\".\"$da\" <> 1659312000000 OR \"createdAt\".\"$da\" IS UNSET)", err: nil},
+		},
+		{
+			name: "ObjectID equal test", r1: "_id", r2: types.MustMakeDocument("$eq", types.ObjectID{98, 226, 189, 84, 81, 6, 131, 249, 192, 187, 13, 107}),
+			e: expectedWhereKey{sql: "\"_id\" = {\"oid\": '62e2bd54510683f9c0bb0d6b'}", err: nil},
+		},
 		{
 			name: "exists test", r1: "field", r2: types.MustMakeDocument("$exists", true),
 			e: expectedWhereKey{sql: "\"field\" IS SET", err: nil},
@@ -336,11 +476,19 @@ func TestFieldExpression(t *testing.T) {
 		},
 		{
 			name: "$elemMatch test", r1: "field", r2: types.MustMakeDocument("$elemMatch", types.MustMakeDocument("$gt", int32(9))),
-			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"field\" SATISFIES \"element\" > 9 END ", err: nil},
+			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"field\" SATISFIES ((\"element\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"element\" > 9) OR \"element\".\"$n\" > 9) END ", err: nil},
+		},
+		{
+			name: "int64 greater than test", r1: "field", r2: types.MustMakeDocument("$gt", int64(9007199254740993)),
+			e: expectedWhereKey{sql: "((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" > 9007199254740993) OR \"field\".\"$l\" > '09232379236109516801')", err: nil},
+		},
+		{
+			name: "int64 not equal test", r1: "field", r2: types.MustMakeDocument("$ne", int64(-9007199254740993)),
+			e: expectedWhereKey{sql: "(\"field\".\"$l\" <> '09214364837600034815' OR \"field\".\"$l\" IS UNSET)", err: nil},
 		},
 		{
 			name: "not test", r1: "field", r2: types.MustMakeDocument("$not", types.MustMakeDocument("$gt", int32(9))),
-			e: expectedWhereKey{sql: "( NOT \"field\" > 9 OR \"field\" IS UNSET) ", err: nil},
+			e: expectedWhereKey{sql: "( NOT ((\"field\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"field\" > 9) OR \"field\".\"$n\" > 9) OR \"field\" IS UNSET) ", err: nil},
 		},
 		{
 			name: "$regex test", r1: "field", r2: types.MustMakeDocument("$regex", "pattern"),
@@ -359,13 +507,83 @@ func TestFieldExpression(t *testing.T) {
 			e: expectedWhereKey{sql: "\"field\"", err: fmt.Errorf("$exists only works with boolean")},
 		},
 		{
-			name: "not supported expression error test", r1: "field", r2: types.MustMakeDocument("$geoWithin", "not supported"),
-			e: expectedWhereKey{sql: "\"field\"", err: fmt.Errorf("support for $geoWithin is not implemented yet")},
+			name: "not supported expression error test", r1: "field", r2: types.MustMakeDocument("$mod", "not supported"),
+			e: expectedWhereKey{sql: "\"field\"", err: fmt.Errorf("support for $mod is not implemented yet")},
+		},
+		{
+			name: "$geoWithin $geometry test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "Polygon", "coordinates", types.MustNewArray(types.MustNewArray(
+					types.MustNewArray(int32(0), int32(0)), types.MustNewArray(int32(3), int32(0)),
+					types.MustNewArray(int32(3), int32(3)), types.MustNewArray(int32(0), int32(0)),
+				))),
+			)),
+			e: expectedWhereKey{sql: "ST_GeomFromGeoJSON(\"loc\", 4326).ST_Within(ST_GeomFromText('POLYGON ((0 0, 3 0, 3 3, 0 0))', 4326)) = 1", err: nil},
+		},
+		{
+			name: "$geoWithin $box test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$box", types.MustNewArray(types.MustNewArray(int32(0), int32(0)), types.MustNewArray(float64(1.5), int32(2))),
+			)),
+			e: expectedWhereKey{sql: "ST_GeomFromGeoJSON(\"loc\", 4326).ST_Within(ST_GeomFromText('POLYGON ((0 0, 1.5 0, 1.5 2, 0 2, 0 0))', 4326)) = 1", err: nil},
+		},
+		{
+			name: "$geoWithin $centerSphere test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$centerSphere", types.MustNewArray(types.MustNewArray(int32(8), int32(49)), float64(0.001)),
+			)),
+			e: expectedWhereKey{sql: "ST_GeomFromGeoJSON(\"loc\", 4326).ST_Distance(ST_GeomFromText('POINT (8 49)', 4326), 'meter') <= 6378.1", err: nil},
+		},
+		{
+			name: "$geoIntersects test", r1: "loc", r2: types.MustMakeDocument("$geoIntersects", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "LineString", "coordinates", types.MustNewArray(
+					types.MustNewArray(int32(0), int32(0)), types.MustNewArray(int32(1), int32(1)),
+				)),
+			)),
+			e: expectedWhereKey{sql: "ST_GeomFromGeoJSON(\"loc\", 4326).ST_Intersects(ST_GeomFromText('LINESTRING (0 0, 1 1)', 4326)) = 1", err: nil},
+		},
+		{
+			name: "$near test", r1: "loc", r2: types.MustMakeDocument("$near", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "Point", "coordinates", types.MustNewArray(int32(8), int32(49))),
+				"$maxDistance", int32(1000),
+			)),
+			e: expectedWhereKey{sql: "ST_GeomFromGeoJSON(\"loc\", 4326).ST_Distance(ST_GeomFromText('POINT (8 49)', 4326), 'meter') <= 1000", err: nil},
+		},
+		{
+			name: "$near without point error test", r1: "loc", r2: types.MustMakeDocument("$near", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "LineString", "coordinates", types.MustNewArray(
+					types.MustNewArray(int32(0), int32(0)), types.MustNewArray(int32(1), int32(1)),
+				)),
+			)),
+			e: expectedWhereKey{sql: "", err: fmt.Errorf("$near requires a point, given LineString")},
+		},
+		{
+			name: "$geoWithin unknown shape error test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$circle", int32(1),
+			)),
+			e: expectedWhereKey{sql: "", err: fmt.Errorf("unknown geo specifier: $circle")},
+		},
+		{
+			name: "$near with NaN coordinate error test", r1: "loc", r2: types.MustMakeDocument("$near", types.MustMakeDocument(
+				"$geometry", types.MustMakeDocument("type", "Point", "coordinates", types.MustNewArray(math.NaN(), int32(49))),
+			)),
+			e: expectedWhereKey{sql: "", err: fmt.Errorf("expected a finite number. Got instead: NaN")},
+		},
+		{
+			name: "$geoWithin $box with infinite coordinate error test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$box", types.MustNewArray(types.MustNewArray(int32(0), int32(0)), types.MustNewArray(math.Inf(1), int32(2))),
+			)),
+			e: expectedWhereKey{sql: "", err: fmt.Errorf("expected a finite number. Got instead: +Inf")},
+		},
+		{
+			name: "$geoWithin $centerSphere with too large radius error test", r1: "loc", r2: types.MustMakeDocument("$geoWithin", types.MustMakeDocument(
+				"$centerSphere", types.MustNewArray(types.MustNewArray(int32(8), int32(49)), math.MaxFloat64),
+			)),
+			e: expectedWhereKey{sql: "", err: fmt.Errorf("$centerSphere radius is out of range")},
 		},
 	}
 
 	for _, field := range fieldExpressionTestCases {
-		sql, err := fieldExpression(field.r1, field.r2)
+		var p Placeholder
+		sql, err := fieldExpression(field.r1, field.r2, nil, &p)
+		sql = bindSQL(sql, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -393,7 +611,19 @@ func TestFilterArray(t *testing.T) {
 	filterArrayTestCases := []testCaseFilterArray{
 		{
 			name: "$elemMatch with comparison test", r1: "\"nested\".\"field\"", r2: "elemMatch", r3: types.MustMakeDocument("$gte", int32(9)),
-			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"nested\".\"field\" SATISFIES \"element\" >= 9 END ", err: nil},
+			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"nested\".\"field\" SATISFIES ((\"element\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"element\" >= 9) OR \"element\".\"$n\" >= 9) END ", err: nil},
+		},
+		{
+			name: "$elemMatch with $not test", r1: "\"nested\".\"field\"", r2: "elemMatch", r3: types.MustMakeDocument("$not", types.MustMakeDocument("$gt", int32(9))),
+			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"nested\".\"field\" SATISFIES  NOT ((\"element\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"element\" > 9) OR \"element\".\"$n\" > 9) END ", err: nil},
+		},
+		{
+			name: "$all with int64 test", r1: "\"nested\".\"field\"", r2: "all", r3: types.MustNewArray(int64(9007199254740993)),
+			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"nested\".\"field\" SATISFIES \"element\".\"$l\" = '09232379236109516801' END ", err: nil},
+		},
+		{
+			name: "$elemMatch with fields in order test", r1: "\"nested\".\"field\"", r2: "elemMatch", r3: types.MustMakeDocument("z", "last", "a", int32(1)),
+			e: expectedWhereKey{sql: "FOR ANY \"element\" IN \"nested\".\"field\" SATISFIES \"element\".\"z\" = 'last' AND \"element\".\"a\" = 1 END ", err: nil},
 		},
 		{
 			name: "$elemMatch with field: value test", r1: "\"nested\".\"field\"", r2: "elemMatch", r3: types.MustMakeDocument("field", float64(14.241234)),
@@ -418,7 +648,9 @@ func TestFilterArray(t *testing.T) {
 	}
 
 	for _, field := range filterArrayTestCases {
-		sql, err := filterArray(field.r1, field.r2, field.r3)
+		var p Placeholder
+		sql, err := filterArray(field.r1, field.r2, field.r3, nil, &p)
+		sql = bindSQL(sql, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -441,7 +673,9 @@ func TestRegex(t *testing.T) {
 	}
 
 	for _, field := range regexTestCases {
-		sql, err := regex(field.r)
+		var p Placeholder
+		sql, err := regex(field.r, &p)
+		sql = bindSQL(sql, &p)
 
 		if field.e.err != nil {
 			if !strings.EqualFold(sql, field.e.sql) || !strings.Contains(err.Error(), field.e.err.Error()) {
@@ -456,3 +690,8 @@ func TestRegex(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderBySQL(t *testing.T) {
+	assert.Equal(t, `"createdAt"."$da" ASC NULLS FIRST, "createdAt" ASC`, OrderBySQL(`"createdAt"`, "ASC"))
+	assert.Equal(t, `"a"."b"."$da" DESC NULLS LAST, "a"."b" DESC`, OrderBySQL(`"a"."b"`, "DESC"))
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package common
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// ParseWriteConcern validates a write concern like {w: 1, j: true, wtimeout: 1000}.
+// SAP HANA is a single node for the compatibility layer, so w can only be 0, 1 or "majority".
+func ParseWriteConcern(value any) (*hana.WriteConcern, error) {
+	doc, ok := value.(types.Document)
+	if !ok {
+		return nil, NewErrorMessage(ErrBadValue, "writeConcern must be an object. Got instead: %T", value)
+	}
+
+	var wc hana.WriteConcern
+	for _, k := range doc.Keys() {
+		v := doc.Map()[k]
+
+		switch k {
+		case "w":
+			switch w := v.(type) {
+			case string:
+				if w != "majority" {
+					return nil, NewErrorMessage(ErrBadValue, "unrecognized write concern mode: %s", w)
+				}
+				wc.W = w
+			case int32, int64, float64:
+				n, _ := writeConcernNumber(w)
+				if n < 0 {
+					return nil, NewErrorMessage(ErrBadValue, "w has to be a non-negative number and not greater than 50")
+				}
+				if n > 1 {
+					return nil, NewErrorMessage(ErrBadValue, "cannot use 'w' > 1 on a standalone")
+				}
+				wc.W = n
+			default:
+				return nil, NewErrorMessage(ErrBadValue, "w has to be a number or a string. Got instead: %T", v)
+			}
+		case "j":
+			j, ok := v.(bool)
+			if !ok {
+				return nil, NewErrorMessage(ErrBadValue, "j must be a boolean. Got instead: %T", v)
+			}
+			wc.J = &j
+		case "wtimeout":
+			n, ok := writeConcernNumber(v)
+			if !ok || n < 0 {
+				return nil, NewErrorMessage(ErrBadValue, "wtimeout must be a non-negative number")
+			}
+			wc.WTimeout = n
+		default:
+			return nil, NewErrorMessage(ErrBadValue, "unrecognized write concern field: %s", k)
+		}
+	}
+
+	return &wc, nil
+}
+
+// ValidateCommitQuorum validates the commitQuorum of index builds.
+// Like w of the write concern it can only be 0, 1, "majority" or "votingMembers" for a single node.
+func ValidateCommitQuorum(value any) error {
+	switch value := value.(type) {
+	case string:
+		if value != "majority" && value != "votingMembers" {
+			return NewErrorMessage(ErrBadValue, "unrecognized commitQuorum mode: %s", value)
+		}
+	case int32, int64, float64:
+		n, _ := writeConcernNumber(value)
+		if n < 0 || n > 1 {
+			return NewErrorMessage(ErrBadValue, "commitQuorum can only be 0 or 1 on a standalone. Got instead: %d", n)
+		}
+	default:
+		return NewErrorMessage(ErrBadValue, "commitQuorum has to be a number or a string. Got instead: %T", value)
+	}
+
+	return nil
+}
+
+// CommitQuorumWaits returns false for the validated commitQuorum 0,
+// with which createIndexes returns without waiting for its index builds to finish.
+func CommitQuorumWaits(value any) bool {
+	n, ok := writeConcernNumber(value)
+	return !ok || n != 0
+}
+
+// writeConcernNumber converts any numeric value to int64.
+func writeConcernNumber(value any) (int64, bool) {
+	switch value := value.(type) {
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	case float64:
+		return int64(value), true
+	default:
+		return 0, false
+	}
+}
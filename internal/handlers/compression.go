@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// setCompression negotiates the compressor of the connection with the compression array of hello or isMaster,
+// like ["snappy", "zlib"] in the order of preference of the client.
+// The first supported one is advertised back in the reply, and the following replies of the connection
+// are compressed with it. Without a supported one, the reply has no compression field and replies are not compressed.
+func (h *Handler) setCompression(reply *types.Document, request types.Document) error {
+	v, ok := request.Map()["compression"]
+	if !ok {
+		return nil
+	}
+
+	names, ok := v.(*types.Array)
+	if !ok {
+		return common.NewErrorMessage(common.ErrBadValue, "'compression' is not an array")
+	}
+
+	for i := 0; i < names.Len(); i++ {
+		v, _ := names.Get(i)
+		name, ok := v.(string)
+		if !ok {
+			return common.NewErrorMessage(common.ErrBadValue, "'compression' is not a string")
+		}
+
+		compressor, ok := wire.NegotiableCompressors[name]
+		if !ok {
+			continue
+		}
+
+		if err := reply.Set("compression", types.MustNewArray(name)); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		h.compressor = compressor
+		h.compression = true
+
+		return nil
+	}
+
+	return nil
+}
+
+// Compressor returns the compressor negotiated in the handshake of the connection,
+// and false if replies are not compressed.
+func (h *Handler) Compressor() (wire.Compressor, bool) {
+	return h.compressor, h.compression
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// Coalescer runs identical concurrent point reads by _id as one SAP HANA query, whose result all of them return.
+// This protects SAP HANA from many clients reading the same document at once,
+// for example web applications which all miss their cache for the same key.
+//
+// A coalesced read may return the document as it was when the first of the identical reads started,
+// so a client may not see its own write which completed in the meantime.
+//
+// The methods may be called on a nil *Coalescer, which does not coalesce.
+type Coalescer struct {
+	mu    sync.Mutex
+	reads map[string]*coalescedRead
+
+	coalesced prometheus.Counter
+}
+
+// coalescedRead is a running point read, whose result is shared once done is closed.
+type coalescedRead struct {
+	done chan struct{}
+	rows [][]byte
+	err  error
+}
+
+// NewCoalescer returns a new Coalescer.
+func NewCoalescer() *Coalescer {
+	return &Coalescer{
+		reads: make(map[string]*coalescedRead),
+		coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "SAP_HANA_compatibility_layer_for_MongoDB_Wire_Protocol",
+			Subsystem: "handler",
+			Name:      "coalesced_reads_total",
+			Help:      "Total number of point reads by _id which returned the result of an identical concurrent read.",
+		}),
+	}
+}
+
+// isPointRead returns true if the filter only selects documents by a value of _id, like findOne by _id.
+func isPointRead(filter types.Document) bool {
+	keys := filter.Keys()
+	if len(keys) != 1 || keys[0] != "_id" {
+		return false
+	}
+
+	// documents may contain query operators
+	switch filter.Map()["_id"].(type) {
+	case types.Document, *types.Array:
+		return false
+	default:
+		return true
+	}
+}
+
+// query returns the rows of the query, or the rows of an identical running query.
+// If that one is canceled by its client, the query is run again.
+func (c *Coalescer) query(ctx context.Context, sql string, query func(context.Context) ([][]byte, error)) ([][]byte, error) {
+	if c == nil {
+		return query(ctx)
+	}
+
+	c.mu.Lock()
+	if r, ok := c.reads[sql]; ok {
+		c.mu.Unlock()
+
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if errors.Is(r.err, context.Canceled) || errors.Is(r.err, context.DeadlineExceeded) {
+			return query(ctx)
+		}
+
+		c.coalesced.Inc()
+		return r.rows, r.err
+	}
+
+	r := &coalescedRead{done: make(chan struct{})}
+	c.reads[sql] = r
+	c.mu.Unlock()
+
+	r.rows, r.err = query(ctx)
+
+	c.mu.Lock()
+	delete(c.reads, sql)
+	c.mu.Unlock()
+	close(r.done)
+
+	return r.rows, r.err
+}
+
+// Describe implements prometheus.Collector.
+func (c *Coalescer) Describe(ch chan<- *prometheus.Desc) {
+	c.coalesced.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Coalescer) Collect(ch chan<- prometheus.Metric) {
+	c.coalesced.Collect(ch)
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Coalescer)(nil)
+)
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	utiltestutil "github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+)
+
+// waitingContext is a context which signals on waiting when Done is called,
+// like by a read waiting for the result of an identical one.
+type waitingContext struct {
+	context.Context
+	waiting chan<- struct{}
+}
+
+// Done implements context.Context.
+func (ctx waitingContext) Done() <-chan struct{} {
+	ctx.waiting <- struct{}{}
+	return ctx.Context.Done()
+}
+
+func TestCoalescer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewCoalescer()
+		ctx := utiltestutil.Ctx(t)
+
+		// the first query blocks until all others wait for it
+		var queries int32
+		release := make(chan struct{})
+		query := func(context.Context) ([][]byte, error) {
+			atomic.AddInt32(&queries, 1)
+			<-release
+			return [][]byte{[]byte(`{"_id":1}`)}, nil
+		}
+
+		const n = 10
+		waiting := make(chan struct{}, n)
+		ctx = waitingContext{Context: ctx, waiting: waiting}
+		var wg sync.WaitGroup
+		results := make([][][]byte, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				var err error
+				results[i], err = c.query(ctx, "SELECT", query)
+				assert.NoError(t, err)
+			}(i)
+		}
+
+		for i := 0; i < n-1; i++ {
+			<-waiting
+		}
+		close(release)
+		wg.Wait()
+
+		for _, res := range results {
+			assert.Equal(t, [][]byte{[]byte(`{"_id":1}`)}, res)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&queries))
+		assert.Equal(t, float64(n-1), testutil.ToFloat64(c.coalesced))
+		assert.Empty(t, c.reads)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		t.Parallel()
+
+		c := NewCoalescer()
+		ctx, cancel := context.WithCancel(utiltestutil.Ctx(t))
+
+		started := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			_, err := c.query(ctx, "SELECT", func(ctx context.Context) ([][]byte, error) {
+				close(started)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			})
+			done <- err
+		}()
+		<-started
+
+		// the read waiting for the canceled one queries itself
+		res := make(chan [][]byte)
+		waiting := make(chan struct{}, 1)
+		go func() {
+			rows, err := c.query(waitingContext{Context: utiltestutil.Ctx(t), waiting: waiting}, "SELECT", func(context.Context) ([][]byte, error) {
+				return [][]byte{[]byte(`{}`)}, nil
+			})
+			assert.NoError(t, err)
+			res <- rows
+		}()
+
+		<-waiting
+		cancel()
+
+		assert.ErrorIs(t, <-done, context.Canceled)
+		assert.Equal(t, [][]byte{[]byte(`{}`)}, <-res)
+		assert.Zero(t, testutil.ToFloat64(c.coalesced))
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		t.Parallel()
+
+		var c *Coalescer
+		rows, err := c.query(utiltestutil.Ctx(t), "SELECT", func(context.Context) ([][]byte, error) {
+			return [][]byte{[]byte(`{}`)}, nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte(`{}`)}, rows)
+	})
+}
+
+func TestIsPointRead(t *testing.T) {
+	t.Parallel()
+
+	for filter, expected := range map[*types.Document]bool{
+		types.MustMakeDocumentPointer("_id", int32(1)):                                true,
+		types.MustMakeDocumentPointer("_id", "a"):                                     true,
+		types.MustMakeDocumentPointer():                                               false,
+		types.MustMakeDocumentPointer("_id", types.MustMakeDocument("$gt", int32(1))): false,
+		types.MustMakeDocumentPointer("_id", types.MustNewArray(int32(1))):            false,
+		types.MustMakeDocumentPointer("_id", int32(1), "deleted", false):              false,
+		types.MustMakeDocumentPointer("name", "a"):                                    false,
+	} {
+		assert.Equal(t, expected, isPointRead(*filter), "%v", filter.Map())
+	}
+}
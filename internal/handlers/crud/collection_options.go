@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// prepareWrite checks that the collection is not read-only and returns the context for the write.
+// The write concern of the request or otherwise the default write concern of the collection is applied:
+// wtimeout bounds the time the write may take.
+func (h *storage) prepareWrite(ctx context.Context, document *types.Document, db, collection string) (context.Context, context.CancelFunc, error) {
+	var writeConcern *hana.WriteConcern
+	if value, ok := document.Map()["writeConcern"]; ok {
+		var err error
+		if writeConcern, err = common.ParseWriteConcern(value); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	opts, err := h.writableCollectionOptions(ctx, db, collection)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if writeConcern == nil {
+		writeConcern = opts.WriteConcern
+	}
+
+	if writeConcern != nil && writeConcern.WTimeout > 0 {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(writeConcern.WTimeout)*time.Millisecond)
+		return ctx, cancel, nil
+	}
+
+	return ctx, func() {}, nil
+}
+
+// writableCollectionOptions returns the options of the collection or IllegalOperation if it is read-only.
+func (h *storage) writableCollectionOptions(ctx context.Context, db, collection string) (*hana.CollectionOptions, error) {
+	opts, err := h.hanaPool.CollectionOptions(ctx, db, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ReadOnly {
+		return nil, common.NewErrorMessage(common.ErrIllegalOperation, "cannot write to the read-only collection %s.%s", db, collection)
+	}
+
+	return opts, nil
+}
+
+// hintSQL returns the WITH HINT clause for the hint of find, count, update or delete.
+// The indexes of the collection are only read if a hint is given.
+func (h *storage) hintSQL(ctx context.Context, db, collection string, hint any) (string, error) {
+	if hint == nil {
+		return "", nil
+	}
+
+	opts, err := h.hanaPool.CollectionOptions(ctx, db, collection)
+	if err != nil {
+		return "", err
+	}
+
+	return common.HintSQL(hint, opts)
+}
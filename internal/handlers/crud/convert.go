@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -28,6 +30,16 @@ import (
 
 // nextRow iterates each retrieved document and returns them unmarshaled
 func nextRow(rows *sql.Rows) (*types.Document, error) {
+	b, err := nextRowBytes(rows)
+	if b == nil || err != nil {
+		return nil, err
+	}
+
+	return decodeRow(b)
+}
+
+// nextRowBytes returns the next retrieved document as JSON, or nil if there is none.
+func nextRowBytes(rows *sql.Rows) ([]byte, error) {
 	if !rows.Next() {
 		err := rows.Err()
 		if err != nil {
@@ -41,11 +53,21 @@ func nextRow(rows *sql.Rows) (*types.Document, error) {
 		return nil, lazyerrors.Error(err)
 	}
 
-	var doc bson.Document
-	if err := doc.UnmarshalJSON(b); err != nil {
+	return b, nil
+}
+
+// decodeRow unmarshals a document retrieved as JSON.
+// The values of the omitted top-level fields are skipped without being decoded.
+func decodeRow(b []byte, omit ...string) (*types.Document, error) {
+	doc, err := bson.UnmarshalLazyJSON(b)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	d, err := doc.Document(omit...)
+	if err != nil {
 		return nil, lazyerrors.Error(err)
 	}
 
-	d := types.MustConvertDocument(&doc)
 	return &d, nil
 }
@@ -0,0 +1,424 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+const (
+	// cursorBatchBytes is the size of the batches of a cursor.
+	// The first batch is filled up to this size; the number of documents of a getMore batch
+	// is this size divided by the average size of the documents returned so far,
+	// so that small documents need fewer round trips and large ones do not overshoot.
+	cursorBatchBytes = 4 << 20
+
+	// cursorMaxBatchBytes is the size after which no more documents are added to a batch,
+	// so that the reply stays below the maximum size of a BSON document.
+	cursorMaxBatchBytes = bson.MaxDocumentLen - 1<<20
+
+	// cursorTimeout is how long a cursor is kept without getMore, like in MongoDB.
+	cursorTimeout = 10 * time.Minute
+
+	// noCursorTimeoutLimit is how long a cursor with noCursorTimeout is kept without getMore,
+	// so that cursors which clients forget to close do not hold their SAP HANA connections forever.
+	noCursorTimeoutLimit = 24 * time.Hour
+
+	// cursorReapInterval is how often timed out cursors are closed by Cursors.Reap.
+	cursorReapInterval = time.Minute
+
+	// noBatchSize is the batchSize of a find without batchSize, whose first batch is only limited by its size.
+	noBatchSize = -1
+)
+
+// cursor holds the documents of a find which were not returned yet.
+type cursor struct {
+	id int64
+	ns string
+
+	// owner is the SAP HANA user of the client which created the cursor, empty without one;
+	// only clients of the same user may continue or kill it
+	owner string
+
+	// conn is the storage of the connection which created the cursor, which closes it when the connection closes
+	conn *storage
+
+	// documents read but not returned yet, and their sizes in bytes as JSON in SAP HANA;
+	// the documents left after a batch are frozen, as they are kept across requests and may be returned on other connections
+	docs  []types.Document
+	sizes []int
+
+	// src reads the further documents from SAP HANA, nil if all documents were read
+	src *cursorSource
+
+	// number and total size of the documents returned so far
+	returned      int
+	returnedBytes int
+
+	// batchSize of the latest getMore, which is also used to read ahead
+	batchSize int
+
+	// noTimeout is set by noCursorTimeout of find, so that the cursor is kept until it is exhausted or killed,
+	// or unused for noCursorTimeoutLimit
+	noTimeout bool
+	lastUsed  time.Time
+}
+
+// newCursor returns a cursor over the documents of the namespace.
+// The further documents are read from src, which can be nil if all documents were read.
+func newCursor(ns string, docs []types.Document, sizes []int, src *cursorSource) *cursor {
+	return &cursor{
+		ns:       ns,
+		docs:     docs,
+		sizes:    sizes,
+		src:      src,
+		lastUsed: time.Now(),
+	}
+}
+
+// firstBatch returns the documents of the first batch, up to cursorBatchBytes
+// and at most batchSize if it is not noBatchSize. The first batch of batchSize 0 is empty.
+func (c *cursor) firstBatch(batchSize int) ([]types.Document, error) {
+	if batchSize == 0 {
+		return nil, nil
+	}
+
+	limit := math.MaxInt
+	if batchSize > 0 {
+		limit = batchSize
+	}
+
+	if err := c.fill(limit, cursorBatchBytes); err != nil {
+		return nil, err
+	}
+
+	var n, size int
+	for n < len(c.docs) && n < limit && size < cursorBatchBytes {
+		size += c.sizes[n]
+		n++
+	}
+
+	return c.next(n), nil
+}
+
+// nextBatch returns the documents of a getMore batch, at most batchSize if it is positive.
+func (c *cursor) nextBatch(batchSize int) ([]types.Document, error) {
+	c.batchSize = batchSize
+
+	n := c.batchCount()
+	if err := c.fill(n, cursorMaxBatchBytes); err != nil {
+		return nil, err
+	}
+
+	return c.next(n), nil
+}
+
+// batchCount returns the number of documents of the next getMore batch:
+// cursorBatchBytes divided by the average size of the documents returned so far, at most batchSize.
+func (c *cursor) batchCount() int {
+	n := math.MaxInt
+	if c.returned > 0 {
+		if avg := c.returnedBytes / c.returned; avg > 0 {
+			n = cursorBatchBytes / avg
+		}
+	}
+	if c.batchSize > 0 && c.batchSize < n {
+		n = c.batchSize
+	}
+
+	return n
+}
+
+// next removes and returns the next n read documents, or fewer if they exceed cursorMaxBatchBytes.
+// At least one document is returned if there is one left.
+func (c *cursor) next(n int) []types.Document {
+	if n > len(c.docs) {
+		n = len(c.docs)
+	}
+	if n < 1 && len(c.docs) > 0 {
+		n = 1
+	}
+
+	var size int
+	for i := 0; i < n; i++ {
+		if i > 0 && size+c.sizes[i] > cursorMaxBatchBytes {
+			n = i
+			break
+		}
+		size += c.sizes[i]
+	}
+
+	batch := c.docs[:n]
+	c.docs = c.docs[n:]
+	c.sizes = c.sizes[n:]
+	for i := range c.docs {
+		c.docs[i].Freeze()
+	}
+	c.returned += n
+	c.returnedBytes += size
+	c.lastUsed = time.Now()
+
+	return batch
+}
+
+// fill reads documents from SAP HANA until n documents or maxBytes are read but not returned,
+// or all documents are read. Documents read ahead are waited for first.
+func (c *cursor) fill(n, maxBytes int) error {
+	if c.src == nil {
+		return nil
+	}
+
+	if err := c.add(c.src.wait()); err != nil || c.src == nil {
+		return err
+	}
+
+	var size int
+	for _, s := range c.sizes {
+		size += s
+	}
+	if len(c.docs) >= n || size >= maxBytes {
+		return nil
+	}
+
+	return c.add(c.src.read(n-len(c.docs), maxBytes-size))
+}
+
+// add adds documents read by the source, which is closed after the last document or an error.
+func (c *cursor) add(res *cursorRead) error {
+	if res == nil {
+		return nil
+	}
+
+	c.docs = append(c.docs, res.docs...)
+	c.sizes = append(c.sizes, res.sizes...)
+
+	if res.done || res.err != nil {
+		c.close()
+	}
+
+	return res.err
+}
+
+// readAhead starts reading the documents of the next getMore batch which were not read yet in the background.
+func (c *cursor) readAhead(cs *Cursors) {
+	if c.src == nil {
+		return
+	}
+
+	c.src.readAhead(c.batchCount()-len(c.docs), cs)
+}
+
+// close closes the source of the cursor, so that its documents are no longer read from SAP HANA.
+func (c *cursor) close() {
+	if c.src != nil {
+		c.src.close()
+		c.src = nil
+	}
+}
+
+// timedOut returns true if the cursor was not used for longer than its CursorTimeout.
+func (c *cursor) timedOut(now time.Time) bool {
+	return now.Sub(c.lastUsed) > CursorTimeout(c.noTimeout)
+}
+
+// CursorTimeout returns how long a cursor is kept without getMore before Cursors.Reap closes it:
+// cursorTimeout, or noCursorTimeoutLimit for a find with noCursorTimeout.
+func CursorTimeout(noTimeout bool) time.Duration {
+	if noTimeout {
+		return noCursorTimeoutLimit
+	}
+
+	return cursorTimeout
+}
+
+// exhausted returns true if all documents were read and returned.
+func (c *cursor) exhausted() bool {
+	return len(c.docs) == 0 && c.src == nil
+}
+
+// Cursors are the open cursors of find.
+// They are shared by all connections like in MongoDB, as drivers may continue a cursor on another connection of their pool.
+type Cursors struct {
+	mu      sync.Mutex
+	cursors map[int64]*cursor
+
+	// maximum and current size of the documents read ahead by all cursors
+	readAheadLimit int64
+	readAheadBytes int64
+}
+
+// NewCursors returns an empty set of cursors.
+// The documents of all cursors read ahead of getMore are limited to readAheadLimit bytes, 0 disables reading ahead.
+func NewCursors(readAheadLimit int64) *Cursors {
+	return &Cursors{
+		cursors:        make(map[int64]*cursor),
+		readAheadLimit: readAheadLimit,
+	}
+}
+
+// add assigns a new random id to the cursor and keeps it until it is taken.
+func (cs *Cursors) add(c *cursor) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	// ids are random, so that clients cannot guess the cursors of others
+	for c.id == 0 || cs.cursors[c.id] != nil {
+		c.id = randomCursorID()
+	}
+
+	// the cursor may be taken as soon as it is added
+	c.readAhead(cs)
+	cs.cursors[c.id] = c
+}
+
+// Reap closes the timed out cursors every cursorReapInterval, so that they release their SAP HANA connections
+// and documents read ahead. It returns when the context is canceled.
+func (cs *Cursors) Reap(ctx context.Context) {
+	ticker := time.NewTicker(cursorReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cs.closeCursors(func(c *cursor) bool { return c.timedOut(now) })
+		}
+	}
+}
+
+// closeCursors removes and closes the kept cursors for which f returns true.
+func (cs *Cursors) closeCursors(f func(c *cursor) bool) {
+	var closed []*cursor
+
+	cs.mu.Lock()
+	for id, c := range cs.cursors {
+		if f(c) {
+			delete(cs.cursors, id)
+			closed = append(closed, c)
+		}
+	}
+	cs.mu.Unlock()
+
+	for _, c := range closed {
+		c.close()
+	}
+}
+
+// randomCursorID returns a positive cursor id from a cryptographically secure source.
+func randomCursorID() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return int64(binary.BigEndian.Uint64(b[:]) &^ (1 << 63))
+}
+
+// put keeps a cursor which was taken, unless all its documents were returned,
+// and starts reading its next batch ahead.
+func (cs *Cursors) put(c *cursor) {
+	if c.exhausted() {
+		return
+	}
+
+	c.readAhead(cs)
+
+	cs.mu.Lock()
+	cs.cursors[c.id] = c
+	cs.mu.Unlock()
+}
+
+// takeOwned is take for a client, which may only use the cursors created by its SAP HANA user.
+// For cursors of other owners, it keeps the cursor and returns Unauthorized.
+func (cs *Cursors) takeOwned(id int64, owner string) (*cursor, error) {
+	c := cs.take(id)
+	if c != nil && c.owner != owner {
+		cs.put(c)
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "cursor id %d was not created by the authenticated user", id)
+	}
+
+	return c, nil
+}
+
+// take removes and returns the cursor, or nil if there is none with the id or it timed out.
+// It is removed, so that concurrent getMore of the same cursor do not return the same documents.
+func (cs *Cursors) take(id int64) *cursor {
+	cs.mu.Lock()
+	c := cs.cursors[id]
+	delete(cs.cursors, id)
+	cs.mu.Unlock()
+
+	if c != nil && c.timedOut(time.Now()) {
+		c.close()
+		return nil
+	}
+
+	return c
+}
+
+// reserveReadAhead returns true if n more bytes may be read ahead.
+// They must be released with releaseReadAhead.
+func (cs *Cursors) reserveReadAhead(n int64) bool {
+	if atomic.AddInt64(&cs.readAheadBytes, n) > cs.readAheadLimit {
+		atomic.AddInt64(&cs.readAheadBytes, -n)
+		return false
+	}
+
+	return true
+}
+
+// releaseReadAhead releases bytes reserved by reserveReadAhead.
+func (cs *Cursors) releaseReadAhead(n int64) {
+	atomic.AddInt64(&cs.readAheadBytes, -n)
+}
+
+// parseBatchSize returns the batchSize of the command, or 0 if it is not given.
+func parseBatchSize(command string, value any) (int, error) {
+	var n int64
+	switch value := value.(type) {
+	case nil:
+		return 0, nil
+	case int32:
+		n = int64(value)
+	case int64:
+		n = value
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'batchSize' must be an integer value in %s", command)
+		}
+		n = int64(value)
+	default:
+		return 0, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'batchSize' must be of type number in %s", command)
+	}
+
+	if n < 0 || n > math.MaxInt32 {
+		return 0, common.NewErrorMessage(common.ErrBadValue, "Batch size for %s must be non-negative, but received: %d", command, n)
+	}
+
+	return int(n), nil
+}
+
+// batchArray returns the documents of a batch as an array for the reply.
+func batchArray(docs []types.Document) *types.Array {
+	var res types.Array
+	for _, doc := range docs {
+		if err := res.Append(doc); err != nil {
+			panic(err)
+		}
+	}
+
+	return &res
+}
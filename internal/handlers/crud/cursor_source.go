@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// cursorSource reads the documents of a cursor from SAP HANA while the cursor is open.
+// It keeps its connection to SAP HANA until it is closed.
+//
+// While the client processes a batch, the next one is read ahead in the background,
+// so that getMore returns without waiting for SAP HANA, for example in exports and ETL jobs.
+type cursorSource struct {
+	rows   *sql.Rows
+	cancel context.CancelFunc
+
+	// omit are the fields which are not decoded from the rows,
+	// and project projects the read documents, nil without a projection
+	omit    []string
+	project func(docs *types.Array) error
+
+	// pending receives the documents read ahead, nil if none are read;
+	// release releases their reservation of Cursors.readAheadLimit
+	pending chan *cursorRead
+	release func()
+}
+
+// cursorRead are documents read by a cursorSource.
+type cursorRead struct {
+	docs  []types.Document
+	sizes []int
+
+	// done is true if there are no more documents
+	done bool
+	err  error
+}
+
+// newCursorSource returns a source reading the rows of a query, which is canceled by cancel when the source is closed.
+func newCursorSource(rows *sql.Rows, cancel context.CancelFunc, omit []string, project func(docs *types.Array) error) *cursorSource {
+	return &cursorSource{
+		rows:    rows,
+		cancel:  cancel,
+		omit:    omit,
+		project: project,
+	}
+}
+
+// read reads up to n documents, or until they have maxBytes.
+func (s *cursorSource) read(n, maxBytes int) *cursorRead {
+	var docs types.Array
+	res := new(cursorRead)
+	var size int
+	for len(res.sizes) < n && size < maxBytes {
+		b, err := nextRowBytes(s.rows)
+		if err != nil {
+			return &cursorRead{err: err}
+		}
+		if b == nil {
+			res.done = true
+			break
+		}
+
+		doc, err := decodeRow(b, s.omit...)
+		if err != nil {
+			return &cursorRead{err: err}
+		}
+		if err = docs.Append(*doc); err != nil {
+			return &cursorRead{err: lazyerrors.Error(err)}
+		}
+		res.sizes = append(res.sizes, len(b))
+		size += len(b)
+	}
+
+	if s.project != nil {
+		if err := s.project(&docs); err != nil {
+			return &cursorRead{err: lazyerrors.Error(err)}
+		}
+	}
+
+	res.docs = make([]types.Document, docs.Len())
+	for i := range res.docs {
+		doc, _ := docs.Get(i)
+		res.docs[i] = doc.(types.Document)
+	}
+
+	return res
+}
+
+// readAhead starts reading up to n documents in the background,
+// unless the documents read ahead by all cursors would exceed the limit of cs.
+func (s *cursorSource) readAhead(n int, cs *Cursors) {
+	if s.pending != nil || n <= 0 || !cs.reserveReadAhead(cursorBatchBytes) {
+		return
+	}
+
+	pending := make(chan *cursorRead, 1)
+	s.pending = pending
+	s.release = func() { cs.releaseReadAhead(cursorBatchBytes) }
+
+	go func() {
+		pending <- s.read(n, cursorBatchBytes)
+	}()
+}
+
+// wait returns the documents read ahead, or nil if none are read.
+func (s *cursorSource) wait() *cursorRead {
+	if s.pending == nil {
+		return nil
+	}
+
+	res := <-s.pending
+	s.pending = nil
+	s.release()
+
+	return res
+}
+
+// close stops reading and closes the rows, which returns the connection to the pool.
+func (s *cursorSource) close() {
+	s.cancel()
+	s.wait()
+	s.rows.Close()
+}
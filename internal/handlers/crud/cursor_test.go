@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// testCursor returns a cursor over n documents of the given size.
+func testCursor(n, size int) *cursor {
+	docs := make([]types.Document, n)
+	sizes := make([]int, n)
+	for i := range docs {
+		docs[i] = types.MustMakeDocument("_id", int32(i))
+		sizes[i] = size
+	}
+
+	return newCursor("db.c", docs, sizes, nil)
+}
+
+// frozenDocument returns the frozen document of the pairs, like the documents left in a cursor after a batch.
+func frozenDocument(pairs ...any) types.Document {
+	doc := types.MustMakeDocument(pairs...)
+	doc.Freeze()
+	return doc
+}
+
+// mustBatch returns a function returning the documents of a batch, which fails the test on an error.
+func mustBatch(t *testing.T) func([]types.Document, error) []types.Document {
+	return func(docs []types.Document, err error) []types.Document {
+		t.Helper()
+		require.NoError(t, err)
+		return docs
+	}
+}
+
+func TestCursorBatches(t *testing.T) {
+	t.Parallel()
+
+	t.Run("SmallDocuments", func(t *testing.T) {
+		t.Parallel()
+
+		// the first batch is filled up to the target size, getMore returns as many documents
+		c := testCursor(10_000, 1<<10)
+		batch := mustBatch(t)
+		assert.Len(t, batch(c.firstBatch(noBatchSize)), 4096)
+		assert.Len(t, batch(c.nextBatch(0)), 4096)
+		assert.Len(t, batch(c.nextBatch(0)), 10_000-2*4096)
+		assert.True(t, c.exhausted())
+	})
+
+	t.Run("LargeDocuments", func(t *testing.T) {
+		t.Parallel()
+
+		c := testCursor(10, 3<<20)
+		batch := mustBatch(t)
+		assert.Len(t, batch(c.firstBatch(noBatchSize)), 2)
+		assert.Len(t, batch(c.nextBatch(0)), 1)
+		assert.Len(t, batch(c.nextBatch(0)), 1)
+	})
+
+	t.Run("HugeDocuments", func(t *testing.T) {
+		t.Parallel()
+
+		// a batch has at least one document, even if it is larger than the target size
+		c := testCursor(3, 10<<20)
+		batch := mustBatch(t)
+		assert.Len(t, batch(c.firstBatch(noBatchSize)), 1)
+		assert.Len(t, batch(c.nextBatch(0)), 1)
+	})
+
+	t.Run("FirstBatchSize", func(t *testing.T) {
+		t.Parallel()
+
+		// the first batch of find has at most batchSize documents, the remainder is left for getMore
+		c := testCursor(10, 1<<10)
+		batch := mustBatch(t)
+		assert.Len(t, batch(c.firstBatch(3)), 3)
+		assert.Len(t, batch(c.nextBatch(0)), 7)
+		assert.True(t, c.exhausted())
+
+		// batchSize 0 opens the cursor without returning documents
+		c = testCursor(10, 1<<10)
+		assert.Empty(t, batch(c.firstBatch(0)))
+		assert.False(t, c.exhausted())
+		assert.Len(t, batch(c.nextBatch(0)), 10)
+	})
+
+	t.Run("BatchSize", func(t *testing.T) {
+		t.Parallel()
+
+		c := testCursor(100, 1<<10)
+		batch := mustBatch(t)
+		c.next(10)
+		assert.True(t, c.docs[0].IsFrozen())
+		assert.Len(t, batch(c.nextBatch(25)), 25)
+		assert.Equal(t, frozenDocument("_id", int32(35)), batch(c.nextBatch(0))[0])
+	})
+
+	t.Run("MaxBatchBytes", func(t *testing.T) {
+		t.Parallel()
+
+		// the documents returned so far are small, but the next ones are not
+		c := testCursor(4, 1<<10)
+		batch := mustBatch(t)
+		c.sizes[2], c.sizes[3] = 10<<20, 10<<20
+		assert.Len(t, c.next(2), 2)
+		assert.Len(t, batch(c.nextBatch(0)), 1)
+		assert.Len(t, batch(c.nextBatch(0)), 1)
+	})
+}
+
+func TestCursors(t *testing.T) {
+	t.Parallel()
+
+	cs := NewCursors(0)
+
+	c := testCursor(2, 1)
+	c.next(1)
+	cs.add(c)
+	require.NotZero(t, c.id)
+
+	// a taken cursor cannot be taken again until it is put back
+	assert.Same(t, c, cs.take(c.id))
+	assert.Nil(t, cs.take(c.id))
+	cs.put(c)
+	assert.Same(t, c, cs.take(c.id))
+
+	// exhausted cursors are not put back
+	c.next(1)
+	cs.put(c)
+	assert.Nil(t, cs.take(c.id))
+
+	// timed out cursors are removed
+	c = testCursor(2, 1)
+	cs.add(c)
+	c.lastUsed = c.lastUsed.Add(-cursorTimeout - 1)
+	assert.Nil(t, cs.take(c.id))
+
+	// the reaper closes timed out cursors, except the ones with noCursorTimeout
+	timedOut := testCursor(2, 1)
+	cs.add(timedOut)
+	timedOut.lastUsed = timedOut.lastUsed.Add(-cursorTimeout - 1)
+	c = testCursor(2, 1)
+	c.noTimeout = true
+	cs.add(c)
+	c.lastUsed = c.lastUsed.Add(-cursorTimeout - 1)
+	now := time.Now()
+	cs.closeCursors(func(c *cursor) bool { return c.timedOut(now) })
+	assert.NotContains(t, cs.cursors, timedOut.id)
+	assert.Same(t, c, cs.take(c.id))
+
+	// up to noCursorTimeoutLimit
+	c.lastUsed = c.lastUsed.Add(-noCursorTimeoutLimit)
+	cs.put(c)
+	assert.Nil(t, cs.take(c.id))
+
+	// the cursors of a connection are closed with it
+	conn := new(storage)
+	conn.cursors = cs
+	c = testCursor(2, 1)
+	c.conn = conn
+	cs.add(c)
+	other := testCursor(2, 1)
+	cs.add(other)
+	conn.Close()
+	assert.Nil(t, cs.take(c.id))
+	assert.Same(t, other, cs.take(other.id))
+}
+
+// testCursorSource returns a source reading n documents from a mocked query.
+func testCursorSource(t *testing.T, n int) (*cursorSource, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	rows := sqlmock.NewRows([]string{"document"})
+	for i := 0; i < n; i++ {
+		rows.AddRow([]byte(fmt.Sprintf(`{"_id": %d}`, i)))
+	}
+	mock.ExpectQuery("SELECT").WillReturnRows(rows).RowsWillBeClosed()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := db.QueryContext(ctx, "SELECT")
+	require.NoError(t, err)
+
+	return newCursorSource(r, cancel, nil, nil), mock
+}
+
+func TestCursorReadAhead(t *testing.T) {
+	t.Parallel()
+
+	t.Run("ReadAhead", func(t *testing.T) {
+		t.Parallel()
+
+		cs := NewCursors(1 << 30)
+		src, mock := testCursorSource(t, 5)
+		c := newCursor("db.c", nil, nil, src)
+		c.batchSize = 2
+
+		// the next batch is read while the cursor waits for getMore
+		cs.add(c)
+		require.NotNil(t, src.pending)
+		assert.Equal(t, int64(cursorBatchBytes), atomic.LoadInt64(&cs.readAheadBytes))
+
+		c = cs.take(c.id)
+		batch := mustBatch(t)(c.nextBatch(2))
+		require.Len(t, batch, 2)
+		assert.Equal(t, int32(1), batch[1].Map()["_id"])
+		cs.put(c)
+
+		c = cs.take(c.id)
+		assert.Len(t, mustBatch(t)(c.nextBatch(0)), 3)
+		assert.True(t, c.exhausted())
+		assert.Zero(t, atomic.LoadInt64(&cs.readAheadBytes))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		t.Parallel()
+
+		// documents are not read ahead beyond the limit, but by getMore
+		cs := NewCursors(cursorBatchBytes - 1)
+		src, mock := testCursorSource(t, 5)
+		c := newCursor("db.c", nil, nil, src)
+		cs.add(c)
+		assert.Nil(t, src.pending)
+
+		c = cs.take(c.id)
+		assert.Len(t, mustBatch(t)(c.nextBatch(0)), 5)
+		assert.True(t, c.exhausted())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		t.Parallel()
+
+		// closing a cursor releases its documents read ahead and closes its rows
+		cs := NewCursors(1 << 30)
+		src, mock := testCursorSource(t, 5)
+		c := newCursor("db.c", nil, nil, src)
+		c.batchSize = 2
+		cs.add(c)
+
+		c = cs.take(c.id)
+		c.close()
+		assert.True(t, c.exhausted())
+		assert.Zero(t, atomic.LoadInt64(&cs.readAheadBytes))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestParseBatchSize(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[any]int{
+		nil:        0,
+		int32(0):   0,
+		int32(5):   5,
+		int64(7):   7,
+		float64(3): 3,
+	} {
+		actual, err := parseBatchSize("getMore", value)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	for value, expected := range map[any]error{
+		int32(-1):    common.NewErrorMessage(common.ErrBadValue, "Batch size for getMore must be non-negative, but received: -1"),
+		float64(1.5): common.NewErrorMessage(common.ErrTypeMismatch, "Field 'batchSize' must be an integer value in getMore"),
+		"1":          common.NewErrorMessage(common.ErrTypeMismatch, "Field 'batchSize' must be of type number in getMore"),
+	} {
+		_, err := parseBatchSize("getMore", value)
+		assert.Equal(t, expected, err)
+	}
+}
@@ -0,0 +1,440 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// expressionArity are the supported operators of aggregation expressions with their number of arguments,
+// which is -1 for any number, and the minimal number for $ifNull.
+var expressionArity = map[string]int{
+	"$literal":  1,
+	"$add":      -1,
+	"$multiply": -1,
+	"$concat":   -1,
+	"$toLower":  1,
+	"$substr":   3,
+	"$cond":     3,
+	"$ifNull":   2,
+	"$year":     1,
+	"$month":    1,
+}
+
+// validateExpression returns an error if the expression uses unsupported operators or passes a wrong number of arguments.
+// Supported are field paths like "$a.b", the operators of expressionArity, documents and arrays of expressions and constants.
+func validateExpression(expr any) error {
+	switch expr := expr.(type) {
+	case types.Document:
+		if op, ok := expressionOperator(expr); ok {
+			arity, ok := expressionArity[op]
+			if !ok {
+				return common.NewErrorMessage(common.ErrNotImplemented, "expression %s is not implemented yet", op)
+			}
+			if len(expr.Keys()) != 1 {
+				return common.NewErrorMessage(common.ErrBadValue, "an expression specification must contain exactly one field, the name of the expression")
+			}
+
+			if op == "$literal" {
+				return nil
+			}
+
+			args := expressionArgs(expr.Map()[op])
+			if op == "$cond" {
+				if doc, ok := expr.Map()[op].(types.Document); ok {
+					var err error
+					if args, err = condArgs(doc); err != nil {
+						return err
+					}
+				}
+			}
+
+			switch {
+			case arity < 0:
+			case op == "$ifNull" && len(args) < arity:
+				return common.NewErrorMessage(common.ErrBadValue, "$ifNull needs at least two arguments, had: %d", len(args))
+			case op != "$ifNull" && len(args) != arity:
+				return common.NewErrorMessage(common.ErrBadValue, "Expression %s takes exactly %d arguments. %d were passed in.", op, arity, len(args))
+			}
+
+			for _, arg := range args {
+				if err := validateExpression(arg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, k := range expr.Keys() {
+			if err := validateExpression(expr.Map()[k]); err != nil {
+				return err
+			}
+		}
+
+	case *types.Array:
+		for i := 0; i < expr.Len(); i++ {
+			v, _ := expr.Get(i)
+			if err := validateExpression(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expressionOperator returns the operator of an expression like {$add: [1, 2]}.
+func expressionOperator(doc types.Document) (string, bool) {
+	if len(doc.Keys()) == 0 || !strings.HasPrefix(doc.Keys()[0], "$") {
+		return "", false
+	}
+
+	return doc.Keys()[0], true
+}
+
+// expressionArgs returns the arguments of an operator, which are an array or a single argument.
+func expressionArgs(value any) []any {
+	arr, ok := value.(*types.Array)
+	if !ok {
+		return []any{value}
+	}
+
+	args := make([]any, arr.Len())
+	for i := range args {
+		args[i], _ = arr.Get(i)
+	}
+
+	return args
+}
+
+// condArgs returns the arguments of $cond given as {if: ..., then: ..., else: ...}.
+func condArgs(doc types.Document) ([]any, error) {
+	args := make([]any, 3)
+	for i, k := range []string{"if", "then", "else"} {
+		v, ok := doc.Map()[k]
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "Missing '%s' parameter to $cond", k)
+		}
+		args[i] = v
+	}
+
+	for _, k := range doc.Keys() {
+		if k != "if" && k != "then" && k != "else" {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "Unrecognized parameter to $cond: %s", k)
+		}
+	}
+
+	return args, nil
+}
+
+// evalExpression evaluates an expression validated by validateExpression on the document.
+// A field path to a missing field evaluates to nil.
+func evalExpression(doc types.Document, expr any) (any, error) {
+	switch expr := expr.(type) {
+	case string:
+		if !strings.HasPrefix(expr, "$") {
+			return expr, nil
+		}
+		v, err := doc.GetByPath(strings.Split(expr[1:], ".")...)
+		if err != nil {
+			return nil, nil
+		}
+		return v, nil
+
+	case types.Document:
+		if op, ok := expressionOperator(expr); ok {
+			return evalOperator(doc, op, expr.Map()[op])
+		}
+
+		pairs := make([]any, 0, 2*len(expr.Keys()))
+		for _, k := range expr.Keys() {
+			v, err := evalExpression(doc, expr.Map()[k])
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, k, v)
+		}
+		return types.MakeDocument(pairs...)
+
+	case *types.Array:
+		res := types.MakeArray(expr.Len())
+		for i := 0; i < expr.Len(); i++ {
+			v, _ := expr.Get(i)
+			if v, err := evalExpression(doc, v); err != nil {
+				return nil, err
+			} else if err = res.Append(v); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+
+	default:
+		return expr, nil
+	}
+}
+
+// evalOperator evaluates the operator with its value on the document.
+func evalOperator(doc types.Document, op string, value any) (any, error) {
+	if op == "$literal" {
+		return value, nil
+	}
+
+	rawArgs := expressionArgs(value)
+	if cond, ok := value.(types.Document); ok && op == "$cond" {
+		var err error
+		if rawArgs, err = condArgs(cond); err != nil {
+			return nil, err
+		}
+	}
+
+	// $cond and $ifNull only evaluate the arguments they return
+	switch op {
+	case "$cond":
+		cond, err := evalExpression(doc, rawArgs[0])
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(cond) {
+			return evalExpression(doc, rawArgs[1])
+		}
+		return evalExpression(doc, rawArgs[2])
+
+	case "$ifNull":
+		for _, arg := range rawArgs[:len(rawArgs)-1] {
+			v, err := evalExpression(doc, arg)
+			if err != nil || v != nil {
+				return v, err
+			}
+		}
+		return evalExpression(doc, rawArgs[len(rawArgs)-1])
+	}
+
+	args := make([]any, len(rawArgs))
+	for i, arg := range rawArgs {
+		var err error
+		if args[i], err = evalExpression(doc, arg); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op {
+	case "$add":
+		return evalAdd(args)
+	case "$multiply":
+		return evalMultiply(args)
+	case "$concat":
+		return evalConcat(args)
+	case "$toLower":
+		s, err := stringValue("$toLower", args[0])
+		return strings.ToLower(s), err
+	case "$substr":
+		return evalSubstr(args)
+	case "$year", "$month":
+		return evalDatePart(op, args[0])
+	default:
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "expression %s is not implemented yet", op)
+	}
+}
+
+// evalAdd returns the sum of numbers, or a date plus milliseconds. It is null if an argument is null.
+func evalAdd(args []any) (any, error) {
+	var sum numericSum
+	var date *time.Time
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			return nil, nil
+		case int32, int64, float64:
+			sum.add(arg)
+		case time.Time:
+			if date != nil {
+				return nil, common.NewErrorMessage(common.ErrTypeMismatch, "only one date allowed in an $add expression")
+			}
+			date = &arg
+		default:
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "$add only supports numeric or date types, not %s", common.TypeName(arg))
+		}
+	}
+
+	res := sum.sum()
+	if date == nil {
+		return res, nil
+	}
+
+	var ms float64
+	switch res := res.(type) {
+	case int32:
+		ms = float64(res)
+	case int64:
+		ms = float64(res)
+	case float64:
+		ms = res
+	}
+
+	return date.Add(time.Duration(math.Round(ms)) * time.Millisecond), nil
+}
+
+// evalMultiply returns the product of numbers, which is null if an argument is null.
+// Like for $sum, the product of int32 values is an int32 if it fits, otherwise an int64 or a double.
+func evalMultiply(args []any) (any, error) {
+	product, f := int64(1), float64(1)
+	var isInt64, isFloat bool
+	for _, arg := range args {
+		var i int64
+		switch arg := arg.(type) {
+		case nil:
+			return nil, nil
+		case int32:
+			i = int64(arg)
+		case int64:
+			i, isInt64 = arg, true
+		case float64:
+			isFloat = true
+			f *= arg
+			continue
+		default:
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "$multiply only supports numeric types, not %s", common.TypeName(arg))
+		}
+
+		if !isFloat && product != 0 && (i*product/product != i || (product == -1 && i == math.MinInt64)) {
+			isFloat = true
+		}
+		if isFloat {
+			f *= float64(i)
+			continue
+		}
+		product *= i
+	}
+
+	if isFloat {
+		return float64(product) * f, nil
+	}
+
+	return intResult(product, isInt64), nil
+}
+
+// evalConcat returns the concatenation of strings, which is null if an argument is null.
+func evalConcat(args []any) (any, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			b.WriteString(arg)
+		default:
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "$concat only supports strings, not %s", common.TypeName(arg))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// evalSubstr returns the substring of $substr, whose start and length count bytes.
+// A negative length returns the rest of the string.
+func evalSubstr(args []any) (any, error) {
+	s, err := stringValue("$substr", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	start, ok := integerArg(args[1])
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "$substrBytes: starting index must be a numeric type (is BSON type %s)", common.TypeName(args[1]))
+	}
+	length, ok := integerArg(args[2])
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "$substrBytes: length must be a numeric type (is BSON type %s)", common.TypeName(args[2]))
+	}
+
+	if start < 0 || start >= int64(len(s)) {
+		return "", nil
+	}
+	if length < 0 || start+length > int64(len(s)) {
+		length = int64(len(s)) - start
+	}
+
+	return s[start : start+length], nil
+}
+
+// evalDatePart returns the year or month of a date in UTC, which is null for null.
+// The argument may also be given as {date: ...}.
+func evalDatePart(op string, arg any) (any, error) {
+	if doc, ok := arg.(types.Document); ok {
+		if _, ok := doc.Map()["timezone"]; ok {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "timezone of %s is not implemented yet", op)
+		}
+		arg = doc.Map()["date"]
+	}
+
+	switch arg := arg.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		if op == "$year" {
+			return int32(arg.UTC().Year()), nil
+		}
+		return int32(arg.UTC().Month()), nil
+	default:
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "can't convert from BSON type %s to Date", common.TypeName(arg))
+	}
+}
+
+// stringValue returns the value converted to a string for the string operator op.
+// Like in MongoDB null is the empty string and numbers are formatted.
+func stringValue(op string, v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", common.NewErrorMessage(common.ErrTypeMismatch, "%s: can't convert from BSON type %s to String", op, common.TypeName(v))
+	}
+}
+
+// integerArg returns the number as an integer, which is truncated for doubles.
+func integerArg(v any) (int64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// isTruthy returns false for false, null, missing values and zero, like conditions of MongoDB expressions.
+func isTruthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int32:
+		return v != 0
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	default:
+		return true
+	}
+}
@@ -0,0 +1,379 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// fakeGenerator returns a value of the i-th generated document.
+type fakeGenerator func(r *rand.Rand, i int) any
+
+// fakeTemplate generates documents from a schema template.
+//
+// Every value of the template is either a generator like {$int: {min: 1, max: 10}},
+// a document or an array of which every value is a template itself, or a constant.
+type fakeTemplate struct {
+	keys       []string
+	generators []fakeGenerator
+}
+
+// fakeMaxLen is the maximum number of words of $sentence and of values of $array,
+// so that a single document cannot exhaust the memory.
+const fakeMaxLen = 1000
+
+var (
+	fakeFirstNames = []string{
+		"Anna", "Ben", "Clara", "David", "Emma", "Felix", "Greta", "Hugo", "Ida", "Jonas",
+		"Klara", "Leon", "Mia", "Noah", "Olivia", "Paul", "Sofia", "Tim", "Valentina", "Yusuf",
+	}
+	fakeLastNames = []string{
+		"Becker", "Fischer", "Garcia", "Hoffmann", "Ivanova", "Jensen", "Kowalski", "Martin", "Meyer", "Müller",
+		"Nowak", "Rossi", "Schmidt", "Schneider", "Smith", "Tanaka", "Wagner", "Weber", "Williams", "Zimmermann",
+	}
+	fakeCities = []string{
+		"Amsterdam", "Bangalore", "Berlin", "Dublin", "Lisbon", "London", "Madrid", "Montreal", "Munich", "New York",
+		"Palo Alto", "Paris", "Prague", "São Paulo", "Seoul", "Shanghai", "Singapore", "Sydney", "Tokyo", "Walldorf",
+	}
+	fakeWords = []string{
+		"alpha", "bright", "cloud", "data", "engine", "fast", "green", "harbor", "insight", "journey",
+		"kernel", "ledger", "matrix", "network", "orbit", "pixel", "quartz", "river", "signal", "table",
+		"unit", "vector", "window", "yield", "zone",
+	}
+	fakeDomains = []string{"example.com", "example.net", "example.org"}
+
+	// fakeDateMin and fakeDateMax are the default range of $date.
+	fakeDateMin = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	fakeDateMax = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// newFakeTemplate parses the schema template. Without _id in the template, an ObjectID is generated.
+func newFakeTemplate(template types.Document) (*fakeTemplate, error) {
+	t, err := parseFakeDocument(template)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := template.Map()["_id"]; !ok {
+		t.keys = append([]string{"_id"}, t.keys...)
+		t.generators = append([]fakeGenerator{fakeObjectID}, t.generators...)
+	}
+
+	return t, nil
+}
+
+// document returns the i-th document.
+func (t *fakeTemplate) document(r *rand.Rand, i int) types.Document {
+	pairs := make([]any, 0, 2*len(t.keys))
+	for j, k := range t.keys {
+		pairs = append(pairs, k, t.generators[j](r, i))
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// parseFakeDocument parses a document which is not a generator.
+func parseFakeDocument(doc types.Document) (*fakeTemplate, error) {
+	t := &fakeTemplate{keys: doc.Keys()}
+	for _, k := range t.keys {
+		if strings.HasPrefix(k, "$") {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: field %s must not start with $ unless it is the only field of a generator", k)
+		}
+
+		g, err := parseFakeValue(doc.Map()[k])
+		if err != nil {
+			return nil, err
+		}
+		t.generators = append(t.generators, g)
+	}
+
+	return t, nil
+}
+
+// parseFakeValue returns the generator of a template value.
+func parseFakeValue(value any) (fakeGenerator, error) {
+	switch value := value.(type) {
+	case types.Document:
+		if keys := value.Keys(); len(keys) == 1 && strings.HasPrefix(keys[0], "$") {
+			return parseFakeGenerator(keys[0], value.Map()[keys[0]])
+		}
+
+		t, err := parseFakeDocument(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *rand.Rand, i int) any { return t.document(r, i) }, nil
+
+	case *types.Array:
+		generators := make([]fakeGenerator, value.Len())
+		for j := range generators {
+			v, _ := value.Get(j)
+
+			var err error
+			if generators[j], err = parseFakeValue(v); err != nil {
+				return nil, err
+			}
+		}
+		return func(r *rand.Rand, i int) any {
+			values := make([]any, len(generators))
+			for j, g := range generators {
+				values[j] = g(r, i)
+			}
+			return types.MustNewArray(values...)
+		}, nil
+
+	default:
+		return func(*rand.Rand, int) any { return value }, nil
+	}
+}
+
+// parseFakeGenerator returns the generator with the given name and options.
+func parseFakeGenerator(name string, value any) (fakeGenerator, error) {
+	if name == "$choice" {
+		values, ok := value.(*types.Array)
+		if !ok || values.Len() == 0 {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: $choice must be a non-empty array")
+		}
+		return func(r *rand.Rand, _ int) any {
+			v, _ := values.Get(r.Intn(values.Len()))
+			return v
+		}, nil
+	}
+
+	opts, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "seed: the options of %s must be an object", name)
+	}
+
+	switch name {
+	case "$int":
+		lo, err := fakeInteger(name, opts, "min", 0)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := fakeInteger(name, opts, "max", 100)
+		if err != nil {
+			return nil, err
+		}
+		if hi < lo {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: min of %s must not be greater than max", name)
+		}
+		return func(r *rand.Rand, _ int) any {
+			return fakeInt(fakeBetween(r, lo, hi))
+		}, nil
+
+	case "$double":
+		min, max, err := fakeRange(name, opts, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *rand.Rand, _ int) any {
+			return min + r.Float64()*(max-min)
+		}, nil
+
+	case "$bool":
+		return func(r *rand.Rand, _ int) any { return r.Intn(2) == 1 }, nil
+
+	case "$sequence":
+		start, err := fakeNumber(name, opts, "start", 1)
+		if err != nil {
+			return nil, err
+		}
+		return func(_ *rand.Rand, i int) any { return fakeInt(int64(start) + int64(i)) }, nil
+
+	case "$objectId":
+		return fakeObjectID, nil
+
+	case "$firstName":
+		return fakePick(fakeFirstNames), nil
+
+	case "$lastName":
+		return fakePick(fakeLastNames), nil
+
+	case "$name":
+		return func(r *rand.Rand, _ int) any {
+			return fakeFirstNames[r.Intn(len(fakeFirstNames))] + " " + fakeLastNames[r.Intn(len(fakeLastNames))]
+		}, nil
+
+	case "$email":
+		return func(r *rand.Rand, _ int) any {
+			first := strings.ToLower(fakeFirstNames[r.Intn(len(fakeFirstNames))])
+			last := strings.ToLower(fakeLastNames[r.Intn(len(fakeLastNames))])
+			return first + "." + last + "@" + fakeDomains[r.Intn(len(fakeDomains))]
+		}, nil
+
+	case "$city":
+		return fakePick(fakeCities), nil
+
+	case "$word":
+		return fakePick(fakeWords), nil
+
+	case "$sentence":
+		words, err := fakeNumber(name, opts, "words", 8)
+		if err != nil {
+			return nil, err
+		}
+		if words < 1 || words > fakeMaxLen {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: words of $sentence must be between 1 and %d", fakeMaxLen)
+		}
+		return func(r *rand.Rand, _ int) any {
+			s := make([]string, int(words))
+			for j := range s {
+				s[j] = fakeWords[r.Intn(len(fakeWords))]
+			}
+			s[0] = strings.ToUpper(s[0][:1]) + s[0][1:]
+			return strings.Join(s, " ") + "."
+		}, nil
+
+	case "$date":
+		min, max := fakeDateMin, fakeDateMax
+		for k, d := range map[string]*time.Time{"min": &min, "max": &max} {
+			if v, ok := opts.Map()[k]; ok {
+				if *d, ok = v.(time.Time); !ok {
+					return nil, common.NewErrorMessage(common.ErrBadValue, "seed: %s of $date must be a date", k)
+				}
+			}
+		}
+		if max.Before(min) {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: min of $date must not be greater than max")
+		}
+		lo, hi := min.UnixMilli(), max.UnixMilli()
+		return func(r *rand.Rand, _ int) any {
+			return time.UnixMilli(fakeBetween(r, lo, hi))
+		}, nil
+
+	case "$array":
+		of, ok := opts.Map()["of"]
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: $array requires of")
+		}
+		g, err := parseFakeValue(of)
+		if err != nil {
+			return nil, err
+		}
+		min, max, err := fakeRange(name, opts, 0, 5)
+		if err != nil {
+			return nil, err
+		}
+		if min < 0 || max > fakeMaxLen {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "seed: min and max of $array must be between 0 and %d", fakeMaxLen)
+		}
+		lo, hi := int(min), int(max)
+		return func(r *rand.Rand, i int) any {
+			values := make([]any, lo+r.Intn(hi-lo+1))
+			for j := range values {
+				values[j] = g(r, i)
+			}
+			return types.MustNewArray(values...)
+		}, nil
+
+	default:
+		return nil, common.NewErrorMessage(common.ErrBadValue, "seed: unknown generator %s", name)
+	}
+}
+
+// fakeRange returns the options min and max of the generator.
+func fakeRange(name string, opts types.Document, defMin, defMax float64) (float64, float64, error) {
+	min, err := fakeNumber(name, opts, "min", defMin)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	max, err := fakeNumber(name, opts, "max", defMax)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if max < min {
+		return 0, 0, common.NewErrorMessage(common.ErrBadValue, "seed: min of %s must not be greater than max", name)
+	}
+
+	return min, max, nil
+}
+
+// fakeNumber returns the numeric option of the generator.
+func fakeNumber(name string, opts types.Document, key string, def float64) (float64, error) {
+	v, ok := opts.Map()[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := v.(type) {
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return 0, common.NewErrorMessage(common.ErrBadValue, "seed: %s of %s must be a number", key, name)
+	}
+}
+
+// fakeInteger returns the integer option of the generator.
+func fakeInteger(name string, opts types.Document, key string, def int64) (int64, error) {
+	v, ok := opts.Map()[key]
+	if !ok {
+		return def, nil
+	}
+
+	switch v := v.(type) {
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		// float64(math.MaxInt64) is 2^63, which does not fit
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), nil
+		}
+	}
+
+	return 0, common.NewErrorMessage(common.ErrBadValue, "seed: %s of %s must be a 64-bit integer", key, name)
+}
+
+// fakeBetween returns a random integer from lo to hi, also if the range is wider than the one of int64.
+func fakeBetween(r *rand.Rand, lo, hi int64) int64 {
+	n := uint64(hi) - uint64(lo) + 1
+	switch {
+	case n == 0:
+		// the whole range of int64
+		return int64(r.Uint64())
+	case n <= math.MaxInt64:
+		return lo + r.Int63n(int64(n))
+	}
+
+	for {
+		if v := r.Uint64(); v < n {
+			return int64(uint64(lo) + v)
+		}
+	}
+}
+
+// fakeInt returns n as int32 if it fits, like MongoDB shells do.
+func fakeInt(n int64) any {
+	if n >= math.MinInt32 && n <= math.MaxInt32 {
+		return int32(n)
+	}
+	return n
+}
+
+// fakePick returns a generator of one of the values.
+func fakePick(values []string) fakeGenerator {
+	return func(r *rand.Rand, _ int) any { return values[r.Intn(len(values))] }
+}
+
+// fakeObjectID generates an ObjectID from the random source, so that seeding is deterministic.
+func fakeObjectID(r *rand.Rand, _ int) any {
+	var id types.ObjectID
+	r.Read(id[:])
+	return id
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"math"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// findOptions are the options of find which change its cursor.
+type findOptions struct {
+	// the cursor does not time out after cursorTimeout without getMore, only after noCursorTimeoutLimit
+	noCursorTimeout bool
+
+	// maximum number of documents of the first batch, noBatchSize if not given
+	batchSize int
+
+	// the cursor is closed after the first batch
+	singleBatch bool
+
+	// only the key fields of the index selected for the query are returned
+	returnKey bool
+}
+
+// parseFindOptions validates the cursor options of find, including its batchSize.
+// Tailable cursors and the index bounds min and max, with or without hint, are rejected,
+// as collections in SAP HANA are not capped and their indexes have no bounds.
+func parseFindOptions(m map[string]any) (*findOptions, error) {
+	flags := make(map[string]bool)
+	for _, name := range []string{"tailable", "awaitData", "noCursorTimeout", "singleBatch", "returnKey"} {
+		switch v := m[name].(type) {
+		case nil:
+		case bool:
+			flags[name] = v
+		default:
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field '%s' must be of type bool", name)
+		}
+	}
+
+	if flags["awaitData"] && !flags["tailable"] {
+		return nil, common.NewErrorMessage(common.ErrFailedToParse, "Cannot set 'awaitData' without also setting 'tailable'")
+	}
+
+	if v, ok := m["maxAwaitTimeMS"]; ok {
+		if !isNonNegativeInteger(v) {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS must be a non-negative integer")
+		}
+		if !flags["awaitData"] {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS can only be used with tailable awaitData cursors")
+		}
+	}
+
+	if flags["tailable"] {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "tailable cursor requested on non capped collection")
+	}
+
+	for _, name := range []string{"min", "max"} {
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		if _, ok = v.(types.Document); !ok {
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field '%s' must be of type object", name)
+		}
+		if _, ok = m["hint"]; !ok {
+			return nil, common.NewErrorMessage(common.ErrMinMaxWithoutHint, "When using min()/max() a hint of which index to use must be provided")
+		}
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "find with %s is not implemented yet, as indexes of SAP HANA have no bounds", name)
+	}
+
+	batchSize := noBatchSize
+	if v, ok := m["batchSize"]; ok {
+		var err error
+		if batchSize, err = parseBatchSize("find", v); err != nil {
+			return nil, err
+		}
+	}
+
+	return &findOptions{
+		noCursorTimeout: flags["noCursorTimeout"],
+		batchSize:       batchSize,
+		singleBatch:     flags["singleBatch"],
+		returnKey:       flags["returnKey"],
+	}, nil
+}
+
+// isNonNegativeInteger returns true if the value is a non-negative whole number.
+func isNonNegativeInteger(value any) bool {
+	switch v := value.(type) {
+	case int32:
+		return v >= 0
+	case int64:
+		return v >= 0
+	case float64:
+		return v >= 0 && v == math.Trunc(v)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestParseFindOptions(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		m        map[string]any
+		expected *findOptions
+		err      error
+	}{
+		"None": {
+			m:        map[string]any{},
+			expected: &findOptions{batchSize: noBatchSize},
+		},
+		"NoCursorTimeout": {
+			m:        map[string]any{"noCursorTimeout": true, "tailable": false},
+			expected: &findOptions{noCursorTimeout: true, batchSize: noBatchSize},
+		},
+		"BatchSize": {
+			m:        map[string]any{"batchSize": int32(0)},
+			expected: &findOptions{batchSize: 0},
+		},
+		"SingleBatch": {
+			m:        map[string]any{"singleBatch": true, "batchSize": float64(5)},
+			expected: &findOptions{batchSize: 5, singleBatch: true},
+		},
+		"ReturnKey": {
+			m:        map[string]any{"returnKey": true},
+			expected: &findOptions{batchSize: noBatchSize, returnKey: true},
+		},
+		"SingleBatchWrongType": {
+			m:   map[string]any{"singleBatch": int32(1)},
+			err: common.NewErrorMessage(common.ErrTypeMismatch, "Field 'singleBatch' must be of type bool"),
+		},
+		"NegativeBatchSize": {
+			m:   map[string]any{"batchSize": int64(-1)},
+			err: common.NewErrorMessage(common.ErrBadValue, "Batch size for find must be non-negative, but received: -1"),
+		},
+		"WrongType": {
+			m:   map[string]any{"tailable": int32(1)},
+			err: common.NewErrorMessage(common.ErrTypeMismatch, "Field 'tailable' must be of type bool"),
+		},
+		"Tailable": {
+			m:   map[string]any{"tailable": true, "awaitData": true, "maxAwaitTimeMS": int32(100)},
+			err: common.NewErrorMessage(common.ErrBadValue, "tailable cursor requested on non capped collection"),
+		},
+		"AwaitDataWithoutTailable": {
+			m:   map[string]any{"awaitData": true},
+			err: common.NewErrorMessage(common.ErrFailedToParse, "Cannot set 'awaitData' without also setting 'tailable'"),
+		},
+		"MaxAwaitTimeMSWithoutAwaitData": {
+			m:   map[string]any{"maxAwaitTimeMS": int64(100)},
+			err: common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS can only be used with tailable awaitData cursors"),
+		},
+		"NegativeMaxAwaitTimeMS": {
+			m:   map[string]any{"tailable": true, "awaitData": true, "maxAwaitTimeMS": float64(-1)},
+			err: common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS must be a non-negative integer"),
+		},
+		"Min": {
+			m:   map[string]any{"min": types.MustMakeDocument("a", int32(1))},
+			err: common.NewErrorMessage(common.ErrMinMaxWithoutHint, "When using min()/max() a hint of which index to use must be provided"),
+		},
+		"MinMaxWithHint": {
+			m:   map[string]any{"min": types.MustMakeDocument("a", int32(1)), "max": types.MustMakeDocument("a", int32(5)), "hint": "a_1"},
+			err: common.NewErrorMessage(common.ErrNotImplemented, "find with min is not implemented yet, as indexes of SAP HANA have no bounds"),
+		},
+		"MaxWrongType": {
+			m:   map[string]any{"max": int32(1)},
+			err: common.NewErrorMessage(common.ErrTypeMismatch, "Field 'max' must be of type object"),
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := parseFindOptions(tc.m)
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -0,0 +1,531 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// groupStage implements $group with the accumulators $sum, $avg, $min, $max, $first, $last, $push and $addToSet.
+type groupStage struct {
+	id           any
+	fields       []string
+	accumulators []accumulator
+	decimal      bool
+}
+
+// accumulator is an accumulator like {$sum: "$amount"} of a $group field.
+type accumulator struct {
+	operator string
+	expr     any
+}
+
+func newGroupStage(value any, decimal bool) (*groupStage, error) {
+	spec, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "a group's fields must be specified in an object")
+	}
+
+	id, ok := spec.Map()["_id"]
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "a group specification must include an _id")
+	}
+	if err := validateExpression(id); err != nil {
+		return nil, err
+	}
+
+	s := &groupStage{id: id, decimal: decimal}
+	for _, field := range spec.Keys() {
+		if field == "_id" {
+			continue
+		}
+
+		if strings.Contains(field, ".") {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "The field name '%s' cannot contain '.'", field)
+		}
+
+		acc, ok := spec.Map()[field].(types.Document)
+		if !ok || len(acc.Keys()) != 1 {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "The field '%s' must be an accumulator object", field)
+		}
+
+		operator := acc.Keys()[0]
+		switch operator {
+		case "$sum", "$avg", "$min", "$max", "$first", "$last", "$push", "$addToSet":
+		default:
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "accumulator %s is not implemented yet", operator)
+		}
+
+		expr := acc.Map()[operator]
+		if err := validateExpression(expr); err != nil {
+			return nil, err
+		}
+
+		s.fields = append(s.fields, field)
+		s.accumulators = append(s.accumulators, accumulator{operator: operator, expr: expr})
+	}
+
+	return s, nil
+}
+
+// process implements stage interface.
+func (s *groupStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	type group struct {
+		id     any
+		states []*accumulatorState
+	}
+
+	var groups []*group
+	index := make(map[string]*group)
+
+	for _, doc := range docs {
+		id, err := evalExpression(doc, s.id)
+		if err != nil {
+			return nil, err
+		}
+
+		b, err := fjson.Marshal(id)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		g, ok := index[string(b)]
+		if !ok {
+			g = &group{id: id, states: make([]*accumulatorState, len(s.accumulators))}
+			for i := range g.states {
+				g.states[i] = newAccumulatorState(s.decimal)
+			}
+			index[string(b)] = g
+			groups = append(groups, g)
+		}
+
+		for i, acc := range s.accumulators {
+			if err = g.states[i].add(acc.operator, doc, acc.expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res := make([]types.Document, 0, len(groups))
+	for _, g := range groups {
+		pairs := []any{"_id", g.id}
+		for i, acc := range s.accumulators {
+			pairs = append(pairs, s.fields[i], g.states[i].result(acc.operator))
+		}
+
+		doc, err := types.MakeDocument(pairs...)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		res = append(res, doc)
+	}
+
+	return res, nil
+}
+
+// accumulatorState accumulates the values of an accumulator for the documents of a group.
+type accumulatorState struct {
+	// sum of $sum and $avg
+	sum *numericSum
+
+	// value of $min, $max, $first and $last, which is set if a value was accumulated
+	value any
+	set   bool
+
+	// values of $push and $addToSet, and the JSON of the values of $addToSet
+	values *types.Array
+	keys   map[string]struct{}
+}
+
+func newAccumulatorState(decimal bool) *accumulatorState {
+	return &accumulatorState{
+		sum:    &numericSum{decimal: decimal},
+		values: types.MakeArray(0),
+		keys:   make(map[string]struct{}),
+	}
+}
+
+// add accumulates the value of the expression for the document.
+func (a *accumulatorState) add(operator string, doc types.Document, expr any) error {
+	v, err := evalExpression(doc, expr)
+	if err != nil {
+		return err
+	}
+
+	switch operator {
+	case "$sum", "$avg":
+		a.sum.add(v)
+
+	case "$min", "$max":
+		// like in MongoDB null and missing values are ignored, and values are compared in the BSON order
+		if v == nil {
+			return nil
+		}
+		c := 0
+		if a.set {
+			c = types.Compare(v, a.value)
+		}
+		if !a.set || (operator == "$min" && c < 0) || (operator == "$max" && c > 0) {
+			a.value, a.set = v, true
+		}
+
+	case "$first":
+		if !a.set {
+			a.value, a.set = v, true
+		}
+
+	case "$last":
+		a.value, a.set = v, true
+
+	case "$push", "$addToSet":
+		// missing values are not accumulated, but null values are
+		if isMissing(doc, expr) {
+			return nil
+		}
+
+		if operator == "$addToSet" {
+			b, err := fjson.Marshal(v)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+			if _, ok := a.keys[string(b)]; ok {
+				return nil
+			}
+			a.keys[string(b)] = struct{}{}
+		}
+
+		if err := a.values.Append(v); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// result returns the accumulated value.
+func (a *accumulatorState) result(operator string) any {
+	switch operator {
+	case "$sum":
+		return a.sum.sum()
+	case "$avg":
+		return a.sum.avg()
+	case "$push", "$addToSet":
+		return a.values
+	default:
+		return a.value
+	}
+}
+
+// isMissing returns true if the expression is a field path to a field missing in the document.
+func isMissing(doc types.Document, expr any) bool {
+	if !isFieldPath(expr) {
+		return false
+	}
+
+	_, err := doc.GetByPath(strings.Split(expr.(string)[1:], ".")...)
+	return err != nil
+}
+
+// groupFunctions are the SQL aggregate functions of the accumulators SAP HANA computes.
+var groupFunctions = map[string]string{
+	"$sum": "SUM",
+	"$avg": "AVG",
+	"$min": "MIN",
+	"$max": "MAX",
+}
+
+// errUnsupportedTypes is returned by the scan of a pushed down $group if the _id of a group is not null, a number or a string,
+// whose values SAP HANA returns as JSON text, or if a field of $min or $max holds values of different types,
+// which SAP HANA does not compare in the BSON order. Then the groups must be computed by the compatibility layer.
+var errUnsupportedTypes = errors.New("$group of unsupported types")
+
+// pushdown implements pushedStage interface. SAP HANA computes the groups with GROUP BY
+// if _id is a field path or null and the accumulators sum, average, minimize or maximize a field, or sum an integer.
+// The exact decimals of numericAccuracy, and the accumulators depending on the order of the documents
+// or returning arrays are only computed by the proxy.
+func (s *groupStage) pushdown() bool {
+	if s.decimal {
+		return false
+	}
+
+	if s.id != nil && !isFieldPath(s.id) {
+		return false
+	}
+
+	for _, acc := range s.accumulators {
+		if _, ok := groupFunctions[acc.operator]; !ok {
+			return false
+		}
+
+		switch acc.expr.(type) {
+		case int32, int64:
+			if acc.operator != "$sum" {
+				return false
+			}
+		default:
+			if !isFieldPath(acc.expr) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// pushedSQL implements pushedStage interface.
+// The SELECT computing the groups has the columns _id and the fields of the accumulators.
+func (s *groupStage) pushedSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	from, err := fromSQL(db, collection, filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	keySQL := "NULL"
+	if s.id != nil {
+		if keySQL, err = common.FieldSQL(s.id.(string)[1:]); err != nil {
+			return "", err
+		}
+	}
+
+	columns := []string{keySQL + " AS \"_id\""}
+
+	// the _id must be null, a number or a string, and the values of $min and $max must have one type,
+	// which is checked by the columns following the accumulators
+	var checks []string
+	if s.id != nil {
+		checks = append(checks, "CASE WHEN "+keySQL+" IS NULL OR "+keySQL+" IS UNSET OR "+
+			common.IsNumberSQL(keySQL)+" OR "+common.IsStringSQL(keySQL)+" THEN 1 ELSE 0 END")
+	}
+	for i, acc := range s.accumulators {
+		var column string
+		switch expr := acc.expr.(type) {
+		case int32, int64:
+			column = fmt.Sprintf("%d * COUNT(*)", expr)
+		default:
+			fieldSQL, err := common.FieldSQL(expr.(string)[1:])
+			if err != nil {
+				return "", err
+			}
+
+			switch acc.operator {
+			case "$sum", "$avg":
+				// like in MongoDB values which are no numbers are ignored
+				column = groupFunctions[acc.operator] + "(CASE WHEN " + common.IsNumberSQL(fieldSQL) + " THEN " + fieldSQL + " END)"
+			default:
+				column = groupFunctions[acc.operator] + "(" + fieldSQL + ")"
+				checks = append(checks, common.UniformTypeSQL(fieldSQL))
+			}
+
+			// like in MongoDB the sum of no numbers is 0
+			if acc.operator == "$sum" {
+				column = "COALESCE(" + column + ", 0)"
+			}
+		}
+
+		alias, err := common.FieldSQL(s.fields[i])
+		if err != nil {
+			return "", err
+		}
+		columns = append(columns, column+" AS "+alias)
+	}
+
+	sql := "SELECT " + strings.Join(append(columns, checks...), ", ") + " FROM " + from
+	if s.id != nil {
+		return sql + " GROUP BY " + keySQL, nil
+	}
+
+	// without GROUP BY there is a result row also if no documents are selected, but no group in MongoDB
+	return sql + " HAVING COUNT(*) > 0", nil
+}
+
+// scan implements pushedStage interface.
+// It returns errUnsupportedTypes if the _id or the values of $min or $max of a group have unsupported types.
+func (s *groupStage) scan(ctx context.Context, rows *sql.Rows) ([]types.Document, error) {
+	var checks int
+	if s.id != nil {
+		checks++
+	}
+	for _, acc := range s.accumulators {
+		if acc.operator == "$min" || acc.operator == "$max" {
+			checks++
+		}
+	}
+
+	var res []types.Document
+	for rows.Next() {
+		values := make([]any, len(s.accumulators)+1+checks)
+		dest := make([]any, len(values))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		for _, uniform := range values[len(s.accumulators)+1:] {
+			if n, ok := uniform.(int64); !ok || n != 1 {
+				return nil, errUnsupportedTypes
+			}
+		}
+
+		pairs := []any{"_id", groupValue(values[0], false)}
+		for i, acc := range s.accumulators {
+			v := values[i+1]
+			switch acc.operator {
+			case "$sum":
+				_, isInt64 := acc.expr.(int64)
+				v = groupValue(v, isInt64)
+			case "$avg":
+				if i, ok := v.(int64); ok {
+					v = float64(i)
+				}
+			default:
+				v = groupValue(v, false)
+			}
+			pairs = append(pairs, s.fields[i], v)
+		}
+
+		doc, err := types.MakeDocument(pairs...)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		res = append(res, doc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return res, nil
+}
+
+// groupValue converts a value read from SAP HANA to the type of the document.
+// Integers are int32 if they fit, unless isInt64 is set, like sums in MongoDB.
+func groupValue(v any, isInt64 bool) any {
+	switch v := v.(type) {
+	case int64:
+		return intResult(v, isInt64)
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+// isFieldPath returns true if the expression is a field path like "$a.b".
+func isFieldPath(expr any) bool {
+	path, ok := expr.(string)
+	return ok && strings.HasPrefix(path, "$") && !strings.HasPrefix(path, "$$")
+}
+
+// numericSum sums the numbers given to $sum and $avg, other values are ignored.
+// Like in MongoDB the sum of int32 values is an int32 if it fits, otherwise an int64
+// and a double if it overflows int64 or a double is added.
+//
+// In decimal mode numbers are summed as exact decimals like SAP HANA DECIMAL does,
+// so that for example 0.1 + 0.2 is 0.3. Doubles are converted to the shortest decimal
+// representing them, and the result is only rounded to a double at the end.
+type numericSum struct {
+	decimal bool
+	count   int64
+	isInt64 bool
+	isFloat bool
+	i       int64
+	f       float64
+	r       big.Rat
+}
+
+// add adds v to the sum if it is a number.
+func (s *numericSum) add(v any) {
+	switch v := v.(type) {
+	case int32:
+		s.addInt(int64(v))
+	case int64:
+		s.isInt64 = true
+		s.addInt(v)
+	case float64:
+		s.isFloat = true
+		if s.decimal {
+			r, _ := new(big.Rat).SetString(strconv.FormatFloat(v, 'g', -1, 64))
+			if r == nil {
+				// NaN and infinity have no decimal representation
+				s.f += v
+			} else {
+				s.r.Add(&s.r, r)
+			}
+		} else {
+			s.f += v
+		}
+	default:
+		return
+	}
+
+	s.count++
+}
+
+func (s *numericSum) addInt(v int64) {
+	if s.decimal {
+		s.r.Add(&s.r, new(big.Rat).SetInt64(v))
+		return
+	}
+
+	if (v > 0 && s.i > math.MaxInt64-v) || (v < 0 && s.i < math.MinInt64-v) {
+		s.isFloat = true
+		s.f += float64(s.i) + float64(v)
+		s.i = 0
+		return
+	}
+	s.i += v
+}
+
+// sum returns the result of $sum.
+func (s *numericSum) sum() any {
+	if s.decimal {
+		if !s.isFloat && s.r.IsInt() && s.r.Num().IsInt64() {
+			return intResult(s.r.Num().Int64(), s.isInt64)
+		}
+		f, _ := s.r.Float64()
+		return f + s.f
+	}
+
+	if s.isFloat {
+		return float64(s.i) + s.f
+	}
+	return intResult(s.i, s.isInt64)
+}
+
+// avg returns the result of $avg, which is null if no numbers were added.
+func (s *numericSum) avg() any {
+	if s.count == 0 {
+		return nil
+	}
+
+	if s.decimal {
+		f, _ := new(big.Rat).Quo(&s.r, new(big.Rat).SetInt64(s.count)).Float64()
+		return f + s.f/float64(s.count)
+	}
+
+	return (float64(s.i) + s.f) / float64(s.count)
+}
+
+// intResult returns the sum of integers as int32 if it fits and only int32 values were added.
+func intResult(i int64, isInt64 bool) any {
+	if !isInt64 && i >= math.MinInt32 && i <= math.MaxInt32 {
+		return int32(i)
+	}
+	return i
+}
@@ -0,0 +1,333 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// IndexBuilds are the index builds in progress of all client connections,
+// which currentOp reports, setIndexCommitQuorum changes and killOp aborts.
+type IndexBuilds struct {
+	mu     sync.Mutex
+	lastID int32
+	builds map[int32]*indexBuild
+}
+
+// NewIndexBuilds returns an empty set of index builds.
+func NewIndexBuilds() *IndexBuilds {
+	return &IndexBuilds{
+		builds: make(map[int32]*indexBuild),
+	}
+}
+
+// indexBuild builds the indexes of one createIndexes one after another in the background,
+// so that the build continues when the client disconnects, like in MongoDB.
+type indexBuild struct {
+	opid       int32
+	db         string
+	collection string
+	indexes    []*hana.Index
+
+	// command is the createIndexes command reported by currentOp
+	command types.Document
+
+	// owner is the SAP HANA user of the client which started the build, empty without one;
+	// only clients of the same user may see, change or abort it
+	owner string
+
+	started time.Time
+	cancel  context.CancelFunc
+
+	// done is closed when the build finished, and err is its error then
+	done chan struct{}
+	err  error
+
+	// connID is the id of the SAP HANA connection of the build, 0 until it is taken,
+	// and built is the number of indexes built so far; both are accessed atomically
+	connID int64
+	built  int32
+
+	// noWait is closed when the commitQuorum of the build is 0,
+	// so that createIndexes returns without waiting for the build to finish
+	quorumMu     sync.Mutex
+	commitQuorum any
+	noWait       chan struct{}
+}
+
+// build starts building the indexes of the collection with the pool in the background and returns the builds of the indexes.
+// Indexes which are built already by another build are not built again, their builds are returned instead.
+// ctx is only used for the owner and the comment of the statements, the build is not canceled with it.
+func (ibs *IndexBuilds) build(
+	ctx context.Context, hanaPool *hana.Hpool, l *zap.Logger,
+	db, collection string, indexes []*hana.Index, command types.Document, commitQuorum any,
+) []*indexBuild {
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	var res []*indexBuild
+	var missing []*hana.Index
+	seen := make(map[*indexBuild]struct{})
+	for _, index := range indexes {
+		b := ibs.building(db, collection, index.Name)
+		if b == nil {
+			missing = append(missing, index)
+			continue
+		}
+		if _, ok := seen[b]; !ok {
+			seen[b] = struct{}{}
+			res = append(res, b)
+		}
+	}
+
+	if len(missing) == 0 {
+		return res
+	}
+
+	buildCtx, cancel := context.WithCancel(hana.WithComment(context.Background(), hana.Comment(ctx)))
+
+	ibs.lastID++
+	b := &indexBuild{
+		opid:       ibs.lastID,
+		db:         db,
+		collection: collection,
+		indexes:    missing,
+		command:    command,
+		owner:      hana.User(ctx),
+		started:    time.Now(),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		noWait:     make(chan struct{}),
+	}
+	b.setCommitQuorum(commitQuorum)
+	ibs.builds[b.opid] = b
+
+	go func() {
+		defer close(b.done)
+		defer ibs.remove(b)
+		defer cancel()
+
+		b.err = b.run(buildCtx, hanaPool, l)
+	}()
+
+	return append(res, b)
+}
+
+// run creates the indexes on one connection of the pool. If the build is aborted,
+// the indexes it already created are dropped again, like in MongoDB.
+func (b *indexBuild) run(ctx context.Context, hanaPool *hana.Hpool, l *zap.Logger) error {
+	builder, err := hanaPool.NewIndexBuilder(ctx)
+	if err != nil {
+		return b.abortedError(ctx, err)
+	}
+	defer builder.Close()
+
+	atomic.StoreInt64(&b.connID, builder.ConnID)
+
+	for _, index := range b.indexes {
+		if err = builder.CreateIndex(ctx, b.db, b.collection, index); err != nil {
+			break
+		}
+		atomic.AddInt32(&b.built, 1)
+	}
+
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	for _, index := range b.indexes[:atomic.LoadInt32(&b.built)] {
+		if dropErr := hanaPool.DropIndex(context.Background(), b.db, b.collection, index.Name); dropErr != nil {
+			l.Warn("Failed to drop index of aborted build", zap.String("index", index.Name), zap.Error(dropErr))
+		}
+	}
+
+	return b.abortedError(ctx, err)
+}
+
+// abortedError returns IndexBuildAborted if the build was aborted, and err otherwise.
+func (b *indexBuild) abortedError(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+
+	return common.NewErrorMessage(common.ErrIndexBuildAborted, "Index build aborted: %d: operation was interrupted", b.opid)
+}
+
+// wait waits for the build to finish and returns its error, or returns without it once the commitQuorum is 0.
+// If the context is done first, the build continues.
+func (b *indexBuild) wait(ctx context.Context) error {
+	select {
+	case <-b.done:
+		return b.err
+	case <-b.noWait:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setCommitQuorum sets the validated commitQuorum of the build.
+func (b *indexBuild) setCommitQuorum(commitQuorum any) {
+	b.quorumMu.Lock()
+	defer b.quorumMu.Unlock()
+
+	if !common.CommitQuorumWaits(b.commitQuorum) {
+		// createIndexes no longer waits
+		b.commitQuorum = commitQuorum
+		return
+	}
+
+	b.commitQuorum = commitQuorum
+	if !common.CommitQuorumWaits(commitQuorum) {
+		close(b.noWait)
+	}
+}
+
+// names returns the sorted names of the indexes of the build.
+func (b *indexBuild) names() []string {
+	res := make([]string, len(b.indexes))
+	for i, index := range b.indexes {
+		res[i] = index.Name
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// remove removes the finished build.
+func (ibs *IndexBuilds) remove(b *indexBuild) {
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	delete(ibs.builds, b.opid)
+}
+
+// list returns the builds in progress of the owner, ordered by their opid.
+func (ibs *IndexBuilds) list(owner string) []*indexBuild {
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	res := make([]*indexBuild, 0, len(ibs.builds))
+	for _, b := range ibs.builds {
+		if b.owner == owner {
+			res = append(res, b)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].opid < res[j].opid })
+
+	return res
+}
+
+// get returns the build in progress with the opid, nil if there is none.
+// For builds of other owners, it returns Unauthorized.
+func (ibs *IndexBuilds) get(opid int32, owner string) (*indexBuild, error) {
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	b := ibs.builds[opid]
+	if b != nil && b.owner != owner {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "not authorized to kill op %d", opid)
+	}
+
+	return b, nil
+}
+
+// find returns the build in progress of the owner building exactly the named indexes of the collection,
+// nil if there is none.
+func (ibs *IndexBuilds) find(db, collection string, names []string, owner string) *indexBuild {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	ibs.mu.Lock()
+	defer ibs.mu.Unlock()
+
+	for _, b := range ibs.builds {
+		if b.owner != owner || b.db != db || b.collection != collection {
+			continue
+		}
+		if strings.Join(b.names(), "\x00") == strings.Join(sorted, "\x00") {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// building returns the build in progress of the named index of the collection, nil if there is none.
+// It must be called with mu held.
+func (ibs *IndexBuilds) building(db, collection, name string) *indexBuild {
+	for _, b := range ibs.builds {
+		if b.db != db || b.collection != collection {
+			continue
+		}
+		for _, index := range b.indexes {
+			if index.Name == name {
+				return b
+			}
+		}
+	}
+
+	return nil
+}
+
+// currentOp returns the document describing the build for currentOp,
+// with the progress of the index being built as reported by SAP HANA if there is one.
+func (b *indexBuild) currentOp(ctx context.Context, hanaPool *hana.Hpool) (types.Document, error) {
+	running := time.Since(b.started)
+	built := atomic.LoadInt32(&b.built)
+
+	pairs := []any{
+		"type", "op",
+		"opid", b.opid,
+		"active", true,
+		"secs_running", int64(running / time.Second),
+		"microsecs_running", running.Microseconds(),
+		"op", "command",
+		"ns", b.db + "." + b.collection,
+		"command", b.command,
+	}
+
+	connID := atomic.LoadInt64(&b.connID)
+	if connID == 0 {
+		pairs = append(pairs, "msg", "Index Build: waiting for a connection")
+	} else {
+		building := b.indexes[minInt32(built, int32(len(b.indexes)-1))]
+		pairs = append(pairs, "msg", "Index Build: building index "+building.Name)
+
+		done, total, err := hanaPool.IndexBuildProgress(ctx, connID)
+		switch err {
+		case nil:
+			pairs = append(pairs, "progress", types.MustMakeDocument("done", done, "total", total))
+		case hana.ErrNotExist:
+			// SAP HANA reports no progress yet
+		default:
+			return types.Document{}, err
+		}
+	}
+
+	pairs = append(pairs, "indexesBuilt", built, "indexesTotal", int32(len(b.indexes)))
+
+	return types.MakeDocument(pairs...)
+}
+
+// minInt32 returns the smaller of a and b.
+func minInt32(a, b int32) int32 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
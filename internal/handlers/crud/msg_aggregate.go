@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgAggregate runs an aggregation pipeline on a collection and returns a cursor to the resulting documents.
+func (h *storage) MsgAggregate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	unimplementedFields := []string{
+		"bypassDocumentValidation",
+		"readConcern",
+		"collation",
+		"hint",
+		"let",
+		"writeConcern",
+	}
+
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err := common.Unimplemented(&document, unimplementedFields...); err != nil {
+		return nil, err
+	}
+
+	common.Ignored(&document, h.l, "allowDiskUse")
+
+	db := document.Map()["$db"].(string)
+
+	p, err := h.newAggregatePipeline(db, document)
+	if err != nil {
+		return nil, err
+	}
+
+	if explain, _ := document.Map()["explain"].(bool); explain {
+		return p.explainReply(ctx, document, false)
+	}
+
+	docs, err := p.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = h.checkQuotas(ctx, docs); err != nil {
+		return nil, err
+	}
+
+	firstBatch := types.MakeArray(len(docs))
+	for _, doc := range docs {
+		if err = firstBatch.Append(doc); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", firstBatch,
+				"id", int64(0),
+				"ns", db+"."+p.collection,
+			),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// newAggregatePipeline returns the pipeline of the aggregate command.
+func (h *storage) newAggregatePipeline(db string, cmd types.Document) (*pipeline, error) {
+	m := cmd.Map()
+
+	collection, ok := m["aggregate"].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "aggregate is only supported on a collection")
+	}
+
+	stages, ok := m["pipeline"].(*types.Array)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "'pipeline' option must be specified as an array")
+	}
+
+	// numericAccuracy is an extension to avoid floating point drift in financial aggregations
+	var decimal bool
+	if v, ok := m["numericAccuracy"]; ok {
+		switch v {
+		case "double":
+		case "decimal":
+			decimal = true
+		default:
+			return nil, common.NewErrorMessage(common.ErrBadValue, "numericAccuracy must be \"double\" or \"decimal\"")
+		}
+	}
+
+	return h.newPipeline(db, collection, stages, decimal)
+}
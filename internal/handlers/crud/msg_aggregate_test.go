@@ -0,0 +1,907 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgAggregate(t *testing.T) {
+	ctx, storage, mock, err := setupTestUtil(t)
+	require.NoError(t, err)
+
+	expectNamespace := func(db, collection string) {
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs(db).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs(db, collection).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	}
+
+	// the SQL of a pushed down $group only accumulates numbers and checks the types of the keys and of $min and $max
+	isNumber := func(k string) string { return k + " BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308" }
+	numbers := func(k string) string { return "CASE WHEN " + isNumber(k) + " THEN " + k + " END" }
+	keyCheck := func(k string) string {
+		return "CASE WHEN " + k + " IS NULL OR " + k + " IS UNSET OR " + isNumber(k) + " OR " + k + " LIKE '%' THEN 1 ELSE 0 END"
+	}
+	uniformCheck := func(k string) string {
+		return "CASE WHEN COUNT(" + k + ") IN (COUNT(CASE WHEN " + isNumber(k) + " THEN 1 END), COUNT(CASE WHEN " + k + " LIKE '%' THEN 1 END)) THEN 1 ELSE 0 END"
+	}
+
+	t.Run("$match and $lookup from another database", func(t *testing.T) {
+		expectNamespace("sales", "orders")
+		mock.ExpectQuery("SELECT * FROM \"sales\".\"orders\" WHERE \"status\" = ?").WithArgs("open").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 1, "customer": 7}`)),
+		)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE USER_NAME = CURRENT_USER AND SCHEMA_NAME = ? AND (OBJECT_NAME IS NULL OR OBJECT_NAME = ?) AND PRIVILEGE = ?").WithArgs("crm", "customers", "SELECT").WillReturnRows(
+			sqlmock.NewRows([]string{"count"}).AddRow(1),
+		)
+		expectNamespace("crm", "customers")
+		mock.ExpectQuery("SELECT * FROM \"crm\".\"customers\" WHERE \"_id\" = ?").WithArgs(int32(7)).WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 7, "name": "SAP"}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "orders",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "open")),
+				types.MustMakeDocument("$lookup", types.MustMakeDocument(
+					"from", types.MustMakeDocument("db", "crm", "coll", "customers"),
+					"localField", "customer",
+					"foreignField", "_id",
+					"as", "customerDetails",
+				)),
+			),
+			"cursor", types.MustMakeDocument(),
+			"$db", "sales",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", types.MustNewArray(
+					types.MustMakeDocument(
+						"_id", int32(1),
+						"customer", int32(7),
+						"customerDetails", types.MustNewArray(
+							types.MustMakeDocument("_id", int32(7), "name", "SAP"),
+						),
+					),
+				),
+				"id", int64(0),
+				"ns", "sales.orders",
+			),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$lookup from another database with one query", func(t *testing.T) {
+		expectNamespace("sales", "orders")
+		mock.ExpectQuery("SELECT * FROM \"sales\".\"orders\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "customer": 7}`)).
+				AddRow([]byte(`{"_id": 2, "customer": [7, 8]}`)).
+				AddRow([]byte(`{"_id": 3}`)),
+		)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE USER_NAME = CURRENT_USER AND SCHEMA_NAME = ? AND (OBJECT_NAME IS NULL OR OBJECT_NAME = ?) AND PRIVILEGE = ?").WithArgs("crm", "customers", "SELECT").WillReturnRows(
+			sqlmock.NewRows([]string{"count"}).AddRow(1),
+		)
+		expectNamespace("crm", "customers")
+
+		// the foreign documents of all documents are fetched by one query
+		mock.ExpectQuery("SELECT * FROM \"crm\".\"customers\" WHERE ((\"_id\" IS NULL OR \"_id\" IS UNSET) OR \"_id\" = ? OR \"_id\" = ?)").
+			WithArgs(int32(7), int32(8)).WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 7, "name": "SAP"}`)).
+				AddRow([]byte(`{"_id": 8, "name": "SE"}`)).
+				AddRow([]byte(`{"_id": null, "name": "unknown"}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "orders",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$lookup", types.MustMakeDocument(
+					"from", types.MustMakeDocument("db", "crm", "coll", "customers"),
+					"localField", "customer",
+					"foreignField", "_id",
+					"as", "customerDetails",
+				)),
+			),
+			"cursor", types.MustMakeDocument(),
+			"$db", "sales",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		sap := types.MustMakeDocument("_id", int32(7), "name", "SAP")
+		se := types.MustMakeDocument("_id", int32(8), "name", "SE")
+		unknown := types.MustMakeDocument("_id", nil, "name", "unknown")
+		expected := types.MustNewArray(
+			types.MustMakeDocument("_id", int32(1), "customer", int32(7), "customerDetails", types.MustNewArray(sap)),
+			types.MustMakeDocument("_id", int32(2), "customer", types.MustNewArray(int32(7), int32(8)), "customerDetails", types.MustNewArray(sap, se)),
+			types.MustMakeDocument("_id", int32(3), "customerDetails", types.MustNewArray(unknown)),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$match and $lookup joined by SAP HANA", func(t *testing.T) {
+		expectNamespace("sales", "orders")
+		mock.ExpectQuery("SELECT * FROM (SELECT * FROM \"sales\".\"orders\" WHERE \"status\" = ?) AS \"l\" " +
+			"LEFT OUTER JOIN \"sales\".\"customers\" AS \"f\" ON (\"l\".\"customer\" = \"f\".\"_id\" OR " +
+			"((\"l\".\"customer\" IS NULL OR \"l\".\"customer\" IS UNSET) AND (\"f\".\"_id\" IS NULL OR \"f\".\"_id\" IS UNSET)))").WillReturnRows(
+			sqlmock.NewRows([]string{"l", "f"}).
+				AddRow([]byte(`{"_id": 1, "customer": 7}`), []byte(`{"_id": 7, "name": "SAP"}`)).
+				AddRow([]byte(`{"_id": 2, "customer": 9}`), nil).
+				AddRow([]byte(`{"_id": 3, "customer": [7, 8]}`), nil),
+		)
+
+		// SAP HANA only joins equal values, so arrays are looked up by the proxy
+		expectNamespace("sales", "customers")
+		mock.ExpectQuery("SELECT * FROM \"sales\".\"customers\" WHERE").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 7, "name": "SAP"}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "orders",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "open")),
+				types.MustMakeDocument("$lookup", types.MustMakeDocument(
+					"from", "customers",
+					"localField", "customer",
+					"foreignField", "_id",
+					"as", "customerDetails",
+				)),
+			),
+			"cursor", types.MustMakeDocument(),
+			"$db", "sales",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		sap := types.MustMakeDocument("_id", int32(7), "name", "SAP")
+		expected := types.MustNewArray(
+			types.MustMakeDocument("_id", int32(1), "customer", int32(7), "customerDetails", types.MustNewArray(sap)),
+			types.MustMakeDocument("_id", int32(2), "customer", int32(9), "customerDetails", types.MustNewArray()),
+			types.MustMakeDocument("_id", int32(3), "customer", types.MustNewArray(int32(7), int32(8)), "customerDetails", types.MustNewArray(sap)),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$out to another database without privilege", func(t *testing.T) {
+		expectNamespace("sales", "orders")
+		mock.ExpectQuery("SELECT * FROM \"sales\".\"orders\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 1}`)),
+		)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE USER_NAME = CURRENT_USER AND SCHEMA_NAME = ? AND (OBJECT_NAME IS NULL OR OBJECT_NAME = ?) AND PRIVILEGE = ?").WithArgs("reporting", "orders", "INSERT").WillReturnRows(
+			sqlmock.NewRows([]string{"count"}).AddRow(0),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "orders",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$out", types.MustMakeDocument("db", "reporting", "coll", "orders")),
+			),
+			"cursor", types.MustMakeDocument(),
+			"$db", "sales",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.Equal(t, common.NewErrorMessage(common.ErrUnauthorized, "not authorized on reporting to execute insert on collection orders"), err)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$out must be the last stage", func(t *testing.T) {
+		req := types.MustMakeDocument(
+			"aggregate", "orders",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$out", "copy"),
+				types.MustMakeDocument("$match", types.MustMakeDocument()),
+			),
+			"$db", "sales",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.EqualError(t, err, "BadValue (2): $out can only be the final stage in the pipeline")
+	})
+
+	t.Run("$group with decimal accuracy", func(t *testing.T) {
+		// exact decimals are only computed by the proxy
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "a", "amount": 0.1}`)).
+				AddRow([]byte(`{"_id": 2, "account": "b", "amount": 1}`)).
+				AddRow([]byte(`{"_id": 3, "account": "a", "amount": 0.2}`)).
+				AddRow([]byte(`{"_id": 4, "account": "b", "amount": 2}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$group", types.MustMakeDocument(
+					"_id", "$account",
+					"total", types.MustMakeDocument("$sum", "$amount"),
+					"average", types.MustMakeDocument("$avg", "$amount"),
+					"count", types.MustMakeDocument("$sum", int32(1)),
+				)),
+			),
+			"numericAccuracy", "decimal",
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustNewArray(
+			types.MustMakeDocument("_id", "a", "total", 0.3, "average", 0.15, "count", int32(2)),
+			types.MustMakeDocument("_id", "b", "total", int32(3), "average", 1.5, "count", int32(2)),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group pushed down to SAP HANA", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT \"account\" AS \"_id\", COALESCE(SUM(" + numbers(`"amount"`) + "), 0) AS \"total\", " +
+			"AVG(" + numbers(`"amount"`) + ") AS \"average\", 1 * COUNT(*) AS \"count\", " + keyCheck(`"account"`) + " " +
+			"FROM \"shop\".\"payments\" WHERE \"status\" = ? GROUP BY \"account\"").WithArgs("paid").WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "total", "average", "count", "key"}).
+				AddRow("a", 0.30000000000000004, 0.15000000000000002, int64(2), int64(1)).
+				AddRow("b", int64(3), 1.5, int64(2), int64(1)).
+				AddRow(nil, int64(0), nil, int64(1), int64(1)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "paid")),
+				types.MustMakeDocument("$group", types.MustMakeDocument(
+					"_id", "$account",
+					"total", types.MustMakeDocument("$sum", "$amount"),
+					"average", types.MustMakeDocument("$avg", "$amount"),
+					"count", types.MustMakeDocument("$sum", int32(1)),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustNewArray(
+			types.MustMakeDocument("_id", "a", "total", 0.30000000000000004, "average", 0.15000000000000002, "count", int32(2)),
+			types.MustMakeDocument("_id", "b", "total", int32(3), "average", 1.5, "count", int32(2)),
+			types.MustMakeDocument("_id", nil, "total", int32(0), "average", nil, "count", int32(1)),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group of all documents pushed down to SAP HANA", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT NULL AS \"_id\", COALESCE(SUM(" + numbers(`"amount"`) + "), 0) AS \"total\" FROM \"shop\".\"payments\" HAVING COUNT(*) > 0").WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "total"}),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$group", types.MustMakeDocument(
+					"_id", nil,
+					"total", types.MustMakeDocument("$sum", "$amount"),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group with accumulators of the proxy", func(t *testing.T) {
+		// $first, $last, $push and $addToSet depend on the order of the documents or return arrays
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "a", "amount": 5, "tag": "x"}`)).
+				AddRow([]byte(`{"_id": 2, "account": "a", "amount": "n/a", "tag": null}`)).
+				AddRow([]byte(`{"_id": 3, "account": "a", "amount": 2.5, "tag": "x"}`)).
+				AddRow([]byte(`{"_id": 4, "account": "a"}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$group", types.MustMakeDocument(
+					"_id", "$account",
+					"min", types.MustMakeDocument("$min", "$amount"),
+					"max", types.MustMakeDocument("$max", "$amount"),
+					"first", types.MustMakeDocument("$first", "$amount"),
+					"last", types.MustMakeDocument("$last", "$amount"),
+					"amounts", types.MustMakeDocument("$push", "$amount"),
+					"tags", types.MustMakeDocument("$addToSet", "$tag"),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustNewArray(
+			types.MustMakeDocument(
+				"_id", "a",
+				"min", 2.5,
+				"max", "n/a",
+				"first", int32(5),
+				"last", nil,
+				"amounts", types.MustNewArray(int32(5), "n/a", 2.5),
+				"tags", types.MustNewArray("x", nil),
+			),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	minMaxSQL := "SELECT \"account\" AS \"_id\", MIN(\"amount\") AS \"min\", MAX(\"amount\") AS \"max\", " +
+		keyCheck(`"account"`) + ", " + uniformCheck(`"amount"`) + ", " + uniformCheck(`"amount"`) + " " +
+		"FROM \"shop\".\"payments\" GROUP BY \"account\""
+
+	minMaxReq := types.MustMakeDocument(
+		"aggregate", "payments",
+		"pipeline", types.MustNewArray(
+			types.MustMakeDocument("$group", types.MustMakeDocument(
+				"_id", "$account",
+				"min", types.MustMakeDocument("$min", "$amount"),
+				"max", types.MustMakeDocument("$max", "$amount"),
+			)),
+		),
+		"$db", "shop",
+	)
+
+	t.Run("$group with $min and $max pushed down to SAP HANA", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery(minMaxSQL).WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "min", "max", "key", "uniform1", "uniform2"}).AddRow("a", int64(1), 2.5, int64(1), int64(1), int64(1)),
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{minMaxReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(types.MustMakeDocument("_id", "a", "min", int32(1), "max", 2.5)), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group with $min and $max of different types", func(t *testing.T) {
+		// SAP HANA does not compare values of different types in the BSON order, so the proxy computes the groups
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery(minMaxSQL).WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "min", "max", "key", "uniform1", "uniform2"}).AddRow("a", int64(1), 2.5, int64(1), int64(0), int64(0)),
+		)
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "a", "amount": 5}`)).
+				AddRow([]byte(`{"_id": 2, "account": "a", "amount": "n/a"}`)).
+				AddRow([]byte(`{"_id": 3, "account": "a", "amount": 2.5}`)),
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{minMaxReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(types.MustMakeDocument("_id", "a", "min", 2.5, "max", "n/a")), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group by documents", func(t *testing.T) {
+		// SAP HANA returns documents as JSON text, so the proxy computes the groups
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery(minMaxSQL).WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "min", "max", "key", "uniform1", "uniform2"}).AddRow(`{"x": 1}`, int64(1), int64(1), int64(0), int64(1), int64(1)),
+		)
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": {"x": 1}, "amount": 1}`)).
+				AddRow([]byte(`{"_id": 2, "account": {"x": 2}, "amount": 2}`)),
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{minMaxReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(
+			types.MustMakeDocument("_id", types.MustMakeDocument("x", int32(1)), "min", int32(1), "max", int32(1)),
+			types.MustMakeDocument("_id", types.MustMakeDocument("x", int32(2)), "min", int32(2), "max", int32(2)),
+		), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	expectTableStats := func(rows int64) {
+		mock.ExpectQuery("SELECT TABLE_NAME, TABLE_TYPE, TABLE_SIZE, RECORD_COUNT FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").
+			WithArgs("shop", "payments").
+			WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "TABLE_TYPE", "TABLE_SIZE", "RECORD_COUNT"}).AddRow("payments", "COLLECTION", 1024, rows))
+	}
+
+	t.Run("$sample pushed down to SAP HANA", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		expectTableStats(100)
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\" TABLESAMPLE BERNOULLI (4) WHERE \"status\" = ? ORDER BY RAND() LIMIT 2").
+			WithArgs("paid").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 3}`)).
+				AddRow([]byte(`{"_id": 1}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "paid")),
+				types.MustMakeDocument("$sample", types.MustMakeDocument("size", int32(2))),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(types.MustMakeDocument("_id", int32(3)), types.MustMakeDocument("_id", int32(1))), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$sample of too few sampled documents", func(t *testing.T) {
+		// TABLESAMPLE sampled fewer documents matching the filter than needed, so all matching documents are ordered randomly
+		expectNamespace("shop", "payments")
+		expectTableStats(1000)
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\" TABLESAMPLE BERNOULLI (0.4) WHERE \"status\" = ? ORDER BY RAND() LIMIT 2").
+			WithArgs("paid").WillReturnRows(sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 3}`)))
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\" WHERE \"status\" = ? ORDER BY RAND() LIMIT 2").WithArgs("paid").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 7}`)).
+				AddRow([]byte(`{"_id": 3}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "paid")),
+				types.MustMakeDocument("$sample", types.MustMakeDocument("size", int32(2))),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, types.MustNewArray(types.MustMakeDocument("_id", int32(7)), types.MustMakeDocument("_id", int32(3))), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$sample after $group", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT \"account\" AS \"_id\", " + keyCheck(`"account"`) + " FROM \"shop\".\"payments\" GROUP BY \"account\"").WillReturnRows(
+			sqlmock.NewRows([]string{"_id", "key"}).AddRow("a", int64(1)).AddRow("b", int64(1)).AddRow("c", int64(1)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$group", types.MustMakeDocument("_id", "$account")),
+				types.MustMakeDocument("$sample", types.MustMakeDocument("size", float64(2))),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, 2, firstBatch.(*types.Array).Len())
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$sample with negative size", func(t *testing.T) {
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$sample", types.MustMakeDocument("size", int32(-1))),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.EqualError(t, err, "BadValue (2): size argument to $sample must not be negative")
+	})
+
+	t.Run("$project pushed down to SAP HANA", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		sql := "SELECT {\"_id\": \"_id\", \"account\": \"account\", \"total\": ((\"amount\" * \"count\")), " +
+			"\"code\": ((\"account\" || ? || COALESCE(LOWER(\"currency\"), '')))} FROM \"shop\".\"payments\" WHERE \"status\" = ?"
+		mock.ExpectQuery(sql).WithArgs("-", "paid").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "a", "total": 10, "code": "a-eur"}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "paid")),
+				types.MustMakeDocument("$project", types.MustMakeDocument(
+					"account", int32(1),
+					"total", types.MustMakeDocument("$multiply", types.MustNewArray("$amount", "$count")),
+					"code", types.MustMakeDocument("$concat", types.MustNewArray(
+						"$account", "-", types.MustMakeDocument("$toLower", "$currency"),
+					)),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		expected := types.MustNewArray(types.MustMakeDocument("_id", int32(1), "account", "a", "total", int32(10), "code", "a-eur"))
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$project and $addFields computed by the proxy", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\"").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "Alice", "amount": 5, "paid": {"$da": 1654041600000}}`)).
+				AddRow([]byte(`{"_id": 2, "account": "Bob", "amount": 2147483647, "fee": 1.5}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$project", types.MustMakeDocument(
+					"_id", false,
+					"initials", types.MustMakeDocument("$substr", types.MustNewArray("$account", int32(0), int32(2))),
+					"total", types.MustMakeDocument("$add", types.MustNewArray("$amount", types.MustMakeDocument("$ifNull", types.MustNewArray("$fee", int32(1))))),
+					"year", types.MustMakeDocument("$year", "$paid"),
+					"paid", "$paid",
+					// SAP HANA does not compute the truthiness of fields
+					"unpaid", types.MustMakeDocument("$cond", types.MustMakeDocument(
+						"if", "$paid", "then", "no", "else", types.MustMakeDocument("$literal", "$yes"),
+					)),
+				)),
+				types.MustMakeDocument("$addFields", types.MustMakeDocument(
+					"month", types.MustMakeDocument("$month", types.MustMakeDocument("date", "$paid")),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		paid := time.UnixMilli(1654041600000).UTC()
+		expected := types.MustNewArray(
+			types.MustMakeDocument("initials", "Al", "total", int32(6), "year", int32(2022), "paid", paid, "unpaid", "no", "month", int32(6)),
+			types.MustMakeDocument("initials", "Bo", "total", 2147483648.5, "year", nil, "unpaid", "$yes", "month", nil),
+		)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$project with exclusion applied while scanning", func(t *testing.T) {
+		expectNamespace("shop", "payments")
+		mock.ExpectQuery("SELECT * FROM \"shop\".\"payments\" WHERE \"status\" = ?").WithArgs("paid").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "account": "a", "receipt": {"pdf": "JVBERi0", "pages": 2}, "card": {"number": "4111", "type": "visa"}}`)),
+		)
+
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$match", types.MustMakeDocument("status", "paid")),
+				types.MustMakeDocument("$project", types.MustMakeDocument("_id", int32(0), "receipt", int32(0), "card.number", int32(0))),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgAggregate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch, err := actual.GetByPath("cursor", "firstBatch")
+		require.NoError(t, err)
+		expected := types.MustNewArray(types.MustMakeDocument("account", "a", "card", types.MustMakeDocument("type", "visa")))
+		assert.Equal(t, expected, firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$project with exclusion and computed field", func(t *testing.T) {
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$project", types.MustMakeDocument(
+					"amount", int32(0),
+					"total", types.MustMakeDocument("$add", types.MustNewArray("$amount", int32(1))),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.EqualError(t, err, "Location31254 (31254): Cannot do exclusion on field amount in inclusion projection")
+	})
+
+	t.Run("$addFields with unsupported expression", func(t *testing.T) {
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(
+				types.MustMakeDocument("$addFields", types.MustMakeDocument(
+					"total", types.MustMakeDocument("$subtract", types.MustNewArray("$amount", int32(1))),
+				)),
+			),
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.EqualError(t, err, "NotImplemented (238): expression $subtract is not implemented yet")
+	})
+
+	t.Run("$group with unknown numericAccuracy", func(t *testing.T) {
+		req := types.MustMakeDocument(
+			"aggregate", "payments",
+			"pipeline", types.MustNewArray(),
+			"numericAccuracy", "float",
+			"$db", "shop",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		_, err := storage.MsgAggregate(ctx, &reqMsg)
+		assert.EqualError(t, err, "BadValue (2): numericAccuracy must be \"double\" or \"decimal\"")
+	})
+}
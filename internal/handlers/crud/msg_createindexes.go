@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -20,16 +22,102 @@ package crud
 
 import (
 	"context"
+	"strings"
 
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
-// MsgCreateIndexes creates indexes. (IS NOT IMPLEMENTED YET)
+// MsgCreateIndexes validates the given index specifications and creates the indexes of ascending and descending keys
+// as SAP HANA indexes of the collection, which are built in the background, see IndexBuilds.
+// It waits for the build to finish unless the commitQuorum is 0.
+// Text and 2dsphere indexes are not created as SAP HANA indexes: SAP HANA JSON Document Store has no full-text
+// or spatial indexes, so only their fields are stored with the collection options.
 func (h *storage) MsgCreateIndexes(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	commitQuorum, ok := document.Map()["commitQuorum"]
+	if ok {
+		if err = common.ValidateCommitQuorum(commitQuorum); err != nil {
+			return nil, err
+		}
+	} else {
+		commitQuorum = "votingMembers"
+	}
+
+	indexes, ok := document.Map()["indexes"].(*types.Array)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "createIndexes needs an array of indexes")
+	}
+
+	var textIndex *hana.TextIndex
+	var geoIndexes []hana.GeoIndex
+	var keyIndexes []*hana.Index
+	for i := 0; i < indexes.Len(); i++ {
+		index, _ := indexes.Get(i)
+		indexDoc, ok := index.(types.Document)
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "index specification must be an object")
+		}
+
+		if err = validateIndexKey(indexDoc); err != nil {
+			return nil, err
+		}
+
+		t, err := textIndexOf(indexDoc)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			if textIndex != nil {
+				return nil, common.NewErrorMessage(common.ErrIndexOptionsConflict, "only one text index per collection allowed, found existing text index \"%s\"", textIndex.Name)
+			}
+			textIndex = t
+		}
+
+		g, err := geoIndexOf(indexDoc)
+		if err != nil {
+			return nil, err
+		}
+		if g != nil {
+			geoIndexes = append(geoIndexes, *g)
+		}
+
+		k, err := keyIndexOf(indexDoc)
+		if err != nil {
+			return nil, err
+		}
+		if k != nil {
+			keyIndexes = append(keyIndexes, k)
+		}
+	}
+
+	if textIndex != nil {
+		if err = h.createTextIndex(ctx, document, textIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(geoIndexes) > 0 {
+		if err = h.createGeoIndexes(ctx, document, geoIndexes); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(keyIndexes) > 0 {
+		if err = h.buildIndexes(ctx, document, keyIndexes, commitQuorum); err != nil {
+			return nil, err
+		}
+	}
+
 	var reply wire.OpMsg
-	err := reply.SetSections(wire.OpMsgSection{
+	err = reply.SetSections(wire.OpMsgSection{
 		Documents: []types.Document{types.MustMakeDocument(
 			"ok", float64(1),
 		)},
@@ -40,3 +128,228 @@ func (h *storage) MsgCreateIndexes(ctx context.Context, msg *wire.OpMsg) (*wire.
 
 	return &reply, nil
 }
+
+// validateIndexKey checks that the key of an index specification only uses supported index types.
+func validateIndexKey(index types.Document) error {
+	key, ok := index.Map()["key"].(types.Document)
+	if !ok || len(key.Keys()) == 0 {
+		return common.NewErrorMessage(common.ErrBadValue, "index specification must contain a key object")
+	}
+
+	for _, field := range key.Keys() {
+		switch indexType := key.Map()[field].(type) {
+		case int32:
+			if indexType != 1 && indexType != -1 {
+				return common.NewErrorMessage(common.ErrBadValue, "values in the index key pattern can only be 1 or -1")
+			}
+		case float64:
+			if indexType != 1 && indexType != -1 {
+				return common.NewErrorMessage(common.ErrBadValue, "values in the index key pattern can only be 1 or -1")
+			}
+		case string:
+			switch indexType {
+			case "text", "2dsphere":
+			default:
+				return common.NewErrorMessage(common.ErrNotImplemented, "index type %s is not supported", indexType)
+			}
+		default:
+			return common.NewErrorMessage(common.ErrBadValue, "cannot use type %T in the index key pattern", indexType)
+		}
+	}
+
+	return nil
+}
+
+// textIndexOf returns the text index of an index specification or nil if it has no text fields.
+func textIndexOf(index types.Document) (*hana.TextIndex, error) {
+	key := index.Map()["key"].(types.Document)
+
+	var fields []string
+	for _, field := range key.Keys() {
+		if key.Map()[field] != "text" {
+			continue
+		}
+		if field == "$**" {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "wildcard text indexes are not supported")
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	name, ok := index.Map()["name"].(string)
+	if !ok || name == "" {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "text index specification must have a name")
+	}
+
+	return &hana.TextIndex{Name: name, Fields: fields}, nil
+}
+
+// geoIndexOf returns the 2dsphere index of an index specification or nil if it has no 2dsphere fields.
+func geoIndexOf(index types.Document) (*hana.GeoIndex, error) {
+	key := index.Map()["key"].(types.Document)
+
+	var fields []string
+	for _, field := range key.Keys() {
+		if key.Map()[field] == "2dsphere" {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	name, ok := index.Map()["name"].(string)
+	if !ok || name == "" {
+		return nil, common.NewErrorMessage(common.ErrFailedToParse, "The 'name' field is a required property of an index specification")
+	}
+
+	return &hana.GeoIndex{Name: name, Fields: fields}, nil
+}
+
+// keyIndexOf returns the index of an index specification whose keys are all ascending or descending,
+// or nil if it has other keys or is the index of _id, which every collection has.
+func keyIndexOf(index types.Document) (*hana.Index, error) {
+	key := index.Map()["key"].(types.Document)
+
+	res := new(hana.Index)
+	for _, field := range key.Keys() {
+		switch order := key.Map()[field].(type) {
+		case int32:
+			res.Keys = append(res.Keys, hana.IndexKey{Field: field, Descending: order < 0})
+		case float64:
+			res.Keys = append(res.Keys, hana.IndexKey{Field: field, Descending: order < 0})
+		default:
+			return nil, nil
+		}
+	}
+
+	if len(res.Keys) == 1 && res.Keys[0].Field == "_id" {
+		return nil, nil
+	}
+
+	var ok bool
+	if res.Name, ok = index.Map()["name"].(string); !ok || res.Name == "" {
+		return nil, common.NewErrorMessage(common.ErrFailedToParse, "The 'name' field is a required property of an index specification")
+	}
+
+	return res, nil
+}
+
+// buildIndexes builds the indexes of the collection which do not exist yet, creating the collection if it does not exist.
+// It waits for their builds to finish, including the ones of other clients building the same indexes,
+// unless the commitQuorum is 0 or ctx is done; the builds continue then.
+func (h *storage) buildIndexes(ctx context.Context, document types.Document, indexes []*hana.Index, commitQuorum any) error {
+	m := document.Map()
+	collection, ok := m[document.Command()].(string)
+	if !ok {
+		return common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m[document.Command()])
+	}
+	db := m["$db"].(string)
+
+	if err := h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+		return err
+	}
+
+	var missing []*hana.Index
+	for _, index := range indexes {
+		exists, err := h.hanaPool.IndexExists(ctx, db, collection, index.Name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			missing = append(missing, index)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, b := range h.indexBuilds.build(ctx, h.hanaPool, h.l, db, collection, missing, document, commitQuorum) {
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createTextIndex stores the fields of the text index with the options of the collection, which is created if it does not exist.
+// No index is created in SAP HANA, so $text queries are not supported. Like in MongoDB, a collection can only have one text index.
+func (h *storage) createTextIndex(ctx context.Context, document types.Document, textIndex *hana.TextIndex) error {
+	m := document.Map()
+	collection, ok := m[document.Command()].(string)
+	if !ok {
+		return common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m[document.Command()])
+	}
+	db := m["$db"].(string)
+
+	if err := h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+		return err
+	}
+
+	opts, err := h.hanaPool.CollectionOptions(ctx, db, collection)
+	if err != nil {
+		return err
+	}
+
+	if existing := opts.TextIndex; existing != nil {
+		if existing.Name != textIndex.Name || strings.Join(existing.Fields, ",") != strings.Join(textIndex.Fields, ",") {
+			return common.NewErrorMessage(common.ErrIndexOptionsConflict, "only one text index per collection allowed, found existing text index \"%s\"", existing.Name)
+		}
+		return nil
+	}
+
+	opts.TextIndex = textIndex
+	return h.hanaPool.SetCollectionOptions(ctx, db, collection, opts)
+}
+
+// createGeoIndexes stores the fields of the 2dsphere indexes with the options of the collection,
+// which is created if it does not exist. No index is created in SAP HANA.
+func (h *storage) createGeoIndexes(ctx context.Context, document types.Document, geoIndexes []hana.GeoIndex) error {
+	m := document.Map()
+	collection, ok := m[document.Command()].(string)
+	if !ok {
+		return common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m[document.Command()])
+	}
+	db := m["$db"].(string)
+
+	if err := h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+		return err
+	}
+
+	opts, err := h.hanaPool.CollectionOptions(ctx, db, collection)
+	if err != nil {
+		return err
+	}
+
+	var changed bool
+	for _, geoIndex := range geoIndexes {
+		var found bool
+		for _, existing := range opts.GeoIndexes {
+			if existing.Name != geoIndex.Name {
+				continue
+			}
+			if strings.Join(existing.Fields, ",") != strings.Join(geoIndex.Fields, ",") {
+				return common.NewErrorMessage(common.ErrIndexOptionsConflict,
+					"An existing index has the same name as the requested index: \"%s\"", existing.Name)
+			}
+			found = true
+		}
+
+		if !found {
+			opts.GeoIndexes = append(opts.GeoIndexes, geoIndex)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return h.hanaPool.SetCollectionOptions(ctx, db, collection, opts)
+}
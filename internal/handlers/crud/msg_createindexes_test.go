@@ -0,0 +1,255 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestMsgCreateIndexes(t *testing.T) {
+	ctx, storage, mock, err := setupTestUtil(t)
+	require.NoError(t, err)
+
+	createIndexes := func(t *testing.T, indexes *types.Array) (types.Document, error) {
+		t.Helper()
+
+		var reqMsg wire.OpMsg
+		err := reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{types.MustMakeDocument(
+				"createIndexes", "testCollection",
+				"indexes", indexes,
+				"$db", "testDatabase",
+			)},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgCreateIndexes(ctx, &reqMsg)
+		if err != nil {
+			return types.Document{}, err
+		}
+
+		return msg.Document()
+	}
+
+	t.Run("text index", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectExec("COMMENT ON TABLE \"testDatabase\".\"testCollection\" IS '{\"textIndex\":{\"name\":\"title_text_body_text\",\"fields\":[\"title\",\"body\"]}}'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		actual, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("title", "text", "body", "text"),
+			"name", "title_text_body_text",
+		)))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("second text index", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(sqlmock.NewRows([]string{"comments"}).AddRow(`{"textIndex":{"name":"title_text","fields":["title"]}}`))
+
+		_, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("body", "text"),
+			"name", "body_text",
+		)))
+		require.EqualError(t, err, `IndexOptionsConflict (85): only one text index per collection allowed, found existing text index "title_text"`)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("index of keys", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"INDEXES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ? AND INDEX_NAME = ?").
+			WithArgs("testDatabase", "testCollection", "testCollection.a_1_b_-1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery("SELECT CURRENT_CONNECTION FROM DUMMY").WillReturnRows(sqlmock.NewRows([]string{"connection"}).AddRow(42))
+		mock.ExpectExec("CREATE INDEX \"testDatabase\".\"testCollection.a_1_b_-1\" ON \"testDatabase\".\"testCollection\" (\"a\" ASC, \"b\".\"c\" DESC)").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		actual, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("a", int32(1), "b.c", float64(-1)),
+			"name", "a_1_b_-1",
+		)))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("existing index of keys", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"INDEXES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ? AND INDEX_NAME = ?").
+			WithArgs("testDatabase", "testCollection", "testCollection.a_1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		actual, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("a", int32(1)),
+			"name", "a_1",
+		)))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("index of keys without name", func(t *testing.T) {
+		_, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("a", int32(1)),
+		)))
+		require.EqualError(t, err, "FailedToParse (9): The 'name' field is a required property of an index specification")
+	})
+
+	t.Run("wildcard text index", func(t *testing.T) {
+		_, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("$**", "text"),
+			"name", "all_text",
+		)))
+		require.EqualError(t, err, "NotImplemented (238): wildcard text indexes are not supported")
+	})
+
+	t.Run("2dsphere index", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(sqlmock.NewRows([]string{"comments"}).AddRow(`{"textIndex":{"name":"title_text","fields":["title"]}}`))
+		mock.ExpectExec("COMMENT ON TABLE \"testDatabase\".\"testCollection\" IS '{\"textIndex\":{\"name\":\"title_text\",\"fields\":[\"title\"]}," +
+			"\"geoIndexes\":[{\"name\":\"location_2dsphere\",\"fields\":[\"location\"]}]}'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		actual, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("location", "2dsphere"),
+			"name", "location_2dsphere",
+		)))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("existing 2dsphere index", func(t *testing.T) {
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(sqlmock.NewRows([]string{"comments"}).AddRow(`{"geoIndexes":[{"name":"location_2dsphere","fields":["location"]}]}`))
+
+		actual, err := createIndexes(t, types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("location", "2dsphere"),
+			"name", "location_2dsphere",
+		)))
+		require.NoError(t, err)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+func TestIndexBuild(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(QueryMatcherEqualBytes))
+	require.NoError(t, err)
+
+	// the build runs concurrently with currentOp
+	mock.MatchExpectationsInOrder(false)
+
+	ctx := testutil.Ctx(t)
+	storage := NewStorage(&NewStorageOpts{
+		HanaPool:      &hana.Hpool{DB: db},
+		Logger:        zaptest.NewLogger(t),
+		KeyValidation: common.RejectDottedDollarKeys,
+	}).(*storage)
+
+	run := func(t *testing.T, handler func(context.Context, *wire.OpMsg) (*wire.OpMsg, error), doc types.Document) types.Document {
+		t.Helper()
+
+		var reqMsg wire.OpMsg
+		require.NoError(t, reqMsg.SetSections(wire.OpMsgSection{Documents: []types.Document{doc}}))
+
+		msg, err := handler(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, err := msg.Document()
+		require.NoError(t, err)
+
+		return actual
+	}
+
+	mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"INDEXES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ? AND INDEX_NAME = ?").
+		WithArgs("testDatabase", "testCollection", "testCollection.a_1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT CURRENT_CONNECTION FROM DUMMY").WillReturnRows(sqlmock.NewRows([]string{"connection"}).AddRow(42))
+	mock.ExpectExec("CREATE INDEX \"testDatabase\".\"testCollection.a_1\" ON \"testDatabase\".\"testCollection\" (\"a\" ASC)").
+		WillDelayFor(time.Minute).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT CURRENT_PROGRESS, MAX_PROGRESS FROM \"PUBLIC\".\"M_JOB_PROGRESS\" WHERE CONNECTION_ID = ? AND JOB_NAME LIKE '%Index%'").
+		WithArgs(int64(42)).WillReturnRows(sqlmock.NewRows([]string{"current_progress", "max_progress"}).AddRow(10, 100))
+
+	command := types.MustMakeDocument(
+		"createIndexes", "testCollection",
+		"indexes", types.MustNewArray(types.MustMakeDocument(
+			"key", types.MustMakeDocument("a", int32(1)),
+			"name", "a_1",
+		)),
+		"commitQuorum", int32(0),
+		"$db", "testDatabase",
+	)
+
+	// commitQuorum 0 does not wait for the build
+	actual := run(t, storage.MsgCreateIndexes, command)
+	assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+	builds := storage.indexBuilds.list("")
+	require.Len(t, builds, 1)
+	b := builds[0]
+	require.Eventually(t, func() bool { return atomic.LoadInt64(&b.connID) != 0 }, time.Minute, time.Millisecond)
+
+	actual = run(t, storage.MsgCurrentOp, types.MustMakeDocument("currentOp", int32(1), "$db", "admin"))
+	inprog := actual.Map()["inprog"].(*types.Array)
+	require.Equal(t, 1, inprog.Len())
+	op, _ := inprog.Get(0)
+	opDoc := op.(types.Document)
+	assert.Equal(t, int32(1), opDoc.Map()["opid"])
+	assert.Equal(t, "testDatabase.testCollection", opDoc.Map()["ns"])
+	assert.Equal(t, command, opDoc.Map()["command"])
+	assert.Equal(t, "Index Build: building index a_1", opDoc.Map()["msg"])
+	assert.Equal(t, types.MustMakeDocument("done", int64(10), "total", int64(100)), opDoc.Map()["progress"])
+	assert.Equal(t, int32(0), opDoc.Map()["indexesBuilt"])
+	assert.Equal(t, int32(1), opDoc.Map()["indexesTotal"])
+
+	actual = run(t, storage.MsgKillOp, types.MustMakeDocument("killOp", int32(1), "op", int32(1), "$db", "admin"))
+	assert.Equal(t, types.MustMakeDocument("info", "attempting to kill op", "ok", float64(1)), actual)
+
+	<-b.done
+	require.EqualError(t, b.err, "IndexBuildAborted (276): Index build aborted: 1: operation was interrupted")
+	assert.Empty(t, storage.indexBuilds.list(""))
+}
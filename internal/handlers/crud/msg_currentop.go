@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgCurrentOp returns the index builds in progress of the SAP HANA user of the client
+// with their progress as reported by SAP HANA. Other operations are not reported, and filters are ignored.
+func (h *storage) MsgCurrentOp(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if document.Map()["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "currentOp may only be run against the admin database.")
+	}
+
+	inprog := types.MustNewArray()
+	for _, b := range h.indexBuilds.list(hana.User(ctx)) {
+		op, err := b.currentOp(ctx, h.hanaPool)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		if err = inprog.Append(op); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"inprog", inprog,
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -38,9 +38,6 @@ func (h *storage) MsgDelete(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		return nil, lazyerrors.Error(err)
 	}
 
-	if err := common.Unimplemented(&document, "let", "writeConcern"); err != nil {
-		return nil, err
-	}
 	common.Ignored(&document, h.l, "ordered")
 
 	m := document.Map()
@@ -48,6 +45,12 @@ func (h *storage) MsgDelete(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 	collection := m[document.Command()].(string)
 	db := m["$db"].(string)
 
+	ctx, cancel, err := h.prepareWrite(ctx, &document, db, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
 	// If namespace does not exist, return
 	if exists, err := h.hanaPool.NamespaceExists(ctx, db, collection); err == nil {
 		if !exists {
@@ -76,30 +79,42 @@ func (h *storage) MsgDelete(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		if err != nil {
 			return nil, lazyerrors.Error(err)
 		}
-		check := doc.(types.Document)
-		if err := common.Unimplemented(&check, "collation", "hint"); err != nil {
+		d := doc.(types.Document).Map()
+
+		collation, err := common.ParseCollation(d["collation"])
+		if err != nil {
 			return nil, err
 		}
 
-		d := doc.(types.Document).Map()
+		hint, err := h.hintSQL(ctx, db, collection, d["hint"])
+		if err != nil {
+			return nil, err
+		}
+
+		// the variables of let are replaced by their values in $expr
+		filter, err := common.ApplyLet(d["q"].(types.Document), m["let"])
+		if err != nil {
+			return nil, err
+		}
 
 		sql := fmt.Sprintf("DELETE FROM \"%s\".\"%s\"", db, collection)
 
 		limit, _ := d["limit"].(int32)
 
 		var delSQL string
-		var args []any
+		var placeholder common.Placeholder
 		if limit != 0 { // if deleteOne()
 			qSQL := fmt.Sprintf("SELECT {\"_id\": \"_id\"} FROM \"%s\".\"%s\"", db, collection)
 
-			whereSQL, err := common.CreateWhereClause(d["q"].(types.Document))
+			var qPlaceholder common.Placeholder
+			whereSQL, err := common.CreateCollatedWhereClause(filter, collation, &qPlaceholder)
 			if err != nil {
 				return nil, err
 			}
 
-			qSQL += whereSQL + " LIMIT 1"
+			qSQL += whereSQL + " LIMIT 1" + hint
 
-			row := h.hanaPool.QueryRowContext(ctx, qSQL)
+			row := h.hanaPool.QueryRowContext(ctx, qSQL, qPlaceholder.Args()...)
 
 			var objectID []byte
 			err = row.Scan(&objectID)
@@ -113,25 +128,24 @@ func (h *storage) MsgDelete(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 				return nil, err
 			}
 
-			deleteId, err := common.GetUpdateValue(id.(types.Document).Map()["_id"])
+			deleteId, err := common.GetUpdateValue(id.(types.Document).Map()["_id"], &placeholder)
 			if err != nil {
 				return nil, err
 			}
 
-			args = append(args, deleteId)
-			delSQL = " WHERE \"_id\" = %s"
+			delSQL = " WHERE \"_id\" = " + deleteId
 
 		} else { // if deleteMany()
-			delSQL, err = common.CreateWhereClause(d["q"].(types.Document))
+			delSQL, err = common.CreateCollatedWhereClause(filter, collation, &placeholder)
 			if err != nil {
 				return nil, lazyerrors.Error(err)
 			}
+			delSQL += hint
 		}
 
 		sql += delSQL
 
-		sqlExec := fmt.Sprintf(sql, args...)
-		tag, err := h.hanaPool.ExecContext(ctx, sqlExec)
+		tag, err := h.hanaPool.ExecContext(ctx, sql, placeholder.Args()...)
 		if err != nil {
 			// TODO check error code
 			return nil, common.NewErrorMessage(common.ErrNamespaceNotFound, "MsgDelete: ns not found: %w", err)
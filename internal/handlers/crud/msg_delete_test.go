@@ -50,14 +50,18 @@ func setupTestUtil(t *testing.T) (context.Context, common.Storage, sqlmock.Sqlmo
 	}
 
 	hPool := hana.Hpool{
-		db,
+		DB: db,
 	}
 
 	ctx := testutil.Ctx(t)
 
 	l := zaptest.NewLogger(t)
 
-	storage := NewStorage(&hPool, l)
+	storage := NewStorage(&NewStorageOpts{
+		HanaPool:      &hPool,
+		Logger:        l,
+		KeyValidation: common.RejectDottedDollarKeys,
+	})
 
 	return ctx, storage, mock, err
 }
@@ -69,9 +73,10 @@ func TestMsgDelete(t *testing.T) {
 		row1 := sqlmock.NewRows([]string{"count"}).AddRow(1)
 		row2 := sqlmock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
-		mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test'").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ?").WithArgs("test").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		deleteReq := types.MustMakeDocument(
 			"delete", "testCollection",
@@ -109,15 +114,56 @@ func TestMsgDelete(t *testing.T) {
 		}
 	})
 
+	t.Run("deleteMany with let", func(t *testing.T) {
+		row1 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+		row2 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\" WHERE \"qty\" < ?").WithArgs(int32(10)).WillReturnResult(sqlmock.NewResult(2, 2))
+
+		deleteReq := types.MustMakeDocument(
+			"delete", "testCollection",
+			"deletes", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument(
+						"$expr", types.MustMakeDocument("$lt", types.MustNewArray("$qty", "$$minQty")),
+					),
+					"limit", int32(0),
+				),
+			),
+			"let", types.MustMakeDocument("minQty", int32(10)),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{deleteReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgDelete(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, int32(2), actual.Map()["n"])
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
 	t.Run("deleteOne", func(t *testing.T) {
 		idRow := mock.NewRows([]string{"_id"}).AddRow("{\"_id\": 123}")
 		row1 := sqlmock.NewRows([]string{"count"}).AddRow(1)
 		row2 := sqlmock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
-		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test' LIMIT 1").WillReturnRows(idRow)
-		mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\" WHERE \"_id\" = 123").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? LIMIT 1").WithArgs("test").WillReturnRows(idRow)
+		mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\" WHERE \"_id\" = ?").WithArgs(int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		deleteReq := types.MustMakeDocument(
 			"delete", "testCollection",
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgExplain returns how an aggregation pipeline is executed.
+// With the verbosity executionStats or allPlansExecution the pipeline is run to collect the statistics of each stage.
+func (h *storage) MsgExplain(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+	db := m["$db"].(string)
+
+	cmd, ok := m["explain"].(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "explain command requires a nested object")
+	}
+
+	verbosity := "allPlansExecution"
+	if v, ok := m["verbosity"]; ok {
+		verbosity, _ = v.(string)
+		switch verbosity {
+		case "queryPlanner", "executionStats", "allPlansExecution":
+		default:
+			return nil, common.NewErrorMessage(common.ErrBadValue, "verbosity string must be one of {'queryPlanner', 'executionStats', 'allPlansExecution'}")
+		}
+	}
+
+	if cmd.Command() != "aggregate" {
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "explain for %s is not implemented yet", cmd.Command())
+	}
+
+	p, err := h.newAggregatePipeline(db, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.explainReply(ctx, cmd, verbosity != "queryPlanner")
+}
+
+// explainReply returns the reply of explain for the pipeline of the command.
+func (p *pipeline) explainReply(ctx context.Context, cmd types.Document, execute bool) (*wire.OpMsg, error) {
+	stages, err := p.explain(ctx, execute)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"explainVersion", "1",
+			"stages", stages,
+			"command", cmd,
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// explain returns the stages of the pipeline. The first stage $cursor stands for the
+// leading $match stages pushed down to SAP HANA, the other stages are processed by the proxy
+// unless they are marked as pushed down, like a $group computed with GROUP BY.
+// With execute the pipeline is run and each stage contains the number of documents
+// it got and returned and the time spent in it.
+func (p *pipeline) explain(ctx context.Context, execute bool) (*types.Array, error) {
+	if execute && len(p.specs) > 0 {
+		if name := p.specs[len(p.specs)-1].Command(); name == "$out" || name == "$merge" {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "Explain of a pipeline with '%s' can only be performed in 'queryPlanner' mode", name)
+		}
+	}
+
+	query, _, err := p.cursorSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := p.filter
+	if filter.Map() == nil {
+		filter = types.MustMakeDocument()
+	}
+
+	cursor := types.MustMakeDocument(
+		"queryPlanner", types.MustMakeDocument(
+			"namespace", p.db+"."+p.collection,
+			"parsedQuery", filter,
+			"sql", query,
+		),
+		"pushedDown", true,
+	)
+
+	res := types.MakeArray(len(p.stages) + 1)
+
+	if !execute {
+		if err = res.Append(types.MustMakeDocument("$cursor", cursor)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		for i, spec := range p.specs {
+			name := spec.Command()
+			if err = res.Append(types.MustMakeDocument(name, spec.Map()[name], "pushedDown", i < p.pushed)); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		}
+		return res, nil
+	}
+
+	start := time.Now()
+	docs, err := p.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.Set("executionStats", types.MustMakeDocument(
+		"nReturned", int64(len(docs)),
+		"executionTimeMillis", time.Since(start).Milliseconds(),
+	))
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err = res.Append(types.MustMakeDocument("$cursor", cursor)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	for i, s := range p.stages {
+		name := p.specs[i].Command()
+
+		// the statistics of the stages pushed down are the ones of $cursor
+		if i < p.pushed {
+			if err = res.Append(types.MustMakeDocument(name, p.specs[i].Map()[name], "pushedDown", true)); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+			continue
+		}
+
+		nInput := len(docs)
+
+		start = time.Now()
+		if docs, err = s.process(ctx, docs); err != nil {
+			return nil, err
+		}
+
+		err = res.Append(types.MustMakeDocument(
+			name, p.specs[i].Map()[name],
+			"pushedDown", false,
+			"nInput", int64(nInput),
+			"nReturned", int64(len(docs)),
+			"executionTimeMillisEstimate", time.Since(start).Milliseconds(),
+		))
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return res, nil
+}
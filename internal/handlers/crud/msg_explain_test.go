@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgExplain(t *testing.T) {
+	ctx, storage, mock, err := setupTestUtil(t)
+	require.NoError(t, err)
+
+	// the compound _id is grouped by the proxy
+	pipeline := types.MustNewArray(
+		types.MustMakeDocument("$match", types.MustMakeDocument("status", "open")),
+		types.MustMakeDocument("$group", types.MustMakeDocument(
+			"_id", types.MustMakeDocument("customer", "$customer"),
+			"total", types.MustMakeDocument("$sum", "$amount"),
+		)),
+	)
+
+	explain := func(t *testing.T, req types.Document) (types.Document, error) {
+		var reqMsg wire.OpMsg
+		err := reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgExplain(ctx, &reqMsg)
+		if err != nil {
+			return types.Document{}, err
+		}
+
+		return msg.Document()
+	}
+
+	t.Run("executionStats", func(t *testing.T) {
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("sales").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("sales", "orders").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT * FROM \"sales\".\"orders\" WHERE \"status\" = ?").WithArgs("open").WillReturnRows(
+			sqlmock.NewRows([]string{"document"}).
+				AddRow([]byte(`{"_id": 1, "customer": 7, "amount": 10}`)).
+				AddRow([]byte(`{"_id": 2, "customer": 7, "amount": 5}`)).
+				AddRow([]byte(`{"_id": 3, "customer": 8, "amount": 1}`)),
+		)
+
+		actual, err := explain(t, types.MustMakeDocument(
+			"explain", types.MustMakeDocument("aggregate", "orders", "pipeline", pipeline),
+			"verbosity", "executionStats",
+			"$db", "sales",
+		))
+		require.NoError(t, err)
+
+		cursor, err := actual.GetByPath("stages", "0", "$cursor")
+		require.NoError(t, err)
+		assert.Equal(t, true, cursor.(types.Document).Map()["pushedDown"])
+
+		sql, err := actual.GetByPath("stages", "0", "$cursor", "queryPlanner", "sql")
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM \"sales\".\"orders\" WHERE \"status\" = ?", sql)
+
+		nReturned, err := actual.GetByPath("stages", "0", "$cursor", "executionStats", "nReturned")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), nReturned)
+
+		group, err := actual.GetByPath("stages", "1")
+		require.NoError(t, err)
+		m := group.(types.Document).Map()
+		assert.Equal(t, false, m["pushedDown"])
+		assert.Equal(t, int64(3), m["nInput"])
+		assert.Equal(t, int64(2), m["nReturned"])
+		assert.Contains(t, m, "executionTimeMillisEstimate")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("$group pushed down", func(t *testing.T) {
+		actual, err := explain(t, types.MustMakeDocument(
+			"explain", types.MustMakeDocument("aggregate", "orders", "pipeline", types.MustNewArray(
+				types.MustMakeDocument("$group", types.MustMakeDocument(
+					"_id", "$customer",
+					"total", types.MustMakeDocument("$sum", "$amount"),
+				)),
+			)),
+			"verbosity", "queryPlanner",
+			"$db", "sales",
+		))
+		require.NoError(t, err)
+
+		sql, err := actual.GetByPath("stages", "0", "$cursor", "queryPlanner", "sql")
+		require.NoError(t, err)
+		number := "BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308"
+		assert.Equal(t, "SELECT \"customer\" AS \"_id\", COALESCE(SUM(CASE WHEN \"amount\" "+number+" THEN \"amount\" END), 0) AS \"total\", "+
+			"CASE WHEN \"customer\" IS NULL OR \"customer\" IS UNSET OR \"customer\" "+number+" OR \"customer\" LIKE '%' THEN 1 ELSE 0 END "+
+			"FROM \"sales\".\"orders\" GROUP BY \"customer\"", sql)
+
+		pushedDown, err := actual.GetByPath("stages", "1", "pushedDown")
+		require.NoError(t, err)
+		assert.Equal(t, true, pushedDown)
+	})
+
+	t.Run("queryPlanner does not run the pipeline", func(t *testing.T) {
+		actual, err := explain(t, types.MustMakeDocument(
+			"explain", types.MustMakeDocument("aggregate", "orders", "pipeline", pipeline),
+			"verbosity", "queryPlanner",
+			"$db", "sales",
+		))
+		require.NoError(t, err)
+
+		stages, err := actual.Get("stages")
+		require.NoError(t, err)
+		assert.Equal(t, 2, stages.(*types.Array).Len())
+
+		_, err = actual.GetByPath("stages", "0", "$cursor", "executionStats")
+		assert.Error(t, err)
+	})
+
+	t.Run("$out only in queryPlanner mode", func(t *testing.T) {
+		_, err := explain(t, types.MustMakeDocument(
+			"explain", types.MustMakeDocument("aggregate", "orders", "pipeline", types.MustNewArray(
+				types.MustMakeDocument("$out", "copy"),
+			)),
+			"$db", "sales",
+		))
+		assert.EqualError(t, err, "BadValue (2): Explain of a pipeline with '$out' can only be performed in 'queryPlanner' mode")
+	})
+
+	t.Run("find is not implemented", func(t *testing.T) {
+		_, err := explain(t, types.MustMakeDocument(
+			"explain", types.MustMakeDocument("find", "orders"),
+			"$db", "sales",
+		))
+		assert.EqualError(t, err, "NotImplemented (238): explain for find is not implemented yet")
+	})
+}
@@ -24,8 +24,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
@@ -34,33 +37,49 @@ import (
 )
 
 type locatCtx struct {
-	exclusion  bool
 	filter     types.Document
 	db         string
 	collection string
 	count      bool
+
+	// default collation of the collection, which orders find without a collation
+	defaultCollation *common.Collation
+
+	// collation of the sort, nil without one
+	sortCollation *common.Collation
+
+	// the read documents are sorted in Go instead of SAP HANA if the sort has a collation,
+	// sortLess compares the documents by the sort then
+	sortInGo bool
+	sortLess func(a, b *readDocument) bool
+
+	// skip and limit of find or count, 0 if not given
+	skip  int64
+	limit int64
+
+	// WITH HINT clause of the hint
+	hint string
+
+	// projection of returnKey, empty if not given
+	returnKey types.Document
+
+	// projection of find, which is applied to the read documents if postProjection is set,
+	// for exclusions and inclusions of embedded fields
+	projection     types.Document
+	postProjection bool
+
+	// top-level fields excluded by the projection, which are not decoded from the read documents
+	omit []string
 }
 
 // MsgFindOrCount finds documents in a collection or view and returns a cursor to the selected documents
 // or count the number of documents that matches the query filter.
 func (h *storage) MsgFindOrCount(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
 	unimplementedFields := []string{
-		"skip",
-		"returnKey",
 		"showRecordId",
-		"tailable",
 		"oplogReplay",
-		"noCursorTimeout",
-		"awaitData",
 		"allowPartialResults",
-		"collation",
-		"let",
-		"hint",
-		"maxTimeMS",
 		"readConcern",
-		"max",
-		"min",
-		"comment",
 	}
 
 	document, err := msg.Document()
@@ -71,19 +90,35 @@ func (h *storage) MsgFindOrCount(ctx context.Context, msg *wire.OpMsg) (*wire.Op
 		return nil, err
 	}
 
-	common.Ignored(&document, h.l, "singleBatch", "allowDiskUse", "batchSize")
+	common.Ignored(&document, h.l, "allowDiskUse")
 
 	docMap := document.Map()
 	if isPrintShardingStatus(docMap) {
 		return nil, common.NewErrorMessage(common.ErrCommandNotFound, "no such command: printShardingStatus")
 	}
 
+	opts := &findOptions{batchSize: noBatchSize}
+	if _, ok := docMap["find"]; ok {
+		if opts, err = parseFindOptions(docMap); err != nil {
+			return nil, err
+		}
+	}
+
 	var localCtx locatCtx
 	// localCtx.db = docMap["$db"].(string)
 	if err = localCtx.setDBAndCollection(docMap); err != nil {
 		return nil, err
 	}
 
+	if localCtx.skip, localCtx.limit, err = parseSkipLimit(docMap, localCtx.count); err != nil {
+		return nil, err
+	}
+
+	// system collections read by tools are empty, like collections which do not exist
+	if isEmptySystemCollection(localCtx.collection) {
+		return namespaceNotExisting(&localCtx)
+	}
+
 	// If namespace does not exist return 0 for count or nothing for find
 	if namespaceExists, err := h.hanaPool.NamespaceExists(ctx, localCtx.db, localCtx.collection); err == nil {
 		if !namespaceExists {
@@ -93,7 +128,27 @@ func (h *storage) MsgFindOrCount(ctx context.Context, msg *wire.OpMsg) (*wire.Op
 		return nil, err
 	}
 
-	sql, err := createSqlStmt(docMap, &localCtx)
+	// a sort without collation uses the default collation of the collection,
+	// and a hint must be of an index of the collection, whose keys are returned by returnKey
+	sort, _ := docMap["sort"].(types.Document)
+	sorted := !localCtx.count && len(sort.Keys()) > 0 && docMap["collation"] == nil
+	collOpts := new(hana.CollectionOptions)
+	if sorted || docMap["hint"] != nil {
+		if collOpts, err = h.hanaPool.CollectionOptions(ctx, localCtx.db, localCtx.collection); err != nil {
+			return nil, err
+		}
+		localCtx.defaultCollation = common.CollationFromOptions(collOpts.Collation)
+
+		if localCtx.hint, err = common.HintSQL(docMap["hint"], collOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.returnKey {
+		localCtx.returnKey = common.ReturnKeyProjection(docMap["hint"], collOpts)
+	}
+
+	sql, args, err := createSqlStmt(docMap, &localCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -101,23 +156,7 @@ func (h *storage) MsgFindOrCount(ctx context.Context, msg *wire.OpMsg) (*wire.Op
 	// A workaround which allows connecting and using the basics of some GUI's
 	// TODO: Implement this for real.
 	if collection, ok := docMap["find"].(string); ok {
-		if collection == "system.js" {
-			resp := &wire.OpMsg{}
-			err = resp.SetSections(wire.OpMsgSection{
-				Documents: []types.Document{types.MustMakeDocument(
-					"cursor", types.MustMakeDocument(
-						"firstBatch", types.MustMakeDocument(),
-						"id", int64(0), // TODO
-						"ns", localCtx.db+"."+collection,
-					),
-					"ok", float64(1),
-				)},
-			})
-			if err != nil {
-				return nil, err
-			}
-			return resp, nil
-		} else if localCtx.collection == "system.version" {
+		if localCtx.collection == "system.version" {
 			resp := &wire.OpMsg{}
 			err = resp.SetSections(wire.OpMsgSection{
 				Documents: []types.Document{types.MustMakeDocument(
@@ -139,37 +178,181 @@ func (h *storage) MsgFindOrCount(ctx context.Context, msg *wire.OpMsg) (*wire.Op
 		}
 	}
 
-	rows, err := h.hanaPool.QueryContext(ctx, sql)
+	if localCtx.count {
+		rows, err := h.hanaPool.QueryContext(ctx, sql, args...)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		return createCountResponse(rows, &localCtx)
+	}
+
+	var c *cursor
+	switch {
+	case isPointRead(localCtx.filter) && !hana.InTransaction(ctx):
+		// identical concurrent reads by _id are coalesced, except in transactions which may see their own writes
+		// reads are identical if their statements and the values of its parameters are
+		query := func(ctx context.Context) ([][]byte, error) { return h.queryRows(ctx, sql, args...) }
+		rows, err := h.coalescer.query(ctx, fmt.Sprintf("%s %#v", sql, args), query)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = h.readCursor(ctx, rows, &localCtx); err != nil {
+			return nil, err
+		}
+
+	case hana.InTransaction(ctx) || h.quotasActive() || localCtx.sortInGo:
+		// the whole result is read at once if quotas check it, if it is sorted in Go,
+		// or in a transaction, whose connection cannot be kept by the cursor;
+		// unless the documents are skipped and limited in Go, reading stops as soon as they exceed the documents quota
+		var quota int64
+		var quotaRole string
+		if !localCtx.sortInGo {
+			if quota, quotaRole, err = h.documentsQuota(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		rows, err := h.queryRowsLimit(ctx, quota, sql, args...)
+		if err != nil {
+			return nil, err
+		}
+		if quota > 0 && int64(len(rows)) > quota {
+			return nil, errDocumentsQuota(quota, quotaRole)
+		}
+		if c, err = h.readCursor(ctx, rows, &localCtx); err != nil {
+			return nil, err
+		}
+
+	default:
+		// the cursor reads the documents while the client fetches them, also after find returned
+		queryCtx, stop, cancel := detachContext(ctx)
+		defer stop()
+
+		rows, err := h.hanaPool.QueryContext(queryCtx, sql, args...)
+		if err != nil {
+			cancel()
+			return nil, lazyerrors.Error(err)
+		}
+
+		c = newCursor(localCtx.db+"."+localCtx.collection, nil, nil, newCursorSource(rows, cancel, localCtx.omit, localCtx.projectFunc()))
+	}
+
+	c.noTimeout = opts.noCursorTimeout
+	c.owner = hana.User(ctx)
+	c.conn = h
+
+	return h.createFindResponse(c, opts)
+}
+
+// detachContext returns a context which is canceled with ctx until stop is called, and afterwards only by cancel.
+// Cursors read their query with it after the command which opened them returned.
+// It keeps the comment of ctx for the query.
+func detachContext(ctx context.Context) (detached context.Context, stop func(), cancel context.CancelFunc) {
+	detached, cancel = context.WithCancel(hana.WithComment(context.Background(), hana.Comment(ctx)))
+
+	stopped := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-stopped:
+		}
+	}()
+
+	return detached, func() { close(stopped) }, cancel
+}
+
+// queryRows returns the documents selected by the query with the arguments as JSON.
+func (h *storage) queryRows(ctx context.Context, sql string, args ...any) ([][]byte, error) {
+	return h.queryRowsLimit(ctx, 0, sql, args...)
+}
+
+// queryRowsLimit returns the documents selected by the query with the arguments as JSON,
+// but stops reading after limit+1 documents, so that exceeding the limit is detected without reading the rest.
+// A zero limit reads all documents.
+func (h *storage) queryRowsLimit(ctx context.Context, limit int64, sql string, args ...any) ([][]byte, error) {
+	rows, err := h.hanaPool.QueryContext(ctx, sql, args...)
 	if err != nil {
 		return nil, lazyerrors.Error(err)
 	}
+	defer rows.Close()
+
+	var res [][]byte
+	for limit <= 0 || int64(len(res)) <= limit {
+		b, err := nextRowBytes(rows)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			break
+		}
+		res = append(res, b)
+	}
 
-	return createResponse(docMap, rows, &localCtx)
+	return res, nil
 }
 
-func createSqlStmt(docMap map[string]any, ctx *locatCtx) (sql string, err error) {
-	sql, err = createSqlBaseStmt(docMap, ctx)
+// createSqlStmt returns the statement of find or count and the values of its parameters.
+func createSqlStmt(docMap map[string]any, ctx *locatCtx) (sql string, args []any, err error) {
+	collation, err := common.ParseCollation(docMap["collation"])
 	if err != nil {
 		return
 	}
 
-	whereStmt, err := common.CreateWhereClause(ctx.filter)
+	// SAP HANA has no collations for the values of JSON documents, so documents are sorted with a collation in Go
+	sort, _ := docMap["sort"].(types.Document)
+	if !ctx.count && len(sort.Keys()) > 0 {
+		ctx.sortCollation = collation
+		if docMap["collation"] == nil {
+			ctx.sortCollation = ctx.defaultCollation
+		}
+
+		// the text score is not available, as $text is not supported
+		if err = checkNoTextScore(sort); err != nil {
+			return
+		}
+		ctx.sortInGo = ctx.sortCollation != nil
+	}
+
+	sql, err = createSqlBaseStmt(docMap, ctx)
 	if err != nil {
 		return
 	}
-	sql += whereStmt
 
-	orderBystmt, err := createOrderByStmt(docMap)
-	if err != nil {
+	// the variables of let are replaced by their values in $expr
+	if ctx.filter, err = common.ApplyLet(ctx.filter, docMap["let"]); err != nil {
 		return
 	}
-	sql += orderBystmt
 
-	limitStmt, err := createLimitStmt(docMap)
+	var placeholder common.Placeholder
+	whereStmt, err := common.CreateCollatedWhereClause(ctx.filter, collation, &placeholder)
 	if err != nil {
 		return
 	}
-	sql += limitStmt
+	sql += whereStmt
+
+	var orderBystmt string
+	if ctx.sortInGo {
+		if ctx.sortLess, err = goSortLess(sort, ctx.sortCollation); err != nil {
+			return
+		}
+	} else if orderBystmt, err = createOrderByStmt(docMap); err != nil {
+		return
+	}
+
+	// documents matched by $near are sorted by distance if no other sort is given
+	if len(sort.Keys()) == 0 && !ctx.count {
+		orderBystmt, err = common.NearOrderBy(ctx.filter)
+		if err != nil {
+			return
+		}
+	}
+	sql += orderBystmt
+
+	sql += createLimitStmt(ctx)
+	sql += ctx.hint
+	args = placeholder.Args()
 
 	return
 }
@@ -180,12 +363,28 @@ func createSqlBaseStmt(docMap map[string]any, ctx *locatCtx) (sql string, err er
 	if isFindOp { // enters here if find
 		var projectionSQL string
 
-		projectionIn, _ := docMap["projection"].(types.Document)
-		projectionSQL, ctx.exclusion, err = common.Projection(projectionIn)
+		ctx.projection, _ = docMap["projection"].(types.Document)
+		if len(ctx.returnKey.Keys()) > 0 {
+			ctx.projection = ctx.returnKey
+		}
+		if err = checkNoTextScore(ctx.projection); err != nil {
+			return
+		}
+		projectionSQL, ctx.postProjection, err = common.Projection(ctx.projection)
 		if err != nil {
 			return
 		}
 
+		// a sort in Go compares the fields of the sort, so the documents are projected after retrieval
+		if ctx.sortInGo {
+			projectionSQL = "*"
+			ctx.postProjection = len(ctx.projection.Keys()) > 0
+		} else if ctx.postProjection {
+			if ctx.omit, err = common.ExcludedFields(ctx.projection); err != nil {
+				return
+			}
+		}
+
 		ctx.collection = docMap["find"].(string)
 		ctx.filter, _ = docMap["filter"].(types.Document)
 		sql = fmt.Sprintf("SELECT %s FROM \"%s\".\"%s\"", projectionSQL, ctx.db, ctx.collection)
@@ -197,6 +396,7 @@ func createSqlBaseStmt(docMap map[string]any, ctx *locatCtx) (sql string, err er
 	return
 }
 
+// createOrderByStmt returns the ORDER BY of the sort of find.
 func createOrderByStmt(docMap map[string]any) (sql string, err error) {
 	sort, _ := docMap["sort"].(types.Document)
 	sortMap := sort.Map()
@@ -208,111 +408,309 @@ func createOrderByStmt(docMap map[string]any) (sql string, err error) {
 				sql += ","
 			}
 
-			if strings.Contains(sortKey, ".") {
-				split := strings.Split(sortKey, ".")
-				sql += " "
-				for j, s := range split {
-					if (len(split) - 1) == j {
-						sql += "\"" + s + "\""
-					} else {
-						sql += "\"" + s + "\"."
-					}
+			var kSQL string
+			split := strings.Split(sortKey, ".")
+			for j, s := range split {
+				if (len(split) - 1) == j {
+					kSQL += "\"" + s + "\""
+				} else {
+					kSQL += "\"" + s + "\"."
 				}
-			} else {
-				sql += "\"" + sortKey + "\" "
 			}
 
-			order, ok := sortMap[sortKey].(int32)
-			if !ok {
-				if !anyIsInt(sortMap[sortKey]) {
-					err = common.NewErrorMessage(common.ErrSortBadValue, "cannot use type %T for sort", sortMap[sortKey])
-					return
-				}
-				order = int32(sortMap[sortKey].(float64))
-			}
-			if order == 1 {
-				sql += " ASC"
-			} else if order == -1 {
-				sql += " DESC"
-			} else {
-				err = common.NewErrorMessage(common.ErrSortBadValue, "cannot use value %s for sort", sortMap[sortKey])
+			var direction string
+			if direction, err = sortDirection(sortMap[sortKey]); err != nil {
+				return
 			}
+			sql += common.OrderBySQL(kSQL, direction)
 		}
 	}
 	return
 }
 
-func createLimitStmt(docMap map[string]any) (sql string, err error) {
-	limit, _ := docMap["limit"].(int32)
-	switch {
-	case limit == 0:
-		// undefined or zero - no limit
-	case limit > 0:
-		sql += fmt.Sprintf(" LIMIT %d ", limit)
-	default:
-		err = common.NewErrorMessage(common.ErrNotImplemented, "MsgFind: negative limit values are not supported")
+// checkNoTextScore returns Location40218 if the sort or projection of find has a field of {$meta: "textScore"},
+// as the text score of $text is not available.
+func checkNoTextScore(doc types.Document) error {
+	for _, key := range doc.Keys() {
+		meta, err := common.IsTextScoreMeta(doc.Map()[key])
+		if err != nil {
+			return err
+		}
+		if meta {
+			return common.NewErrorMessage(common.ErrTextScoreNotAvailable, "query requires text score metadata, but it is not available")
+		}
 	}
-	return
+
+	return nil
 }
 
-func createResponse(docMap map[string]any, rows *sql.Rows, localCtx *locatCtx) (resp *wire.OpMsg, err error) {
-	resp = &wire.OpMsg{}
-	_, isFindOp := docMap["find"].(string)
-	defer rows.Close()
-	if isFindOp { //nolint:nestif // FIXME: I have no idead to fix this lint
-		var docs types.Array
-		var aDoc *types.Document
+// goSortLess returns the function comparing read documents by the sort of find with the collation,
+// which compares strings by the rules of its locale, or like SAP HANA if it is nil. Missing fields are compared as null.
+func goSortLess(sort types.Document, collation *common.Collation) (func(a, b *readDocument) bool, error) {
+	keys := sort.Keys()
 
-		for {
-			aDoc, err = nextRow(rows)
-			if err != nil {
-				return nil, lazyerrors.Error(err)
-			} else if aDoc == nil {
-				break
+	// 1 or -1 for ascending or descending fields
+	orders := make([]int, len(keys))
+	for i, key := range keys {
+		direction, err := sortDirection(sort.Map()[key])
+		if err != nil {
+			return nil, err
+		}
+		orders[i] = 1
+		if direction == "DESC" {
+			orders[i] = -1
+		}
+	}
+
+	return func(a, b *readDocument) bool {
+		for i, key := range keys {
+			av, _ := a.doc.GetByPath(strings.Split(key, ".")...)
+			bv, _ := b.doc.GetByPath(strings.Split(key, ".")...)
+
+			var c int
+			if collation == nil {
+				c = orders[i] * types.Compare(av, bv)
+			} else {
+				c = orders[i] * collation.Compare(av, bv)
 			}
 
-			if err = docs.Append(*aDoc); err != nil {
-				return nil, lazyerrors.Error(err)
+			if c != 0 {
+				return c < 0
 			}
 		}
 
-		if localCtx.exclusion {
-			err = common.ProjectDocuments(&docs, docMap["projection"].(types.Document))
-			if err != nil {
-				return nil, lazyerrors.Error(err)
+		return false
+	}, nil
+}
+
+// sortDirection returns the SQL direction ASC or DESC of the sort order 1 or -1 of a field.
+func sortDirection(value any) (string, error) {
+	order, ok := value.(int32)
+	if !ok {
+		if !anyIsInt(value) {
+			return "", common.NewErrorMessage(common.ErrSortBadValue, "cannot use type %T for sort", value)
+		}
+		order = int32(value.(float64))
+	}
+
+	switch order {
+	case 1:
+		return "ASC", nil
+	case -1:
+		return "DESC", nil
+	default:
+		return "", common.NewErrorMessage(common.ErrSortBadValue, "cannot use value %v for sort", value)
+	}
+}
+
+// noLimit is the LIMIT of a find with only skip, as SAP HANA only supports OFFSET after LIMIT.
+const noLimit = math.MaxInt32
+
+// parseSkipLimit returns the validated skip and limit of find or count.
+// A negative limit of count counts the same documents as the positive one, like in MongoDB.
+func parseSkipLimit(docMap map[string]any, count bool) (skip, limit int64, err error) {
+	for _, name := range []string{"skip", "limit"} {
+		var v int64
+		switch value := docMap[name].(type) {
+		case nil:
+		case int32:
+			v = int64(value)
+		case int64:
+			v = value
+		case float64:
+			if value != math.Trunc(value) || value < math.MinInt64 || value > math.MaxInt64 {
+				return 0, 0, common.NewErrorMessage(common.ErrBadValue, "Field '%s' must be an integer, but received: %v", name, value)
 			}
+			v = int64(value)
+		default:
+			return 0, 0, common.NewErrorMessage(common.ErrTypeMismatch, "Field '%s' must be a number", name)
 		}
 
-		err = resp.SetSections(wire.OpMsgSection{
-			Documents: []types.Document{types.MustMakeDocument(
-				"cursor", types.MustMakeDocument(
-					"firstBatch", &docs,
-					"id", int64(0), // TODO
-					"ns", localCtx.db+"."+localCtx.collection,
-				),
-				"ok", float64(1),
-			)},
-		})
+		switch {
+		case v >= 0:
+		case name == "limit" && count:
+			v = -v
+		default:
+			return 0, 0, common.NewErrorMessage(
+				common.ErrBadValue, "%s value must be non-negative, but received: %d", strings.ToUpper(name[:1])+name[1:], v,
+			)
+		}
+
+		if name == "skip" {
+			skip = v
+		} else {
+			limit = v
+		}
+	}
+
+	return skip, limit, nil
+}
+
+// createLimitStmt returns the LIMIT and OFFSET of the skip and limit of find,
+// so that SAP HANA only returns the requested documents instead of the whole collection.
+// The skip and limit of count are applied to the count of all matched documents instead,
+// and the ones of find sorted in Go to the sorted documents.
+func createLimitStmt(ctx *locatCtx) string {
+	if ctx.count || ctx.sortInGo {
+		return ""
+	}
+
+	switch {
+	case ctx.limit > 0 && ctx.skip > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d ", ctx.limit, ctx.skip)
+	case ctx.limit > 0:
+		return fmt.Sprintf(" LIMIT %d ", ctx.limit)
+	case ctx.skip > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d ", noLimit, ctx.skip)
+	default:
+		return ""
+	}
+}
+
+// readDocument is a document read as JSON with its size in bytes.
+type readDocument struct {
+	doc  types.Document
+	size int
+}
+
+// readCursor returns a cursor over the documents read as JSON, which are checked by the quotas.
+func (h *storage) readCursor(ctx context.Context, rows [][]byte, localCtx *locatCtx) (*cursor, error) {
+	read := make([]readDocument, len(rows))
+	for i, b := range rows {
+		doc, err := decodeRow(b, localCtx.omit...)
 		if err != nil {
+			return nil, err
+		}
+
+		read[i] = readDocument{doc: *doc, size: len(b)}
+	}
+
+	if localCtx.sortLess != nil {
+		read = localCtx.sortDocuments(read)
+	}
+
+	var docs types.Array
+	sizes := make([]int, len(read))
+	for i, r := range read {
+		if err := docs.Append(r.doc); err != nil {
 			return nil, lazyerrors.Error(err)
 		}
-	} else {
-		var count int32
-		for rows.Next() {
-			err = rows.Scan(&count)
-			if err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+		sizes[i] = r.size
+	}
+
+	if localCtx.postProjection {
+		if err := common.ProjectDocuments(&docs, localCtx.projection); err != nil {
+			return nil, lazyerrors.Error(err)
 		}
+	}
 
-		err = resp.SetSections(wire.OpMsgSection{
-			Documents: []types.Document{types.MustMakeDocument(
-				"n", count,
-				"ok", float64(1),
-			)},
-		})
+	cursorDocs := make([]types.Document, docs.Len())
+	for i := range cursorDocs {
+		doc, _ := docs.Get(i)
+		cursorDocs[i] = doc.(types.Document)
 	}
-	return
+	if err := h.checkQuotas(ctx, cursorDocs); err != nil {
+		return nil, err
+	}
+
+	return newCursor(localCtx.db+"."+localCtx.collection, cursorDocs, sizes, nil), nil
+}
+
+// sortDocuments sorts the read documents by the sort in Go,
+// and then skips and limits them like SAP HANA does for other sorts.
+func (ctx *locatCtx) sortDocuments(docs []readDocument) []readDocument {
+	sort.SliceStable(docs, func(i, j int) bool { return ctx.sortLess(&docs[i], &docs[j]) })
+
+	start, end := int64(len(docs)), int64(len(docs))
+	if ctx.skip < start {
+		start = ctx.skip
+	}
+	if ctx.limit > 0 && start+ctx.limit < end {
+		end = start + ctx.limit
+	}
+
+	return docs[start:end]
+}
+
+// projectFunc returns the function applying the projection to the read documents if it is not computed by SAP HANA.
+// It is nil if the read documents are returned as they are.
+func (ctx *locatCtx) projectFunc() func(docs *types.Array) error {
+	if !ctx.postProjection {
+		return nil
+	}
+
+	return func(docs *types.Array) error {
+		return common.ProjectDocuments(docs, ctx.projection)
+	}
+}
+
+// createFindResponse returns the first batch of the cursor, which is kept for getMore if it has more documents,
+// unless singleBatch is set.
+func (h *storage) createFindResponse(c *cursor, opts *findOptions) (*wire.OpMsg, error) {
+	firstBatch, err := c.firstBatch(opts.batchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.singleBatch:
+		// the remaining documents are not read, so that no cursor is left open on the server
+		c.close()
+	case !c.exhausted():
+		h.cursors.add(c)
+	}
+
+	resp := &wire.OpMsg{}
+	err = resp.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", batchArray(firstBatch),
+				"id", c.id,
+				"ns", c.ns,
+			),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return resp, nil
+}
+
+// createCountResponse returns the count selected by the query, after skip and limit of count.
+func createCountResponse(rows *sql.Rows, ctx *locatCtx) (*wire.OpMsg, error) {
+	defer rows.Close()
+
+	var count int32
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	// the count of the matched documents after skip, at most limit
+	if int64(count) <= ctx.skip {
+		count = 0
+	} else {
+		count -= int32(ctx.skip)
+	}
+	if ctx.limit > 0 && int64(count) > ctx.limit {
+		count = int32(ctx.limit)
+	}
+
+	resp := &wire.OpMsg{}
+	err := resp.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"n", count,
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return resp, nil
 }
 
 func namespaceNotExisting(localCtx *locatCtx) (*wire.OpMsg, error) {
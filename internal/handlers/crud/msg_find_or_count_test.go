@@ -21,8 +21,8 @@ func TestMsgFindOrCound(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
 		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\"").WillReturnRows(docRow)
 
 		deleteReq := types.MustMakeDocument(
@@ -62,13 +62,101 @@ func TestMsgFindOrCound(t *testing.T) {
 		}
 	})
 
+	t.Run("find and count system collections", func(t *testing.T) {
+		for _, command := range []string{"find", "count"} {
+			for _, collection := range []string{"system.views", "system.js"} {
+				var reqMsg wire.OpMsg
+				err = reqMsg.SetSections(wire.OpMsgSection{
+					Documents: []types.Document{types.MustMakeDocument(
+						command, collection,
+						"$db", "testDatabase",
+					)},
+				})
+				require.NoError(t, err)
+
+				msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+				require.NoError(t, err)
+
+				expected := types.MustMakeDocument(
+					"cursor", types.MustMakeDocument(
+						"firstBatch", types.MustNewArray(),
+						"id", int64(0),
+						"ns", "testDatabase."+collection,
+					),
+					"ok", float64(1),
+				)
+				if command == "count" {
+					expected = types.MustMakeDocument("n", int32(0), "ok", float64(1))
+				}
+
+				actual, err := msg.Document()
+				require.NoError(t, err)
+				assert.Equal(t, expected, actual)
+			}
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find single batch", func(t *testing.T) {
+		docRows := mock.NewRows([]string{"document"}).
+			AddRow([]byte(`{"_id": 1}`)).
+			AddRow([]byte(`{"_id": 2}`)).
+			AddRow([]byte(`{"_id": 3}`))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\"").WillReturnRows(docRows).RowsWillBeClosed()
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"filter", types.MustMakeDocument(),
+			"batchSize", int32(2),
+			"singleBatch", true,
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		// the cursor is closed after the first batch
+		expected := types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", types.MustNewArray(
+					types.MustMakeDocument("_id", int32(1)),
+					types.MustMakeDocument("_id", int32(2)),
+				),
+				"id", int64(0),
+				"ns", "testDatabase.testCollection",
+			),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
 	t.Run("count", func(t *testing.T) {
 		countRow := mock.NewRows([]string{"count"}).AddRow(3)
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
 		mock.ExpectQuery("SELECT COUNT(*) FROM \"testDatabase\".\"testCollection\"").WillReturnRows(countRow)
 
 		deleteReq := types.MustMakeDocument(
@@ -99,14 +187,50 @@ func TestMsgFindOrCound(t *testing.T) {
 		}
 	})
 
+	t.Run("count with skip and limit", func(t *testing.T) {
+		countRow := mock.NewRows([]string{"count"}).AddRow(10)
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"testDatabase\".\"testCollection\"").WillReturnRows(countRow)
+
+		countReq := types.MustMakeDocument(
+			"count", "testCollection",
+			"query", types.MustMakeDocument(),
+			"skip", int32(7),
+			"limit", int64(-2),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{countReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, types.MustMakeDocument("n", int32(2), "ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
 	t.Run("find documents with where, order by, limit, and projection", func(t *testing.T) {
 		idRow := mock.NewRows([]string{"document"}).AddRow([]byte{123, 34, 95, 105, 100, 34, 58, 32, 49, 50, 51, 125})
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
-		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test' ORDER BY  \"phone\".\"number\" ASC LIMIT 1").WillReturnRows(idRow)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(mock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? ORDER BY \"phone\".\"number\".\"$da\" ASC NULLS FIRST, \"phone\".\"number\" ASC LIMIT 1").WithArgs("test").WillReturnRows(idRow)
 
 		deleteReq := types.MustMakeDocument(
 			"find", "testCollection",
@@ -152,4 +276,311 @@ func TestMsgFindOrCound(t *testing.T) {
 			t.Errorf("there were unfulfilled expectations: %s", err)
 		}
 	})
+
+	t.Run("find documents with case-insensitive collation", func(t *testing.T) {
+		idRow := mock.NewRows([]string{"document"}).
+			AddRow([]byte(`{"_id": 1, "name": "b"}`)).
+			AddRow([]byte(`{"_id": 2, "name": "A"}`)).
+			AddRow([]byte(`{"_id": 3, "name": "a"}`))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE UPPER(\"item\") = UPPER(?)").WithArgs("test").WillReturnRows(idRow)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"filter", types.MustMakeDocument(
+				"item", "test",
+			),
+			"sort", types.MustMakeDocument(
+				"name", int32(1),
+			),
+			"collation", types.MustMakeDocument(
+				"locale", "en",
+				"strength", int32(2),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		// the documents are sorted with the collation after they are read
+		expected := types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", types.MustNewArray(
+					types.MustMakeDocument("_id", int32(2), "name", "A"),
+					types.MustMakeDocument("_id", int32(3), "name", "a"),
+					types.MustMakeDocument("_id", int32(1), "name", "b"),
+				),
+				"id", int64(0),
+				"ns", "testDatabase.testCollection",
+			),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find documents sorted by the default collation of the collection", func(t *testing.T) {
+		idRow := mock.NewRows([]string{"document"}).
+			AddRow([]byte(`{"_id": 1, "name": "Birne"}`)).
+			AddRow([]byte(`{"_id": 2, "name": "Äpfel"}`)).
+			AddRow([]byte(`{"_id": 3, "name": "Apfel"}`))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(mock.NewRows([]string{"comments"}).AddRow(`{"collation":{"locale":"de_AT"}}`))
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\"").WillReturnRows(idRow)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"sort", types.MustMakeDocument(
+				"name", int32(1),
+			),
+			"projection", types.MustMakeDocument(
+				"name", int32(0),
+			),
+			"limit", int32(2),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		// the limit and projection are applied after sorting in German
+		actual, _ := msg.Document()
+		firstBatch := actual.Map()["cursor"].(types.Document).Map()["firstBatch"].(*types.Array)
+		assert.Equal(t, types.MustNewArray(types.MustMakeDocument("_id", int32(3)), types.MustMakeDocument("_id", int32(2))), firstBatch)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find documents with hint", func(t *testing.T) {
+		idRow := mock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 123}`))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(mock.NewRows([]string{"comments"}).AddRow(`{}`))
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" LIMIT 1  WITH HINT(INDEX_SEARCH)").WillReturnRows(idRow)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"limit", int32(1),
+			"hint", "_id_",
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		_, err = storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").
+			WillReturnRows(mock.NewRows([]string{"comments"}).AddRow(`{}`))
+
+		require.NoError(t, findReq.Set("hint", "name_1"))
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		_, err = storage.MsgFindOrCount(ctx, &reqMsg)
+		require.EqualError(t, err, "BadValue (2): hint provided does not correspond to an existing index")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find documents with returnKey", func(t *testing.T) {
+		idRow := mock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 123}`))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"name\" = ?").WithArgs("test").WillReturnRows(idRow)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"filter", types.MustMakeDocument("name", "test"),
+			"projection", types.MustMakeDocument("name", int32(1)),
+			"returnKey", true,
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgFindOrCount(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		actual, _ := msg.Document()
+		firstBatch := actual.Map()["cursor"].(types.Document).Map()["firstBatch"].(*types.Array)
+		assert.Equal(t, 1, firstBatch.Len())
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find documents with $text", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"filter", types.MustMakeDocument(
+				"$text", types.MustMakeDocument("$search", "coffee"),
+				"price", types.MustMakeDocument("$lt", int32(5)),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		_, err = storage.MsgFindOrCount(ctx, &reqMsg)
+		require.EqualError(t, err, "NotImplemented (238): $text is not supported, as SAP HANA JSON Document Store has no full-text indexes")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find text score without $text", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		findReq := types.MustMakeDocument(
+			"find", "testCollection",
+			"projection", types.MustMakeDocument("score", types.MustMakeDocument("$meta", "textScore")),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{findReq},
+		})
+		require.NoError(t, err)
+
+		_, err = storage.MsgFindOrCount(ctx, &reqMsg)
+		require.EqualError(t, err, "Location40218 (40218): query requires text score metadata, but it is not available")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+func TestSkipLimit(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		docMap   map[string]any
+		count    bool
+		expected string
+		err      string
+	}{
+		"None": {
+			docMap:   map[string]any{},
+			expected: "",
+		},
+		"Limit": {
+			docMap:   map[string]any{"limit": int32(5)},
+			expected: " LIMIT 5 ",
+		},
+		"SkipAndLimit": {
+			docMap:   map[string]any{"skip": int64(20), "limit": float64(10)},
+			expected: " LIMIT 10 OFFSET 20 ",
+		},
+		"Skip": {
+			docMap:   map[string]any{"skip": int32(20)},
+			expected: " LIMIT 2147483647 OFFSET 20 ",
+		},
+		"Count": {
+			docMap:   map[string]any{"skip": int32(20), "limit": int32(-10)},
+			count:    true,
+			expected: "",
+		},
+		"NegativeLimit": {
+			docMap: map[string]any{"limit": int32(-1)},
+			err:    "BadValue (2): Limit value must be non-negative, but received: -1",
+		},
+		"NegativeSkip": {
+			docMap: map[string]any{"skip": int32(-1)},
+			count:  true,
+			err:    "BadValue (2): Skip value must be non-negative, but received: -1",
+		},
+		"Fraction": {
+			docMap: map[string]any{"skip": 1.5},
+			err:    "BadValue (2): Field 'skip' must be an integer, but received: 1.5",
+		},
+		"String": {
+			docMap: map[string]any{"limit": "1"},
+			err:    "TypeMismatch (14): Field 'limit' must be a number",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := locatCtx{count: tc.count}
+			var err error
+			ctx.skip, ctx.limit, err = parseSkipLimit(tc.docMap, tc.count)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, createLimitStmt(&ctx))
+		})
+	}
 }
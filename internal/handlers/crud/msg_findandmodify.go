@@ -30,6 +30,10 @@ type findAndModifyParams struct {
 	upsert     bool
 	upsertDoc  *types.Document
 	docID      any
+	found      *types.Document
+
+	// lock reads the document FOR UPDATE, as array updates are computed from it
+	lock bool
 }
 
 func (h *storage) MsgFindAndModify(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
@@ -40,9 +44,7 @@ func (h *storage) MsgFindAndModify(ctx context.Context, msg *wire.OpMsg) (*wire.
 
 	unimplementedFields := []string{
 		"arrayFilter",
-		"commented",
 		"let",
-		"maxTimeMS",
 	}
 	if err := common.Unimplemented(&document, unimplementedFields...); err != nil {
 		return nil, err
@@ -51,7 +53,6 @@ func (h *storage) MsgFindAndModify(ctx context.Context, msg *wire.OpMsg) (*wire.
 	ignoredFields := []string{
 		"fields",
 		"bypassDocumentValidation",
-		"writeConcern",
 		"collation",
 		"hint",
 	}
@@ -63,25 +64,53 @@ func (h *storage) MsgFindAndModify(ctx context.Context, msg *wire.OpMsg) (*wire.
 		return nil, err
 	}
 
-	doc, err := findDocument(ctx, &params, h.hanaPool)
+	if params.update != nil {
+		if err = h.keys.ValidateUpdate(*params.update); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel, err := h.prepareWrite(ctx, &document, params.db, params.collection)
 	if err != nil {
 		return nil, err
 	}
+	defer cancel()
 
-	resp := &wire.OpMsg{}
-	if doc != nil || params.upsert {
-		err = modifyDocument(ctx, &params, h.hanaPool)
-		if err != nil {
-			return nil, err
+	var doc *types.Document
+	var modified bool
+	findAndModify := func(ctx context.Context) error {
+		var err error
+		if doc, err = findDocument(ctx, &params, h.hanaPool); err != nil {
+			return err
+		}
+
+		if modified = doc != nil || params.upsert; !modified {
+			return nil
+		}
+
+		if err = modifyDocument(ctx, &params, h.hanaPool); err != nil {
+			return err
 		}
 
 		if params.new && !params.remove {
 			doc, err = findNewDocument(ctx, &params, h.hanaPool)
-			if err != nil {
-				return nil, err
-			}
 		}
+		return err
+	}
 
+	// array updates are computed from the found document, so it is read and updated in one transaction
+	params.lock = params.update != nil && !params.remove && !params.replace && common.IsArrayUpdate(*params.update)
+	if params.lock {
+		err = h.hanaPool.InTx(ctx, findAndModify)
+	} else {
+		err = findAndModify(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &wire.OpMsg{}
+	if modified {
 		if params.remove {
 			err = resp.SetSections(wire.OpMsgSection{
 				Documents: []types.Document{types.MustMakeDocument(
@@ -178,13 +207,13 @@ func findDocument(ctx context.Context, params *findAndModifyParams, db *hana.Hpo
 		return nil, err
 	}
 
-	sql, err := createQuery(ctx, params)
+	sql, args, err := createQuery(ctx, params)
 	if err != nil {
 		return nil, err
 	}
 
 	var docByte []byte
-	row := db.QueryRowContext(ctx, sql)
+	row := db.QueryRowContext(ctx, sql, args...)
 
 	err = row.Scan(&docByte)
 	if err != nil {
@@ -200,6 +229,7 @@ func findDocument(ctx context.Context, params *findAndModifyParams, db *hana.Hpo
 	}
 
 	d := types.MustConvertDocument(&doc)
+	params.found = &d
 
 	params.docID, err = d.Get("_id")
 	if err != nil {
@@ -235,14 +265,15 @@ func modifyDocument(ctx context.Context, params *findAndModifyParams, db *hana.H
 func findNewDocument(ctx context.Context, params *findAndModifyParams, db *hana.Hpool) (*types.Document, error) {
 	sql := fmt.Sprintf("SELECT * FROM \"%s\".\"%s\"", params.db, params.collection)
 
-	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID))
+	var placeholder common.Placeholder
+	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID), &placeholder)
 	if err != nil {
 		return nil, err
 	}
 
 	sql += whereSQL + " LIMIT 1"
 
-	row := db.QueryRowContext(ctx, sql)
+	row := db.QueryRowContext(ctx, sql, placeholder.Args()...)
 
 	var docByte []byte
 	err = row.Scan(&docByte)
@@ -260,24 +291,29 @@ func findNewDocument(ctx context.Context, params *findAndModifyParams, db *hana.
 	return &d, nil
 }
 
-func createQuery(ctx context.Context, params *findAndModifyParams) (string, error) {
+// createQuery returns the query of the document to modify and the values of its parameters.
+func createQuery(ctx context.Context, params *findAndModifyParams) (string, []any, error) {
 	sql := fmt.Sprintf("SELECT * FROM \"%s\".\"%s\"", params.db, params.collection)
 
-	whereSQL, err := common.CreateWhereClause(*params.filter)
+	var placeholder common.Placeholder
+	whereSQL, err := common.CreateWhereClause(*params.filter, &placeholder)
 	if err != nil {
-		return "", lazyerrors.Error(err)
+		return "", nil, lazyerrors.Error(err)
 	}
 
 	orderSQL, err := createOrderBy(params)
 	if err != nil {
-		return "", lazyerrors.Error(err)
+		return "", nil, lazyerrors.Error(err)
 	}
 
 	sql += whereSQL + orderSQL
 
 	sql += " LIMIT 1"
+	if params.lock {
+		sql += " FOR UPDATE"
+	}
 
-	return sql, nil
+	return sql, placeholder.Args(), nil
 }
 
 func createOrderBy(params *findAndModifyParams) (sql string, err error) {
@@ -293,35 +329,21 @@ func createOrderBy(params *findAndModifyParams) (sql string, err error) {
 				sql += ","
 			}
 
-			if strings.Contains(sortKey, ".") {
-				split := strings.Split(sortKey, ".")
-				sql += " "
-				for j, s := range split {
-					if (len(split) - 1) == j {
-						sql += "\"" + s + "\""
-					} else {
-						sql += "\"" + s + "\"."
-					}
+			var kSQL string
+			split := strings.Split(sortKey, ".")
+			for j, s := range split {
+				if (len(split) - 1) == j {
+					kSQL += "\"" + s + "\""
+				} else {
+					kSQL += "\"" + s + "\"."
 				}
-			} else {
-				sql += "\"" + sortKey + "\" "
 			}
 
-			order, ok := sortMap[sortKey].(int32)
-			if !ok {
-				if !anyIsInt(sortMap[sortKey]) {
-					err = common.NewErrorMessage(common.ErrSortBadValue, "cannot use type %T for sort", sortMap[sortKey])
-					return
-				}
-				order = int32(sortMap[sortKey].(float64))
-			}
-			if order == 1 {
-				sql += " ASC"
-			} else if order == -1 {
-				sql += " DESC"
-			} else {
-				err = common.NewErrorMessage(common.ErrSortBadValue, "cannot use value %s for sort", sortMap[sortKey])
+			var direction string
+			if direction, err = sortDirection(sortMap[sortKey]); err != nil {
+				return
 			}
+			sql += common.OrderBySQL(kSQL, direction)
 		}
 	}
 	return
@@ -330,14 +352,15 @@ func createOrderBy(params *findAndModifyParams) (sql string, err error) {
 func removeDocument(ctx context.Context, params *findAndModifyParams, db *hana.Hpool) error {
 	sql := fmt.Sprintf("DELETE FROM \"%s\".\"%s\"", params.db, params.collection)
 
-	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID))
+	var placeholder common.Placeholder
+	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID), &placeholder)
 	if err != nil {
 		return lazyerrors.Error(err)
 	}
 
 	sql += whereSQL
 
-	_, err = db.ExecContext(ctx, sql)
+	_, err = db.ExecContext(ctx, sql, placeholder.Args()...)
 
 	return err
 }
@@ -346,19 +369,34 @@ func updateDocument(ctx context.Context, params *findAndModifyParams, db *hana.H
 
 	sql := fmt.Sprintf("UPDATE \"%s\".\"%s\"", params.db, params.collection)
 
-	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID))
-	if err != nil {
-		return lazyerrors.Error(err)
+	// the parameters are bound in the order of the statement: update, WHERE, and notWhereSQL
+	var placeholder, notWherePlaceholder common.Placeholder
+	var updateSQL, notWhereSQL string
+	var err error
+	if common.IsArrayUpdate(*params.update) {
+		updateSQL, err = common.UpdateArrays(*params.update, *params.filter, *params.found, &placeholder)
+		if err != nil {
+			return err
+		}
+		if updateSQL == "" {
+			return nil
+		}
+	} else {
+		// notWhereSQL only skips a document which already has the new values
+		updateSQL, notWhereSQL, err = common.Update(*params.update, &placeholder, &notWherePlaceholder)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
 	}
 
-	updateSQL, _, err := common.Update(*params.update)
+	whereSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", params.docID), &placeholder)
 	if err != nil {
 		return lazyerrors.Error(err)
 	}
 
-	sql += updateSQL + whereSQL
+	sql += updateSQL + whereSQL + notWhereSQL
 
-	_, err = db.ExecContext(ctx, sql)
+	_, err = db.ExecContext(ctx, sql, append(placeholder.Args(), notWherePlaceholder.Args()...)...)
 
 	return err
 }
@@ -517,9 +555,9 @@ func (params *findAndModifyParams) fillFindAndModifyParams(doc *types.Document)
 }
 
 func checkIfReplace(doc *types.Document) (bool, error) {
-	supportedUpdateCmds := map[string]struct{}{"$set": {}, "$unset": {}}
+	supportedUpdateCmds := map[string]struct{}{"$set": {}, "$unset": {}, "$push": {}, "$pull": {}}
 
-	for k := range doc.Map() {
+	for _, k := range doc.Keys() {
 		if strings.HasPrefix(k, "$") {
 			if _, ok := supportedUpdateCmds[strings.ToLower(k)]; !ok {
 				return false, fmt.Errorf("%s is not supported in update document", k)
@@ -26,11 +26,12 @@ func TestMsgFindAndModify(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnRows(findDoc)
-		mock.ExpectExec("UPDATE \"testDB\".\"testCollection\" SET \"name\" = 'test name' WHERE \"_id\" = 123").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnRows(findNewDoc)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnRows(findDoc)
+		mock.ExpectExec("UPDATE \"testDB\".\"testCollection\" SET \"name\" = ? WHERE \"_id\" = ? AND").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnRows(findNewDoc)
 
 		req := types.MustMakeDocument(
 			"findAndModify", "testCollection",
@@ -79,17 +80,132 @@ func TestMsgFindAndModify(t *testing.T) {
 		}
 	})
 
+	t.Run("find document, push and return old document", func(t *testing.T) {
+		findDoc := mock.NewRows([]string{"document"}).AddRow([]byte("{\"_id\": 123, \"tags\": [\"a\"]}"))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+
+		// the document is locked until the new array is written
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1 FOR UPDATE").WithArgs(int32(123)).WillReturnRows(findDoc)
+		mock.ExpectExec("UPDATE \"testDB\".\"testCollection\" SET \"tags\" = [?, ?] WHERE \"_id\" = ?").WithArgs("a", "b", int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		req := types.MustMakeDocument(
+			"findAndModify", "testCollection",
+			"query", types.MustMakeDocument("_id", int32(123)),
+			"update", types.MustMakeDocument(
+				"$push", types.MustMakeDocument("tags", "b"),
+			),
+			"$db", "testDB",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		resp, err := storage.MsgFindAndModify(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"lastErrorObject", types.MustMakeDocument(
+				"n", int32(1),
+				"updatedExisting", true,
+			),
+			"value", types.MustMakeDocument(
+				"_id", int32(123),
+				"tags", types.MustNewArray("a"),
+			),
+			"ok", float64(1),
+		)
+
+		actual, _ := resp.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("find document, update the matched array element and return new document", func(t *testing.T) {
+		findDoc := mock.NewRows([]string{"document"}).AddRow([]byte("{\"_id\": 123, \"tags\": [\"b\", \"a\"]}"))
+		findNewDoc := mock.NewRows([]string{"document"}).AddRow([]byte("{\"_id\": 123, \"tags\": [\"b\", \"z\"]}"))
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+
+		// the index of the matched element is resolved from the locked document
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? AND \"tags\" = ? LIMIT 1 FOR UPDATE").WithArgs(int32(123), "a").WillReturnRows(findDoc)
+		mock.ExpectExec("UPDATE \"testDB\".\"testCollection\" SET \"tags\"[2] = ? WHERE \"_id\" = ?").WithArgs("z", int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnRows(findNewDoc)
+		mock.ExpectCommit()
+
+		req := types.MustMakeDocument(
+			"findAndModify", "testCollection",
+			"query", types.MustMakeDocument(
+				"_id", int32(123),
+				"tags", "a",
+			),
+			"new", true,
+			"update", types.MustMakeDocument(
+				"$set", types.MustMakeDocument(
+					"tags.$", "z",
+				),
+			),
+			"$db", "testDB",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{req},
+		})
+		require.NoError(t, err)
+
+		resp, err := storage.MsgFindAndModify(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"lastErrorObject", types.MustMakeDocument(
+				"n", int32(1),
+				"updatedExisting", true,
+			),
+			"value", types.MustMakeDocument(
+				"_id", int32(123),
+				"tags", types.MustNewArray("b", "z"),
+			),
+			"ok", float64(1),
+		)
+
+		actual, _ := resp.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
 	t.Run("find document, remove and return removed document", func(t *testing.T) {
 
 		findDoc := mock.NewRows([]string{"document"}).AddRow([]byte("{\"_id\": 123, \"item\": \"test\"}"))
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnRows(findDoc)
-		mock.ExpectExec("DELETE FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnRows(findDoc)
+		mock.ExpectExec("DELETE FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ?").WithArgs(int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		req := types.MustMakeDocument(
 			"findAndModify", "testCollection",
@@ -136,11 +252,12 @@ func TestMsgFindAndModify(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 ORDER BY \"item\"  ASC LIMIT 1").WillReturnRows(findDoc)
-		mock.ExpectExec("DELETE FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? ORDER BY \"item\".\"$da\" ASC NULLS FIRST, \"item\" ASC LIMIT 1").WillReturnRows(findDoc)
+		mock.ExpectExec("DELETE FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ?").WithArgs(int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectExec("INSERT INTO \"testDB\".\"testCollection\" VALUES ($1) ").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		req := types.MustMakeDocument(
@@ -194,10 +311,11 @@ func TestMsgFindAndModify(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnError(sql.ErrNoRows)
 
 		req := types.MustMakeDocument(
 			"findAndModify", "testCollection",
@@ -238,10 +356,11 @@ func TestMsgFindAndModify(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnError(sql.ErrNoRows)
 
 		req := types.MustMakeDocument(
 			"findAndModify", "testCollection",
@@ -290,15 +409,16 @@ func TestMsgFindAndModify(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDB'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDB' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDB", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDB").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDB", "testCollection").WillReturnRows(row2)
 
 		upsertDoc := mock.NewRows([]string{"document"}).AddRow([]byte("{\"_id\": 123, \"name\": \"test name\"}"))
 
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnError(sql.ErrNoRows)
-		mock.ExpectQuery("SELECT _id FROM \"testDB\".\"testCollection\"  WHERE \"_id\" = 123 LIMIT 1").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery("SELECT _id FROM \"testDB\".\"testCollection\"  WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnError(sql.ErrNoRows)
 		mock.ExpectExec("INSERT INTO \"testDB\".\"testCollection\" VALUES ($1) ").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = 123 LIMIT 1").WillReturnRows(upsertDoc)
+		mock.ExpectQuery("SELECT * FROM \"testDB\".\"testCollection\" WHERE \"_id\" = ? LIMIT 1").WithArgs(int32(123)).WillReturnRows(upsertDoc)
 
 		req := types.MustMakeDocument(
 			"findAndModify", "testCollection",
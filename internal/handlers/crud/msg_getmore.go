@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgGetMore returns the next batch of documents of a cursor of find.
+// Without batchSize, the batch is sized by the average size of the documents returned so far.
+// With the exhaustAllowed flag, the reply of a cursor which is not exhausted has the moreToCome flag,
+// and the next batch follows without a request.
+func (h *storage) MsgGetMore(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	common.Ignored(&document, h.l, "maxTimeMS")
+
+	m := document.Map()
+
+	id, ok := m["getMore"].(int64)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'getMore' must be of type long")
+	}
+
+	collection, ok := m["collection"].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'collection' must be of type string")
+	}
+	ns := m["$db"].(string) + "." + collection
+
+	batchSize, err := parseBatchSize("getMore", m["batchSize"])
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := h.cursors.takeOwned(id, hana.User(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, common.NewErrorMessage(common.ErrCursorNotFound, "cursor id %d not found", id)
+	}
+
+	if c.ns != ns {
+		h.cursors.put(c)
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "Requested getMore on namespace '%s', but cursor belongs to a different namespace %s", ns, c.ns)
+	}
+
+	batch, err := c.nextBatch(batchSize)
+	if err != nil {
+		return nil, err
+	}
+	h.cursors.put(c)
+
+	// the id of an exhausted cursor is 0, so that the client does not continue it
+	id = c.id
+	if c.exhausted() {
+		id = 0
+	}
+
+	var reply wire.OpMsg
+	if id != 0 && msg.FlagBits.FlagSet(wire.OpMsgExhaustAllowed) {
+		reply.FlagBits = wire.OpMsgFlags(wire.OpMsgMoreToCome)
+	}
+
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"nextBatch", batchArray(batch),
+				"id", id,
+				"ns", c.ns,
+			),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
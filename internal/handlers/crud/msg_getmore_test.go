@@ -0,0 +1,167 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestMsgGetMore(t *testing.T) {
+	ctx, s, _, err := setupTestUtil(t)
+	require.NoError(t, err)
+	cursors := s.(*storage).cursors
+
+	request := func(doc types.Document) *wire.OpMsg {
+		var msg wire.OpMsg
+		require.NoError(t, msg.SetSections(wire.OpMsgSection{Documents: []types.Document{doc}}))
+		return &msg
+	}
+
+	t.Run("getMore", func(t *testing.T) {
+		c := testCursor(3, 10)
+		c.next(1)
+		cursors.add(c)
+
+		msg, err := s.MsgGetMore(ctx, request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "c",
+			"batchSize", int32(1),
+			"$db", "db",
+		)))
+		require.NoError(t, err)
+		actual, err := msg.Document()
+		require.NoError(t, err)
+		expected := types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"nextBatch", types.MustNewArray(frozenDocument("_id", int32(1))),
+				"id", c.id,
+				"ns", "db.c",
+			),
+			"ok", float64(1),
+		)
+		assert.Equal(t, expected, actual)
+
+		// the last batch closes the cursor
+		msg, err = s.MsgGetMore(ctx, request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "c",
+			"$db", "db",
+		)))
+		require.NoError(t, err)
+		actual, err = msg.Document()
+		require.NoError(t, err)
+		expected = types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"nextBatch", types.MustNewArray(frozenDocument("_id", int32(2))),
+				"id", int64(0),
+				"ns", "db.c",
+			),
+			"ok", float64(1),
+		)
+		assert.Equal(t, expected, actual)
+
+		_, err = s.MsgGetMore(ctx, request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "c",
+			"$db", "db",
+		)))
+		assert.Equal(t, common.NewErrorMessage(common.ErrCursorNotFound, "cursor id %d not found", c.id), err)
+	})
+
+	t.Run("getMore with exhaustAllowed", func(t *testing.T) {
+		c := testCursor(3, 10)
+		cursors.add(c)
+
+		req := request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "c",
+			"batchSize", int32(2),
+			"$db", "db",
+		))
+		req.FlagBits = wire.OpMsgFlags(wire.OpMsgExhaustAllowed)
+
+		// the reply has moreToCome until the cursor is exhausted
+		msg, err := s.MsgGetMore(ctx, req)
+		require.NoError(t, err)
+		assert.True(t, msg.FlagBits.FlagSet(wire.OpMsgMoreToCome))
+
+		msg, err = s.MsgGetMore(ctx, req)
+		require.NoError(t, err)
+		assert.False(t, msg.FlagBits.FlagSet(wire.OpMsgMoreToCome))
+	})
+
+	t.Run("getMore of another namespace", func(t *testing.T) {
+		c := testCursor(3, 10)
+		cursors.add(c)
+
+		_, err := s.MsgGetMore(ctx, request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "other",
+			"$db", "db",
+		)))
+		expected := common.NewErrorMessage(common.ErrUnauthorized, "Requested getMore on namespace 'db.other', but cursor belongs to a different namespace db.c")
+		assert.Equal(t, expected, err)
+
+		// the cursor is kept
+		assert.Same(t, c, cursors.take(c.id))
+	})
+
+	t.Run("getMore of another user", func(t *testing.T) {
+		c := testCursor(3, 10)
+		c.owner = "OTHER"
+		cursors.add(c)
+
+		req := request(types.MustMakeDocument(
+			"getMore", c.id,
+			"collection", "c",
+			"$db", "db",
+		))
+		_, err := s.MsgGetMore(hana.WithUser(ctx, "APP"), req)
+		expected := common.NewErrorMessage(common.ErrUnauthorized, "cursor id %d was not created by the authenticated user", c.id)
+		assert.Equal(t, expected, err)
+
+		_, err = s.MsgKillCursors(hana.WithUser(ctx, "APP"), request(types.MustMakeDocument(
+			"killCursors", "c",
+			"cursors", types.MustNewArray(c.id),
+			"$db", "db",
+		)))
+		assert.Equal(t, expected, err)
+
+		// the owner continues the cursor
+		_, err = s.MsgGetMore(hana.WithUser(ctx, "OTHER"), req)
+		require.NoError(t, err)
+	})
+
+	t.Run("killCursors", func(t *testing.T) {
+		c := testCursor(3, 10)
+		cursors.add(c)
+
+		msg, err := s.MsgKillCursors(ctx, request(types.MustMakeDocument(
+			"killCursors", "c",
+			"cursors", types.MustNewArray(c.id, c.id+1),
+			"$db", "db",
+		)))
+		require.NoError(t, err)
+		actual, err := msg.Document()
+		require.NoError(t, err)
+		expected := types.MustMakeDocument(
+			"cursorsKilled", types.MustNewArray(c.id),
+			"cursorsNotFound", types.MustNewArray(c.id+1),
+			"cursorsAlive", types.MustNewArray(),
+			"cursorsUnknown", types.MustNewArray(),
+			"ok", float64(1),
+		)
+		assert.Equal(t, expected, actual)
+		assert.Nil(t, cursors.take(c.id))
+	})
+}
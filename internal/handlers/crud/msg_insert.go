@@ -38,7 +38,7 @@ func (h *storage) MsgInsert(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		return nil, lazyerrors.Error(err)
 	}
 
-	err = (common.Unimplemented(&document, "writeConcern", "bypassDocumentValidation", "comment"))
+	err = (common.Unimplemented(&document, "bypassDocumentValidation"))
 	if err != nil {
 		return nil, err
 	}
@@ -50,11 +50,29 @@ func (h *storage) MsgInsert(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 	collection := m[document.Command()].(string)
 	db := m["$db"].(string)
 
-	if err = h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+	// documents with invalid keys or which are too large are rejected before any is inserted
+	docs, _ := m["documents"].(*types.Array)
+	for i := 0; i < docs.Len(); i++ {
+		doc, _ := docs.Get(i)
+		if d, ok := doc.(types.Document); ok {
+			if err = h.keys.ValidateDocument(d); err != nil {
+				return nil, err
+			}
+			if err = checkDocumentSize(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ctx, cancel, err := h.prepareWrite(ctx, &document, db, collection)
+	if err != nil {
 		return nil, err
 	}
+	defer cancel()
 
-	docs, _ := m["documents"].(*types.Array)
+	if err = h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+		return nil, err
+	}
 
 	var inserted int32
 	for i := 0; i < docs.Len(); i++ {
@@ -101,3 +119,25 @@ func (h *storage) MsgInsert(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 
 	return &reply, nil
 }
+
+// checkDocumentSize returns BSONObjectTooLarge for a document larger than bson.MaxDocumentLen, like in MongoDB.
+// The message of the insert may still hold it, as its documents may be up to bson.MaxInternalDocumentLen.
+func checkDocumentSize(doc types.Document) error {
+	d, err := bson.ConvertDocument(doc)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	l, err := d.Size()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if l > bson.MaxDocumentLen {
+		return common.NewErrorMessage(
+			common.ErrBSONObjectTooLarge, "object to insert too large. size in bytes: %d, max size: %d", l, bson.MaxDocumentLen,
+		)
+	}
+
+	return nil
+}
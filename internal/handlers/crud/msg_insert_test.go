@@ -6,9 +6,11 @@ package crud
 
 import (
 	"database/sql/driver"
+	"strings"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 	"github.com/stretchr/testify/assert"
@@ -22,9 +24,10 @@ func TestMsgInsert(t *testing.T) {
 		idRow := mock.NewRows([]string{"_id"})
 		args := []driver.Value{[]byte{123, 34, 95, 105, 100, 34, 58, 49, 50, 51, 44, 34, 105, 116, 101, 109, 34, 58, 34, 116, 101, 115, 116, 34, 125}}
 
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
 		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"testCollection\"  WHERE \"_id\" = 123").WillReturnRows(idRow)
+		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"testCollection\"  WHERE \"_id\" = ?").WillReturnRows(idRow)
 		mock.ExpectExec("INSERT INTO \"testDatabase\".\"testCollection\" VALUES ($1)").WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		insertReq := types.MustMakeDocument(
@@ -64,9 +67,10 @@ func TestMsgInsert(t *testing.T) {
 	t.Run("insert a document. Not unique id", func(t *testing.T) {
 		idRow := mock.NewRows([]string{"_id"}).AddRow(123)
 
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
 		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"testCollection\"  WHERE \"_id\" = 123").WillReturnRows(idRow)
+		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"testCollection\"  WHERE \"_id\" = ?").WillReturnRows(idRow)
 
 		insertReq := types.MustMakeDocument(
 			"insert", "testCollection",
@@ -94,4 +98,121 @@ func TestMsgInsert(t *testing.T) {
 			t.Errorf("there were unfulfilled expectations: %s", err)
 		}
 	})
+
+	t.Run("insert a document into a read-only collection", func(t *testing.T) {
+		commentsRow := sqlmock.NewRows([]string{"comments"}).AddRow(`{"readOnly":true}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(commentsRow)
+
+		insertReq := types.MustMakeDocument(
+			"insert", "testCollection",
+			"documents", types.MustNewArray(
+				types.MustMakeDocument(
+					"_id", int32(123),
+					"item", "test",
+				),
+			),
+			"ordered", true,
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{insertReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgInsert(ctx, &reqMsg)
+		assert.Nil(t, msg)
+		assert.EqualError(t, err, "IllegalOperation (20): cannot write to the read-only collection testDatabase.testCollection")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("insert a document with invalid write concern", func(t *testing.T) {
+		insertReq := types.MustMakeDocument(
+			"insert", "testCollection",
+			"documents", types.MustNewArray(
+				types.MustMakeDocument(
+					"_id", int32(123),
+					"item", "test",
+				),
+			),
+			"ordered", true,
+			"writeConcern", types.MustMakeDocument("w", int32(2)),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{insertReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgInsert(ctx, &reqMsg)
+		assert.Nil(t, msg)
+		assert.EqualError(t, err, "BadValue (2): cannot use 'w' > 1 on a standalone")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("insert a document with a dollar prefixed key", func(t *testing.T) {
+		insertReq := types.MustMakeDocument(
+			"insert", "testCollection",
+			"documents", types.MustNewArray(
+				types.MustMakeDocument(
+					"_id", int32(123),
+					"item", types.MustMakeDocument("$da", int32(0)),
+				),
+			),
+			"ordered", true,
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{insertReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgInsert(ctx, &reqMsg)
+		assert.Nil(t, msg)
+		assert.EqualError(t, err, "DollarPrefixedFieldName (52): The dollar ($) prefixed field '$da' in 'item.$da' is not valid for storage.")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("insert a document which is too large", func(t *testing.T) {
+		insertReq := types.MustMakeDocument(
+			"insert", "testCollection",
+			"documents", types.MustNewArray(
+				types.MustMakeDocument(
+					"_id", int32(123),
+					"item", strings.Repeat("x", bson.MaxDocumentLen),
+				),
+			),
+			"ordered", true,
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{insertReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgInsert(ctx, &reqMsg)
+		assert.Nil(t, msg)
+		assert.EqualError(t, err, "BSONObjectTooLarge (10334): object to insert too large. size in bytes: 16777241, max size: 16777216")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
 }
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgKillCursors closes cursors of find, which drivers do when a cursor is closed before it is exhausted.
+func (h *storage) MsgKillCursors(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+
+	collection, ok := m["killCursors"].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'killCursors' must be of type string")
+	}
+	ns := m["$db"].(string) + "." + collection
+
+	ids, ok := m["cursors"].(*types.Array)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'cursors' must be of type array")
+	}
+
+	killed := types.MustNewArray()
+	notFound := types.MustNewArray()
+	for i := 0; i < ids.Len(); i++ {
+		v, _ := ids.Get(i)
+		id, ok := v.(int64)
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'cursors' must contain only values of type long")
+		}
+
+		// cursors of other users fail the command, the ones of other namespaces are not closed
+		c, err := h.cursors.takeOwned(id, hana.User(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if c != nil && c.ns != ns {
+			h.cursors.put(c)
+			c = nil
+		}
+
+		res := notFound
+		if c != nil {
+			c.close()
+			res = killed
+		}
+		if err = res.Append(id); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"cursorsKilled", killed,
+			"cursorsNotFound", notFound,
+			"cursorsAlive", types.MustNewArray(),
+			"cursorsUnknown", types.MustNewArray(),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
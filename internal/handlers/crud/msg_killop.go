@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"math"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgKillOp aborts the index build with the opid reported by currentOp,
+// which cancels its statement in SAP HANA and drops the indexes it already built.
+// Like in MongoDB, it succeeds if there is no such operation.
+func (h *storage) MsgKillOp(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+
+	if m["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "killOp may only be run against the admin database.")
+	}
+
+	var opid int64
+	switch op := m["op"].(type) {
+	case int32:
+		opid = int64(op)
+	case int64:
+		opid = op
+	case float64:
+		if op != math.Trunc(op) {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "invalid op : %v", op)
+		}
+		opid = int64(op)
+	default:
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "Field 'op' must be a number")
+	}
+
+	if opid > 0 && opid <= math.MaxInt32 {
+		b, err := h.indexBuilds.get(int32(opid), hana.User(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			b.cancel()
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"info", "attempting to kill op",
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// maxSeedCount is the maximum number of documents generated by one seed command.
+const maxSeedCount = 100_000
+
+// MsgSeed populates a collection with documents generated from a schema template.
+// The same template and randomSeed always generate the same documents.
+func (h *storage) MsgSeed(ctx context.Context, msg *wire.OpMsg) (res *wire.OpMsg, err error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+	db := m["$db"].(string)
+
+	collection, ok := m["seed"].(string)
+	if !ok || collection == "" {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "seed must be a collection name")
+	}
+
+	var count int64
+	switch c := m["count"].(type) {
+	case int32:
+		count = int64(c)
+	case int64:
+		count = c
+	case float64:
+		if c == float64(int64(c)) {
+			count = int64(c)
+		}
+	}
+	if count < 1 || count > maxSeedCount {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "count must be a whole number between 1 and %d", maxSeedCount)
+	}
+
+	template, ok := m["template"].(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "template must be an object")
+	}
+
+	var randomSeed int64
+	switch s := m["randomSeed"].(type) {
+	case nil:
+	case int32:
+		randomSeed = int64(s)
+	case int64:
+		randomSeed = s
+	default:
+		return nil, common.NewErrorMessage(common.ErrBadValue, "randomSeed must be an integer")
+	}
+
+	drop, _ := m["drop"].(bool)
+
+	t, err := newFakeTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel, err := h.prepareWrite(ctx, &document, db, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
+	if err = h.hanaPool.CreateNamespaceIfNotExists(ctx, db, collection); err != nil {
+		return nil, err
+	}
+
+	// insert all documents in one transaction, unless the session already runs one
+	if !hana.InTransaction(ctx) {
+		var tx *hana.PinnedTx
+		if tx, err = h.hanaPool.BeginPinnedTx(ctx); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+
+			if err = tx.Commit(); err != nil {
+				res = nil
+			}
+		}()
+
+		ctx = hana.WithPinnedTx(ctx, tx)
+	}
+
+	if drop {
+		if _, err = h.hanaPool.ExecContext(ctx, fmt.Sprintf("DELETE FROM \"%s\".\"%s\"", db, collection)); err != nil {
+			return nil, err
+		}
+	}
+
+	// the insert is prepared once and runs for all documents in the transaction
+	var stmt *sql.Stmt
+	stmt, err = h.hanaPool.PrepareContext(ctx, fmt.Sprintf("INSERT INTO \"%s\".\"%s\" VALUES ($1)", db, collection))
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer stmt.Close()
+
+	r := rand.New(rand.NewSource(randomSeed))
+	for i := 0; i < int(count); i++ {
+		var b []byte
+		if b, err = bson.MustConvertDocument(t.document(r, i)).MarshalJSONHANA(); err != nil {
+			return nil, err
+		}
+
+		if _, err = stmt.ExecContext(ctx, b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"n", int32(count),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestFakeTemplate(t *testing.T) {
+	t.Parallel()
+
+	template := types.MustMakeDocument(
+		"n", types.MustMakeDocument("$sequence", types.MustMakeDocument("start", int32(10))),
+		"age", types.MustMakeDocument("$int", types.MustMakeDocument("min", int32(18), "max", int32(65))),
+		"kind", "customer",
+		"address", types.MustMakeDocument(
+			"city", types.MustMakeDocument("$city", types.MustMakeDocument()),
+		),
+		"tags", types.MustMakeDocument("$array", types.MustMakeDocument(
+			"of", types.MustMakeDocument("$choice", types.MustNewArray("a", "b")),
+			"max", int32(3),
+		)),
+		"since", types.MustMakeDocument("$date", types.MustMakeDocument()),
+	)
+
+	ft, err := newFakeTemplate(template)
+	require.NoError(t, err)
+
+	generate := func(seed int64) []types.Document {
+		r := rand.New(rand.NewSource(seed))
+		docs := make([]types.Document, 20)
+		for i := range docs {
+			docs[i] = ft.document(r, i)
+		}
+		return docs
+	}
+
+	docs := generate(42)
+	assert.Equal(t, docs, generate(42))
+	assert.NotEqual(t, docs, generate(43))
+
+	for i, doc := range docs {
+		m := doc.Map()
+		assert.Equal(t, []string{"_id", "n", "age", "kind", "address", "tags", "since"}, doc.Keys())
+		assert.IsType(t, types.ObjectID{}, m["_id"])
+		assert.Equal(t, int32(10+i), m["n"])
+		assert.GreaterOrEqual(t, m["age"], int32(18))
+		assert.LessOrEqual(t, m["age"], int32(65))
+		assert.Equal(t, "customer", m["kind"])
+		assert.Contains(t, fakeCities, m["address"].(types.Document).Map()["city"])
+		assert.LessOrEqual(t, m["tags"].(*types.Array).Len(), 3)
+
+		since := m["since"].(time.Time)
+		assert.False(t, since.Before(fakeDateMin) || since.After(fakeDateMax))
+	}
+}
+
+func TestFakeBetween(t *testing.T) {
+	t.Parallel()
+
+	r := rand.New(rand.NewSource(1))
+	for name, tc := range map[string]struct {
+		lo, hi int64
+	}{
+		"Small":   {lo: -5, hi: 5},
+		"Single":  {lo: 7, hi: 7},
+		"Wide":    {lo: math.MinInt64 / 2, hi: math.MaxInt64},
+		"Full":    {lo: math.MinInt64, hi: math.MaxInt64},
+		"MaxOnly": {lo: math.MaxInt64, hi: math.MaxInt64},
+	} {
+		for i := 0; i < 100; i++ {
+			v := fakeBetween(r, tc.lo, tc.hi)
+			assert.True(t, v >= tc.lo && v <= tc.hi, "%s: %d", name, v)
+		}
+	}
+}
+
+func TestFakeTemplateErrors(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		template types.Document
+		err      string
+	}{
+		"Unknown": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$foo", types.MustMakeDocument())),
+			err:      "seed: unknown generator $foo",
+		},
+		"Choice": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$choice", types.MustNewArray())),
+			err:      "seed: $choice must be a non-empty array",
+		},
+		"Range": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$int", types.MustMakeDocument("min", int32(2), "max", int32(1)))),
+			err:      "seed: min of $int must not be greater than max",
+		},
+		"IntRange": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$int", types.MustMakeDocument("max", float64(1<<63)))),
+			err:      "seed: max of $int must be a 64-bit integer",
+		},
+		"Words": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$sentence", types.MustMakeDocument("words", int32(1001)))),
+			err:      "seed: words of $sentence must be between 1 and 1000",
+		},
+		"ArrayLen": {
+			template: types.MustMakeDocument("v", types.MustMakeDocument("$array", types.MustMakeDocument(
+				"of", int32(1), "max", int64(1<<40),
+			))),
+			err: "seed: min and max of $array must be between 0 and 1000",
+		},
+		"Field": {
+			template: types.MustMakeDocument("$value", int32(1), "w", int32(2)),
+			err:      "seed: field $value must not start with $ unless it is the only field of a generator",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newFakeTemplate(tc.template)
+			assert.Equal(t, common.NewErrorMessage(common.ErrBadValue, tc.err), err)
+		})
+	}
+}
+
+func TestMsgSeed(t *testing.T) {
+	ctx, storage, mock, err := setupTestUtil(t)
+	require.NoError(t, err)
+
+	mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+	mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM \"testDatabase\".\"testCollection\"").WillReturnResult(sqlmock.NewResult(0, 5))
+	insert := mock.ExpectPrepare("INSERT INTO \"testDatabase\".\"testCollection\" VALUES ($1)").WillBeClosed()
+	insert.ExpectExec().WithArgs([]byte(`{"_id":1,"name":"seed"}`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	insert.ExpectExec().WithArgs([]byte(`{"_id":2,"name":"seed"}`)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	var reqMsg wire.OpMsg
+	err = reqMsg.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"seed", "testCollection",
+			"count", int32(2),
+			"template", types.MustMakeDocument(
+				"_id", types.MustMakeDocument("$sequence", types.MustMakeDocument()),
+				"name", "seed",
+			),
+			"randomSeed", int64(7),
+			"drop", true,
+			"$db", "testDatabase",
+		)},
+	})
+	require.NoError(t, err)
+
+	msg, err := storage.MsgSeed(ctx, &reqMsg)
+	require.NoError(t, err)
+
+	actual, err := msg.Document()
+	require.NoError(t, err)
+	assert.Equal(t, types.MustMakeDocument("n", int32(2), "ok", float64(1)), actual)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
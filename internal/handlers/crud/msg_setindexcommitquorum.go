@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgSetIndexCommitQuorum changes the commitQuorum of the index build in progress of exactly the given indexes.
+// With the commitQuorum 0, the createIndexes waiting for the build returns while the build continues.
+func (h *storage) MsgSetIndexCommitQuorum(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+	collection, ok := m[document.Command()].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m[document.Command()])
+	}
+	db := m["$db"].(string)
+
+	indexNames, ok := m["indexNames"].(*types.Array)
+	if !ok || indexNames.Len() == 0 {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "indexNames must be a non-empty array of index names")
+	}
+	names := make([]string, indexNames.Len())
+	for i := range names {
+		name, _ := indexNames.Get(i)
+		if names[i], ok = name.(string); !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "indexNames must only contain strings")
+		}
+	}
+
+	commitQuorum, ok := m["commitQuorum"]
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "setIndexCommitQuorum needs a commitQuorum")
+	}
+	if err = common.ValidateCommitQuorum(commitQuorum); err != nil {
+		return nil, err
+	}
+
+	b := h.indexBuilds.find(db, collection, names, hana.User(ctx))
+	if b == nil {
+		return nil, common.NewErrorMessage(
+			common.ErrIndexNotFound,
+			"Cannot find an index build on collection '%s.%s' with the provided index names", db, collection,
+		)
+	}
+	b.setCommitQuorum(commitQuorum)
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
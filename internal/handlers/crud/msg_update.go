@@ -40,11 +40,8 @@ func (h *storage) MsgUpdate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 
 	unimplementedFields := []string{
 		"upsert",
-		"writeConcern",
 		"collation",
 		"arrayFilter",
-		"hint",
-		"commented",
 		"bypassDocumentValidation",
 	}
 
@@ -62,6 +59,12 @@ func (h *storage) MsgUpdate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		return nil, fmt.Errorf("wrong use of update")
 	}
 
+	ctx, cancel, err := h.prepareWrite(ctx, &document, db, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+
 	if exists, err := h.hanaPool.NamespaceExists(ctx, db, collection); err == nil {
 		if !exists {
 			docs = types.MustNewArray()
@@ -70,7 +73,7 @@ func (h *storage) MsgUpdate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		return nil, err
 	}
 
-	var selected, updated, matched int32
+	var selected, updated int32
 	for i := 0; i < docs.Len(); i++ {
 		doc, err := docs.Get(i)
 		if err != nil {
@@ -79,76 +82,84 @@ func (h *storage) MsgUpdate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 
 		docM := doc.(types.Document).Map()
 
-		whereSQL, err := common.CreateWhereClause(docM["q"].(types.Document))
+		collation, err := common.ParseCollation(docM["collation"])
 		if err != nil {
 			return nil, err
 		}
-		// notWhereSQL makes sure we do not update documents which do not need an update
-		updateSQL, notWhereSQL, err := common.Update(docM["u"].(types.Document))
+
+		// the variables of let are replaced by their values in $expr
+		filter, err := common.ApplyLet(docM["q"].(types.Document), m["let"])
 		if err != nil {
 			return nil, err
 		}
 
-		// Get amount of documents that fits the filter. MatchCount
-		countSQL := fmt.Sprintf("SELECT count(*) FROM \"%s\".\"%s\"", db, collection) + whereSQL
-		countRow := h.hanaPool.QueryRowContext(ctx, countSQL)
-
-		err = countRow.Scan(&matched)
+		// the statements selecting the matched documents have the parameters of the filter only
+		var wherePlaceholder common.Placeholder
+		whereSQL, err := common.CreateCollatedWhereClause(filter, collation, &wherePlaceholder)
 		if err != nil {
-			return nil, lazyerrors.Error(err)
+			return nil, err
 		}
 
-		var args []any
-		if docM["multi"] != true { // If updateOne()
-
-			// We get the _id of the one document to update.
-			sql := fmt.Sprintf("SELECT {\"_id\": \"_id\"} FROM \"%s\".\"%s\"", db, collection)
-			sql += whereSQL + notWhereSQL + " LIMIT 1"
-			row := h.hanaPool.QueryRowContext(ctx, sql)
-
-			var objectID []byte
+		hint, err := h.hintSQL(ctx, db, collection, docM["hint"])
+		if err != nil {
+			return nil, err
+		}
 
-			err = row.Scan(&objectID)
+		// the new documents of an update with an aggregation pipeline are computed by the compatibility layer
+		if pipeline, ok := docM["u"].(*types.Array); ok {
+			stages, err := newUpdateStages(pipeline, m["let"])
 			if err != nil {
-				selected += matched
-				err = nil
-				continue
+				return nil, err
 			}
 
-			id, err := fjson.Unmarshal(objectID)
+			n, modified, err := h.updatePipeline(ctx, db, collection, whereSQL, wherePlaceholder.Args(), hint, stages, docM["multi"] == true)
 			if err != nil {
 				return nil, err
 			}
 
-			updateId, err := common.GetUpdateValue(id.(types.Document).Map()["_id"])
+			selected += n
+			updated += modified
+			continue
+		}
+
+		if err = h.keys.ValidateUpdate(docM["u"].(types.Document)); err != nil {
+			return nil, err
+		}
+
+		u := docM["u"].(types.Document)
+		nestedSQL, err := common.NestedSetSQL(u)
+		if err != nil {
+			return nil, err
+		}
+
+		if common.IsArrayUpdate(u) && nestedSQL == "" {
+			n, modified, err := h.updateArrays(ctx, db, collection, whereSQL, wherePlaceholder.Args(), hint, filter, u, docM["multi"] == true)
 			if err != nil {
 				return nil, err
 			}
 
-			whereSQL = "WHERE \"_id\" = %s"
-			var emptySlice []any
-			args = append(emptySlice, updateId)
-			notWhereSQL = ""
+			selected += n
+			updated += modified
+			continue
 		}
 
-		sql := fmt.Sprintf("UPDATE \"%s\".\"%s\" ", db, collection)
-
-		sql += updateSQL + " " + fmt.Sprintf(whereSQL, args...) + notWhereSQL
-
-		tag, err := h.hanaPool.ExecContext(ctx, sql)
+		// fields of embedded documents are set by the UPDATE statement in the documents in which they exist,
+		// the other documents are read to create the fields with their missing parents
+		n, modified, err := h.updateDocuments(ctx, db, collection, whereAnd(whereSQL, nestedSQL), wherePlaceholder.Args(), hint, filter, collation, u, nestedSQL, docM["multi"] == true)
 		if err != nil {
 			return nil, err
 		}
+		selected += n
+		updated += modified
 
-		// Set modifiedCount
-		if docM["multi"] != true {
-			updated += 1
-			selected += matched
-		} else {
-			rowsaffected, _ := tag.RowsAffected()
+		if nestedSQL != "" && (docM["multi"] == true || n == 0) {
+			n, modified, err = h.updateArrays(ctx, db, collection, whereAnd(whereSQL, "NOT ("+nestedSQL+")"), wherePlaceholder.Args(), hint, filter, u, docM["multi"] == true)
+			if err != nil {
+				return nil, err
+			}
 
-			updated += int32(rowsaffected)
-			selected += matched
+			selected += n
+			updated += modified
 		}
 	}
 
@@ -166,3 +177,162 @@ func (h *storage) MsgUpdate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 
 	return &reply, nil
 }
+
+// updateDocuments updates the documents matching whereSQL with the arguments whereArgs in an UPDATE statement,
+// and returns the number of matched and of modified documents.
+// The condition nestedSQL, if any, is added to the filter of a multi update, which is bound to the parameters of the statement again.
+func (h *storage) updateDocuments(ctx context.Context, db, collection, whereSQL string, whereArgs []any, hint string, filter types.Document, collation *common.Collation, update types.Document, nestedSQL string, multi bool) (matched, modified int32, err error) {
+	// notWhereSQL makes sure we do not update documents which do not need an update
+	var placeholder, notWherePlaceholder common.Placeholder
+	updateSQL, notWhereSQL, err := common.Update(update, &placeholder, &notWherePlaceholder)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Get amount of documents that fits the filter. MatchCount
+	countSQL := fmt.Sprintf("SELECT count(*) FROM \"%s\".\"%s\"", db, collection) + whereSQL + hint
+	countRow := h.hanaPool.QueryRowContext(ctx, countSQL, whereArgs...)
+
+	err = countRow.Scan(&matched)
+	if err != nil {
+		return 0, 0, lazyerrors.Error(err)
+	}
+
+	if !multi { // If updateOne()
+		if matched == 0 {
+			return 0, 0, nil
+		}
+
+		// We get the _id of the first matched document, which is updated unless it already has the new values.
+		sql := fmt.Sprintf("SELECT {\"_id\": \"_id\"} FROM \"%s\".\"%s\"", db, collection)
+		sql += whereSQL + " LIMIT 1" + hint
+		row := h.hanaPool.QueryRowContext(ctx, sql, whereArgs...)
+
+		var objectID []byte
+
+		err = row.Scan(&objectID)
+		if err != nil {
+			return 0, 0, lazyerrors.Error(err)
+		}
+
+		id, err := fjson.Unmarshal(objectID)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		updateId, err := common.GetUpdateValue(id.(types.Document).Map()["_id"], &placeholder)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		whereSQL = "WHERE \"_id\" = " + updateId
+		hint = ""
+		matched = 1
+	} else {
+		// the filter is bound to the parameters of the UPDATE statement again
+		if whereSQL, err = common.CreateCollatedWhereClause(filter, collation, &placeholder); err != nil {
+			return 0, 0, err
+		}
+		whereSQL = whereAnd(whereSQL, nestedSQL)
+	}
+
+	// notWhereSQL excludes the matched documents which already have the new values,
+	// so that the affected rows are the modified documents
+	sql := fmt.Sprintf("UPDATE \"%s\".\"%s\" ", db, collection)
+
+	sql += updateSQL + " " + whereSQL + notWhereSQL + hint
+
+	tag, err := h.hanaPool.ExecContext(ctx, sql, append(placeholder.Args(), notWherePlaceholder.Args()...)...)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rowsaffected, err := tag.RowsAffected()
+	if err != nil {
+		return 0, 0, lazyerrors.Error(err)
+	}
+
+	modified = int32(rowsaffected)
+
+	return matched, modified, nil
+}
+
+// whereAnd adds the condition to the WHERE clause, which may be empty.
+func whereAnd(whereSQL, condition string) string {
+	switch {
+	case condition == "":
+		return whereSQL
+	case whereSQL == "":
+		return " WHERE " + condition
+	default:
+		return whereSQL + " AND " + condition
+	}
+}
+
+// updateArrays updates the documents matching whereSQL with the arguments whereArgs with array operators like $push or $pull,
+// with the positional operator $ which refers to the array element matched by the filter,
+// or with fields of embedded documents set by dot notation which are created with their missing parents,
+// and returns the number of matched and of modified documents.
+// SAP HANA cannot compute the new arrays in an UPDATE statement, so the documents are read first
+// and every one of them is updated with its new arrays. They are read with FOR UPDATE in the transaction of the updates,
+// so that concurrent updates of the same documents wait instead of overwriting each other's arrays.
+// The hint is the WITH HINT clause of the SELECT.
+func (h *storage) updateArrays(ctx context.Context, db, collection, whereSQL string, whereArgs []any, hint string, filter, update types.Document, multi bool) (matched, modified int32, err error) {
+	sql := fmt.Sprintf("SELECT * FROM \"%s\".\"%s\"", db, collection) + whereSQL
+	if !multi {
+		sql += " LIMIT 1"
+	}
+	sql += " FOR UPDATE" + hint
+
+	err = h.hanaPool.InTx(ctx, func(ctx context.Context) error {
+		rows, err := h.hanaPool.QueryContext(ctx, sql, whereArgs...)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+		defer rows.Close()
+
+		var docs []types.Document
+		for {
+			doc, err := nextRow(rows)
+			if err != nil {
+				return err
+			}
+			if doc == nil {
+				break
+			}
+			docs = append(docs, *doc)
+		}
+		rows.Close()
+
+		matched = int32(len(docs))
+
+		for _, doc := range docs {
+			var placeholder common.Placeholder
+			updateSQL, err := common.UpdateArrays(update, filter, doc, &placeholder)
+			if err != nil {
+				return err
+			}
+			if updateSQL == "" {
+				continue
+			}
+
+			idSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", doc.Map()["_id"]), &placeholder)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+
+			sql := fmt.Sprintf("UPDATE \"%s\".\"%s\"", db, collection) + updateSQL + idSQL
+			if _, err = h.hanaPool.ExecContext(ctx, sql, placeholder.Args()...); err != nil {
+				return err
+			}
+			modified++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return matched, modified, nil
+}
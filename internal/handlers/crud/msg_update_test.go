@@ -22,11 +22,12 @@ func TestMsgUpdate(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test'").WillReturnRows(row)
-		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"item\" = 'new test'  WHERE \"item\" = 'test' AND ( NOT (   \"item\" = 'new test') OR (\"item\" IS UNSET )) ").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ?").WithArgs("test").WillReturnRows(row)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"item\" = ?  WHERE \"item\" = ? AND ( NOT (   \"item\" = ?) OR (\"item\" IS UNSET )) ").WithArgs("new test", "test", "new test").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		updateReq := types.MustMakeDocument(
 			"update", "testCollection",
@@ -76,12 +77,13 @@ func TestMsgUpdate(t *testing.T) {
 		row1 := mock.NewRows([]string{"count"}).AddRow(1)
 		row2 := mock.NewRows([]string{"count"}).AddRow(1)
 
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'testDatabase'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'testDatabase' AND table_name = 'testCollection' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
 
-		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test'").WillReturnRows(countRow)
-		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = 'test' AND ( NOT (   \"item\" = 'new test') OR (\"item\" IS UNSET )) ").WillReturnRows(idRow)
-		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"item\" = 'new test' WHERE \"_id\" = 123").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ?").WithArgs("test").WillReturnRows(countRow)
+		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? LIMIT 1").WithArgs("test").WillReturnRows(idRow)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"item\" = ? WHERE \"_id\" = ? AND ( NOT (   \"item\" = ?) OR (\"item\" IS UNSET ))").WithArgs("new test", int32(123), "new test").WillReturnResult(sqlmock.NewResult(1, 1))
 
 		updateReq := types.MustMakeDocument(
 			"update", "testCollection",
@@ -124,4 +126,430 @@ func TestMsgUpdate(t *testing.T) {
 		}
 	})
 
+	t.Run("push", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+		docRows := sqlmock.NewRows([]string{"doc"}).AddRow(`{"_id": 123, "feed": [1, 2]}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// the document is read and updated in one transaction
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? LIMIT 1 FOR UPDATE").WithArgs("test").WillReturnRows(docRows)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"feed\" = [?, ?], \"item\" = ? WHERE \"_id\" = ?").WithArgs(int32(3), int32(1), "pushed", int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument(
+						"item", "test",
+					),
+					"u", types.MustMakeDocument(
+						"$push", types.MustMakeDocument(
+							"feed", types.MustMakeDocument(
+								"$each", types.MustNewArray(int32(3)),
+								"$position", int32(0),
+								"$slice", int32(2),
+							),
+						),
+						"$set", types.MustMakeDocument(
+							"item", "pushed",
+						),
+					),
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(1),
+			"nModified", int32(1),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("pull", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+		docRows := sqlmock.NewRows([]string{"doc"}).
+			AddRow(`{"_id": 123, "feed": [1, 2, 1]}`).
+			AddRow(`{"_id": 124, "feed": [1]}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// all matched documents stay locked until their arrays are written
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? FOR UPDATE").WithArgs("test").WillReturnRows(docRows)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"feed\" = [?] WHERE \"_id\" = ?").WithArgs(int32(2), int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"feed\" = [] WHERE \"_id\" = ?").WithArgs(int32(124)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument(
+						"item", "test",
+					),
+					"u", types.MustMakeDocument(
+						"$pull", types.MustMakeDocument(
+							"feed", int32(1),
+						),
+					),
+					"multi", true,
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(2),
+			"nModified", int32(2),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("positional", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+		docRows := sqlmock.NewRows([]string{"doc"}).AddRow(`{"_id": 123, "items": [{"sku": "a", "qty": 1}, {"sku": "b", "qty": 2}]}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE FOR ANY \"element\" IN \"items\" SATISFIES").WillReturnRows(docRows)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"items\"[2].\"qty\" = ? WHERE \"_id\" = ?").WithArgs(int32(5), int32(123)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument(
+						"items", types.MustMakeDocument("$elemMatch", types.MustMakeDocument("sku", "b")),
+					),
+					"u", types.MustMakeDocument(
+						"$set", types.MustMakeDocument(
+							"items.$.qty", int32(5),
+						),
+					),
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(1),
+			"nModified", int32(1),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("dot notation", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+		docRows := sqlmock.NewRows([]string{"doc"}).AddRow(`{"_id": 123, "address": {"city": "Walldorf"}}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// the field does not exist, so the document is read to create it with its missing parents
+		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"_id\" = ? AND \"address\".\"geo\".\"lat\" IS SET").WithArgs(int32(123)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE \"_id\" = ? AND NOT (\"address\".\"geo\".\"lat\" IS SET) LIMIT 1 FOR UPDATE").WithArgs(int32(123)).WillReturnRows(docRows)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"address\" = {\"city\": ?, \"geo\": {\"lat\": ?}} WHERE \"_id\" = ?").WithArgs("Walldorf", 49.3, int32(123)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument("_id", int32(123)),
+					"u", types.MustMakeDocument(
+						"$set", types.MustMakeDocument(
+							"address.geo.lat", 49.3,
+						),
+					),
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(1),
+			"nModified", int32(1),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("dot notation of existing fields", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// SAP HANA sets the existing fields in the UPDATE statement, only the other documents are read
+		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"city\" = ? AND \"address\".\"geo\".\"lat\" IS SET").WithArgs("Walldorf").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"address\".\"geo\".\"lat\" = ?  WHERE \"city\" = ? AND \"address\".\"geo\".\"lat\" IS SET AND").
+			WithArgs(49.3, "Walldorf", 49.3).WillReturnResult(sqlmock.NewResult(1, 2))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE \"city\" = ? AND NOT (\"address\".\"geo\".\"lat\" IS SET) FOR UPDATE").WithArgs("Walldorf").
+			WillReturnRows(sqlmock.NewRows([]string{"doc"}))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument("city", "Walldorf"),
+					"u", types.MustMakeDocument(
+						"$set", types.MustMakeDocument(
+							"address.geo.lat", 49.3,
+						),
+					),
+					"multi", true,
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(2),
+			"nModified", int32(2),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("updateOne no-op", func(t *testing.T) {
+		countRow := sqlmock.NewRows([]string{"count"}).AddRow(3)
+		idRow := sqlmock.NewRows([]string{"_id"}).AddRow("{\"_id\": 123}")
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// the first of three matched documents already has the new value
+		mock.ExpectQuery("SELECT count(*) FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ?").WithArgs("test").WillReturnRows(countRow)
+		mock.ExpectQuery("SELECT {\"_id\": \"_id\"} FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? LIMIT 1").WithArgs("test").WillReturnRows(idRow)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\"  SET \"qty\" = ? WHERE \"_id\" = ? AND").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument("item", "test"),
+					"u", types.MustMakeDocument(
+						"$set", types.MustMakeDocument("qty", int32(5)),
+					),
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(1),
+			"nModified", int32(0),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		row1 := mock.NewRows([]string{"count"}).AddRow(1)
+		row2 := mock.NewRows([]string{"count"}).AddRow(1)
+		docRows := sqlmock.NewRows([]string{"doc"}).
+			AddRow(`{"_id": 1, "item": "test", "price": 10, "tmp": true}`).
+			AddRow(`{"_id": 2, "item": "test", "price": 20, "total": 22}`)
+
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+
+		// the new documents are computed by the compatibility layer, the second one already has them
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\" WHERE \"item\" = ? FOR UPDATE").WithArgs("test").WillReturnRows(docRows)
+		mock.ExpectExec("UPDATE \"testDatabase\".\"testCollection\" SET \"total\" = ?, UNSET \"tmp\" WHERE \"_id\" = ?").WithArgs(int32(12), int32(1)).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument("item", "test"),
+					"u", types.MustNewArray(
+						types.MustMakeDocument("$set", types.MustMakeDocument(
+							"total", types.MustMakeDocument("$add", types.MustNewArray("$price", "$$tax")),
+						)),
+						types.MustMakeDocument("$unset", "tmp"),
+					),
+					"multi", true,
+				),
+			),
+			"let", types.MustMakeDocument("tax", int32(2)),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		msg, err := storage.MsgUpdate(ctx, &reqMsg)
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"n", int32(2),
+			"nModified", int32(1),
+			"ok", float64(1),
+		)
+
+		actual, _ := msg.Document()
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("pipeline with unsupported stage", func(t *testing.T) {
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(mock.NewRows([]string{"count"}).AddRow(1))
+
+		updateReq := types.MustMakeDocument(
+			"update", "testCollection",
+			"updates", types.MustNewArray(
+				types.MustMakeDocument(
+					"q", types.MustMakeDocument("item", "test"),
+					"u", types.MustNewArray(types.MustMakeDocument("$replaceWith", "$sub")),
+				),
+			),
+			"$db", "testDatabase",
+		)
+
+		var reqMsg wire.OpMsg
+		err = reqMsg.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{updateReq},
+		})
+		require.NoError(t, err)
+
+		_, err = storage.MsgUpdate(ctx, &reqMsg)
+		require.EqualError(t, err, "NotImplemented (238): $replaceWith is not supported in updates with an aggregation pipeline")
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
 }
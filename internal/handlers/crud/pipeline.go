@@ -0,0 +1,880 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// pipeline is an aggregation pipeline. Leading $match stages are pushed down
+// to SAP HANA as a WHERE clause, and a following $group, $lookup, $sample or $project if SAP HANA can compute it.
+// All other stages are processed one after another.
+type pipeline struct {
+	h          *storage
+	db         string
+	collection string
+	filter     types.Document
+	stages     []stage
+	specs      []types.Document
+
+	// pushed is the number of stages after the $match stages computed by SAP HANA
+	pushed int
+}
+
+// stage is a pipeline stage processing the documents returned by the previous stage.
+type stage interface {
+	process(ctx context.Context, docs []types.Document) ([]types.Document, error)
+}
+
+// pushedStage is a stage which SAP HANA can compute for the documents selected by the leading $match stages.
+type pushedStage interface {
+	stage
+
+	// pushdown returns true if SAP HANA can compute the stage.
+	pushdown() bool
+
+	// pushedSQL returns the SQL computing the stage for the documents of the collection matching the filter,
+	// whose values are bound to parameters of placeholder.
+	pushedSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error)
+
+	// scan returns the resulting documents of the rows selected by the SQL.
+	scan(ctx context.Context, rows *sql.Rows) ([]types.Document, error)
+}
+
+// newPipeline parses the stages of an aggregation pipeline.
+// With decimal $sum and $avg of $group compute with exact decimals instead of doubles.
+func (h *storage) newPipeline(db, collection string, stages *types.Array, decimal bool) (*pipeline, error) {
+	p := &pipeline{
+		h:          h,
+		db:         db,
+		collection: collection,
+	}
+
+	var matches []any
+	for i := 0; i < stages.Len(); i++ {
+		s, _ := stages.Get(i)
+		stageDoc, ok := s.(types.Document)
+		if !ok || len(stageDoc.Keys()) != 1 {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "A pipeline stage specification object must contain exactly one field.")
+		}
+
+		name := stageDoc.Keys()[0]
+		value := stageDoc.Map()[name]
+
+		if name != "$match" {
+			p.specs = append(p.specs, stageDoc)
+		}
+
+		if (name == "$out" || name == "$merge") && i != stages.Len()-1 {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "%s can only be the final stage in the pipeline", name)
+		}
+
+		switch name {
+		case "$match":
+			filter, ok := value.(types.Document)
+			if !ok {
+				return nil, common.NewErrorMessage(common.ErrBadValue, "the match filter must be an expression in an object")
+			}
+			if len(p.stages) != 0 {
+				return nil, common.NewErrorMessage(common.ErrNotImplemented, "$match is only supported before all other stages")
+			}
+			matches = append(matches, filter)
+		case "$group":
+			group, err := newGroupStage(value, decimal)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, group)
+		case "$project":
+			project, err := newProjectStage(value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, project)
+		case "$addFields", "$set":
+			addFields, err := newAddFieldsStage(name, value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, addFields)
+		case "$sample":
+			sample, err := newSampleStage(value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, sample)
+		case "$lookup":
+			lookup, err := newLookupStage(h, db, value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, lookup)
+		case "$out":
+			out, err := newOutStage(h, db, value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, out)
+		case "$merge":
+			merge, err := newMergeStage(h, db, value)
+			if err != nil {
+				return nil, err
+			}
+			p.stages = append(p.stages, merge)
+		default:
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "support for stage %s is not implemented yet", name)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+	case 1:
+		p.filter = matches[0].(types.Document)
+	default:
+		p.filter = types.MustMakeDocument("$and", types.MustNewArray(matches...))
+	}
+
+	if len(p.stages) > 0 {
+		if s, ok := p.stages[0].(pushedStage); ok && s.pushdown() {
+			p.pushed = 1
+		}
+	}
+
+	return p, nil
+}
+
+// run executes the pipeline and returns the resulting documents.
+func (p *pipeline) run(ctx context.Context) ([]types.Document, error) {
+	docs, err := p.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range p.stages[p.pushed:] {
+		if docs, err = s.process(ctx, docs); err != nil {
+			return nil, err
+		}
+	}
+
+	return docs, nil
+}
+
+// fetch returns the documents computed by SAP HANA with the stages pushed down to it.
+func (p *pipeline) fetch(ctx context.Context) ([]types.Document, error) {
+	if p.pushed == 0 {
+		return p.h.fetchDocuments(ctx, p.db, p.collection, p.filter)
+	}
+
+	if ok, err := p.h.hasDocuments(ctx, p.db, p.collection); !ok || err != nil {
+		return nil, err
+	}
+
+	if s, ok := p.stages[0].(*sampleStage); ok {
+		return p.fetchSample(ctx, s)
+	}
+
+	docs, err := p.query(ctx)
+	if err == errUnsupportedTypes {
+		// the compatibility layer groups documents and arrays and compares the values of different types in the BSON order
+		p.pushed = 0
+		return p.h.fetchDocuments(ctx, p.db, p.collection, p.filter)
+	}
+
+	return docs, err
+}
+
+// fetchSample returns the documents sampled by SAP HANA. TABLESAMPLE first samples about twice as many documents
+// of the collection as needed, so that only they are ordered randomly. If fewer than size of them match the filter,
+// all documents matching it are ordered randomly instead.
+func (p *pipeline) fetchSample(ctx context.Context, s *sampleStage) ([]types.Document, error) {
+	stats, err := p.h.hanaPool.TableStats(ctx, p.db, p.collection)
+	if err != nil {
+		return nil, err
+	}
+	s.percent = samplePercent(s.size, stats.Rows)
+
+	docs, err := p.query(ctx)
+	if err != nil || s.percent == 0 || int64(len(docs)) >= s.size {
+		return docs, err
+	}
+
+	s.percent = 0
+	return p.query(ctx)
+}
+
+// query returns the documents computed by SAP HANA with the SQL of the stages pushed down to it.
+func (p *pipeline) query(ctx context.Context) ([]types.Document, error) {
+	query, args, err := p.cursorSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := p.h.hanaPool.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	return p.stages[0].(pushedStage).scan(ctx, rows)
+}
+
+// cursorSQL returns the SQL of the stages pushed down to SAP HANA and the values of its parameters.
+func (p *pipeline) cursorSQL() (string, []any, error) {
+	var placeholder common.Placeholder
+
+	var query string
+	var err error
+	if p.pushed == 0 {
+		query, err = documentsSQL(p.db, p.collection, p.filter, &placeholder)
+	} else {
+		query, err = p.stages[0].(pushedStage).pushedSQL(p.db, p.collection, p.filter, &placeholder)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return query, placeholder.Args(), nil
+}
+
+// hasDocuments returns false if the collection does not exist or is one of the emptySystemCollections.
+func (h *storage) hasDocuments(ctx context.Context, db, collection string) (bool, error) {
+	if isEmptySystemCollection(collection) {
+		return false, nil
+	}
+
+	return h.hanaPool.NamespaceExists(ctx, db, collection)
+}
+
+// fetchDocuments returns all documents of the collection matching the filter.
+// A collection which does not exist has no documents, neither have the emptySystemCollections.
+func (h *storage) fetchDocuments(ctx context.Context, db, collection string, filter types.Document) ([]types.Document, error) {
+	if ok, err := h.hasDocuments(ctx, db, collection); !ok || err != nil {
+		return nil, err
+	}
+
+	var placeholder common.Placeholder
+	query, err := documentsSQL(db, collection, filter, &placeholder)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := h.hanaPool.QueryContext(ctx, query, placeholder.Args()...)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	return scanDocuments(rows)
+}
+
+// scanDocuments returns the documents selected by the rows.
+func scanDocuments(rows *sql.Rows) ([]types.Document, error) {
+	var docs []types.Document
+	for {
+		doc, err := nextRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		if doc == nil {
+			break
+		}
+		docs = append(docs, *doc)
+	}
+
+	return docs, nil
+}
+
+// documentsSQL returns the SQL selecting the documents of the collection matching the filter.
+func documentsSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	from, err := fromSQL(db, collection, filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	return "SELECT * FROM " + from, nil
+}
+
+// fromSQL returns the collection and the WHERE clause of the filter, which follow FROM.
+// The values of the filter are bound to parameters of placeholder.
+func fromSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	whereSQL, err := common.CreateWhereClause(filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("\"%s\".\"%s\"", db, collection) + whereSQL, nil
+}
+
+// checkPrivilege returns Unauthorized if a collection of another database than the one
+// of the command is used without the needed privileges.
+// The user of the context, like the one of the client certificate, needs them for every collection.
+func (h *storage) checkPrivilege(ctx context.Context, commandDB, db, collection string, privileges ...string) error {
+	if db == commandDB && hana.User(ctx) == "" {
+		return nil
+	}
+
+	for _, privilege := range privileges {
+		ok, err := h.hanaPool.HasPrivilege(ctx, db, collection, privilege)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return common.NewErrorMessage(common.ErrUnauthorized, "not authorized on %s to execute %s on collection %s", db, strings.ToLower(privilege), collection)
+		}
+	}
+
+	return nil
+}
+
+// parseNamespace parses a collection given either as "collection" or as {db: "database", coll: "collection"},
+// and validates it for the access of the stage.
+func parseNamespace(stageName string, value any, defaultDB string, access common.NamespaceAccess) (db, collection string, err error) {
+	switch value := value.(type) {
+	case string:
+		db, collection = defaultDB, value
+	case types.Document:
+		var ok bool
+		if db, ok = value.Map()["db"].(string); !ok {
+			err = common.NewErrorMessage(common.ErrBadValue, "%s needs the database given as db", stageName)
+			return
+		}
+		if collection, ok = value.Map()["coll"].(string); !ok {
+			err = common.NewErrorMessage(common.ErrBadValue, "%s needs the collection given as coll", stageName)
+			return
+		}
+	default:
+		err = common.NewErrorMessage(common.ErrBadValue, "%s needs a collection name or an object with db and coll. Got instead: %T", stageName, value)
+		return
+	}
+
+	if collection == "" || db == "" {
+		err = common.NewErrorMessage(common.ErrBadValue, "%s needs a non-empty database and collection name", stageName)
+		return
+	}
+
+	err = common.ValidateNamespace(db, collection, access)
+
+	return
+}
+
+// lookupStage implements $lookup with localField and foreignField.
+// The foreign collection may be in another database.
+// In the same database, SAP HANA joins the documents of the leading $match stages with a LEFT OUTER JOIN.
+type lookupStage struct {
+	h            *storage
+	db           string
+	fromDB       string
+	from         string
+	localField   string
+	foreignField string
+	as           string
+}
+
+func newLookupStage(h *storage, db string, value any) (*lookupStage, error) {
+	doc, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "the $lookup specification must be an object")
+	}
+
+	if err := common.Unimplemented(&doc, "let", "pipeline"); err != nil {
+		return nil, err
+	}
+
+	s := &lookupStage{h: h, db: db}
+
+	from, ok := doc.Map()["from"]
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "$lookup needs from")
+	}
+
+	var err error
+	if s.fromDB, s.from, err = parseNamespace("$lookup", from, db, common.NamespaceRead); err != nil {
+		return nil, err
+	}
+
+	for key, field := range map[string]*string{"localField": &s.localField, "foreignField": &s.foreignField, "as": &s.as} {
+		if *field, ok = doc.Map()[key].(string); !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "$lookup needs %s given as a string", key)
+		}
+	}
+
+	if strings.Contains(s.as, ".") {
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "$lookup does not support nested fields for as")
+	}
+
+	return s, nil
+}
+
+func (s *lookupStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	if err := s.h.checkPrivilege(ctx, s.db, s.fromDB, s.from, hana.PrivilegeSelect); err != nil {
+		return nil, err
+	}
+
+	matches, err := s.lookup(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range docs {
+		if err = docs[i].Set(s.as, matches[i]); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return docs, nil
+}
+
+// lookupBatchSize is the maximum number of documents whose foreign documents are fetched by one query.
+const lookupBatchSize = 1000
+
+// lookup returns the documents of the foreign collection matching each of the documents.
+// The foreign documents of up to lookupBatchSize documents are fetched by one query matching any of their local values,
+// and are then matched to the documents.
+func (s *lookupStage) lookup(ctx context.Context, docs []types.Document) ([]*types.Array, error) {
+	matches := make([]*types.Array, len(docs))
+	locals := make([][]any, len(docs))
+	for i := range docs {
+		matches[i] = types.MakeArray(0)
+		locals[i] = s.localValues(docs[i])
+	}
+
+	for start := 0; start < len(docs); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+
+		var values []any
+		for _, local := range locals[start:end] {
+			values = append(values, local...)
+		}
+		values = distinctValues(values)
+		if len(values) == 0 {
+			continue
+		}
+
+		conditions := make([]any, len(values))
+		for j, v := range values {
+			conditions[j] = types.MustMakeDocument(s.foreignField, v)
+		}
+		filter := conditions[0].(types.Document)
+		if len(conditions) > 1 {
+			filter = types.MustMakeDocument("$or", types.MustNewArray(conditions...))
+		}
+
+		foreign, err := s.h.fetchDocuments(ctx, s.fromDB, s.from, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := start; i < end; i++ {
+			for _, f := range foreign {
+				if !s.matches(locals[i], f) {
+					continue
+				}
+				if err = matches[i].Append(f); err != nil {
+					return nil, lazyerrors.Error(err)
+				}
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// localValues returns the values of the local field of the document which foreign documents match:
+// the elements of an array, and null for a missing field, which matches null and missing foreign fields.
+func (s *lookupStage) localValues(doc types.Document) []any {
+	local, err := doc.GetByPath(strings.Split(s.localField, ".")...)
+	if err != nil {
+		return []any{nil}
+	}
+
+	arr, ok := local.(*types.Array)
+	if !ok {
+		return []any{local}
+	}
+
+	// an array matches if any of its elements matches
+	res := make([]any, arr.Len())
+	for i := range res {
+		res[i], _ = arr.Get(i)
+	}
+
+	return res
+}
+
+// matches returns true if the foreign field of the foreign document equals one of the local values,
+// or is an array with an element equal to one of them. A missing field equals null.
+func (s *lookupStage) matches(locals []any, foreign types.Document) bool {
+	f, err := foreign.GetByPath(strings.Split(s.foreignField, ".")...)
+	if err != nil {
+		f = nil
+	}
+
+	candidates := []any{f}
+	if arr, ok := f.(*types.Array); ok {
+		for i := 0; i < arr.Len(); i++ {
+			v, _ := arr.Get(i)
+			candidates = append(candidates, v)
+		}
+	}
+
+	for _, local := range locals {
+		for _, c := range candidates {
+			if types.Compare(local, c) == 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// distinctValues returns the values without duplicates, in the BSON comparison order.
+func distinctValues(values []any) []any {
+	sort.SliceStable(values, func(i, j int) bool { return types.Compare(values[i], values[j]) < 0 })
+
+	res := values[:0]
+	for i, v := range values {
+		if i == 0 || types.Compare(res[len(res)-1], v) != 0 {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// pushdown implements pushedStage interface. SAP HANA joins collections of the same database.
+func (s *lookupStage) pushdown() bool {
+	return s.fromDB == s.db
+}
+
+// pushedSQL implements pushedStage interface.
+// The SELECT joining the documents has a column with the document of the collection,
+// and one with the matching foreign document, which is null for documents without one.
+func (s *lookupStage) pushedSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	query, err := documentsSQL(db, collection, filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	on, err := common.JoinSQL("l", s.localField, "f", s.foreignField)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("SELECT * FROM (%s) AS \"l\" LEFT OUTER JOIN \"%s\".\"%s\" AS \"f\" ON %s", query, s.fromDB, s.from, on), nil
+}
+
+// scan implements pushedStage interface.
+// The joined rows of a document are nested into its as field.
+// Documents whose local field is an array are looked up like in process, as SAP HANA only joins equal values.
+func (s *lookupStage) scan(ctx context.Context, rows *sql.Rows) ([]types.Document, error) {
+	var docs []types.Document
+	var matches []*types.Array
+	index := make(map[string]int)
+
+	for rows.Next() {
+		var local, foreign []byte
+		if err := rows.Scan(&local, &foreign); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		i, ok := index[string(local)]
+		if !ok {
+			doc, err := decodeRow(local)
+			if err != nil {
+				return nil, err
+			}
+
+			i = len(docs)
+			index[string(local)] = i
+			docs = append(docs, *doc)
+			matches = append(matches, types.MakeArray(0))
+		}
+
+		if foreign == nil {
+			continue
+		}
+
+		doc, err := decodeRow(foreign)
+		if err != nil {
+			return nil, err
+		}
+		if err = matches[i].Append(*doc); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	// the documents whose local field is an array are looked up together
+	var arrays []int
+	for i := range docs {
+		if local, err := docs[i].GetByPath(strings.Split(s.localField, ".")...); err == nil {
+			if _, ok := local.(*types.Array); ok {
+				arrays = append(arrays, i)
+			}
+		}
+	}
+
+	if len(arrays) > 0 {
+		arrayDocs := make([]types.Document, len(arrays))
+		for j, i := range arrays {
+			arrayDocs[j] = docs[i]
+		}
+
+		arrayMatches, err := s.lookup(ctx, arrayDocs)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range arrays {
+			matches[i] = arrayMatches[j]
+		}
+	}
+
+	for i := range docs {
+		if err := docs[i].Set(s.as, matches[i]); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return docs, nil
+}
+
+// outStage implements $out by replacing all documents of the target collection.
+type outStage struct {
+	h          *storage
+	db         string
+	targetDB   string
+	collection string
+}
+
+func newOutStage(h *storage, db string, value any) (*outStage, error) {
+	s := &outStage{h: h, db: db}
+
+	var err error
+	if s.targetDB, s.collection, err = parseNamespace("$out", value, db, common.NamespaceWrite); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *outStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	if hana.InTransaction(ctx) {
+		return nil, common.NewErrorMessage(common.ErrOperationNotSupportedInTransaction, "$out cannot be used in a transaction")
+	}
+
+	if err := s.h.checkPrivilege(ctx, s.db, s.targetDB, s.collection, hana.PrivilegeInsert, hana.PrivilegeDelete); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.h.writableCollectionOptions(ctx, s.targetDB, s.collection); err != nil {
+		return nil, err
+	}
+
+	if err := s.h.hanaPool.CreateNamespaceIfNotExists(ctx, s.targetDB, s.collection); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.h.hanaPool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM \"%s\".\"%s\"", s.targetDB, s.collection)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	for _, doc := range docs {
+		if err = insertIntoTx(ctx, tx, s.targetDB, s.collection, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return nil, nil
+}
+
+// mergeStage implements $merge on _id.
+type mergeStage struct {
+	h              *storage
+	db             string
+	targetDB       string
+	collection     string
+	whenMatched    string
+	whenNotMatched string
+}
+
+func newMergeStage(h *storage, db string, value any) (*mergeStage, error) {
+	s := &mergeStage{h: h, db: db, whenMatched: "merge", whenNotMatched: "insert"}
+
+	into := value
+	if doc, ok := value.(types.Document); ok {
+		if err := common.Unimplemented(&doc, "let"); err != nil {
+			return nil, err
+		}
+
+		if on, ok := doc.Map()["on"]; ok && on != "_id" {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "$merge only supports _id for on")
+		}
+
+		if into, ok = doc.Map()["into"]; !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "$merge needs into")
+		}
+
+		if v, ok := doc.Map()["whenMatched"]; ok {
+			whenMatched, ok := v.(string)
+			switch {
+			case !ok:
+				return nil, common.NewErrorMessage(common.ErrNotImplemented, "$merge does not support a pipeline for whenMatched")
+			case whenMatched != "replace" && whenMatched != "keepExisting" && whenMatched != "merge" && whenMatched != "fail":
+				return nil, common.NewErrorMessage(common.ErrBadValue, "Enumeration value '%s' for field 'whenMatched' is not a valid value.", whenMatched)
+			}
+			s.whenMatched = whenMatched
+		}
+
+		if v, ok := doc.Map()["whenNotMatched"]; ok {
+			whenNotMatched, _ := v.(string)
+			if whenNotMatched != "insert" && whenNotMatched != "discard" && whenNotMatched != "fail" {
+				return nil, common.NewErrorMessage(common.ErrBadValue, "Enumeration value '%v' for field 'whenNotMatched' is not a valid value.", v)
+			}
+			s.whenNotMatched = whenNotMatched
+		}
+	}
+
+	var err error
+	if s.targetDB, s.collection, err = parseNamespace("$merge", into, db, common.NamespaceWrite); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *mergeStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	if hana.InTransaction(ctx) {
+		return nil, common.NewErrorMessage(common.ErrOperationNotSupportedInTransaction, "$merge cannot be used in a transaction")
+	}
+
+	if err := s.h.checkPrivilege(ctx, s.db, s.targetDB, s.collection, hana.PrivilegeSelect, hana.PrivilegeInsert, hana.PrivilegeDelete); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.h.writableCollectionOptions(ctx, s.targetDB, s.collection); err != nil {
+		return nil, err
+	}
+
+	if err := s.h.hanaPool.CreateNamespaceIfNotExists(ctx, s.targetDB, s.collection); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.h.hanaPool.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer tx.Rollback()
+
+	for _, doc := range docs {
+		id, ok := doc.Map()["_id"]
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "$merge does not support documents without _id")
+		}
+
+		var placeholder common.Placeholder
+		idFilter, err := common.CreateWhereClause(types.MustMakeDocument("_id", id), &placeholder)
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := nextDocument(ctx, tx, fmt.Sprintf("SELECT * FROM \"%s\".\"%s\"", s.targetDB, s.collection)+idFilter+" LIMIT 1", placeholder.Args()...)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing == nil {
+			switch s.whenNotMatched {
+			case "insert":
+				err = insertIntoTx(ctx, tx, s.targetDB, s.collection, doc)
+			case "fail":
+				err = common.NewErrorMessage(common.ErrBadValue, "$merge could not find a matching document in the target collection for at least one document in the source collection")
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch s.whenMatched {
+		case "keepExisting":
+			continue
+		case "fail":
+			return nil, common.NewErrorMessage(common.ErrBadValue, "$merge found a document with the same _id in the target collection")
+		case "merge":
+			for _, k := range doc.Keys() {
+				if err = existing.Set(k, doc.Map()[k]); err != nil {
+					return nil, lazyerrors.Error(err)
+				}
+			}
+			doc = *existing
+		}
+
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM \"%s\".\"%s\"", s.targetDB, s.collection)+idFilter, placeholder.Args()...); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		if err = insertIntoTx(ctx, tx, s.targetDB, s.collection, doc); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return nil, nil
+}
+
+// insertIntoTx inserts the document within the transaction.
+func insertIntoTx(ctx context.Context, tx *sql.Tx, db, collection string, doc types.Document) error {
+	b, err := bson.MustConvertDocument(doc).MarshalJSONHANA()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO \"%s\".\"%s\" VALUES ($1)", db, collection), b); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// nextDocument returns the first document selected by the statement with the arguments within the transaction
+// or nil if there is none.
+func nextDocument(ctx context.Context, tx *sql.Tx, sqlStmt string, args ...any) (*types.Document, error) {
+	rows, err := tx.QueryContext(ctx, sqlStmt, args...)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	defer rows.Close()
+
+	return nextRow(rows)
+}
@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// projectStage implements $project with inclusions, exclusions and computed top-level fields.
+// SAP HANA computes it with its JSON projection if it only includes top-level fields
+// and computes fields with expressions it supports.
+// Exclusions are applied while the rows are scanned, as the JSON projection cannot leave fields out.
+type projectStage struct {
+	// projection are the included or excluded fields
+	projection types.Document
+
+	// computed are the expressions of the computed fields
+	computed types.Document
+
+	// excludeID is true if _id is excluded
+	excludeID bool
+}
+
+func newProjectStage(value any) (*projectStage, error) {
+	spec, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "$project specification must be an object")
+	}
+	if len(spec.Keys()) == 0 {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "$project requires at least one output field")
+	}
+
+	s := &projectStage{projection: types.MustMakeDocument(), computed: types.MustMakeDocument()}
+	var inclusion, exclusion string
+	for _, k := range spec.Keys() {
+		v := spec.Map()[k]
+
+		if include, ok := projectionFlag(v); ok {
+			if k == "_id" {
+				s.excludeID = !include
+			} else if include {
+				inclusion = k
+			} else {
+				exclusion = k
+			}
+			if err := s.projection.Set(k, v); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+			continue
+		}
+
+		if strings.Contains(k, ".") {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "$project does not support computed embedded fields like %s yet", k)
+		}
+		if doc, ok := v.(types.Document); ok {
+			if _, ok := expressionOperator(doc); !ok {
+				return nil, common.NewErrorMessage(common.ErrNotImplemented, "$project does not support nested projections like %s yet", k)
+			}
+		}
+		if err := validateExpression(v); err != nil {
+			return nil, err
+		}
+
+		inclusion = k
+		if err := s.computed.Set(k, v); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if inclusion != "" && exclusion != "" {
+		return nil, common.NewErrorMessage(common.ErrProjectionExIn, "Cannot do exclusion on field %s in inclusion projection", exclusion)
+	}
+
+	return s, nil
+}
+
+// projectionFlag returns whether a value of $project like 1 or false includes the field,
+// and false for values which are expressions.
+func projectionFlag(v any) (include bool, ok bool) {
+	switch v := v.(type) {
+	case bool:
+		return v, true
+	case int32:
+		return v != 0, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	default:
+		return false, false
+	}
+}
+
+// isExclusion returns true if the stage only excludes fields, or only _id.
+func (s *projectStage) isExclusion() bool {
+	if len(s.computed.Keys()) > 0 {
+		return false
+	}
+
+	for _, k := range s.projection.Keys() {
+		if include, _ := projectionFlag(s.projection.Map()[k]); include && k != "_id" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// process implements stage interface.
+func (s *projectStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	if s.isExclusion() {
+		return projectDocuments(docs, s.projection)
+	}
+
+	// the computed fields are computed from the documents before the projection
+	values := make([][]any, len(docs))
+	for i, doc := range docs {
+		values[i] = make([]any, len(s.computed.Keys()))
+		for j, k := range s.computed.Keys() {
+			v, err := evalExpression(doc, s.computed.Map()[k])
+			if err != nil {
+				return nil, err
+			}
+			values[i][j] = v
+		}
+	}
+
+	pairs := []any{"_id", !s.excludeID}
+	for _, k := range s.projection.Keys() {
+		if k != "_id" {
+			pairs = append(pairs, k, true)
+		}
+	}
+
+	res := make([]types.Document, len(docs))
+	if len(pairs) > 2 {
+		var err error
+		if res, err = projectDocuments(docs, types.MustMakeDocument(pairs...)); err != nil {
+			return nil, err
+		}
+	} else {
+		// only _id and computed fields
+		for i, doc := range docs {
+			res[i] = types.MustMakeDocument()
+			if id, ok := doc.Map()["_id"]; ok && !s.excludeID {
+				res[i] = types.MustMakeDocument("_id", id)
+			}
+		}
+	}
+
+	for i := range res {
+		for j, k := range s.computed.Keys() {
+			// a missing field is left out
+			if values[i][j] == nil && isMissing(docs[i], s.computed.Map()[k]) {
+				continue
+			}
+			if err := res[i].Set(k, values[i][j]); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// pushdown implements pushedStage interface.
+// SAP HANA computes inclusions of top-level fields and computed fields of supported expressions.
+// For exclusions it selects the documents, whose excluded top-level fields are then not decoded.
+func (s *projectStage) pushdown() bool {
+	if s.isExclusion() {
+		return true
+	}
+
+	for _, k := range s.projection.Keys() {
+		if strings.Contains(k, ".") {
+			return false
+		}
+	}
+
+	for _, k := range s.computed.Keys() {
+		if _, err := common.ExpressionSQL(s.computed.Map()[k], new(common.Placeholder)); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pushedSQL implements pushedStage interface.
+// The JSON projection builds the documents of the included fields and the computed fields.
+func (s *projectStage) pushedSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	if s.isExclusion() {
+		return documentsSQL(db, collection, filter, placeholder)
+	}
+
+	var fields []string
+	if !s.excludeID {
+		fields = append(fields, "\"_id\": \"_id\"")
+	}
+
+	for _, k := range s.projection.Keys() {
+		if k == "_id" {
+			continue
+		}
+
+		kSQL, err := common.FieldSQL(k)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, kSQL+": "+kSQL)
+	}
+
+	for _, k := range s.computed.Keys() {
+		kSQL, err := common.FieldSQL(k)
+		if err != nil {
+			return "", err
+		}
+
+		exprSQL, err := common.ExpressionSQL(s.computed.Map()[k], placeholder)
+		if err != nil {
+			return "", err
+		}
+		fields = append(fields, kSQL+": ("+exprSQL+")")
+	}
+
+	// the parameters of the filter follow the ones of the computed fields
+	from, err := fromSQL(db, collection, filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	return "SELECT {" + strings.Join(fields, ", ") + "} FROM " + from, nil
+}
+
+// scan implements pushedStage interface.
+// The values of excluded top-level fields are skipped, and excluded embedded fields are removed afterwards.
+func (s *projectStage) scan(ctx context.Context, rows *sql.Rows) ([]types.Document, error) {
+	if !s.isExclusion() {
+		return scanDocuments(rows)
+	}
+
+	omit, err := common.ExcludedFields(s.projection)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []types.Document
+	for {
+		b, err := nextRowBytes(rows)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			break
+		}
+
+		doc, err := decodeRow(b, omit...)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+
+	if len(omit) == len(s.projection.Keys()) {
+		return docs, nil
+	}
+
+	return projectDocuments(docs, s.projection)
+}
+
+// addFieldsStage implements $addFields and its alias $set, which add computed fields to the documents.
+type addFieldsStage struct {
+	fields types.Document
+}
+
+func newAddFieldsStage(name string, value any) (*addFieldsStage, error) {
+	spec, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "%s specification stage must be an object", name)
+	}
+
+	for _, k := range spec.Keys() {
+		if strings.Contains(k, ".") {
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "%s does not support embedded fields like %s yet", name, k)
+		}
+		if err := validateExpression(spec.Map()[k]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &addFieldsStage{fields: spec}, nil
+}
+
+// process implements stage interface.
+// All fields are computed from the document before the stage.
+func (s *addFieldsStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	for i := range docs {
+		values := make([]any, len(s.fields.Keys()))
+		for j, k := range s.fields.Keys() {
+			v, err := evalExpression(docs[i], s.fields.Map()[k])
+			if err != nil {
+				return nil, err
+			}
+			values[j] = v
+		}
+
+		for j, k := range s.fields.Keys() {
+			// a missing field is left out
+			if values[j] == nil && isMissing(docs[i], s.fields.Map()[k]) {
+				continue
+			}
+			if err := docs[i].Set(k, values[j]); err != nil {
+				return nil, lazyerrors.Error(err)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// projectDocuments returns the documents projected with common.ProjectDocuments.
+func projectDocuments(docs []types.Document, projection types.Document) ([]types.Document, error) {
+	arr := types.MakeArray(len(docs))
+	for _, doc := range docs {
+		if err := arr.Append(doc); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if err := common.ProjectDocuments(arr, projection); err != nil {
+		return nil, err
+	}
+
+	res := make([]types.Document, arr.Len())
+	for i := range res {
+		v, _ := arr.Get(i)
+		res[i] = v.(types.Document)
+	}
+
+	return res, nil
+}
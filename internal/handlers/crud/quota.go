@@ -0,0 +1,326 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Quota limits the results of queries of users with a SAP HANA role,
+// so that ad-hoc access to production collections cannot accidentally dump entire tables.
+// Zero values mean no limit.
+type Quota struct {
+	// MaxDocumentsPerQuery is the maximum number of documents returned by a find or aggregate.
+	MaxDocumentsPerQuery int64 `json:"maxDocumentsPerQuery"`
+
+	// MaxResultBytesPerMinute is the maximum BSON size of all documents returned within a minute.
+	MaxResultBytesPerMinute int64 `json:"maxResultBytesPerMinute"`
+}
+
+// Quotas enforces the quotas of SAP HANA roles. It is shared by all connections,
+// so that the result bytes of a role are counted across them.
+type Quotas struct {
+	rw      sync.Mutex
+	quotas  map[string]Quota
+	windows map[string]*quotaWindow
+
+	// the file the quotas were loaded from, see Watch
+	path      string
+	version   string
+	loadedAt  time.Time
+	lastError error
+}
+
+// QuotasStatus describes the active quotas.
+type QuotasStatus struct {
+	// Path is the file the quotas were loaded from, empty if they were not loaded from a file.
+	Path string
+
+	// Version is the beginning of the SHA-256 of the file contents.
+	Version string
+
+	// LoadedAt is when the active quotas were loaded.
+	LoadedAt time.Time
+
+	// Roles is the number of roles with quotas.
+	Roles int
+
+	// LastError is why the latest change of the file was rejected, nil if it was applied.
+	LastError error
+}
+
+// quotaWindow counts the result bytes of a role within the current minute.
+type quotaWindow struct {
+	start time.Time
+	bytes int64
+}
+
+// NewQuotas returns the quotas for the given roles.
+func NewQuotas(quotas map[string]Quota) *Quotas {
+	return &Quotas{
+		quotas:  quotas,
+		windows: make(map[string]*quotaWindow),
+	}
+}
+
+// LoadQuotas reads the quotas from a JSON file like {"ANALYST": {"maxDocumentsPerQuery": 1000}}.
+func LoadQuotas(path string) (*Quotas, error) {
+	quotas, version, err := readQuotas(path)
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewQuotas(quotas)
+	q.path = path
+	q.version = version
+	q.loadedAt = time.Now()
+
+	return q, nil
+}
+
+// readQuotas reads and validates the quotas file and returns the quotas and their version.
+func readQuotas(path string) (map[string]Quota, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", lazyerrors.Error(err)
+	}
+
+	var quotas map[string]Quota
+	if err = json.Unmarshal(b, &quotas); err != nil {
+		return nil, "", lazyerrors.Error(err)
+	}
+
+	for role, quota := range quotas {
+		if role == "" {
+			return nil, "", fmt.Errorf("%s: role name must not be empty", path)
+		}
+		if quota.MaxDocumentsPerQuery < 0 || quota.MaxResultBytesPerMinute < 0 {
+			return nil, "", fmt.Errorf("%s: quotas of role %s must not be negative", path, role)
+		}
+	}
+
+	sum := sha256.Sum256(b)
+
+	return quotas, hex.EncodeToString(sum[:6]), nil
+}
+
+// Watch checks the file the quotas were loaded from every interval until ctx is canceled.
+// A changed file is validated and replaces the quotas of all connections at once;
+// an invalid file is logged and the active quotas stay in place.
+func (q *Quotas) Watch(ctx context.Context, interval time.Duration, l *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// the same error is only logged once
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := q.reload()
+		switch {
+		case err != nil && err.Error() != lastErr:
+			l.Warn("Failed to reload quotas, keeping the active ones", zap.String("path", q.path), zap.Error(err))
+		case reloaded:
+			l.Info("Reloaded quotas", zap.String("path", q.path), zap.String("version", q.Status().Version))
+		}
+
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+	}
+}
+
+// reload replaces the quotas if the file changed and is valid.
+func (q *Quotas) reload() (bool, error) {
+	quotas, version, err := readQuotas(q.path)
+
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	q.lastError = err
+	if err != nil || version == q.version {
+		return false, err
+	}
+
+	// the result bytes of the current minute are still counted for the roles
+	q.quotas = quotas
+	q.version = version
+	q.loadedAt = time.Now()
+
+	return true, nil
+}
+
+// Status returns the description of the active quotas.
+func (q *Quotas) Status() QuotasStatus {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	return QuotasStatus{
+		Path:      q.path,
+		Version:   q.version,
+		LoadedAt:  q.loadedAt,
+		Roles:     len(q.quotas),
+		LastError: q.lastError,
+	}
+}
+
+// check returns Unauthorized if the documents exceed a quota of one of the roles.
+// Otherwise their size is added to the result bytes of the current minute.
+func (q *Quotas) check(roles []string, docs []types.Document, now time.Time) error {
+	var size int64
+	var sized bool
+
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	for _, role := range roles {
+		quota, ok := q.quotas[role]
+		if !ok {
+			continue
+		}
+
+		if quota.MaxDocumentsPerQuery > 0 && int64(len(docs)) > quota.MaxDocumentsPerQuery {
+			return errDocumentsQuota(quota.MaxDocumentsPerQuery, role)
+		}
+
+		if quota.MaxResultBytesPerMinute <= 0 {
+			continue
+		}
+
+		if !sized {
+			for _, doc := range docs {
+				l, err := bson.MustConvertDocument(doc).Size()
+				if err != nil {
+					return lazyerrors.Error(err)
+				}
+				size += int64(l)
+			}
+			sized = true
+		}
+
+		w := q.windows[role]
+		if w == nil || now.Sub(w.start) >= time.Minute {
+			w = &quotaWindow{start: now}
+			q.windows[role] = w
+		}
+
+		if w.bytes+size > quota.MaxResultBytesPerMinute {
+			return common.NewErrorMessage(common.ErrUnauthorized,
+				"query results would exceed %d bytes per minute, the maximum for role %s; try again later",
+				quota.MaxResultBytesPerMinute, role,
+			)
+		}
+	}
+
+	if !sized {
+		return nil
+	}
+
+	for _, role := range roles {
+		if w := q.windows[role]; w != nil && q.quotas[role].MaxResultBytesPerMinute > 0 {
+			w.bytes += size
+		}
+	}
+
+	return nil
+}
+
+// maxDocuments returns the smallest maximum number of documents per query of the roles and the role with it,
+// or 0 if none of them has one.
+func (q *Quotas) maxDocuments(roles []string) (int64, string) {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+
+	var limit int64
+	var limitRole string
+	for _, role := range roles {
+		if m := q.quotas[role].MaxDocumentsPerQuery; m > 0 && (limit == 0 || m < limit) {
+			limit, limitRole = m, role
+		}
+	}
+
+	return limit, limitRole
+}
+
+// errDocumentsQuota returns the error of a query returning more than the maximum number of documents of the role.
+func errDocumentsQuota(limit int64, role string) error {
+	return common.NewErrorMessage(common.ErrUnauthorized,
+		"query returned more than %d documents, the maximum for role %s; use a more selective filter or a limit",
+		limit, role,
+	)
+}
+
+// checkQuotas checks the documents returned by a query against the quotas of the roles of the connected user.
+func (h *storage) checkQuotas(ctx context.Context, docs []types.Document) error {
+	if !h.quotasActive() {
+		return nil
+	}
+
+	roles, err := h.userRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	return h.quotas.check(roles, docs, time.Now())
+}
+
+// documentsQuota returns the maximum number of documents a query of the connected user may return
+// and the role with it, or 0 if there is none.
+func (h *storage) documentsQuota(ctx context.Context) (int64, string, error) {
+	if !h.quotasActive() {
+		return 0, "", nil
+	}
+
+	roles, err := h.userRoles(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+
+	limit, role := h.quotas.maxDocuments(roles)
+	return limit, role, nil
+}
+
+// userRoles returns the roles of the SAP HANA user of the context, which authenticated the client,
+// or else of the user of the connect string. They are loaded once per user and connection.
+func (h *storage) userRoles(ctx context.Context) ([]string, error) {
+	if user := hana.User(ctx); h.roles == nil || h.rolesUser != user {
+		roles, err := h.hanaPool.Roles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		h.roles = roles
+		if h.roles == nil {
+			h.roles = []string{}
+		}
+		h.rolesUser = user
+	}
+
+	return h.roles, nil
+}
+
+// quotasActive returns true if there are quotas, which check the whole result of a query.
+func (h *storage) quotasActive() bool {
+	return h.quotas != nil && h.quotas.Status().Roles > 0
+}
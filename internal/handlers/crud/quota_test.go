@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestQuotas(t *testing.T) {
+	t.Parallel()
+
+	docs := []types.Document{
+		types.MustMakeDocument("_id", int32(1)),
+		types.MustMakeDocument("_id", int32(2)),
+	}
+	// each document has 14 bytes in BSON
+	now := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("MaxDocumentsPerQuery", func(t *testing.T) {
+		t.Parallel()
+
+		q := NewQuotas(map[string]Quota{"ANALYST": {MaxDocumentsPerQuery: 1}})
+
+		assert.NoError(t, q.check([]string{"PUBLIC"}, docs, now))
+		assert.NoError(t, q.check([]string{"ANALYST"}, docs[:1], now))
+
+		err := q.check([]string{"PUBLIC", "ANALYST"}, docs, now)
+		expected := common.NewErrorMessage(common.ErrUnauthorized,
+			"query returned more than 1 documents, the maximum for role ANALYST; use a more selective filter or a limit",
+		)
+		assert.Equal(t, expected, err)
+	})
+
+	t.Run("MaxResultBytesPerMinute", func(t *testing.T) {
+		t.Parallel()
+
+		q := NewQuotas(map[string]Quota{"ANALYST": {MaxResultBytesPerMinute: 42}})
+
+		assert.NoError(t, q.check([]string{"ANALYST"}, docs, now))
+
+		err := q.check([]string{"ANALYST"}, docs, now.Add(30*time.Second))
+		expected := common.NewErrorMessage(common.ErrUnauthorized,
+			"query results would exceed 42 bytes per minute, the maximum for role ANALYST; try again later",
+		)
+		assert.Equal(t, expected, err)
+
+		assert.NoError(t, q.check([]string{"ANALYST"}, docs[:1], now.Add(30*time.Second)))
+		assert.NoError(t, q.check([]string{"ANALYST"}, docs, now.Add(time.Minute)))
+	})
+}
+
+func TestCheckQuotas(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(QueryMatcherEqualBytes))
+	require.NoError(t, err)
+
+	s := NewStorage(&NewStorageOpts{
+		HanaPool: &hana.Hpool{DB: db},
+		Logger:   zaptest.NewLogger(t),
+		Quotas: NewQuotas(map[string]Quota{
+			"ANALYST": {MaxDocumentsPerQuery: 1},
+		}),
+		KeyValidation: common.RejectDottedDollarKeys,
+	}).(*storage)
+
+	// roles are only loaded once per connection
+	mock.ExpectQuery("SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE USER_NAME = CURRENT_USER").WillReturnRows(
+		sqlmock.NewRows([]string{"ROLE_NAME"}).AddRow("PUBLIC").AddRow("ANALYST"),
+	)
+
+	ctx := testutil.Ctx(t)
+	doc := types.MustMakeDocument("_id", int32(1))
+
+	assert.NoError(t, s.checkQuotas(ctx, []types.Document{doc}))
+	assert.Error(t, s.checkQuotas(ctx, []types.Document{doc, doc}))
+
+	// the roles are loaded again for the user authenticating the client
+	mock.ExpectQuery("SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE USER_NAME = ?").WithArgs("ALICE").WillReturnRows(
+		sqlmock.NewRows([]string{"ROLE_NAME"}).AddRow("PUBLIC"),
+	)
+
+	ctx = hana.WithUser(ctx, "ALICE")
+	assert.NoError(t, s.checkQuotas(ctx, []types.Document{doc, doc}))
+	assert.NoError(t, s.checkQuotas(ctx, []types.Document{doc, doc}))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestFindQuota(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(QueryMatcherEqualBytes))
+	require.NoError(t, err)
+
+	s := NewStorage(&NewStorageOpts{
+		HanaPool: &hana.Hpool{DB: db},
+		Logger:   zaptest.NewLogger(t),
+		Quotas: NewQuotas(map[string]Quota{
+			"ANALYST": {MaxDocumentsPerQuery: 2},
+		}),
+		KeyValidation: common.RejectDottedDollarKeys,
+	})
+
+	mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").
+		WithArgs("testDatabase", "testCollection").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE USER_NAME = CURRENT_USER").WillReturnRows(
+		sqlmock.NewRows([]string{"ROLE_NAME"}).AddRow("ANALYST"),
+	)
+
+	// reading stops at the first document exceeding the quota, the rest is not fetched
+	docRows := sqlmock.NewRows([]string{"document"})
+	for i := 1; i <= 3; i++ {
+		docRows.AddRow([]byte(fmt.Sprintf(`{"_id": %d}`, i)))
+	}
+	docRows.AddRow([]byte("not fetched")).RowError(3, errors.New("the fourth row was fetched"))
+	mock.ExpectQuery("SELECT * FROM \"testDatabase\".\"testCollection\"").WillReturnRows(docRows).RowsWillBeClosed()
+
+	var reqMsg wire.OpMsg
+	err = reqMsg.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"find", "testCollection",
+			"filter", types.MustMakeDocument(),
+			"$db", "testDatabase",
+		)},
+	})
+	require.NoError(t, err)
+
+	_, err = s.MsgFindOrCount(testutil.Ctx(t), &reqMsg)
+	expected := common.NewErrorMessage(common.ErrUnauthorized,
+		"query returned more than 2 documents, the maximum for role ANALYST; use a more selective filter or a limit",
+	)
+	assert.Equal(t, expected, err)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestQuotasReload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ANALYST": {"maxDocumentsPerQuery": 1}}`), 0o600))
+
+	q, err := LoadQuotas(path)
+	require.NoError(t, err)
+
+	docs := []types.Document{types.MustMakeDocument("_id", int32(1)), types.MustMakeDocument("_id", int32(2))}
+	now := time.Now()
+
+	loaded := q.Status()
+	assert.Equal(t, path, loaded.Path)
+	assert.Len(t, loaded.Version, 12)
+	assert.Equal(t, 1, loaded.Roles)
+	assert.Error(t, q.check([]string{"ANALYST"}, docs, now))
+
+	// an unchanged file is not reloaded
+	reloaded, err := q.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// an invalid file is rejected and the active quotas stay in place
+	require.NoError(t, os.WriteFile(path, []byte(`{"ANALYST": {"maxDocumentsPerQuery": -1}}`), 0o600))
+	reloaded, err = q.reload()
+	assert.EqualError(t, err, path+": quotas of role ANALYST must not be negative")
+	assert.False(t, reloaded)
+
+	status := q.Status()
+	assert.Equal(t, loaded.Version, status.Version)
+	assert.Equal(t, err, status.LastError)
+	assert.Error(t, q.check([]string{"ANALYST"}, docs, now))
+
+	// a valid change replaces the quotas
+	require.NoError(t, os.WriteFile(path, []byte(`{"ANALYST": {"maxDocumentsPerQuery": 2}, "GUEST": {}}`), 0o600))
+	reloaded, err = q.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	status = q.Status()
+	assert.NotEqual(t, loaded.Version, status.Version)
+	assert.Equal(t, 2, status.Roles)
+	assert.NoError(t, status.LastError)
+	assert.NoError(t, q.check([]string{"ANALYST"}, docs, now))
+}
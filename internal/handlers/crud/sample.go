@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// sampleOversampling is how many times more documents than the size of $sample are sampled by TABLESAMPLE,
+// so that rarely fewer than size of them are sampled.
+const sampleOversampling = 2
+
+// sampleStage implements $sample, which randomly selects size documents.
+type sampleStage struct {
+	size int64
+
+	// percent of the documents of the collection sampled by TABLESAMPLE when pushed down, 0 to not use it
+	percent float64
+}
+
+func newSampleStage(value any) (*sampleStage, error) {
+	spec, ok := value.(types.Document)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "the $sample stage specification must be an object")
+	}
+
+	s := new(sampleStage)
+	for _, k := range spec.Keys() {
+		if k != "size" {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "unrecognized option to $sample: %s", k)
+		}
+
+		switch size := spec.Map()[k].(type) {
+		case int32:
+			s.size = int64(size)
+		case int64:
+			s.size = size
+		case float64:
+			if size != math.Trunc(size) || size > math.MaxInt64 {
+				return nil, common.NewErrorMessage(common.ErrBadValue, "size argument to $sample must be an integer")
+			}
+			s.size = int64(size)
+		default:
+			return nil, common.NewErrorMessage(common.ErrBadValue, "size argument to $sample must be a number")
+		}
+	}
+
+	if _, ok := spec.Map()["size"]; !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "$sample stage must specify a size")
+	}
+	if s.size < 0 {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "size argument to $sample must not be negative")
+	}
+
+	return s, nil
+}
+
+// process implements stage interface.
+func (s *sampleStage) process(ctx context.Context, docs []types.Document) ([]types.Document, error) {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(docs), func(i, j int) { docs[i], docs[j] = docs[j], docs[i] })
+
+	if int64(len(docs)) > s.size {
+		docs = docs[:s.size]
+	}
+
+	return docs, nil
+}
+
+// pushdown implements pushedStage interface. SAP HANA always samples the documents of the leading $match stages.
+func (s *sampleStage) pushdown() bool {
+	return true
+}
+
+// pushedSQL implements pushedStage interface.
+// The documents sampled by TABLESAMPLE, or else all documents, are ordered randomly,
+// so that the first size documents are a uniform sample.
+func (s *sampleStage) pushedSQL(db, collection string, filter types.Document, placeholder *common.Placeholder) (string, error) {
+	whereSQL, err := common.CreateWhereClause(filter, placeholder)
+	if err != nil {
+		return "", err
+	}
+
+	table := fmt.Sprintf("\"%s\".\"%s\"", db, collection)
+	if s.percent > 0 {
+		table += " TABLESAMPLE BERNOULLI (" + strconv.FormatFloat(s.percent, 'f', -1, 64) + ")"
+	}
+
+	return "SELECT * FROM " + table + whereSQL + fmt.Sprintf(" ORDER BY RAND() LIMIT %d", s.size), nil
+}
+
+// samplePercent returns the percentage of the rows of a collection which TABLESAMPLE samples for a sample of size documents,
+// or 0 if it would sample all of them.
+func samplePercent(size, rows int64) float64 {
+	if size <= 0 || rows <= 0 {
+		return 0
+	}
+
+	percent := 100 * sampleOversampling * float64(size) / float64(rows)
+	if percent >= 100 {
+		return 0
+	}
+
+	return percent
+}
+
+// scan implements pushedStage interface.
+func (s *sampleStage) scan(ctx context.Context, rows *sql.Rows) ([]types.Document, error) {
+	return scanDocuments(rows)
+}
@@ -29,13 +29,68 @@ import (
 )
 
 type storage struct {
-	hanaPool *hana.Hpool
-	l        *zap.Logger
+	hanaPool  *hana.Hpool
+	l         *zap.Logger
+	quotas    *Quotas
+	cursors   *Cursors
+	coalescer *Coalescer
+
+	// indexBuilds are the index builds in progress of all connections
+	indexBuilds *IndexBuilds
+
+	// keys validates the keys of inserted and updated documents
+	keys common.KeyValidation
+
+	// roles of the SAP HANA user rolesUser of the connection, loaded when quotas are checked first
+	roles     []string
+	rolesUser string
+}
+
+// Close closes the cursors created by the connection of the storage.
+// Cursors taken by a concurrent getMore are not closed.
+func (h *storage) Close() {
+	h.cursors.closeCursors(func(c *cursor) bool { return c.conn == h })
 }
 
-func NewStorage(hanaPool *hana.Hpool, l *zap.Logger) common.Storage {
+// NewStorageOpts represents options of the storage of a connection.
+type NewStorageOpts struct {
+	HanaPool *hana.Hpool
+	Logger   *zap.Logger
+
+	// Quotas can be nil.
+	Quotas *Quotas
+
+	// Cursors can be nil, then the cursors of find can only be continued on this connection.
+	Cursors *Cursors
+
+	// Coalescer can be nil, then point reads are not coalesced.
+	Coalescer *Coalescer
+
+	// KeyValidation validates the keys of inserted and updated documents.
+	KeyValidation common.KeyValidation
+
+	// IndexBuilds can be nil, then only the index builds of this connection are reported and aborted by it.
+	IndexBuilds *IndexBuilds
+}
+
+// NewStorage returns the storage of a connection.
+func NewStorage(opts *NewStorageOpts) common.Storage {
+	cursors := opts.Cursors
+	if cursors == nil {
+		cursors = NewCursors(0)
+	}
+	indexBuilds := opts.IndexBuilds
+	if indexBuilds == nil {
+		indexBuilds = NewIndexBuilds()
+	}
+
 	return &storage{
-		hanaPool: hanaPool,
-		l:        l,
+		hanaPool:    opts.HanaPool,
+		l:           opts.Logger,
+		quotas:      opts.Quotas,
+		cursors:     cursors,
+		coalescer:   opts.Coalescer,
+		keys:        opts.KeyValidation,
+		indexBuilds: indexBuilds,
 	}
 }
@@ -0,0 +1,20 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+// emptySystemCollections are the system collections which tools read without checking whether they exist.
+// They are always empty: views are not supported, so system.views has no view definitions,
+// and server-side JavaScript is not supported, so system.js has no functions.
+// Writing to them is rejected by common.ValidateNamespace.
+var emptySystemCollections = map[string]struct{}{
+	"system.js":    {},
+	"system.views": {},
+}
+
+// isEmptySystemCollection returns true if the collection is one of the emptySystemCollections.
+func isEmptySystemCollection(collection string) bool {
+	_, ok := emptySystemCollections[collection]
+	return ok
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package crud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// newUpdateStages returns the stages of an update with an aggregation pipeline,
+// which may be $set, $addFields, $unset and $project. The variables of let are replaced in their expressions.
+func newUpdateStages(pipeline *types.Array, let any) ([]stage, error) {
+	if pipeline.Len() == 0 {
+		return nil, common.NewErrorMessage(common.ErrFailedToParse, "Update pipeline must not be empty")
+	}
+
+	stages := make([]stage, pipeline.Len())
+	for i := 0; i < pipeline.Len(); i++ {
+		v, _ := pipeline.Get(i)
+		spec, ok := v.(types.Document)
+		if !ok || len(spec.Keys()) != 1 {
+			return nil, common.NewErrorMessage(common.ErrFailedToParse, "Each element of the 'pipeline' array must be an object")
+		}
+
+		name := spec.Keys()[0]
+		value := spec.Map()[name]
+
+		var err error
+		switch name {
+		case "$set", "$addFields":
+			if value, err = common.ApplyLetToExpression(value, let); err != nil {
+				return nil, err
+			}
+			stages[i], err = newAddFieldsStage(name, value)
+
+		case "$unset":
+			stages[i], err = newUnsetStage(value)
+
+		case "$project":
+			if value, err = common.ApplyLetToExpression(value, let); err != nil {
+				return nil, err
+			}
+			stages[i], err = newProjectStage(value)
+
+		default:
+			return nil, common.NewErrorMessage(common.ErrNotImplemented, "%s is not supported in updates with an aggregation pipeline", name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stages, nil
+}
+
+// newUnsetStage returns the $project stage excluding the fields of $unset, which are a field or an array of fields.
+func newUnsetStage(value any) (*projectStage, error) {
+	var fields []any
+	switch value := value.(type) {
+	case string:
+		fields = []any{value}
+	case *types.Array:
+		for i := 0; i < value.Len(); i++ {
+			field, _ := value.Get(i)
+			fields = append(fields, field)
+		}
+	}
+
+	projection := types.MustMakeDocument()
+	for _, field := range fields {
+		field, ok := field.(string)
+		if !ok || field == "" {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "$unset specification must be a string or an array of strings")
+		}
+		if err := projection.Set(field, int32(0)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if len(projection.Keys()) == 0 {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "$unset specification must be a string or an array of strings")
+	}
+
+	return newProjectStage(projection)
+}
+
+// updatePipeline updates the documents matching whereSQL with the arguments whereArgs with the stages of an aggregation pipeline,
+// and returns the number of matched and of modified documents.
+// Like updateArrays, the documents are read with FOR UPDATE, and the changed top-level fields of every one of them are updated.
+// The hint is the WITH HINT clause of the SELECT.
+func (h *storage) updatePipeline(ctx context.Context, db, collection, whereSQL string, whereArgs []any, hint string, stages []stage, multi bool) (matched, modified int32, err error) {
+	sql := fmt.Sprintf("SELECT * FROM \"%s\".\"%s\"", db, collection) + whereSQL
+	if !multi {
+		sql += " LIMIT 1"
+	}
+	sql += " FOR UPDATE" + hint
+
+	err = h.hanaPool.InTx(ctx, func(ctx context.Context) error {
+		rows, err := h.hanaPool.QueryContext(ctx, sql, whereArgs...)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+		defer rows.Close()
+
+		docs, err := scanDocuments(rows)
+		if err != nil {
+			return err
+		}
+		rows.Close()
+
+		matched = int32(len(docs))
+
+		for _, doc := range docs {
+			updated := []types.Document{doc.DeepCopy()}
+			for _, s := range stages {
+				if updated, err = s.process(ctx, updated); err != nil {
+					return err
+				}
+			}
+
+			var placeholder common.Placeholder
+			updateSQL, err := common.ReplaceSQL(doc, updated[0], &placeholder)
+			if err != nil {
+				return err
+			}
+			if updateSQL == "" {
+				continue
+			}
+
+			idSQL, err := common.CreateWhereClause(types.MustMakeDocument("_id", doc.Map()["_id"]), &placeholder)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+
+			sql := fmt.Sprintf("UPDATE \"%s\".\"%s\"", db, collection) + updateSQL + idSQL
+			if _, err = h.hanaPool.ExecContext(ctx, sql, placeholder.Args()...); err != nil {
+				return err
+			}
+			modified++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return matched, modified, nil
+}
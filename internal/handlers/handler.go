@@ -22,16 +22,22 @@ package handlers
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
 
 	"go.uber.org/zap"
 
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
@@ -42,7 +48,58 @@ type Handler struct {
 	l             *zap.Logger
 	crud          common.Storage
 	metrics       *Metrics
+	shutdown      func(delay time.Duration)
 	lastRequestID int32
+
+	// sessions of all clients with their open transactions
+	sessions *Sessions
+
+	// cursors used with legacy opcodes by cursor id, for OP_KILL_CURSORS
+	legacyCursors map[int64]legacyCursor
+
+	middlewares []Middleware
+	sandbox     *Sandbox
+	quotas      *crud.Quotas
+	mappings    *Mappings
+
+	// SAP HANA roles of the connected user selecting its row-level security filters, loaded by the first mapped command
+	roles []string
+
+	supportBundle *support.Collector
+
+	// commands taking at least this long are logged, 0 to disable
+	slowCommandThreshold time.Duration
+
+	// subject and issuer of the TLS client certificate, empty without one
+	clientIdentity string
+	clientIssuer   string
+
+	// capture of the commands, nil if disabled
+	capture *Capture
+
+	// requireAuth only allows the commands of the handshake until the connection is authenticated
+	requireAuth   bool
+	authenticated bool
+
+	// SAP HANA user mapped to the client certificate and its roles, set by authentication
+	hanaUser  string
+	hanaRoles []string
+
+	// compressor of the replies negotiated in the handshake, if compression is true
+	compressor  wire.Compressor
+	compression bool
+
+	// userPools opens the SAP HANA connections of the client with its credentials, nil without passthrough;
+	// userDB are the ones opened by its authentication as passthroughUser
+	userPools       hana.UserPoolOpener
+	userDB          *sql.DB
+	passthroughUser string
+
+	// readOnly rejects writes with NotWritablePrimary
+	readOnly bool
+
+	// logUnredacted logs the messages of errors, which may contain values of documents and filters
+	logUnredacted bool
 }
 
 type NewOpts struct {
@@ -51,9 +108,55 @@ type NewOpts struct {
 	CrudStorage common.Storage
 	Metrics     *Metrics
 	PeerAddr    string
+	Shutdown    func(delay time.Duration)
+	Middlewares []Middleware
+	Sandbox     *Sandbox
+	Quotas      *crud.Quotas
+	Mappings    *Mappings
+
+	// Sessions are the client sessions of all connections, which clients may continue on any connection.
+	// The connection has its own sessions if it is nil.
+	Sessions *Sessions
+
+	SupportBundle *support.Collector
+
+	SlowCommandThreshold time.Duration
+
+	// ClientIdentity is the subject of the TLS client certificate of the connection, empty without one.
+	ClientIdentity string
+
+	// ClientIssuer is the issuer of the TLS client certificate of the connection, empty without one.
+	ClientIssuer string
+
+	// Capture writes the commands of the connection, if not nil.
+	Capture *Capture
+
+	// RequireAuth only allows the commands of the handshake until the connection is authenticated.
+	RequireAuth bool
+
+	// UserPools enables SAP HANA credential passthrough, which requires authentication with PLAIN.
+	// HanaPool must then be the pool of the connection only, as its connections are replaced by the ones of the user.
+	UserPools hana.UserPoolOpener
+
+	// ReadOnly rejects commands and pipelines writing to SAP HANA, while all reads are allowed.
+	ReadOnly bool
+
+	// LogUnredacted logs the messages of the errors of commands instead of their codes, only for development.
+	LogUnredacted bool
 }
 
 func New(opts *NewOpts) *Handler {
+	// the sandbox is the first middleware, so that it rejects commands before all others
+	middlewares := opts.Middlewares
+	if opts.Sandbox != nil {
+		middlewares = append([]Middleware{opts.Sandbox}, middlewares...)
+	}
+
+	sessions := opts.Sessions
+	if sessions == nil {
+		sessions = NewSessions(opts.Logger, opts.Metrics)
+	}
+
 	return &Handler{
 		hanaPool: opts.HanaPool,
 		l:        opts.Logger,
@@ -61,6 +164,32 @@ func New(opts *NewOpts) *Handler {
 		crud:     opts.CrudStorage,
 		metrics:  opts.Metrics,
 		peerAddr: opts.PeerAddr,
+		shutdown: opts.Shutdown,
+		sessions: sessions,
+
+		legacyCursors: make(map[int64]legacyCursor),
+
+		middlewares: middlewares,
+		sandbox:     opts.Sandbox,
+		quotas:      opts.Quotas,
+		mappings:    opts.Mappings,
+
+		supportBundle: opts.SupportBundle,
+
+		slowCommandThreshold: opts.SlowCommandThreshold,
+
+		clientIdentity: opts.ClientIdentity,
+		clientIssuer:   opts.ClientIssuer,
+
+		capture: opts.Capture,
+
+		requireAuth: opts.RequireAuth || opts.UserPools != nil,
+
+		userPools: opts.UserPools,
+
+		readOnly: opts.ReadOnly,
+
+		logUnredacted: opts.LogUnredacted,
 	}
 }
 
@@ -77,6 +206,26 @@ func (h *Handler) Handle(ctx context.Context, reqHeader *wire.MsgHeader, reqBody
 	resHeader = new(wire.MsgHeader)
 	var err error
 
+	if h.clientIdentity != "" {
+		ctx = WithClientIdentity(ctx, h.clientIdentity)
+	}
+	switch {
+	case h.hanaUser != "":
+		ctx = hana.WithUser(ctx, h.hanaUser)
+	case h.passthroughUser != "":
+		ctx = hana.WithUser(ctx, h.passthroughUser)
+	}
+
+	if h.capture != nil {
+		sqlCapture := new(hana.SQLCapture)
+		ctx = hana.WithSQLCapture(ctx, sqlCapture)
+
+		start := time.Now()
+		defer func() {
+			h.captureCommand(reqBody, resBody, sqlCapture.Statements(), time.Since(start))
+		}()
+	}
+
 	switch reqHeader.OpCode {
 	case wire.OP_MSG:
 		resHeader.OpCode = wire.OP_MSG
@@ -84,20 +233,17 @@ func (h *Handler) Handle(ctx context.Context, reqHeader *wire.MsgHeader, reqBody
 	case wire.OP_QUERY:
 		resHeader.OpCode = wire.OP_REPLY
 		resBody, err = h.handleOpQuery(ctx, reqBody.(*wire.OpQuery))
+	case wire.OP_GET_MORE:
+		resHeader.OpCode = wire.OP_REPLY
+		resBody, err = h.handleOpGetMore(ctx, reqBody.(*wire.OpGetMore))
+	case wire.OP_INSERT, wire.OP_UPDATE, wire.OP_DELETE, wire.OP_KILL_CURSORS:
+		// legacy writes and OP_KILL_CURSORS have no reply
+		h.handleLegacyNoReply(ctx, reqHeader.OpCode, reqBody)
+		return nil, nil, false
 	case wire.OP_REPLY:
 		fallthrough
-	case wire.OP_UPDATE:
-		fallthrough
-	case wire.OP_INSERT:
-		fallthrough
 	case wire.OP_GET_BY_OID:
 		fallthrough
-	case wire.OP_GET_MORE:
-		fallthrough
-	case wire.OP_DELETE:
-		fallthrough
-	case wire.OP_KILL_CURSORS:
-		fallthrough
 	case wire.OP_COMPRESSED:
 		fallthrough
 	default:
@@ -105,6 +251,18 @@ func (h *Handler) Handle(ctx context.Context, reqHeader *wire.MsgHeader, reqBody
 		panic(fmt.Sprintf("unexpected OpCode %s", reqHeader.OpCode))
 	}
 
+	// the client does not read the reply of a message with moreToCome, so its errors are only logged;
+	// commands with the write concern w: 0 are not acknowledged either, so they only reply {ok: 1}
+	if reqMsg, ok := reqBody.(*wire.OpMsg); ok {
+		switch {
+		case reqMsg.FlagBits.FlagSet(wire.OpMsgMoreToCome):
+			h.observeUnacknowledged(reqMsg, err)
+		case isUnacknowledged(reqMsg):
+			h.observeUnacknowledged(reqMsg, err)
+			resBody, err = unacknowledgedReply(), nil
+		}
+	}
+
 	if err != nil {
 		if resHeader.OpCode != wire.OP_MSG {
 			panic(err)
@@ -122,22 +280,206 @@ func (h *Handler) Handle(ctx context.Context, reqHeader *wire.MsgHeader, reqBody
 		resBody = &res
 	}
 
-	resHeader.ResponseTo = reqHeader.RequestID
+	// replies have a checksum if the client sent one
+	if reqMsg, ok := reqBody.(*wire.OpMsg); ok && reqMsg.FlagBits.FlagSet(wire.OpMsgChecksumPresent) {
+		setChecksumFlag(resBody)
+	}
+
+	// the reply is not marshaled there, it is streamed to the client by the caller
+	l, err := wire.BodySize(resBody)
+	if err == nil && wire.MsgHeaderLen+l > wire.MaxMsgLen {
+		err = lazyerrors.Errorf("reply length %d: %w", wire.MsgHeaderLen+l, wire.ErrMessageTooLarge)
+	}
+	if err != nil {
+		// a reply which is too large is replaced by the error, like in MongoDB
+		if !errors.Is(err, wire.ErrMessageTooLarge) && !errors.Is(err, bson.ErrDocumentTooLarge) {
+			panic(err)
+		}
+
+		h.l.Warn("Reply is too large", zap.Stringer("opcode", reqHeader.OpCode), zap.Error(err))
+		resBody = tooLargeReply(reqHeader.OpCode, err)
+		if reqMsg, ok := reqBody.(*wire.OpMsg); ok && reqMsg.FlagBits.FlagSet(wire.OpMsgChecksumPresent) {
+			setChecksumFlag(resBody)
+		}
+
+		if l, err = wire.BodySize(resBody); err != nil {
+			panic(err)
+		}
+	}
+
+	h.setReplyHeader(reqHeader, resHeader, l)
+
+	return
+}
+
+// captureCommand writes the command of the request with its statements and reply to the capture.
+func (h *Handler) captureCommand(reqBody, resBody wire.MsgBody, statements []string, duration time.Duration) {
+	record := newCaptureRecord(reqBody, resBody, statements)
+	if record == nil {
+		return
+	}
+
+	record.Remote = h.peerAddr
+	record.DurationMillis = duration.Milliseconds()
+
+	if err := h.capture.write(record); err != nil {
+		h.l.Warn("Failed to capture command", zap.Error(err))
+	}
+}
+
+// ReplyTooLarge returns the reply to a request which was not handled
+// because the message or one of its documents is too large, as returned by wire.ReadMessage.
+// Like MongoDB, it replies with the error Overflow or BSONObjectTooLarge.
+// OP_INSERT, OP_UPDATE, OP_DELETE and OP_KILL_CURSORS have no reply, so its body is nil for them.
+func (h *Handler) ReplyTooLarge(reqHeader *wire.MsgHeader, err error) (resHeader *wire.MsgHeader, resBody wire.MsgBody) {
+	h.metrics.requests.WithLabelValues(reqHeader.OpCode.String(), "").Inc()
+	h.l.Warn("Request is too large", zap.Stringer("opcode", reqHeader.OpCode), zap.Error(err))
+
+	resBody = tooLargeReply(reqHeader.OpCode, err)
+	if resBody == nil {
+		return nil, nil
+	}
 
-	// FIXME don't call MarshalBinary there
-	// Fix header in the caller?
-	b, err := resBody.MarshalBinary()
+	l, err := wire.BodySize(resBody)
 	if err != nil {
 		panic(err)
 	}
-	resHeader.MessageLength = int32(wire.MsgHeaderLen + len(b))
+
+	resHeader = &wire.MsgHeader{OpCode: wire.OP_REPLY}
+	if reqHeader.OpCode == wire.OP_MSG {
+		resHeader.OpCode = wire.OP_MSG
+	}
+	h.setReplyHeader(reqHeader, resHeader, l)
+
+	return resHeader, resBody
+}
+
+// tooLargeReply returns the reply body with the error of a message or document which is too large
+// for a request of the opcode, or nil if the opcode has no reply.
+func tooLargeReply(opCode wire.OpCode, err error) wire.MsgBody {
+	protoErr := common.NewErrorMessage(common.ErrOverflow, "message is larger than maxMessageSizeBytes of %d bytes", wire.MaxMsgLen)
+	if errors.Is(err, bson.ErrDocumentTooLarge) {
+		protoErr = common.NewErrorMessage(
+			common.ErrBSONObjectTooLarge, "document is larger than the maximum of %d bytes", bson.MaxInternalDocumentLen,
+		)
+	}
+
+	return errorReply(opCode, protoErr)
+}
+
+// errorReply returns the reply body with the error for a request of the opcode, or nil if the opcode has no reply.
+func errorReply(opCode wire.OpCode, err error) wire.MsgBody {
+	switch opCode {
+	case wire.OP_MSG:
+		protoErr, _ := common.ProtocolError(err)
+		var res wire.OpMsg
+		if err := res.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{protoErr.Document()},
+		}); err != nil {
+			panic(err)
+		}
+		return &res
+	case wire.OP_QUERY, wire.OP_GET_MORE:
+		return legacyErrorReply(err)
+	default:
+		return nil
+	}
+}
+
+// ErrorReply returns the reply with the error to a request which is not handled by a Handler,
+// like the first request of a connection which is rejected by the listener.
+// It is nil for requests without a reply.
+func ErrorReply(reqHeader *wire.MsgHeader, err error) (resHeader *wire.MsgHeader, resBody wire.MsgBody) {
+	resBody = errorReply(reqHeader.OpCode, err)
+	if resBody == nil {
+		return nil, nil
+	}
+
+	l, err := wire.BodySize(resBody)
+	if err != nil {
+		panic(err)
+	}
+
+	resHeader = &wire.MsgHeader{
+		MessageLength: int32(wire.MsgHeaderLen + l),
+		RequestID:     1,
+		ResponseTo:    reqHeader.RequestID,
+		OpCode:        wire.OP_REPLY,
+	}
+	if reqHeader.OpCode == wire.OP_MSG {
+		resHeader.OpCode = wire.OP_MSG
+	}
+
+	return resHeader, resBody
+}
+
+// setChecksumFlag sets the checksumPresent flag of the reply if it is an OP_MSG.
+func setChecksumFlag(resBody wire.MsgBody) {
+	if resMsg, ok := resBody.(*wire.OpMsg); ok {
+		resMsg.FlagBits |= wire.OpMsgFlags(wire.OpMsgChecksumPresent)
+	}
+}
+
+// setReplyHeader sets the fields of the header of the reply to the request, with a body of bodyLen bytes.
+func (h *Handler) setReplyHeader(reqHeader, resHeader *wire.MsgHeader, bodyLen int) {
+	resHeader.ResponseTo = reqHeader.RequestID
+	resHeader.MessageLength = int32(wire.MsgHeaderLen + bodyLen)
 
 	if resHeader.RequestID != 0 {
 		panic("resHeader.RequestID must not be set by handler")
 	}
 	resHeader.RequestID = atomic.AddInt32(&h.lastRequestID, 1)
+}
 
-	return
+// observeUnacknowledged counts the request with the moreToCome flag, like an unacknowledged write with {w: 0},
+// and logs its error.
+func (h *Handler) observeUnacknowledged(msg *wire.OpMsg, err error) {
+	var cmd string
+	if document, docErr := msg.Document(); docErr == nil {
+		cmd = document.Command()
+	}
+
+	h.observeUnacknowledgedCommand(cmd, err)
+}
+
+// isUnacknowledged returns true if the message is a command with the valid write concern w: 0.
+func isUnacknowledged(msg *wire.OpMsg) bool {
+	document, err := msg.Document()
+	if err != nil {
+		return false
+	}
+
+	value, ok := document.Map()["writeConcern"]
+	if !ok {
+		return false
+	}
+
+	wc, err := common.ParseWriteConcern(value)
+
+	return err == nil && wc.W == int64(0)
+}
+
+// unacknowledgedReply returns the reply to an unacknowledged command.
+func unacknowledgedReply() *wire.OpMsg {
+	var reply wire.OpMsg
+	if err := reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument("ok", float64(1))},
+	}); err != nil {
+		panic(err)
+	}
+
+	return &reply
+}
+
+// observeUnacknowledgedCommand counts the unacknowledged command and logs its error.
+func (h *Handler) observeUnacknowledgedCommand(cmd string, err error) {
+	if err == nil {
+		h.metrics.unacknowledged.WithLabelValues(cmd, "ok").Inc()
+		return
+	}
+
+	h.metrics.unacknowledged.WithLabelValues(cmd, "error").Inc()
+	h.l.Warn("Unacknowledged command failed", zap.String("command", cmd), h.errorField(err))
 }
 
 //nolint:goconst // good enough
@@ -155,11 +497,76 @@ func (h *Handler) handleOpMsg(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg
 
 	h.metrics.requests.WithLabelValues(wire.OP_MSG.String(), cmd).Inc()
 
+	return h.runOpMsg(ctx, msg, document)
+}
+
+// runOpMsg runs the command of the message, at most for the maximum time of the sandbox.
+func (h *Handler) runOpMsg(ctx context.Context, msg *wire.OpMsg, document types.Document) (*wire.OpMsg, error) {
+	if err := h.checkAuth(document.Command()); err != nil {
+		return nil, err
+	}
+	if err := h.checkReadOnly(document); err != nil {
+		return nil, err
+	}
+
+	msg, document, err := h.applyMappings(ctx, msg, document)
+	if err != nil {
+		return nil, err
+	}
+
+	// the privileges are checked for the collections of the mappings
+	if err = h.checkPrivileges(ctx, document); err != nil {
+		return nil, err
+	}
+
+	if h.sandbox != nil && h.sandbox.MaxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.sandbox.MaxTime)
+		defer cancel()
+	}
+
+	return h.intercept(ctx, msg, document, h.handleCommand)
+}
+
+// handleCommand runs the command of the request document, at most for its maxTimeMS.
+// Its comment is attached to its SAP HANA statements and to the log of slow commands.
+func (h *Handler) handleCommand(ctx context.Context, msg *wire.OpMsg, document types.Document) (*wire.OpMsg, error) {
+	ctx, done, err := withMaxTime(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := commentString(document)
+	if comment != "" {
+		ctx = hana.WithComment(ctx, comment)
+	}
+
+	start := time.Now()
+	res, err := h.runCommand(ctx, msg, document)
+	err = done(err)
+	h.logSlowCommand(document, comment, time.Since(start), err)
+
+	return res, err
+}
+
+// runCommand runs the command of the request document.
+func (h *Handler) runCommand(ctx context.Context, msg *wire.OpMsg, document types.Document) (*wire.OpMsg, error) {
+	cmd := document.Command()
+
 	if cmd == "listcommands" {
 		return SupportedCommands(ctx, msg)
 	}
 
+	ctx, err := h.sessionContext(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+
 	if cmd, ok := commands[cmd]; ok {
+		if err := validateNamespace(document); err != nil {
+			return nil, err
+		}
+
 		if cmd.handler != nil {
 			return cmd.handler(h, ctx, msg)
 		}
@@ -174,15 +581,19 @@ func (h *Handler) handleOpMsg(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg
 	return nil, common.NewErrorMessage(common.ErrCommandNotFound, "no such command: '%s'", cmd)
 }
 
+// handleOpQuery handles commands of the handshake sent as OP_QUERY to admin.$cmd,
+// and queries of other collections like find.
 func (h *Handler) handleOpQuery(ctx context.Context, query *wire.OpQuery) (*wire.OpReply, error) {
-	cmd := query.Query.Command()
-	h.metrics.requests.WithLabelValues(wire.OP_QUERY.String(), cmd).Inc()
-
 	if query.FullCollectionName == "admin.$cmd" {
+		cmd := query.Query.Command()
+		h.metrics.requests.WithLabelValues(wire.OP_QUERY.String(), cmd).Inc()
+		if err := h.checkAuth(cmd); err != nil {
+			return legacyErrorReply(err), nil
+		}
 		return h.QueryCmd(ctx, query)
 	}
 
-	return nil, common.NewErrorMessage(common.ErrNotImplemented, "handleOpQuery: unhandled collection %q", query.FullCollectionName)
+	return h.handleLegacyFind(ctx, query), nil
 }
 
 func (h *Handler) msgStorage(ctx context.Context, msg *wire.OpMsg) (common.Storage, error) {
@@ -202,7 +613,8 @@ func (h *Handler) msgStorage(ctx context.Context, msg *wire.OpMsg) (common.Stora
 	command := document.Command()
 
 	switch command {
-	case "delete", "find", "count", "findAndModify", "update", "insert", "createindexes":
+	case "aggregate", "delete", "explain", "find", "count", "findAndModify", "update", "insert", "createIndexes", "seed", "getMore", "killCursors",
+		"setIndexCommitQuorum", "currentOp", "killOp":
 		return h.crud, nil
 	default:
 		panic(fmt.Sprintf("unhandled command %q", command))
@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -18,7 +20,11 @@
 
 package handlers
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
 
 const (
 	namespace = "SAP_HANA_compatibility_layer_for_MongoDB_Wire_Protocol"
@@ -27,7 +33,10 @@ const (
 
 // Metrics represents handler metrics.
 type Metrics struct {
-	requests *prometheus.CounterVec
+	requests       *prometheus.CounterVec
+	orphanedTxs    *prometheus.CounterVec
+	unacknowledged *prometheus.CounterVec
+	Network        *NetworkStats
 }
 
 // NewMetrics creates new handler metrics.
@@ -42,20 +51,91 @@ func NewMetrics() *Metrics {
 			},
 			[]string{"opcode", "command"},
 		),
+		orphanedTxs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "orphaned_transactions_total",
+				Help:      "Total number of transactions rolled back because their session ended or the client disconnected.",
+			},
+			[]string{"reason"},
+		),
+		unacknowledged: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "unacknowledged_requests_total",
+				Help:      "Total number of requests with the moreToCome flag, which are not replied to.",
+			},
+			[]string{"command", "result"},
+		),
+		Network: NewNetworkStats(),
 	}
 }
 
 // Describe implements prometheus.Collector.
 func (lm *Metrics) Describe(ch chan<- *prometheus.Desc) {
 	lm.requests.Describe(ch)
+	lm.orphanedTxs.Describe(ch)
+	lm.unacknowledged.Describe(ch)
+	lm.Network.Describe(ch)
 }
 
 // Collect implements prometheus.Collector.
 func (lm *Metrics) Collect(ch chan<- prometheus.Metric) {
 	lm.requests.Collect(ch)
+	lm.orphanedTxs.Collect(ch)
+	lm.unacknowledged.Collect(ch)
+	lm.Network.Collect(ch)
 }
 
 // check interfaces
 var (
 	_ prometheus.Collector = (*Metrics)(nil)
 )
+
+// CommandUsage is the number of requests of one command in the compatibility report.
+type CommandUsage struct {
+	OpCode    string  `json:"opCode"`
+	Command   string  `json:"command"`
+	Requests  float64 `json:"requests"`
+	Supported bool    `json:"supported"`
+}
+
+// CompatibilityReport returns the commands received by all connections, with their number of requests
+// and whether they are supported, to find the commands an application uses which are not supported yet.
+func (lm *Metrics) CompatibilityReport() ([]CommandUsage, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(lm.requests); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	var res []CommandUsage
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			var usage CommandUsage
+			for _, l := range m.GetLabel() {
+				switch l.GetName() {
+				case "opcode":
+					usage.OpCode = l.GetValue()
+				case "command":
+					usage.Command = l.GetValue()
+				}
+			}
+			usage.Requests = m.GetCounter().GetValue()
+
+			if cmd, ok := commands[usage.Command]; ok {
+				usage.Supported = cmd.handler != nil || cmd.storageHandler != nil || usage.Command == "listCommands"
+			}
+
+			res = append(res, usage)
+		}
+	}
+
+	return res, nil
+}
@@ -25,16 +25,20 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
@@ -55,14 +59,18 @@ func setup(t *testing.T, qMatcher sqlmock.QueryMatcher) (context.Context, *Handl
 	}
 
 	hPool := hana.Hpool{
-		db,
+		DB: db,
 	}
 
 	ctx := testutil.Ctx(t)
 
 	l := zaptest.NewLogger(t)
 
-	crud := crud.NewStorage(&hPool, l)
+	crud := crud.NewStorage(&crud.NewStorageOpts{
+		HanaPool:      &hPool,
+		Logger:        l,
+		KeyValidation: common.RejectDottedDollarKeys,
+	})
 	handler := New(&NewOpts{
 		HanaPool:    &hPool,
 		Logger:      l,
@@ -141,9 +149,10 @@ func TestFind(t *testing.T) {
 		row4 := sqlmock.NewRows([]string{"count"}).AddRow(1)
 
 		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'databaseName'").WillReturnRows(row3)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'databaseName' AND table_name = 'actor' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row4)
-		mock.ExpectQuery("SELECT * FROM \"databaseName\".\"actor\" WHERE \"last_name\" = 'Doe' AND \"actor_id\" \u003e 50 AND \"actor_id\" \u003c 100").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("databaseName").WillReturnRows(row3)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("databaseName", "actor").WillReturnRows(row4)
+		mock.ExpectQuery("SELECT * FROM \"databaseName\".\"actor\" WHERE \"last_name\" = ? AND ((\"actor_id\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"actor_id\" \u003e ?) OR \"actor_id\".\"$n\" \u003e ?) AND ((\"actor_id\" BETWEEN -1.7976931348623157E308 AND 1.7976931348623157E308 AND \"actor_id\" \u003c ?) OR \"actor_id\".\"$n\" \u003c ?)").
+			WithArgs("Doe", int32(50), int32(50), int32(100), int32(100)).WillReturnRows(row2)
 
 		actual := handle(ctx, t, handler, reqDoc)
 		expected := types.MustMakeDocument(
@@ -184,8 +193,8 @@ func TestFind(t *testing.T) {
 		row3 := sqlmock.NewRows([]string{"count"}).AddRow(0)
 
 		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(row1)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = 'database'").WillReturnRows(row2)
-		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = 'database' AND table_name = 'actor' AND TABLE_TYPE = 'COLLECTION'").WillReturnRows(row3)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("database").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("database", "actor").WillReturnRows(row3)
 
 		actual := handle(ctx, t, handler, reqDoc)
 		expected := types.MustMakeDocument(
@@ -228,9 +237,10 @@ func TestInsert(t *testing.T) {
 		args := []driver.Value{[]byte{123, 34, 95, 105, 100, 34, 58, 49, 44, 34, 110, 101, 119, 34, 58, 34, 116, 101, 115, 116, 34, 125}}
 
 		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "test").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
 		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"test\"").WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"test\"  WHERE \"_id\" = 1 LIMIT 1").WillReturnRows(row3)
+		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"test\"  WHERE \"_id\" = ? LIMIT 1").WillReturnRows(row3)
 		mock.ExpectExec("INSERT INTO \"testDatabase\".\"test\" VALUES ($1)").WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		actual := handle(ctx, t, handler, reqDoc)
@@ -269,9 +279,10 @@ func TestInsert(t *testing.T) {
 		args := []driver.Value{[]byte{123, 34, 95, 105, 100, 34, 58, 49, 44, 34, 110, 101, 119, 34, 58, 34, 116, 101, 115, 116, 34, 125}}
 
 		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "test").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
 		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnError(fmt.Errorf("386: cannot use duplicate schema name"))
 		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"test\"").WillReturnError(fmt.Errorf("288: cannot use duplicate table name"))
-		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"test\"  WHERE \"_id\" = 1 LIMIT 1").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"test\"  WHERE \"_id\" = ? LIMIT 1").WillReturnRows(row2)
 		mock.ExpectExec("INSERT INTO \"testDatabase\".\"test\" VALUES ($1)").WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
 
 		actual := handle(ctx, t, handler, reqDoc)
@@ -286,6 +297,31 @@ func TestInsert(t *testing.T) {
 			t.Errorf("there were unfulfilled expectations: %s", err)
 		}
 	})
+
+	t.Run("insert document into invalid namespace", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		for collection, errmsg := range map[string]string{
+			"system.test": "cannot write to 'testDatabase.system.test'",
+			"te$t":        "Invalid namespace specified 'testDatabase.te$t'",
+		} {
+			reqDoc := types.MustMakeDocument(
+				"insert", collection,
+				"documents", types.MustNewArray(types.MustMakeDocument("_id", int32(1))),
+				"$db", "testDatabase",
+			)
+
+			actual := handle(ctx, t, handler, reqDoc)
+			assert.Equal(t, "InvalidNamespace", actual.Map()["codeName"])
+			assert.Equal(t, errmsg, actual.Map()["errmsg"])
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
 }
 
 func TestDatabaseCommand(t *testing.T) {
@@ -309,6 +345,7 @@ func TestDatabaseCommand(t *testing.T) {
 			"maxBsonObjectSize", int32(bson.MaxDocumentLen),
 			"ok", float64(1),
 			"buildEnvironment", version.Get().BuildEnvironment,
+			"compatibilityLayer", version.Get().Document(),
 		)
 
 		assert.Equal(t, expected, actual)
@@ -339,6 +376,194 @@ func TestDatabaseCommand(t *testing.T) {
 		}
 	})
 
+	t.Run("create collection with collation", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		reqDoc := types.MustMakeDocument(
+			"create", "newTest",
+			"collation", types.MustMakeDocument("locale", "de", "strength", int32(2)),
+			"$db", "testDatabase",
+		)
+
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectBegin()
+		mock.ExpectExec("SET TRANSACTION AUTOCOMMIT DDL OFF").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"newTest\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("COMMENT ON TABLE \"testDatabase\".\"newTest\" IS '{\"collation\":{\"locale\":\"de\",\"strength\":2}}'").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SET TRANSACTION AUTOCOMMIT DDL ON").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		actual := handle(ctx, t, handler, reqDoc)
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("create partitioned collection", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		reqDoc := types.MustMakeDocument(
+			"create", "newTest",
+			"partition", types.MustMakeDocument(
+				"type", "range",
+				"key", "year",
+				"boundaries", types.MustNewArray(int32(2000), int32(2010), int32(2020)),
+			),
+			"$db", "testDatabase",
+		)
+
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"newTest\" PARTITION BY RANGE (\"year\") (PARTITION 2000 <= VALUES < 2010, PARTITION 2010 <= VALUES < 2020, PARTITION OTHERS)").WillReturnResult(sqlmock.NewResult(1, 1))
+
+		actual := handle(ctx, t, handler, reqDoc)
+		expected := types.MustMakeDocument(
+			"ok", float64(1),
+		)
+
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("collMod partition", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		reqDoc := types.MustMakeDocument(
+			"collMod", "testCollection",
+			"partition", types.MustMakeDocument(
+				"type", "hash",
+				"key", "_id",
+				"partitions", int32(4),
+			),
+			"$db", "testDatabase",
+		)
+
+		row1 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+		row2 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectExec("ALTER COLLECTION \"testDatabase\".\"testCollection\" PARTITION BY HASH (\"_id\") PARTITIONS 4").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		actual := handle(ctx, t, handler, reqDoc)
+		expected := types.MustMakeDocument(
+			"ok", float64(1),
+		)
+
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("collMod readOnly", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		reqDoc := types.MustMakeDocument(
+			"collMod", "testCollection",
+			"readOnly", true,
+			"defaultWriteConcern", types.MustMakeDocument(
+				"w", "majority",
+				"wtimeout", int32(5000),
+			),
+			"$db", "testDatabase",
+		)
+
+		row1 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+		row2 := sqlmock.NewRows([]string{"count"}).AddRow(1)
+		row3 := sqlmock.NewRows([]string{"comments"}).AddRow(nil)
+
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("testDatabase").WillReturnRows(row1)
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("testDatabase", "testCollection").WillReturnRows(row2)
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(row3)
+		mock.ExpectExec("COMMENT ON TABLE \"testDatabase\".\"testCollection\" IS '{\"readOnly\":true,\"writeConcern\":{\"w\":\"majority\",\"wtimeout\":5000}}'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		actual := handle(ctx, t, handler, reqDoc)
+		expected := types.MustMakeDocument(
+			"ok", float64(1),
+		)
+
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("collMod unacknowledged defaultWriteConcern", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"collMod", "testCollection",
+			"defaultWriteConcern", types.MustMakeDocument("w", int32(0)),
+			"$db", "testDatabase",
+		))
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "The default write concern cannot be unacknowledged",
+			"code", int32(2),
+			"codeName", "BadValue",
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("collStats", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		reqDoc := types.MustMakeDocument(
+			"collStats", "testCollection",
+			"scale", int32(2),
+			"$db", "testDatabase",
+		)
+
+		tableRow := sqlmock.NewRows([]string{"table_name", "table_type", "table_size", "record_count"}).AddRow("testCollection", "COLLECTION", 400, 30)
+		partitionRows := sqlmock.NewRows([]string{"part_id", "record_count", "table_size"}).AddRow(1, 10, 100).AddRow(2, 20, 300)
+
+		mock.ExpectQuery("SELECT TABLE_NAME, TABLE_TYPE, TABLE_SIZE, RECORD_COUNT FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(tableRow)
+		mock.ExpectQuery("SELECT PART_ID, RECORD_COUNT, TABLE_SIZE FROM \"PUBLIC\".\"M_TABLE_PARTITIONS\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "testCollection").WillReturnRows(partitionRows)
+
+		actual := handle(ctx, t, handler, reqDoc)
+		expected := types.MustMakeDocument(
+			"ns", "testDatabase.testCollection",
+			"count", int64(30),
+			"size", int64(200),
+			"storageSize", int64(200),
+			"totalIndexSize", int64(0),
+			"totalSize", int64(200),
+			"scaleFactor", int32(2),
+			"nPartitions", int32(2),
+			"partitions", types.MustNewArray(
+				types.MustMakeDocument("id", int32(1), "count", int64(10), "size", int64(50)),
+				types.MustMakeDocument("id", int32(2), "count", int64(20), "size", int64(150)),
+			),
+			"ok", float64(1),
+		)
+
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
 	t.Run("drop collection", func(t *testing.T) {
 		t.Parallel()
 
@@ -543,6 +768,7 @@ func TestDatabaseCommand(t *testing.T) {
 		expected := types.MustMakeDocument(
 			"helloOk", true,
 			"ismaster", true,
+			"topologyVersion", topologyVersion(),
 			"maxBsonObjectSize", int32(16777216),
 			"maxMessageSizeBytes", int32(48000000),
 			"maxWriteBatchSize", int32(100000),
@@ -554,6 +780,83 @@ func TestDatabaseCommand(t *testing.T) {
 
 		assert.Equal(t, expected, actual)
 	})
+	t.Run("MsgHelloSASLSupportedMechs", func(t *testing.T) {
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+		handler.clientIdentity = "CN=client,O=example"
+
+		for user, expected := range map[string]any{
+			"$external.CN=client,O=example": types.MustNewArray("MONGODB-X509"),
+			"$external.CN=other":            nil,
+			"admin.CN=client,O=example":     nil,
+		} {
+			actual := handle(ctx, t, handler, types.MustMakeDocument(
+				"hello", int32(1),
+				"saslSupportedMechs", user,
+				"$db", "admin",
+			))
+			assert.Equal(t, expected, actual.Map()["saslSupportedMechs"], user)
+		}
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"saslSupportedMechs", "user",
+			"$db", "admin",
+		))
+		assert.Equal(t, "UserName must contain a '.' separated database.user pair", actual.Map()["errmsg"])
+	})
+	t.Run("MsgHelloLoadBalanced", func(t *testing.T) {
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"loadBalanced", true,
+			"$db", "admin",
+		))
+		assert.Equal(t, topologyProcessID, actual.Map()["serviceId"])
+
+		actual = handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"loadBalanced", false,
+			"$db", "admin",
+		))
+		assert.NotContains(t, actual.Keys(), "serviceId")
+
+		actual = handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"loadBalanced", int32(1),
+			"$db", "admin",
+		))
+		assert.Equal(t, "loadBalanced must be a boolean. Got instead: int32", actual.Map()["errmsg"])
+	})
+	t.Run("MsgHelloCompression", func(t *testing.T) {
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"compression", types.MustNewArray("snappy", "zstd"),
+			"$db", "admin",
+		))
+		assert.NotContains(t, actual.Keys(), "compression")
+		_, ok := handler.Compressor()
+		assert.False(t, ok)
+
+		actual = handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"compression", types.MustNewArray("snappy", "zlib", "zstd"),
+			"$db", "admin",
+		))
+		assert.Equal(t, types.MustNewArray("zlib"), actual.Map()["compression"])
+		compressor, ok := handler.Compressor()
+		assert.True(t, ok)
+		assert.Equal(t, wire.CompressorZlib, compressor)
+
+		actual = handle(ctx, t, handler, types.MustMakeDocument(
+			"hello", int32(1),
+			"compression", "zlib",
+			"$db", "admin",
+		))
+		assert.Equal(t, "'compression' is not an array", actual.Map()["errmsg"])
+	})
 	t.Run("MsgLog", func(t *testing.T) {
 		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
 
@@ -624,6 +927,7 @@ func TestQueryCmd(t *testing.T) {
 	expectedDoc := types.MustMakeDocument(
 		"helloOk", true,
 		"ismaster", true,
+		"topologyVersion", topologyVersion(),
 		"maxBsonObjectSize", int32(16777216),
 		"maxMessageSizeBytes", int32(48000000),
 		"maxWriteBatchSize", int32(100000),
@@ -1485,3 +1789,1049 @@ func TestQueryCmd(t *testing.T) {
 // 		assert.Equal(t, expected, actual)
 // 	})
 // }
+
+func TestTransactions(t *testing.T) {
+	lsid := types.MustMakeDocument(
+		"id", types.Binary{Subtype: types.BinaryUUID, B: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}},
+	)
+
+	t.Run("commit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"ping", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"startTransaction", true,
+			"autocommit", false,
+			"$db", "testDatabase",
+		))
+		assert.Equal(t, float64(1), actual.Map()["ok"])
+
+		actual = handle(ctx, t, handler, types.MustMakeDocument(
+			"commitTransaction", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"autocommit", false,
+			"$db", "admin",
+		))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("no transaction", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"abortTransaction", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"autocommit", false,
+			"$db", "admin",
+		))
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "transaction 1 is not in progress for this session",
+			"code", int32(251),
+			"codeName", "NoSuchTransaction",
+		)
+		assert.Equal(t, expected, actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("txnNumber", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		// the newer transaction rolls back the open one
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+
+		txnCommand := func(txnNumber int64, start bool) types.Document {
+			doc := types.MustMakeDocument(
+				"ping", int32(1),
+				"lsid", lsid,
+				"txnNumber", txnNumber,
+				"autocommit", false,
+				"$db", "testDatabase",
+			)
+			if start {
+				require.NoError(t, doc.Set("startTransaction", true))
+			}
+			return doc
+		}
+
+		assert.Equal(t, float64(1), handle(ctx, t, handler, txnCommand(1, true)).Map()["ok"])
+		assert.Equal(t, float64(1), handle(ctx, t, handler, txnCommand(2, true)).Map()["ok"])
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.orphanedTxs.WithLabelValues(cleanupNewerTransaction)))
+
+		actual := handle(ctx, t, handler, txnCommand(1, false))
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "Cannot continue transaction 1 on session 0102030405060708090a0b0c0d0e0f10 because a newer transaction 2 has already started",
+			"code", int32(225),
+			"codeName", "TransactionTooOld",
+		)
+		assert.Equal(t, expected, actual)
+
+		actual = handle(ctx, t, handler, txnCommand(3, false))
+		assert.Equal(t, "transaction 3 is not in progress for this session", actual.Map()["errmsg"])
+
+		actual = handle(ctx, t, handler, txnCommand(2, true))
+		assert.Equal(t, "transaction 2 has already been started on this session", actual.Map()["errmsg"])
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("endSessions rolls back", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		handle(ctx, t, handler, types.MustMakeDocument(
+			"ping", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"startTransaction", true,
+			"autocommit", false,
+			"$db", "testDatabase",
+		))
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"endSessions", types.MustNewArray(lsid),
+			"$db", "admin",
+		))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.orphanedTxs.WithLabelValues(cleanupEndSessions)))
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("disconnect keeps the transaction", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		handle(ctx, t, handler, types.MustMakeDocument(
+			"ping", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"startTransaction", true,
+			"autocommit", false,
+			"$db", "testDatabase",
+		))
+
+		handler.Close()
+
+		// the driver continues the session on another connection of its pool
+		other := New(&NewOpts{
+			HanaPool: handler.hanaPool,
+			Logger:   handler.l,
+			Metrics:  handler.metrics,
+			Sessions: handler.sessions,
+		})
+		actual := handle(ctx, t, other, types.MustMakeDocument(
+			"commitTransaction", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"autocommit", false,
+			"$db", "admin",
+		))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectBegin()
+
+		handle(ctx, t, handler, types.MustMakeDocument(
+			"ping", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"startTransaction", true,
+			"autocommit", false,
+			"$db", "testDatabase",
+		))
+
+		other := New(&NewOpts{
+			HanaPool: handler.hanaPool,
+			Logger:   handler.l,
+			Metrics:  handler.metrics,
+			Sessions: handler.sessions,
+		})
+		other.hanaUser = "OTHER"
+
+		actual := handle(ctx, t, other, types.MustMakeDocument(
+			"abortTransaction", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"autocommit", false,
+			"$db", "admin",
+		))
+		assert.Equal(t, "Unauthorized", actual.Map()["codeName"])
+
+		// the sessions of other users are not ended
+		handle(ctx, t, other, types.MustMakeDocument(
+			"endSessions", types.MustNewArray(lsid),
+			"$db", "admin",
+		))
+		assert.Len(t, handler.sessions.sessions, 1)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("timeout rolls back", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		handle(ctx, t, handler, types.MustMakeDocument(
+			"ping", int32(1),
+			"lsid", lsid,
+			"txnNumber", int64(1),
+			"startTransaction", true,
+			"autocommit", false,
+			"$db", "testDatabase",
+		))
+
+		now := time.Now()
+		handler.sessions.reap(now)
+		assert.Equal(t, float64(0), promtestutil.ToFloat64(handler.metrics.orphanedTxs.WithLabelValues(cleanupTimeout)))
+
+		handler.sessions.reap(now.Add(transactionLifetimeLimit + time.Second))
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.orphanedTxs.WithLabelValues(cleanupTimeout)))
+		assert.Len(t, handler.sessions.sessions, 1)
+
+		handler.sessions.reap(now.Add(sessionTimeout + time.Second))
+		assert.Empty(t, handler.sessions.sessions)
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+}
+
+// systemPrivilegeSQL is the query of hana.HasSystemPrivilege for the connected user.
+const systemPrivilegeSQL = "SELECT COUNT(*) FROM \"PUBLIC\".\"EFFECTIVE_PRIVILEGES\" WHERE USER_NAME = CURRENT_USER " +
+	"AND OBJECT_TYPE = 'SYSTEMPRIVILEGE' AND PRIVILEGE = ? AND IS_VALID = 'TRUE'"
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		peerAddr      string
+		authenticated bool
+		privileged    bool
+		req           types.Document
+		expected      types.Document
+		delay         time.Duration
+	}{
+		"Default": {
+			peerAddr: "127.0.0.1:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "$db", "admin"),
+			expected: types.MustMakeDocument("ok", float64(1)),
+			delay:    15 * time.Second,
+		},
+		"TimeoutSecs": {
+			peerAddr: "[::1]:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "timeoutSecs", int32(5), "$db", "admin"),
+			expected: types.MustMakeDocument("ok", float64(1)),
+			delay:    5 * time.Second,
+		},
+		"Force": {
+			peerAddr: "127.0.0.1:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "force", true, "timeoutSecs", int32(5), "$db", "admin"),
+			expected: types.MustMakeDocument("ok", float64(1)),
+			delay:    0,
+		},
+		"NotAdmin": {
+			peerAddr: "127.0.0.1:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "$db", "testDatabase"),
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "shutdown may only be run against the admin database.",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+			delay: -1,
+		},
+		"UnixSocket": {
+			peerAddr: "/tmp/mongodb-27017.sock#1",
+			req:      types.MustMakeDocument("shutdown", int32(1), "$db", "admin"),
+			expected: types.MustMakeDocument("ok", float64(1)),
+			delay:    15 * time.Second,
+		},
+		"TimeoutSecsTooLarge": {
+			peerAddr: "127.0.0.1:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "timeoutSecs", float64(1e300), "$db", "admin"),
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "timeoutSecs must be between 0 and 86400. Got instead: 1e+300",
+				"code", int32(2),
+				"codeName", "BadValue",
+			),
+			delay: -1,
+		},
+		"RemoteAuthenticated": {
+			peerAddr:      "10.0.0.1:50000",
+			authenticated: true,
+			privileged:    true,
+			req:           types.MustMakeDocument("shutdown", int32(1), "$db", "admin"),
+			expected:      types.MustMakeDocument("ok", float64(1)),
+			delay:         15 * time.Second,
+		},
+		"NotPrivileged": {
+			peerAddr:      "127.0.0.1:50000",
+			authenticated: true,
+			req:           types.MustMakeDocument("shutdown", int32(1), "$db", "admin"),
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "not authorized on admin to execute command shutdown, which needs the privilege SERVICE ADMIN",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+			delay: -1,
+		},
+		"Remote": {
+			peerAddr: "10.0.0.1:50000",
+			req:      types.MustMakeDocument("shutdown", int32(1), "$db", "admin"),
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "shutdown must run from localhost when running db without auth",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+			delay: -1,
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+			handler.peerAddr = tc.peerAddr
+			handler.authenticated = tc.authenticated
+
+			if tc.authenticated {
+				var count int
+				if tc.privileged {
+					count = 1
+				}
+				mock.ExpectQuery(systemPrivilegeSQL).
+					WithArgs(hana.PrivilegeServiceAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(count))
+			}
+
+			delay := time.Duration(-1)
+			handler.shutdown = func(d time.Duration) { delay = d }
+
+			actual := handle(ctx, t, handler, tc.req)
+			assert.Equal(t, tc.expected, actual)
+			assert.Equal(t, tc.delay, delay)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestSetIndexCommitQuorum(t *testing.T) {
+	t.Parallel()
+
+	t.Run("no index build in progress", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(10))
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"setIndexCommitQuorum", "testCollection",
+			"indexNames", types.MustNewArray("name_1"),
+			"commitQuorum", "majority",
+			"$db", "testDatabase",
+		))
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "Cannot find an index build on collection 'testDatabase.testCollection' with the provided index names",
+			"code", int32(27),
+			"codeName", "IndexNotFound",
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("invalid commitQuorum", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(10))
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument(
+			"setIndexCommitQuorum", "testCollection",
+			"indexNames", types.MustNewArray("name_1"),
+			"commitQuorum", int32(3),
+			"$db", "testDatabase",
+		))
+		expected := types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", "commitQuorum can only be 0 or 1 on a standalone. Got instead: 3",
+			"code", int32(2),
+			"codeName", "BadValue",
+		)
+		assert.Equal(t, expected, actual)
+	})
+}
+
+func TestDropConnections(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		req           types.Document
+		peerAddr      string
+		authenticated bool
+		privileged    bool
+		expected      types.Document
+		dropped       []string
+	}{
+		"Host": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"hostAndPort", types.MustNewArray("10.0.0.1"),
+				"$db", "admin",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument("ok", float64(1)),
+			dropped:  []string{"10.0.0.1:1000", "10.0.0.1:2000"},
+		},
+		"HostAndPort": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"hostAndPort", types.MustNewArray("10.0.0.1:2000", "10.0.0.2:3000"),
+				"$db", "admin",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument("ok", float64(1)),
+			dropped:  []string{"10.0.0.1:2000", "10.0.0.2:3000"},
+		},
+		"AppName": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"appName", "billing",
+				"$db", "admin",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument("ok", float64(1)),
+			dropped:  []string{"10.0.0.1:1000", "10.0.0.2:3000"},
+		},
+		"HostAndAppName": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"hostAndPort", types.MustNewArray("10.0.0.1"),
+				"appName", "billing",
+				"$db", "admin",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument("ok", float64(1)),
+			dropped:  []string{"10.0.0.1:1000"},
+		},
+		"NotAdmin": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"appName", "billing",
+				"$db", "testDatabase",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "dropConnections may only be run against the admin database.",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+		},
+		"NoFilter": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"$db", "admin",
+			),
+			peerAddr: "127.0.0.1:50000",
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "dropConnections needs hostAndPort or appName",
+				"code", int32(2),
+				"codeName", "BadValue",
+			),
+		},
+		"Remote": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"appName", "billing",
+				"$db", "admin",
+			),
+			peerAddr: "10.0.0.3:50000",
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "dropConnections must run from localhost when running db without auth",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+		},
+		"RemoteAuthenticated": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"appName", "billing",
+				"$db", "admin",
+			),
+			peerAddr:      "10.0.0.3:50000",
+			authenticated: true,
+			privileged:    true,
+			expected:      types.MustMakeDocument("ok", float64(1)),
+			dropped:       []string{"10.0.0.1:1000", "10.0.0.2:3000"},
+		},
+		"NotPrivileged": {
+			req: types.MustMakeDocument(
+				"dropConnections", int32(1),
+				"appName", "billing",
+				"$db", "admin",
+			),
+			peerAddr:      "127.0.0.1:50000",
+			authenticated: true,
+			expected: types.MustMakeDocument(
+				"ok", float64(0),
+				"errmsg", "not authorized on admin to execute command dropConnections, which needs the privilege SESSION ADMIN",
+				"code", int32(13),
+				"codeName", "Unauthorized",
+			),
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+			handler.peerAddr = tc.peerAddr
+			handler.authenticated = tc.authenticated
+
+			if tc.authenticated {
+				var count int
+				if tc.privileged {
+					count = 1
+				}
+				mock.ExpectQuery(systemPrivilegeSQL).
+					WithArgs(hana.PrivilegeSessionAdmin).
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(count))
+			}
+
+			var dropped []string
+			for _, peerAddr := range []string{"10.0.0.1:1000", "10.0.0.1:2000", "10.0.0.2:3000"} {
+				peerAddr := peerAddr
+				handler.metrics.Network.OpenConn(peerAddr, func() { dropped = append(dropped, peerAddr) })
+			}
+			handler.metrics.Network.SetAppName("10.0.0.1:1000", "billing")
+			handler.metrics.Network.SetAppName("10.0.0.2:3000", "billing")
+
+			actual := handle(ctx, t, handler, tc.req)
+			assert.Equal(t, tc.expected, actual)
+
+			sort.Strings(dropped)
+			assert.Equal(t, tc.dropped, dropped)
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestMessageFlags(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		flags          wire.OpMsgFlags
+		req            types.Document
+		resFlags       wire.OpMsgFlags
+		res            types.Document
+		unacknowledged string
+	}{
+		"None": {
+			req: types.MustMakeDocument("ping", int32(1), "$db", "admin"),
+		},
+		"ChecksumPresent": {
+			flags:    wire.OpMsgFlags(wire.OpMsgChecksumPresent),
+			req:      types.MustMakeDocument("ping", int32(1), "$db", "admin"),
+			resFlags: wire.OpMsgFlags(wire.OpMsgChecksumPresent),
+		},
+		"MoreToCome": {
+			flags:          wire.OpMsgFlags(wire.OpMsgMoreToCome),
+			req:            types.MustMakeDocument("ping", int32(1), "$db", "admin"),
+			unacknowledged: "ok",
+		},
+		"MoreToComeError": {
+			flags:          wire.OpMsgFlags(wire.OpMsgMoreToCome),
+			req:            types.MustMakeDocument("shutdown", int32(1), "$db", "testDatabase"),
+			unacknowledged: "error",
+		},
+		"WriteConcernW0Error": {
+			req: types.MustMakeDocument(
+				"shutdown", int32(1),
+				"writeConcern", types.MustMakeDocument("w", int32(0)),
+				"$db", "testDatabase",
+			),
+			res:            types.MustMakeDocument("ok", float64(1)),
+			unacknowledged: "error",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+			reqMsg := wire.OpMsg{FlagBits: tc.flags}
+			require.NoError(t, reqMsg.SetSections(wire.OpMsgSection{
+				Documents: []types.Document{tc.req},
+			}))
+
+			_, resBody, closeConn := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_MSG}, &reqMsg)
+			assert.False(t, closeConn)
+			assert.Equal(t, tc.resFlags, resBody.(*wire.OpMsg).FlagBits)
+			if tc.res.Keys() != nil {
+				res, err := resBody.(*wire.OpMsg).Document()
+				require.NoError(t, err)
+				assert.Equal(t, tc.res, res)
+			}
+
+			command := tc.req.Command()
+			for _, result := range []string{"ok", "error"} {
+				expected := float64(0)
+				if result == tc.unacknowledged {
+					expected = 1
+				}
+				assert.Equal(t, expected, promtestutil.ToFloat64(handler.metrics.unacknowledged.WithLabelValues(command, result)))
+			}
+		})
+	}
+}
+
+func TestAwaitableHello(t *testing.T) {
+	t.Parallel()
+
+	current := types.MustMakeDocument("processId", topologyProcessID, "counter", int64(0))
+	other := types.MustMakeDocument("processId", types.ObjectID{1}, "counter", int64(3))
+
+	for name, tc := range map[string]struct {
+		flags    wire.OpMsgFlags
+		req      types.Document
+		wait     bool
+		resFlags wire.OpMsgFlags
+		err      string
+	}{
+		"Awaitable": {
+			req:  types.MustMakeDocument("hello", int32(1), "topologyVersion", current, "maxAwaitTimeMS", int32(50), "$db", "admin"),
+			wait: true,
+		},
+		"Exhaust": {
+			flags:    wire.OpMsgFlags(wire.OpMsgExhaustAllowed),
+			req:      types.MustMakeDocument("hello", int32(1), "topologyVersion", current, "maxAwaitTimeMS", int32(50), "$db", "admin"),
+			wait:     true,
+			resFlags: wire.OpMsgFlags(wire.OpMsgMoreToCome),
+		},
+		"OtherProcess": {
+			req: types.MustMakeDocument("hello", int32(1), "topologyVersion", other, "maxAwaitTimeMS", int32(10000), "$db", "admin"),
+		},
+		"ExhaustNotAwaitable": {
+			flags: wire.OpMsgFlags(wire.OpMsgExhaustAllowed),
+			req:   types.MustMakeDocument("hello", int32(1), "$db", "admin"),
+		},
+		"MissingTopologyVersion": {
+			req: types.MustMakeDocument("hello", int32(1), "maxAwaitTimeMS", int32(50), "$db", "admin"),
+			err: "A request with 'maxAwaitTimeMS' must include a 'topologyVersion'",
+		},
+		"NegativeMaxAwaitTime": {
+			req: types.MustMakeDocument("hello", int32(1), "topologyVersion", current, "maxAwaitTimeMS", int32(-1), "$db", "admin"),
+			err: "maxAwaitTimeMS must be a non-negative integer",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+			reqMsg := wire.OpMsg{FlagBits: tc.flags}
+			require.NoError(t, reqMsg.SetSections(wire.OpMsgSection{
+				Documents: []types.Document{tc.req},
+			}))
+
+			start := time.Now()
+			_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_MSG}, &reqMsg)
+			elapsed := time.Since(start)
+
+			actual, err := resBody.(*wire.OpMsg).Document()
+			require.NoError(t, err)
+
+			if tc.err != "" {
+				assert.Equal(t, tc.err, actual.Map()["errmsg"])
+				return
+			}
+
+			assert.Equal(t, current, actual.Map()["topologyVersion"])
+			assert.Equal(t, tc.resFlags, resBody.(*wire.OpMsg).FlagBits)
+			if tc.wait {
+				assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+			} else {
+				assert.Less(t, elapsed, time.Second)
+			}
+		})
+	}
+}
+
+func TestLegacyOpcodes(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Insert", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		args := []driver.Value{[]byte{123, 34, 95, 105, 100, 34, 58, 49, 44, 34, 110, 101, 119, 34, 58, 34, 116, 101, 115, 116, 34, 125}}
+
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(10))
+		mock.ExpectQuery("SELECT COMMENTS FROM \"PUBLIC\".\"TABLES\" WHERE SCHEMA_NAME = ? AND TABLE_NAME = ?").WithArgs("testDatabase", "test").WillReturnRows(sqlmock.NewRows([]string{"comments"}))
+		mock.ExpectExec("CREATE SCHEMA \"testDatabase\"").WillReturnError(fmt.Errorf("386: cannot use duplicate schema name"))
+		mock.ExpectExec("CREATE COLLECTION \"testDatabase\".\"test\"").WillReturnError(fmt.Errorf("288: cannot use duplicate table name"))
+		mock.ExpectQuery("SELECT _id FROM \"testDatabase\".\"test\"  WHERE \"_id\" = ? LIMIT 1").WillReturnRows(sqlmock.NewRows([]string{"_id"}))
+		mock.ExpectExec("INSERT INTO \"testDatabase\".\"test\" VALUES ($1)").WithArgs(args...).WillReturnResult(sqlmock.NewResult(1, 1))
+
+		reqBody := &wire.OpInsert{
+			FullCollectionName: "testDatabase.test",
+			Documents:          []types.Document{types.MustMakeDocument("_id", int32(1), "new", "test")},
+		}
+		resHeader, resBody, closeConn := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_INSERT}, reqBody)
+		assert.Nil(t, resHeader)
+		assert.Nil(t, resBody)
+		assert.False(t, closeConn)
+
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.requests.WithLabelValues(wire.OP_INSERT.String(), "insert")))
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.unacknowledged.WithLabelValues("insert", "ok")))
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("DeleteInvalidNamespace", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		reqBody := &wire.OpDelete{FullCollectionName: "test", Selector: types.MustMakeDocument()}
+		_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_DELETE}, reqBody)
+		assert.Nil(t, resBody)
+
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.unacknowledged.WithLabelValues("", "error")))
+	})
+
+	t.Run("GetMoreCursorNotFound", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(10))
+
+		reqBody := &wire.OpGetMore{FullCollectionName: "testDatabase.test", CursorID: 42}
+		resHeader, resBody, closeConn := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_GET_MORE}, reqBody)
+		assert.False(t, closeConn)
+		assert.Equal(t, wire.OP_REPLY, resHeader.OpCode)
+
+		expected := &wire.OpReply{ResponseFlags: wire.OpReplyFlags(wire.OpReplyCursorNotFound)}
+		assert.Equal(t, expected, resBody)
+	})
+
+	t.Run("GetMoreInvalidNamespace", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		reqBody := &wire.OpGetMore{FullCollectionName: "test", CursorID: 42}
+		_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_GET_MORE}, reqBody)
+
+		expected := &wire.OpReply{
+			ResponseFlags:  wire.OpReplyFlags(wire.OpReplyQueryFailure),
+			NumberReturned: 1,
+			Documents: []types.Document{types.MustMakeDocument(
+				"$err", "Invalid namespace specified 'test'",
+				"code", int32(73),
+			)},
+		}
+		assert.Equal(t, expected, resBody)
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, mock := setup(t, QueryMatcherEqualBytes)
+
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage WHERE component_name = 'DOCSTORE' AND feature_name = 'COLLECTIONS'").WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(10))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"SCHEMAS\" WHERE SCHEMA_NAME = ?").WithArgs("databaseName").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT COUNT(*) FROM \"PUBLIC\".\"M_TABLES\" WHERE SCHEMA_NAME = ? AND table_name = ? AND TABLE_TYPE = 'COLLECTION'").WithArgs("databaseName", "actor").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT * FROM \"databaseName\".\"actor\" WHERE \"last_name\" = ?").WithArgs("Doe").WillReturnRows(sqlmock.NewRows([]string{"document"}).AddRow([]byte(`{"_id": 1, "last_name": "Doe"}`)))
+
+		reqBody := &wire.OpQuery{
+			FullCollectionName: "databaseName.actor",
+			Query:              types.MustMakeDocument("$query", types.MustMakeDocument("last_name", "Doe")),
+		}
+		resHeader, resBody, closeConn := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_QUERY}, reqBody)
+		assert.False(t, closeConn)
+		assert.Equal(t, wire.OP_REPLY, resHeader.OpCode)
+
+		expected := &wire.OpReply{
+			NumberReturned: 1,
+			Documents:      []types.Document{types.MustMakeDocument("_id", int32(1), "last_name", "Doe")},
+		}
+		assert.Equal(t, expected, resBody)
+
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.requests.WithLabelValues(wire.OP_QUERY.String(), "find")))
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("there were unfulfilled expectations: %s", err)
+		}
+	})
+
+	t.Run("QueryExhaust", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		reqBody := &wire.OpQuery{
+			Flags:              wire.OpQueryFlags(wire.OpQueryExhaust),
+			FullCollectionName: "databaseName.actor",
+			Query:              types.MustMakeDocument(),
+		}
+		_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_QUERY}, reqBody)
+
+		expected := &wire.OpReply{
+			ResponseFlags:  wire.OpReplyFlags(wire.OpReplyQueryFailure),
+			NumberReturned: 1,
+			Documents: []types.Document{types.MustMakeDocument(
+				"$err", "OP_QUERY flag Exhaust is not implemented yet",
+				"code", int32(238),
+			)},
+		}
+		assert.Equal(t, expected, resBody)
+	})
+
+	t.Run("KillCursorsUnknown", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		_, resBody, _ := handler.Handle(ctx, &wire.MsgHeader{RequestID: 1, OpCode: wire.OP_KILL_CURSORS}, &wire.OpKillCursors{CursorIDs: []int64{42}})
+		assert.Nil(t, resBody)
+
+		assert.Equal(t, float64(1), promtestutil.ToFloat64(handler.metrics.requests.WithLabelValues(wire.OP_KILL_CURSORS.String(), "")))
+	})
+
+	t.Run("CursorsExpire", func(t *testing.T) {
+		t.Parallel()
+
+		_, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		now := time.Now()
+		handler.legacyCursors[1] = legacyCursor{ns: "testDatabase.test", lastUsed: now.Add(-11 * time.Minute)}
+		handler.legacyCursors[2] = legacyCursor{ns: "testDatabase.test", lastUsed: now.Add(-9 * time.Minute)}
+		handler.legacyCursors[3] = legacyCursor{ns: "testDatabase.test", noTimeout: true, lastUsed: now.Add(-11 * time.Minute)}
+		handler.legacyCursors[4] = legacyCursor{ns: "testDatabase.test", noTimeout: true, lastUsed: now.Add(-25 * time.Hour)}
+
+		handler.expireLegacyCursors(now)
+
+		ids := make([]int64, 0, len(handler.legacyCursors))
+		for id := range handler.legacyCursors {
+			ids = append(ids, id)
+		}
+		assert.ElementsMatch(t, []int64{2, 3}, ids)
+	})
+
+	t.Run("CloseReleasesCursors", func(t *testing.T) {
+		t.Parallel()
+
+		_, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+		handler.recordLegacyCursor(42, "testDatabase.test", false)
+		require.Len(t, handler.legacyCursors, 1)
+
+		handler.Close()
+		assert.Empty(t, handler.legacyCursors)
+	})
+}
+
+func TestLegacyFind(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		query    wire.OpQuery
+		expected types.Document
+		err      string
+	}{
+		"Filter": {
+			query: wire.OpQuery{
+				FullCollectionName:   "db.system.indexes",
+				NumberToSkip:         5,
+				NumberToReturn:       20,
+				Query:                types.MustMakeDocument("a", int32(1)),
+				ReturnFieldsSelector: types.MustMakeDocumentPointer("a", int32(1)),
+			},
+			expected: types.MustMakeDocument(
+				"find", "system.indexes",
+				"filter", types.MustMakeDocument("a", int32(1)),
+				"projection", types.MustMakeDocument("a", int32(1)),
+				"skip", int64(5),
+				"batchSize", int64(20),
+				"$db", "db",
+			),
+		},
+		"Modifiers": {
+			query: wire.OpQuery{
+				Flags:              wire.OpQueryFlags(wire.OpQuerySlaveOk | wire.OpQueryNoCursorTimeout),
+				FullCollectionName: "db.c",
+				NumberToReturn:     -3,
+				Query: types.MustMakeDocument(
+					"$query", types.MustMakeDocument("a", int32(1)),
+					"$orderby", types.MustMakeDocument("b", int32(-1)),
+				),
+			},
+			expected: types.MustMakeDocument(
+				"find", "c",
+				"filter", types.MustMakeDocument("a", int32(1)),
+				"sort", types.MustMakeDocument("b", int32(-1)),
+				"limit", int64(3),
+				"singleBatch", true,
+				"noCursorTimeout", true,
+				"$db", "db",
+			),
+		},
+		"UnknownModifier": {
+			query: wire.OpQuery{
+				FullCollectionName: "db.c",
+				Query:              types.MustMakeDocument("query", types.MustMakeDocument(), "$snapshot", true),
+			},
+			err: "NotImplemented (238): query modifier $snapshot is not implemented yet",
+		},
+		"InvalidNamespace": {
+			query: wire.OpQuery{FullCollectionName: "db", Query: types.MustMakeDocument()},
+			err:   "InvalidNamespace (73): Invalid namespace specified 'db'",
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := legacyFind(&tc.query)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestReplyTooLarge(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		opCode   wire.OpCode
+		err      error
+		expected wire.MsgBody
+	}{
+		"Message": {
+			opCode: wire.OP_MSG,
+			err:    wire.ErrMessageTooLarge,
+			expected: func() wire.MsgBody {
+				var msg wire.OpMsg
+				require.NoError(t, msg.SetSections(wire.OpMsgSection{Documents: []types.Document{types.MustMakeDocument(
+					"ok", float64(0),
+					"errmsg", "message is larger than maxMessageSizeBytes of 48000000 bytes",
+					"code", int32(15),
+					"codeName", "Overflow",
+				)}}))
+				return &msg
+			}(),
+		},
+		"Document": {
+			opCode: wire.OP_QUERY,
+			err:    bson.ErrDocumentTooLarge,
+			expected: &wire.OpReply{
+				ResponseFlags:  wire.OpReplyFlags(wire.OpReplyQueryFailure),
+				NumberReturned: 1,
+				Documents: []types.Document{types.MustMakeDocument(
+					"$err", "document is larger than the maximum of 16793600 bytes",
+					"code", int32(10334),
+				)},
+			},
+		},
+		"NoReply": {
+			opCode: wire.OP_INSERT,
+			err:    bson.ErrDocumentTooLarge,
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+			resHeader, resBody := handler.ReplyTooLarge(&wire.MsgHeader{RequestID: 7, OpCode: tc.opCode}, tc.err)
+			if tc.expected == nil {
+				assert.Nil(t, resHeader)
+				assert.Nil(t, resBody)
+				return
+			}
+
+			assert.Equal(t, tc.expected, resBody)
+			assert.Equal(t, int32(7), resHeader.ResponseTo)
+
+			b, err := resBody.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, int32(wire.MsgHeaderLen+len(b)), resHeader.MessageLength)
+		})
+	}
+}
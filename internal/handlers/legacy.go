@@ -0,0 +1,460 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// legacyCursor is a cursor returned by OP_QUERY or OP_GET_MORE, recorded for OP_KILL_CURSORS,
+// which has no namespace.
+type legacyCursor struct {
+	ns string
+
+	// noTimeout is set by the flag NoCursorTimeout of OP_QUERY, like noCursorTimeout of find
+	noTimeout bool
+	lastUsed  time.Time
+}
+
+// recordLegacyCursor records the cursor of a reply of OP_QUERY or OP_GET_MORE.
+func (h *Handler) recordLegacyCursor(id int64, ns string, noTimeout bool) {
+	now := time.Now()
+	h.expireLegacyCursors(now)
+
+	h.legacyCursors[id] = legacyCursor{
+		ns:        ns,
+		noTimeout: noTimeout,
+		lastUsed:  now,
+	}
+}
+
+// expireLegacyCursors forgets the legacy cursors which were not used for longer than their crud.CursorTimeout,
+// as Cursors.Reap closed them, so that clients which never exhaust or kill their cursors do not grow the map.
+// Cursors continued with getMore commands instead may be forgotten earlier; OP_KILL_CURSORS skips them then,
+// and they are closed when they time out.
+func (h *Handler) expireLegacyCursors(now time.Time) {
+	for id, c := range h.legacyCursors {
+		if now.Sub(c.lastUsed) > crud.CursorTimeout(c.noTimeout) {
+			delete(h.legacyCursors, id)
+		}
+	}
+}
+
+// splitNamespace returns the database and the collection of the full collection name "db.collection"
+// of a legacy opcode.
+func splitNamespace(fullCollectionName string) (string, string, error) {
+	db, collection, ok := strings.Cut(fullCollectionName, ".")
+	if !ok || db == "" || collection == "" {
+		return "", "", common.NewErrorMessage(common.ErrInvalidNamespace, "Invalid namespace specified '%s'", fullCollectionName)
+	}
+
+	return db, collection, nil
+}
+
+// runLegacyCommand runs the command document converted from a message of a legacy opcode
+// like the command of an OP_MSG.
+func (h *Handler) runLegacyCommand(ctx context.Context, opCode wire.OpCode, document types.Document) (types.Document, error) {
+	h.metrics.requests.WithLabelValues(opCode.String(), document.Command()).Inc()
+
+	var msg wire.OpMsg
+	if err := msg.SetSections(wire.OpMsgSection{Documents: []types.Document{document}}); err != nil {
+		return types.Document{}, lazyerrors.Error(err)
+	}
+
+	res, err := h.runOpMsg(ctx, &msg, document)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	return res.Document()
+}
+
+// handleLegacyNoReply handles OP_INSERT, OP_UPDATE, OP_DELETE and OP_KILL_CURSORS, which have no reply.
+// Like unacknowledged writes, their errors are only counted and logged.
+func (h *Handler) handleLegacyNoReply(ctx context.Context, opCode wire.OpCode, body wire.MsgBody) {
+	var document types.Document
+	var err error
+
+	switch body := body.(type) {
+	case *wire.OpInsert:
+		document, err = legacyInsert(body)
+	case *wire.OpUpdate:
+		document, err = legacyUpdate(body)
+	case *wire.OpDelete:
+		document, err = legacyDelete(body)
+	case *wire.OpKillCursors:
+		h.legacyKillCursors(ctx, body)
+		return
+	default:
+		panic(fmt.Sprintf("unexpected legacy message %T", body))
+	}
+
+	if err != nil {
+		h.metrics.requests.WithLabelValues(opCode.String(), "").Inc()
+		h.observeUnacknowledgedCommand("", err)
+		return
+	}
+
+	res, err := h.runLegacyCommand(ctx, opCode, document)
+	if err == nil {
+		if writeErrors, ok := res.Map()["writeErrors"].(*types.Array); ok && writeErrors.Len() > 0 {
+			first, _ := writeErrors.Get(0)
+			err = lazyerrors.Errorf("%d write errors, first: %v", writeErrors.Len(), first)
+		}
+	}
+
+	h.observeUnacknowledgedCommand(document.Command(), err)
+}
+
+// legacyInsert converts OP_INSERT to an insert command.
+func legacyInsert(insert *wire.OpInsert) (types.Document, error) {
+	db, collection, err := splitNamespace(insert.FullCollectionName)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	documents := types.MakeArray(len(insert.Documents))
+	for _, doc := range insert.Documents {
+		if err = documents.Append(doc); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	return types.MakeDocument(
+		"insert", collection,
+		"documents", documents,
+		"ordered", !insert.ContinueOnError,
+		"$db", db,
+	)
+}
+
+// legacyUpdate converts OP_UPDATE to an update command.
+func legacyUpdate(update *wire.OpUpdate) (types.Document, error) {
+	db, collection, err := splitNamespace(update.FullCollectionName)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	return types.MakeDocument(
+		"update", collection,
+		"updates", types.MustNewArray(types.MustMakeDocument(
+			"q", update.Selector,
+			"u", update.Update,
+			"upsert", update.Upsert,
+			"multi", update.MultiUpdate,
+		)),
+		"$db", db,
+	)
+}
+
+// legacyDelete converts OP_DELETE to a delete command.
+func legacyDelete(del *wire.OpDelete) (types.Document, error) {
+	db, collection, err := splitNamespace(del.FullCollectionName)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	// the limit of 0 deletes all matching documents
+	var limit int32
+	if del.SingleRemove {
+		limit = 1
+	}
+
+	return types.MakeDocument(
+		"delete", collection,
+		"deletes", types.MustNewArray(types.MustMakeDocument(
+			"q", del.Selector,
+			"limit", limit,
+		)),
+		"$db", db,
+	)
+}
+
+// handleOpGetMore converts OP_GET_MORE to a getMore command and replies with its next batch.
+// As the reply of OP_GET_MORE can't be an OP_MSG, errors are returned in the reply.
+func (h *Handler) handleOpGetMore(ctx context.Context, getMore *wire.OpGetMore) (*wire.OpReply, error) {
+	res, err := h.legacyGetMore(ctx, getMore)
+	if err != nil {
+		return legacyErrorReply(err), nil
+	}
+
+	return res, nil
+}
+
+// legacyErrorReply returns the OP_REPLY of the error of OP_QUERY or OP_GET_MORE:
+// the CursorNotFound flag for an unknown cursor, and the QueryFailure flag with the error document otherwise.
+func legacyErrorReply(err error) *wire.OpReply {
+	protoErr, _ := common.ProtocolError(err)
+	m := protoErr.Document().Map()
+
+	if m["code"] == int32(common.ErrCursorNotFound) {
+		return &wire.OpReply{ResponseFlags: wire.OpReplyFlags(wire.OpReplyCursorNotFound)}
+	}
+
+	return &wire.OpReply{
+		ResponseFlags:  wire.OpReplyFlags(wire.OpReplyQueryFailure),
+		NumberReturned: 1,
+		Documents:      []types.Document{types.MustMakeDocument("$err", m["errmsg"], "code", m["code"])},
+	}
+}
+
+// legacyQueryModifiers are the fields of the find command of the modifiers of a wrapped OP_QUERY
+// like {$query: {...}, $orderby: {...}}.
+var legacyQueryModifiers = map[string]string{
+	"$query":     "filter",
+	"query":      "filter",
+	"$orderby":   "sort",
+	"orderby":    "sort",
+	"$hint":      "hint",
+	"$comment":   "comment",
+	"$maxTimeMS": "maxTimeMS",
+	"$max":       "max",
+	"$min":       "min",
+	"$returnKey": "returnKey",
+}
+
+// legacyQueryFlags are the fields of the find command of the flags of OP_QUERY.
+var legacyQueryFlags = []struct {
+	bit   wire.OpQueryFlagBit
+	field string
+}{
+	{wire.OpQueryTailableCursor, "tailable"},
+	{wire.OpQueryOplogReplay, "oplogReplay"},
+	{wire.OpQueryNoCursorTimeout, "noCursorTimeout"},
+	{wire.OpQueryAwaitData, "awaitData"},
+	{wire.OpQueryPartial, "allowPartialResults"},
+}
+
+// legacyFind converts OP_QUERY of a collection to a find command.
+func legacyFind(query *wire.OpQuery) (types.Document, error) {
+	db, collection, err := splitNamespace(query.FullCollectionName)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	document := types.MustMakeDocument("find", collection)
+
+	// the query is either the filter or wrapped with modifiers, if its first field is $query or query
+	filter := query.Query
+	if keys := query.Query.Keys(); len(keys) > 0 && (keys[0] == "$query" || keys[0] == "query") {
+		filter = types.MustMakeDocument()
+		for _, k := range keys {
+			field, ok := legacyQueryModifiers[k]
+			if !ok {
+				return types.Document{}, common.NewErrorMessage(common.ErrNotImplemented, "query modifier %s is not implemented yet", k)
+			}
+			if err = document.Set(field, query.Query.Map()[k]); err != nil {
+				return types.Document{}, lazyerrors.Error(err)
+			}
+		}
+	}
+	if _, ok := document.Map()["filter"]; !ok {
+		if err = document.Set("filter", filter); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	if query.ReturnFieldsSelector != nil && len(query.ReturnFieldsSelector.Keys()) > 0 {
+		if err = document.Set("projection", *query.ReturnFieldsSelector); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	if query.NumberToSkip > 0 {
+		if err = document.Set("skip", int64(query.NumberToSkip)); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	// a negative numberToReturn, or 1, is the limit of a single batch, and a positive one the size of the first batch
+	switch n := query.NumberToReturn; {
+	case n < 0 || n == 1:
+		if n < 0 {
+			n = -n
+		}
+		if err = document.Set("limit", int64(n)); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+		if err = document.Set("singleBatch", true); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	case n > 1:
+		if err = document.Set("batchSize", int64(n)); err != nil {
+			return types.Document{}, lazyerrors.Error(err)
+		}
+	}
+
+	if query.Flags.FlagSet(wire.OpQueryExhaust) {
+		return types.Document{}, common.NewErrorMessage(common.ErrNotImplemented, "OP_QUERY flag Exhaust is not implemented yet")
+	}
+	for _, flag := range legacyQueryFlags {
+		if query.Flags.FlagSet(flag.bit) {
+			if err = document.Set(flag.field, true); err != nil {
+				return types.Document{}, lazyerrors.Error(err)
+			}
+		}
+	}
+
+	if err = document.Set("$db", db); err != nil {
+		return types.Document{}, lazyerrors.Error(err)
+	}
+
+	return document, nil
+}
+
+// handleLegacyFind runs the find command of OP_QUERY of a collection and replies with its first batch.
+// The namespace of its cursor is recorded for OP_GET_MORE and OP_KILL_CURSORS.
+func (h *Handler) handleLegacyFind(ctx context.Context, query *wire.OpQuery) *wire.OpReply {
+	document, err := legacyFind(query)
+	if err != nil {
+		h.metrics.requests.WithLabelValues(wire.OP_QUERY.String(), "find").Inc()
+		return legacyErrorReply(err)
+	}
+
+	res, err := h.runLegacyCommand(ctx, wire.OP_QUERY, document)
+	if err != nil {
+		return legacyErrorReply(err)
+	}
+
+	id, batch, err := legacyBatch(res, "firstBatch")
+	if err != nil {
+		return legacyErrorReply(err)
+	}
+
+	if id != 0 {
+		h.recordLegacyCursor(id, query.FullCollectionName, query.Flags.FlagSet(wire.OpQueryNoCursorTimeout))
+	}
+
+	return &wire.OpReply{
+		CursorID:       id,
+		NumberReturned: int32(len(batch)),
+		Documents:      batch,
+	}
+}
+
+// legacyBatch returns the cursor id and the documents of the batch of the reply of find or getMore.
+func legacyBatch(res types.Document, batchField string) (int64, []types.Document, error) {
+	cursor, ok := res.Map()["cursor"].(types.Document)
+	if !ok {
+		return 0, nil, lazyerrors.Errorf("reply has no cursor: %v", res)
+	}
+	id, _ := cursor.Map()["id"].(int64)
+
+	batch, _ := cursor.Map()[batchField].(*types.Array)
+	if batch == nil {
+		return id, nil, nil
+	}
+
+	docs := make([]types.Document, batch.Len())
+	for i := range docs {
+		v, _ := batch.Get(i)
+		doc, ok := v.(types.Document)
+		if !ok {
+			return 0, nil, lazyerrors.Errorf("reply has a batch of %T", v)
+		}
+		docs[i] = doc
+	}
+
+	return id, docs, nil
+}
+
+// legacyGetMore runs the getMore command of OP_GET_MORE and records the namespace of the cursor for OP_KILL_CURSORS.
+func (h *Handler) legacyGetMore(ctx context.Context, getMore *wire.OpGetMore) (*wire.OpReply, error) {
+	db, collection, err := splitNamespace(getMore.FullCollectionName)
+	if err != nil {
+		h.metrics.requests.WithLabelValues(wire.OP_GET_MORE.String(), "").Inc()
+		return nil, err
+	}
+
+	document := types.MustMakeDocument(
+		"getMore", getMore.CursorID,
+		"collection", collection,
+		"$db", db,
+	)
+
+	// a negative numberToReturn closes the cursor after the batch, which is the same for the client
+	batchSize := getMore.NumberToReturn
+	if batchSize < 0 {
+		batchSize = -batchSize
+	}
+	if batchSize > 0 {
+		if err = document.Set("batchSize", int64(batchSize)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	res, err := h.runLegacyCommand(ctx, wire.OP_GET_MORE, document)
+	if err != nil {
+		return nil, err
+	}
+
+	id, batch, err := legacyBatch(res, "nextBatch")
+	if err != nil {
+		return nil, err
+	}
+	reply := &wire.OpReply{
+		CursorID:       id,
+		NumberReturned: int32(len(batch)),
+		Documents:      batch,
+	}
+
+	if id == 0 {
+		delete(h.legacyCursors, getMore.CursorID)
+	} else {
+		h.recordLegacyCursor(id, getMore.FullCollectionName, h.legacyCursors[id].noTimeout)
+	}
+
+	return reply, nil
+}
+
+// legacyKillCursors kills the cursors of OP_KILL_CURSORS with killCursors commands.
+// As OP_KILL_CURSORS has no namespace, only the cursors returned by OP_QUERY or OP_GET_MORE on this connection
+// can be killed; the others are closed when they time out.
+func (h *Handler) legacyKillCursors(ctx context.Context, killCursors *wire.OpKillCursors) {
+	// cursor ids by namespace
+	namespaces := map[string][]any{}
+	var unknown int
+	for _, id := range killCursors.CursorIDs {
+		c, ok := h.legacyCursors[id]
+		if !ok {
+			unknown++
+			continue
+		}
+		delete(h.legacyCursors, id)
+		namespaces[c.ns] = append(namespaces[c.ns], id)
+	}
+
+	if unknown > 0 {
+		h.l.Debug("OP_KILL_CURSORS with cursors of unknown namespaces", zap.Int("cursors", unknown))
+	}
+
+	if len(namespaces) == 0 {
+		h.metrics.requests.WithLabelValues(wire.OP_KILL_CURSORS.String(), "").Inc()
+		return
+	}
+
+	for ns, ids := range namespaces {
+		db, collection, _ := splitNamespace(ns)
+		document := types.MustMakeDocument(
+			"killCursors", collection,
+			"cursors", types.MustNewArray(ids...),
+			"$db", db,
+		)
+
+		_, err := h.runLegacyCommand(ctx, wire.OP_KILL_CURSORS, document)
+		h.observeUnacknowledgedCommand(document.Command(), err)
+	}
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// setServiceID sets the serviceId of the hello reply if the driver connects in load-balanced mode with loadBalanced: true,
+// like mongos behind a load balancer.
+//
+// Drivers in load-balanced mode don't monitor the servers behind the load balancer,
+// and pin cursors and transactions to their connection, whose handler holds them.
+// The serviceId identifies this process, so that drivers only clear the connections to it after its errors.
+func setServiceID(reply *types.Document, request types.Document) error {
+	v, ok := request.Map()["loadBalanced"]
+	if !ok {
+		return nil
+	}
+
+	loadBalanced, ok := v.(bool)
+	if !ok {
+		return common.NewErrorMessage(common.ErrTypeMismatch, "loadBalanced must be a boolean. Got instead: %T", v)
+	}
+
+	if !loadBalanced {
+		return nil
+	}
+
+	if err := reply.Set("serviceId", topologyProcessID); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
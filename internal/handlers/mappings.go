@@ -0,0 +1,561 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// Mappings are the virtual collections and the row-level security filters of collections,
+// loaded from a JSON file like:
+//
+//	{
+//	  "virtualCollections": {"shop.openOrders": {"collection": "orders", "filter": {"status": "open"}}},
+//	  "rowLevelSecurity": {"shop.orders": {"ANALYST_EU": {"region": "EU"}}}
+//	}
+//
+// A virtual collection is a filtered view of another collection of the same database.
+// The row-level security filters of a collection restrict the documents read, updated and deleted
+// by the users with the SAP HANA roles; users with none of the roles are not allowed to access them.
+//
+// They are shared by all connections, and replaced at once when the file changes, see Watch.
+type Mappings struct {
+	rw  sync.Mutex
+	set *mappingSet
+
+	path      string
+	version   string
+	loadedAt  time.Time
+	lastError error
+}
+
+// MappingsStatus describes the active mappings.
+type MappingsStatus struct {
+	// Path is the file the mappings were loaded from.
+	Path string
+
+	// Version is the beginning of the SHA-256 of the file contents.
+	Version string
+
+	// LoadedAt is when the active mappings were loaded.
+	LoadedAt time.Time
+
+	// VirtualCollections is the number of virtual collections.
+	VirtualCollections int
+
+	// RowLevelSecurity is the number of collections with row-level security filters.
+	RowLevelSecurity int
+
+	// LastError is why the latest change of the file was rejected, nil if it was applied.
+	LastError error
+}
+
+// mappingsFile is the contents of the mappings file.
+type mappingsFile struct {
+	VirtualCollections map[string]struct {
+		Collection string          `json:"collection"`
+		Filter     json.RawMessage `json:"filter"`
+	} `json:"virtualCollections"`
+	RowLevelSecurity map[string]map[string]json.RawMessage `json:"rowLevelSecurity"`
+}
+
+// mappingSet is a validated version of the mappings file, which is never modified.
+type mappingSet struct {
+	// virtual collections by namespace
+	virtual map[string]virtualCollection
+
+	// row-level security filters by namespace and role
+	rowFilters map[string]map[string]types.Document
+}
+
+// virtualCollection is a filtered view of a collection.
+type virtualCollection struct {
+	collection string
+	filter     types.Document
+}
+
+// mappedFilters are the fields of the filters of the commands reading, updating or deleting documents.
+var mappedFilters = map[string]string{
+	"count":         "query",
+	"find":          "filter",
+	"findAndModify": "query",
+	"findandmodify": "query",
+}
+
+// LoadMappings reads the mappings from a JSON file.
+func LoadMappings(path string) (*Mappings, error) {
+	set, version, err := readMappings(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Mappings{
+		set:      set,
+		path:     path,
+		version:  version,
+		loadedAt: time.Now(),
+	}, nil
+}
+
+// readMappings reads and validates the mappings file and returns the mappings and their version.
+func readMappings(path string) (*mappingSet, string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", lazyerrors.Error(err)
+	}
+
+	var file mappingsFile
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, "", lazyerrors.Error(err)
+	}
+
+	set := &mappingSet{
+		virtual:    make(map[string]virtualCollection, len(file.VirtualCollections)),
+		rowFilters: make(map[string]map[string]types.Document, len(file.RowLevelSecurity)),
+	}
+
+	for ns, v := range file.VirtualCollections {
+		db, _, err := splitNamespace(ns)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: virtual collection %q must be a namespace like db.collection", path, ns)
+		}
+		if v.Collection == "" || strings.Contains(v.Collection, "$") {
+			return nil, "", fmt.Errorf("%s: virtual collection %s must have a valid collection", path, ns)
+		}
+		if _, ok := file.VirtualCollections[db+"."+v.Collection]; ok {
+			return nil, "", fmt.Errorf("%s: virtual collection %s must not map to another virtual collection", path, ns)
+		}
+
+		filter, err := readMappingFilter(v.Filter)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: filter of virtual collection %s: %w", path, ns, err)
+		}
+
+		set.virtual[ns] = virtualCollection{collection: v.Collection, filter: filter}
+	}
+
+	for ns, roles := range file.RowLevelSecurity {
+		if _, _, err := splitNamespace(ns); err != nil {
+			return nil, "", fmt.Errorf("%s: row-level security of %q must be for a namespace like db.collection", path, ns)
+		}
+		if _, ok := set.virtual[ns]; ok {
+			return nil, "", fmt.Errorf("%s: row-level security of %s must be for the collection of the virtual collection", path, ns)
+		}
+		if len(roles) == 0 {
+			return nil, "", fmt.Errorf("%s: row-level security of %s must have filters of roles", path, ns)
+		}
+
+		set.rowFilters[ns] = make(map[string]types.Document, len(roles))
+		for role, raw := range roles {
+			if role == "" {
+				return nil, "", fmt.Errorf("%s: row-level security of %s: role name must not be empty", path, ns)
+			}
+
+			filter, err := readMappingFilter(raw)
+			if err != nil {
+				return nil, "", fmt.Errorf("%s: row-level security filter of %s for role %s: %w", path, ns, role, err)
+			}
+
+			set.rowFilters[ns][role] = filter
+		}
+	}
+
+	sum := sha256.Sum256(b)
+
+	return set, hex.EncodeToString(sum[:6]), nil
+}
+
+// readMappingFilter returns the filter, which must be a document translatable to SAP HANA SQL.
+// A missing filter matches all documents.
+func readMappingFilter(raw json.RawMessage) (types.Document, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return types.MustMakeDocument(), nil
+	}
+
+	v, err := fjson.Unmarshal(raw)
+	if err != nil {
+		return types.Document{}, err
+	}
+
+	filter, ok := v.(types.Document)
+	if !ok {
+		return types.Document{}, fmt.Errorf("filter must be a document")
+	}
+
+	if _, err = common.CreateWhereClause(filter, new(common.Placeholder)); err != nil {
+		return types.Document{}, err
+	}
+
+	return filter, nil
+}
+
+// Watch checks the file the mappings were loaded from every interval until ctx is canceled.
+// A changed file is validated and replaces the mappings of all connections at once;
+// an invalid file is logged and the active mappings stay in place.
+func (m *Mappings) Watch(ctx context.Context, interval time.Duration, l *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// the same error is only logged once
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := m.reload()
+		switch {
+		case err != nil && err.Error() != lastErr:
+			l.Warn("Failed to reload mappings, keeping the active ones", zap.String("path", m.path), zap.Error(err))
+		case reloaded:
+			l.Info("Reloaded mappings", zap.String("path", m.path), zap.String("version", m.Status().Version))
+		}
+
+		lastErr = ""
+		if err != nil {
+			lastErr = err.Error()
+		}
+	}
+}
+
+// reload replaces the mappings if the file changed and is valid.
+func (m *Mappings) reload() (bool, error) {
+	set, version, err := readMappings(m.path)
+
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	m.lastError = err
+	if err != nil || version == m.version {
+		return false, err
+	}
+
+	m.set = set
+	m.version = version
+	m.loadedAt = time.Now()
+
+	return true, nil
+}
+
+// Status returns the description of the active mappings.
+func (m *Mappings) Status() MappingsStatus {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	return MappingsStatus{
+		Path:               m.path,
+		Version:            m.version,
+		LoadedAt:           m.loadedAt,
+		VirtualCollections: len(m.set.virtual),
+		RowLevelSecurity:   len(m.set.rowFilters),
+		LastError:          m.lastError,
+	}
+}
+
+// active returns the active mappings, which are used for a whole command even if the file is reloaded meanwhile.
+func (m *Mappings) active() *mappingSet {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	return m.set
+}
+
+// rewrite returns the request document for the collection of the virtual collection,
+// with the filters of the virtual collection and the row-level security filters of the roles.
+// Like PreCommand of Middleware, the zero document is returned for requests which are not rewritten.
+func (s *mappingSet) rewrite(document types.Document, roles func() ([]string, error)) (types.Document, error) {
+	command := document.Command()
+	m := document.Map()
+
+	if command == "explain" {
+		explained, ok := m["explain"].(types.Document)
+		if !ok {
+			return types.Document{}, nil
+		}
+
+		// the explained command is in the database of the explain command
+		_, hasDB := explained.Map()["$db"]
+		if !hasDB {
+			db, _ := m["$db"].(string)
+			explained = withField(explained, "$db", db)
+		}
+
+		rewritten, err := s.rewrite(explained, roles)
+		if err != nil || rewritten.Map() == nil {
+			return types.Document{}, err
+		}
+		if !hasDB {
+			if err = rewritten.Remove("$db"); err != nil {
+				return types.Document{}, lazyerrors.Error(err)
+			}
+		}
+
+		return withField(document, "explain", rewritten), nil
+	}
+
+	db, _ := m["$db"].(string)
+	collection, ok := m[command].(string)
+	if !ok {
+		return types.Document{}, nil
+	}
+
+	if command == "aggregate" {
+		if ns := s.mappedLookup(db, m["pipeline"]); ns != "" {
+			return types.Document{}, common.NewErrorMessage(
+				common.ErrNotImplemented, "namespace %s has mappings and can only be aggregated by its own pipeline", ns,
+			)
+		}
+	}
+
+	target := collection
+	var filters []any
+
+	virtual, isVirtual := s.virtual[db+"."+collection]
+	if isVirtual {
+		target = virtual.collection
+		if len(virtual.filter.Keys()) > 0 {
+			filters = append(filters, virtual.filter)
+		}
+	}
+
+	rowFilters, hasRowFilters := s.rowFilters[db+"."+target]
+
+	_, filtered := mappedFilters[command]
+	filtered = filtered || command == "aggregate" || command == "update" || command == "delete"
+
+	switch {
+	case !isVirtual && !hasRowFilters:
+		return types.Document{}, nil
+	case !filtered && isVirtual:
+		return types.Document{}, common.NewErrorMessage(
+			common.ErrIllegalOperation, "command %s is not allowed on virtual collection %s.%s", command, db, collection,
+		)
+	case !filtered:
+		// inserts and the commands of collections and indexes are checked by the privileges of SAP HANA
+		return types.Document{}, nil
+	}
+
+	if hasRowFilters {
+		userRoles, err := roles()
+		if err != nil {
+			return types.Document{}, err
+		}
+
+		var roleFilters []any
+		sort.Strings(userRoles)
+		for _, role := range userRoles {
+			if f, ok := rowFilters[role]; ok {
+				roleFilters = append(roleFilters, f)
+			}
+		}
+
+		switch len(roleFilters) {
+		case 0:
+			return types.Document{}, common.NewErrorMessage(
+				common.ErrUnauthorized, "none of the roles of the user have a row-level security filter of %s.%s", db, target,
+			)
+		case 1:
+			filters = append(filters, roleFilters[0])
+		default:
+			filters = append(filters, types.MustMakeDocument("$or", types.MustNewArray(roleFilters...)))
+		}
+	}
+
+	document = withField(document, command, target)
+
+	switch command {
+	case "aggregate":
+		pipeline, ok := m["pipeline"].(*types.Array)
+		if !ok {
+			return document, nil
+		}
+
+		stages := make([]any, 0, pipeline.Len()+1)
+		if len(filters) > 0 {
+			stages = append(stages, types.MustMakeDocument("$match", andFilters(types.MustMakeDocument(), filters)))
+		}
+		for i := 0; i < pipeline.Len(); i++ {
+			stage, _ := pipeline.Get(i)
+			stages = append(stages, stage)
+		}
+
+		return withField(document, "pipeline", types.MustNewArray(stages...)), nil
+
+	case "update", "delete":
+		field, filterField := "updates", "q"
+		if command == "delete" {
+			field = "deletes"
+		}
+
+		statements, ok := m[field].(*types.Array)
+		if !ok {
+			return document, nil
+		}
+
+		rewritten := make([]any, statements.Len())
+		for i := 0; i < statements.Len(); i++ {
+			v, _ := statements.Get(i)
+			statement, ok := v.(types.Document)
+			if !ok {
+				rewritten[i] = v
+				continue
+			}
+
+			filter, _ := statement.Map()[filterField].(types.Document)
+			rewritten[i] = withField(statement, filterField, andFilters(filter, filters))
+		}
+
+		return withField(document, field, types.MustNewArray(rewritten...)), nil
+
+	default:
+		filterField := mappedFilters[command]
+		filter, _ := m[filterField].(types.Document)
+
+		return withField(document, filterField, andFilters(filter, filters)), nil
+	}
+}
+
+// mappedLookup returns the namespace with mappings which is read by a stage of the pipeline,
+// like the collection of $lookup, or an empty string.
+func (s *mappingSet) mappedLookup(db string, value any) string {
+	switch value := value.(type) {
+	case types.Document:
+		m := value.Map()
+		for _, k := range value.Keys() {
+			var from any
+			switch k {
+			case "$lookup", "$graphLookup":
+				if stage, ok := m[k].(types.Document); ok {
+					from = stage.Map()["from"]
+				}
+			case "$unionWith":
+				from = m[k]
+				if stage, ok := from.(types.Document); ok {
+					from = stage.Map()["coll"]
+				}
+			}
+
+			if collection, ok := from.(string); ok {
+				ns := db + "." + collection
+				if _, ok := s.virtual[ns]; ok {
+					return ns
+				}
+				if _, ok := s.rowFilters[ns]; ok {
+					return ns
+				}
+			}
+
+			if ns := s.mappedLookup(db, m[k]); ns != "" {
+				return ns
+			}
+		}
+	case *types.Array:
+		for i := 0; i < value.Len(); i++ {
+			v, _ := value.Get(i)
+			if ns := s.mappedLookup(db, v); ns != "" {
+				return ns
+			}
+		}
+	}
+
+	return ""
+}
+
+// andFilters returns the filter matching the documents matched by the filter and all other filters.
+func andFilters(filter types.Document, filters []any) types.Document {
+	if len(filters) == 0 {
+		return filter
+	}
+
+	if len(filter.Keys()) > 0 {
+		filters = append([]any{filter}, filters...)
+	}
+	if len(filters) == 1 {
+		return filters[0].(types.Document)
+	}
+
+	return types.MustMakeDocument("$and", types.MustNewArray(filters...))
+}
+
+// withField returns a copy of the document with the value of the field, which is appended if it is missing.
+func withField(document types.Document, field string, value any) types.Document {
+	m := document.Map()
+
+	pairs := make([]any, 0, 2*len(m)+2)
+	for _, k := range document.Keys() {
+		v := m[k]
+		if k == field {
+			v = value
+		}
+		pairs = append(pairs, k, v)
+	}
+	if _, ok := m[field]; !ok {
+		pairs = append(pairs, field, value)
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// applyMappings returns the request for the collection of a virtual collection with the filters of the mappings,
+// or the request unchanged without mappings.
+func (h *Handler) applyMappings(ctx context.Context, msg *wire.OpMsg, document types.Document) (*wire.OpMsg, types.Document, error) {
+	if h.mappings == nil {
+		return msg, document, nil
+	}
+
+	rewritten, err := h.mappings.active().rewrite(document, func() ([]string, error) {
+		return h.mappingRoles(ctx)
+	})
+	if err != nil {
+		return nil, types.Document{}, err
+	}
+
+	if rewritten.Map() == nil {
+		return msg, document, nil
+	}
+
+	msg = new(wire.OpMsg)
+	if err = msg.SetSections(wire.OpMsgSection{Documents: []types.Document{rewritten}}); err != nil {
+		return nil, types.Document{}, lazyerrors.Error(err)
+	}
+
+	return msg, rewritten, nil
+}
+
+// mappingRoles returns the SAP HANA roles of the user of the connection, which select its row-level security filters.
+func (h *Handler) mappingRoles(ctx context.Context) ([]string, error) {
+	if h.hanaUser != "" {
+		return h.hanaRoles, nil
+	}
+
+	if h.roles == nil {
+		roles, err := h.hanaPool.Roles(ctx)
+		if err != nil {
+			return nil, err
+		}
+		h.roles = append([]string{}, roles...)
+	}
+
+	return h.roles, nil
+}
@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestMappingsReload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "mappings.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"virtualCollections": {"shop.openOrders": {"collection": "orders", "filter": {"status": "open"}}}
+	}`), 0o600))
+
+	m, err := LoadMappings(path)
+	require.NoError(t, err)
+
+	loaded := m.Status()
+	assert.Equal(t, path, loaded.Path)
+	assert.Len(t, loaded.Version, 12)
+	assert.Equal(t, 1, loaded.VirtualCollections)
+	assert.Equal(t, 0, loaded.RowLevelSecurity)
+
+	// an unchanged file is not reloaded
+	reloaded, err := m.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// an invalid file is rejected and the active mappings stay in place
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"rowLevelSecurity": {"shop.orders": {"ANALYST": {"region": {"$foo": 1}}}}
+	}`), 0o600))
+	reloaded, err = m.reload()
+	assert.ErrorContains(t, err, path+": row-level security filter of shop.orders for role ANALYST")
+	assert.False(t, reloaded)
+
+	status := m.Status()
+	assert.Equal(t, loaded.Version, status.Version)
+	assert.Equal(t, err, status.LastError)
+	assert.Equal(t, 1, status.VirtualCollections)
+
+	// a valid change replaces the mappings
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"rowLevelSecurity": {"shop.orders": {"ANALYST": {"region": "EU"}}}
+	}`), 0o600))
+	reloaded, err = m.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	status = m.Status()
+	assert.NotEqual(t, loaded.Version, status.Version)
+	assert.NoError(t, status.LastError)
+	assert.Equal(t, 0, status.VirtualCollections)
+	assert.Equal(t, 1, status.RowLevelSecurity)
+}
+
+func TestMappingsRewrite(t *testing.T) {
+	t.Parallel()
+
+	set := &mappingSet{
+		virtual: map[string]virtualCollection{
+			"shop.openOrders": {collection: "orders", filter: types.MustMakeDocument("status", "open")},
+		},
+		rowFilters: map[string]map[string]types.Document{
+			"shop.orders": {
+				"ANALYST_EU": types.MustMakeDocument("region", "EU"),
+				"ANALYST_US": types.MustMakeDocument("region", "US"),
+			},
+		},
+	}
+
+	roles := func(roles ...string) func() ([]string, error) {
+		return func() ([]string, error) {
+			return roles, nil
+		}
+	}
+
+	t.Run("Find", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := set.rewrite(types.MustMakeDocument(
+			"find", "openOrders", "filter", types.MustMakeDocument("total", int32(1)), "$db", "shop",
+		), roles("ANALYST_EU"))
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"find", "orders",
+			"filter", types.MustMakeDocument("$and", types.MustNewArray(
+				types.MustMakeDocument("total", int32(1)),
+				types.MustMakeDocument("status", "open"),
+				types.MustMakeDocument("region", "EU"),
+			)),
+			"$db", "shop",
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("SeveralRoles", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := set.rewrite(types.MustMakeDocument(
+			"count", "orders", "$db", "shop",
+		), roles("ANALYST_US", "PUBLIC", "ANALYST_EU"))
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"count", "orders",
+			"$db", "shop",
+			"query", types.MustMakeDocument("$or", types.MustNewArray(
+				types.MustMakeDocument("region", "EU"),
+				types.MustMakeDocument("region", "US"),
+			)),
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := set.rewrite(types.MustMakeDocument(
+			"update", "openOrders",
+			"updates", types.MustNewArray(types.MustMakeDocument(
+				"q", types.MustMakeDocument(),
+				"u", types.MustMakeDocument("$set", types.MustMakeDocument("status", "closed")),
+			)),
+			"$db", "shop",
+		), roles("ANALYST_EU"))
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"update", "orders",
+			"updates", types.MustNewArray(types.MustMakeDocument(
+				"q", types.MustMakeDocument("$and", types.MustNewArray(
+					types.MustMakeDocument("status", "open"),
+					types.MustMakeDocument("region", "EU"),
+				)),
+				"u", types.MustMakeDocument("$set", types.MustMakeDocument("status", "closed")),
+			)),
+			"$db", "shop",
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Aggregate", func(t *testing.T) {
+		t.Parallel()
+
+		actual, err := set.rewrite(types.MustMakeDocument(
+			"explain", types.MustMakeDocument(
+				"aggregate", "openOrders",
+				"pipeline", types.MustNewArray(types.MustMakeDocument("$limit", int32(1))),
+			),
+			"$db", "shop",
+		), roles("ANALYST_EU"))
+		require.NoError(t, err)
+
+		expected := types.MustMakeDocument(
+			"explain", types.MustMakeDocument(
+				"aggregate", "orders",
+				"pipeline", types.MustNewArray(
+					types.MustMakeDocument("$match", types.MustMakeDocument("$and", types.MustNewArray(
+						types.MustMakeDocument("status", "open"),
+						types.MustMakeDocument("region", "EU"),
+					))),
+					types.MustMakeDocument("$limit", int32(1)),
+				),
+			),
+			"$db", "shop",
+		)
+		assert.Equal(t, expected, actual)
+
+		_, err = set.rewrite(types.MustMakeDocument(
+			"aggregate", "customers",
+			"pipeline", types.MustNewArray(types.MustMakeDocument("$lookup", types.MustMakeDocument("from", "orders"))),
+			"$db", "shop",
+		), roles("ANALYST_EU"))
+		assert.EqualError(t, err, "NotImplemented (238): namespace shop.orders has mappings and can only be aggregated by its own pipeline")
+	})
+
+	t.Run("Unmapped", func(t *testing.T) {
+		t.Parallel()
+
+		for _, document := range []types.Document{
+			types.MustMakeDocument("find", "customers", "$db", "shop"),
+			types.MustMakeDocument("find", "orders", "$db", "archive"),
+			types.MustMakeDocument("insert", "orders", "documents", types.MustNewArray(), "$db", "shop"),
+			types.MustMakeDocument("ping", int32(1), "$db", "admin"),
+		} {
+			actual, err := set.rewrite(document, roles())
+			require.NoError(t, err)
+			assert.Nil(t, actual.Map(), "%v", document)
+		}
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := set.rewrite(types.MustMakeDocument("find", "orders", "$db", "shop"), roles("PUBLIC"))
+		assert.EqualError(t, err, "Unauthorized (13): none of the roles of the user have a row-level security filter of shop.orders")
+
+		_, err = set.rewrite(types.MustMakeDocument("insert", "openOrders", "documents", types.MustNewArray(), "$db", "shop"), roles())
+		assert.EqualError(t, err, "IllegalOperation (20): command insert is not allowed on virtual collection shop.openOrders")
+	})
+}
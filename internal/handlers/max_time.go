@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// parseMaxTimeMS returns the maxTimeMS of the command, or 0 if it is not given or 0.
+func parseMaxTimeMS(document types.Document) (time.Duration, error) {
+	var ms int64
+	switch v := document.Map()["maxTimeMS"].(type) {
+	case nil:
+		return 0, nil
+	case int32:
+		ms = int64(v)
+	case int64:
+		ms = v
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, common.NewErrorMessage(common.ErrBadValue, "maxTimeMS has non-integral value")
+		}
+		if v < math.MinInt64 || v > math.MaxInt64 {
+			return 0, common.NewErrorMessage(common.ErrBadValue, "maxTimeMS value must be between 0 and %d, but received: %v", math.MaxInt32, v)
+		}
+		ms = int64(v)
+	default:
+		return 0, common.NewErrorMessage(common.ErrBadValue, "maxTimeMS must be a number")
+	}
+
+	if ms < 0 || ms > math.MaxInt32 {
+		return 0, common.NewErrorMessage(common.ErrBadValue, "maxTimeMS value must be between 0 and %d, but received: %d", math.MaxInt32, ms)
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// withMaxTime returns the context of the command with the deadline of its maxTimeMS,
+// which cancels its SAP HANA statements when exceeded, and a function returning its error.
+// After the deadline, the command fails with MaxTimeMSExpired, like in MongoDB.
+func withMaxTime(ctx context.Context, document types.Document) (context.Context, func(err error) error, error) {
+	maxTime, err := parseMaxTimeMS(document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if maxTime == 0 {
+		return ctx, func(err error) error { return err }, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, maxTime)
+	done := func(err error) error {
+		defer cancel()
+
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return common.NewErrorMessage(common.ErrMaxTimeMSExpired, "operation exceeded time limit")
+		}
+
+		return err
+	}
+
+	return ctx, done, nil
+}
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+)
+
+func TestParseMaxTimeMS(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		value    any
+		expected time.Duration
+		err      string
+	}{
+		"None":        {value: nil},
+		"Int32":       {value: int32(100), expected: 100 * time.Millisecond},
+		"Int64":       {value: int64(0)},
+		"Double":      {value: float64(1500), expected: 1500 * time.Millisecond},
+		"Fraction":    {value: 1.5, err: "BadValue (2): maxTimeMS has non-integral value"},
+		"Negative":    {value: int32(-1), err: "BadValue (2): maxTimeMS value must be between 0 and 2147483647, but received: -1"},
+		"OutOfRange":  {value: int64(1 << 40), err: "BadValue (2): maxTimeMS value must be between 0 and 2147483647, but received: 1099511627776"},
+		"WrongType":   {value: "100", err: "BadValue (2): maxTimeMS must be a number"},
+		"DoubleRange": {value: 1e300, err: "BadValue (2): maxTimeMS value must be between 0 and 2147483647, but received: 1e+300"},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			document := types.MustMakeDocument("find", "c")
+			if tc.value != nil {
+				require.NoError(t, document.Set("maxTimeMS", tc.value))
+			}
+
+			actual, err := parseMaxTimeMS(document)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestMaxTimeMS(t *testing.T) {
+	t.Parallel()
+
+	_, handler, mock := setup(t, nil)
+
+	// the SAP HANA statement is canceled after maxTimeMS
+	mock.ExpectQuery("SELECT object_count FROM m_feature_usage").
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(int64(1)))
+
+	actual := handle(testutil.Ctx(t), t, handler, types.MustMakeDocument("find", "c", "maxTimeMS", int32(10), "$db", "db"))
+	assert.Equal(t, "MaxTimeMSExpired", actual.Map()["codeName"])
+	assert.Equal(t, "operation exceeded time limit", actual.Map()["errmsg"])
+
+	actual = handle(testutil.Ctx(t), t, handler, types.MustMakeDocument("count", "c", "maxTimeMS", int32(-1), "$db", "db"))
+	assert.Equal(t, "BadValue", actual.Map()["codeName"])
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// Middleware intercepts the commands of OP_MSG requests, for example for auditing, caching or rewriting.
+//
+// Middlewares are called in the order of NewOpts.Middlewares: first PreCommand of every middleware,
+// then the command and last PostCommand of every middleware in reverse order.
+type Middleware interface {
+	// PreCommand is called with the request document before the command runs.
+	//
+	// A non-zero rewritten document replaces the request for later middlewares and the command.
+	// A non-nil reply or error answers the request: PreCommand of later middlewares and the command
+	// are skipped, but PostCommand of this and all earlier middlewares is still called.
+	PreCommand(ctx context.Context, document types.Document) (rewritten types.Document, reply *wire.OpMsg, err error)
+
+	// PostCommand is called with the request document and the reply or error of the command.
+	// It returns the reply or error passed on to the earlier middlewares and the client.
+	PostCommand(ctx context.Context, document types.Document, reply *wire.OpMsg, err error) (*wire.OpMsg, error)
+}
+
+// intercept runs the command with the middlewares of the handler.
+func (h *Handler) intercept(ctx context.Context, msg *wire.OpMsg, document types.Document,
+	command func(context.Context, *wire.OpMsg, types.Document) (*wire.OpMsg, error),
+) (*wire.OpMsg, error) {
+	var reply *wire.OpMsg
+	var err error
+
+	// the number of middlewares which PreCommand was called
+	var called int
+	for _, m := range h.middlewares {
+		var rewritten types.Document
+		rewritten, reply, err = m.PreCommand(ctx, document)
+		called++
+
+		if reply != nil || err != nil {
+			break
+		}
+
+		if rewritten.Map() != nil {
+			document = rewritten
+
+			msg = new(wire.OpMsg)
+			if err = msg.SetSections(wire.OpMsgSection{Documents: []types.Document{document}}); err != nil {
+				err = lazyerrors.Error(err)
+				break
+			}
+		}
+	}
+
+	if reply == nil && err == nil {
+		reply, err = command(ctx, msg, document)
+	}
+
+	for i := called - 1; i >= 0; i-- {
+		reply, err = h.middlewares[i].PostCommand(ctx, document, reply, err)
+	}
+
+	return reply, err
+}
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// testMiddleware records its calls and runs the given functions.
+type testMiddleware struct {
+	name  string
+	calls *[]string
+	pre   func(document types.Document) (types.Document, *wire.OpMsg, error)
+	post  func(reply *wire.OpMsg, err error) (*wire.OpMsg, error)
+}
+
+func (m *testMiddleware) PreCommand(ctx context.Context, document types.Document) (types.Document, *wire.OpMsg, error) {
+	*m.calls = append(*m.calls, "pre "+m.name+" "+document.Command())
+	if m.pre == nil {
+		return types.Document{}, nil, nil
+	}
+	return m.pre(document)
+}
+
+func (m *testMiddleware) PostCommand(ctx context.Context, document types.Document, reply *wire.OpMsg, err error) (*wire.OpMsg, error) {
+	*m.calls = append(*m.calls, "post "+m.name+" "+document.Command())
+	if m.post == nil {
+		return reply, err
+	}
+	return m.post(reply, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	okReply := func(t *testing.T, pairs ...any) *wire.OpMsg {
+		var reply wire.OpMsg
+		require.NoError(t, reply.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{types.MustMakeDocument(pairs...)},
+		}))
+		return &reply
+	}
+
+	t.Run("Order", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, nil)
+
+		var calls []string
+		handler.middlewares = []Middleware{
+			&testMiddleware{name: "a", calls: &calls},
+			&testMiddleware{name: "b", calls: &calls},
+		}
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+		assert.Equal(t, []string{"pre a ping", "pre b ping", "post b ping", "post a ping"}, calls)
+	})
+
+	t.Run("ShortCircuit", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, nil)
+
+		var calls []string
+		handler.middlewares = []Middleware{
+			&testMiddleware{name: "a", calls: &calls},
+			&testMiddleware{name: "cache", calls: &calls, pre: func(types.Document) (types.Document, *wire.OpMsg, error) {
+				return types.Document{}, okReply(t, "cached", true, "ok", float64(1)), nil
+			}},
+			&testMiddleware{name: "c", calls: &calls},
+		}
+
+		// the command does not exist, so it would fail if it ran
+		actual := handle(ctx, t, handler, types.MustMakeDocument("cachedCommand", int32(1), "$db", "admin"))
+		assert.Equal(t, types.MustMakeDocument("cached", true, "ok", float64(1)), actual)
+		assert.Equal(t, []string{"pre a cachedCommand", "pre cache cachedCommand", "post cache cachedCommand", "post a cachedCommand"}, calls)
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, nil)
+
+		var calls []string
+		handler.middlewares = []Middleware{
+			&testMiddleware{name: "rewrite", calls: &calls, pre: func(types.Document) (types.Document, *wire.OpMsg, error) {
+				return types.MustMakeDocument("ping", int32(1), "$db", "admin"), nil, nil
+			}},
+			&testMiddleware{name: "b", calls: &calls},
+		}
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument("legacyPing", int32(1), "$db", "admin"))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+		assert.Equal(t, []string{"pre rewrite legacyPing", "pre b ping", "post b ping", "post rewrite ping"}, calls)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, nil)
+
+		var calls []string
+		handler.middlewares = []Middleware{
+			&testMiddleware{name: "audit", calls: &calls, post: func(reply *wire.OpMsg, err error) (*wire.OpMsg, error) {
+				assert.Nil(t, reply)
+				assert.Equal(t, common.NewErrorMessage(common.ErrUnauthorized, "denied"), err)
+				return nil, common.NewErrorMessage(common.ErrUnauthorized, "denied by policy")
+			}},
+			&testMiddleware{name: "deny", calls: &calls, pre: func(types.Document) (types.Document, *wire.OpMsg, error) {
+				return types.Document{}, nil, common.NewErrorMessage(common.ErrUnauthorized, "denied")
+			}},
+		}
+
+		actual := handle(ctx, t, handler, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+		assert.Equal(t, "denied by policy", actual.Map()["errmsg"])
+		assert.Equal(t, []string{"pre audit ping", "pre deny ping", "post deny ping", "post audit ping"}, calls)
+	})
+	t.Run("ClientIdentity", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, handler, _ := setup(t, nil)
+		handler.clientIdentity = "CN=client"
+
+		m := new(identityMiddleware)
+		handler.middlewares = []Middleware{m}
+
+		handle(ctx, t, handler, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+		assert.Equal(t, "CN=client", m.identity)
+	})
+}
+
+// identityMiddleware records the client identity of the commands.
+type identityMiddleware struct {
+	identity string
+}
+
+func (m *identityMiddleware) PreCommand(ctx context.Context, document types.Document) (types.Document, *wire.OpMsg, error) {
+	m.identity = ClientIdentity(ctx)
+	return types.Document{}, nil, nil
+}
+
+func (m *identityMiddleware) PostCommand(ctx context.Context, document types.Document, reply *wire.OpMsg, err error) (*wire.OpMsg, error) {
+	return reply, err
+}
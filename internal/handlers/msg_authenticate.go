@@ -7,23 +7,100 @@ package handlers
 import (
 	"context"
 
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
-// MsgAuthenticate is so far only used for the authentication needed by MongoDB drivers when using tls.
-// Since username and password is so far not implemented, MsgAuthenticate sends ok: 1 no matter what.
+// MsgAuthenticate is used for the authentication needed by MongoDB drivers when using tls.
+//
+// Without required authentication, it sends ok: 1 no matter what, as username and password are so far not implemented.
+// With required authentication, the client is authenticated with the MONGODB-X509 mechanism
+// as the user of the subject of its TLS client certificate, which must be mapped to a SAP HANA user.
 func (h *Handler) MsgAuthenticate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
-	var reply wire.OpMsg
-	err := reply.SetSections(wire.OpMsgSection{
-		Documents: []types.Document{types.MustMakeDocument(
+	reply := types.MustMakeDocument(
+		"ok", float64(1),
+	)
+
+	if h.requireAuth {
+		document, err := msg.Document()
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		if h.userPools != nil {
+			return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "SAP HANA credential passthrough requires the %s mechanism", PlainMechanism)
+		}
+
+		if err = h.authenticateX509(ctx, document); err != nil {
+			return nil, err
+		}
+
+		reply = types.MustMakeDocument(
+			"dbname", externalDB,
+			"user", h.clientIdentity,
 			"ok", float64(1),
-		)},
+		)
+	}
+
+	var res wire.OpMsg
+	err := res.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{reply},
 	})
 	if err != nil {
 		return nil, lazyerrors.Error(err)
 	}
 
-	return &reply, nil
+	return &res, nil
+}
+
+// authenticateX509 authenticates the connection with the MONGODB-X509 mechanism of the authenticate command.
+// The user, if given, must be the subject of the TLS client certificate.
+//
+// The subject and issuer must be the X.509 identity of a SAP HANA user, like created WITH IDENTITY 'CN=app, O=example' ... FOR X509.
+// The privileges and roles of that user are then checked for every command of the connection,
+// like for its collection, for collections of other databases and for quotas.
+func (h *Handler) authenticateX509(ctx context.Context, document types.Document) error {
+	m := document.Map()
+
+	if mechanism, _ := m["mechanism"].(string); mechanism != X509Mechanism {
+		return common.NewErrorMessage(common.ErrAuthenticationFailed, "authentication mechanism %q is not supported, only %s", mechanism, X509Mechanism)
+	}
+
+	if db, _ := m["$db"].(string); db != externalDB {
+		return common.NewErrorMessage(common.ErrAuthenticationFailed, "%s authentication must use the %s database", X509Mechanism, externalDB)
+	}
+
+	if h.clientIdentity == "" {
+		return common.NewErrorMessage(common.ErrAuthenticationFailed, "%s authentication requires a TLS client certificate", X509Mechanism)
+	}
+
+	if user, ok := m["user"].(string); ok && user != h.clientIdentity {
+		return common.NewErrorMessage(common.ErrAuthenticationFailed, "user %q does not match the subject of the TLS client certificate", user)
+	}
+
+	user, err := h.hanaPool.X509User(ctx, h.clientIdentity, h.clientIssuer)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+	if user == "" {
+		return common.NewErrorMessage(common.ErrAuthenticationFailed, "no SAP HANA user is mapped to the subject of the TLS client certificate")
+	}
+
+	roles, err := h.hanaPool.Roles(hana.WithUser(ctx, user))
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	h.l.Info("Authenticated", zap.String("subject", h.clientIdentity), zap.String("user", user), zap.Strings("roles", roles))
+
+	h.authenticated = true
+	h.hanaUser = user
+	h.hanaRoles = roles
+
+	return nil
 }
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// maxSupportBundleBytes is the maximum size of the support bundle returned by collectSupportBundle,
+// which leaves room for the other fields of the reply in a document of maxBsonObjectSize.
+const maxSupportBundleBytes = bson.MaxDocumentLen - 1024
+
+// MsgCollectSupportBundle returns a zip archive with the support bundle of the running instance,
+// with its sanitized configuration, recent logs, metrics, profiles, SAP HANA diagnostics and compatibility report.
+// The command is only enabled with -enable-support-bundle-command, as the bundle is returned to any client allowed to run commands.
+func (h *Handler) MsgCollectSupportBundle(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if document.Map()["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "collectSupportBundle may only be run against the admin database.")
+	}
+
+	if h.supportBundle == nil {
+		return nil, common.NewErrorMessage(common.ErrNotImplemented, "collectSupportBundle is not enabled, use -enable-support-bundle-command")
+	}
+
+	b, err := h.supportBundle.Bytes(ctx, maxSupportBundleBytes)
+	if errors.Is(err, support.ErrTooLarge) {
+		return nil, common.NewErrorMessage(
+			common.ErrBSONObjectTooLarge,
+			"the support bundle is larger than %d bytes, write it to a file with -collect-support-bundle", maxSupportBundleBytes,
+		)
+	}
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"bundle", types.Binary{Subtype: types.BinaryGeneric, B: b},
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
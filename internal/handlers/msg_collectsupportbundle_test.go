@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/support"
+)
+
+func TestCollectSupportBundle(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, nil)
+
+	actual := handle(ctx, t, handler, types.MustMakeDocument("collectSupportBundle", int32(1), "$db", "admin"))
+	assert.Equal(t, "collectSupportBundle is not enabled, use -enable-support-bundle-command", actual.Map()["errmsg"])
+
+	handler.supportBundle = &support.Collector{
+		Report: func() (any, error) {
+			return handler.metrics.CompatibilityReport()
+		},
+	}
+
+	// the unsupported command is part of the compatibility report
+	handle(ctx, t, handler, types.MustMakeDocument("fsync", int32(1), "$db", "admin"))
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("collectSupportBundle", int32(1), "$db", "admin"))
+	require.Equal(t, float64(1), actual.Map()["ok"])
+	b := actual.Map()["bundle"].(types.Binary).B
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	require.NoError(t, err)
+
+	var report string
+	for _, f := range zr.File {
+		if f.Name != "compatibility.json" {
+			continue
+		}
+
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		report = string(content)
+	}
+
+	assert.Contains(t, report, `"command": "fsync",`)
+	assert.Contains(t, report, `"supported": false`)
+	assert.Contains(t, report, `"command": "collectSupportBundle",`)
+	assert.Contains(t, report, `"supported": true`)
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("collectSupportBundle", int32(1), "$db", "test"))
+	assert.Equal(t, "collectSupportBundle may only be run against the admin database.", actual.Map()["errmsg"])
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgCollMod changes the options of an existing collection.
+func (h *Handler) MsgCollMod(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	unimplementedFields := []string{
+		"index",
+		"validator",
+		"validationLevel",
+		"validationAction",
+		"viewOn",
+		"pipeline",
+		"expireAfterSeconds",
+		"changeStreamPreAndPostImages",
+		"writeConcern",
+		"comment",
+	}
+	if err := common.Unimplemented(&document, unimplementedFields...); err != nil {
+		return nil, err
+	}
+
+	m := document.Map()
+	collection, ok := m[document.Command()].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m[document.Command()])
+	}
+	db := m["$db"].(string)
+
+	var partitioning *hana.Partitioning
+	if partition, ok := m["partition"]; ok {
+		if partitioning, err = common.ParsePartitioning(partition); err != nil {
+			return nil, err
+		}
+	}
+
+	readOnly, setReadOnly := m["readOnly"]
+	if setReadOnly {
+		if _, ok := readOnly.(bool); !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "readOnly must be a boolean. Got instead: %T", readOnly)
+		}
+	}
+
+	var writeConcern *hana.WriteConcern
+	defaultWriteConcern, setWriteConcern := m["defaultWriteConcern"]
+	if setWriteConcern {
+		if writeConcern, err = common.ParseWriteConcern(defaultWriteConcern); err != nil {
+			return nil, err
+		}
+		if writeConcern.W == int64(0) {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "The default write concern cannot be unacknowledged")
+		}
+	}
+
+	exists, err := h.hanaPool.NamespaceExists(ctx, db, collection)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if !exists {
+		return nil, common.NewErrorMessage(common.ErrNamespaceNotFound, "ns does not exist")
+	}
+
+	if partitioning != nil {
+		if err = h.hanaPool.PartitionCollection(ctx, db, collection, partitioning); err != nil {
+			return nil, err
+		}
+	}
+
+	if setReadOnly || setWriteConcern {
+		opts, err := h.hanaPool.CollectionOptions(ctx, db, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		if setReadOnly {
+			opts.ReadOnly = readOnly.(bool)
+		}
+		if setWriteConcern {
+			// an empty document removes the default write concern
+			opts.WriteConcern = writeConcern
+			if *writeConcern == (hana.WriteConcern{}) {
+				opts.WriteConcern = nil
+			}
+		}
+
+		if err = h.hanaPool.SetCollectionOptions(ctx, db, collection, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
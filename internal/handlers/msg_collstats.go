@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -18,42 +20,88 @@
 
 package handlers
 
-// MsgCollStats returns a set of statistics for a collection.
-// To function hanapool.TableStats needs to be implemented for DocStore
-// func (h *Handler) MsgCollStats(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
-// 	document, err := msg.Document()
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
-
-// 	m := document.Map()
-// 	collection := m["collStats"].(string)
-// 	db, ok := m["$db"].(string)
-// 	if !ok {
-// 		return nil, lazyerrors.New("no db")
-// 	}
-
-// 	stats, err := h.hanaPool.TableStats(ctx, db, collection)
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
-
-// 	var reply wire.OpMsg
-// 	err = reply.SetSections(wire.OpMsgSection{
-// 		Documents: []types.Document{types.MustMakeDocument(
-// 			"ns", db+"."+collection,
-// 			"count", stats.Rows,
-// 			"size", stats.SizeTotal,
-// 			"storageSize", stats.SizeTable,
-// 			"totalIndexSize", stats.SizeIndexes,
-// 			"totalSize", stats.SizeTotal,
-// 			"scaleFactor", int32(1),
-// 			"ok", float64(1),
-// 		)},
-// 	})
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
-
-// 	return &reply, nil
-// }
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgCollStats returns a set of statistics for a collection including the statistics of its partitions.
+func (h *Handler) MsgCollStats(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+	collection, ok := m["collStats"].(string)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "collection name has invalid type %T", m["collStats"])
+	}
+	db, ok := m["$db"].(string)
+	if !ok {
+		return nil, lazyerrors.New("no db")
+	}
+
+	scale := int64(1)
+	switch s := m["scale"].(type) {
+	case int32:
+		scale = int64(s)
+	case int64:
+		scale = s
+	case float64:
+		scale = int64(s)
+	}
+	if scale < 1 {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "scale has to be >= 1")
+	}
+
+	stats, err := h.hanaPool.TableStats(ctx, db, collection)
+	if err != nil {
+		if err == hana.ErrNotExist {
+			return nil, common.NewErrorMessage(common.ErrNamespaceNotFound, "Collection [%s.%s] not found.", db, collection)
+		}
+		return nil, lazyerrors.Error(err)
+	}
+
+	partitionStats, err := h.hanaPool.PartitionStats(ctx, db, collection)
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	partitions := types.MakeArray(len(partitionStats))
+	for _, p := range partitionStats {
+		if err = partitions.Append(types.MustMakeDocument(
+			"id", p.ID,
+			"count", p.Rows,
+			"size", p.Size/scale,
+		)); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ns", db+"."+collection,
+			"count", stats.Rows,
+			"size", stats.SizeTotal/scale,
+			"storageSize", stats.SizeTable/scale,
+			"totalIndexSize", stats.SizeIndexes/scale,
+			"totalSize", stats.SizeTotal/scale,
+			"scaleFactor", int32(scale),
+			"nPartitions", int32(len(partitionStats)),
+			"partitions", partitions,
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -29,13 +29,26 @@ import (
 
 // MsgConnectionStatus is a common implementation of the connectionStatus command.
 // Is a workaround to make it possible to connect and use GUI's like Studio 3T.
+//
+// An authenticated connection returns the user of its client certificate and the roles of the mapped SAP HANA user.
 func (h *Handler) MsgConnectionStatus(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	users := types.MustNewArray("USERNAME")
+	roles := types.MustNewArray()
+	if h.authenticated && h.hanaUser != "" {
+		users = types.MustNewArray(types.MustMakeDocument("user", h.clientIdentity, "db", externalDB))
+		for _, role := range h.hanaRoles {
+			if err := roles.Append(types.MustMakeDocument("role", role, "db", externalDB)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	var reply wire.OpMsg
 	err := reply.SetSections(wire.OpMsgSection{
 		Documents: []types.Document{types.MustMakeDocument(
 			"authInfo", types.MustMakeDocument(
-				"authenticatedUsers", types.MustNewArray("USERNAME"),
-				"authenticatedUserRoles", types.MustNewArray(),
+				"authenticatedUsers", users,
+				"authenticatedUserRoles", roles,
 				"authenticatedUserPrivileges", types.MustNewArray(),
 			),
 			"ok", float64(1),
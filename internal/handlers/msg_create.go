@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -45,7 +47,6 @@ func (h *Handler) MsgCreate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 		"validationAction",
 		"viewOn",
 		"pipeline",
-		"collation",
 		"autoIndexId",
 		"storageEngine",
 		"indexOptionDefaults",
@@ -65,12 +66,46 @@ func (h *Handler) MsgCreate(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg,
 
 	collection := m[document.Command()].(string)
 
+	var partitioning *hana.Partitioning
+	if partition, ok := m["partition"]; ok {
+		if partitioning, err = common.ParsePartitioning(partition); err != nil {
+			return nil, err
+		}
+	}
+
+	// the default collation orders the strings of find without a collation of its own
+	collation, err := common.ParseCollation(m["collation"])
+	if err != nil {
+		return nil, err
+	}
+
 	db := m["$db"].(string)
 	if err := h.hanaPool.CreateSchema(ctx, db); err != nil && err != hana.ErrAlreadyExist {
 		return nil, lazyerrors.Error(err)
 	}
 
-	if err = h.hanaPool.CreateCollection(ctx, db, collection); err != nil {
+	create := func(ctx context.Context) error {
+		var err error
+		if partitioning != nil {
+			err = h.hanaPool.CreatePartitionedCollection(ctx, db, collection, partitioning)
+		} else {
+			err = h.hanaPool.CreateCollection(ctx, db, collection)
+		}
+		if err != nil || collation == nil {
+			return err
+		}
+
+		return h.hanaPool.SetCollectionOptions(ctx, db, collection, &hana.CollectionOptions{Collation: collation.Options()})
+	}
+
+	// the default collation is stored in the transaction creating the collection, so that it is never missing
+	if collation != nil {
+		err = h.hanaPool.InDDLTx(ctx, create)
+	} else {
+		err = create(ctx)
+	}
+
+	if err != nil {
 		if err == hana.ErrAlreadyExist {
 			return nil, common.NewErrorMessage(common.ErrNamespaceExists, "Collection already exists. NS: \"%s\".\"%s\"", db, collection)
 		}
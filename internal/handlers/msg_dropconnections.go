@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"net"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// MsgDropConnections closes the open client connections from the given hosts or client applications,
+// so that misbehaving clients can be evicted without a restart.
+// An entry of hostAndPort without port matches all connections from the host.
+// If both hostAndPort and appName are given, a connection must match both.
+//
+// Without authentication any client could evict the others, so then it must run from localhost.
+// Authenticated users need the system privilege SESSION ADMIN, which allows to cancel sessions in SAP HANA.
+// Behind a proxy without -proxy-protocol all connections have the address of the proxy,
+// so its host matches all of them.
+func (h *Handler) MsgDropConnections(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+
+	if m["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "dropConnections may only be run against the admin database.")
+	}
+
+	if err = h.checkAdminPrivilege(ctx, "dropConnections"); err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	if v, ok := m["hostAndPort"]; ok {
+		hostAndPort, ok := v.(*types.Array)
+		if !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "hostAndPort must be an array. Got instead: %T", v)
+		}
+		for i := 0; i < hostAndPort.Len(); i++ {
+			host, _ := hostAndPort.Get(i)
+			s, ok := host.(string)
+			if !ok {
+				return nil, common.NewErrorMessage(common.ErrBadValue, "hostAndPort must only contain strings")
+			}
+			hosts = append(hosts, s)
+		}
+	}
+
+	var appName string
+	if v, ok := m["appName"]; ok {
+		if appName, ok = v.(string); !ok || appName == "" {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "appName must be a non-empty string")
+		}
+	}
+
+	if len(hosts) == 0 && appName == "" {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "dropConnections needs hostAndPort or appName")
+	}
+
+	dropped := h.metrics.Network.DropConns(func(peerAddr, connAppName string) bool {
+		if appName != "" && connAppName != appName {
+			return false
+		}
+		if len(hosts) == 0 {
+			return true
+		}
+
+		peerHost, _, _ := net.SplitHostPort(peerAddr)
+		for _, host := range hosts {
+			if host == peerAddr || host == peerHost {
+				return true
+			}
+		}
+		return false
+	})
+
+	h.l.Sugar().Infof("Dropped %d connections as requested by %s.", dropped, h.peerAddr)
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -18,26 +20,105 @@
 
 package handlers
 
-// import (
-// 	"context"
-
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
-// )
-
-// // MsgGetParameter OpMsg used to get parameter.
-// func (h *Handler) MsgGetParameter(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
-// 	var reply wire.OpMsg
-// 	err := reply.SetSections(wire.OpMsgSection{
-// 		Documents: []types.Document{types.MustMakeDocument(
-// 			"version", versionValue,
-// 			"ok", float64(1),
-// 		)},
-// 	})
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
-
-// 	return &reply, nil
-// }
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// parameters are the names of the parameters returned by getParameter.
+var parameters = []string{"mappings", "quotas"}
+
+// MsgGetParameter OpMsg used to get parameter.
+// With {getParameter: "*"} all parameters are returned, otherwise the ones given with any value.
+func (h *Handler) MsgGetParameter(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+
+	if m["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "getParameter may only be run against the admin database.")
+	}
+
+	all := m["getParameter"] == "*"
+
+	var pairs []any
+	for _, name := range parameters {
+		if _, ok := m[name]; !ok && !all {
+			continue
+		}
+
+		switch name {
+		case "mappings":
+			pairs = append(pairs, name, h.mappingsParameter())
+		case "quotas":
+			pairs = append(pairs, name, h.quotasParameter())
+		}
+	}
+
+	if len(pairs) == 0 {
+		return nil, common.NewErrorMessage(common.ErrInvalidOptions, "no option found to get")
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			append(pairs, "ok", float64(1))...,
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// quotasParameter returns the status of the quotas, which are reloaded when their file changes.
+func (h *Handler) quotasParameter() types.Document {
+	if h.quotas == nil {
+		return types.MustMakeDocument("roles", int32(0))
+	}
+
+	status := h.quotas.Status()
+
+	pairs := []any{
+		"path", status.Path,
+		"version", status.Version,
+		"loadedAt", status.LoadedAt,
+		"roles", int32(status.Roles),
+	}
+	if status.LastError != nil {
+		pairs = append(pairs, "lastError", status.LastError.Error())
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
+
+// mappingsParameter returns the status of the virtual collections and row-level security filters,
+// which are reloaded when their file changes.
+func (h *Handler) mappingsParameter() types.Document {
+	if h.mappings == nil {
+		return types.MustMakeDocument("virtualCollections", int32(0), "rowLevelSecurity", int32(0))
+	}
+
+	status := h.mappings.Status()
+
+	pairs := []any{
+		"path", status.Path,
+		"version", status.Version,
+		"loadedAt", status.LoadedAt,
+		"virtualCollections", int32(status.VirtualCollections),
+		"rowLevelSecurity", int32(status.RowLevelSecurity),
+	}
+	if status.LastError != nil {
+		pairs = append(pairs, "lastError", status.LastError.Error())
+	}
+
+	return types.MustMakeDocument(pairs...)
+}
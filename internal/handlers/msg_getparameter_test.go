@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/crud"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestGetParameter(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, nil)
+	handler.quotas = crud.NewQuotas(map[string]crud.Quota{"ANALYST": {MaxDocumentsPerQuery: 1}})
+
+	expected := types.MustMakeDocument(
+		"mappings", types.MustMakeDocument("virtualCollections", int32(0), "rowLevelSecurity", int32(0)),
+		"quotas", types.MustMakeDocument(
+			"path", "",
+			"version", "",
+			"loadedAt", time.Time{},
+			"roles", int32(1),
+		),
+		"ok", float64(1),
+	)
+
+	actual := handle(ctx, t, handler, types.MustMakeDocument("getParameter", "*", "$db", "admin"))
+	assert.Equal(t, expected, actual)
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("getParameter", int32(1), "quotas", int32(1), "$db", "admin"))
+	expected.Remove("mappings")
+	assert.Equal(t, expected, actual)
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("getParameter", int32(1), "featureCompatibilityVersion", int32(1), "$db", "admin"))
+	assert.Equal(t, "no option found to get", actual.Map()["errmsg"])
+	assert.Equal(t, "InvalidOptions", actual.Map()["codeName"])
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("getParameter", "*", "$db", "test"))
+	assert.Equal(t, "getParameter may only be run against the admin database.", actual.Map()["errmsg"])
+}
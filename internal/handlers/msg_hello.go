@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -20,34 +22,100 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"math"
 	"time"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
 )
 
+// topologyProcessID identifies this process in the topologyVersion of hello.
+var topologyProcessID = newTopologyProcessID()
+
+// newTopologyProcessID returns a new ObjectID of the current time and random bytes.
+func newTopologyProcessID() types.ObjectID {
+	var id types.ObjectID
+	binary.BigEndian.PutUint32(id[:4], uint32(time.Now().Unix()))
+	if _, err := rand.Read(id[4:]); err != nil {
+		panic(err)
+	}
+
+	return id
+}
+
+// topologyVersion returns the topologyVersion of hello.
+// The topology of a single instance does not change while it runs, so the counter is always 0.
+func topologyVersion() types.Document {
+	return types.MustMakeDocument(
+		"processId", topologyProcessID,
+		"counter", int64(0),
+	)
+}
+
 // MsgHello returns a document that describes the role of the instance.
+//
+// With topologyVersion and maxAwaitTimeMS, like sent by drivers using the streaming server monitoring protocol,
+// hello is awaitable: if the topologyVersion is the current one, the reply is sent after maxAwaitTimeMS.
+// With the exhaustAllowed flag, the reply then has the moreToCome flag and the next reply follows without a request.
 func (h *Handler) MsgHello(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	h.setAppName(document)
+
+	maxAwaitTime, awaitable, err := parseAwaitableHello(document)
+	if err != nil {
+		return nil, err
+	}
+
+	if awaitable {
+		timer := time.NewTimer(maxAwaitTime)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+
 	var reply wire.OpMsg
-	err := reply.SetSections(wire.OpMsgSection{
-		// TODO merge with QueryCmd
-		Documents: []types.Document{types.MustMakeDocument(
-			"helloOk", true,
-			"ismaster", true,
-			// topologyVersion
-			"maxBsonObjectSize", int32(bson.MaxDocumentLen),
-			"maxMessageSizeBytes", int32(wire.MaxMsgLen),
-			"maxWriteBatchSize", int32(100000),
-			"localTime", time.Now(),
-			// logicalSessionTimeoutMinutes
-			// connectionId
-			"minWireVersion", int32(13),
-			"maxWireVersion", int32(13),
-			"readOnly", false,
-			"ok", float64(1),
-		)},
+	if awaitable && msg.FlagBits.FlagSet(wire.OpMsgExhaustAllowed) {
+		reply.FlagBits = wire.OpMsgFlags(wire.OpMsgMoreToCome)
+	}
+
+	// TODO merge with QueryCmd
+	res := types.MustMakeDocument(
+		"helloOk", true,
+		"ismaster", true,
+		"topologyVersion", topologyVersion(),
+		"maxBsonObjectSize", int32(bson.MaxDocumentLen),
+		"maxMessageSizeBytes", int32(wire.MaxMsgLen),
+		"maxWriteBatchSize", int32(100000),
+		"localTime", time.Now(),
+		// logicalSessionTimeoutMinutes
+		// connectionId
+		"minWireVersion", int32(13),
+		"maxWireVersion", int32(13),
+		"readOnly", h.readOnly,
+		"ok", float64(1),
+	)
+	if err = h.setSASLSupportedMechs(&res, document); err != nil {
+		return nil, err
+	}
+	if err = h.setCompression(&res, document); err != nil {
+		return nil, err
+	}
+	if err = setServiceID(&res, document); err != nil {
+		return nil, err
+	}
+
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{res},
 	})
 	if err != nil {
 		return nil, lazyerrors.Error(err)
@@ -55,3 +123,75 @@ func (h *Handler) MsgHello(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, e
 
 	return &reply, nil
 }
+
+// parseAwaitableHello returns the maxAwaitTimeMS of hello, and true if the hello waits for it,
+// as its topologyVersion is the current one.
+func parseAwaitableHello(document types.Document) (time.Duration, bool, error) {
+	m := document.Map()
+	version, hasVersion := m["topologyVersion"]
+	maxAwaitTimeMS, hasMaxAwaitTime := m["maxAwaitTimeMS"]
+
+	switch {
+	case !hasVersion && !hasMaxAwaitTime:
+		return 0, false, nil
+	case !hasMaxAwaitTime:
+		return 0, false, common.NewErrorMessage(common.ErrBadValue, "A request with a 'topologyVersion' must include 'maxAwaitTimeMS'")
+	case !hasVersion:
+		return 0, false, common.NewErrorMessage(common.ErrBadValue, "A request with 'maxAwaitTimeMS' must include a 'topologyVersion'")
+	}
+
+	var ms int64
+	switch v := maxAwaitTimeMS.(type) {
+	case int32:
+		ms = int64(v)
+	case int64:
+		ms = v
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, false, common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS has non-integral value")
+		}
+		ms = int64(v)
+	default:
+		return 0, false, common.NewErrorMessage(common.ErrTypeMismatch, "maxAwaitTimeMS must be a number")
+	}
+	if ms < 0 {
+		return 0, false, common.NewErrorMessage(common.ErrBadValue, "maxAwaitTimeMS must be a non-negative integer")
+	}
+
+	versionDoc, ok := version.(types.Document)
+	if !ok {
+		return 0, false, common.NewErrorMessage(common.ErrTypeMismatch, "topologyVersion must be an object")
+	}
+
+	// a topologyVersion of another process, like before a restart, is outdated
+	if versionDoc.Map()["processId"] != topologyProcessID {
+		return 0, false, nil
+	}
+
+	var counter int64
+	switch v := versionDoc.Map()["counter"].(type) {
+	case int32:
+		counter = int64(v)
+	case int64:
+		counter = v
+	default:
+		return 0, false, common.NewErrorMessage(common.ErrTypeMismatch, "topologyVersion.counter must be a long")
+	}
+	if counter > 0 {
+		return 0, false, common.NewErrorMessage(
+			common.ErrBadValue,
+			"Received a topology version with the same process ID and a higher counter than the current topology version",
+		)
+	}
+
+	return time.Duration(ms) * time.Millisecond, counter == 0, nil
+}
+
+// setAppName uses the client application name sent with hello for the network statistics of the connection.
+func (h *Handler) setAppName(document types.Document) {
+	if name, err := document.GetByPath("client", "application", "name"); err == nil {
+		if name, ok := name.(string); ok {
+			h.metrics.Network.SetAppName(h.peerAddr, name)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// PlainMechanism is the authentication mechanism of users whose password is checked outside of the layer,
+// like the SAP HANA users of SAP HANA credential passthrough.
+const PlainMechanism = "PLAIN"
+
+// MsgSASLStart authenticates the connection with the PLAIN mechanism on the $external database
+// with SAP HANA credential passthrough.
+//
+// The user and password of the client open the SAP HANA connections of the connection,
+// which are used by all its following commands instead of the ones of the shared pool.
+// PLAIN has a single step, so saslContinue is not needed.
+func (h *Handler) MsgSASLStart(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if h.userPools == nil {
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "SASL authentication requires SAP HANA credential passthrough")
+	}
+
+	m := document.Map()
+
+	if mechanism, _ := m["mechanism"].(string); mechanism != PlainMechanism {
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "authentication mechanism %q is not supported, only %s", mechanism, PlainMechanism)
+	}
+
+	if db, _ := m["$db"].(string); db != externalDB {
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "%s authentication must use the %s database", PlainMechanism, externalDB)
+	}
+
+	// the payload is the authorization identity, the user and the password, separated by NUL
+	var payload []byte
+	switch p := m["payload"].(type) {
+	case types.Binary:
+		payload = p.B
+	case string:
+		payload = []byte(p)
+	default:
+		return nil, common.NewErrorMessage(common.ErrTypeMismatch, "payload must be binary data. Got instead: %T", p)
+	}
+
+	parts := bytes.Split(payload, []byte{0})
+	if len(parts) != 3 || len(parts[1]) == 0 {
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "%s payload must contain a user and a password", PlainMechanism)
+	}
+	authzid, user, password := string(parts[0]), string(parts[1]), string(parts[2])
+	if authzid != "" && authzid != user {
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "authorization identity %q must be the user", authzid)
+	}
+
+	db, err := h.userPools(ctx, user, password)
+	if err != nil {
+		// the error of SAP HANA is not returned, so that clients can't find out which users exist
+		h.l.Warn("SAP HANA credential passthrough failed", zap.String("user", user), zap.Error(err))
+		return nil, common.NewErrorMessage(common.ErrAuthenticationFailed, "Authentication failed.")
+	}
+
+	// the pool is shared with the storage of the connection, so the cursors of the previous user are closed with its pool;
+	// its open transactions keep their pinned connections until they end or time out
+	h.closeConnections()
+	h.userDB = db
+	h.passthroughUser = user
+	h.hanaPool.DB = db
+	h.authenticated = true
+
+	// the roles of the row-level security filters are the ones of the user now
+	h.roles = nil
+
+	h.l.Info("Authenticated", zap.String("user", user), zap.String("mechanism", PlainMechanism))
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"conversationId", int32(1),
+			"done", true,
+			"payload", types.Binary{B: []byte{}},
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestSASLStartPassthrough(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, QueryMatcherEqualBytes)
+
+	userDB, userMock, err := sqlmock.New(sqlmock.QueryMatcherOption(QueryMatcherEqualBytes))
+	require.NoError(t, err)
+	otherDB, otherMock, err := sqlmock.New(sqlmock.QueryMatcherOption(QueryMatcherEqualBytes))
+	require.NoError(t, err)
+
+	handler.requireAuth = true
+	userDBs := []*sql.DB{userDB, otherDB}
+	handler.userPools = func(ctx context.Context, user, password string) (*sql.DB, error) {
+		if user != "APP" || password != "secret" {
+			return nil, errors.New("authentication failed")
+		}
+		db := userDBs[0]
+		userDBs = userDBs[1:]
+		return db, nil
+	}
+
+	saslStart := func(payload string) types.Document {
+		return types.MustMakeDocument(
+			"saslStart", int32(1),
+			"mechanism", "PLAIN",
+			"payload", types.Binary{B: []byte(payload)},
+			"autoAuthorize", int32(1),
+			"$db", "$external",
+		)
+	}
+
+	for name, tc := range map[string]struct {
+		request types.Document
+		errmsg  string
+	}{
+		"Mechanism": {
+			request: types.MustMakeDocument("saslStart", int32(1), "mechanism", "SCRAM-SHA-256", "$db", "admin"),
+			errmsg:  `authentication mechanism "SCRAM-SHA-256" is not supported, only PLAIN`,
+		},
+		"Payload": {
+			request: saslStart("APP"),
+			errmsg:  "PLAIN payload must contain a user and a password",
+		},
+		"Password": {
+			request: saslStart("\x00APP\x00wrong"),
+			errmsg:  "Authentication failed.",
+		},
+		"X509": {
+			request: types.MustMakeDocument("authenticate", int32(1), "mechanism", "MONGODB-X509", "$db", "$external"),
+			errmsg:  "SAP HANA credential passthrough requires the PLAIN mechanism",
+		},
+	} {
+		res := handle(ctx, t, handler, tc.request)
+		assert.Equal(t, tc.errmsg, res.Map()["errmsg"], name)
+		assert.Equal(t, int32(18), res.Map()["code"], name)
+	}
+	assert.False(t, handler.authenticated)
+
+	res := handle(ctx, t, handler, saslStart("\x00APP\x00secret"))
+	expected := types.MustMakeDocument(
+		"conversationId", int32(1),
+		"done", true,
+		"payload", types.Binary{B: []byte{}},
+		"ok", float64(1),
+	)
+	assert.Equal(t, expected, res)
+
+	// the following commands use the connections of the user
+	userMock.ExpectQuery("SELECT ROLE_NAME FROM \"PUBLIC\".\"EFFECTIVE_ROLES\" WHERE USER_NAME = CURRENT_USER").
+		WillReturnRows(userMock.NewRows([]string{"ROLE_NAME"}).AddRow("READER"))
+	roles, err := handler.hanaPool.Roles(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"READER"}, roles)
+
+	// authenticating again closes the connections of the previous authentication
+	userMock.ExpectClose()
+	res = handle(ctx, t, handler, saslStart("\x00APP\x00secret"))
+	assert.Equal(t, expected, res)
+	require.NoError(t, userMock.ExpectationsWereMet())
+
+	otherMock.ExpectClose()
+	handler.Close()
+	require.NoError(t, otherMock.ExpectationsWereMet())
+}
+
+func TestSASLStartWithoutPassthrough(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, nil)
+
+	res := handle(ctx, t, handler, types.MustMakeDocument("saslStart", int32(1), "mechanism", "PLAIN", "$db", "$external"))
+	assert.Equal(t, "SASL authentication requires SAP HANA credential passthrough", res.Map()["errmsg"])
+}
@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -18,26 +20,50 @@
 
 package handlers
 
-// import (
-// 	"context"
-
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
-// 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
-// )
-
-// // MsgServerStatus OpMsg used to get a server status.
-// func (h *Handler) MsgServerStatus(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
-// 	var reply wire.OpMsg
-// 	err := reply.SetSections(wire.OpMsgSection{
-// 		Documents: []types.Document{types.MustMakeDocument(
-// 			"version", versionValue,
-// 			"ok", float64(1),
-// 		)},
-// 	})
-// 	if err != nil {
-// 		return nil, lazyerrors.Error(err)
-// 	}
-
-// 	return &reply, nil
-// }
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/version"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// startTime is used to calculate the uptime.
+var startTime = time.Now()
+
+// MsgServerStatus OpMsg used to get a server status.
+//
+// Like dropConnections, the open connections with the addresses of the clients
+// are only listed on authenticated connections or for clients on localhost.
+func (h *Handler) MsgServerStatus(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	uptime := time.Since(startTime)
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"host", host,
+			"version", versionValue,
+			"compatibilityLayer", version.Get().Document(),
+			"process", os.Args[0],
+			"pid", int64(os.Getpid()),
+			"uptime", uptime.Seconds(),
+			"uptimeMillis", uptime.Milliseconds(),
+			"localTime", time.Now(),
+			"network", h.metrics.Network.Document(h.authenticated || isLocal(h.peerAddr)),
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// defaultShutdownTimeout is the time open connections have to finish their requests
+// if shutdown is used without force and timeoutSecs, like in MongoDB.
+const defaultShutdownTimeout = 15 * time.Second
+
+// maxShutdownTimeout is the largest timeoutSecs of shutdown.
+const maxShutdownTimeout = 24 * time.Hour
+
+// MsgShutdown stops accepting connections and closes the open ones.
+// Without force they have timeoutSecs to finish their requests.
+func (h *Handler) MsgShutdown(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	m := document.Map()
+
+	if m["$db"] != "admin" {
+		return nil, common.NewErrorMessage(common.ErrUnauthorized, "shutdown may only be run against the admin database.")
+	}
+
+	if err = h.checkAdminPrivilege(ctx, "shutdown"); err != nil {
+		return nil, err
+	}
+
+	var force bool
+	if v, ok := m["force"]; ok {
+		if force, ok = v.(bool); !ok {
+			return nil, common.NewErrorMessage(common.ErrBadValue, "force must be a boolean. Got instead: %T", v)
+		}
+	}
+
+	timeout := defaultShutdownTimeout
+	if v, ok := m["timeoutSecs"]; ok {
+		var secs float64
+		switch v := v.(type) {
+		case int32:
+			secs = float64(v)
+		case int64:
+			secs = float64(v)
+		case float64:
+			secs = v
+		default:
+			return nil, common.NewErrorMessage(common.ErrBadValue, "timeoutSecs must be a number. Got instead: %T", v)
+		}
+
+		// larger values would overflow the duration
+		if math.IsNaN(secs) || secs < 0 || secs > maxShutdownTimeout.Seconds() {
+			return nil, common.NewErrorMessage(
+				common.ErrBadValue, "timeoutSecs must be between 0 and %d. Got instead: %v", int64(maxShutdownTimeout.Seconds()), v,
+			)
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
+
+	if force {
+		timeout = 0
+	}
+
+	if h.shutdown == nil {
+		return nil, common.NewErrorMessage(common.ErrIllegalOperation, "shutdown is not available")
+	}
+
+	h.l.Sugar().Infof("Shutdown requested by %s, closing connections in %s.", h.peerAddr, timeout)
+	h.shutdown(timeout)
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// isLocal returns true if the peer address is a loopback address or the one of a Unix domain socket.
+func isLocal(peerAddr string) bool {
+	host, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		// the peers of Unix domain sockets have addresses like "/tmp/mongodb-27017.sock#1"
+		return strings.Contains(peerAddr, "#")
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestVersionInfo(t *testing.T) {
+	t.Parallel()
+
+	ctx, handler, _ := setup(t, nil)
+
+	actual := handle(ctx, t, handler, types.MustMakeDocument("versionInfo", int32(1), "$db", "admin"))
+	m := actual.Map()
+	assert.Equal(t, float64(1), m["ok"])
+	assert.Equal(t, runtime.Version(), m["goVersion"])
+	assert.Equal(t, runtime.GOOS, m["os"])
+	assert.Equal(t, runtime.GOARCH, m["arch"])
+	require.IsType(t, new(types.Array), m["buildTags"])
+	assert.Contains(t, m, "hdbDriverVersion")
+
+	// the same provenance is returned by serverStatus
+	status := handle(ctx, t, handler, types.MustMakeDocument("serverStatus", int32(1), "$db", "admin"))
+	layer := status.Map()["compatibilityLayer"].(types.Document)
+	assert.Equal(t, m["commit"], layer.Map()["commit"])
+	assert.Equal(t, m["arch"], layer.Map()["arch"])
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("versionInfo", int32(1), "$db", "test"))
+	assert.Equal(t, "versionInfo may only be run against the admin database.", actual.Map()["errmsg"])
+}
@@ -0,0 +1,60 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// namespaceCommands are the commands taking a collection name as their value,
+// with what they do with the collection.
+var namespaceCommands = map[string]common.NamespaceAccess{
+	"aggregate":     common.NamespaceRead,
+	"collMod":       common.NamespaceWrite,
+	"collStats":     common.NamespaceRead,
+	"count":         common.NamespaceRead,
+	"create":        common.NamespaceCreate,
+	"createIndexes": common.NamespaceWrite,
+	"delete":        common.NamespaceWrite,
+	"drop":          common.NamespaceWrite,
+	"find":          common.NamespaceRead,
+	"findAndModify": common.NamespaceWrite,
+	"insert":        common.NamespaceWrite,
+	"seed":          common.NamespaceWrite,
+	"update":        common.NamespaceWrite,
+}
+
+// validateNamespace returns InvalidNamespace if the database of the request document is invalid,
+// or the collection of one of the namespaceCommands.
+// The explained command of explain is validated like the command itself.
+func validateNamespace(document types.Document) error {
+	m := document.Map()
+
+	db, ok := m["$db"].(string)
+	if !ok {
+		return nil
+	}
+
+	command := document.Command()
+	if command == "explain" {
+		if explained, ok := m[command].(types.Document); ok {
+			command, m = explained.Command(), explained.Map()
+		}
+	}
+
+	access, ok := namespaceCommands[command]
+	if !ok {
+		return common.ValidateDatabaseName(db)
+	}
+
+	// aggregate: 1 runs a pipeline on the database
+	collection, ok := m[command].(string)
+	if !ok {
+		return common.ValidateDatabaseName(db)
+	}
+
+	return common.ValidateNamespace(db, collection, access)
+}
@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+const (
+	// unknownAppName is used for clients which did not send an application name with hello.
+	unknownAppName = "unknown"
+
+	// otherAppName is used for clients whose application name is too long or not valid UTF-8,
+	// or if there are already maxAppNames client applications.
+	otherAppName = "other"
+
+	// maxAppNameLen is the maximum length of an application name in MongoDB.
+	maxAppNameLen = 128
+
+	// maxAppNames bounds the client applications, which are a label of the Prometheus metrics.
+	maxAppNames = 100
+)
+
+// networkCounters are the bytes transferred for a connection or a client application.
+// Logical bytes are the sizes of the wire messages, physical bytes are the bytes
+// actually sent over the network which differ from the logical ones for compressed messages.
+type networkCounters struct {
+	bytesIn          int64
+	bytesOut         int64
+	physicalBytesIn  int64
+	physicalBytesOut int64
+	numRequests      int64
+}
+
+func (c *networkCounters) add(o *networkCounters) {
+	c.bytesIn += o.bytesIn
+	c.bytesOut += o.bytesOut
+	c.physicalBytesIn += o.physicalBytesIn
+	c.physicalBytesOut += o.physicalBytesOut
+	c.numRequests += o.numRequests
+}
+
+func (c *networkCounters) document() types.Document {
+	return types.MustMakeDocument(
+		"bytesIn", c.bytesIn,
+		"bytesOut", c.bytesOut,
+		"physicalBytesIn", c.physicalBytesIn,
+		"physicalBytesOut", c.physicalBytesOut,
+		"numRequests", c.numRequests,
+	)
+}
+
+// connNetworkStats are the network statistics of an open connection.
+type connNetworkStats struct {
+	appName string
+	drop    func()
+	networkCounters
+}
+
+// appNetworkStats are the network statistics of a client application with open connections.
+type appNetworkStats struct {
+	conns int
+	networkCounters
+}
+
+// NetworkStats accounts the network traffic per connection and per client application,
+// so that the usage of shared instances can be charged back.
+//
+// The statistics of a client application, and its Prometheus metrics, are kept
+// as long as the application has open connections.
+type NetworkStats struct {
+	rw    sync.RWMutex
+	total networkCounters
+	apps  map[string]*appNetworkStats
+	conns map[string]*connNetworkStats
+
+	bytes    *prometheus.CounterVec
+	requests *prometheus.CounterVec
+}
+
+// NewNetworkStats creates new network statistics.
+func NewNetworkStats() *NetworkStats {
+	return &NetworkStats{
+		apps:  make(map[string]*appNetworkStats),
+		conns: make(map[string]*connNetworkStats),
+		bytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "network",
+				Name:      "bytes_total",
+				Help:      "Total number of bytes transferred per client application.",
+			},
+			[]string{"app_name", "direction", "kind"},
+		),
+		requests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: "network",
+				Name:      "requests_total",
+				Help:      "Total number of requests received per client application.",
+			},
+			[]string{"app_name"},
+		),
+	}
+}
+
+// OpenConn starts the accounting of the connection with the given peer address.
+// drop is called to close the connection when it is dropped with DropConns.
+func (s *NetworkStats) OpenConn(peerAddr string, drop func()) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if conn, ok := s.conns[peerAddr]; ok {
+		s.closeApp(conn.appName)
+	}
+
+	s.conns[peerAddr] = &connNetworkStats{appName: unknownAppName, drop: drop}
+	s.openApp(unknownAppName)
+}
+
+// CloseConn stops the accounting of the connection with the given peer address.
+// The traffic of the connection stays part of the totals of its client application
+// until the last connection of the application is closed.
+func (s *NetworkStats) CloseConn(peerAddr string) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	if conn, ok := s.conns[peerAddr]; ok {
+		delete(s.conns, peerAddr)
+		s.closeApp(conn.appName)
+	}
+}
+
+// SetAppName sets the client application name of the connection sent with hello.
+func (s *NetworkStats) SetAppName(peerAddr, appName string) {
+	if appName == "" {
+		return
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	conn, ok := s.conns[peerAddr]
+	if !ok {
+		return
+	}
+
+	if len(appName) > maxAppNameLen || !utf8.ValidString(appName) {
+		appName = otherAppName
+	}
+	if _, ok := s.apps[appName]; !ok && len(s.apps) >= maxAppNames {
+		appName = otherAppName
+	}
+
+	if conn.appName == appName {
+		return
+	}
+
+	s.closeApp(conn.appName)
+	s.openApp(appName)
+	conn.appName = appName
+}
+
+// openApp accounts a new connection of the client application.
+// It must be called with the lock held.
+func (s *NetworkStats) openApp(appName string) {
+	app, ok := s.apps[appName]
+	if !ok {
+		app = new(appNetworkStats)
+		s.apps[appName] = app
+	}
+	app.conns++
+}
+
+// closeApp accounts a closed connection of the client application, and removes the statistics
+// and the Prometheus metrics of the application with its last connection.
+// It must be called with the lock held.
+func (s *NetworkStats) closeApp(appName string) {
+	app, ok := s.apps[appName]
+	if !ok {
+		return
+	}
+
+	if app.conns--; app.conns > 0 {
+		return
+	}
+
+	delete(s.apps, appName)
+	s.bytes.DeletePartialMatch(prometheus.Labels{"app_name": appName})
+	s.requests.DeletePartialMatch(prometheus.Labels{"app_name": appName})
+}
+
+// DropConns closes all open connections for which match returns true
+// and returns the number of closed connections.
+func (s *NetworkStats) DropConns(match func(peerAddr, appName string) bool) int {
+	s.rw.RLock()
+	var drops []func()
+	for peerAddr, conn := range s.conns {
+		if match(peerAddr, conn.appName) && conn.drop != nil {
+			drops = append(drops, conn.drop)
+		}
+	}
+	s.rw.RUnlock()
+
+	for _, drop := range drops {
+		drop()
+	}
+
+	return len(drops)
+}
+
+// RecordRequest accounts a request and its response of the connection with the given peer address.
+// The logical sizes are the message lengths and the physical sizes are the bytes read and written.
+func (s *NetworkStats) RecordRequest(peerAddr string, bytesIn, physicalBytesIn, bytesOut, physicalBytesOut int64) {
+	c := &networkCounters{
+		bytesIn:          bytesIn,
+		bytesOut:         bytesOut,
+		physicalBytesIn:  physicalBytesIn,
+		physicalBytesOut: physicalBytesOut,
+		numRequests:      1,
+	}
+
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.total.add(c)
+
+	conn, ok := s.conns[peerAddr]
+	if !ok {
+		return
+	}
+	conn.add(c)
+
+	appName := conn.appName
+	s.apps[appName].add(c)
+
+	s.bytes.WithLabelValues(appName, "in", "logical").Add(float64(bytesIn))
+	s.bytes.WithLabelValues(appName, "in", "physical").Add(float64(physicalBytesIn))
+	s.bytes.WithLabelValues(appName, "out", "logical").Add(float64(bytesOut))
+	s.bytes.WithLabelValues(appName, "out", "physical").Add(float64(physicalBytesOut))
+	s.requests.WithLabelValues(appName).Inc()
+}
+
+// Document returns the network section of serverStatus.
+// Besides the totals it contains the traffic per client application and,
+// if withConns is set, per open connection with the peer address of the client.
+func (s *NetworkStats) Document(withConns bool) types.Document {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	doc := s.total.document()
+
+	appNames := make([]string, 0, len(s.apps))
+	for appName := range s.apps {
+		appNames = append(appNames, appName)
+	}
+	sort.Strings(appNames)
+
+	apps := types.MakeArray(len(appNames))
+	for _, appName := range appNames {
+		appDoc := s.apps[appName].document()
+		appDoc.Set("appName", appName)
+		apps.Append(appDoc)
+	}
+	doc.Set("clients", apps)
+
+	if !withConns {
+		return doc
+	}
+
+	peerAddrs := make([]string, 0, len(s.conns))
+	for peerAddr := range s.conns {
+		peerAddrs = append(peerAddrs, peerAddr)
+	}
+	sort.Strings(peerAddrs)
+
+	conns := types.MakeArray(len(peerAddrs))
+	for _, peerAddr := range peerAddrs {
+		conn := s.conns[peerAddr]
+		connDoc := conn.document()
+		connDoc.Set("appName", conn.appName)
+		connDoc.Set("client", peerAddr)
+		conns.Append(connDoc)
+	}
+
+	doc.Set("connections", conns)
+
+	return doc
+}
+
+// Describe implements prometheus.Collector.
+func (s *NetworkStats) Describe(ch chan<- *prometheus.Desc) {
+	s.bytes.Describe(ch)
+	s.requests.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (s *NetworkStats) Collect(ch chan<- prometheus.Metric) {
+	s.bytes.Collect(ch)
+	s.requests.Collect(ch)
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*NetworkStats)(nil)
+)
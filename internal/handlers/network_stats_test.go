@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestNetworkStats(t *testing.T) {
+	t.Parallel()
+
+	s := NewNetworkStats()
+
+	s.OpenConn("127.0.0.1:1000", nil)
+	s.OpenConn("127.0.0.1:2000", nil)
+	s.SetAppName("127.0.0.1:1000", "billing")
+
+	s.RecordRequest("127.0.0.1:1000", 100, 100, 200, 200)
+	s.RecordRequest("127.0.0.1:1000", 10, 10, 20, 20)
+	s.RecordRequest("127.0.0.1:2000", 1, 1, 2, 2)
+
+	s.CloseConn("127.0.0.1:2000")
+
+	// the traffic of the closed connection stays part of the totals only
+	billing := types.MustMakeDocument(
+		"bytesIn", int64(110),
+		"bytesOut", int64(220),
+		"physicalBytesIn", int64(110),
+		"physicalBytesOut", int64(220),
+		"numRequests", int64(2),
+		"appName", "billing",
+	)
+	expected := types.MustMakeDocument(
+		"bytesIn", int64(111),
+		"bytesOut", int64(222),
+		"physicalBytesIn", int64(111),
+		"physicalBytesOut", int64(222),
+		"numRequests", int64(3),
+		"clients", types.MustNewArray(billing),
+		"connections", types.MustNewArray(
+			types.MustMakeDocument(
+				"bytesIn", int64(110),
+				"bytesOut", int64(220),
+				"physicalBytesIn", int64(110),
+				"physicalBytesOut", int64(220),
+				"numRequests", int64(2),
+				"appName", "billing",
+				"client", "127.0.0.1:1000",
+			),
+		),
+	)
+	assert.Equal(t, expected, s.Document(true))
+
+	expected.Remove("connections")
+	assert.Equal(t, expected, s.Document(false))
+
+	s.CloseConn("127.0.0.1:1000")
+	clients, err := s.Document(false).Get("clients")
+	require.NoError(t, err)
+	assert.Equal(t, types.MakeArray(0), clients)
+	assert.Equal(t, 0, testutil.CollectAndCount(s))
+}
+
+func TestNetworkStatsAppNames(t *testing.T) {
+	t.Parallel()
+
+	appNames := func(s *NetworkStats) []string {
+		var res []string
+		s.DropConns(func(peerAddr, appName string) bool {
+			res = append(res, appName)
+			return false
+		})
+		sort.Strings(res)
+		return res
+	}
+
+	s := NewNetworkStats()
+	s.OpenConn("127.0.0.1:1000", nil)
+	s.SetAppName("127.0.0.1:1000", strings.Repeat("a", maxAppNameLen+1))
+	s.OpenConn("127.0.0.1:1001", nil)
+	s.SetAppName("127.0.0.1:1001", "\xff")
+	assert.Equal(t, []string{"other", "other"}, appNames(s))
+
+	// the connection setting its name is still counted for unknown
+	s = NewNetworkStats()
+	for i := 0; i < maxAppNames; i++ {
+		peerAddr := fmt.Sprintf("127.0.0.1:%d", 1000+i)
+		s.OpenConn(peerAddr, nil)
+		s.SetAppName(peerAddr, fmt.Sprintf("app%d", i))
+	}
+	names := appNames(s)
+	assert.Len(t, names, maxAppNames)
+	assert.Equal(t, "app98", names[maxAppNames-2])
+	assert.Equal(t, "other", names[maxAppNames-1])
+}
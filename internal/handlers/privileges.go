@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// commandPrivileges are the SAP HANA privileges on the collection of a command,
+// which users authenticated with their client certificate need to run it.
+// Commands without privileges, like the ones of the handshake and of the catalog, are allowed.
+var commandPrivileges = map[string][]string{
+	"aggregate":            {hana.PrivilegeSelect},
+	"collMod":              {hana.PrivilegeAlter},
+	"collStats":            {hana.PrivilegeSelect},
+	"count":                {hana.PrivilegeSelect},
+	"create":               {hana.PrivilegeCreateAny},
+	"createIndexes":        {hana.PrivilegeIndex},
+	"dataSize":             {hana.PrivilegeSelect},
+	"delete":               {hana.PrivilegeDelete},
+	"distinct":             {hana.PrivilegeSelect},
+	"drop":                 {hana.PrivilegeDrop},
+	"dropDatabase":         {hana.PrivilegeDrop},
+	"dropIndexes":          {hana.PrivilegeIndex},
+	"find":                 {hana.PrivilegeSelect},
+	"insert":               {hana.PrivilegeInsert},
+	"listIndexes":          {hana.PrivilegeSelect},
+	"renameCollection":     {hana.PrivilegeAlter},
+	"seed":                 {hana.PrivilegeInsert},
+	"setIndexCommitQuorum": {hana.PrivilegeIndex},
+	"update":               {hana.PrivilegeUpdate},
+}
+
+// checkPrivileges returns Unauthorized if the SAP HANA user mapped to the client certificate
+// lacks a privilege on the collection of the command, either granted for the collection or for its schema.
+// Without such a user, the privileges of the user of the pool apply, which runs all statements.
+func (h *Handler) checkPrivileges(ctx context.Context, document types.Document) error {
+	if h.hanaUser == "" {
+		return nil
+	}
+
+	db, _ := document.Map()["$db"].(string)
+
+	// explain needs the privileges of the explained command
+	command := document.Command()
+	if explained, ok := document.Map()["explain"].(types.Document); ok && command == "explain" {
+		document = explained
+		command = document.Command()
+	}
+
+	privileges := commandPrivileges[command]
+	switch command {
+	case "findAndModify", "findandmodify":
+		privileges = []string{hana.PrivilegeSelect, hana.PrivilegeUpdate}
+		if remove, _ := document.Map()["remove"].(bool); remove {
+			privileges = []string{hana.PrivilegeSelect, hana.PrivilegeDelete}
+		}
+		if upsert, _ := document.Map()["upsert"].(bool); upsert {
+			privileges = append(privileges, hana.PrivilegeInsert)
+		}
+	case "update":
+		if updates, ok := document.Map()["updates"].(*types.Array); ok && hasUpsert(updates) {
+			privileges = []string{hana.PrivilegeUpdate, hana.PrivilegeInsert}
+		}
+	}
+
+	if len(privileges) == 0 {
+		return nil
+	}
+
+	// commands of the database, like dropDatabase or aggregate with 1, need the privileges on the schema
+	collection, _ := document.Map()[document.Command()].(string)
+
+	for _, privilege := range privileges {
+		ok, err := h.hanaPool.HasPrivilege(hana.WithUser(ctx, h.hanaUser), db, collection, privilege)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return common.NewErrorMessage(
+				common.ErrUnauthorized, "not authorized on %s to execute command %s, which needs the privilege %s",
+				db, command, privilege,
+			)
+		}
+	}
+
+	return nil
+}
+
+// adminPrivileges are the SAP HANA system privileges which authenticated users need to run administrative commands.
+var adminPrivileges = map[string]string{
+	"dropConnections": hana.PrivilegeSessionAdmin,
+	"shutdown":        hana.PrivilegeServiceAdmin,
+}
+
+// checkAdminPrivilege returns Unauthorized if the client may not run the administrative command.
+// Without authentication any client could run it, so then it must run from localhost or a Unix domain socket,
+// like in MongoDB without auth. Authenticated users need the system privilege of the command.
+func (h *Handler) checkAdminPrivilege(ctx context.Context, command string) error {
+	if !h.authenticated {
+		if isLocal(h.peerAddr) {
+			return nil
+		}
+		return common.NewErrorMessage(common.ErrUnauthorized, "%s must run from localhost when running db without auth", command)
+	}
+
+	privilege := adminPrivileges[command]
+	ok, err := h.hanaPool.HasSystemPrivilege(ctx, privilege)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return common.NewErrorMessage(
+			common.ErrUnauthorized, "not authorized on admin to execute command %s, which needs the privilege %s",
+			command, privilege,
+		)
+	}
+
+	return nil
+}
+
+// hasUpsert returns true if any of the update statements upserts.
+func hasUpsert(updates *types.Array) bool {
+	for i := 0; i < updates.Len(); i++ {
+		update, _ := updates.Get(i)
+		if doc, ok := update.(types.Document); ok && doc.Map()["upsert"] == true {
+			return true
+		}
+	}
+
+	return false
+}
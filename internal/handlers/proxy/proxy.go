@@ -30,6 +30,7 @@ import (
 
 // Handler "handles" messages by sending them to another wire protocol compatible service.
 type Handler struct {
+	addr string
 	conn net.Conn
 	bufr *bufio.Reader
 	bufw *bufio.Writer
@@ -37,27 +38,58 @@ type Handler struct {
 
 // New creates a new Handler for a service with given address.
 func New(addr string) (*Handler, error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
+	h := &Handler{addr: addr}
+	if err := h.dial(); err != nil {
 		return nil, err
 	}
 
-	return &Handler{
-		conn: conn,
-		bufr: bufio.NewReader(conn),
-		bufw: bufio.NewWriter(conn),
-	}, nil
+	return h, nil
+}
+
+// dial connects to the service.
+func (h *Handler) dial() error {
+	conn, err := net.Dial("tcp", h.addr)
+	if err != nil {
+		return err
+	}
+
+	h.conn = conn
+	h.bufr = bufio.NewReader(conn)
+	h.bufw = bufio.NewWriter(conn)
+
+	return nil
 }
 
 // Close stops the handler.
 func (h *Handler) Close() {
-	h.conn.Close()
+	if h.conn != nil {
+		h.conn.Close()
+	}
 }
 
 // Handle "handles" the message by sending it to another wire protocol compatible service.
 //
 // Returned error is something fatal.
+// Messages without reply, like with the moreToCome flag, return nil header and body.
+// After an error the connection is closed, and the next message is sent on a new one.
 func (h *Handler) Handle(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
+	if h.conn == nil {
+		if err := h.dial(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	resHeader, resBody, err := h.handle(ctx, header, body)
+	if err != nil {
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	return resHeader, resBody, err
+}
+
+// handle sends the message on the current connection.
+func (h *Handler) handle(ctx context.Context, header *wire.MsgHeader, body wire.MsgBody) (*wire.MsgHeader, wire.MsgBody, error) {
 	deadline, _ := ctx.Deadline()
 	h.conn.SetDeadline(deadline)
 
@@ -69,5 +101,9 @@ func (h *Handler) Handle(ctx context.Context, header *wire.MsgHeader, body wire.
 		return nil, nil, lazyerrors.Error(err)
 	}
 
+	if wire.NoReply(header, body) {
+		return nil, nil, nil
+	}
+
 	return wire.ReadMessage(h.bufr)
 }
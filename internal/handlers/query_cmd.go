@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -33,25 +35,35 @@ func (h *Handler) QueryCmd(ctx context.Context, query *wire.OpQuery) (*wire.OpRe
 	switch cmd := strings.ToLower(query.Query.Command()); cmd {
 	case "ismaster":
 		// TODO merge with MsgHello
+		h.setAppName(query.Query)
+		res := types.MustMakeDocument(
+			"helloOk", true,
+			"ismaster", true,
+			"topologyVersion", topologyVersion(),
+			"maxBsonObjectSize", int32(bson.MaxDocumentLen),
+			"maxMessageSizeBytes", int32(wire.MaxMsgLen),
+			"maxWriteBatchSize", int32(100000),
+			"localTime", time.Now(),
+			// logicalSessionTimeoutMinutes
+			// connectionId
+			"minWireVersion", int32(13),
+			"maxWireVersion", int32(13),
+			"readOnly", h.readOnly,
+			"ok", float64(1),
+		)
+		if err := h.setSASLSupportedMechs(&res, query.Query); err != nil {
+			return nil, err
+		}
+		if err := h.setCompression(&res, query.Query); err != nil {
+			return nil, err
+		}
+		if err := setServiceID(&res, query.Query); err != nil {
+			return nil, err
+		}
+
 		reply := &wire.OpReply{
 			NumberReturned: 1,
-			Documents: []types.Document{
-				types.MustMakeDocument(
-					"helloOk", true,
-					"ismaster", true,
-					// topologyVersion
-					"maxBsonObjectSize", int32(bson.MaxDocumentLen),
-					"maxMessageSizeBytes", int32(wire.MaxMsgLen),
-					"maxWriteBatchSize", int32(100000),
-					"localTime", time.Now(),
-					// logicalSessionTimeoutMinutes
-					// connectionId
-					"minWireVersion", int32(13),
-					"maxWireVersion", int32(13),
-					"readOnly", false,
-					"ok", float64(1),
-				),
-			},
+			Documents:      []types.Document{res},
 		}
 		return reply, nil
 	case "getlasterror":
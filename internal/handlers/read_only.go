@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// readOnlyCommands are the commands writing documents, collections, databases or indexes,
+// which are rejected in read-only mode.
+var readOnlyCommands = map[string]struct{}{
+	"collMod":              {},
+	"create":               {},
+	"createIndexes":        {},
+	"delete":               {},
+	"drop":                 {},
+	"dropDatabase":         {},
+	"dropIndexes":          {},
+	"findAndModify":        {},
+	"findandmodify":        {},
+	"insert":               {},
+	"renameCollection":     {},
+	"seed":                 {},
+	"setIndexCommitQuorum": {},
+	"update":               {},
+}
+
+// readOnlyStages are the aggregation stages writing to collections, which are rejected in read-only mode.
+var readOnlyStages = []string{"$out", "$merge"}
+
+// checkReadOnly returns NotWritablePrimary in read-only mode if the command of the request document writes,
+// like a secondary of a replica set, so that all reads are allowed, for example on an analytical replica.
+func (h *Handler) checkReadOnly(document types.Document) error {
+	if !h.readOnly {
+		return nil
+	}
+
+	command := document.Command()
+	if _, ok := readOnlyCommands[command]; ok {
+		return common.NewErrorMessage(common.ErrNotWritablePrimary, "command %s is not allowed in read-only mode", command)
+	}
+
+	if command != "aggregate" {
+		return nil
+	}
+
+	if stage := findStage(document.Map()["pipeline"], readOnlyStages); stage != "" {
+		return common.NewErrorMessage(common.ErrNotWritablePrimary, "%s is not allowed in read-only mode", stage)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+)
+
+func TestReadOnly(t *testing.T) {
+	t.Parallel()
+
+	_, handler, _ := setup(t, nil)
+	handler.readOnly = true
+	ctx := testutil.Ctx(t)
+
+	actual := handle(ctx, t, handler, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+	assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+
+	actual = handle(ctx, t, handler, types.MustMakeDocument("hello", int32(1), "$db", "admin"))
+	assert.Equal(t, true, actual.Map()["readOnly"])
+
+	for req, errmsg := range map[*types.Document]string{
+		types.MustMakeDocumentPointer("insert", "c", "documents", types.MustNewArray(), "$db", "db"): "command insert is not allowed in read-only mode",
+		types.MustMakeDocumentPointer("findAndModify", "c", "remove", true, "$db", "db"):             "command findAndModify is not allowed in read-only mode",
+		types.MustMakeDocumentPointer("dropDatabase", int32(1), "$db", "db"):                         "command dropDatabase is not allowed in read-only mode",
+		types.MustMakeDocumentPointer("aggregate", "c", "pipeline", types.MustNewArray(
+			types.MustMakeDocument("$match", types.MustMakeDocument()),
+			types.MustMakeDocument("$merge", types.MustMakeDocument("into", "copy")),
+		), "$db", "db"): "$merge is not allowed in read-only mode",
+	} {
+		actual = handle(ctx, t, handler, *req)
+		assert.Equal(t, types.MustMakeDocument(
+			"ok", float64(0),
+			"errmsg", errmsg,
+			"code", int32(10107),
+			"codeName", "NotWritablePrimary",
+		), actual)
+	}
+}
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+)
+
+// errorField returns the field logging the error of a command. Its message may contain values of documents and filters,
+// like the key of a duplicate key error or a part of a SAP HANA statement, so it is only logged if logs are unredacted;
+// otherwise, only its code name and code are.
+func (h *Handler) errorField(err error) zap.Field {
+	if h.logUnredacted {
+		return zap.Error(err)
+	}
+
+	protoErr, _ := common.ProtocolError(err)
+	m := protoErr.Document().Map()
+
+	return zap.String("error", fmt.Sprintf("%v (%v)", m["codeName"], m["code"]))
+}
@@ -0,0 +1,26 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+)
+
+func TestErrorField(t *testing.T) {
+	t.Parallel()
+
+	err := common.NewErrorMessage(common.ErrBadValue, "invalid value alice@example.com")
+
+	h := &Handler{}
+	assert.Equal(t, zap.String("error", "BadValue (2)"), h.errorField(err))
+
+	h.logUnredacted = true
+	assert.Equal(t, zap.Error(err), h.errorField(err))
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// sandboxCommands are the commands allowed in sandbox mode.
+var sandboxCommands = map[string]struct{}{
+	"abortTransaction":  {},
+	"aggregate":         {},
+	"buildInfo":         {},
+	"collStats":         {},
+	"commitTransaction": {},
+	"connectionStatus":  {},
+	"count":             {},
+	"dbStats":           {},
+	"endSessions":       {},
+	"explain":           {},
+	"find":              {},
+	"getLastError":      {},
+	"getMore":           {},
+	"getlasterror":      {},
+	"hello":             {},
+	"hostInfo":          {},
+	"isMaster":          {},
+	"ismaster":          {},
+	"killCursors":       {},
+	"listCollections":   {},
+	"listCommands":      {},
+	"listcommands":      {},
+	"listDatabases":     {},
+	"ping":              {},
+	"rolesInfo":         {},
+	"serverStatus":      {},
+	"usersInfo":         {},
+	"versionInfo":       {},
+	"whatsmyuri":        {},
+}
+
+// sandboxStages are the aggregation stages blocked in sandbox mode, anywhere in the pipeline.
+var sandboxStages = []string{"$out", "$merge", "$sql"}
+
+// Sandbox restricts a connection to read-only, time-boxed queries for untrusted ad-hoc access,
+// for example of BI analysts with MongoDB Compass to production data.
+//
+// It is a Middleware: commands other than reads and pipelines with sandboxStages fail with Unauthorized,
+// and find and aggregate return at most MaxDocuments documents.
+// In addition, the handler cancels every command after MaxTime.
+type Sandbox struct {
+	MaxTime      time.Duration
+	MaxDocuments int32
+}
+
+// PreCommand implements Middleware.
+func (s *Sandbox) PreCommand(ctx context.Context, document types.Document) (types.Document, *wire.OpMsg, error) {
+	command := document.Command()
+	if _, ok := sandboxCommands[command]; !ok {
+		return types.Document{}, nil, common.NewErrorMessage(common.ErrUnauthorized, "command %s is not allowed in sandbox mode, which only allows reads", command)
+	}
+
+	if err := sandboxCheckStages(document); err != nil {
+		return types.Document{}, nil, err
+	}
+
+	if command != "find" || s.MaxDocuments <= 0 {
+		return types.Document{}, nil, nil
+	}
+
+	// limit find in SAP HANA; a negative limit is left to find to reject
+	limit := s.MaxDocuments
+	switch l := document.Map()["limit"].(type) {
+	case int32:
+		if l < 0 || (l > 0 && l <= s.MaxDocuments) {
+			return types.Document{}, nil, nil
+		}
+	case int64:
+		if l > 0 && l <= int64(s.MaxDocuments) {
+			limit = int32(l)
+		}
+	case float64:
+		if l > 0 && l <= float64(s.MaxDocuments) && l == float64(int32(l)) {
+			limit = int32(l)
+		}
+	}
+
+	rewritten, err := sandboxWith(document, "limit", limit)
+	if err != nil {
+		return types.Document{}, nil, err
+	}
+
+	return rewritten, nil, nil
+}
+
+// PostCommand implements Middleware.
+func (s *Sandbox) PostCommand(ctx context.Context, document types.Document, reply *wire.OpMsg, err error) (*wire.OpMsg, error) {
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, common.NewErrorMessage(common.ErrMaxTimeMSExpired, "operation exceeded time limit of %s in sandbox mode", s.MaxTime)
+		}
+		return nil, err
+	}
+
+	if s.MaxDocuments <= 0 || reply == nil {
+		return reply, nil
+	}
+
+	// aggregate is processed by the proxy, so its results are truncated
+	return s.truncate(reply)
+}
+
+// truncate returns the reply with at most MaxDocuments documents in the first batch of the cursor.
+func (s *Sandbox) truncate(reply *wire.OpMsg) (*wire.OpMsg, error) {
+	doc, err := reply.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	cursor, ok := doc.Map()["cursor"].(types.Document)
+	if !ok {
+		return reply, nil
+	}
+
+	batch, ok := cursor.Map()["firstBatch"].(*types.Array)
+	if !ok || batch.Len() <= int(s.MaxDocuments) {
+		return reply, nil
+	}
+
+	if batch, err = batch.Subslice(0, int(s.MaxDocuments)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if cursor, err = sandboxWith(cursor, "firstBatch", batch); err != nil {
+		return nil, err
+	}
+
+	if doc, err = sandboxWith(doc, "cursor", cursor); err != nil {
+		return nil, err
+	}
+
+	var res wire.OpMsg
+	if err = res.SetSections(wire.OpMsgSection{Documents: []types.Document{doc}}); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &res, nil
+}
+
+// sandboxCheckStages returns Unauthorized if the value contains one of the sandboxStages,
+// for example in the pipeline of aggregate, of explain or of $lookup.
+func sandboxCheckStages(value any) error {
+	if stage := findStage(value, sandboxStages); stage != "" {
+		return common.NewErrorMessage(common.ErrUnauthorized, "%s is not allowed in sandbox mode", stage)
+	}
+
+	return nil
+}
+
+// findStage returns the first of the stages which is a key anywhere in the value, or an empty string.
+func findStage(value any, stages []string) string {
+	switch value := value.(type) {
+	case types.Document:
+		for _, k := range value.Keys() {
+			for _, stage := range stages {
+				if k == stage {
+					return stage
+				}
+			}
+
+			if stage := findStage(value.Map()[k], stages); stage != "" {
+				return stage
+			}
+		}
+	case *types.Array:
+		for i := 0; i < value.Len(); i++ {
+			v, _ := value.Get(i)
+			if stage := findStage(v, stages); stage != "" {
+				return stage
+			}
+		}
+	}
+
+	return ""
+}
+
+// sandboxWith returns a copy of the document with the field set to the value.
+func sandboxWith(doc types.Document, key string, value any) (types.Document, error) {
+	pairs := make([]any, 0, 2*len(doc.Keys())+2)
+	for _, k := range doc.Keys() {
+		pairs = append(pairs, k, doc.Map()[k])
+	}
+
+	res, err := types.MakeDocument(pairs...)
+	if err != nil {
+		return types.Document{}, lazyerrors.Error(err)
+	}
+
+	if err = res.Set(key, value); err != nil {
+		return types.Document{}, lazyerrors.Error(err)
+	}
+
+	return res, nil
+}
+
+// check interfaces
+var (
+	_ Middleware = (*Sandbox)(nil)
+)
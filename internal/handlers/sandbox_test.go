@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+func TestSandbox(t *testing.T) {
+	t.Parallel()
+
+	sandboxHandler := func(t *testing.T, s *Sandbox) (*Handler, sqlmock.Sqlmock) {
+		t.Helper()
+
+		_, handler, mock := setup(t, nil)
+		handler.sandbox = s
+		handler.middlewares = []Middleware{s}
+		return handler, mock
+	}
+
+	t.Run("Reads", func(t *testing.T) {
+		t.Parallel()
+
+		handler, _ := sandboxHandler(t, &Sandbox{MaxTime: time.Second, MaxDocuments: 2})
+
+		actual := handle(testutil.Ctx(t), t, handler, types.MustMakeDocument("ping", int32(1), "$db", "admin"))
+		assert.Equal(t, types.MustMakeDocument("ok", float64(1)), actual)
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		t.Parallel()
+
+		handler, _ := sandboxHandler(t, &Sandbox{MaxTime: time.Second, MaxDocuments: 2})
+		ctx := testutil.Ctx(t)
+
+		for req, errmsg := range map[*types.Document]string{
+			types.MustMakeDocumentPointer("insert", "c", "documents", types.MustNewArray(), "$db", "db"): "command insert is not allowed in sandbox mode, which only allows reads",
+			types.MustMakeDocumentPointer("dropDatabase", int32(1), "$db", "db"):                         "command dropDatabase is not allowed in sandbox mode, which only allows reads",
+			types.MustMakeDocumentPointer("aggregate", "c", "pipeline", types.MustNewArray(
+				types.MustMakeDocument("$out", "copy"),
+			), "$db", "db"): "$out is not allowed in sandbox mode",
+			types.MustMakeDocumentPointer("explain", types.MustMakeDocument("aggregate", "c", "pipeline", types.MustNewArray(
+				types.MustMakeDocument("$lookup", types.MustMakeDocument("pipeline", types.MustNewArray(
+					types.MustMakeDocument("$sql", "SELECT 1"),
+				))),
+			)), "$db", "db"): "$sql is not allowed in sandbox mode",
+		} {
+			actual := handle(ctx, t, handler, *req)
+			assert.Equal(t, "Unauthorized", actual.Map()["codeName"])
+			assert.Equal(t, errmsg, actual.Map()["errmsg"])
+		}
+	})
+
+	t.Run("Limit", func(t *testing.T) {
+		t.Parallel()
+
+		s := &Sandbox{MaxDocuments: 2}
+		ctx := testutil.Ctx(t)
+
+		for name, tc := range map[string]struct {
+			limit    any
+			expected any
+		}{
+			"Missing": {expected: int32(2)},
+			"Zero":    {limit: int32(0), expected: int32(2)},
+			"Smaller": {limit: int32(1)},
+			"Larger":  {limit: int32(5), expected: int32(2)},
+			"Double":  {limit: float64(1), expected: int32(1)},
+		} {
+			doc := types.MustMakeDocument("find", "c", "$db", "db")
+			if tc.limit != nil {
+				require.NoError(t, doc.Set("limit", tc.limit))
+			}
+
+			rewritten, reply, err := s.PreCommand(ctx, doc)
+			require.NoError(t, err, name)
+			assert.Nil(t, reply, name)
+
+			if tc.expected == nil {
+				assert.Nil(t, rewritten.Map(), name)
+				continue
+			}
+			assert.Equal(t, tc.expected, rewritten.Map()["limit"], name)
+		}
+	})
+
+	t.Run("Truncate", func(t *testing.T) {
+		t.Parallel()
+
+		s := &Sandbox{MaxDocuments: 2}
+
+		var reply wire.OpMsg
+		require.NoError(t, reply.SetSections(wire.OpMsgSection{
+			Documents: []types.Document{types.MustMakeDocument(
+				"cursor", types.MustMakeDocument(
+					"firstBatch", types.MustNewArray(int32(1), int32(2), int32(3)),
+					"id", int64(0),
+					"ns", "db.c",
+				),
+				"ok", float64(1),
+			)},
+		}))
+
+		res, err := s.PostCommand(testutil.Ctx(t), types.MustMakeDocument("aggregate", "c"), &reply, nil)
+		require.NoError(t, err)
+
+		actual, err := res.Document()
+		require.NoError(t, err)
+		expected := types.MustMakeDocument(
+			"cursor", types.MustMakeDocument(
+				"firstBatch", types.MustNewArray(int32(1), int32(2)),
+				"id", int64(0),
+				"ns", "db.c",
+			),
+			"ok", float64(1),
+		)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("MaxTime", func(t *testing.T) {
+		t.Parallel()
+
+		handler, mock := sandboxHandler(t, &Sandbox{MaxTime: 10 * time.Millisecond, MaxDocuments: 2})
+
+		mock.ExpectQuery("SELECT object_count FROM m_feature_usage").
+			WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"object_count"}).AddRow(int64(1)))
+
+		actual := handle(testutil.Ctx(t), t, handler, types.MustMakeDocument("find", "c", "$db", "db"))
+		assert.Equal(t, "MaxTimeMSExpired", actual.Map()["codeName"])
+		assert.Equal(t, "operation exceeded time limit of 10ms in sandbox mode", actual.Map()["errmsg"])
+	})
+}
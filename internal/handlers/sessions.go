@@ -0,0 +1,449 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/hana"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/handlers/common"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/wire"
+)
+
+// Reasons for rolling back transactions which were neither committed nor aborted by the client.
+const (
+	cleanupEndSessions      = "endSessions"
+	cleanupNewerTransaction = "newerTransaction"
+	cleanupTimeout          = "timeout"
+)
+
+const (
+	// transactionLifetimeLimit is how long a transaction may stay open, like transactionLifetimeLimitSeconds of MongoDB.
+	// Older transactions are rolled back by Sessions.Reap, so that they release their SAP HANA connections.
+	transactionLifetimeLimit = time.Minute
+
+	// sessionTimeout is how long a session without open transaction is kept without commands,
+	// like the logicalSessionTimeoutMinutes reported by hello.
+	sessionTimeout = 30 * time.Minute
+
+	// sessionReapInterval is how often timed out transactions and sessions are removed by Sessions.Reap.
+	sessionReapInterval = 10 * time.Second
+)
+
+// txnKey identifies a transaction by the id of its session and its txnNumber.
+type txnKey struct {
+	lsid      string
+	txnNumber int64
+}
+
+// sessionID returns the session id of a command or an empty string if it has none.
+func sessionID(lsid any) (string, error) {
+	doc, ok := lsid.(types.Document)
+	if !ok {
+		return "", common.NewErrorMessage(common.ErrBadValue, "lsid must be an object. Got instead: %T", lsid)
+	}
+
+	id, ok := doc.Map()["id"].(types.Binary)
+	if !ok {
+		return "", common.NewErrorMessage(common.ErrBadValue, "lsid.id must be a UUID. Got instead: %T", doc.Map()["id"])
+	}
+
+	return hex.EncodeToString(id.B), nil
+}
+
+// commandTxnKey returns the transaction of a command of a multi-document transaction.
+func commandTxnKey(m map[string]any) (txnKey, error) {
+	id, err := sessionID(m["lsid"])
+	if err != nil {
+		return txnKey{}, err
+	}
+
+	txnNumber, ok := m["txnNumber"].(int64)
+	if !ok {
+		return txnKey{}, common.NewErrorMessage(common.ErrInvalidOptions, "txnNumber must be provided for multi-document transactions")
+	}
+
+	return txnKey{lsid: id, txnNumber: txnNumber}, nil
+}
+
+// session is a client session with its latest txnNumber and its open transaction.
+type session struct {
+	// owner is the SAP HANA user of the client which started the session, empty without one;
+	// only clients of the same user may use or end it
+	owner string
+
+	txnNumber int64
+
+	// tx is the open transaction of txnNumber, nil if it ended, and started is when it was begun
+	tx      *hana.PinnedTx
+	started time.Time
+
+	lastUsed time.Time
+}
+
+// check returns Unauthorized if the session was started by another user,
+// and TransactionTooOld if a newer transaction of the session was started.
+func (s *session) check(key txnKey, owner, action string) error {
+	if s.owner != owner {
+		return common.NewErrorMessage(common.ErrUnauthorized, "session %s was not started by the authenticated user", key.lsid)
+	}
+
+	if key.txnNumber < s.txnNumber {
+		return common.NewErrorMessage(
+			common.ErrTransactionTooOld,
+			"Cannot %s transaction %d on session %s because a newer transaction %d has already started",
+			action, key.txnNumber, key.lsid, s.txnNumber,
+		)
+	}
+
+	return nil
+}
+
+// Sessions are the client sessions with their open transactions, by session id.
+// They are shared by all connections like in MongoDB, as drivers may continue a session on another connection of their pool.
+// A session ends with endSessions or when it times out, not when the connection which started it closes.
+type Sessions struct {
+	l       *zap.Logger
+	metrics *Metrics
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewSessions returns an empty set of sessions.
+// The rollbacks of orphaned transactions are logged with l and counted by metrics.
+func NewSessions(l *zap.Logger, metrics *Metrics) *Sessions {
+	return &Sessions{
+		l:        l,
+		metrics:  metrics,
+		sessions: make(map[string]*session),
+	}
+}
+
+// Reap rolls back the transactions open for longer than transactionLifetimeLimit
+// and removes the sessions unused for longer than sessionTimeout every sessionReapInterval.
+// It returns when the context is canceled.
+func (ss *Sessions) Reap(ctx context.Context) {
+	ticker := time.NewTicker(sessionReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ss.reap(now)
+		}
+	}
+}
+
+// reap rolls back the transactions and removes the sessions which timed out at now.
+func (ss *Sessions) reap(now time.Time) {
+	var orphaned []*hana.PinnedTx
+
+	ss.mu.Lock()
+	for id, s := range ss.sessions {
+		if s.tx != nil && now.Sub(s.started) > transactionLifetimeLimit {
+			orphaned = append(orphaned, s.tx)
+			s.tx = nil
+		}
+
+		if s.tx == nil && now.Sub(s.lastUsed) > sessionTimeout {
+			delete(ss.sessions, id)
+		}
+	}
+	ss.mu.Unlock()
+
+	for _, tx := range orphaned {
+		ss.rollback(tx, cleanupTimeout)
+	}
+}
+
+// transaction returns the open transaction of the session and txnNumber of the command.
+// With start, it begins a new transaction with hanaPool instead and rolls back the open one of the session.
+func (ss *Sessions) transaction(ctx context.Context, hanaPool *hana.Hpool, key txnKey, start bool) (*hana.PinnedTx, error) {
+	owner := hana.User(ctx)
+
+	if !start {
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+
+		s := ss.sessions[key.lsid]
+		if s != nil {
+			if err := s.check(key, owner, "continue"); err != nil {
+				return nil, err
+			}
+		}
+
+		if s == nil || s.txnNumber != key.txnNumber || s.tx == nil {
+			return nil, common.NewErrorMessage(common.ErrNoSuchTransaction, "transaction %d is not in progress for this session", key.txnNumber)
+		}
+
+		s.lastUsed = time.Now()
+		return s.tx, nil
+	}
+
+	ss.mu.Lock()
+	if err := ss.checkStart(key, owner); err != nil {
+		ss.mu.Unlock()
+		return nil, err
+	}
+
+	s := ss.sessions[key.lsid]
+	if s == nil {
+		s = &session{owner: owner}
+		ss.sessions[key.lsid] = s
+	}
+
+	orphaned := s.tx
+	s.txnNumber, s.tx, s.lastUsed = key.txnNumber, nil, time.Now()
+	ss.mu.Unlock()
+
+	// the open transaction releases its connection first, so that a small pool has one for the new transaction
+	if orphaned != nil {
+		ss.rollback(orphaned, cleanupNewerTransaction)
+	}
+
+	// the transaction is begun without holding the lock, as it may wait for a connection of the pool
+	tx, err := hanaPool.BeginPinnedTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	// the session may have ended or started a newer transaction in the meantime
+	if ss.sessions[key.lsid] != s || s.txnNumber != key.txnNumber {
+		_ = tx.Rollback()
+		return nil, common.NewErrorMessage(common.ErrNoSuchTransaction, "transaction %d is not in progress for this session", key.txnNumber)
+	}
+
+	s.tx, s.started = tx, time.Now()
+
+	return tx, nil
+}
+
+// checkStart returns an error if the owner cannot start the transaction.
+// It must be called with mu held.
+func (ss *Sessions) checkStart(key txnKey, owner string) error {
+	s := ss.sessions[key.lsid]
+	if s == nil {
+		return nil
+	}
+
+	if err := s.check(key, owner, "start"); err != nil {
+		return err
+	}
+
+	if key.txnNumber == s.txnNumber {
+		return common.NewErrorMessage(common.ErrBadValue, "transaction %d has already been started on this session", key.txnNumber)
+	}
+
+	return nil
+}
+
+// end removes the open transaction of the session and txnNumber of the command, which the caller commits or rolls back.
+func (ss *Sessions) end(ctx context.Context, key txnKey) (*hana.PinnedTx, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	s := ss.sessions[key.lsid]
+	if s != nil {
+		if err := s.check(key, hana.User(ctx), "end"); err != nil {
+			return nil, err
+		}
+	}
+
+	if s == nil || s.txnNumber != key.txnNumber || s.tx == nil {
+		return nil, common.NewErrorMessage(common.ErrNoSuchTransaction, "transaction %d is not in progress for this session", key.txnNumber)
+	}
+
+	tx := s.tx
+	s.tx = nil
+	s.lastUsed = time.Now()
+
+	return tx, nil
+}
+
+// endSession removes the session and rolls back its open transaction.
+// Like in MongoDB, the sessions of other users are not ended.
+func (ss *Sessions) endSession(ctx context.Context, id string) {
+	ss.mu.Lock()
+	s := ss.sessions[id]
+	if s == nil || s.owner != hana.User(ctx) {
+		ss.mu.Unlock()
+		return
+	}
+	delete(ss.sessions, id)
+	ss.mu.Unlock()
+
+	if s.tx != nil {
+		ss.rollback(s.tx, cleanupEndSessions)
+	}
+}
+
+// rollback rolls back an orphaned transaction for the reason.
+func (ss *Sessions) rollback(tx *hana.PinnedTx, reason string) {
+	if err := tx.Rollback(); err != nil {
+		ss.l.Warn("Failed to roll back orphaned transaction", zap.String("reason", reason), zap.Error(err))
+	}
+
+	ss.metrics.orphanedTxs.WithLabelValues(reason).Inc()
+}
+
+// sessionContext returns the context of a command.
+// A command with startTransaction pins a transaction to its session and txnNumber, and
+// the following commands of the session with autocommit false and the same txnNumber run in it,
+// on any connection of the same user.
+// Starting a newer transaction rolls back the open one of the session, like in MongoDB.
+func (h *Handler) sessionContext(ctx context.Context, document types.Document) (context.Context, error) {
+	m := document.Map()
+
+	if _, ok := m["lsid"]; !ok {
+		return ctx, nil
+	}
+
+	autocommit, ok := m["autocommit"].(bool)
+	if !ok || autocommit {
+		return ctx, nil
+	}
+
+	key, err := commandTxnKey(m)
+	if err != nil {
+		return nil, err
+	}
+
+	start, _ := m["startTransaction"].(bool)
+
+	tx, err := h.sessions.transaction(ctx, h.hanaPool, key, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return hana.WithPinnedTx(ctx, tx), nil
+}
+
+// endTransaction commits or rolls back the transaction of the command's session and txnNumber
+// and returns its connection to the pool.
+func (h *Handler) endTransaction(ctx context.Context, msg *wire.OpMsg, commit bool) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	key, err := commandTxnKey(document.Map())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.sessions.end(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if commit {
+		err = tx.Commit()
+	} else {
+		err = tx.Rollback()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// MsgCommitTransaction commits the transaction of the session.
+func (h *Handler) MsgCommitTransaction(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	return h.endTransaction(ctx, msg, true)
+}
+
+// MsgAbortTransaction rolls back the transaction of the session.
+func (h *Handler) MsgAbortTransaction(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	return h.endTransaction(ctx, msg, false)
+}
+
+// MsgEndSessions ends the given sessions and rolls back their open transactions.
+func (h *Handler) MsgEndSessions(ctx context.Context, msg *wire.OpMsg) (*wire.OpMsg, error) {
+	document, err := msg.Document()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	sessions, ok := document.Map()[document.Command()].(*types.Array)
+	if !ok {
+		return nil, common.NewErrorMessage(common.ErrBadValue, "endSessions must be an array. Got instead: %T", document.Map()[document.Command()])
+	}
+
+	for i := 0; i < sessions.Len(); i++ {
+		lsid, err := sessions.Get(i)
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+		id, err := sessionID(lsid)
+		if err != nil {
+			return nil, err
+		}
+
+		h.sessions.endSession(ctx, id)
+	}
+
+	var reply wire.OpMsg
+	err = reply.SetSections(wire.OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"ok", float64(1),
+		)},
+	})
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return &reply, nil
+}
+
+// Close closes the cursors created by the client connection
+// and the SAP HANA connections opened with the credentials of the client.
+// It is called when the client disconnects.
+// The open transactions of its sessions are kept, as the client may continue them on another connection,
+// until they end or time out.
+func (h *Handler) Close() {
+	h.closeConnections()
+}
+
+// closeConnections closes the cursors created by the connection and then the SAP HANA connections opened
+// with the credentials of the client, which the cursors no longer hold.
+// The pinned connections of open transactions are closed when the transactions end.
+func (h *Handler) closeConnections() {
+	if h.crud != nil {
+		h.crud.Close()
+	}
+
+	// the cursors of legacy opcodes were closed with the others
+	h.legacyCursors = make(map[int64]legacyCursor)
+
+	if h.userDB != nil {
+		h.userDB.Close()
+		h.userDB = nil
+	}
+}
@@ -26,7 +26,8 @@ import "fmt"
 //
 // Zero value is a valid empty array.
 type Array struct {
-	s []any
+	s      []any
+	frozen bool
 }
 
 func (*Array) sealed() {}
@@ -76,6 +77,10 @@ func (a *Array) Get(index int) (any, error) {
 }
 
 func (a *Array) GetPointer(index int) (*any, error) {
+	if a.frozen {
+		return nil, fmt.Errorf("types.Array.GetPointer: array is frozen")
+	}
+
 	if l := a.Len(); index < 0 || index >= l {
 		return nil, fmt.Errorf("types.Array.Get: index %d is out of bounds [0-%d)", index, l)
 	}
@@ -109,6 +114,10 @@ func (a *Array) Subslice(low, high int) (*Array, error) {
 
 // Set sets the value at the given index.
 func (a *Array) Set(index int, value any) error {
+	if a.frozen {
+		return fmt.Errorf("types.Array.Set: array is frozen")
+	}
+
 	if l := a.Len(); index < 0 || index >= l {
 		return fmt.Errorf("types.Array.Set: index %d is out of bounds [0-%d)", index, l)
 	}
@@ -123,6 +132,10 @@ func (a *Array) Set(index int, value any) error {
 
 // Append appends given values to the array.
 func (a *Array) Append(values ...any) error {
+	if a.frozen {
+		return fmt.Errorf("types.Array.Append: array is frozen")
+	}
+
 	for _, value := range values {
 		if err := validateValue(value); err != nil {
 			return fmt.Errorf("types.Array.Append: %w", err)
@@ -151,6 +164,10 @@ func (a *Array) Contains(key string) bool {
 }
 
 func (a *Array) Delete(index int) (err error) {
+	if a.frozen {
+		return fmt.Errorf("types.Array.Delete: array is frozen")
+	}
+
 	l := a.Len()
 
 	if index >= l {
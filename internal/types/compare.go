@@ -249,3 +249,232 @@ func compareOrdered[T constraints.Ordered](a, b T) CompareResult {
 func compareNumbers(a float64, b int64) CompareResult {
 	return compareOrdered(a, float64(b))
 }
+
+// unknownCanonicalType is the canonical type of values of unknown types.
+const unknownCanonicalType = 100
+
+// CanonicalType returns the position of the type of the value in the BSON comparison order of MongoDB:
+// null, numbers, strings, documents, arrays, binary data, ObjectIDs, booleans, dates, timestamps,
+// regular expressions, JavaScript code and code with scope.
+//
+// Numbers of different types have the same canonical type. Query operators like $lt only compare values
+// of the same canonical type, which is called type bracketing.
+// Values of unknown types are ordered after all others.
+func CanonicalType(value any) int {
+	switch value.(type) {
+	case nil, NullType:
+		return 5
+	case float64, int32, int64:
+		return 10
+	case string, CString:
+		return 15
+	case Document:
+		return 20
+	case *Array:
+		return 25
+	case Binary:
+		return 30
+	case ObjectID:
+		return 35
+	case bool:
+		return 40
+	case time.Time:
+		return 45
+	case Timestamp:
+		return 47
+	case Regex:
+		return 50
+	case Code:
+		return 60
+	case CodeWithScope:
+		return 65
+	default:
+		return unknownCanonicalType
+	}
+}
+
+// Compare compares two values of any type in the BSON comparison order of MongoDB and returns -1, 0 or 1.
+// Unlike CompareScalars, it totally orders all values, like sort, $min and $max do:
+// values of different canonical types are ordered by CanonicalType,
+// numbers are compared by their value exactly, NaN being less than all other numbers,
+// and documents and arrays are compared element by element.
+// Values of unknown types are ordered by the names of their types, values of the same unknown type are equal.
+func Compare(a, b any) int {
+	if ta, tb := CanonicalType(a), CanonicalType(b); ta != tb {
+		return compareOrder(ta, tb)
+	}
+
+	switch a := a.(type) {
+	case nil, NullType:
+		return 0
+
+	case float64, int32, int64:
+		return compareNumberValues(a, b)
+
+	case string:
+		return compareOrder(a, stringValue(b))
+
+	case CString:
+		return compareOrder(string(a), stringValue(b))
+
+	case Document:
+		return compareDocuments(a, b.(Document))
+
+	case *Array:
+		b := b.(*Array)
+		for i := 0; i < len(a.s) && i < len(b.s); i++ {
+			if c := Compare(a.s[i], b.s[i]); c != 0 {
+				return c
+			}
+		}
+		return compareOrder(len(a.s), len(b.s))
+
+	case Binary:
+		// like in MongoDB, shorter data is less, then subtypes are compared
+		b := b.(Binary)
+		if c := compareOrder(len(a.B), len(b.B)); c != 0 {
+			return c
+		}
+		if c := compareOrder(a.Subtype, b.Subtype); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.B, b.B)
+
+	case ObjectID:
+		b := b.(ObjectID)
+		return bytes.Compare(a[:], b[:])
+
+	case bool:
+		switch b := b.(bool); {
+		case a == b:
+			return 0
+		case a:
+			return 1
+		default:
+			return -1
+		}
+
+	case time.Time:
+		return compareOrder(a.UnixMilli(), b.(time.Time).UnixMilli())
+
+	case Timestamp:
+		return compareOrder(a, b.(Timestamp))
+
+	case Regex:
+		b := b.(Regex)
+		if c := compareOrder(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return compareOrder(a.Options, b.Options)
+
+	case Code:
+		return compareOrder(a, b.(Code))
+
+	case CodeWithScope:
+		b := b.(CodeWithScope)
+		if c := compareOrder(a.Code, b.Code); c != 0 {
+			return c
+		}
+		return compareDocuments(a.Scope, b.Scope)
+
+	default:
+		return compareOrder(fmt.Sprintf("%T", a), fmt.Sprintf("%T", b))
+	}
+}
+
+// compareDocuments compares the fields of two documents in their order:
+// first their canonical types, then their keys, then their values.
+// A document with fewer fields is less if all its fields are equal.
+func compareDocuments(a, b Document) int {
+	for i := 0; i < len(a.keys) && i < len(b.keys); i++ {
+		av, bv := a.m[a.keys[i]], b.m[b.keys[i]]
+		if c := compareOrder(CanonicalType(av), CanonicalType(bv)); c != 0 {
+			return c
+		}
+		if c := compareOrder(a.keys[i], b.keys[i]); c != 0 {
+			return c
+		}
+		if c := Compare(av, bv); c != 0 {
+			return c
+		}
+	}
+
+	return compareOrder(len(a.keys), len(b.keys))
+}
+
+// stringValue returns the string of a string or a CString.
+func stringValue(value any) string {
+	if s, ok := value.(CString); ok {
+		return string(s)
+	}
+
+	return value.(string)
+}
+
+// compareNumberValues compares two numbers of any types exactly, so that large int64 values are not rounded.
+func compareNumberValues(a, b any) int {
+	af, aFloat := a.(float64)
+	bf, bFloat := b.(float64)
+
+	switch {
+	case aFloat && bFloat:
+		switch {
+		case math.IsNaN(af) && math.IsNaN(bf):
+			return 0
+		case math.IsNaN(af):
+			return -1
+		case math.IsNaN(bf):
+			return 1
+		default:
+			return compareOrder(af, bf)
+		}
+	case aFloat:
+		return compareFloatInt(af, intValue(b))
+	case bFloat:
+		return -compareFloatInt(bf, intValue(a))
+	default:
+		return compareOrder(intValue(a), intValue(b))
+	}
+}
+
+// compareFloatInt compares a float64 and an int64 exactly.
+func compareFloatInt(f float64, i int64) int {
+	// -2^63 is the smallest int64, and 2^63 is greater than the largest one
+	const twoTo63 = float64(1 << 63)
+
+	switch {
+	case math.IsNaN(f), f < -twoTo63:
+		return -1
+	case f >= twoTo63:
+		return 1
+	}
+
+	t := math.Trunc(f)
+	if c := compareOrder(int64(t), i); c != 0 {
+		return c
+	}
+
+	// integer parts are equal, so the fraction decides
+	return compareOrder(f, t)
+}
+
+// intValue returns the int32 or int64 as int64.
+func intValue(value any) int64 {
+	if i, ok := value.(int32); ok {
+		return int64(i)
+	}
+
+	return value.(int64)
+}
+
+// compareOrder compares two values of the same ordered type and returns -1, 0 or 1.
+func compareOrder[T constraints.Ordered](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
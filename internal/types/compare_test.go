@@ -5,6 +5,8 @@
 package types
 
 import (
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -176,3 +178,81 @@ func TestCompare(t *testing.T) {
 		assert.Equal(t, CompareResult(3), result)
 	})
 }
+
+func TestCompareTotalOrder(t *testing.T) {
+	t.Parallel()
+
+	// values in ascending order; values of the same group are equal
+	groups := [][]any{
+		{nil, Null},
+		{math.NaN()},
+		{math.Inf(-1)},
+		{int64(math.MinInt64)},
+		{int32(-1), int64(-1), float64(-1)},
+		{float64(-0.5)},
+		{int32(0), float64(0), math.Copysign(0, -1)},
+		{float64(1.5)},
+		{int32(2), int64(2), float64(2)},
+		{int64(1<<53 + 1)},
+		{float64(1<<53 + 2)},
+		{int64(math.MaxInt64)},
+		{float64(1 << 63)},
+		{math.Inf(1)},
+		{"", CString("")},
+		{"a", CString("a")},
+		{"b"},
+		{MustMakeDocument()},
+		{MustMakeDocument("a", nil)},
+		{MustMakeDocument("a", int32(1))},
+		{MustMakeDocument("a", int32(1), "b", int32(1))},
+		{MustMakeDocument("b", int32(1))},
+		{MustMakeDocument("a", "x")},
+		{MustNewArray()},
+		{MustNewArray(int32(1)), MustNewArray(float64(1))},
+		{MustNewArray(int32(1), nil)},
+		{MustNewArray(int32(2))},
+		{MustNewArray("a")},
+		{Binary{Subtype: BinaryUser, B: []byte{9}}},
+		{Binary{Subtype: BinaryGeneric, B: []byte{1, 2}}},
+		{Binary{Subtype: BinaryGeneric, B: []byte{1, 3}}},
+		{ObjectID{1}},
+		{ObjectID{2}},
+		{false},
+		{true},
+		{time.UnixMilli(-1)},
+		{time.UnixMilli(0), time.UnixMilli(0).UTC()},
+		{Timestamp(1)},
+		{Regex{Pattern: "a"}},
+		{Regex{Pattern: "a", Options: "i"}},
+		{Code("a")},
+		{CodeWithScope{Code: "a", Scope: MustMakeDocument()}},
+		{CodeWithScope{Code: "a", Scope: MustMakeDocument("x", int32(1))}},
+	}
+
+	for i, gi := range groups {
+		for j, gj := range groups {
+			expected := 0
+			switch {
+			case i < j:
+				expected = -1
+			case i > j:
+				expected = 1
+			}
+
+			for _, a := range gi {
+				for _, b := range gj {
+					assert.Equal(t, expected, Compare(a, b), fmt.Sprintf("Compare(%#v, %#v)", a, b))
+				}
+			}
+		}
+	}
+
+	assert.Equal(t, CanonicalType(int32(1)), CanonicalType(float64(1)))
+	assert.NotEqual(t, CanonicalType("1"), CanonicalType(int32(1)))
+
+	// values of unknown types are ordered after all others by the names of their types
+	assert.Equal(t, -1, Compare(CodeWithScope{Code: "a", Scope: MustMakeDocument()}, uint8(1)))
+	assert.Equal(t, 1, Compare(uint8(1), nil))
+	assert.Equal(t, 0, Compare(uint8(1), uint8(2)))
+	assert.Equal(t, -1, Compare(uint16(1), uint8(1)))
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+// DeepCopy returns a copy of the document which does not share any documents, arrays or binary data with it,
+// so that both can be changed independently. The copy is not frozen.
+func (d Document) DeepCopy() Document {
+	res := Document{
+		m:    make(map[string]any, len(d.m)),
+		keys: make([]string, len(d.keys)),
+	}
+
+	for k, v := range d.m {
+		res.m[k] = deepCopy(v)
+	}
+	copy(res.keys, d.keys)
+
+	return res
+}
+
+// DeepCopy returns a copy of the array which does not share any documents, arrays or binary data with it,
+// so that both can be changed independently. The copy is not frozen.
+func (a *Array) DeepCopy() *Array {
+	res := &Array{s: make([]any, len(a.s))}
+	for i, v := range a.s {
+		res.s[i] = deepCopy(v)
+	}
+
+	return res
+}
+
+// deepCopy returns a deep copy of the value. Values of other types are immutable and returned as they are.
+func deepCopy(v any) any {
+	switch v := v.(type) {
+	case Document:
+		return v.DeepCopy()
+	case *Array:
+		return v.DeepCopy()
+	case Binary:
+		return Binary{Subtype: v.Subtype, B: append([]byte(nil), v.B...)}
+	case CodeWithScope:
+		return CodeWithScope{Code: v.Code, Scope: v.Scope.DeepCopy()}
+	default:
+		return v
+	}
+}
+
+// Freeze makes the document and all documents and arrays in it immutable,
+// so that it can be shared with concurrent code like cursors without copying.
+// Set, SetByPath, Remove and RemoveByPath of a frozen document return an error.
+//
+// Copies of the document made before Freeze and the map returned by Map are not protected.
+// Use DeepCopy to get a mutable copy of a frozen document.
+func (d *Document) Freeze() {
+	if d.frozen {
+		return
+	}
+
+	for k, v := range d.m {
+		d.m[k] = freeze(v)
+	}
+	d.frozen = true
+}
+
+// IsFrozen returns true if the document is immutable.
+func (d Document) IsFrozen() bool {
+	return d.frozen
+}
+
+// Freeze makes the array and all documents and arrays in it immutable,
+// so that it can be shared with concurrent code like cursors without copying.
+// Set, Append, Delete and GetPointer of a frozen array return an error.
+func (a *Array) Freeze() {
+	if a.frozen {
+		return
+	}
+
+	for i, v := range a.s {
+		a.s[i] = freeze(v)
+	}
+	a.frozen = true
+}
+
+// IsFrozen returns true if the array is immutable.
+func (a *Array) IsFrozen() bool {
+	return a.frozen
+}
+
+// freeze returns the frozen value.
+func freeze(v any) any {
+	switch v := v.(type) {
+	case Document:
+		v.Freeze()
+		return v
+	case *Array:
+		v.Freeze()
+		return v
+	case CodeWithScope:
+		v.Scope.Freeze()
+		return v
+	default:
+		return v
+	}
+}
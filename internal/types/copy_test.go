@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeepCopy(t *testing.T) {
+	t.Parallel()
+
+	doc := MustMakeDocument(
+		"_id", int32(1),
+		"doc", MustMakeDocument("a", int32(1)),
+		"arr", MustNewArray(MustMakeDocument("b", int32(2)), int32(3)),
+		"bin", Binary{Subtype: BinaryGeneric, B: []byte{1, 2}},
+		"code", CodeWithScope{Code: "x", Scope: MustMakeDocument("x", int32(4))},
+	)
+	doc.Freeze()
+
+	res := doc.DeepCopy()
+	assert.False(t, res.IsFrozen())
+	assert.Equal(t, doc.Keys(), res.Keys())
+
+	require.NoError(t, res.SetByPath(int32(5), "doc", "a"))
+	require.NoError(t, res.Map()["arr"].(*Array).Set(1, int32(6)))
+	res.Map()["bin"].(Binary).B[0] = 7
+	require.NoError(t, res.SetByPath(int32(8), "arr", "0", "b"))
+	scope := res.Map()["code"].(CodeWithScope).Scope
+	require.NoError(t, scope.Set("x", int32(9)))
+	res.Remove("_id")
+
+	expected := MustMakeDocument(
+		"_id", int32(1),
+		"doc", MustMakeDocument("a", int32(1)),
+		"arr", MustNewArray(MustMakeDocument("b", int32(2)), int32(3)),
+		"bin", Binary{Subtype: BinaryGeneric, B: []byte{1, 2}},
+		"code", CodeWithScope{Code: "x", Scope: MustMakeDocument("x", int32(4))},
+	)
+	expected.Freeze()
+	assert.Equal(t, expected, doc)
+}
+
+func TestFreeze(t *testing.T) {
+	t.Parallel()
+
+	doc := MustMakeDocument(
+		"doc", MustMakeDocument("a", int32(1)),
+		"arr", MustNewArray(MustMakeDocument("b", int32(2))),
+	)
+	doc.Freeze()
+	assert.True(t, doc.IsFrozen())
+
+	assert.EqualError(t, doc.Set("c", int32(3)), "types.Document.Set: document is frozen")
+	assert.EqualError(t, doc.SetByPath(int32(3), "c"), "types.Document.SetByPath: document is frozen")
+	assert.EqualError(t, doc.Remove("doc"), "types.Document.Remove: document is frozen")
+	assert.EqualError(t, doc.RemoveByPath("doc", "a"), "types.Document.RemoveByPath: document is frozen")
+
+	embedded := doc.Map()["doc"].(Document)
+	assert.True(t, embedded.IsFrozen())
+	assert.EqualError(t, embedded.Set("a", int32(3)), "types.Document.Set: document is frozen")
+
+	arr := doc.Map()["arr"].(*Array)
+	assert.True(t, arr.IsFrozen())
+	assert.EqualError(t, arr.Set(0, int32(3)), "types.Array.Set: array is frozen")
+	assert.EqualError(t, arr.Append(int32(3)), "types.Array.Append: array is frozen")
+	assert.EqualError(t, arr.Delete(0), "types.Array.Delete: array is frozen")
+	_, err := arr.GetPointer(0)
+	assert.EqualError(t, err, "types.Array.GetPointer: array is frozen")
+
+	elem, err := arr.Get(0)
+	require.NoError(t, err)
+	assert.True(t, elem.(Document).IsFrozen())
+
+	// documents containing frozen documents are not frozen, and SetByPath copies the frozen ones
+	other := MustMakeDocument("doc", embedded)
+	assert.False(t, other.IsFrozen())
+	require.NoError(t, other.SetByPath(int32(4), "doc", "a"))
+	assert.Equal(t, int32(1), embedded.Map()["a"])
+}
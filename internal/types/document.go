@@ -47,8 +47,9 @@ type document interface {
 //
 // Duplicate field names are not supported.
 type Document struct {
-	m    map[string]any
-	keys []string
+	m      map[string]any
+	keys   []string
+	frozen bool
 }
 
 func (Document) sealed() {}
@@ -216,8 +217,70 @@ func (d Document) GetByPath(path ...string) (any, error) {
 	return getByPath(d, path...)
 }
 
+// SetByPath sets the value by path - a sequence of indexes and keys, replacing any existing value.
+// Missing embedded documents are created, and arrays are padded with nulls up to the index.
+// If an element of the path is neither a document nor an array, *NotViableError is returned.
+//
+// Embedded documents and arrays along the path are copied, so documents sharing them are not changed.
+func (d *Document) SetByPath(value any, path ...string) error {
+	if d.frozen {
+		return fmt.Errorf("types.Document.SetByPath: document is frozen")
+	}
+
+	if len(path) == 0 {
+		return fmt.Errorf("types.Document.SetByPath: empty path")
+	}
+
+	res, err := setByPath(*d, "", path, value)
+	if err != nil {
+		return err
+	}
+
+	*d = res.(Document)
+	return nil
+}
+
+// RemoveByPath removes the value by path - a sequence of indexes and keys, doing nothing if the path does not exist.
+// Array elements are deleted, so the following elements are shifted.
+//
+// Embedded documents and arrays along the path are copied, so documents sharing them are not changed.
+func (d *Document) RemoveByPath(path ...string) error {
+	if d.frozen {
+		return fmt.Errorf("types.Document.RemoveByPath: document is frozen")
+	}
+
+	if len(path) == 0 {
+		return nil
+	}
+
+	if res, ok := removeByPath(*d, path); ok {
+		*d = res.(Document)
+	}
+
+	return nil
+}
+
+// shallowCopy returns a copy of the document sharing its values.
+func (d Document) shallowCopy() Document {
+	res := Document{
+		m:    make(map[string]any, len(d.m)),
+		keys: make([]string, len(d.keys)),
+	}
+
+	for k, v := range d.m {
+		res.m[k] = v
+	}
+	copy(res.keys, d.keys)
+
+	return res
+}
+
 // Set the value of the given key, replacing any existing value.
 func (d *Document) Set(key string, value any) error {
+	if d.frozen {
+		return fmt.Errorf("types.Document.Set: document is frozen")
+	}
+
 	if !isValidKey(key) {
 		return fmt.Errorf("types.Document.Set: invalid key: %q", key)
 	}
@@ -236,9 +299,13 @@ func (d *Document) Set(key string, value any) error {
 }
 
 // Remove the given key, doing nothing if the key does not exist.
-func (d *Document) Remove(key string) {
+func (d *Document) Remove(key string) error {
+	if d.frozen {
+		return fmt.Errorf("types.Document.Remove: document is frozen")
+	}
+
 	if _, ok := d.m[key]; !ok {
-		return
+		return nil
 	}
 
 	delete(d.m, key)
@@ -246,7 +313,7 @@ func (d *Document) Remove(key string) {
 	for i, k := range d.keys {
 		if k == key {
 			d.keys = append(d.keys[:i], d.keys[i+1:]...)
-			return
+			return nil
 		}
 	}
 
@@ -105,7 +105,7 @@ func TestValidate(t *testing.T) {
 		m = nil
 		d2 := Document{m: m, keys: k}
 		convertedDoc, err = ConvertDocument(d2)
-		expectDoc := Document{map[string]any{}, []string{}}
+		expectDoc := Document{m: map[string]any{}, keys: []string{}}
 		assert.Nil(t, err)
 		assert.Equal(t, expectDoc, convertedDoc)
 	})
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package driverbson converts between types.Document and types.Array and
+// bson.D and bson.A of the official MongoDB Go driver.
+//
+// It allows the middlewares of applications embedding the compatibility layer, see package compatlayer,
+// to construct and inspect documents with the driver types they already know.
+//
+// The mapping of values is:
+//
+//	types.Document       bson.D
+//	*types.Array         bson.A
+//	float64              float64
+//	string               string
+//	types.Binary         primitive.Binary
+//	types.ObjectID       primitive.ObjectID
+//	bool                 bool
+//	time.Time            primitive.DateTime
+//	any(nil)             any(nil)
+//	types.Regex          primitive.Regex
+//	int32                int32
+//	types.Timestamp      primitive.Timestamp
+//	int64                int64
+//	types.Code           primitive.JavaScript
+//	types.CodeWithScope  primitive.CodeWithScope
+//
+// In addition, bson.M is not accepted as its keys have no order, but int,
+// time.Time and primitive.Null are converted from driver values like the driver encodes them.
+package driverbson
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// FromDocument converts a types.Document to bson.D.
+func FromDocument(doc types.Document) (bson.D, error) {
+	d := make(bson.D, 0, len(doc.Keys()))
+	for _, k := range doc.Keys() {
+		v, err := fromValue(doc.Map()[k])
+		if err != nil {
+			return nil, lazyerrors.Errorf("driverbson.FromDocument: %q: %w", k, err)
+		}
+		d = append(d, bson.E{Key: k, Value: v})
+	}
+
+	return d, nil
+}
+
+// FromArray converts a *types.Array to bson.A.
+func FromArray(arr *types.Array) (bson.A, error) {
+	a := make(bson.A, arr.Len())
+	for i := range a {
+		v, _ := arr.Get(i)
+
+		var err error
+		if a[i], err = fromValue(v); err != nil {
+			return nil, lazyerrors.Errorf("driverbson.FromArray: %d: %w", i, err)
+		}
+	}
+
+	return a, nil
+}
+
+// ToDocument converts a bson.D to types.Document.
+func ToDocument(d bson.D) (types.Document, error) {
+	pairs := make([]any, 0, 2*len(d))
+	for _, e := range d {
+		v, err := toValue(e.Value)
+		if err != nil {
+			return types.Document{}, lazyerrors.Errorf("driverbson.ToDocument: %q: %w", e.Key, err)
+		}
+		pairs = append(pairs, e.Key, v)
+	}
+
+	doc, err := types.MakeDocument(pairs...)
+	if err != nil {
+		return types.Document{}, lazyerrors.Error(err)
+	}
+
+	return doc, nil
+}
+
+// ToArray converts a bson.A to *types.Array.
+func ToArray(a bson.A) (*types.Array, error) {
+	arr := types.MakeArray(len(a))
+	for i, v := range a {
+		v, err := toValue(v)
+		if err != nil {
+			return nil, lazyerrors.Errorf("driverbson.ToArray: %d: %w", i, err)
+		}
+		if err = arr.Append(v); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	return arr, nil
+}
+
+// fromValue converts a value of the types package to the driver type.
+func fromValue(v any) (any, error) {
+	switch v := v.(type) {
+	case types.Document:
+		return FromDocument(v)
+	case *types.Array:
+		return FromArray(v)
+	case float64, string, bool, int32, int64, nil:
+		return v, nil
+	case types.Binary:
+		return primitive.Binary{Subtype: byte(v.Subtype), Data: v.B}, nil
+	case types.ObjectID:
+		return primitive.ObjectID(v), nil
+	case time.Time:
+		return primitive.NewDateTimeFromTime(v), nil
+	case types.Regex:
+		return primitive.Regex{Pattern: v.Pattern, Options: v.Options}, nil
+	case types.Timestamp:
+		return primitive.Timestamp{T: uint32(v >> 32), I: uint32(v)}, nil
+	case types.CString:
+		return string(v), nil
+	case types.Code:
+		return primitive.JavaScript(v), nil
+	case types.CodeWithScope:
+		scope, err := FromDocument(v.Scope)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.CodeWithScope{Code: primitive.JavaScript(v.Code), Scope: scope}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// toValue converts a value of the driver to the types package.
+func toValue(v any) (any, error) {
+	switch v := v.(type) {
+	case bson.D:
+		return ToDocument(v)
+	case bson.A:
+		return ToArray(v)
+	case []any:
+		return ToArray(bson.A(v))
+	case bson.M:
+		return nil, fmt.Errorf("bson.M has no key order, use bson.D instead")
+	case float64, string, bool, int32, int64, nil:
+		return v, nil
+	case int:
+		// like the driver, int is an int32 if it fits
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int32(v), nil
+		}
+		return int64(v), nil
+	case primitive.Null:
+		return nil, nil
+	case primitive.Binary:
+		return types.Binary{Subtype: types.BinarySubtype(v.Subtype), B: v.Data}, nil
+	case primitive.ObjectID:
+		return types.ObjectID(v), nil
+	case primitive.DateTime:
+		return v.Time(), nil
+	case time.Time:
+		return v, nil
+	case primitive.Regex:
+		return types.Regex{Pattern: v.Pattern, Options: v.Options}, nil
+	case primitive.Timestamp:
+		return types.Timestamp(uint64(v.T)<<32 | uint64(v.I)), nil
+	case primitive.JavaScript:
+		return types.Code(v), nil
+	case primitive.CodeWithScope:
+		scope, err := toValue(v.Scope)
+		if err != nil {
+			return nil, err
+		}
+		doc, ok := scope.(types.Document)
+		if !ok {
+			return nil, fmt.Errorf("unsupported scope type %T", v.Scope)
+		}
+		return types.CodeWithScope{Code: string(v.Code), Scope: doc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package driverbson
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	internalbson "github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	date := time.Date(2022, 8, 1, 12, 30, 15, 123_000_000, time.UTC).Local()
+
+	doc := types.MustMakeDocument(
+		"_id", types.ObjectID{0x62, 0xe2, 0xbd, 0x54, 0x51, 0x06, 0x83, 0xf9, 0xc0, 0xbb, 0x0d, 0x6b},
+		"double", 42.13,
+		"string", "foo",
+		"binary", types.Binary{Subtype: types.BinaryUser, B: []byte{0x42}},
+		"bool", true,
+		"date", date,
+		"null", nil,
+		"regex", types.Regex{Pattern: "^foo", Options: "i"},
+		"int32", int32(42),
+		"timestamp", types.Timestamp(7<<32|3),
+		"int64", int64(1)<<40,
+		"document", types.MustMakeDocument("b", int32(2), "a", int32(1)),
+		"array", types.MustNewArray("a", types.MustMakeDocument("c", types.MustNewArray())),
+		"code", types.Code("function() { return 1; }"),
+		"codeWithScope", types.CodeWithScope{Code: "function() { return x; }", Scope: types.MustMakeDocument("x", int32(1))},
+	)
+
+	expected := bson.D{
+		{Key: "_id", Value: primitive.ObjectID{0x62, 0xe2, 0xbd, 0x54, 0x51, 0x06, 0x83, 0xf9, 0xc0, 0xbb, 0x0d, 0x6b}},
+		{Key: "double", Value: 42.13},
+		{Key: "string", Value: "foo"},
+		{Key: "binary", Value: primitive.Binary{Subtype: 0x80, Data: []byte{0x42}}},
+		{Key: "bool", Value: true},
+		{Key: "date", Value: primitive.NewDateTimeFromTime(date)},
+		{Key: "null", Value: nil},
+		{Key: "regex", Value: primitive.Regex{Pattern: "^foo", Options: "i"}},
+		{Key: "int32", Value: int32(42)},
+		{Key: "timestamp", Value: primitive.Timestamp{T: 7, I: 3}},
+		{Key: "int64", Value: int64(1) << 40},
+		{Key: "document", Value: bson.D{{Key: "b", Value: int32(2)}, {Key: "a", Value: int32(1)}}},
+		{Key: "array", Value: bson.A{"a", bson.D{{Key: "c", Value: bson.A{}}}}},
+		{Key: "code", Value: primitive.JavaScript("function() { return 1; }")},
+		{Key: "codeWithScope", Value: primitive.CodeWithScope{
+			Code:  "function() { return x; }",
+			Scope: bson.D{{Key: "x", Value: int32(1)}},
+		}},
+	}
+
+	d, err := FromDocument(doc)
+	require.NoError(t, err)
+	assert.Equal(t, expected, d)
+
+	actual, err := ToDocument(d)
+	require.NoError(t, err)
+	assert.Equal(t, doc, actual)
+
+	// the driver encodes bson.D like the wire protocol decodes it, which does not support binary data and timestamps yet
+	var wireD bson.D
+	for _, e := range d {
+		if e.Key == "binary" || e.Key == "timestamp" {
+			doc.Remove(e.Key)
+			continue
+		}
+		wireD = append(wireD, e)
+	}
+
+	b, err := bson.Marshal(wireD)
+	require.NoError(t, err)
+
+	var wireDoc internalbson.Document
+	require.NoError(t, wireDoc.ReadFrom(bufio.NewReader(bytes.NewReader(b))))
+	assert.Equal(t, doc, types.MustConvertDocument(&wireDoc))
+}
+
+func TestToDocument(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		d        bson.D
+		expected types.Document
+		err      string
+	}{
+		"Int": {
+			d:        bson.D{{Key: "small", Value: 1}, {Key: "large", Value: 1 << 40}},
+			expected: types.MustMakeDocument("small", int32(1), "large", int64(1)<<40),
+		},
+		"Null": {
+			d:        bson.D{{Key: "v", Value: primitive.Null{}}},
+			expected: types.MustMakeDocument("v", nil),
+		},
+		"Slice": {
+			d:        bson.D{{Key: "v", Value: []any{"a"}}},
+			expected: types.MustMakeDocument("v", types.MustNewArray("a")),
+		},
+		"M": {
+			d:   bson.D{{Key: "v", Value: bson.M{"a": 1}}},
+			err: "bson.M has no key order, use bson.D instead",
+		},
+		"Unsupported": {
+			d:   bson.D{{Key: "v", Value: primitive.Decimal128{}}},
+			err: "unsupported type primitive.Decimal128",
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			actual, err := ToDocument(tc.d)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
@@ -52,3 +52,133 @@ func getByPath[T CompositeType](comp T, path ...string) (any, error) {
 
 	return next, nil
 }
+
+// NotViableError is returned by SetByPath if the value can't be set,
+// because an element of the path is neither a document nor an array,
+// or because an array is accessed by a key which is not an index.
+type NotViableError struct {
+	Field   string // the key which can't be created
+	Element string // the key of the element
+	Value   any    // the value of the element
+}
+
+// Error implements error interface.
+func (e *NotViableError) Error() string {
+	var value any = e.Value
+	if value == nil {
+		value = "null"
+	}
+
+	return fmt.Sprintf("Cannot create field '%s' in element {%s: %v}", e.Field, e.Element, value)
+}
+
+// setByPath returns a copy of the document or the array comp, whose key is element,
+// with the value set by path. The documents and arrays along the path are copied, the other values are shared.
+//
+// Missing documents are created, and arrays are padded with nulls up to the index.
+func setByPath(comp any, element string, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	p := path[0]
+	switch comp := comp.(type) {
+	case Document:
+		next, ok := comp.m[p]
+		if !ok {
+			next = MustMakeDocument()
+		}
+
+		child, err := setByPath(next, p, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		res := comp.shallowCopy()
+		if err = res.Set(p, child); err != nil {
+			return nil, fmt.Errorf("types.setByPath: %w", err)
+		}
+		return res, nil
+
+	case *Array:
+		index, err := strconv.Atoi(p)
+		if err != nil || index < 0 {
+			return nil, &NotViableError{Field: p, Element: element, Value: comp}
+		}
+
+		res := &Array{s: append(make([]any, 0, comp.Len()), comp.s...)}
+
+		var next any = MustMakeDocument()
+		if index < res.Len() {
+			next = res.s[index]
+		}
+		for res.Len() <= index {
+			res.s = append(res.s, nil)
+		}
+
+		child, err := setByPath(next, p, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = res.Set(index, child); err != nil {
+			return nil, fmt.Errorf("types.setByPath: %w", err)
+		}
+		return res, nil
+
+	default:
+		return nil, &NotViableError{Field: p, Element: element, Value: comp}
+	}
+}
+
+// removeByPath returns a copy of the document or the array comp without the value at path,
+// and true if the value was found. The documents and arrays along the path are copied, the other values are shared.
+func removeByPath(comp any, path []string) (any, bool) {
+	p := path[0]
+	switch comp := comp.(type) {
+	case Document:
+		next, ok := comp.m[p]
+		if !ok {
+			return comp, false
+		}
+
+		res := comp.shallowCopy()
+		if len(path) == 1 {
+			// the copy is not frozen
+			_ = res.Remove(p)
+			return res, true
+		}
+
+		child, ok := removeByPath(next, path[1:])
+		if !ok {
+			return comp, false
+		}
+
+		res.m[p] = child
+		return res, true
+
+	case *Array:
+		index, err := strconv.Atoi(p)
+		if err != nil || index < 0 || index >= comp.Len() {
+			return comp, false
+		}
+
+		res := &Array{s: make([]any, comp.Len())}
+		copy(res.s, comp.s)
+		if len(path) == 1 {
+			res.s = append(res.s[:index], res.s[index+1:]...)
+			return res, true
+		}
+
+		child, ok := removeByPath(res.s[index], path[1:])
+		if !ok {
+			return comp, false
+		}
+
+		res.s[index] = child
+		return res, true
+
+	default:
+		return comp, false
+	}
+}
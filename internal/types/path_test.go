@@ -100,3 +100,165 @@ func TestGetByPath(t *testing.T) {
 		})
 	}
 }
+
+func TestSetByPath(t *testing.T) {
+	t.Parallel()
+
+	type testCase struct {
+		name  string
+		doc   Document
+		path  []string
+		value any
+		res   Document
+		err   string
+	}
+
+	for _, tc := range []testCase{{ //nolint:paralleltest // false positive
+		name:  "Replace",
+		doc:   MustMakeDocument("a", MustMakeDocument("b", int32(1), "c", int32(2))),
+		path:  []string{"a", "b"},
+		value: "x",
+		res:   MustMakeDocument("a", MustMakeDocument("b", "x", "c", int32(2))),
+	}, {
+		name:  "MissingDocuments",
+		doc:   MustMakeDocument("_id", int32(1)),
+		path:  []string{"a", "b", "c"},
+		value: true,
+		res:   MustMakeDocument("_id", int32(1), "a", MustMakeDocument("b", MustMakeDocument("c", true))),
+	}, {
+		name:  "ArrayElement",
+		doc:   MustMakeDocument("a", MustNewArray(MustMakeDocument("b", int32(1)), int32(2))),
+		path:  []string{"a", "0", "b"},
+		value: int32(3),
+		res:   MustMakeDocument("a", MustNewArray(MustMakeDocument("b", int32(3)), int32(2))),
+	}, {
+		name:  "ArrayPadding",
+		doc:   MustMakeDocument("a", MustNewArray(int32(1))),
+		path:  []string{"a", "3", "b"},
+		value: int32(2),
+		res:   MustMakeDocument("a", MustNewArray(int32(1), nil, nil, MustMakeDocument("b", int32(2)))),
+	}, {
+		name:  "MissingIndexKey",
+		doc:   MustMakeDocument(),
+		path:  []string{"a", "0"},
+		value: int32(1),
+		res:   MustMakeDocument("a", MustMakeDocument("0", int32(1))),
+	}, {
+		name:  "Scalar",
+		doc:   MustMakeDocument("a", MustMakeDocument("b", int32(5))),
+		path:  []string{"a", "b", "c"},
+		value: int32(1),
+		err:   "Cannot create field 'c' in element {b: 5}",
+	}, {
+		name:  "Null",
+		doc:   MustMakeDocument("a", nil),
+		path:  []string{"a", "b"},
+		value: int32(1),
+		err:   "Cannot create field 'b' in element {a: null}",
+	}, {
+		name:  "ArrayKey",
+		doc:   MustMakeDocument("a", MustNewArray(int32(1))),
+		path:  []string{"a", "b"},
+		value: int32(1),
+		err:   "Cannot create field 'b' in element {a: &{[1] false}}",
+	}} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			doc := tc.doc
+			err := doc.SetByPath(tc.value, tc.path...)
+			if tc.err != "" {
+				var notViable *NotViableError
+				require.ErrorAs(t, err, &notViable)
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.res, doc)
+		})
+	}
+
+	t.Run("NoAliasing", func(t *testing.T) {
+		t.Parallel()
+
+		embedded := MustMakeDocument("b", int32(1))
+		arr := MustNewArray(embedded)
+		doc := MustMakeDocument("a", arr, "e", embedded)
+		shared := doc
+
+		require.NoError(t, doc.SetByPath(int32(2), "a", "0", "b"))
+		require.NoError(t, doc.SetByPath(int32(3), "e", "c"))
+
+		assert.Equal(t, MustMakeDocument("a", MustNewArray(embedded), "e", embedded), shared)
+		assert.Equal(t, MustMakeDocument("b", int32(1)), embedded)
+		assert.Equal(t, MustNewArray(MustMakeDocument("b", int32(1))), arr)
+	})
+}
+
+func TestRemoveByPath(t *testing.T) {
+	t.Parallel()
+
+	doc := MustMakeDocument(
+		"_id", int32(1),
+		"a", MustMakeDocument("b", int32(1), "c", nil),
+		"arr", MustNewArray(int32(1), MustMakeDocument("b", int32(2), "c", int32(3)), int32(4)),
+	)
+
+	type testCase struct {
+		path []string
+		res  Document
+	}
+
+	for _, tc := range []testCase{{ //nolint:paralleltest // false positive
+		path: []string{"a", "b"},
+		res: MustMakeDocument(
+			"_id", int32(1),
+			"a", MustMakeDocument("c", nil),
+			"arr", MustNewArray(int32(1), MustMakeDocument("b", int32(2), "c", int32(3)), int32(4)),
+		),
+	}, {
+		path: []string{"a", "c"},
+		res: MustMakeDocument(
+			"_id", int32(1),
+			"a", MustMakeDocument("b", int32(1)),
+			"arr", MustNewArray(int32(1), MustMakeDocument("b", int32(2), "c", int32(3)), int32(4)),
+		),
+	}, {
+		path: []string{"arr", "1", "c"},
+		res: MustMakeDocument(
+			"_id", int32(1),
+			"a", MustMakeDocument("b", int32(1), "c", nil),
+			"arr", MustNewArray(int32(1), MustMakeDocument("b", int32(2)), int32(4)),
+		),
+	}, {
+		path: []string{"arr", "0"},
+		res: MustMakeDocument(
+			"_id", int32(1),
+			"a", MustMakeDocument("b", int32(1), "c", nil),
+			"arr", MustNewArray(MustMakeDocument("b", int32(2), "c", int32(3)), int32(4)),
+		),
+	}, {
+		path: []string{"a", "b", "c"},
+		res:  doc,
+	}, {
+		path: []string{"arr", "3"},
+		res:  doc,
+	}, {
+		path: []string{"arr", "b"},
+		res:  doc,
+	}, {
+		path: []string{"missing", "b"},
+		res:  doc,
+	}} {
+		tc := tc
+		t.Run(fmt.Sprint(tc.path), func(t *testing.T) {
+			t.Parallel()
+
+			res := doc
+			res.RemoveByPath(tc.path...)
+			assert.Equal(t, tc.res, res)
+		})
+	}
+}
@@ -30,24 +30,26 @@
 //
 // Composite/pointer types
 //
-//	types.Document   *bson.Document  *fjson.Document
-//	*types.Array     *bson.Array     *fjson.Array
+//	types.Document       *bson.Document       *fjson.Document
+//	*types.Array         *bson.Array          *fjson.Array
 //
 // Scalar/value types
 //
-//	float64          *bson.Double     *fjson.Double
-//	string           *bson.String     *fjson.String
-//	types.Binary     *bson.Binary     *fjson.Binary
-//	types.ObjectID   *bson.ObjectID   *fjson.ObjectID
-//	bool             *bson.Bool       *fjson.Bool
-//	time.Time        *bson.DateTime   *fjson.DateTime
-//	any(nil)         any(nil)         any(nil)
-//	types.Regex      *bson.Regex      *fjson.Regex
-//	int32            *bson.Int32      *fjson.Int32
-//	types.Timestamp  *bson.Timestamp  *fjson.Timestamp
-//	int64            *bson.Int64      *fjson.Int64
+//	float64              *bson.Double         *fjson.Double
+//	string               *bson.String         *fjson.String
+//	types.Binary         *bson.Binary         *fjson.Binary
+//	types.ObjectID       *bson.ObjectID       *fjson.ObjectID
+//	bool                 *bson.Bool           *fjson.Bool
+//	time.Time            *bson.DateTime       *fjson.DateTime
+//	any(nil)             any(nil)             any(nil)
+//	types.Regex          *bson.Regex          *fjson.Regex
+//	int32                *bson.Int32          *fjson.Int32
+//	types.Timestamp      *bson.Timestamp      *fjson.Timestamp
+//	int64                *bson.Int64          *fjson.Int64
+//	types.Code           *bson.Code           *fjson.Code
+//	types.CodeWithScope  *bson.CodeWithScope  *fjson.CodeWithScope
 //	TODO Decimal128
-//	types.CString    *bson.CString    *fjson.CString
+//	types.CString        *bson.CString        *fjson.CString
 package types
 
 import (
@@ -77,6 +79,15 @@ type (
 
 	Timestamp uint64
 
+	// Code is JavaScript code, like a stored function.
+	Code string
+
+	// CodeWithScope is JavaScript code with a document of the variables in its scope.
+	CodeWithScope struct {
+		Code  string
+		Scope Document
+	}
+
 	NullType struct{}
 )
 
@@ -115,6 +126,10 @@ func validateValue(value any) error {
 		return nil
 	case CString:
 		return nil
+	case Code:
+		return nil
+	case CodeWithScope:
+		return value.Scope.validate()
 	default:
 		return fmt.Errorf("types.validateValue: unsupported type: %[1]T (%[1]v)", value)
 	}
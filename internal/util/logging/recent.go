@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// recentEntriesSize is the number of log entries kept for support bundles.
+const recentEntriesSize = 1024
+
+//nolint:gochecknoglobals // the global logger is set up once, too
+var recent = newRecentEntries(recentEntriesSize)
+
+// Recent returns the most recent log entries of the global logger as JSON lines, oldest first.
+func Recent() []string {
+	return recent.lines()
+}
+
+// recentEntries is a ring buffer of encoded log entries.
+type recentEntries struct {
+	mu      sync.Mutex
+	entries []string
+	next    int
+	full    bool
+}
+
+// newRecentEntries returns a ring buffer keeping the last size entries.
+func newRecentEntries(size int) *recentEntries {
+	return &recentEntries{
+		entries: make([]string, size),
+	}
+}
+
+// add adds the entry, replacing the oldest one if the buffer is full.
+func (r *recentEntries) add(entry string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// lines returns a copy of the entries, oldest first.
+func (r *recentEntries) lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]string(nil), r.entries[:r.next]...)
+	}
+
+	return append(append([]string(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// core returns a zapcore.Core adding the entries enabled by the level to the buffer.
+func (r *recentEntries) core(level zapcore.LevelEnabler) zapcore.Core {
+	return &recentCore{
+		LevelEnabler: level,
+		enc:          zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		recent:       r,
+	}
+}
+
+// recentCore is a zapcore.Core writing to recentEntries.
+type recentCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	recent *recentEntries
+}
+
+// With implements zapcore.Core.
+func (c *recentCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	return &recentCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          enc,
+		recent:       c.recent,
+	}
+}
+
+// Check implements zapcore.Core.
+func (c *recentCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return ce.AddCore(entry, c)
+	}
+
+	return ce
+}
+
+// Write implements zapcore.Core.
+func (c *recentCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(entry, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	// the JSON encoder ends the entry with a newline
+	line := buf.String()
+	c.recent.add(line[:len(line)-1])
+
+	return nil
+}
+
+// Sync implements zapcore.Core.
+func (c *recentCore) Sync() error {
+	return nil
+}
+
+// check interfaces
+var (
+	_ zapcore.Core = (*recentCore)(nil)
+)
@@ -0,0 +1,280 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package support collects support bundles with everything SAP support needs to analyze a problem
+// of the SAP HANA compatibility layer for MongoDB Wire Protocol in one archive.
+package support
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/fjson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/logging"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/version"
+)
+
+// hanaCheckTimeout is the maximum duration of every SAP HANA diagnostic.
+const hanaCheckTimeout = 10 * time.Second
+
+// ErrTooLarge is returned by Bytes if the support bundle exceeds the limit.
+var ErrTooLarge = errors.New("support bundle is too large")
+
+// DB is the part of *sql.DB used for the SAP HANA diagnostics.
+type DB interface {
+	PingContext(ctx context.Context) error
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Collector collects support bundles.
+//
+// All fields are optional; the files of missing ones are left out of the bundle.
+type Collector struct {
+	// Config is the sanitized configuration, without secrets.
+	Config any
+	// ConfigProblems are the problems of an invalid configuration.
+	ConfigProblems []string
+	// Gatherer gathers the metrics.
+	Gatherer prometheus.Gatherer
+	// HANA is the connection pool used for the SAP HANA connectivity diagnostics.
+	HANA DB
+	// Report returns the compatibility report.
+	Report func() (any, error)
+}
+
+// hanaCheck is the result of one SAP HANA connectivity diagnostic.
+type hanaCheck struct {
+	Name     string `json:"name"`
+	Query    string `json:"query,omitempty"`
+	Result   string `json:"result,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Collect writes a zip archive with the support bundle to w.
+//
+// The bundle contains the files
+//   - version.json with the version and build provenance;
+//   - config.json with the sanitized configuration and its problems;
+//   - logs.jsonl with the most recent log entries;
+//   - metrics.txt with a snapshot of the metrics;
+//   - goroutines.txt and heap.pprof with the goroutine and heap profiles;
+//   - hana.json with the SAP HANA connectivity diagnostics;
+//   - compatibility.json with the compatibility report.
+//
+// Failures of single files do not stop the collection; they are listed in errors.txt,
+// and the file may be empty or incomplete.
+func (c *Collector) Collect(ctx context.Context, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+
+	var problems []string
+	add := func(name string, f func(w io.Writer) error) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		if err = f(fw); errors.Is(err, ErrTooLarge) {
+			return err
+		} else if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err))
+		}
+
+		return nil
+	}
+
+	files := []struct {
+		name string
+		f    func(w io.Writer) error
+		skip bool
+	}{
+		{name: "version.json", f: writeVersion},
+		{name: "config.json", f: c.writeConfig, skip: c.Config == nil && c.ConfigProblems == nil},
+		{name: "logs.jsonl", f: writeLogs},
+		{name: "metrics.txt", f: c.writeMetrics, skip: c.Gatherer == nil},
+		{name: "goroutines.txt", f: writeProfile("goroutine", 2)},
+		{name: "heap.pprof", f: writeProfile("heap", 0)},
+		{name: "hana.json", f: func(w io.Writer) error { return c.writeHANA(ctx, w) }, skip: c.HANA == nil},
+		{name: "compatibility.json", f: c.writeReport, skip: c.Report == nil},
+	}
+
+	for _, file := range files {
+		if file.skip {
+			continue
+		}
+
+		if err := add(file.name, file.f); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) > 0 {
+		err := add("errors.txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, strings.Join(problems, "\n")+"\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// Bytes returns the support bundle collected by Collect.
+// It stops collecting and returns ErrTooLarge as soon as the bundle exceeds limit bytes.
+func (c *Collector) Bytes(ctx context.Context, limit int) ([]byte, error) {
+	buf := &limitedBuffer{limit: limit}
+	if err := c.Collect(ctx, buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// limitedBuffer is a bytes.Buffer which returns ErrTooLarge for writes exceeding its limit.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+// Write implements io.Writer.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, ErrTooLarge
+	}
+
+	return b.Buffer.Write(p)
+}
+
+// writeJSON writes the indented JSON of v.
+func writeJSON(w io.Writer, v any) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(v)
+}
+
+// writeVersion writes the version and build provenance.
+func writeVersion(w io.Writer) error {
+	b, err := fjson.Marshal(version.Get().Document())
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// writeConfig writes the sanitized configuration and its problems.
+func (c *Collector) writeConfig(w io.Writer) error {
+	return writeJSON(w, map[string]any{
+		"config":   c.Config,
+		"problems": c.ConfigProblems,
+	})
+}
+
+// writeLogs writes the most recent log entries.
+func writeLogs(w io.Writer) error {
+	for _, line := range logging.Recent() {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMetrics writes the metrics in the text format of /debug/metrics.
+func (c *Collector) writeMetrics(w io.Writer) error {
+	mfs, err := c.Gatherer.Gather()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	for _, mf := range mfs {
+		if _, err = expfmt.MetricFamilyToText(w, mf); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// writeProfile returns a function writing the runtime profile with the given name.
+func writeProfile(name string, debug int) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		return pprof.Lookup(name).WriteTo(w, debug)
+	}
+}
+
+// writeHANA writes the results of the SAP HANA connectivity diagnostics.
+// A failed diagnostic is part of the results and not an error.
+func (c *Collector) writeHANA(ctx context.Context, w io.Writer) error {
+	checks := []hanaCheck{c.checkHANA(ctx, "ping", "")}
+
+	for _, check := range []struct {
+		name  string
+		query string
+	}{
+		{name: "version", query: `SELECT VERSION FROM "SYS"."M_DATABASE"`},
+		{name: "user", query: `SELECT CURRENT_USER FROM DUMMY`},
+		{name: "schema", query: `SELECT CURRENT_SCHEMA FROM DUMMY`},
+		{name: "collections", query: `SELECT COUNT(*) FROM "PUBLIC"."M_TABLES" WHERE TABLE_TYPE = 'COLLECTION'`},
+	} {
+		checks = append(checks, c.checkHANA(ctx, check.name, check.query))
+	}
+
+	return writeJSON(w, checks)
+}
+
+// checkHANA runs one SAP HANA diagnostic, a ping if the query is empty.
+func (c *Collector) checkHANA(ctx context.Context, name, query string) hanaCheck {
+	ctx, cancel := context.WithTimeout(ctx, hanaCheckTimeout)
+	defer cancel()
+
+	res := hanaCheck{Name: name, Query: query}
+	start := time.Now()
+
+	var err error
+	if query == "" {
+		err = c.HANA.PingContext(ctx)
+	} else {
+		err = c.HANA.QueryRowContext(ctx, query).Scan(&res.Result)
+	}
+
+	res.Duration = time.Since(start).String()
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// writeReport writes the compatibility report.
+func (c *Collector) writeReport(w io.Writer) error {
+	report, err := c.Report()
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, report)
+}
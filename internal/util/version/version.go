@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -20,6 +22,7 @@ package version
 
 import (
 	_ "embed"
+	"runtime"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -46,8 +49,18 @@ type Info struct {
 	Dirty            bool
 	Debug            bool // testcover or -race
 	BuildEnvironment types.Document
+
+	// build provenance included in bug reports
+	GoVersion        string
+	OS               string
+	Arch             string
+	BuildTags        []string
+	HDBDriverVersion string // empty if unknown
 }
 
+// hdbDriverPath is the suffix of the module path of the SAP HANA driver.
+const hdbDriverPath = "go-hdb"
+
 var info *Info
 
 func Get() *Info {
@@ -56,8 +69,12 @@ func Get() *Info {
 
 func init() {
 	info = &Info{
-		Version: strings.TrimSpace(version),
-		Branch:  strings.TrimSpace(branch),
+		Version:   strings.TrimSpace(version),
+		Branch:    strings.TrimSpace(branch),
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		BuildTags: []string{},
 	}
 
 	buildInfo, ok := debug.ReadBuildInfo()
@@ -65,6 +82,16 @@ func init() {
 		return
 	}
 
+	for _, dep := range buildInfo.Deps {
+		if !strings.HasSuffix(dep.Path, hdbDriverPath) {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		info.HDBDriverVersion = dep.Version
+	}
+
 	info.BuildEnvironment = types.MustMakeDocument()
 	for _, s := range buildInfo.Settings {
 		info.BuildEnvironment.Set(s.Key, s.Value)
@@ -78,9 +105,31 @@ func init() {
 				info.Debug = true
 			}
 		case "-tags":
-			if slices.Contains(strings.Split(s.Value, ","), "testcover") {
+			info.BuildTags = strings.Split(s.Value, ",")
+			if slices.Contains(info.BuildTags, "testcover") {
 				info.Debug = true
 			}
 		}
 	}
 }
+
+// Document returns the version and build provenance, as returned by serverStatus and versionInfo.
+func (i *Info) Document() types.Document {
+	tags := make([]any, len(i.BuildTags))
+	for j, tag := range i.BuildTags {
+		tags[j] = tag
+	}
+
+	return types.MustMakeDocument(
+		"version", i.Version,
+		"commit", i.Commit,
+		"branch", i.Branch,
+		"dirty", i.Dirty,
+		"debug", i.Debug,
+		"goVersion", i.GoVersion,
+		"os", i.OS,
+		"arch", i.Arch,
+		"buildTags", types.MustNewArray(tags...),
+		"hdbDriverVersion", i.HDBDriverVersion,
+	)
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// ErrChecksumMismatch is returned for an OP_MSG whose CRC32C checksum does not match its content,
+// which is corrupted.
+var ErrChecksumMismatch = errors.New("OP_MSG checksum mismatch")
+
+// crc32cTable is the table of the CRC-32C (Castagnoli) checksum of OP_MSG.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// hasChecksum returns true if the message body is an OP_MSG with the checksumPresent flag.
+func hasChecksum(header *MsgHeader, body []byte) bool {
+	if header.OpCode != OP_MSG || len(body) < 4 {
+		return false
+	}
+
+	return OpMsgFlags(binary.LittleEndian.Uint32(body)).FlagSet(OpMsgChecksumPresent)
+}
+
+// checksum returns the CRC32C checksum of the message, which covers the header and the body without the checksum.
+func checksum(header *MsgHeader, body []byte) (uint32, error) {
+	b, err := header.MarshalBinary()
+	if err != nil {
+		return 0, lazyerrors.Error(err)
+	}
+
+	sum := crc32.Update(0, crc32cTable, b)
+	return crc32.Update(sum, crc32cTable, body[:len(body)-4]), nil
+}
+
+// validateChecksum returns ErrChecksumMismatch if the checksum at the end of the body does not match the message.
+func validateChecksum(header *MsgHeader, body []byte) error {
+	if len(body) < 8 {
+		return lazyerrors.Errorf("OP_MSG of %d bytes is too short for a checksum", len(body))
+	}
+
+	expected, err := checksum(header, body)
+	if err != nil {
+		return err
+	}
+
+	if actual := binary.LittleEndian.Uint32(body[len(body)-4:]); actual != expected {
+		return lazyerrors.Errorf("expected %#08x, got %#08x: %w", expected, actual, ErrChecksumMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+
+	msg := &OpMsg{FlagBits: OpMsgFlags(OpMsgChecksumPresent)}
+	require.NoError(t, msg.SetSections(OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument("ping", int32(1), "$db", "admin")},
+	}))
+
+	body, err := msg.MarshalBinary()
+	require.NoError(t, err)
+	header := &MsgHeader{MessageLength: int32(MsgHeaderLen + len(body)), RequestID: 1, OpCode: OP_MSG}
+
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+	require.NoError(t, WriteMessage(bufw, header, msg))
+	require.NoError(t, bufw.Flush())
+	b := buf.Bytes()
+
+	expected := crc32.Checksum(b[:len(b)-4], crc32.MakeTable(crc32.Castagnoli))
+	assert.Equal(t, expected, msg.Checksum)
+
+	_, actual, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual.(*OpMsg).Checksum)
+
+	t.Run("Corrupted", func(t *testing.T) {
+		t.Parallel()
+
+		corrupted := append([]byte(nil), b...)
+		corrupted[MsgHeaderLen+10] ^= 0xff
+
+		_, _, err := ReadMessage(bufio.NewReader(bytes.NewReader(corrupted)))
+		require.ErrorIs(t, err, ErrChecksumMismatch)
+	})
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestLegacyOpcodes(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		opCode  OpCode
+		msgBody MsgBody
+		noReply bool
+	}{
+		"Insert": {
+			opCode: OP_INSERT,
+			msgBody: &OpInsert{
+				ContinueOnError:    true,
+				FullCollectionName: "test.values",
+				Documents: []types.Document{
+					types.MustMakeDocument("_id", int32(1), "v", "foo"),
+					types.MustMakeDocument("_id", int32(2), "v", "bar"),
+				},
+			},
+			noReply: true,
+		},
+		"Update": {
+			opCode: OP_UPDATE,
+			msgBody: &OpUpdate{
+				FullCollectionName: "test.values",
+				Upsert:             true,
+				Selector:           types.MustMakeDocument("_id", int32(1)),
+				Update:             types.MustMakeDocument("$set", types.MustMakeDocument("v", "baz")),
+			},
+			noReply: true,
+		},
+		"Delete": {
+			opCode: OP_DELETE,
+			msgBody: &OpDelete{
+				FullCollectionName: "test.values",
+				SingleRemove:       true,
+				Selector:           types.MustMakeDocument("v", "foo"),
+			},
+			noReply: true,
+		},
+		"GetMore": {
+			opCode: OP_GET_MORE,
+			msgBody: &OpGetMore{
+				FullCollectionName: "test.values",
+				NumberToReturn:     10,
+				CursorID:           42,
+			},
+		},
+		"KillCursors": {
+			opCode:  OP_KILL_CURSORS,
+			msgBody: &OpKillCursors{CursorIDs: []int64{42, 43}},
+			noReply: true,
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			body, err := tc.msgBody.MarshalBinary()
+			require.NoError(t, err)
+			header := &MsgHeader{MessageLength: int32(MsgHeaderLen + len(body)), RequestID: 1, OpCode: tc.opCode}
+
+			var buf bytes.Buffer
+			bufw := bufio.NewWriter(&buf)
+			require.NoError(t, WriteMessage(bufw, header, tc.msgBody))
+			require.NoError(t, bufw.Flush())
+
+			actualHeader, actualBody, err := ReadMessage(bufio.NewReader(&buf))
+			require.NoError(t, err)
+			assert.Equal(t, header, actualHeader)
+			assert.Equal(t, tc.msgBody, actualBody)
+			assert.Equal(t, tc.noReply, NoReply(actualHeader, actualBody))
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "SAP_HANA_compatibility_layer_for_MongoDB_Wire_Protocol"
+	subsystem = "wire"
+)
+
+// Metrics are the wire protocol metrics, which distinguish the time spent decoding and encoding messages
+// from the time spent in SAP HANA.
+//
+// The methods may be called on a nil *Metrics, which reads and writes messages without metrics.
+type Metrics struct {
+	decodeSeconds *prometheus.HistogramVec
+	encodeSeconds *prometheus.HistogramVec
+	messageBytes  *prometheus.HistogramVec
+}
+
+// NewMetrics creates new wire protocol metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		decodeSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "decode_seconds",
+				Help:      "Time to decode the body of a received message.",
+				Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to 2.6s
+			},
+			[]string{"opcode"},
+		),
+		encodeSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "encode_seconds",
+				Help:      "Time to encode the body of a sent message.",
+				Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10), // 10µs to 2.6s
+			},
+			[]string{"opcode"},
+		),
+		messageBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "message_size_bytes",
+				Help:      "Size of received and sent messages including the header.",
+				Buckets:   prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+			},
+			[]string{"opcode", "direction"},
+		),
+	}
+}
+
+// ReadMessage is ReadMessage recording the size and decode time of the message.
+func (m *Metrics) ReadMessage(r *bufio.Reader) (*MsgHeader, MsgBody, error) {
+	return readMessage(r, m)
+}
+
+// WriteMessage is WriteMessage recording the size and encode time of the message.
+func (m *Metrics) WriteMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody) error {
+	return writeMessage(w, header, msg, m)
+}
+
+// observeDecode records a received message.
+func (m *Metrics) observeDecode(header *MsgHeader, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	opcode := header.OpCode.String()
+	m.decodeSeconds.WithLabelValues(opcode).Observe(d.Seconds())
+	m.messageBytes.WithLabelValues(opcode, "received").Observe(float64(header.MessageLength))
+}
+
+// observeEncode records a sent message.
+func (m *Metrics) observeEncode(header *MsgHeader, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	opcode := header.OpCode.String()
+	m.encodeSeconds.WithLabelValues(opcode).Observe(d.Seconds())
+	m.messageBytes.WithLabelValues(opcode, "sent").Observe(float64(header.MessageLength))
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.decodeSeconds.Describe(ch)
+	m.encodeSeconds.Describe(ch)
+	m.messageBytes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.decodeSeconds.Collect(ch)
+	m.encodeSeconds.Collect(ch)
+	m.messageBytes.Collect(ch)
+}
+
+// check interfaces
+var (
+	_ prometheus.Collector = (*Metrics)(nil)
+)
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	var msg OpMsg
+	require.NoError(t, msg.SetSections(OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument("ping", int32(1), "$db", "admin")},
+	}))
+
+	b, err := msg.MarshalBinary()
+	require.NoError(t, err)
+
+	header := &MsgHeader{
+		MessageLength: int32(MsgHeaderLen + len(b)),
+		RequestID:     1,
+		OpCode:        OP_MSG,
+	}
+
+	m := NewMetrics()
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	require.NoError(t, m.WriteMessage(w, header, &msg))
+	require.NoError(t, w.Flush())
+
+	actualHeader, actualBody, err := m.ReadMessage(bufio.NewReader(&buf))
+	require.NoError(t, err)
+	assert.Equal(t, header, actualHeader)
+	assert.Equal(t, &msg, actualBody)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(m.decodeSeconds))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.encodeSeconds))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.messageBytes))
+
+	// nil metrics read and write messages without recording them
+	var nilMetrics *Metrics
+	require.NoError(t, nilMetrics.WriteMessage(w, header, &msg))
+	require.NoError(t, w.Flush())
+	_, _, err = nilMetrics.ReadMessage(bufio.NewReader(&buf))
+	require.NoError(t, err)
+}
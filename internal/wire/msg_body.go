@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -21,10 +23,15 @@ package wire
 import (
 	"bufio"
 	"encoding"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"time"
 
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
 )
 
@@ -39,12 +46,52 @@ type MsgBody interface {
 
 //go-sumtype:decl MsgBody
 
+// streamedBody is implemented by the bodies of replies, which may contain large batches of documents.
+// They are written section by section and document by document with a bounded buffer
+// instead of being marshaled as a whole.
+type streamedBody interface {
+	// size returns the length of the marshaled body without marshaling it.
+	size() (int, error)
+
+	// writeTo writes the body without the OP_MSG checksum, which is written by writeMessage.
+	writeTo(*bufio.Writer) error
+}
+
+// BodySize returns the length of the marshaled body.
+// Replies are not marshaled for that.
+func BodySize(msg MsgBody) (int, error) {
+	if sb, ok := msg.(streamedBody); ok {
+		return sb.size()
+	}
+
+	b, err := msg.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// ReadMessage reads the next message.
+//
+// For a message longer than MaxMsgLen, it returns its header with ErrMessageTooLarge without reading its body,
+// so that the connection can't be used further.
+// For a message with a document longer than bson.MaxDocumentLen, it returns its header with bson.ErrDocumentTooLarge,
+// and the next message can be read.
 func ReadMessage(r *bufio.Reader) (*MsgHeader, MsgBody, error) {
+	return readMessage(r, nil)
+}
+
+// readMessage reads the next message and records it in the metrics, which may be nil.
+func readMessage(r *bufio.Reader, m *Metrics) (*MsgHeader, MsgBody, error) {
 	var header MsgHeader
 	if err := header.readFrom(r); err != nil {
 		if err == io.EOF {
 			return nil, nil, err
 		}
+		if errors.Is(err, ErrMessageTooLarge) {
+			return &header, nil, lazyerrors.Error(err)
+		}
 		return nil, nil, lazyerrors.Error(err)
 	}
 
@@ -53,62 +100,156 @@ func ReadMessage(r *bufio.Reader) (*MsgHeader, MsgBody, error) {
 		return nil, nil, lazyerrors.Errorf("expected %d, read %d: %w", len(b), n, err)
 	}
 
-	switch header.OpCode {
-	case OP_REPLY:
-		var reply OpReply
-		if err := reply.UnmarshalBinary(b); err != nil {
+	if hasChecksum(&header, b) {
+		if err := validateChecksum(&header, b); err != nil {
 			return nil, nil, lazyerrors.Error(err)
 		}
+	}
 
-		return &header, &reply, nil
+	if header.OpCode == OP_COMPRESSED {
+		return readCompressed(&header, b, m)
+	}
 
-	case OP_MSG:
-		var msg OpMsg
-		if err := msg.UnmarshalBinary(b); err != nil {
-			return nil, nil, lazyerrors.Error(err)
+	body, err := newMsgBody(header.OpCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	if err = body.UnmarshalBinary(b); err != nil {
+		if errors.Is(err, bson.ErrDocumentTooLarge) {
+			return &header, nil, lazyerrors.Error(err)
 		}
+		return nil, nil, lazyerrors.Error(err)
+	}
+	m.observeDecode(&header, time.Since(start))
 
-		return &header, &msg, nil
+	return &header, body, nil
+}
 
-	case OP_QUERY:
-		var query OpQuery
-		if err := query.UnmarshalBinary(b); err != nil {
-			return nil, nil, lazyerrors.Error(err)
-		}
+// newMsgBody returns a new body for the opcode, except OP_COMPRESSED.
+func newMsgBody(opCode OpCode) (MsgBody, error) {
+	switch opCode {
+	case OP_REPLY:
+		return new(OpReply), nil
+
+	case OP_MSG:
+		return new(OpMsg), nil
 
-		return &header, &query, nil
+	case OP_QUERY:
+		return new(OpQuery), nil
 
 	case OP_UPDATE:
-		fallthrough
+		return new(OpUpdate), nil
+
 	case OP_INSERT:
-		fallthrough
-	case OP_GET_BY_OID:
-		fallthrough
+		return new(OpInsert), nil
+
 	case OP_GET_MORE:
-		fallthrough
+		return new(OpGetMore), nil
+
 	case OP_DELETE:
-		fallthrough
+		return new(OpDelete), nil
+
 	case OP_KILL_CURSORS:
+		return new(OpKillCursors), nil
+
+	case OP_GET_BY_OID:
 		fallthrough
 	case OP_COMPRESSED:
 		fallthrough
 
 	default:
-		return nil, nil, lazyerrors.Errorf("unhandled opcode %s", header.OpCode)
+		return nil, lazyerrors.Errorf("unhandled opcode %s", opCode)
+	}
+}
+
+// NoReply returns true if the message is not replied to, like the legacy writes OP_INSERT, OP_UPDATE and OP_DELETE,
+// OP_KILL_CURSORS, and OP_MSG with the moreToCome flag.
+func NoReply(header *MsgHeader, body MsgBody) bool {
+	switch header.OpCode {
+	case OP_INSERT, OP_UPDATE, OP_DELETE, OP_KILL_CURSORS:
+		return true
+	case OP_MSG:
+		msg, ok := body.(*OpMsg)
+		return ok && msg.FlagBits.FlagSet(OpMsgMoreToCome)
+	default:
+		return false
 	}
 }
 
+// WriteMessage writes the message.
 func WriteMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody) error {
+	return writeMessage(w, header, msg, nil)
+}
+
+// writeMessage writes the message and records it in the metrics, which may be nil.
+//
+// OP_MSG and OP_REPLY bodies are streamed to w, so the encoding duration of the metrics
+// includes the time to flush the buffer of w when it is full.
+func writeMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody, m *Metrics) error {
+	start := time.Now()
+
+	sb, ok := msg.(streamedBody)
+	if !ok {
+		return writeMarshaled(w, header, msg, m)
+	}
+
+	l, err := sb.size()
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if err = checkLength(header, l); err != nil {
+		return err
+	}
+
+	opMsg, ok := msg.(*OpMsg)
+	if !ok || !opMsg.FlagBits.FlagSet(OpMsgChecksumPresent) {
+		if err = header.writeTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+		if err = sb.writeTo(w); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		m.observeEncode(header, time.Since(start))
+		return nil
+	}
+
+	// the checksum of an OP_MSG is computed over the written message
+	crc := crc32.New(crc32cTable)
+	hw := bufio.NewWriter(io.MultiWriter(w, crc))
+	if err = header.writeTo(hw); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err = sb.writeTo(hw); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err = hw.Flush(); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	opMsg.Checksum = crc.Sum32()
+	if err = binary.Write(w, binary.LittleEndian, opMsg.Checksum); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	m.observeEncode(header, time.Since(start))
+	return nil
+}
+
+// writeMarshaled writes the message with a body which is marshaled as a whole.
+func writeMarshaled(w *bufio.Writer, header *MsgHeader, msg MsgBody, m *Metrics) error {
+	start := time.Now()
 	b, err := msg.MarshalBinary()
 	if err != nil {
 		return lazyerrors.Error(err)
 	}
+	m.observeEncode(header, time.Since(start))
 
-	if expected := len(b) + MsgHeaderLen; int32(expected) != header.MessageLength {
-		panic(fmt.Sprintf(
-			"expected length %d (marshaled body size) + %d (fixed marshaled header size) = %d, got %d",
-			len(b), MsgHeaderLen, expected, header.MessageLength,
-		))
+	if err = checkLength(header, len(b)); err != nil {
+		return err
 	}
 
 	if err := header.writeTo(w); err != nil {
@@ -121,3 +262,20 @@ func WriteMessage(w *bufio.Writer, header *MsgHeader, msg MsgBody) error {
 
 	return nil
 }
+
+// checkLength returns ErrMessageTooLarge if the message is larger than MaxMsgLen,
+// and panics if the message length of the header does not match the length of the body.
+func checkLength(header *MsgHeader, bodyLen int) error {
+	if bodyLen+MsgHeaderLen > MaxMsgLen {
+		return lazyerrors.Errorf("message length %d: %w", bodyLen+MsgHeaderLen, ErrMessageTooLarge)
+	}
+
+	if expected := bodyLen + MsgHeaderLen; int32(expected) != header.MessageLength {
+		panic(fmt.Sprintf(
+			"expected length %d (marshaled body size) + %d (fixed marshaled header size) = %d, got %d",
+			bodyLen, MsgHeaderLen, expected, header.MessageLength,
+		))
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestReadMessageTooLarge(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Message", func(t *testing.T) {
+		t.Parallel()
+
+		header := &MsgHeader{MessageLength: MaxMsgLen + 1, RequestID: 1, OpCode: OP_MSG}
+		b, err := header.MarshalBinary()
+		require.NoError(t, err)
+
+		actual, body, err := ReadMessage(bufio.NewReader(bytes.NewReader(b)))
+		require.ErrorIs(t, err, ErrMessageTooLarge)
+		assert.Equal(t, header, actual)
+		assert.Nil(t, body)
+	})
+
+	t.Run("Document", func(t *testing.T) {
+		t.Parallel()
+
+		// OP_MSG without flags with a section of kind 0 of a document declaring a length above the maximum
+		body := make([]byte, 10)
+		binary.LittleEndian.PutUint32(body[5:], bson.MaxInternalDocumentLen+1)
+		header := &MsgHeader{MessageLength: int32(MsgHeaderLen + len(body)), RequestID: 1, OpCode: OP_MSG}
+
+		var buf bytes.Buffer
+		b, err := header.MarshalBinary()
+		require.NoError(t, err)
+		buf.Write(b)
+		buf.Write(body)
+
+		// the next message is read after the one with the document which is too large
+		next := &OpMsg{}
+		require.NoError(t, next.SetSections(OpMsgSection{
+			Documents: []types.Document{types.MustMakeDocument("ping", int32(1), "$db", "admin")},
+		}))
+		nextB, err := next.MarshalBinary()
+		require.NoError(t, err)
+		bufw := bufio.NewWriter(&buf)
+		require.NoError(t, WriteMessage(bufw, &MsgHeader{MessageLength: int32(MsgHeaderLen + len(nextB)), RequestID: 2, OpCode: OP_MSG}, next))
+		require.NoError(t, bufw.Flush())
+
+		bufr := bufio.NewReader(&buf)
+		actual, actualBody, err := ReadMessage(bufr)
+		require.ErrorIs(t, err, bson.ErrDocumentTooLarge)
+		assert.Equal(t, header, actual)
+		assert.Nil(t, actualBody)
+
+		actual, actualBody, err = ReadMessage(bufr)
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), actual.RequestID)
+		assert.Equal(t, next, actualBody)
+	})
+}
+
+func TestWriteMessageStreamed(t *testing.T) {
+	t.Parallel()
+
+	docs := make([]types.Document, 100)
+	for i := range docs {
+		docs[i] = types.MustMakeDocument("_id", int32(i), "v", types.MustNewArray("a", int64(i)))
+	}
+
+	msg := &OpMsg{FlagBits: OpMsgFlags(OpMsgChecksumPresent)}
+	require.NoError(t, msg.SetSections(
+		OpMsgSection{Documents: []types.Document{types.MustMakeDocument("ok", float64(1))}},
+		OpMsgSection{Kind: 1, Identifier: "documents", Documents: docs},
+	))
+
+	for name, body := range map[string]MsgBody{
+		"OpMsg":   msg,
+		"OpReply": &OpReply{NumberReturned: int32(len(docs)), Documents: docs},
+	} {
+		name, body := name, body
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			l, err := BodySize(body)
+			require.NoError(t, err)
+
+			opCode := OP_REPLY
+			if _, ok := body.(*OpMsg); ok {
+				opCode = OP_MSG
+			}
+			header := &MsgHeader{MessageLength: int32(MsgHeaderLen + l), RequestID: 1, OpCode: opCode}
+
+			var buf bytes.Buffer
+			bufw := bufio.NewWriterSize(&buf, 64)
+			require.NoError(t, WriteMessage(bufw, header, body))
+			require.NoError(t, bufw.Flush())
+
+			// the streamed message is the marshaled one, with the checksum set while writing
+			b, err := header.MarshalBinary()
+			require.NoError(t, err)
+			marshaled, err := body.MarshalBinary()
+			require.NoError(t, err)
+			assert.Equal(t, append(b, marshaled...), buf.Bytes())
+
+			actualHeader, actualBody, err := ReadMessage(bufio.NewReader(&buf))
+			require.NoError(t, err)
+			assert.Equal(t, header, actualHeader)
+			assert.Equal(t, body, actualBody)
+		})
+	}
+}
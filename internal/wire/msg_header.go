@@ -23,6 +23,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"io"
 
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
@@ -62,6 +63,9 @@ const (
 	MaxMsgLen    = 48000000
 )
 
+// ErrMessageTooLarge is returned for messages longer than MaxMsgLen, the maxMessageSizeBytes of MongoDB.
+var ErrMessageTooLarge = errors.New("message is too large")
+
 func (msg *MsgHeader) readFrom(r *bufio.Reader) error {
 	b := make([]byte, MsgHeaderLen)
 	if n, err := io.ReadFull(r, b); err != nil {
@@ -76,7 +80,10 @@ func (msg *MsgHeader) readFrom(r *bufio.Reader) error {
 	msg.ResponseTo = int32(binary.LittleEndian.Uint32(b[8:12]))
 	msg.OpCode = OpCode(binary.LittleEndian.Uint32(b[12:16]))
 
-	if msg.MessageLength < MsgHeaderLen || msg.MessageLength > MaxMsgLen {
+	if msg.MessageLength > MaxMsgLen {
+		return lazyerrors.Errorf("message length %d: %w", msg.MessageLength, ErrMessageTooLarge)
+	}
+	if msg.MessageLength < MsgHeaderLen {
 		return lazyerrors.Errorf("invalid message length %d", msg.MessageLength)
 	}
 
@@ -0,0 +1,289 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// Compressor is the ID of the algorithm compressing the original message of an OP_COMPRESSED message.
+type Compressor uint8
+
+const (
+	CompressorNoop   = Compressor(0)
+	CompressorSnappy = Compressor(1)
+	CompressorZlib   = Compressor(2)
+	CompressorZstd   = Compressor(3)
+)
+
+// compressorNames are the names of the compressors used in the compression array of hello.
+var compressorNames = map[Compressor]string{
+	CompressorNoop:   "noop",
+	CompressorSnappy: "snappy",
+	CompressorZlib:   "zlib",
+	CompressorZstd:   "zstd",
+}
+
+// String returns the name of the compressor.
+func (c Compressor) String() string {
+	if name, ok := compressorNames[c]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Compressor(%d)", c)
+}
+
+// NegotiableCompressors are the compressors which can be negotiated with clients in hello, by name.
+// Messages compressed with noop are read too, but drivers don't negotiate it.
+var NegotiableCompressors = map[string]Compressor{
+	"zlib": CompressorZlib,
+}
+
+// opCompressedPrefixLen is the length of the fields of OP_COMPRESSED before the compressed message.
+const opCompressedPrefixLen = 9
+
+// OpCompressed is a message whose original message, without the header, is compressed.
+//
+// ReadMessage decodes the original message of an OP_COMPRESSED message into Body.
+type OpCompressed struct {
+	OriginalOpCode   OpCode
+	UncompressedSize int32
+	Compressor       Compressor
+
+	// Body is the body of the original message.
+	Body MsgBody
+
+	// the marshaled body of the OP_COMPRESSED message, as read or compressed
+	b []byte
+}
+
+func (compressed *OpCompressed) msgbody() {}
+
+// OriginalHeader returns the header of the original message of the OP_COMPRESSED message with the given header.
+func (compressed *OpCompressed) OriginalHeader(header *MsgHeader) *MsgHeader {
+	return &MsgHeader{
+		MessageLength: MsgHeaderLen + compressed.UncompressedSize,
+		RequestID:     header.RequestID,
+		ResponseTo:    header.ResponseTo,
+		OpCode:        compressed.OriginalOpCode,
+	}
+}
+
+// Compress returns the header and the body of the OP_COMPRESSED message with the message compressed by the compressor.
+// The message length of the header must be set.
+func Compress(header *MsgHeader, body MsgBody, compressor Compressor) (*MsgHeader, *OpCompressed, error) {
+	// the message is written as a whole, with the checksum of an OP_MSG computed over the original message
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+	if err := writeMessage(bufw, header, body, nil); err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+	if err := bufw.Flush(); err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	compressed := &OpCompressed{
+		OriginalOpCode:   header.OpCode,
+		UncompressedSize: int32(buf.Len() - MsgHeaderLen),
+		Compressor:       compressor,
+		Body:             body,
+	}
+
+	var err error
+	if compressed.b, err = compressed.compress(buf.Bytes()[MsgHeaderLen:]); err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	compressedHeader := &MsgHeader{
+		MessageLength: int32(MsgHeaderLen + len(compressed.b)),
+		RequestID:     header.RequestID,
+		ResponseTo:    header.ResponseTo,
+		OpCode:        OP_COMPRESSED,
+	}
+
+	return compressedHeader, compressed, nil
+}
+
+// compress returns the marshaled OP_COMPRESSED body with the original body b.
+func (compressed *OpCompressed) compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, uint32(compressed.OriginalOpCode))
+	binary.Write(&buf, binary.LittleEndian, compressed.UncompressedSize)
+	buf.WriteByte(byte(compressed.Compressor))
+
+	switch compressed.Compressor {
+	case CompressorNoop:
+		buf.Write(b)
+
+	case CompressorZlib:
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+
+	default:
+		return nil, lazyerrors.Errorf("unsupported compressor %s", compressed.Compressor)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decompress sets the fields of the OP_COMPRESSED body b, and returns the original body.
+func (compressed *OpCompressed) decompress(b []byte) ([]byte, error) {
+	if len(b) < opCompressedPrefixLen {
+		return nil, lazyerrors.Errorf("OP_COMPRESSED of %d bytes is too short", len(b))
+	}
+
+	compressed.OriginalOpCode = OpCode(binary.LittleEndian.Uint32(b[0:4]))
+	compressed.UncompressedSize = int32(binary.LittleEndian.Uint32(b[4:8]))
+	compressed.Compressor = Compressor(b[8])
+	compressed.b = b
+
+	if compressed.OriginalOpCode == OP_COMPRESSED {
+		return nil, lazyerrors.Errorf("OP_COMPRESSED of OP_COMPRESSED")
+	}
+
+	size := compressed.UncompressedSize
+	if size < 0 || size > MaxMsgLen-MsgHeaderLen {
+		return nil, lazyerrors.Errorf("uncompressed size %d: %w", size, ErrMessageTooLarge)
+	}
+
+	var r io.Reader
+	switch compressed.Compressor {
+	case CompressorNoop:
+		r = bytes.NewReader(b[opCompressedPrefixLen:])
+
+	case CompressorZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(b[opCompressedPrefixLen:]))
+		if err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+		defer zr.Close()
+		r = zr
+
+	default:
+		return nil, lazyerrors.Errorf("unsupported compressor %s", compressed.Compressor)
+	}
+
+	// one more byte than expected is read to find out if the original message is longer
+	original, err := io.ReadAll(io.LimitReader(r, int64(size)+1))
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if len(original) != int(size) {
+		return nil, lazyerrors.Errorf("uncompressed size %d, expected %d", len(original), size)
+	}
+
+	return original, nil
+}
+
+// readCompressed decodes the OP_COMPRESSED body b of the message with the header,
+// and records it in the metrics, which may be nil.
+func readCompressed(header *MsgHeader, b []byte, m *Metrics) (*MsgHeader, MsgBody, error) {
+	start := time.Now()
+
+	var compressed OpCompressed
+	original, err := compressed.decompress(b)
+	if err != nil {
+		return nil, nil, lazyerrors.Error(err)
+	}
+
+	originalHeader := compressed.OriginalHeader(header)
+	if hasChecksum(originalHeader, original) {
+		if err = validateChecksum(originalHeader, original); err != nil {
+			return nil, nil, lazyerrors.Error(err)
+		}
+	}
+
+	if compressed.Body, err = newMsgBody(compressed.OriginalOpCode); err != nil {
+		return nil, nil, err
+	}
+
+	if err = compressed.Body.UnmarshalBinary(original); err != nil {
+		// the error is replied to like for the original message
+		if errors.Is(err, bson.ErrDocumentTooLarge) {
+			return originalHeader, nil, lazyerrors.Error(err)
+		}
+		return nil, nil, lazyerrors.Error(err)
+	}
+	m.observeDecode(header, time.Since(start))
+
+	return header, &compressed, nil
+}
+
+func (compressed *OpCompressed) readFrom(bufr *bufio.Reader) error {
+	b, err := io.ReadAll(bufr)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return compressed.UnmarshalBinary(b)
+}
+
+// UnmarshalBinary reads an OpCompressed from a byte array and decodes its original body.
+func (compressed *OpCompressed) UnmarshalBinary(b []byte) error {
+	original, err := compressed.decompress(b)
+	if err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if compressed.Body, err = newMsgBody(compressed.OriginalOpCode); err != nil {
+		return err
+	}
+
+	if err = compressed.Body.UnmarshalBinary(original); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpCompressed to a byte array, compressing the original body if it was not read or compressed.
+func (compressed *OpCompressed) MarshalBinary() ([]byte, error) {
+	if compressed.b != nil {
+		return compressed.b, nil
+	}
+
+	original, err := compressed.Body.MarshalBinary()
+	if err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	compressed.UncompressedSize = int32(len(original))
+	if compressed.b, err = compressed.compress(original); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return compressed.b, nil
+}
+
+// MarshalJSON writes an OpCompressed in JSON format to a byte array.
+func (compressed *OpCompressed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"OriginalOpCode":   compressed.OriginalOpCode,
+		"UncompressedSize": compressed.UncompressedSize,
+		"Compressor":       compressed.Compressor.String(),
+		"Body":             compressed.Body,
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpCompressed)(nil)
+)
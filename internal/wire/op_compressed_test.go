@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestCompress(t *testing.T) {
+	t.Parallel()
+
+	docs := make([]types.Document, 100)
+	for i := range docs {
+		docs[i] = types.MustMakeDocument("_id", int32(i), "v", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	}
+
+	msg := &OpMsg{FlagBits: OpMsgFlags(OpMsgChecksumPresent)}
+	require.NoError(t, msg.SetSections(
+		OpMsgSection{Documents: []types.Document{types.MustMakeDocument("ok", float64(1))}},
+		OpMsgSection{Kind: 1, Identifier: "documents", Documents: docs},
+	))
+
+	for name, compressor := range map[string]Compressor{
+		"Noop": CompressorNoop,
+		"Zlib": CompressorZlib,
+	} {
+		name, compressor := name, compressor
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			l, err := BodySize(msg)
+			require.NoError(t, err)
+			header := &MsgHeader{MessageLength: int32(MsgHeaderLen + l), RequestID: 2, ResponseTo: 1, OpCode: OP_MSG}
+
+			compressedHeader, compressed, err := Compress(header, msg, compressor)
+			require.NoError(t, err)
+			assert.Equal(t, OP_COMPRESSED, compressedHeader.OpCode)
+			assert.Equal(t, int32(2), compressedHeader.RequestID)
+			assert.Equal(t, int32(1), compressedHeader.ResponseTo)
+			if compressor == CompressorZlib {
+				assert.Less(t, compressedHeader.MessageLength, header.MessageLength)
+			}
+
+			var buf bytes.Buffer
+			bufw := bufio.NewWriter(&buf)
+			require.NoError(t, WriteMessage(bufw, compressedHeader, compressed))
+			require.NoError(t, bufw.Flush())
+
+			actualHeader, actualBody, err := ReadMessage(bufio.NewReader(&buf))
+			require.NoError(t, err)
+			assert.Equal(t, compressedHeader, actualHeader)
+
+			actual, ok := actualBody.(*OpCompressed)
+			require.True(t, ok)
+			assert.Equal(t, compressor, actual.Compressor)
+			assert.Equal(t, header, actual.OriginalHeader(actualHeader))
+			assert.Equal(t, msg, actual.Body)
+		})
+	}
+}
+
+func TestReadCompressedInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		compressor Compressor
+		size       int32
+		original   []byte
+	}{
+		"Unsupported": {
+			compressor: CompressorSnappy,
+			size:       5,
+			original:   []byte{5, 0, 0, 0, 0},
+		},
+		"SizeMismatch": {
+			compressor: CompressorNoop,
+			size:       6,
+			original:   []byte{5, 0, 0, 0, 0},
+		},
+		"TooLarge": {
+			compressor: CompressorNoop,
+			size:       MaxMsgLen,
+			original:   []byte{5, 0, 0, 0, 0},
+		},
+	} {
+		name, tc := name, tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			compressed := &OpCompressed{
+				OriginalOpCode:   OP_MSG,
+				UncompressedSize: tc.size,
+				Compressor:       CompressorNoop,
+			}
+			b, err := compressed.compress(tc.original)
+			require.NoError(t, err)
+			b[8] = byte(tc.compressor)
+
+			header := &MsgHeader{MessageLength: int32(MsgHeaderLen + len(b)), RequestID: 1, OpCode: OP_COMPRESSED}
+			hb, err := header.MarshalBinary()
+			require.NoError(t, err)
+
+			_, _, err = ReadMessage(bufio.NewReader(bytes.NewReader(append(hb, b...))))
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// opDeleteSingleRemove is the flag of OpDelete to remove only the first matching document.
+const opDeleteSingleRemove = 1 << 0
+
+// OpDelete is the legacy message deleting documents of a collection, which has no reply.
+type OpDelete struct {
+	FullCollectionName string
+	SingleRemove       bool
+	Selector           types.Document
+}
+
+func (del *OpDelete) msgbody() {}
+
+func (del *OpDelete) readFrom(bufr *bufio.Reader) error {
+	var zero, flags int32
+	if err := binary.Read(bufr, binary.LittleEndian, &zero); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	var col bson.CString
+	if err := col.ReadFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+	del.FullCollectionName = string(col)
+
+	if err := binary.Read(bufr, binary.LittleEndian, &flags); err != nil {
+		return lazyerrors.Error(err)
+	}
+	del.SingleRemove = flags&opDeleteSingleRemove != 0
+
+	var doc bson.Document
+	if err := doc.ReadFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	var err error
+	if del.Selector, err = types.ConvertDocument(&doc); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinary reads an OpDelete from a byte array.
+func (del *OpDelete) UnmarshalBinary(b []byte) error {
+	bufr := bufio.NewReader(bytes.NewReader(b))
+
+	if err := del.readFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err := bufr.Peek(1); err != io.EOF {
+		return lazyerrors.Errorf("unexpected end of the OpDelete: %v", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpDelete to a byte array.
+func (del *OpDelete) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	if err := binary.Write(bufw, binary.LittleEndian, int32(0)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bson.CString(del.FullCollectionName).WriteTo(bufw); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	var flags int32
+	if del.SingleRemove {
+		flags |= opDeleteSingleRemove
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, flags); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bson.MustConvertDocument(del.Selector).WriteTo(bufw); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes an OpDelete in JSON format to a byte array.
+func (del *OpDelete) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"FullCollectionName": del.FullCollectionName,
+		"SingleRemove":       del.SingleRemove,
+		"Selector":           bson.MustConvertDocument(del.Selector),
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpDelete)(nil)
+)
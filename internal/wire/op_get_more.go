@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// OpGetMore is the legacy message reading the next documents of a cursor, which is replied to with an OpReply.
+type OpGetMore struct {
+	FullCollectionName string
+	NumberToReturn     int32
+	CursorID           int64
+}
+
+func (getMore *OpGetMore) msgbody() {}
+
+func (getMore *OpGetMore) readFrom(bufr *bufio.Reader) error {
+	var zero int32
+	if err := binary.Read(bufr, binary.LittleEndian, &zero); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	var col bson.CString
+	if err := col.ReadFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+	getMore.FullCollectionName = string(col)
+
+	if err := binary.Read(bufr, binary.LittleEndian, &getMore.NumberToReturn); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err := binary.Read(bufr, binary.LittleEndian, &getMore.CursorID); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinary reads an OpGetMore from a byte array.
+func (getMore *OpGetMore) UnmarshalBinary(b []byte) error {
+	bufr := bufio.NewReader(bytes.NewReader(b))
+
+	if err := getMore.readFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err := bufr.Peek(1); err != io.EOF {
+		return lazyerrors.Errorf("unexpected end of the OpGetMore: %v", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpGetMore to a byte array.
+func (getMore *OpGetMore) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	if err := binary.Write(bufw, binary.LittleEndian, int32(0)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bson.CString(getMore.FullCollectionName).WriteTo(bufw); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := binary.Write(bufw, binary.LittleEndian, getMore.NumberToReturn); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, getMore.CursorID); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes an OpGetMore in JSON format to a byte array.
+func (getMore *OpGetMore) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"FullCollectionName": getMore.FullCollectionName,
+		"NumberToReturn":     getMore.NumberToReturn,
+		"CursorID":           getMore.CursorID,
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpGetMore)(nil)
+)
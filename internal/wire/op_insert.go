@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// opInsertContinueOnError is the flag of OpInsert to insert the remaining documents after an error.
+const opInsertContinueOnError = 1 << 0
+
+// OpInsert is the legacy message inserting documents into a collection, which has no reply.
+type OpInsert struct {
+	ContinueOnError    bool
+	FullCollectionName string
+	Documents          []types.Document
+}
+
+func (insert *OpInsert) msgbody() {}
+
+func (insert *OpInsert) readFrom(bufr *bufio.Reader) error {
+	var flags int32
+	if err := binary.Read(bufr, binary.LittleEndian, &flags); err != nil {
+		return lazyerrors.Error(err)
+	}
+	insert.ContinueOnError = flags&opInsertContinueOnError != 0
+
+	var col bson.CString
+	if err := col.ReadFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+	insert.FullCollectionName = string(col)
+
+	for {
+		if _, err := bufr.Peek(1); err == io.EOF {
+			break
+		}
+
+		var doc bson.Document
+		if err := doc.ReadFrom(bufr); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		d, err := types.ConvertDocument(&doc)
+		if err != nil {
+			return lazyerrors.Error(err)
+		}
+		insert.Documents = append(insert.Documents, d)
+	}
+
+	return nil
+}
+
+// UnmarshalBinary reads an OpInsert from a byte array.
+func (insert *OpInsert) UnmarshalBinary(b []byte) error {
+	bufr := bufio.NewReader(bytes.NewReader(b))
+
+	if err := insert.readFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpInsert to a byte array.
+func (insert *OpInsert) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	var flags int32
+	if insert.ContinueOnError {
+		flags |= opInsertContinueOnError
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, flags); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bson.CString(insert.FullCollectionName).WriteTo(bufw); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	for _, doc := range insert.Documents {
+		if err := bson.MustConvertDocument(doc).WriteTo(bufw); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes an OpInsert in JSON format to a byte array.
+func (insert *OpInsert) MarshalJSON() ([]byte, error) {
+	docs := make([]any, len(insert.Documents))
+	for i, doc := range insert.Documents {
+		docs[i] = bson.MustConvertDocument(doc)
+	}
+
+	return json.Marshal(map[string]any{
+		"ContinueOnError":    insert.ContinueOnError,
+		"FullCollectionName": insert.FullCollectionName,
+		"Documents":          docs,
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpInsert)(nil)
+)
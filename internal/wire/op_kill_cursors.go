@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// OpKillCursors is the legacy message closing cursors, which has no reply.
+type OpKillCursors struct {
+	CursorIDs []int64
+}
+
+func (kill *OpKillCursors) msgbody() {}
+
+func (kill *OpKillCursors) readFrom(bufr *bufio.Reader) error {
+	var zero, n int32
+	if err := binary.Read(bufr, binary.LittleEndian, &zero); err != nil {
+		return lazyerrors.Error(err)
+	}
+	if err := binary.Read(bufr, binary.LittleEndian, &n); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if n < 0 || n > MaxMsgLen/8 {
+		return lazyerrors.Errorf("wire.OpKillCursors.readFrom: invalid number of cursor IDs %d", n)
+	}
+
+	kill.CursorIDs = make([]int64, n)
+	if err := binary.Read(bufr, binary.LittleEndian, kill.CursorIDs); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	return nil
+}
+
+// UnmarshalBinary reads an OpKillCursors from a byte array.
+func (kill *OpKillCursors) UnmarshalBinary(b []byte) error {
+	bufr := bufio.NewReader(bytes.NewReader(b))
+
+	if err := kill.readFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err := bufr.Peek(1); err != io.EOF {
+		return lazyerrors.Errorf("unexpected end of the OpKillCursors: %v", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpKillCursors to a byte array.
+func (kill *OpKillCursors) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	if err := binary.Write(bufw, binary.LittleEndian, int32(0)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, int32(len(kill.CursorIDs))); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, kill.CursorIDs); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes an OpKillCursors in JSON format to a byte array.
+func (kill *OpKillCursors) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"CursorIDs": kill.CursorIDs,
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpKillCursors)(nil)
+)
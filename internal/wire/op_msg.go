@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -57,8 +59,17 @@ func (msg *OpMsg) SetSections(sections ...OpMsgSection) error {
 }
 
 // Document returns the value of msg as a types.Document.
+//
+// The documents of kind 1 sections are added to the document of the kind 0 section
+// as arrays named by their identifiers. Drivers may split large batches into several kind 1 sections
+// with the same identifier, send them before the kind 0 section or send them without documents,
+// so the documents of sections with the same identifier are concatenated in their order.
 func (msg *OpMsg) Document() (types.Document, error) {
 	var doc types.Document
+	var body bool
+
+	var identifiers []string
+	sequences := make(map[string]*types.Array)
 
 	for _, section := range msg.sections {
 		switch section.Kind {
@@ -66,9 +77,10 @@ func (msg *OpMsg) Document() (types.Document, error) {
 			if l := len(section.Documents); l != 1 {
 				return doc, lazyerrors.Errorf("wire.OpMsg.Document: %d documents in kind 0 section", l)
 			}
-			if m := doc.Map(); len(m) != 0 {
-				return doc, lazyerrors.Errorf("wire.OpMsg.Document: doc is not empty already: %+v", m)
+			if body {
+				return doc, lazyerrors.New("wire.OpMsg.Document: more than one kind 0 section")
 			}
+			body = true
 
 			// do a shallow copy of the document that we would modify if there are kind 1 sections
 			doc = types.MustMakeDocument()
@@ -82,28 +94,42 @@ func (msg *OpMsg) Document() (types.Document, error) {
 			if section.Identifier == "" {
 				return doc, lazyerrors.New("wire.OpMsg.Document: empty section identifier")
 			}
-			m := doc.Map()
-			if len(m) == 0 {
-				return doc, lazyerrors.New("wire.OpMsg.Document: doc is empty")
-			}
-			if _, ok := m[section.Identifier]; ok {
-				return doc, lazyerrors.Errorf("wire.OpMsg.Document: doc already has %q key", section.Identifier)
+
+			a, ok := sequences[section.Identifier]
+			if !ok {
+				a = types.MakeArray(len(section.Documents)) // may be zero
+				sequences[section.Identifier] = a
+				identifiers = append(identifiers, section.Identifier)
 			}
 
-			a := types.MakeArray(len(section.Documents)) // may be zero
 			for _, d := range section.Documents {
 				if err := a.Append(d); err != nil {
 					return doc, lazyerrors.Error(err)
 				}
 			}
 
-			doc.Set(section.Identifier, a)
-
 		default:
 			return doc, lazyerrors.Errorf("wire.OpMsg.Document: unknown kind %d", section.Kind)
 		}
 	}
 
+	if len(identifiers) == 0 {
+		return doc, nil
+	}
+
+	if !body {
+		return doc, lazyerrors.New("wire.OpMsg.Document: doc is empty")
+	}
+
+	m := doc.Map()
+	for _, identifier := range identifiers {
+		if _, ok := m[identifier]; ok {
+			return doc, lazyerrors.Errorf("wire.OpMsg.Document: doc already has %q key", identifier)
+		}
+
+		doc.Set(identifier, sequences[identifier])
+	}
+
 	return doc, nil
 }
 
@@ -198,7 +224,7 @@ func (msg *OpMsg) readFrom(bufr *bufio.Reader) error {
 		return lazyerrors.Error(err)
 	}
 
-	// TODO validate checksum
+	// the checksum covers the header, so it is validated by ReadMessage
 
 	return nil
 }
@@ -224,14 +250,29 @@ func (msg *OpMsg) MarshalBinary() ([]byte, error) {
 	var buf bytes.Buffer
 	bufw := bufio.NewWriter(&buf)
 
-	if err := binary.Write(bufw, binary.LittleEndian, msg.FlagBits); err != nil {
+	if err := msg.writeTo(bufw); err != nil {
 		return nil, lazyerrors.Error(err)
 	}
 
-	for _, section := range msg.sections {
-		if err := bufw.WriteByte(section.Kind); err != nil {
+	if msg.FlagBits.FlagSet(OpMsgChecksumPresent) {
+		if err := binary.Write(bufw, binary.LittleEndian, msg.Checksum); err != nil {
 			return nil, lazyerrors.Error(err)
 		}
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// size implements streamedBody interface.
+func (msg *OpMsg) size() (int, error) {
+	l := 4 // flag bits
+
+	for _, section := range msg.sections {
+		l++ // kind
 
 		switch section.Kind {
 		case 0:
@@ -239,59 +280,76 @@ func (msg *OpMsg) MarshalBinary() ([]byte, error) {
 				panic(fmt.Errorf("%d documents in section with kind 0", l))
 			}
 
-			d, err := bson.ConvertDocument(section.Documents[0])
-			if err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-			if d.WriteTo(bufw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
-
 		case 1:
-			var secBuf bytes.Buffer
-			secw := bufio.NewWriter(&secBuf)
+			l += 4 + len(section.Identifier) + 1 // size and identifier
 
-			if err := bson.CString(section.Identifier).WriteTo(secw); err != nil {
-				return nil, lazyerrors.Error(err)
-			}
+		default:
+			return 0, lazyerrors.Errorf("kind is %d", section.Kind)
+		}
 
-			for _, doc := range section.Documents {
-				d, err := bson.ConvertDocument(doc)
-				if err != nil {
-					return nil, lazyerrors.Error(err)
-				}
-				if d.WriteTo(secw); err != nil {
-					return nil, lazyerrors.Error(err)
-				}
+		dl, err := documentsSize(section.Documents)
+		if err != nil {
+			return 0, lazyerrors.Error(err)
+		}
+		l += dl
+	}
+
+	if msg.FlagBits.FlagSet(OpMsgChecksumPresent) {
+		l += 4
+	}
+
+	return l, nil
+}
+
+// writeTo implements streamedBody interface.
+//
+// The documents of the sections are written one by one, so that large kind 1 sections are not buffered.
+func (msg *OpMsg) writeTo(w *bufio.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, msg.FlagBits); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	for _, section := range msg.sections {
+		if err := w.WriteByte(section.Kind); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		switch section.Kind {
+		case 0:
+			if l := len(section.Documents); l != 1 {
+				panic(fmt.Errorf("%d documents in section with kind 0", l))
 			}
 
-			if err := secw.Flush(); err != nil {
-				return nil, lazyerrors.Error(err)
+		case 1:
+			dl, err := documentsSize(section.Documents)
+			if err != nil {
+				return lazyerrors.Error(err)
 			}
 
-			if err := binary.Write(bufw, binary.LittleEndian, int32(secBuf.Len()+4)); err != nil {
-				return nil, lazyerrors.Error(err)
+			l := 4 + len(section.Identifier) + 1 + dl
+			if err := binary.Write(w, binary.LittleEndian, int32(l)); err != nil {
+				return lazyerrors.Error(err)
 			}
-			if _, err := bufw.Write(secBuf.Bytes()); err != nil {
-				return nil, lazyerrors.Error(err)
+			if err := bson.CString(section.Identifier).WriteTo(w); err != nil {
+				return lazyerrors.Error(err)
 			}
 
 		default:
-			return nil, lazyerrors.Errorf("kind is %d", section.Kind)
+			return lazyerrors.Errorf("kind is %d", section.Kind)
 		}
-	}
 
-	if msg.FlagBits.FlagSet(OpMsgChecksumPresent) {
-		if err := binary.Write(bufw, binary.LittleEndian, msg.Checksum); err != nil {
-			return nil, lazyerrors.Error(err)
+		for _, doc := range section.Documents {
+			d, err := bson.ConvertDocument(doc)
+			if err != nil {
+				return lazyerrors.Error(err)
+			}
+			if err := d.WriteTo(w); err != nil {
+				return lazyerrors.Error(err)
+			}
 		}
 	}
 
-	if err := bufw.Flush(); err != nil {
-		return nil, lazyerrors.Error(err)
-	}
-
-	return buf.Bytes(), nil
+	return nil
 }
 
 // MarshalJSON writes an OpMsg in JSON format to a byte array.
@@ -326,7 +384,26 @@ func (msg *OpMsg) MarshalJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// documentsSize returns the total length of the marshaled documents.
+func documentsSize(docs []types.Document) (int, error) {
+	var l int
+	for _, doc := range docs {
+		d, err := bson.ConvertDocument(doc)
+		if err != nil {
+			return 0, lazyerrors.Error(err)
+		}
+		dl, err := d.Size()
+		if err != nil {
+			return 0, lazyerrors.Error(err)
+		}
+		l += dl
+	}
+
+	return l, nil
+}
+
 // check interfaces
 var (
-	_ MsgBody = (*OpMsg)(nil)
+	_ MsgBody      = (*OpMsg)(nil)
+	_ streamedBody = (*OpMsg)(nil)
 )
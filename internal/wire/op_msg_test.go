@@ -1,5 +1,7 @@
 // SPDX-FileCopyrightText: 2021 FerretDB Inc.
 //
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
 // SPDX-License-Identifier: Apache-2.0
 
 // Copyright 2021 FerretDB Inc.
@@ -19,8 +21,13 @@
 package wire
 
 import (
+	"fmt"
+	"math/rand"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
 	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/testutil"
 )
@@ -167,3 +174,108 @@ func TestMsg(t *testing.T) {
 func FuzzMsg(f *testing.F) {
 	fuzzMessages(f, msgTestCases)
 }
+
+// TestMsgSectionLayouts checks random valid section layouts like drivers send them for large batches:
+// kind 1 sections split into several sections with the same identifier, sections without documents
+// and kind 1 sections before the kind 0 section.
+func TestMsgSectionLayouts(t *testing.T) {
+	t.Parallel()
+
+	for seed := int64(0); seed < 200; seed++ {
+		seed := seed
+		t.Run(fmt.Sprint(seed), func(t *testing.T) {
+			t.Parallel()
+
+			r := rand.New(rand.NewSource(seed))
+
+			body := types.MustMakeDocument("insert", "values", "$db", "test")
+			expected := map[string]any{"insert": "values", "$db": "test"}
+
+			// the sections in order, kind 0 is placed later
+			var sequences [][]OpMsgSection
+			for _, identifier := range []string{"documents", "updates", "deletes"}[:r.Intn(4)] {
+				docs := make([]types.Document, r.Intn(6))
+				a := types.MakeArray(len(docs))
+				for i := range docs {
+					docs[i] = types.MustMakeDocument("_id", int32(i), "identifier", identifier)
+					require.NoError(t, a.Append(docs[i]))
+				}
+				expected[identifier] = a
+
+				// split into segments, some of them empty
+				var sections []OpMsgSection
+				for len(docs) > 0 || len(sections) == 0 || r.Intn(3) == 0 {
+					n := r.Intn(len(docs) + 1)
+					sections = append(sections, OpMsgSection{Kind: 1, Identifier: identifier, Documents: docs[:n]})
+					docs = docs[n:]
+				}
+				sequences = append(sequences, sections)
+			}
+
+			// interleave the segments of the identifiers randomly, keeping their order
+			var sections []OpMsgSection
+			for len(sequences) > 0 {
+				i := r.Intn(len(sequences))
+				sections = append(sections, sequences[i][0])
+				if sequences[i] = sequences[i][1:]; len(sequences[i]) == 0 {
+					sequences = append(sequences[:i], sequences[i+1:]...)
+				}
+			}
+
+			pos := r.Intn(len(sections) + 1)
+			sections = append(sections[:pos], append([]OpMsgSection{{Documents: []types.Document{body}}}, sections[pos:]...)...)
+
+			var msg OpMsg
+			require.NoError(t, msg.SetSections(sections...))
+			if r.Intn(2) == 0 {
+				msg.FlagBits = OpMsgFlags(OpMsgChecksumPresent)
+				msg.Checksum = r.Uint32()
+			}
+
+			b, err := msg.MarshalBinary()
+			require.NoError(t, err)
+
+			var actual OpMsg
+			require.NoError(t, actual.UnmarshalBinary(b))
+			assert.Equal(t, msg.Checksum, actual.Checksum)
+
+			doc, err := actual.Document()
+			require.NoError(t, err)
+			assert.Equal(t, expected, doc.Map())
+		})
+	}
+}
+
+func TestMsgDocumentErrors(t *testing.T) {
+	t.Parallel()
+
+	body := types.MustMakeDocument("insert", "values", "documents", types.MakeArray(0), "$db", "test")
+
+	for name, tc := range map[string]struct {
+		sections []OpMsgSection
+		err      string
+	}{
+		"TwoBodies": {
+			sections: []OpMsgSection{{Documents: []types.Document{body}}, {Documents: []types.Document{body}}},
+			err:      "more than one kind 0 section",
+		},
+		"NoBody": {
+			sections: []OpMsgSection{{Kind: 1, Identifier: "documents"}},
+			err:      "doc is empty",
+		},
+		"DuplicateKey": {
+			sections: []OpMsgSection{{Kind: 1, Identifier: "documents"}, {Documents: []types.Document{body}}},
+			err:      `doc already has "documents" key`,
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := OpMsg{sections: tc.sections}
+			_, err := msg.Document()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
@@ -91,37 +91,59 @@ func (reply *OpReply) UnmarshalBinary(b []byte) error {
 
 // MarshalBinary writes an OpReply to a byte array.
 func (reply *OpReply) MarshalBinary() ([]byte, error) {
-	if l := len(reply.Documents); int32(l) != reply.NumberReturned {
-		return nil, lazyerrors.Errorf("wire.OpReply.MarshalBinary: len(Documents)=%d, NumberReturned=%d", l, reply.NumberReturned)
-	}
-
 	var buf bytes.Buffer
 	bufw := bufio.NewWriter(&buf)
 
-	if err := binary.Write(bufw, binary.LittleEndian, reply.ResponseFlags); err != nil {
-		return nil, lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+	if err := reply.writeTo(bufw); err != nil {
+		return nil, err
 	}
-	if err := binary.Write(bufw, binary.LittleEndian, reply.CursorID); err != nil {
-		return nil, lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+
+	if err := bufw.Flush(); err != nil {
+		return nil, err
 	}
-	if err := binary.Write(bufw, binary.LittleEndian, reply.StartingFrom); err != nil {
-		return nil, lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+
+	return buf.Bytes(), nil
+}
+
+// size implements streamedBody interface.
+func (reply *OpReply) size() (int, error) {
+	l, err := documentsSize(reply.Documents)
+	if err != nil {
+		return 0, lazyerrors.Errorf("wire.OpReply.size: %w", err)
 	}
-	if err := binary.Write(bufw, binary.LittleEndian, reply.NumberReturned); err != nil {
-		return nil, lazyerrors.Errorf("wire.OpReply.UnmarshalBinary (binary.Write): %w", err)
+
+	// flags, cursor ID, starting from and number returned
+	return 4 + 8 + 4 + 4 + l, nil
+}
+
+// writeTo implements streamedBody interface.
+//
+// The documents are written one by one, so that large batches are not buffered.
+func (reply *OpReply) writeTo(w *bufio.Writer) error {
+	if l := len(reply.Documents); int32(l) != reply.NumberReturned {
+		return lazyerrors.Errorf("wire.OpReply.MarshalBinary: len(Documents)=%d, NumberReturned=%d", l, reply.NumberReturned)
 	}
 
-	for _, doc := range reply.Documents {
-		if err := bson.MustConvertDocument(doc).WriteTo(bufw); err != nil {
-			return nil, lazyerrors.Errorf("wire.OpReply.MarshalBinary: %w", err)
-		}
+	if err := binary.Write(w, binary.LittleEndian, reply.ResponseFlags); err != nil {
+		return lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, reply.CursorID); err != nil {
+		return lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, reply.StartingFrom); err != nil {
+		return lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, reply.NumberReturned); err != nil {
+		return lazyerrors.Errorf("wire.OpReply.MarshalBinary (binary.Write): %w", err)
 	}
 
-	if err := bufw.Flush(); err != nil {
-		return nil, err
+	for _, doc := range reply.Documents {
+		if err := bson.MustConvertDocument(doc).WriteTo(w); err != nil {
+			return lazyerrors.Errorf("wire.OpReply.MarshalBinary: %w", err)
+		}
 	}
 
-	return buf.Bytes(), nil
+	return nil
 }
 
 // MarshalJSON marshals an OpReply in JSON format to a byte array.
@@ -145,5 +167,6 @@ func (reply *OpReply) MarshalJSON() ([]byte, error) {
 
 // check interfaces
 var (
-	_ MsgBody = (*OpReply)(nil)
+	_ MsgBody      = (*OpReply)(nil)
+	_ streamedBody = (*OpReply)(nil)
 )
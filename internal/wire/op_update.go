@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/bson"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/util/lazyerrors"
+)
+
+// The flags of OpUpdate.
+const (
+	opUpdateUpsert      = 1 << 0
+	opUpdateMultiUpdate = 1 << 1
+)
+
+// OpUpdate is the legacy message updating documents of a collection, which has no reply.
+type OpUpdate struct {
+	FullCollectionName string
+	Upsert             bool
+	MultiUpdate        bool
+	Selector           types.Document
+	Update             types.Document
+}
+
+func (update *OpUpdate) msgbody() {}
+
+func (update *OpUpdate) readFrom(bufr *bufio.Reader) error {
+	var zero, flags int32
+	if err := binary.Read(bufr, binary.LittleEndian, &zero); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	var col bson.CString
+	if err := col.ReadFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+	update.FullCollectionName = string(col)
+
+	if err := binary.Read(bufr, binary.LittleEndian, &flags); err != nil {
+		return lazyerrors.Error(err)
+	}
+	update.Upsert = flags&opUpdateUpsert != 0
+	update.MultiUpdate = flags&opUpdateMultiUpdate != 0
+
+	for _, d := range []*types.Document{&update.Selector, &update.Update} {
+		var doc bson.Document
+		if err := doc.ReadFrom(bufr); err != nil {
+			return lazyerrors.Error(err)
+		}
+
+		var err error
+		if *d, err = types.ConvertDocument(&doc); err != nil {
+			return lazyerrors.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// UnmarshalBinary reads an OpUpdate from a byte array.
+func (update *OpUpdate) UnmarshalBinary(b []byte) error {
+	bufr := bufio.NewReader(bytes.NewReader(b))
+
+	if err := update.readFrom(bufr); err != nil {
+		return lazyerrors.Error(err)
+	}
+
+	if _, err := bufr.Peek(1); err != io.EOF {
+		return lazyerrors.Errorf("unexpected end of the OpUpdate: %v", err)
+	}
+
+	return nil
+}
+
+// MarshalBinary writes an OpUpdate to a byte array.
+func (update *OpUpdate) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	bufw := bufio.NewWriter(&buf)
+
+	if err := binary.Write(bufw, binary.LittleEndian, int32(0)); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	if err := bson.CString(update.FullCollectionName).WriteTo(bufw); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	var flags int32
+	if update.Upsert {
+		flags |= opUpdateUpsert
+	}
+	if update.MultiUpdate {
+		flags |= opUpdateMultiUpdate
+	}
+	if err := binary.Write(bufw, binary.LittleEndian, flags); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	for _, doc := range []types.Document{update.Selector, update.Update} {
+		if err := bson.MustConvertDocument(doc).WriteTo(bufw); err != nil {
+			return nil, lazyerrors.Error(err)
+		}
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return nil, lazyerrors.Error(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON writes an OpUpdate in JSON format to a byte array.
+func (update *OpUpdate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"FullCollectionName": update.FullCollectionName,
+		"Upsert":             update.Upsert,
+		"MultiUpdate":        update.MultiUpdate,
+		"Selector":           bson.MustConvertDocument(update.Selector),
+		"Update":             bson.MustConvertDocument(update.Update),
+	})
+}
+
+// check interfaces
+var (
+	_ MsgBody = (*OpUpdate)(nil)
+)
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+// redactedReplyFields are the top-level fields of command documents whose values are kept by redaction,
+// besides the command name and the database, as they contain no data of clients.
+var redactedReplyFields = []string{"ok", "code", "codeName"}
+
+// DumpRedactedMsgBody returns the body like DumpMsgBody, but with the shape of its documents only:
+// values are replaced by their BSON type, like "string" or "int", so that logs contain no documents, filters or credentials.
+// The command name, the database and the status of replies are kept.
+func DumpRedactedMsgBody(body MsgBody) string {
+	return DumpMsgBody(redactMsgBody(body))
+}
+
+// redactMsgBody returns a copy of the body with redacted documents.
+func redactMsgBody(body MsgBody) MsgBody {
+	switch body := body.(type) {
+	case *OpMsg:
+		res := &OpMsg{
+			FlagBits: body.FlagBits,
+			Checksum: body.Checksum,
+			sections: make([]OpMsgSection, len(body.sections)),
+		}
+		for i, section := range body.sections {
+			res.sections[i] = OpMsgSection{
+				Kind:       section.Kind,
+				Identifier: section.Identifier,
+				Documents:  make([]types.Document, len(section.Documents)),
+			}
+			for j, doc := range section.Documents {
+				if section.Kind == 0 {
+					res.sections[i].Documents[j] = redactCommand(doc)
+				} else {
+					res.sections[i].Documents[j] = redactDocument(doc)
+				}
+			}
+		}
+		return res
+
+	case *OpQuery:
+		res := *body
+		if strings.HasSuffix(body.FullCollectionName, ".$cmd") {
+			res.Query = redactCommand(body.Query)
+		} else {
+			res.Query = redactDocument(body.Query)
+		}
+		if body.ReturnFieldsSelector != nil {
+			selector := redactDocument(*body.ReturnFieldsSelector)
+			res.ReturnFieldsSelector = &selector
+		}
+		return &res
+
+	case *OpReply:
+		res := *body
+		res.Documents = make([]types.Document, len(body.Documents))
+		for i, doc := range body.Documents {
+			res.Documents[i] = redactDocument(doc, redactedReplyFields...)
+		}
+		return &res
+
+	case *OpInsert:
+		res := *body
+		res.Documents = make([]types.Document, len(body.Documents))
+		for i, doc := range body.Documents {
+			res.Documents[i] = redactDocument(doc)
+		}
+		return &res
+
+	case *OpUpdate:
+		res := *body
+		res.Selector = redactDocument(body.Selector)
+		res.Update = redactDocument(body.Update)
+		return &res
+
+	case *OpDelete:
+		res := *body
+		res.Selector = redactDocument(body.Selector)
+		return &res
+
+	case *OpCompressed:
+		res := *body
+		res.Body = redactMsgBody(body.Body)
+		res.b = nil
+		return &res
+
+	default:
+		return body
+	}
+}
+
+// redactCommand returns the redacted command or reply document,
+// keeping the command name, the database and the redactedReplyFields.
+func redactCommand(doc types.Document) types.Document {
+	if len(doc.Keys()) == 0 {
+		return doc
+	}
+
+	return redactDocument(doc, append([]string{doc.Command(), "$db"}, redactedReplyFields...)...)
+}
+
+// redactDocument returns the document with the shapes of its values,
+// keeping the values of the given top-level fields if they are strings, numbers or booleans.
+func redactDocument(doc types.Document, keep ...string) types.Document {
+	m := doc.Map()
+	pairs := make([]any, 0, 2*len(doc.Keys()))
+
+	for _, k := range doc.Keys() {
+		v := redactValue(m[k])
+		for _, kk := range keep {
+			if k != kk {
+				continue
+			}
+
+			switch m[k].(type) {
+			case string, float64, int32, int64, bool:
+				v = m[k]
+			}
+		}
+
+		pairs = append(pairs, k, v)
+	}
+
+	// the keys are the ones of a valid document
+	return types.MustMakeDocument(pairs...)
+}
+
+// redactValue returns the shape of the value: documents and arrays with the shapes of their values,
+// and the BSON type alias of other values, like "string" or "int".
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case types.Document:
+		return redactDocument(v)
+	case *types.Array:
+		res := types.MakeArray(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e, _ := v.Get(i)
+			_ = res.Append(redactValue(e))
+		}
+		return res
+	case float64:
+		return "double"
+	case string:
+		return "string"
+	case types.Binary:
+		return "binData"
+	case types.ObjectID:
+		return "objectId"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "date"
+	case nil:
+		return "null"
+	case types.Regex:
+		return "regex"
+	case types.Code:
+		return "javascript"
+	case types.CodeWithScope:
+		return "javascriptWithScope"
+	case int32:
+		return "int"
+	case types.Timestamp:
+		return "timestamp"
+	case int64:
+		return "long"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2022 SAP SE or an SAP affiliate company
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package wire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SAP/sap-hana-compatibility-layer-for-mongodb-wire-protocol/internal/types"
+)
+
+func TestDumpRedactedMsgBody(t *testing.T) {
+	t.Parallel()
+
+	var msg OpMsg
+	err := msg.SetSections(OpMsgSection{
+		Documents: []types.Document{types.MustMakeDocument(
+			"update", "users",
+			"ordered", true,
+			"$db", "app",
+		)},
+	}, OpMsgSection{
+		Kind:       1,
+		Identifier: "updates",
+		Documents: []types.Document{types.MustMakeDocument(
+			"q", types.MustMakeDocument("email", "alice@example.com"),
+			"u", types.MustMakeDocument("$set", types.MustMakeDocument("password", "secret", "logins", int32(3))),
+			"ok", float64(1),
+		)},
+	})
+	require.NoError(t, err)
+
+	expected := types.MustMakeDocument(
+		"update", "users",
+		"ordered", "bool",
+		"$db", "app",
+		"updates", types.MustNewArray(types.MustMakeDocument(
+			"q", types.MustMakeDocument("email", "string"),
+			"u", types.MustMakeDocument("$set", types.MustMakeDocument("password", "string", "logins", "int")),
+			"ok", "double",
+		)),
+	)
+	redacted := redactMsgBody(&msg).(*OpMsg)
+	actual, err := redacted.Document()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	dump := DumpRedactedMsgBody(&msg)
+	assert.NotContains(t, dump, "alice@example.com")
+	assert.NotContains(t, dump, "secret")
+
+	// the original message is not changed
+	assert.Contains(t, DumpMsgBody(&msg), "secret")
+
+	reply := &OpReply{
+		NumberReturned: 1,
+		Documents: []types.Document{types.MustMakeDocument(
+			"_id", types.ObjectID{1},
+			"errmsg", "E11000 duplicate key error",
+			"code", int32(11000),
+			"ok", float64(0),
+		)},
+	}
+	expectedReply := types.MustMakeDocument(
+		"_id", "objectId",
+		"errmsg", "string",
+		"code", int32(11000),
+		"ok", float64(0),
+	)
+	assert.Equal(t, expectedReply, redactMsgBody(reply).(*OpReply).Documents[0])
+}